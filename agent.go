@@ -1,25 +1,114 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/rpc"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/robertknight/1pass/onepass"
 )
 
-var agentConnAddr = os.ExpandEnv("$HOME/.1pass.sock")
+var agentConnAddr = homeDir() + "/.1pass.sock"
 var agentBinaryVersion = appBinaryVersion()
 
+// version of the RPC protocol used between the client and agent.
+// This must be incremented when agent methods or their arguments
+// change in a way which older clients or agents cannot handle.
+//
+// The version is also reported to JSON-RPC clients, which require
+// version 4 or later. Version 5 adds WaitForEvents().
+// See docs/agent-protocol.md
+const agentProtocolVersion = 5
+
+// oldest protocol version which this client or agent can
+// still talk to
+const agentMinProtocolVersion = 1
+
+// folder where the agent stores encrypted indexes
+// of the items in unlocked vaults
+var agentIndexDir = homeDir() + "/.1pass-index"
+
 const defaultUnlockDelay = 2 * time.Minute
 
+// maximum time the client waits for the agent to respond to a
+// request. This is long enough for requests which need the user
+// to authenticate, such as unlocking with Touch ID or polkit.
+const defaultAgentCallTimeout = 2 * time.Minute
+
+// maximum time the client waits for the agent to respond
+// when connecting, after which the agent is assumed to be hung
+const agentConnectTimeout = 5 * time.Second
+
+// default time the client waits for a newly started
+// agent to accept connections and the initial interval
+// between attempts to connect, which doubles after each
+// attempt up to maxAgentDialInterval
+const (
+	defaultAgentDialTimeout = 1 * time.Second
+	defaultAgentDialBackoff = 10 * time.Millisecond
+	maxAgentDialInterval    = 250 * time.Millisecond
+)
+
+// period of inactivity after which session
+// tokens created by SignIn() expire
+const defaultSessionDuration = 30 * time.Minute
+
+// environment variable from which the client
+// reads the session token printed by 'signin'
+const sessionEnvVar = "ONEPASS_SESSION"
+
+var errSessionRequired = errors.New("Vault was unlocked with 'signin' and requires a session token")
+
 type vaultData struct {
 	keys     onepass.KeyDict
 	autoLock *time.Timer
+
+	// reports changes to the vault, including those made by
+	// other processes such as a sync client. Set by watchVault()
+	// once the vault's items have been listed.
+	watcher *onepass.Subscription
+
+	// index of item overview data, loaded lazily
+	// on the first ListItems() call
+	index *onepass.ItemIndex
+
+	// map of session token -> expiry time for vaults unlocked
+	// with SignIn(). If non-nil, requests for the vault must
+	// present a valid token.
+	sessions map[string]time.Time
+
+	// keys encrypted while the vault is idle, see wrapIdleKeys().
+	// While these are set, keys is nil.
+	wrappedKeys []byte
+	wrappingKey []byte
+
+	lastUsed  time.Time
+	idleTimer *time.Timer
+}
+
+// checks that token is a valid session for the vault,
+// if the vault requires one
+func (data *vaultData) checkSession(token string) error {
+	if data.sessions == nil {
+		return nil
+	}
+	expiry, ok := data.sessions[token]
+	if !ok || time.Now().After(expiry) {
+		return errors.New("Invalid or expired session token")
+	}
+	return nil
 }
 
 // OnePassAgent is an RPC service for temporarily
@@ -28,36 +117,153 @@ type vaultData struct {
 type OnePassAgent struct {
 	rpcServer rpc.Server
 
-	mu     sync.Mutex // protects `vaults`
+	// protects `vaults`. Item encryption and decryption hold
+	// a read lock so that keys are not wiped while in use.
+	mu     sync.RWMutex
 	vaults map[string]vaultData
+
+	// keys kept for unlocking auto-locked vaults
+	// with Touch ID, see BiometricUnlock()
+	biometric map[string]biometricKeys
+
+	// OS-level authentication required before decrypting
+	// items: 'polkit', 'pam' or empty. See authGateHelp()
+	authGate string
+
+	// map of vault path -> time until which items can be
+	// decrypted without authenticating again, guarded by authMu
+	authenticated map[string]time.Time
+	authMu        sync.Mutex
+
+	// listener for client connections, set by ServeAt()
+	listener net.Listener
+
+	// listener for remote client connections, set by ServeTCP()
+	tcpListener net.Listener
+
+	// recent changes to vaults, see WaitForEvents().
+	// newEvents is closed when an event is added.
+	events    []AgentEvent
+	eventSeq  uint64
+	newEvents chan bool
+	eventsMu  sync.Mutex
 }
 
 type OnePassAgentClient struct {
 	rpcClient *rpc.Client
 	VaultPath string
 	Info      AgentInfo
+
+	// Protocol version negotiated with the agent or zero
+	// if the client and agent are incompatible
+	Protocol int
+
+	// Period after an Unlock() during which the vault can be
+	// unlocked again with BiometricUnlock()
+	BiometricWindow time.Duration
+
+	// Period of inactivity after which the agent locks the
+	// vault or zero to use the default
+	UnlockDelay time.Duration
+
+	// Session token returned by SignIn(), which is
+	// presented with each request for the vault
+	Session string
+
+	// Context for requests to the agent. Pending requests fail
+	// when it is done, eg. because the user pressed Ctrl-C.
+	Context context.Context
+
+	// Maximum time to wait for the agent to respond to each
+	// request or zero to wait indefinitely
+	CallTimeout time.Duration
 }
 
 type CryptArgs struct {
 	VaultPath string
+	Session   string
 	KeyName   string
 	Data      []byte
+
+	// how long the client waits for a response. The agent abandons
+	// requests which it cannot handle within this time of receiving
+	// them. Zero for clients which do not set a limit.
+	Timeout time.Duration
+}
+
+type SessionArgs struct {
+	VaultPath string
+	Session   string
+	Timeout   time.Duration
 }
 
 type UnlockArgs struct {
 	VaultPath   string
 	MasterPwd   string
 	ExpireAfter time.Duration
+	Timeout     time.Duration
+
+	// period after unlocking during which the vault may be
+	// unlocked again with Touch ID once it auto-locks.
+	// Zero disables biometric unlock.
+	BiometricWindow time.Duration
 }
 
 type RefreshArgs struct {
 	VaultPath   string
+	Session     string
 	ExpireAfter time.Duration
+	Timeout     time.Duration
+}
+
+var errRequestExpired = errors.New("The request timed out before the agent could handle it")
+
+// requestContext returns a context for handling a request which is
+// done once the client that made it has stopped waiting for the
+// response, as given by the request's timeout
+func requestContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// checkRequest returns errRequestExpired if the client which
+// made a request has stopped waiting for the response
+func checkRequest(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return errRequestExpired
+	}
+	return nil
 }
 
 type AgentInfo struct {
 	BinaryVersion time.Time
 	Pid           int
+
+	// range of protocol versions supported by the agent.
+	// These are zero for agents which pre-date protocol
+	// versioning.
+	ProtocolVersion    int
+	MinProtocolVersion int
+}
+
+// negotiateProtocol returns the protocol version to use with an
+// agent, which is the newest version supported by both the client
+// and agent, or an error if they have no version in common
+func negotiateProtocol(info AgentInfo) (int, error) {
+	if info.ProtocolVersion == 0 {
+		return 0, errors.New("The agent does not support protocol versioning")
+	}
+	version := agentProtocolVersion
+	if info.ProtocolVersion < version {
+		version = info.ProtocolVersion
+	}
+	if version < agentMinProtocolVersion || version < info.MinProtocolVersion {
+		return 0, fmt.Errorf("The agent supports protocol versions %d-%d, the client supports %d-%d",
+			info.MinProtocolVersion, info.ProtocolVersion, agentMinProtocolVersion, agentProtocolVersion)
+	}
+	return version, nil
 }
 
 func appBinaryVersion() time.Time {
@@ -70,70 +276,272 @@ func appBinaryVersion() time.Time {
 
 func NewAgent() OnePassAgent {
 	return OnePassAgent{
-		vaults: map[string]vaultData{},
+		vaults:        map[string]vaultData{},
+		biometric:     map[string]biometricKeys{},
+		authenticated: map[string]time.Time{},
 	}
 }
 
 // Encrypt encrypts data for storage in an item in a 1Password vault
 // The vault must previously have been unlocked using an Unlock() call
 func (agent *OnePassAgent) Encrypt(args CryptArgs, cipherText *[]byte) error {
-	agent.mu.Lock()
-	defer agent.mu.Unlock()
+	ctx, cancel := requestContext(args.Timeout)
+	defer cancel()
+	err := agent.useKeys(args.VaultPath)
+	if err != nil {
+		return err
+	}
 
-	vaultData, ok := agent.vaults[args.VaultPath]
-	if !ok {
-		return errors.New("No such vault")
+	agent.mu.RLock()
+	defer agent.mu.RUnlock()
+	if err := checkRequest(ctx); err != nil {
+		return err
 	}
 
-	itemKey, ok := vaultData.keys[args.KeyName]
-	if !ok {
-		return errors.New("No such key")
+	itemKey, err := agent.itemKey(args.VaultPath, args.Session, args.KeyName)
+	if err != nil {
+		return err
 	}
-	var err error
 	*cipherText, err = onepass.EncryptItemData(itemKey, args.Data)
 	return err
 }
 
 func (agent *OnePassAgent) Decrypt(args CryptArgs, plainText *[]byte) error {
-	agent.mu.Lock()
-	defer agent.mu.Unlock()
+	ctx, cancel := requestContext(args.Timeout)
+	defer cancel()
+	err := agent.checkUserAuth(ctx, args)
+	if err == nil {
+		err = agent.useKeys(args.VaultPath)
+	}
+	if err != nil {
+		return err
+	}
 
-	vaultData, ok := agent.vaults[args.VaultPath]
-	if !ok {
-		return errors.New("No such vault")
+	agent.mu.RLock()
+	defer agent.mu.RUnlock()
+	if err := checkRequest(ctx); err != nil {
+		return err
 	}
-	itemKey, ok := vaultData.keys[args.KeyName]
-	if !ok {
-		return errors.New("No such key")
+
+	itemKey, err := agent.itemKey(args.VaultPath, args.Session, args.KeyName)
+	if err != nil {
+		return err
 	}
-	var err error
 	*plainText, err = onepass.DecryptItemData(itemKey, args.Data)
 	return err
 }
 
+// returns the named key for an unlocked vault. The caller must
+// hold at least a read lock on agent.mu while using the key.
+func (agent *OnePassAgent) itemKey(vaultPath string, session string, keyName string) ([]byte, error) {
+	vaultData, ok := agent.vaults[vaultPath]
+	if !ok {
+		return nil, errors.New("No such vault")
+	}
+	err := vaultData.checkSession(session)
+	if err != nil {
+		return nil, err
+	}
+	itemKey, ok := vaultData.keys[keyName]
+	if !ok {
+		debugf("Key cache miss for %s in '%s'", keyName, vaultPath)
+		return nil, onepass.KeyLockedError{Level: keyName}
+	}
+	debugf("Key cache hit for %s in '%s'", keyName, vaultPath)
+	return itemKey, nil
+}
+
 func (agent *OnePassAgent) Unlock(args UnlockArgs, ok *bool) error {
+	ctx, cancel := requestContext(args.Timeout)
+	defer cancel()
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+	if err := checkRequest(ctx); err != nil {
+		return err
+	}
+
+	if existing, unlocked := agent.vaults[args.VaultPath]; unlocked && existing.sessions != nil {
+		return errSessionRequired
+	}
+	err := agent.unlock(args)
+	if err != nil {
+		return err
+	}
+	*ok = true
+	return nil
+}
+
+// SignIn unlocks a vault and returns a new session token for it.
+// Until the vault is locked, requests for it must present a valid
+// session token rather than relying only on access to the agent's
+// socket. Sessions expire after a period of inactivity.
+func (agent *OnePassAgent) SignIn(args UnlockArgs, token *string) error {
+	ctx, cancel := requestContext(args.Timeout)
+	defer cancel()
 	agent.mu.Lock()
 	defer agent.mu.Unlock()
+	if err := checkRequest(ctx); err != nil {
+		return err
+	}
+
+	sessions := map[string]time.Time{}
+	if existing, unlocked := agent.vaults[args.VaultPath]; unlocked && existing.sessions != nil {
+		sessions = existing.sessions
+	}
+	err := agent.unlock(args)
+	if err != nil {
+		return err
+	}
 
+	tokenBytes := make([]byte, 32)
+	_, err = rand.Read(tokenBytes)
+	if err != nil {
+		return err
+	}
+	*token = hex.EncodeToString(tokenBytes)
+	sessions[*token] = time.Now().Add(args.ExpireAfter)
+
+	vaultData := agent.vaults[args.VaultPath]
+	vaultData.sessions = sessions
+	agent.vaults[args.VaultPath] = vaultData
+	agent.keepBiometricSessions(args.VaultPath, sessions)
+	log.Printf("Started session for vault '%s'", args.VaultPath)
+	return nil
+}
+
+// SignOut ends a session started with SignIn(). The vault is
+// locked when its last session ends.
+func (agent *OnePassAgent) SignOut(args SessionArgs, ok *bool) error {
+	agent.mu.Lock()
+	vaultData, unlocked := agent.vaults[args.VaultPath]
+	if !unlocked || vaultData.sessions == nil {
+		agent.mu.Unlock()
+		return errors.New("Vault has no active sessions")
+	}
+	err := vaultData.checkSession(args.Session)
+	if err != nil {
+		agent.mu.Unlock()
+		return err
+	}
+	delete(vaultData.sessions, args.Session)
+	remaining := len(vaultData.sessions)
+	agent.mu.Unlock()
+
+	if remaining == 0 {
+		return agent.Lock(args.VaultPath, ok)
+	}
+	*ok = true
+	return nil
+}
+
+// unlocks the vault's keys, replacing any existing keys.
+// The caller must hold agent.mu.
+func (agent *OnePassAgent) unlock(args UnlockArgs) error {
 	keys, err := onepass.UnlockKeys(args.VaultPath, args.MasterPwd)
 	if err != nil {
 		log.Printf("Unlocking '%s' failed: %v", args.VaultPath, err)
 		return err
-		*ok = false
 	}
-	autoLock := time.AfterFunc(args.ExpireAfter, func() {
-		log.Printf("Auto-locking vault '%s'", args.VaultPath)
-		ok := false
-		agent.Lock(args.VaultPath, &ok)
+	agent.keepBiometricKeys(args.VaultPath, keys, args.BiometricWindow)
+	agent.setVaultKeys(args.VaultPath, keys, args.ExpireAfter)
+
+	log.Printf("Unlocked vault '%s'", args.VaultPath)
+	return nil
+}
+
+// stores the keys for an unlocked vault, which is locked again
+// after expireAfter. The caller must hold agent.mu.
+func (agent *OnePassAgent) setVaultKeys(vaultPath string, keys onepass.KeyDict, expireAfter time.Duration) {
+	autoLock := time.AfterFunc(expireAfter, func() {
+		log.Printf("Auto-locking vault '%s'", vaultPath)
+		agent.mu.Lock()
+		defer agent.mu.Unlock()
+		agent.lockVault(vaultPath)
 	})
-	agent.vaults[args.VaultPath] = vaultData{
-		keys:     keys,
-		autoLock: autoLock,
+
+	idleTimer := time.AfterFunc(keyIdleWrapDelay, func() {
+		agent.wrapIdleKeys(vaultPath)
+	})
+
+	var watcher *onepass.Subscription
+	if existing, ok := agent.vaults[vaultPath]; ok {
+		existing.autoLock.Stop()
+		existing.idleTimer.Stop()
+		existing.keys.Wipe()
+		existing.discardWrappedKeys()
+		watcher = existing.watcher
+	} else {
+		// listing the vault's items for the watcher can take
+		// a while, so this is done without holding agent.mu
+		go agent.watchVault(vaultPath)
+		agent.addEvent(AgentEvent{Type: vaultUnlockedEvent, VaultPath: vaultPath})
 	}
 
-	log.Printf("Unlocked vault '%s'", args.VaultPath)
+	agent.vaults[vaultPath] = vaultData{
+		keys:      keys,
+		autoLock:  autoLock,
+		watcher:   watcher,
+		lastUsed:  time.Now(),
+		idleTimer: idleTimer,
+	}
+}
 
-	*ok = true
+func itemIndexPath(vaultPath string) string {
+	hash := sha1.Sum([]byte(vaultPath))
+	return agentIndexDir + "/" + hex.EncodeToString(hash[:])
+}
+
+// ListItems returns the overview data for the items in a vault,
+// without their encrypted content, from an index which is kept
+// up to date with the vault's item files.
+//
+// The index is saved to disk, encrypted with a key derived
+// from the vault's master key, so that subsequent listings
+// of large vaults are fast even after the agent restarts.
+func (agent *OnePassAgent) ListItems(args SessionArgs, items *[]onepass.Item) error {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	vaultPath := args.VaultPath
+	vaultData, unlocked := agent.vaults[vaultPath]
+	if !unlocked {
+		return errors.New("Vault is not unlocked")
+	}
+	err := vaultData.checkSession(args.Session)
+	if err != nil {
+		return err
+	}
+	err = agent.unwrapKeys(vaultPath)
+	if err != nil {
+		return err
+	}
+	vaultData = agent.vaults[vaultPath]
+
+	if vaultData.index == nil {
+		index, err := onepass.LoadItemIndex(itemIndexPath(vaultPath), vaultData.keys)
+		if err != nil {
+			log.Printf("Discarding item index for '%s': %v", vaultPath, err)
+			index = onepass.NewItemIndex()
+		}
+		vaultData.index = index
+		agent.vaults[vaultPath] = vaultData
+	}
+
+	vault, err := onepass.OpenVault(vaultPath)
+	if err != nil {
+		return err
+	}
+	changed, err := vaultData.index.Refresh(&vault)
+	if err != nil {
+		return err
+	}
+	if changed {
+		err = vaultData.index.Save(itemIndexPath(vaultPath), vaultData.keys)
+		if err != nil {
+			log.Printf("Unable to save item index for '%s': %v", vaultPath, err)
+		}
+	}
+	*items = vaultData.index.Items(&vault)
 	return nil
 }
 
@@ -141,17 +549,66 @@ func (agent *OnePassAgent) Lock(vaultPath string, ok *bool) error {
 	agent.mu.Lock()
 	defer agent.mu.Unlock()
 
+	agent.lockVault(vaultPath)
+	agent.discardBiometricKeys(vaultPath)
+	*ok = true
+	return nil
+}
+
+// wipes the keys for a vault. The caller must hold agent.mu
+func (agent *OnePassAgent) lockVault(vaultPath string) {
+	if vaultData, unlocked := agent.vaults[vaultPath]; unlocked {
+		vaultData.autoLock.Stop()
+		vaultData.idleTimer.Stop()
+		vaultData.keys.Wipe()
+		vaultData.discardWrappedKeys()
+		if vaultData.watcher != nil {
+			vaultData.watcher.Close()
+		}
+		agent.addEvent(AgentEvent{Type: vaultLockedEvent, VaultPath: vaultPath})
+	}
 	delete(agent.vaults, vaultPath)
+}
+
+// Shutdown locks all vaults and stops the agent. Clients use
+// this to replace an agent from a different version of 1pass.
+func (agent *OnePassAgent) Shutdown(unused string, ok *bool) error {
+	agent.stop(100 * time.Millisecond)
 	*ok = true
 	return nil
 }
 
-func (agent *OnePassAgent) IsLocked(vaultPath string, locked *bool) error {
+// locks all vaults and stops accepting connections after delay,
+// which allows the reply to a Shutdown() call to be sent
+func (agent *OnePassAgent) stop(delay time.Duration) {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	for vaultPath, _ := range agent.vaults {
+		agent.lockVault(vaultPath)
+	}
+	for vaultPath, _ := range agent.biometric {
+		agent.discardBiometricKeys(vaultPath)
+	}
+	for _, listener := range []net.Listener{agent.listener, agent.tcpListener} {
+		if listener != nil {
+			listener := listener
+			time.AfterFunc(delay, func() {
+				listener.Close()
+			})
+		}
+	}
+}
+
+// IsLocked reports whether a vault is locked. A vault which
+// requires a session token is reported as locked if the
+// token presented is not valid.
+func (agent *OnePassAgent) IsLocked(args SessionArgs, locked *bool) error {
 	agent.mu.Lock()
 	defer agent.mu.Unlock()
 
-	_, unlocked := agent.vaults[vaultPath]
-	*locked = !unlocked
+	vaultData, unlocked := agent.vaults[args.VaultPath]
+	*locked = !unlocked || vaultData.checkSession(args.Session) != nil
 	return nil
 }
 
@@ -163,19 +620,59 @@ func (agent *OnePassAgent) RefreshAccess(args RefreshArgs, ok *bool) error {
 	if !unlocked {
 		return errors.New("Vault is not unlocked")
 	}
-	vaultData.autoLock.Reset(args.ExpireAfter)
+	err := vaultData.checkSession(args.Session)
+	if err != nil {
+		return err
+	}
+	expireAfter := args.ExpireAfter
+	if vaultData.sessions != nil {
+		// keep vaults with active sessions unlocked
+		// for as long as the session lasts
+		if expireAfter < defaultSessionDuration {
+			expireAfter = defaultSessionDuration
+		}
+		vaultData.sessions[args.Session] = time.Now().Add(expireAfter)
+	}
+	vaultData.autoLock.Reset(expireAfter)
 	return nil
 }
 
 func (agent *OnePassAgent) Info(unused string, info *AgentInfo) error {
 	*info = AgentInfo{
-		Pid:           os.Getpid(),
-		BinaryVersion: agentBinaryVersion,
+		Pid:                os.Getpid(),
+		BinaryVersion:      agentBinaryVersion,
+		ProtocolVersion:    agentProtocolVersion,
+		MinProtocolVersion: agentMinProtocolVersion,
 	}
 	return nil
 }
 
+func agentServiceHelp() string {
+	return `By default, the agent is started by the first command which needs it.
+Clients talk to the agent over a UNIX domain socket, ~/.1pass.sock, or
+on Windows over a named pipe which only the current user can connect to.
+
+'agent install-service' instead installs systemd user units which start
+the agent when a client first connects to its socket, using systemd
+socket activation. The units are written to ~/.config/systemd/user and
+the socket is enabled so that it is available after logging in.
+
+'agent uninstall-service' stops and removes the units.`
+}
+
+// Serve accepts client connections on the socket passed by the
+// service manager, if the agent was started via socket activation,
+// or otherwise on the agent's usual socket
 func (agent *OnePassAgent) Serve() error {
+	listener, err := activatedListener()
+	if err != nil {
+		return err
+	}
+	if listener != nil {
+		// the socket belongs to the service manager, which
+		// keeps listening on it after the agent exits
+		return agent.serveListener(listener, func() {})
+	}
 	return agent.ServeAt(agentConnAddr)
 }
 
@@ -184,20 +681,55 @@ func (agent *OnePassAgent) ServeAt(addr string) error {
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	rpcServer := rpc.NewServer()
-	rpcServer.Register(agent)
-	listener, err := net.Listen("unix", addr)
+	// the pid file is written first so that clients do not
+	// mistake the new socket for one left by a crashed agent
+	err = writeAgentPid(addr)
 	if err != nil {
 		return err
 	}
-	rpcServer.Accept(listener)
-	return nil
+	defer removeAgentPid(addr)
+	listener, err := listenAgent(addr)
+	if err != nil {
+		return err
+	}
+	return agent.serveListener(listener, func() {
+		os.Remove(addr)
+	})
+}
+
+// serveListener accepts client connections on listener until the
+// agent is stopped. cleanup is called if the agent is stopped
+// by a signal.
+func (agent *OnePassAgent) serveListener(listener net.Listener, cleanup func()) error {
+	rpcServer := rpc.NewServer()
+	rpcServer.Register(agent)
+	agent.mu.Lock()
+	agent.listener = listener
+	agent.mu.Unlock()
+
+	// stop cleanly when asked to by a service manager such as launchd
+	stopSignals := make(chan os.Signal, 1)
+	signal.Notify(stopSignals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		<-stopSignals
+		cleanup()
+		agent.stop(0)
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return nil
+		}
+		go serveConn(rpcServer, conn)
+	}
 }
 
 func (client *OnePassAgentClient) Encrypt(keyName string, in []byte) ([]byte, error) {
 	var cipherText []byte
-	err := client.rpcClient.Call("OnePassAgent.Encrypt", CryptArgs{
+	err := client.call("OnePassAgent.Encrypt", CryptArgs{
 		VaultPath: client.VaultPath,
+		Session:   client.Session,
 		KeyName:   keyName,
 		Data:      in,
 	}, &cipherText)
@@ -205,55 +737,191 @@ func (client *OnePassAgentClient) Encrypt(keyName string, in []byte) ([]byte, er
 }
 
 func (client *OnePassAgentClient) Decrypt(keyName string, in []byte) ([]byte, error) {
-	var plainText []byte
-	err := client.rpcClient.Call("OnePassAgent.Decrypt", CryptArgs{
+	args := CryptArgs{
 		VaultPath: client.VaultPath,
+		Session:   client.Session,
 		KeyName:   keyName,
 		Data:      in,
-	}, &plainText)
+	}
+	var plainText []byte
+	err := client.call("OnePassAgent.Decrypt", args, &plainText)
+	if err != nil && err.Error() == errUserAuthRequired.Error() {
+		userAuthPromptMu.Lock()
+		defer userAuthPromptMu.Unlock()
+
+		// another request may have authenticated while this
+		// one was waiting
+		err = client.call("OnePassAgent.Decrypt", args, &plainText)
+		if err != nil && err.Error() == errUserAuthRequired.Error() {
+			err = client.authenticateUser()
+			if err == nil {
+				err = client.call("OnePassAgent.Decrypt", args, &plainText)
+			}
+		}
+	}
 	return plainText, err
 }
 
+func (client *OnePassAgentClient) unlockDelay() time.Duration {
+	if client.UnlockDelay <= 0 {
+		return defaultUnlockDelay
+	}
+	return client.UnlockDelay
+}
+
 func (client *OnePassAgentClient) Unlock(masterPwd string) error {
 	var ok bool
-	err := client.rpcClient.Call("OnePassAgent.Unlock", UnlockArgs{
-		VaultPath:   client.VaultPath,
-		MasterPwd:   masterPwd,
-		ExpireAfter: defaultUnlockDelay,
+	err := client.call("OnePassAgent.Unlock", UnlockArgs{
+		VaultPath:       client.VaultPath,
+		MasterPwd:       masterPwd,
+		ExpireAfter:     client.unlockDelay(),
+		BiometricWindow: client.BiometricWindow,
 	}, &ok)
+	if err != nil && err.Error() == errSessionRequired.Error() {
+		return errSessionRequired
+	}
 	if err != nil && !ok {
+		// errors lose their type when returned from the agent, so
+		// key file errors are recognized by their message
+		if onepass.IsKeyFileError(err) {
+			return err
+		}
 		return onepass.DecryptError{}
 	}
 	return err
 }
 
+// SignIn unlocks the vault and starts a new session, which
+// is used for subsequent requests from this client
+func (client *OnePassAgentClient) SignIn(masterPwd string) (string, error) {
+	var token string
+	err := client.call("OnePassAgent.SignIn", UnlockArgs{
+		VaultPath:   client.VaultPath,
+		MasterPwd:   masterPwd,
+		ExpireAfter: defaultSessionDuration,
+	}, &token)
+	if err != nil {
+		return "", err
+	}
+	client.Session = token
+	return token, nil
+}
+
+func (client *OnePassAgentClient) SignOut() error {
+	var ok bool
+	return client.call("OnePassAgent.SignOut", client.sessionArgs(), &ok)
+}
+
+// call invokes an agent RPC method, logging the request
+// and the time taken if debug logging is enabled
+func (client *OnePassAgentClient) call(method string, args interface{}, reply interface{}) error {
+	ctx := client.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if client.CallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, client.CallTimeout)
+		defer cancel()
+	}
+	args = withTimeout(args, client.CallTimeout)
+
+	start := time.Now()
+	call := client.rpcClient.Go(method, args, reply, make(chan *rpc.Call, 1))
+	var err error
+	select {
+	case <-call.Done:
+		err = call.Error
+	case <-ctx.Done():
+		// the reply is discarded if the agent responds later
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("The agent did not respond within %v", client.CallTimeout)
+		} else {
+			err = errors.New("Agent request cancelled")
+		}
+	}
+	if debugLog != nil {
+		debugf("Agent call %s(%v) took %v, err: %v", method, args, time.Since(start), err)
+	}
+	return err
+}
+
+// withTimeout sets the timeout in request arguments which
+// include one, so that the agent can abandon the request once
+// the client has stopped waiting for the response
+func withTimeout(args interface{}, timeout time.Duration) interface{} {
+	switch typedArgs := args.(type) {
+	case CryptArgs:
+		typedArgs.Timeout = timeout
+		return typedArgs
+	case SessionArgs:
+		typedArgs.Timeout = timeout
+		return typedArgs
+	case UnlockArgs:
+		typedArgs.Timeout = timeout
+		return typedArgs
+	case RefreshArgs:
+		typedArgs.Timeout = timeout
+		return typedArgs
+	case EventArgs:
+		typedArgs.Timeout = timeout
+		return typedArgs
+	}
+	return args
+}
+
+func (client *OnePassAgentClient) sessionArgs() SessionArgs {
+	return SessionArgs{
+		VaultPath: client.VaultPath,
+		Session:   client.Session,
+	}
+}
+
+// Shutdown asks the agent to lock all vaults and exit
+func (client *OnePassAgentClient) Shutdown() error {
+	var unused bool
+	err := client.call("OnePassAgent.Shutdown", "", &unused)
+	if err == io.ErrUnexpectedEOF || err == rpc.ErrShutdown {
+		// the agent exited before replying
+		err = nil
+	}
+	return err
+}
+
 func (client *OnePassAgentClient) Lock() error {
 	var unused bool
-	err := client.rpcClient.Call("OnePassAgent.Lock", client.VaultPath, &unused)
+	err := client.call("OnePassAgent.Lock", client.VaultPath, &unused)
 	return err
 }
 
 func (client *OnePassAgentClient) IsLocked() (bool, error) {
 	var locked bool
-	err := client.rpcClient.Call("OnePassAgent.IsLocked", client.VaultPath, &locked)
+	err := client.call("OnePassAgent.IsLocked", client.sessionArgs(), &locked)
 	if err != nil {
 		return true, err
 	}
 	return locked, nil
 }
 
+func (client *OnePassAgentClient) ListItems() ([]onepass.Item, error) {
+	var items []onepass.Item
+	err := client.call("OnePassAgent.ListItems", client.sessionArgs(), &items)
+	return items, err
+}
+
 func (client *OnePassAgentClient) RefreshAccess() error {
 	var ok bool
-	err := client.rpcClient.Call("OnePassAgent.RefreshAccess", RefreshArgs{
+	err := client.call("OnePassAgent.RefreshAccess", RefreshArgs{
 		VaultPath:   client.VaultPath,
-		ExpireAfter: defaultUnlockDelay,
+		Session:     client.Session,
+		ExpireAfter: client.unlockDelay(),
 	}, &ok)
 	return err
 }
 
 func (client *OnePassAgentClient) AgentInfo() (AgentInfo, error) {
 	var info AgentInfo
-	err := client.rpcClient.Call("OnePassAgent.Info", "" /* unused */, &info)
+	err := client.call("OnePassAgent.Info", "" /* unused */, &info)
 	if err != nil {
 		return AgentInfo{}, err
 	}
@@ -261,24 +929,75 @@ func (client *OnePassAgentClient) AgentInfo() (AgentInfo, error) {
 }
 
 func DialAgent(vaultPath string) (OnePassAgentClient, error) {
-	var agentConnAddr = os.ExpandEnv("$HOME/.1pass.sock")
 	client, err := DialAgentAt(vaultPath, agentConnAddr)
 	return client, err
 }
 
 func DialAgentAt(vaultPath string, sock string) (OnePassAgentClient, error) {
-	rpcClient, err := rpc.Dial("unix", sock)
+	conn, err := dialAgent(sock)
 	if err != nil {
 		return OnePassAgentClient{}, err
 	}
+	return newAgentClient(rpc.NewClient(conn), vaultPath)
+}
+
+// agentDialPolicy controls how long the client waits
+// for a newly started agent to accept connections
+type agentDialPolicy struct {
+	// maximum time to wait for the agent
+	timeout time.Duration
+
+	// interval before the second attempt to connect,
+	// which doubles after each further attempt
+	backoff time.Duration
+}
+
+// waitForAgent calls dial until it succeeds or policy.timeout has
+// passed, in which case the error from the last attempt is returned
+func waitForAgent(dial func() (OnePassAgentClient, error), policy agentDialPolicy) (OnePassAgentClient, error) {
+	deadline := time.Now().Add(policy.timeout)
+	interval := policy.backoff
+	if interval <= 0 {
+		interval = defaultAgentDialBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		client, err := dial()
+		if err == nil {
+			return client, nil
+		}
+		debugf("Connecting to agent failed (attempt %d): %v", attempt, err)
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			return OnePassAgentClient{}, fmt.Errorf("No response from agent after %v: %v", policy.timeout, err)
+		}
+		if interval > remaining {
+			interval = remaining
+		}
+		time.Sleep(interval)
+		interval *= 2
+		if interval > maxAgentDialInterval {
+			interval = maxAgentDialInterval
+		}
+	}
+}
+
+func newAgentClient(rpcClient *rpc.Client, vaultPath string) (OnePassAgentClient, error) {
 	client := OnePassAgentClient{
-		rpcClient: rpcClient,
-		VaultPath: vaultPath,
+		rpcClient:   rpcClient,
+		VaultPath:   vaultPath,
+		CallTimeout: agentConnectTimeout,
 	}
 	agentInfo, err := client.AgentInfo()
 	if err != nil {
 		return OnePassAgentClient{}, err
 	}
+	client.CallTimeout = defaultAgentCallTimeout
 	client.Info = agentInfo
+	client.Protocol, err = negotiateProtocol(agentInfo)
+	if err != nil {
+		debugf("Agent protocol negotiation failed: %v", err)
+	} else {
+		debugf("Using agent protocol version %d", client.Protocol)
+	}
 	return client, nil
 }
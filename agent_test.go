@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"net"
+	"net/rpc"
+	"os"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/robertknight/1pass/onepass"
 )
 
 func fatalTestErr(t *testing.T, msg string, err error) {
@@ -104,3 +110,305 @@ func TestEncryptDecrypt(t *testing.T) {
 		t.Errorf("Decrypted content does not match original. Actual: %s, Expected: %s", string(decrypted), data)
 	}
 }
+
+func TestListItems(t *testing.T) {
+	agentIndexDir = os.TempDir() + "/1pass-test-index"
+	defer os.RemoveAll(agentIndexDir)
+
+	vault := newTestVault(t)
+	_, client := setupAgent(t, vault.Path)
+	err := client.Unlock(ClientTestPwd)
+	if err != nil {
+		fatalTestErr(t, "Unable to unlock vault", err)
+	}
+	vault.CryptoAgent = &client
+	item, err := vault.AddItem("Listed Item", "securenotes.SecureNote", onepass.ItemContent{Notes: "listed"})
+	if err != nil {
+		fatalTestErr(t, "Unable to add item", err)
+	}
+
+	items, err := vault.ListItems()
+	if err != nil {
+		fatalTestErr(t, "Unable to list items", err)
+	}
+	if len(items) != 1 || items[0].Uuid != item.Uuid {
+		t.Fatalf("Unexpected items: %v", items)
+	}
+	content, err := items[0].Content()
+	if err != nil {
+		fatalTestErr(t, "Unable to decrypt listed item", err)
+	}
+	if content.Notes != "listed" {
+		t.Errorf("Unexpected content for listed item: %s", content.Notes)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	vault := newTestVault(t)
+	_, client := setupAgent(t, vault.Path)
+
+	token, err := client.SignIn(ClientTestPwd)
+	if err != nil {
+		fatalTestErr(t, "Unable to sign in", err)
+	}
+	encrypted, err := client.Encrypt("SL5", []byte("session data"))
+	if err != nil {
+		fatalTestErr(t, "Unable to encrypt with session", err)
+	}
+
+	// requests without the session token are rejected
+	client.Session = ""
+	isLocked, err := client.IsLocked()
+	if err != nil {
+		fatalTestErr(t, "Unable to test if vault is locked", err)
+	}
+	if !isLocked {
+		t.Errorf("Expected vault to be locked without a session token")
+	}
+	_, err = client.Decrypt("SL5", encrypted)
+	if err == nil {
+		t.Errorf("Expected decryption without a session token to fail")
+	}
+	err = client.Unlock(ClientTestPwd)
+	if err != errSessionRequired {
+		t.Errorf("Expected unlock without a session to fail, got: %v", err)
+	}
+
+	client.Session = token
+	decrypted, err := client.Decrypt("SL5", encrypted)
+	if err != nil || string(decrypted) != "session data" {
+		t.Errorf("Unable to decrypt with session: %v", err)
+	}
+
+	err = client.SignOut()
+	if err != nil {
+		fatalTestErr(t, "Unable to sign out", err)
+	}
+	isLocked, err = client.IsLocked()
+	if err != nil {
+		fatalTestErr(t, "Unable to test if vault is locked", err)
+	}
+	if !isLocked {
+		t.Errorf("Expected vault to be locked after the last session ended")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	vault := newTestVault(t)
+	_, client := setupAgent(t, vault.Path)
+
+	err := client.Unlock(ClientTestPwd)
+	if err != nil {
+		fatalTestErr(t, "Unable to unlock vault", err)
+	}
+	err = client.Shutdown()
+	if err != nil {
+		fatalTestErr(t, "Unable to shut down agent", err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	conn, err := net.Dial("unix", "agent-test.sock")
+	if err == nil {
+		conn.Close()
+		t.Errorf("Expected agent to stop accepting connections")
+	}
+}
+
+func TestNegotiateProtocol(t *testing.T) {
+	type testCase struct {
+		info    AgentInfo
+		version int
+	}
+	cases := []testCase{
+		{AgentInfo{}, 0},
+		{AgentInfo{ProtocolVersion: agentProtocolVersion, MinProtocolVersion: agentMinProtocolVersion}, agentProtocolVersion},
+		{AgentInfo{ProtocolVersion: agentProtocolVersion + 1, MinProtocolVersion: agentMinProtocolVersion}, agentProtocolVersion},
+		{AgentInfo{ProtocolVersion: agentProtocolVersion + 2, MinProtocolVersion: agentProtocolVersion + 1}, 0},
+		{AgentInfo{ProtocolVersion: agentMinProtocolVersion - 1}, 0},
+	}
+	for _, tc := range cases {
+		version, err := negotiateProtocol(tc.info)
+		if version != tc.version {
+			t.Errorf("Expected protocol version %d for %+v, got %d", tc.version, tc.info, version)
+		}
+		if (err == nil) != (tc.version != 0) {
+			t.Errorf("Unexpected error result for %+v: %v", tc.info, err)
+		}
+	}
+}
+
+func TestDialAgentProtocol(t *testing.T) {
+	vault := newTestVault(t)
+	_, client := setupAgent(t, vault.Path)
+	if client.Protocol != agentProtocolVersion {
+		t.Errorf("Expected protocol version %d, got %d", agentProtocolVersion, client.Protocol)
+	}
+}
+
+// hungAgent is an agent whose requests never complete
+type hungAgent struct {
+	release chan bool
+}
+
+func (agent *hungAgent) Unlock(args UnlockArgs, ok *bool) error {
+	<-agent.release
+	return nil
+}
+
+func TestCallTimeout(t *testing.T) {
+	server := rpc.NewServer()
+	agent := &hungAgent{release: make(chan bool)}
+	defer close(agent.release)
+	err := server.RegisterName("OnePassAgent", agent)
+	if err != nil {
+		fatalTestErr(t, "Unable to register agent", err)
+	}
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	client := OnePassAgentClient{rpcClient: rpc.NewClient(clientConn)}
+	defer client.rpcClient.Close()
+
+	client.CallTimeout = 50 * time.Millisecond
+	err = client.Unlock(ClientTestPwd)
+	if err == nil {
+		t.Errorf("Expected request to hung agent to time out")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client.Context = ctx
+	client.CallTimeout = 0
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	err = client.Unlock(ClientTestPwd)
+	if err == nil {
+		t.Errorf("Expected request to hung agent to be cancelled")
+	}
+}
+
+func TestExpiredRequest(t *testing.T) {
+	vault := newTestVault(t)
+	agent := NewAgent()
+
+	// requests which the agent cannot handle before
+	// the client stops waiting are abandoned
+	agent.mu.Lock()
+	result := make(chan error)
+	go func() {
+		var ok bool
+		result <- agent.Unlock(UnlockArgs{
+			VaultPath:   vault.Path,
+			MasterPwd:   ClientTestPwd,
+			ExpireAfter: defaultUnlockDelay,
+			Timeout:     10 * time.Millisecond,
+		}, &ok)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	agent.mu.Unlock()
+	err := <-result
+	if err != errRequestExpired {
+		t.Errorf("Expected expired request to fail, got: %v", err)
+	}
+	if _, ok := agent.vaults[vault.Path]; ok {
+		t.Errorf("Expected vault to remain locked")
+	}
+}
+
+func TestWaitForEvents(t *testing.T) {
+	vault := newTestVault(t)
+	_, client := setupAgent(t, vault.Path)
+	err := client.Unlock(ClientTestPwd)
+	if err != nil {
+		fatalTestErr(t, "Unable to unlock vault", err)
+	}
+	reply, err := client.WaitForEvents(0, 0)
+	if err != nil {
+		fatalTestErr(t, "Unable to read events", err)
+	}
+	if len(reply.Events) != 1 || reply.Events[0].Type != vaultUnlockedEvent {
+		t.Errorf("Expected unlocked event, got %v", reply.Events)
+	}
+}
+
+func TestVaultEvents(t *testing.T) {
+	vault := newTestVault(t)
+	err := vault.Unlock(ClientTestPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := NewAgent()
+	var ok bool
+	err = agent.Unlock(UnlockArgs{VaultPath: vault.Path, MasterPwd: ClientTestPwd, ExpireAfter: defaultUnlockDelay}, &ok)
+	if err != nil {
+		fatalTestErr(t, "Unable to unlock vault", err)
+	}
+
+	// the agent starts watching the vault in the background
+	watching := false
+	for i := 0; i < 100 && !watching; i++ {
+		agent.mu.RLock()
+		watching = agent.vaults[vault.Path].watcher != nil
+		agent.mu.RUnlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !watching {
+		t.Fatalf("Agent did not start watching vault")
+	}
+
+	var reply EventsReply
+	err = agent.WaitForEvents(EventArgs{VaultPath: vault.Path}, &reply)
+	if err != nil || len(reply.Events) != 1 || reply.Events[0].Type != vaultUnlockedEvent {
+		t.Fatalf("Expected unlocked event, got %v (%v)", reply.Events, err)
+	}
+	item, err := vault.AddItem("Watched", "securenotes.SecureNote", onepass.ItemContent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = agent.WaitForEvents(EventArgs{VaultPath: vault.Path, After: reply.Seq, Wait: 5 * time.Second}, &reply)
+	if err != nil || len(reply.Events) != 1 {
+		t.Fatalf("Expected item event, got %v (%v)", reply.Events, err)
+	}
+	event := reply.Events[0]
+	if event.Type != string(onepass.ItemAdded) || event.ItemUuid != item.Uuid || event.ItemTitle != "Watched" {
+		t.Errorf("Unexpected item event: %+v", event)
+	}
+
+	// only lock and unlock events are reported for locked vaults
+	agent.Lock(vault.Path, &ok)
+	err = agent.WaitForEvents(EventArgs{VaultPath: vault.Path}, &reply)
+	if err != nil || len(reply.Events) != 2 || reply.Events[1].Type != vaultLockedEvent {
+		t.Errorf("Expected unlocked and locked events, got %v (%v)", reply.Events, err)
+	}
+	err = agent.WaitForEvents(EventArgs{VaultPath: vault.Path, After: reply.Seq, Wait: 10 * time.Millisecond}, &reply)
+	if err != nil || len(reply.Events) != 0 {
+		t.Errorf("Expected no new events, got %v (%v)", reply.Events, err)
+	}
+}
+
+func TestWaitForAgent(t *testing.T) {
+	policy := agentDialPolicy{timeout: 500 * time.Millisecond, backoff: time.Millisecond}
+	attempts := 0
+	_, err := waitForAgent(func() (OnePassAgentClient, error) {
+		attempts++
+		if attempts < 3 {
+			return OnePassAgentClient{}, errors.New("not ready")
+		}
+		return OnePassAgentClient{Protocol: 1}, nil
+	}, policy)
+	if err != nil || attempts != 3 {
+		t.Errorf("Expected connection after 3 attempts, got %d (%v)", attempts, err)
+	}
+
+	policy = agentDialPolicy{timeout: 50 * time.Millisecond, backoff: 5 * time.Millisecond}
+	start := time.Now()
+	_, err = waitForAgent(func() (OnePassAgentClient, error) {
+		return OnePassAgentClient{}, errors.New("connection refused")
+	}, policy)
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("Expected timeout error to include dial error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < policy.timeout || elapsed > 10*policy.timeout {
+		t.Errorf("Expected to wait for about %v, waited %v", policy.timeout, elapsed)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "net"
+
+// listenAgent listens for client connections on
+// the UNIX domain socket at addr
+func listenAgent(addr string) (net.Listener, error) {
+	listener, err := net.Listen("unix", addr)
+	if err != nil {
+		return nil, err
+	}
+	// the socket is left in place when the agent is replaced
+	// via Shutdown(), since the new agent may already have
+	// created its own socket at the same path
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	return listener, nil
+}
+
+// dialAgent connects to the agent listening at addr
+func dialAgent(addr string) (net.Conn, error) {
+	return net.Dial("unix", addr)
+}
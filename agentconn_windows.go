@@ -0,0 +1,424 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// On Windows the agent listens on a named pipe. Clients and the
+// agent use overlapped I/O so that net/rpc can read a reply on a
+// connection while another request is being written to it.
+
+var (
+	kernel32                = syscall.NewLazyDLL("kernel32.dll")
+	procCreateNamedPipeW    = kernel32.NewProc("CreateNamedPipeW")
+	procConnectNamedPipe    = kernel32.NewProc("ConnectNamedPipe")
+	procCreateEventW        = kernel32.NewProc("CreateEventW")
+	procGetOverlappedResult = kernel32.NewProc("GetOverlappedResult")
+
+	advapi32                                                 = syscall.NewLazyDLL("advapi32.dll")
+	procConvertStringSecurityDescriptorToSecurityDescriptorW = advapi32.NewProc("ConvertStringSecurityDescriptorToSecurityDescriptorW")
+	procGetSecurityInfo                                      = advapi32.NewProc("GetSecurityInfo")
+)
+
+// flags and errors from <winbase.h>, <winerror.h> and <accctrl.h>
+const (
+	pipeAccessDuplex          = 0x3
+	fileFlagFirstPipeInstance = 0x80000
+	pipeRejectRemoteClients   = 0x8
+	pipeUnlimitedInstances    = 255
+	pipeBufferSize            = 64 * 1024
+
+	// stops the agent from impersonating clients
+	securitySqosPresent    = 0x100000
+	securityIdentification = 0x10000
+
+	sddlRevision1            = 1
+	seKernelObject           = 6
+	ownerSecurityInformation = 0x1
+
+	errorNoData        = syscall.Errno(232)
+	errorPipeBusy      = syscall.Errno(231)
+	errorPipeConnected = syscall.Errno(535)
+)
+
+// how long to wait for an agent which is being replaced
+// to release the pipe, or for a busy agent to accept
+// a connection
+const pipeWaitTimeout = 5 * time.Second
+
+const pipeRetryInterval = 20 * time.Millisecond
+
+// agentPipeName returns the name of the pipe used by the
+// agent in place of the UNIX domain socket at addr
+func agentPipeName(addr string) string {
+	hash := sha1.Sum([]byte(addr))
+	return `\\.\pipe\1pass-` + hex.EncodeToString(hash[:])
+}
+
+type pipeAddr string
+
+func (addr pipeAddr) Network() string {
+	return "pipe"
+}
+
+func (addr pipeAddr) String() string {
+	return string(addr)
+}
+
+// pipeConn is one end of a named pipe connection
+type pipeConn struct {
+	handle syscall.Handle
+	addr   pipeAddr
+
+	mu      sync.Mutex
+	closed  bool
+	pending sync.WaitGroup
+}
+
+// do starts an overlapped operation on the pipe with start()
+// and waits for it to finish, returning the number of bytes
+// transferred
+func (conn *pipeConn) do(start func(*syscall.Overlapped) error) (uint32, error) {
+	event, _, err := procCreateEventW.Call(0, 1, 0, 0)
+	if event == 0 {
+		return 0, err
+	}
+	defer syscall.CloseHandle(syscall.Handle(event))
+	overlapped := &syscall.Overlapped{HEvent: syscall.Handle(event)}
+
+	// operations are started with the lock held so
+	// that Close() can cancel all of them
+	conn.mu.Lock()
+	if conn.closed {
+		conn.mu.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+	err = start(overlapped)
+	if err != nil && err != syscall.ERROR_IO_PENDING {
+		conn.mu.Unlock()
+		return 0, err
+	}
+	conn.pending.Add(1)
+	conn.mu.Unlock()
+	defer conn.pending.Done()
+
+	var transferred uint32
+	ret, _, err := procGetOverlappedResult.Call(uintptr(conn.handle),
+		uintptr(unsafe.Pointer(overlapped)), uintptr(unsafe.Pointer(&transferred)), 1)
+	if ret == 0 {
+		if err == syscall.ERROR_OPERATION_ABORTED {
+			err = io.ErrClosedPipe
+		}
+		return transferred, err
+	}
+	return transferred, nil
+}
+
+func (conn *pipeConn) Read(buf []byte) (int, error) {
+	n, err := conn.do(func(overlapped *syscall.Overlapped) error {
+		var done uint32
+		return syscall.ReadFile(conn.handle, buf, &done, overlapped)
+	})
+	if err == syscall.ERROR_BROKEN_PIPE {
+		// the other end closed the connection
+		err = io.EOF
+	}
+	return int(n), err
+}
+
+func (conn *pipeConn) Write(buf []byte) (int, error) {
+	written := 0
+	for written < len(buf) {
+		n, err := conn.do(func(overlapped *syscall.Overlapped) error {
+			var done uint32
+			return syscall.WriteFile(conn.handle, buf[written:], &done, overlapped)
+		})
+		written += int(n)
+		if err == syscall.ERROR_BROKEN_PIPE || err == errorNoData {
+			return written, io.ErrClosedPipe
+		} else if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Close cancels pending reads and writes and
+// closes the connection
+func (conn *pipeConn) Close() error {
+	conn.mu.Lock()
+	if conn.closed {
+		conn.mu.Unlock()
+		return io.ErrClosedPipe
+	}
+	conn.closed = true
+	syscall.CancelIoEx(conn.handle, nil)
+	conn.mu.Unlock()
+
+	conn.pending.Wait()
+	return syscall.CloseHandle(conn.handle)
+}
+
+func (conn *pipeConn) LocalAddr() net.Addr {
+	return conn.addr
+}
+
+func (conn *pipeConn) RemoteAddr() net.Addr {
+	return conn.addr
+}
+
+var errPipeDeadline = errors.New("Deadlines are not supported for agent connections")
+
+func (conn *pipeConn) SetDeadline(t time.Time) error {
+	return errPipeDeadline
+}
+
+func (conn *pipeConn) SetReadDeadline(t time.Time) error {
+	return errPipeDeadline
+}
+
+func (conn *pipeConn) SetWriteDeadline(t time.Time) error {
+	return errPipeDeadline
+}
+
+// pipeListener accepts connections on a named pipe. Each
+// connection uses a new instance of the pipe.
+type pipeListener struct {
+	name     *uint16
+	addr     pipeAddr
+	security syscall.SecurityAttributes
+
+	mu     sync.Mutex
+	closed bool
+
+	// the instance which the next client will connect to
+	next *pipeConn
+}
+
+// createInstance creates an instance of the pipe for the next
+// client. The first instance must be the only one, which
+// prevents another process from taking over the agent's pipe.
+func (listener *pipeListener) createInstance(first bool) (*pipeConn, error) {
+	openMode := uintptr(pipeAccessDuplex | syscall.FILE_FLAG_OVERLAPPED)
+	if first {
+		openMode |= fileFlagFirstPipeInstance
+	}
+	handle, _, err := procCreateNamedPipeW.Call(uintptr(unsafe.Pointer(listener.name)), openMode,
+		pipeRejectRemoteClients, pipeUnlimitedInstances, pipeBufferSize, pipeBufferSize, 0,
+		uintptr(unsafe.Pointer(&listener.security)))
+	if syscall.Handle(handle) == syscall.InvalidHandle {
+		return nil, err
+	}
+	return &pipeConn{handle: syscall.Handle(handle), addr: listener.addr}, nil
+}
+
+func (listener *pipeListener) Accept() (net.Conn, error) {
+	for {
+		listener.mu.Lock()
+		conn := listener.next
+		listener.mu.Unlock()
+		if conn == nil {
+			return nil, io.ErrClosedPipe
+		}
+
+		_, err := conn.do(func(overlapped *syscall.Overlapped) error {
+			ret, _, err := procConnectNamedPipe.Call(uintptr(conn.handle), uintptr(unsafe.Pointer(overlapped)))
+			if ret != 0 {
+				return nil
+			}
+			return err
+		})
+		if err == errorPipeConnected {
+			// the client connected before ConnectNamedPipe() was called
+			err = nil
+		}
+		// the client may also have disconnected already, in
+		// which case the instance is replaced and the agent
+		// waits for the next client
+		if err != nil && err != errorNoData {
+			return nil, err
+		}
+
+		listener.mu.Lock()
+		if listener.closed {
+			listener.mu.Unlock()
+			conn.Close()
+			return nil, io.ErrClosedPipe
+		}
+		next, nextErr := listener.createInstance(false)
+		listener.next = next
+		listener.mu.Unlock()
+		if err != nil || nextErr != nil {
+			conn.Close()
+		}
+		if nextErr != nil {
+			return nil, nextErr
+		} else if err == nil {
+			return conn, nil
+		}
+	}
+}
+
+// Close stops accepting connections. Connections which
+// have already been accepted are not closed.
+func (listener *pipeListener) Close() error {
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	if listener.closed {
+		return io.ErrClosedPipe
+	}
+	listener.closed = true
+	if listener.next != nil {
+		listener.next.Close()
+		listener.next = nil
+	}
+	syscall.LocalFree(syscall.Handle(listener.security.SecurityDescriptor))
+	return nil
+}
+
+func (listener *pipeListener) Addr() net.Addr {
+	return listener.addr
+}
+
+// currentUserSid returns the security identifier of the
+// user running the current process
+func currentUserSid() (string, error) {
+	token, err := syscall.OpenCurrentProcessToken()
+	if err != nil {
+		return "", err
+	}
+	defer token.Close()
+	user, err := token.GetTokenUser()
+	if err != nil {
+		return "", err
+	}
+	return user.User.Sid.String()
+}
+
+// defaultOwnerSid returns the security identifier which is set as
+// the owner of objects created by the current process. This is the
+// Administrators group rather than the user in elevated processes.
+func defaultOwnerSid() (string, error) {
+	token, err := syscall.OpenCurrentProcessToken()
+	if err != nil {
+		return "", err
+	}
+	defer token.Close()
+	var size uint32
+	syscall.GetTokenInformation(token, syscall.TokenOwner, nil, 0, &size)
+	if size == 0 {
+		return "", errors.New("Unable to read the process owner")
+	}
+	buf := make([]byte, size)
+	err = syscall.GetTokenInformation(token, syscall.TokenOwner, &buf[0], size, &size)
+	if err != nil {
+		return "", err
+	}
+	owner := (*struct{ Owner *syscall.SID })(unsafe.Pointer(&buf[0])).Owner
+	return owner.String()
+}
+
+// checkPipeOwner verifies that a pipe which a client connected to was
+// created by the same user, so that another user cannot pretend to
+// be the agent in order to capture master passwords
+func checkPipeOwner(handle syscall.Handle) error {
+	var owner *syscall.SID
+	var descriptor uintptr
+	ret, _, _ := procGetSecurityInfo.Call(uintptr(handle), seKernelObject, ownerSecurityInformation,
+		uintptr(unsafe.Pointer(&owner)), 0, 0, 0, uintptr(unsafe.Pointer(&descriptor)))
+	if ret != 0 {
+		return syscall.Errno(ret)
+	}
+	defer syscall.LocalFree(syscall.Handle(descriptor))
+	ownerSid, err := owner.String()
+	if err != nil {
+		return err
+	}
+	for _, sid := range []func() (string, error){currentUserSid, defaultOwnerSid} {
+		expected, err := sid()
+		if err == nil && expected == ownerSid {
+			return nil
+		}
+	}
+	return errors.New("The agent's pipe belongs to another user")
+}
+
+// listenAgent listens for client connections on the named pipe
+// which replaces the UNIX domain socket at addr. Only the current
+// user is allowed to connect.
+func listenAgent(addr string) (net.Listener, error) {
+	sid, err := currentUserSid()
+	if err != nil {
+		return nil, err
+	}
+	name := agentPipeName(addr)
+	listener := &pipeListener{addr: pipeAddr(name)}
+	listener.name, err = syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	sddl, err := syscall.UTF16PtrFromString("D:P(A;;GA;;;" + sid + ")")
+	if err != nil {
+		return nil, err
+	}
+	ret, _, err := procConvertStringSecurityDescriptorToSecurityDescriptorW.Call(uintptr(unsafe.Pointer(sddl)),
+		sddlRevision1, uintptr(unsafe.Pointer(&listener.security.SecurityDescriptor)), 0)
+	if ret == 0 {
+		return nil, err
+	}
+	listener.security.Length = uint32(unsafe.Sizeof(listener.security))
+
+	// an agent which is being replaced via Shutdown()
+	// may not have released the pipe yet
+	deadline := time.Now().Add(pipeWaitTimeout)
+	for {
+		listener.next, err = listener.createInstance(true)
+		if err != syscall.ERROR_ACCESS_DENIED || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(pipeRetryInterval)
+	}
+	if err != nil {
+		syscall.LocalFree(syscall.Handle(listener.security.SecurityDescriptor))
+		return nil, err
+	}
+	return listener, nil
+}
+
+// dialAgent connects to the agent listening on the
+// named pipe which replaces the socket at addr
+func dialAgent(addr string) (net.Conn, error) {
+	name := agentPipeName(addr)
+	name16, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(pipeWaitTimeout)
+	for {
+		handle, err := syscall.CreateFile(name16, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+			syscall.OPEN_EXISTING, syscall.FILE_FLAG_OVERLAPPED|securitySqosPresent|securityIdentification, 0)
+		if err == nil {
+			conn := &pipeConn{handle: handle, addr: pipeAddr(name)}
+			err = checkPipeOwner(handle)
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return conn, nil
+		}
+		// all instances of the pipe are in use until the
+		// agent creates a new one for the next client
+		if err != errorPipeBusy || time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(pipeRetryInterval)
+	}
+}
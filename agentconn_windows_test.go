@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+func TestAgentPipe(t *testing.T) {
+	addr := os.TempDir() + "/1pass-test.sock"
+	listener, err := listenAgent(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// a second agent cannot take over the pipe
+	if _, err := listenAgent(addr); err == nil {
+		t.Errorf("Expected second listener on the same pipe to fail")
+	}
+
+	accepted := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			accepted <- err
+			return
+		}
+		defer conn.Close()
+		// echo requests back to the client
+		_, err = io.Copy(conn, conn)
+		accepted <- err
+	}()
+
+	client, err := dialAgent(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// reads and writes on a connection can run concurrently
+	reply := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 5)
+		_, err := io.ReadFull(client, buf)
+		if err != nil {
+			t.Errorf("Reading from pipe failed: %v", err)
+		}
+		reply <- string(buf)
+	}()
+	_, err = client.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if echoed := <-reply; echoed != "hello" {
+		t.Errorf("Expected 'hello', got '%s'", echoed)
+	}
+	client.Close()
+	if err := <-accepted; err != nil {
+		t.Errorf("Agent end of pipe failed: %v", err)
+	}
+
+	err = listener.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dialAgent(addr); err == nil {
+		t.Errorf("Expected connection to closed pipe to fail")
+	}
+}
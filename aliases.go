@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func aliasHelp() string {
+	return `Gives items short names which can be used in place of a pattern in
+other commands, eg. 'alias set gh "GitHub (Work Account)"' followed by
+'copy gh'. An alias refers to a single item and keeps working if the
+item is renamed. Aliases are saved in ~/.1pass separately for each vault.
+
+  alias                        List aliases for the current vault
+  alias set <name> <pattern>   Create or replace an alias for the item
+                               matching <pattern>
+  alias remove <name>          Remove an alias
+
+A pattern which is exactly the same as an alias always refers to
+the aliased item, even if other items have titles containing it.`
+}
+
+// checkAliasName returns an error if name cannot be used as an
+// alias because it would be interpreted as another kind of pattern
+func checkAliasName(name string) error {
+	if name == "" || strings.ContainsAny(name, " :") || strings.HasPrefix(name, "@") || name == "-" {
+		return fmt.Errorf("'%s' is not a valid alias name", name)
+	}
+	if typeFromAlias(name) != "" {
+		return fmt.Errorf("'%s' is already the name of an item type", name)
+	}
+	return nil
+}
+
+// lookupAlias returns the item which name is an alias
+// for in vault or false if name is not an alias
+func lookupAlias(vault *onepass.Vault, name string) (onepass.Item, bool, error) {
+	uuid, ok := readConfig().Aliases[vault.Path][name]
+	if !ok {
+		return onepass.Item{}, false, nil
+	}
+	item, err := vault.LoadItem(uuid)
+	if os.IsNotExist(err) || (err == nil && item.TypeName == "system.Tombstone") {
+		return onepass.Item{}, true, fmt.Errorf("The item with the alias '%s' no longer exists. Use 'alias remove %s' to remove it", name, name)
+	} else if err != nil {
+		return onepass.Item{}, true, err
+	}
+	return item, true, nil
+}
+
+// setAlias makes name an alias for item in config
+func setAlias(config *clientConfig, vaultPath string, name string, item onepass.Item) error {
+	err := checkAliasName(name)
+	if err != nil {
+		return err
+	}
+	if config.Aliases == nil {
+		config.Aliases = map[string]map[string]string{}
+	}
+	if config.Aliases[vaultPath] == nil {
+		config.Aliases[vaultPath] = map[string]string{}
+	}
+	config.Aliases[vaultPath][name] = item.Uuid
+	return nil
+}
+
+// removeAlias removes the alias name for vaultPath from config
+func removeAlias(config *clientConfig, vaultPath string, name string) error {
+	if _, ok := config.Aliases[vaultPath][name]; !ok {
+		return fmt.Errorf("No alias named '%s'", name)
+	}
+	delete(config.Aliases[vaultPath], name)
+	if len(config.Aliases[vaultPath]) == 0 {
+		delete(config.Aliases, vaultPath)
+	}
+	return nil
+}
+
+// listAliases prints the aliases for vault
+// and the titles of the items they refer to
+func listAliases(vault *onepass.Vault) {
+	aliases := readConfig().Aliases[vault.Path]
+	if len(aliases) == 0 {
+		fmt.Printf("No aliases. Use 'alias set <name> <pattern>' to add one.\n")
+		return
+	}
+	names := []string{}
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		title := "(missing item)"
+		if item, err := vault.LoadItem(aliases[name]); err == nil && item.TypeName != "system.Tombstone" {
+			title = item.Title
+		}
+		fmt.Printf("%s -> %s (%s)\n", name, title, aliases[name][0:4])
+	}
+}
+
+// runAliasCommand runs 'alias [set|remove] [name] [pattern]'
+func runAliasCommand(vault *onepass.Vault, action string, name string, pattern string) {
+	config := readConfig()
+	var err error
+	switch action {
+	case "", "list":
+		listAliases(vault)
+		return
+	case "set":
+		if pattern == "" {
+			fatalErr(fmt.Errorf("No pattern given for alias '%s'", name), "")
+		}
+		var item onepass.Item
+		item, err = lookupSingleItem(vault, pattern)
+		if err != nil {
+			fatalErr(err, "Unable to find item to alias")
+		}
+		err = setAlias(&config, vault.Path, name, item)
+		if err == nil {
+			fmt.Printf("'%s' now refers to '%s' (%s)\n", name, item.Title, shortItemId(item.Uuid))
+		}
+	case "remove":
+		err = removeAlias(&config, vault.Path, name)
+	default:
+		err = fmt.Errorf("Unknown action '%s'. Use set or remove", action)
+	}
+	if err != nil {
+		fatalErr(err, "")
+	}
+	writeConfig(&config)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func TestAliases(t *testing.T) {
+	savedConfigPath := configPath
+	configPath = os.TempDir() + "/1pass-test-aliases-config"
+	os.Remove(configPath)
+	defer func() {
+		os.Remove(configPath)
+		configPath = savedConfigPath
+	}()
+
+	vault := newTestVault(t)
+	err := vault.Unlock(ClientTestPwd)
+	if err != nil {
+		fatalTestErr(t, "Unable to unlock vault", err)
+	}
+	work, err := vault.AddItem("GitHub (Work Account)", "webforms.WebForm", onepass.ItemContent{})
+	if err != nil {
+		fatalTestErr(t, "Unable to add item", err)
+	}
+	_, err = vault.AddItem("gh-cli token", "securenotes.SecureNote", onepass.ItemContent{})
+	if err != nil {
+		fatalTestErr(t, "Unable to add item", err)
+	}
+
+	config := readConfig()
+	for _, name := range []string{"", "two words", "@work", "login", "type:x"} {
+		if setAlias(&config, vault.Path, name, work) == nil {
+			t.Errorf("Expected alias name '%s' to be rejected", name)
+		}
+	}
+	err = setAlias(&config, vault.Path, "gh", work)
+	if err != nil {
+		fatalTestErr(t, "Unable to set alias", err)
+	}
+	writeConfig(&config)
+
+	// the alias refers only to the aliased item, even though
+	// another item's title contains it, and survives renames
+	work.Title = "GitHub"
+	err = work.Save()
+	if err != nil {
+		fatalTestErr(t, "Unable to rename item", err)
+	}
+	items, err := lookupItems(vault, "gh")
+	if err != nil {
+		fatalTestErr(t, "Unable to look up alias", err)
+	}
+	if len(items) != 1 || items[0].Uuid != work.Uuid {
+		t.Errorf("Expected alias to match only '%s', got %v", work.Uuid, items)
+	}
+
+	// aliases are specific to a vault
+	other := onepass.Vault{Path: vault.Path + "-other"}
+	if _, isAlias, _ := lookupAlias(&other, "gh"); isAlias {
+		t.Errorf("Expected alias to apply only to the vault it was created for")
+	}
+
+	err = work.Remove()
+	if err != nil {
+		fatalTestErr(t, "Unable to remove item", err)
+	}
+	_, err = lookupItems(vault, "gh")
+	if err == nil {
+		t.Errorf("Expected alias for removed item to fail")
+	}
+
+	err = removeAlias(&config, vault.Path, "gh")
+	if err != nil || len(config.Aliases) != 0 {
+		t.Errorf("Expected alias to be removed: %v, %v", err, config.Aliases)
+	}
+	if removeAlias(&config, vault.Path, "gh") == nil {
+		t.Errorf("Expected removing a missing alias to fail")
+	}
+}
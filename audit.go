@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+	"github.com/robertknight/1pass/rangeutil"
+)
+
+// default period after which 'audit' reports items as unused
+const defaultUnusedPeriod = "1y"
+
+func auditHelp() string {
+	return fmt.Sprintf(`Reports items which have not been shown, copied or typed recently
+and may no longer be needed, least recently used first.
+
+Usage is recorded locally in ~/.1pass-usage when items are used, so items
+used only before usage tracking was added, or on other devices, are
+reported as never used. Run 'config set usage.sync true' to keep the
+usage log in the vault directory instead, so that it is synced with
+the vault.
+
+Flags:
+
+  -unused <period>  Report items not used within <period>, eg. '6m'.
+                    Defaults to %s. See 'help set-expiry'.`, defaultUnusedPeriod)
+}
+
+// unusedItem is an item reported by 'audit'
+type unusedItem struct {
+	item     onepass.Item
+	lastUsed int64
+}
+
+// findUnusedItems returns the items which have not been used within
+// period before now, least recently used first. Folders and items
+// in the trash are excluded.
+func findUnusedItems(items []onepass.Item, lastUsed map[string]int64, period time.Duration, now time.Time) []unusedItem {
+	cutoff := now.Add(-period).Unix()
+	unused := []unusedItem{}
+	for _, item := range items {
+		if item.Trashed || strings.HasPrefix(item.TypeName, "system.") {
+			continue
+		}
+		if lastUsed[item.Uuid] < cutoff {
+			unused = append(unused, unusedItem{item: item, lastUsed: lastUsed[item.Uuid]})
+		}
+	}
+	rangeutil.Sort(0, len(unused), func(i, k int) bool {
+		if unused[i].lastUsed != unused[k].lastUsed {
+			return unused[i].lastUsed < unused[k].lastUsed
+		}
+		return itemLess(unused[i].item, unused[k].item, "title")
+	}, func(i, k int) {
+		unused[i], unused[k] = unused[k], unused[i]
+	})
+	return unused
+}
+
+func auditVault(vault *onepass.Vault, period time.Duration) {
+	items, err := vault.ListItems()
+	if err != nil {
+		fatalErr(err, "Unable to list vault items")
+	}
+	lastUsed, err := readItemUsage(vault)
+	if err != nil {
+		fatalErr(err, "Unable to read item usage")
+	}
+	now := time.Now()
+	unused := findUnusedItems(items, lastUsed, period, now)
+	if len(unused) == 0 {
+		fmt.Printf("All items have been used in the last %s\n", formatAge(now.Add(-period).Unix(), now))
+		return
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(table, "%s\t%s\t%s\n", colorize(colorBold, "TITLE"), colorize(colorDim, "ID"), "LAST USED")
+	for _, entry := range unused {
+		usage := "never used"
+		if entry.lastUsed != 0 {
+			usage = fmt.Sprintf("not used in %s", formatAge(entry.lastUsed, now))
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\n", colorize(colorBold, entry.item.Title),
+			colorize(colorDim, shortItemId(entry.item.Uuid)), usage)
+	}
+	table.Flush()
+}
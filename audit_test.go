@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func TestFindUnusedItems(t *testing.T) {
+	now := time.Unix(1000*24*60*60, 0)
+	day := int64(24 * 60 * 60)
+	items := []onepass.Item{
+		{Uuid: "recent", Title: "Recent"},
+		{Uuid: "old", Title: "Old"},
+		{Uuid: "older", Title: "Older"},
+		{Uuid: "never", Title: "Never"},
+		{Uuid: "trashed", Title: "Trashed", Trashed: true},
+		{Uuid: "folder", Title: "Folder", TypeName: "system.folder.Regular"},
+	}
+	lastUsed := map[string]int64{
+		"recent": now.Unix() - 10*day,
+		"old":    now.Unix() - 400*day,
+		"older":  now.Unix() - 800*day,
+	}
+	unused := findUnusedItems(items, lastUsed, 365*24*time.Hour, now)
+	order := []string{}
+	for _, entry := range unused {
+		order = append(order, entry.item.Uuid)
+	}
+	if len(order) != 3 || order[0] != "never" || order[1] != "older" || order[2] != "old" {
+		t.Errorf("Unexpected unused items %v", order)
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	now := time.Unix(1000*24*60*60, 0)
+	day := int64(24 * 60 * 60)
+	cases := map[int64]string{
+		0:   "less than a day",
+		1:   "1 day",
+		45:  "45 days",
+		90:  "3 months",
+		800: "2 years",
+	}
+	for days, expected := range cases {
+		if age := formatAge(now.Unix()-days*day, now); age != expected {
+			t.Errorf("Age of %d days was '%s', expected '%s'", days, age, expected)
+		}
+	}
+}
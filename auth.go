@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.google.com/p/go.crypto/ssh/terminal"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+// security level of the items for which the agent requires
+// OS-level authentication when an auth gate is enabled. Items
+// added with '-level SL3' are exempt.
+const gatedKeyLevel = "SL5"
+
+// period after the user authenticates during which
+// gated items can be decrypted without asking again
+const userAuthGrace = 2 * time.Minute
+
+// polkit action checked by the 'polkit' auth gate
+const polkitActionId = "com.github.robertknight.1pass.reveal"
+
+// PAM service used by the 'pam' auth gate
+const pamService = "login"
+
+var errUserAuthRequired = errors.New("OS authentication is required to decrypt this item")
+
+type UserAuthArgs struct {
+	VaultPath string
+	Session   string
+	Password  string
+}
+
+func authGateHelp() string {
+	return fmt.Sprintf(`Sets whether the agent asks you to authenticate with your operating
+system account before it decrypts items, in addition to requiring the
+vault to be unlocked.
+
+  polkit  Authorize via polkit, which shows a desktop password prompt.
+          The polkit action must be installed first, see below.
+  pam     Enter your account password in the terminal, which the agent
+          checks using the PAM '%s' service. This requires a build of
+          1pass made with 'go build -tags pam'.
+  off     Do not require OS authentication.
+
+Once you have authenticated, items can be decrypted for %v without
+asking again. Only items using the %s security level, the default, are
+gated. Items added with '-level SL3' can be used without authenticating.
+
+The running agent is restarted to apply the setting, which locks the
+vault.
+
+Flags:
+
+  -polkit-policy  Print the polkit action definition, to be saved as
+                  /usr/share/polkit-1/actions/%s.policy`,
+		pamService, userAuthGrace, gatedKeyLevel, polkitActionId)
+}
+
+func polkitPolicy() string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE policyconfig PUBLIC "-//freedesktop//DTD PolicyKit Policy Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/PolicyKit/1/policyconfig.dtd">
+<policyconfig>
+  <action id="%s">
+    <description>Reveal items in a 1Password vault</description>
+    <message>Authentication is required to reveal items in your 1Password vault</message>
+    <defaults>
+      <allow_any>auth_self</allow_any>
+      <allow_inactive>auth_self</allow_inactive>
+      <allow_active>auth_self</allow_active>
+    </defaults>
+  </action>
+</policyconfig>`, polkitActionId)
+}
+
+// parseAuthGate checks the name of an auth gate
+func parseAuthGate(gate string) (string, error) {
+	switch gate {
+	case "off", "":
+		return "", nil
+	case "polkit", "pam":
+		return gate, nil
+	}
+	return "", fmt.Errorf("Unknown auth gate '%s'. Use polkit, pam or off", gate)
+}
+
+// setAuthGate saves the auth gate setting and shuts down
+// the running agent so that the new setting is applied
+func setAuthGate(config *clientConfig, gate string) {
+	if gate == "pam" && !pamAvailable() {
+		fatalErr(errors.New("This build of 1pass does not support PAM. Rebuild it with 'go build -tags pam'"), "")
+	}
+	config.AuthGate = gate
+	writeConfig(config)
+
+	agentClient, err := DialAgent(config.VaultDir)
+	if err == nil {
+		fmt.Fprintf(os.Stderr, "Restarting agent to apply the new setting.\n")
+		agentClient.Shutdown()
+	}
+}
+
+// polkitAuthorize asks polkit whether the agent's user may reveal
+// items, which shows an authentication dialog if required. The
+// dialog is dismissed if ctx is done before the user responds.
+func polkitAuthorize(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "pkcheck", "--action-id", polkitActionId,
+		"--process", strconv.Itoa(os.Getpid()), "--allow-user-interaction")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("polkit authorization failed: %v %s", err, output)
+	}
+	return nil
+}
+
+// checkUserAuth checks whether the user has recently authenticated,
+// if the agent's auth gate applies to a Decrypt() request, and
+// authenticates them via polkit if that gate is used
+func (agent *OnePassAgent) checkUserAuth(ctx context.Context, args CryptArgs) error {
+	if agent.authGate == "" || args.KeyName != gatedKeyLevel {
+		return nil
+	}
+	agent.mu.RLock()
+	_, err := agent.itemKey(args.VaultPath, args.Session, args.KeyName)
+	agent.mu.RUnlock()
+	if err != nil {
+		// let Decrypt() report that the vault is locked
+		return nil
+	}
+
+	// concurrent requests wait for the first to authenticate
+	agent.authMu.Lock()
+	defer agent.authMu.Unlock()
+	if time.Now().Before(agent.authenticated[args.VaultPath]) {
+		return nil
+	}
+	if agent.authGate != "polkit" {
+		return errUserAuthRequired
+	}
+	err = polkitAuthorize(ctx)
+	if err != nil {
+		log.Printf("User authentication for '%s' failed: %v", args.VaultPath, err)
+		return err
+	}
+	agent.authenticated[args.VaultPath] = time.Now().Add(userAuthGrace)
+	return nil
+}
+
+// AuthenticateUser checks the password for the agent's user
+// account via PAM when the 'pam' auth gate is used
+func (agent *OnePassAgent) AuthenticateUser(args UserAuthArgs, ok *bool) error {
+	if agent.authGate != "pam" {
+		return errors.New("The agent does not use PAM authentication")
+	}
+	currentUser, err := user.Current()
+	if err != nil {
+		return err
+	}
+	agent.authMu.Lock()
+	defer agent.authMu.Unlock()
+	err = pamAuthenticate(pamService, currentUser.Username, args.Password)
+	if err != nil {
+		log.Printf("User authentication for '%s' failed: %v", args.VaultPath, err)
+		return errors.New("Incorrect password")
+	}
+	agent.authenticated[args.VaultPath] = time.Now().Add(userAuthGrace)
+	*ok = true
+	return nil
+}
+
+// serializes password prompts from concurrent Decrypt() calls
+var userAuthPromptMu sync.Mutex
+
+// authenticateUser prompts for the user's account password
+// and sends it to the agent for checking
+func (client *OnePassAgentClient) authenticateUser() error {
+	if !terminal.IsTerminal(0) {
+		return errUserAuthRequired
+	}
+	name := "your account"
+	if currentUser, err := user.Current(); err == nil {
+		name = fmt.Sprintf("'%s'", currentUser.Username)
+	}
+	fmt.Fprintf(os.Stderr, "Password for %s: ", name)
+	password, err := terminal.ReadPassword(0)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer onepass.ZeroBytes(password)
+	var ok bool
+	return client.call("OnePassAgent.AuthenticateUser", UserAuthArgs{
+		VaultPath: client.VaultPath,
+		Session:   client.Session,
+		Password:  string(password),
+	}, &ok)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseAuthGate(t *testing.T) {
+	for name, expected := range map[string]string{"off": "", "polkit": "polkit", "pam": "pam"} {
+		gate, err := parseAuthGate(name)
+		if err != nil || gate != expected {
+			t.Errorf("Expected '%s' for '%s', got '%s' (%v)", expected, name, gate, err)
+		}
+	}
+	if _, err := parseAuthGate("fingerprint"); err == nil {
+		t.Errorf("Expected error for unknown auth gate")
+	}
+}
+
+func TestAuthGate(t *testing.T) {
+	vault := newTestVault(t)
+	agent := NewAgent()
+	agent.authGate = "pam"
+	var ok bool
+	err := agent.Unlock(UnlockArgs{VaultPath: vault.Path, MasterPwd: ClientTestPwd, ExpireAfter: time.Minute}, &ok)
+	if err != nil {
+		fatalTestErr(t, "Unable to unlock vault", err)
+	}
+	defer agent.stop(0)
+
+	var encrypted, decrypted []byte
+	err = agent.Encrypt(CryptArgs{VaultPath: vault.Path, KeyName: gatedKeyLevel, Data: []byte("data")}, &encrypted)
+	if err != nil {
+		fatalTestErr(t, "Unable to encrypt data", err)
+	}
+	err = agent.Decrypt(CryptArgs{VaultPath: vault.Path, KeyName: gatedKeyLevel, Data: encrypted}, &decrypted)
+	if err != errUserAuthRequired {
+		t.Errorf("Expected decryption to require authentication, got %v", err)
+	}
+	err = agent.checkUserAuth(context.Background(), CryptArgs{VaultPath: vault.Path, KeyName: "SL3"})
+	if err != nil {
+		t.Errorf("Expected SL3 items not to require authentication, got %v", err)
+	}
+
+	agent.authenticated[vault.Path] = time.Now().Add(userAuthGrace)
+	err = agent.Decrypt(CryptArgs{VaultPath: vault.Path, KeyName: gatedKeyLevel, Data: encrypted}, &decrypted)
+	if err != nil || string(decrypted) != "data" {
+		t.Errorf("Expected decryption to succeed after authenticating, got %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+// the sequence typed for items which do not have
+// an 'autotype' field
+const defaultAutoTypeSequence = "{username}{tab}{password}{enter}"
+
+// delay before typing starts, to allow the user
+// to switch to the target window
+const defaultAutoTypeDelay = 2 * time.Second
+
+func autoTypeHelp() string {
+	return `Types the username and password for an item into the focused
+window by simulating keystrokes with 'xdotool' (X11) or 'ydotool'
+(Wayland).
+This can be used for sites and apps where pasting is blocked.
+
+The keystrokes typed are controlled by a sequence. If the item has
+a field titled 'autotype', its value is used as the sequence,
+otherwise the default sequence is:
+
+  ` + defaultAutoTypeSequence + `
+
+In a sequence, {tab} and {enter} press the corresponding keys and
+{<field>} types the value of the first field, web form field or URL
+matching <field>, as with 'copy'. Other text is typed as-is.
+
+Flags:
+
+  -delay <duration>  Time to wait before typing, to switch to the
+                     target window. Defaults to 2s.`
+}
+
+// autoTypeStep is either text to type or the name
+// of a key to press
+type autoTypeStep struct {
+	text string
+	key  string
+}
+
+// parseAutoTypeSequence converts an auto-type sequence into a list
+// of steps, using content to resolve {<field>} placeholders
+func parseAutoTypeSequence(sequence string, content onepass.ItemContent) ([]autoTypeStep, error) {
+	steps := []autoTypeStep{}
+	for len(sequence) > 0 {
+		start := strings.Index(sequence, "{")
+		if start != 0 {
+			if start < 0 {
+				start = len(sequence)
+			}
+			steps = append(steps, autoTypeStep{text: sequence[:start]})
+			sequence = sequence[start:]
+			continue
+		}
+		end := strings.Index(sequence, "}")
+		if end < 0 {
+			return nil, fmt.Errorf("Unterminated '{' in auto-type sequence")
+		}
+		name := sequence[1:end]
+		sequence = sequence[end+1:]
+
+		switch strings.ToLower(name) {
+		case "tab":
+			steps = append(steps, autoTypeStep{key: "Tab"})
+		case "enter":
+			steps = append(steps, autoTypeStep{key: "Return"})
+		case "username":
+			username := itemUsername(content)
+			if username == "" {
+				return nil, fmt.Errorf("Item has no username")
+			}
+			steps = append(steps, autoTypeStep{text: username})
+		default:
+			_, value := findFieldValue(content, name)
+			if value == "" {
+				return nil, fmt.Errorf("Item has no field matching '%s'", name)
+			}
+			steps = append(steps, autoTypeStep{text: value})
+		}
+	}
+	return steps, nil
+}
+
+// keyTyper simulates keystrokes in the focused window
+type keyTyper interface {
+	typeText(text string) error
+	pressKey(key string) error
+}
+
+// xdotoolTyper types keys using xdotool under X11
+type xdotoolTyper struct{}
+
+func (xdotoolTyper) typeText(text string) error {
+	// the text is passed via stdin rather than as an
+	// argument so that it does not appear in 'ps' output
+	cmd := exec.Command("xdotool", "type", "--clearmodifiers", "--file", "-")
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+func (xdotoolTyper) pressKey(key string) error {
+	return exec.Command("xdotool", "key", "--clearmodifiers", key).Run()
+}
+
+// ydotoolTyper types keys using ydotool, which works
+// with both X11 and Wayland
+type ydotoolTyper struct{}
+
+// Linux input event codes for the keys used in sequences
+var ydotoolKeyCodes = map[string]string{
+	"Tab":    "15",
+	"Return": "28",
+}
+
+func (ydotoolTyper) typeText(text string) error {
+	cmd := exec.Command("ydotool", "type", "--file", "-")
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+func (ydotoolTyper) pressKey(key string) error {
+	code := ydotoolKeyCodes[key]
+	return exec.Command("ydotool", "key", code+":1", code+":0").Run()
+}
+
+// findKeyTyper returns a keyTyper for the first
+// available keystroke tool
+func findKeyTyper() (keyTyper, error) {
+	// xdotool only reaches X11 windows, which excludes
+	// native apps in a Wayland session
+	if _, err := exec.LookPath("xdotool"); err == nil && os.Getenv("DISPLAY") != "" && !isWaylandSession() {
+		return xdotoolTyper{}, nil
+	}
+	if _, err := exec.LookPath("ydotool"); err == nil {
+		return ydotoolTyper{}, nil
+	}
+	if _, err := exec.LookPath("xdotool"); err == nil && os.Getenv("DISPLAY") != "" {
+		// only works for X11 apps running under XWayland
+		return xdotoolTyper{}, nil
+	}
+	return nil, fmt.Errorf("Auto-type requires 'xdotool' or 'ydotool' to be installed")
+}
+
+func autoTypeItem(vault *onepass.Vault, pattern string, delay time.Duration) {
+	item, err := lookupSingleItem(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Failed to find item to type")
+	}
+	content, err := item.Content()
+	if err != nil {
+		fatalErr(err, fmt.Sprintf("Failed to decrypt item '%s'", item.Title))
+	}
+
+	sequence := defaultAutoTypeSequence
+	if field := content.FieldByPattern("autotype"); field != nil && field.ValueString() != "" {
+		sequence = field.ValueString()
+	}
+	steps, err := parseAutoTypeSequence(sequence, content)
+	if err != nil {
+		fatalErr(err, fmt.Sprintf("Unable to auto-type '%s'", item.Title))
+	}
+	typer, err := findKeyTyper()
+	if err != nil {
+		fatalErr(err, "")
+	}
+
+	fmt.Printf("Typing '%s' in %v...\n", item.Title, delay)
+	time.Sleep(delay)
+	for _, step := range steps {
+		if step.key != "" {
+			err = typer.pressKey(step.key)
+		} else {
+			err = typer.typeText(step.text)
+		}
+		if err != nil {
+			fatalErr(err, "Failed to type keys")
+		}
+	}
+	recordItemUse(vault, item)
+}
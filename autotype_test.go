@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func TestParseAutoTypeSequence(t *testing.T) {
+	content := onepass.ItemContent{
+		FormFields: []onepass.WebFormField{
+			{Name: "username", Designation: "username", Value: "jim"},
+			{Name: "password", Designation: "password", Value: "secret"},
+		},
+	}
+	steps, err := parseAutoTypeSequence("{username}{TAB}x{password}{enter}", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []autoTypeStep{
+		{text: "jim"}, {key: "Tab"}, {text: "x"}, {text: "secret"}, {key: "Return"},
+	}
+	if len(steps) != len(expected) {
+		t.Fatalf("Expected %d steps, got %v", len(expected), steps)
+	}
+	for i, step := range steps {
+		if step != expected[i] {
+			t.Errorf("Step %d: expected %v, got %v", i, expected[i], step)
+		}
+	}
+
+	_, err = parseAutoTypeSequence("{pin}", content)
+	if err == nil {
+		t.Errorf("Expected missing field to be reported")
+	}
+	_, err = parseAutoTypeSequence("{username", content)
+	if err == nil {
+		t.Errorf("Expected unterminated placeholder to be reported")
+	}
+}
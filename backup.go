@@ -0,0 +1,232 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var defaultBackupDir = homeDir() + "/.1pass-backups"
+
+const backupTimeFormat = "20060102-150405"
+
+// returns the prefix used for the names of backup
+// archives of the vault at vaultPath
+func backupPrefix(vaultPath string) string {
+	name := filepath.Base(vaultPath)
+	return strings.TrimSuffix(name, filepath.Ext(name)) + "-"
+}
+
+// backupVault writes a snapshot of the vault directory at vaultPath
+// to a timestamped .tar.gz archive in destDir and returns the path
+// of the new archive. Item data remains encrypted in the archive.
+func backupVault(vaultPath string, destDir string, now time.Time) (string, error) {
+	err := os.MkdirAll(destDir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	archivePath := fmt.Sprintf("%s/%s%s.tar.gz", destDir, backupPrefix(vaultPath), now.Format(backupTimeFormat))
+	archiveFile, err := os.OpenFile(archivePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer archiveFile.Close()
+
+	gzipWriter := gzip.NewWriter(archiveFile)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	baseDir := filepath.Dir(vaultPath)
+	err = filepath.Walk(vaultPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(baseDir, path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+		err = tarWriter.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tarWriter, file)
+		return err
+	})
+	if err == nil {
+		err = tarWriter.Close()
+	}
+	if err == nil {
+		err = gzipWriter.Close()
+	}
+	if err != nil {
+		os.Remove(archivePath)
+		return "", err
+	}
+	return archivePath, nil
+}
+
+// isBackupOf returns true if name is the name of a backup archive
+// created by backupVault() for a vault with the given backupPrefix().
+// The prefix of one vault's backups may also be the start of another
+// vault's, eg. 'Personal-' and 'Personal-Work-', so the rest of the
+// name must be exactly a timestamp.
+func isBackupOf(name string, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".tar.gz") {
+		return false
+	}
+	timestamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".tar.gz")
+	_, err := time.Parse(backupTimeFormat, timestamp)
+	return err == nil
+}
+
+// listBackups returns the paths of the backup archives for the vault
+// at vaultPath in backupDir, oldest first
+func listBackups(vaultPath string, backupDir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(backupDir)
+	if err != nil {
+		return nil, err
+	}
+	prefix := backupPrefix(vaultPath)
+	backups := []string{}
+	for _, entry := range entries {
+		if isBackupOf(entry.Name(), prefix) {
+			backups = append(backups, backupDir+"/"+entry.Name())
+		}
+	}
+	// the timestamp format used in backup names
+	// sorts chronologically
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// pruneBackups removes all but the newest keep backups of the vault
+// at vaultPath from backupDir and returns the paths of the removed
+// archives
+func pruneBackups(vaultPath string, backupDir string, keep int) ([]string, error) {
+	backups, err := listBackups(vaultPath, backupDir)
+	if err != nil {
+		return nil, err
+	}
+	removed := []string{}
+	for len(backups) > keep {
+		err = os.Remove(backups[0])
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, backups[0])
+		backups = backups[1:]
+	}
+	return removed, nil
+}
+
+// restoreBackup extracts the vault from a backup archive created by
+// backupVault() to vaultPath. If a vault already exists at vaultPath
+// it is moved aside rather than overwritten and the new location
+// is returned.
+func restoreBackup(archivePath string, vaultPath string, now time.Time) (string, error) {
+	archiveFile, err := os.Open(archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer archiveFile.Close()
+
+	gzipReader, err := gzip.NewReader(archiveFile)
+	if err != nil {
+		return "", fmt.Errorf("Unable to read backup archive: %v", err)
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	// extract to a temporary dir alongside the vault first so that
+	// the existing vault is left untouched if extraction fails
+	tmpDir, err := ioutil.TempDir(filepath.Dir(vaultPath), ".1pass-restore")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	extractedVault := ""
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", fmt.Errorf("Unable to read backup archive: %v", err)
+		}
+
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("Backup archive contains invalid path '%s'", header.Name)
+		}
+		topDir := strings.SplitN(name, string(filepath.Separator), 2)[0]
+		if extractedVault == "" {
+			extractedVault = topDir
+		} else if topDir != extractedVault {
+			return "", fmt.Errorf("Backup archive contains more than one vault")
+		}
+
+		destPath := tmpDir + "/" + name
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(destPath, 0755)
+		case tar.TypeReg:
+			err = extractFile(tarReader, destPath, os.FileMode(header.Mode).Perm())
+		default:
+			err = fmt.Errorf("Unsupported entry '%s' in backup archive", header.Name)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if extractedVault == "" {
+		return "", fmt.Errorf("Backup archive is empty")
+	}
+
+	movedVaultPath := ""
+	_, err = os.Stat(vaultPath)
+	if err == nil {
+		movedVaultPath = fmt.Sprintf("%s.%s", vaultPath, now.Format(backupTimeFormat))
+		err = os.Rename(vaultPath, movedVaultPath)
+		if err != nil {
+			return "", fmt.Errorf("Unable to move existing vault: %v", err)
+		}
+	}
+	err = os.Rename(tmpDir+"/"+extractedVault, vaultPath)
+	if err != nil {
+		return "", err
+	}
+	return movedVaultPath, nil
+}
+
+func extractFile(src io.Reader, destPath string, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(destPath), 0755)
+	if err != nil {
+		return err
+	}
+	destFile, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+	_, err = io.Copy(destFile, src)
+	return err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func TestBackupRestore(t *testing.T) {
+	vault := newTestVault(t)
+	err := vault.Unlock(ClientTestPwd)
+	if err != nil {
+		fatalTestErr(t, "Unable to unlock vault", err)
+	}
+	item, err := vault.AddItem("Backup Item", "securenotes.SecureNote", onepass.ItemContent{Notes: "backup-note"})
+	if err != nil {
+		fatalTestErr(t, "Unable to add item", err)
+	}
+
+	backupDir := os.TempDir() + "/1pass-backup-test"
+	os.RemoveAll(backupDir)
+	defer os.RemoveAll(backupDir)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err = backupVault(vault.Path, backupDir, start.Add(time.Duration(i)*time.Second))
+		if err != nil {
+			fatalTestErr(t, "Unable to backup vault", err)
+		}
+	}
+	removed, err := pruneBackups(vault.Path, backupDir, 2)
+	if err != nil {
+		fatalTestErr(t, "Unable to prune backups", err)
+	}
+	if len(removed) != 1 {
+		t.Errorf("Expected 1 backup to be removed, removed %d", len(removed))
+	}
+	backups, err := listBackups(vault.Path, backupDir)
+	if err != nil {
+		fatalTestErr(t, "Unable to list backups", err)
+	}
+	if len(backups) != 2 || backups[0] == removed[0] {
+		t.Fatalf("Unexpected backups after pruning: %v", backups)
+	}
+
+	// remove the item and then restore the vault from the backup
+	err = os.Remove(item.Path())
+	if err != nil {
+		fatalTestErr(t, "Unable to remove item", err)
+	}
+	movedPath, err := restoreBackup(backups[1], vault.Path, time.Now())
+	if err != nil {
+		fatalTestErr(t, "Unable to restore backup", err)
+	}
+	defer os.RemoveAll(movedPath)
+	if movedPath == "" {
+		t.Errorf("Existing vault was not moved aside")
+	}
+
+	loadedItem, err := vault.LoadItem(item.Uuid)
+	if err != nil {
+		fatalTestErr(t, "Unable to load restored item", err)
+	}
+	content, err := loadedItem.Content()
+	if err != nil {
+		fatalTestErr(t, "Unable to decrypt restored item", err)
+	}
+	if content.Notes != "backup-note" {
+		t.Errorf("Restored content mismatch: %s", content.Notes)
+	}
+}
+
+func TestPruneBackupsSharedPrefix(t *testing.T) {
+	backupDir := os.TempDir() + "/1pass-backup-prefix-test"
+	os.RemoveAll(backupDir)
+	err := os.MkdirAll(backupDir, 0700)
+	if err != nil {
+		fatalTestErr(t, "Unable to create backup dir", err)
+	}
+	defer os.RemoveAll(backupDir)
+
+	names := []string{
+		"Personal-20260101-120000.tar.gz",
+		"Personal-20260102-120000.tar.gz",
+		"Personal-Work-20260101-120000.tar.gz",
+		"Personal-notes.tar.gz",
+	}
+	for _, name := range names {
+		err = ioutil.WriteFile(backupDir+"/"+name, []byte{}, 0600)
+		if err != nil {
+			fatalTestErr(t, "Unable to create backup", err)
+		}
+	}
+
+	removed, err := pruneBackups("/vaults/Personal.agilekeychain", backupDir, 0)
+	if err != nil {
+		fatalTestErr(t, "Unable to prune backups", err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("Expected 2 backups to be removed, removed %v", removed)
+	}
+	backups, err := listBackups("/vaults/Personal-Work.agilekeychain", backupDir)
+	if err != nil {
+		fatalTestErr(t, "Unable to list backups", err)
+	}
+	if len(backups) != 1 {
+		t.Errorf("Expected backup of other vault to be kept, got %v", backups)
+	}
+	if _, err := os.Stat(backupDir + "/Personal-notes.tar.gz"); err != nil {
+		t.Errorf("Expected unrelated archive to be kept")
+	}
+}
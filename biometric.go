@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+// biometricKeys holds the keys for a vault which has been
+// auto-locked but may be unlocked again with Touch ID until
+// expires.
+//
+// The keys are encrypted with a random wrapping key, which is in
+// turn encrypted with a key held in the Secure Enclave and then
+// erased. The Secure Enclave only decrypts the wrapping key after
+// the user authenticates with Touch ID, so the agent's memory never
+// holds anything which can decrypt the keys without the user.
+type biometricKeys struct {
+	wrapped       []byte
+	sealedWrapKey []byte
+	enclave       *enclaveKey
+	expires       time.Time
+
+	// sessions of a vault unlocked with SignIn(), which
+	// are restored with the keys
+	sessions map[string]time.Time
+}
+
+func (keys biometricKeys) wipe() {
+	keys.enclave.free()
+	onepass.ZeroBytes(keys.wrapped)
+}
+
+var errBiometricUnavailable = errors.New("Biometric unlock is not available")
+
+func biometricUnlockHelp() string {
+	return `Enables or disables unlocking the vault with Touch ID.
+
+When enabled, the agent keeps the vault's keys, encrypted, after it
+auto-locks. For <period> after the master password was last entered,
+the vault can then be unlocked again with Touch ID instead of the
+password. <period> is a duration such as '8h', '3d' or '1w'. Use
+'off' to disable biometric unlock.
+
+The keys are encrypted with a key held in the Mac's Secure Enclave,
+which only decrypts them after the user authenticates with Touch ID.
+If the vault was unlocked with 'signin', its sessions are restored
+with the keys, so commands still need the session token.
+
+Running 'lock' discards the encrypted keys, so the master password
+is always required after an explicit lock.
+
+Touch ID unlock requires a Mac with Touch ID and a build of 1pass
+with cgo enabled.`
+}
+
+// parseBiometricWindow parses the period for which
+// biometric unlock is allowed, or 'off'
+func parseBiometricWindow(period string) (time.Duration, error) {
+	if period == "off" || period == "" {
+		return 0, nil
+	}
+	return parseExpiryPeriod(period)
+}
+
+// keepBiometricKeys wraps keys so that the vault can be unlocked
+// with biometric authentication until window has elapsed. The
+// caller must hold agent.mu.
+func (agent *OnePassAgent) keepBiometricKeys(vaultPath string, keys onepass.KeyDict, window time.Duration) {
+	agent.discardBiometricKeys(vaultPath)
+	if window <= 0 || !biometricAvailable() {
+		return
+	}
+	enclave, err := newEnclaveKey()
+	if err != nil {
+		log.Printf("Unable to keep keys for biometric unlock of '%s': %v", vaultPath, err)
+		return
+	}
+	wrappingKey := onepass.NewWrappingKey()
+	defer onepass.FreeWrappingKey(wrappingKey)
+	wrapped, err := onepass.WrapKeys(keys, wrappingKey)
+	var sealedWrapKey []byte
+	if err == nil {
+		sealedWrapKey, err = enclave.seal(wrappingKey)
+	}
+	if err != nil {
+		log.Printf("Unable to keep keys for biometric unlock of '%s': %v", vaultPath, err)
+		enclave.free()
+		return
+	}
+	agent.biometric[vaultPath] = biometricKeys{
+		wrapped:       wrapped,
+		sealedWrapKey: sealedWrapKey,
+		enclave:       enclave,
+		expires:       time.Now().Add(window),
+	}
+}
+
+// keepBiometricSessions records the sessions of a vault unlocked
+// with SignIn(), so that a vault unlocked with Touch ID still
+// requires a session. The caller must hold agent.mu.
+func (agent *OnePassAgent) keepBiometricSessions(vaultPath string, sessions map[string]time.Time) {
+	if kept, ok := agent.biometric[vaultPath]; ok {
+		kept.sessions = sessions
+		agent.biometric[vaultPath] = kept
+	}
+}
+
+// discardBiometricKeys removes the keys kept for biometric
+// unlock of a vault. The caller must hold agent.mu.
+func (agent *OnePassAgent) discardBiometricKeys(vaultPath string) {
+	if keys, ok := agent.biometric[vaultPath]; ok {
+		keys.wipe()
+		delete(agent.biometric, vaultPath)
+	}
+}
+
+// BiometricUnlock unlocks a vault using keys kept from a previous
+// password unlock after the user authenticates with Touch ID
+func (agent *OnePassAgent) BiometricUnlock(args UnlockArgs, ok *bool) error {
+	agent.mu.Lock()
+	if _, unlocked := agent.vaults[args.VaultPath]; unlocked {
+		// the vault requires a session, which Touch ID cannot provide
+		agent.mu.Unlock()
+		return errSessionRequired
+	}
+	kept, found := agent.biometric[args.VaultPath]
+	if !found || time.Now().After(kept.expires) {
+		agent.discardBiometricKeys(args.VaultPath)
+		agent.mu.Unlock()
+		return errBiometricUnavailable
+	}
+	// the Touch ID prompt waits for the user, so other requests are
+	// not blocked meanwhile. The enclave key is retained in case the
+	// kept keys are discarded before the prompt is answered.
+	kept.enclave.retain()
+	agent.mu.Unlock()
+
+	wrappingKey, err := kept.enclave.open(kept.sealedWrapKey)
+	kept.enclave.free()
+	if err != nil {
+		log.Printf("Biometric unlock of '%s' failed: %v", args.VaultPath, err)
+		return err
+	}
+	defer onepass.ZeroBytes(wrappingKey)
+
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+	if current, found := agent.biometric[args.VaultPath]; !found || current.enclave != kept.enclave {
+		// the vault was locked or unlocked with a password
+		// while waiting for the user
+		return errBiometricUnavailable
+	}
+	keys, err := onepass.UnwrapKeys(kept.wrapped, wrappingKey)
+	if err != nil {
+		return err
+	}
+	agent.setVaultKeys(args.VaultPath, keys, args.ExpireAfter)
+	if kept.sessions != nil {
+		vaultData := agent.vaults[args.VaultPath]
+		vaultData.sessions = kept.sessions
+		agent.vaults[args.VaultPath] = vaultData
+	}
+	log.Printf("Unlocked vault '%s' with Touch ID", args.VaultPath)
+	*ok = true
+	return nil
+}
+
+// BiometricUnlock asks the agent to unlock the vault using
+// Touch ID. This fails if biometric unlock is unavailable or
+// the period allowed since the last password unlock has passed.
+func (client *OnePassAgentClient) BiometricUnlock() error {
+	if client.Protocol < 2 {
+		return errBiometricUnavailable
+	}
+	var ok bool
+	err := client.call("OnePassAgent.BiometricUnlock", UnlockArgs{
+		VaultPath:   client.VaultPath,
+		ExpireAfter: client.unlockDelay(),
+	}, &ok)
+	return err
+}
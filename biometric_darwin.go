@@ -0,0 +1,146 @@
+//go:build darwin && cgo
+// +build darwin,cgo
+
+package main
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework Foundation -framework LocalAuthentication -framework Security
+
+#include <stdlib.h>
+#include <string.h>
+#import <Foundation/Foundation.h>
+#import <LocalAuthentication/LocalAuthentication.h>
+#import <Security/Security.h>
+
+#define enclaveAlgorithm kSecKeyAlgorithmECIESEncryptionCofactorVariableIVX963SHA256AESGCM
+
+static int canAuthenticateBiometric() {
+	LAContext *context = [[LAContext alloc] init];
+	BOOL available = [context canEvaluatePolicy:LAPolicyDeviceOwnerAuthenticationWithBiometrics error:nil];
+	[context release];
+	return available ? 1 : 0;
+}
+
+// creates a P-256 key in the Secure Enclave. The key is not saved
+// in the keychain, which would require the agent to be signed with
+// keychain entitlements, and the private key can only be used after
+// the user authenticates with Touch ID. Returns NULL on failure.
+static SecKeyRef createEnclaveKey() {
+	SecAccessControlRef access = SecAccessControlCreateWithFlags(kCFAllocatorDefault,
+		kSecAttrAccessibleWhenUnlockedThisDeviceOnly,
+		kSecAccessControlPrivateKeyUsage | kSecAccessControlBiometryCurrentSet, NULL);
+	if (!access) {
+		return NULL;
+	}
+	SecKeyRef key = NULL;
+	@autoreleasepool {
+		NSDictionary *attrs = @{
+			(id)kSecAttrKeyType: (id)kSecAttrKeyTypeECSECPrimeRandom,
+			(id)kSecAttrKeySizeInBits: @256,
+			(id)kSecAttrTokenID: (id)kSecAttrTokenIDSecureEnclave,
+			(id)kSecPrivateKeyAttrs: @{
+				(id)kSecAttrIsPermanent: @NO,
+				(id)kSecAttrAccessControl: (id)access,
+			},
+		};
+		key = SecKeyCreateRandomKey((CFDictionaryRef)attrs, NULL);
+	}
+	CFRelease(access);
+	return key;
+}
+
+// encrypts data with the public half of an enclave key.
+// Returns NULL on failure.
+static CFDataRef sealWithEnclaveKey(SecKeyRef key, const UInt8 *data, CFIndex len) {
+	SecKeyRef publicKey = SecKeyCopyPublicKey(key);
+	if (!publicKey) {
+		return NULL;
+	}
+	CFDataRef plain = CFDataCreateWithBytesNoCopy(NULL, data, len, kCFAllocatorNull);
+	CFDataRef sealed = SecKeyCreateEncryptedData(publicKey, enclaveAlgorithm, plain, NULL);
+	CFRelease(plain);
+	CFRelease(publicKey);
+	return sealed;
+}
+
+// decrypts data sealed with sealWithEnclaveKey(). This prompts for
+// Touch ID and waits for the result. Returns NULL on failure or if
+// the user cancelled.
+static CFDataRef openWithEnclaveKey(SecKeyRef key, const UInt8 *data, CFIndex len) {
+	CFDataRef sealed = CFDataCreateWithBytesNoCopy(NULL, data, len, kCFAllocatorNull);
+	CFDataRef plain = SecKeyCreateDecryptedData(key, enclaveAlgorithm, sealed, NULL);
+	CFRelease(sealed);
+	return plain;
+}
+
+// erases and releases data returned by openWithEnclaveKey()
+static void wipeData(CFDataRef data) {
+	memset((void *)CFDataGetBytePtr(data), 0, CFDataGetLength(data));
+	CFRelease(data);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// biometricAvailable returns true if Touch ID is
+// available and enrolled on this Mac
+func biometricAvailable() bool {
+	return C.canAuthenticateBiometric() == 1
+}
+
+// enclaveKey is a key held in the Secure Enclave which can
+// only be used after authenticating with Touch ID
+type enclaveKey struct {
+	ref C.SecKeyRef
+}
+
+func newEnclaveKey() (*enclaveKey, error) {
+	ref := C.createEnclaveKey()
+	if ref == 0 {
+		return nil, errors.New("Unable to create a key in the Secure Enclave")
+	}
+	return &enclaveKey{ref: ref}, nil
+}
+
+// seal encrypts data so that it can only be decrypted
+// with open(). This does not require authentication.
+func (key *enclaveKey) seal(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("No data to seal")
+	}
+	sealed := C.sealWithEnclaveKey(key.ref, (*C.UInt8)(unsafe.Pointer(&data[0])), C.CFIndex(len(data)))
+	if sealed == 0 {
+		return nil, errors.New("Unable to encrypt with the Secure Enclave key")
+	}
+	defer C.CFRelease(C.CFTypeRef(sealed))
+	return C.GoBytes(unsafe.Pointer(C.CFDataGetBytePtr(sealed)), C.int(C.CFDataGetLength(sealed))), nil
+}
+
+// open prompts the user to authenticate with Touch ID and decrypts
+// data returned by seal(). The result should be erased after use.
+func (key *enclaveKey) open(sealed []byte) ([]byte, error) {
+	if len(sealed) == 0 {
+		return nil, errors.New("No data to open")
+	}
+	plain := C.openWithEnclaveKey(key.ref, (*C.UInt8)(unsafe.Pointer(&sealed[0])), C.CFIndex(len(sealed)))
+	if plain == 0 {
+		return nil, errors.New("Touch ID authentication failed or was cancelled")
+	}
+	defer C.wipeData(plain)
+	return C.GoBytes(unsafe.Pointer(C.CFDataGetBytePtr(plain)), C.int(C.CFDataGetLength(plain))), nil
+}
+
+// retain adds a reference to the key, which must be
+// released with another call to free()
+func (key *enclaveKey) retain() {
+	C.CFRetain(C.CFTypeRef(key.ref))
+}
+
+func (key *enclaveKey) free() {
+	C.CFRelease(C.CFTypeRef(key.ref))
+}
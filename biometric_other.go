@@ -0,0 +1,28 @@
+//go:build !darwin || !cgo
+// +build !darwin !cgo
+
+package main
+
+// biometricAvailable returns true if Touch ID is
+// available and enrolled on this Mac
+func biometricAvailable() bool {
+	return false
+}
+
+type enclaveKey struct{}
+
+func newEnclaveKey() (*enclaveKey, error) {
+	return nil, errBiometricUnavailable
+}
+
+func (key *enclaveKey) seal(data []byte) ([]byte, error) {
+	return nil, errBiometricUnavailable
+}
+
+func (key *enclaveKey) open(sealed []byte) ([]byte, error) {
+	return nil, errBiometricUnavailable
+}
+
+func (key *enclaveKey) retain() {}
+
+func (key *enclaveKey) free() {}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBiometricWindow(t *testing.T) {
+	for period, expected := range map[string]time.Duration{
+		"off": 0,
+		"":    0,
+		"8h":  8 * time.Hour,
+		"2d":  48 * time.Hour,
+	} {
+		window, err := parseBiometricWindow(period)
+		if err != nil || window != expected {
+			t.Errorf("Expected %v for '%s', got %v (%v)", expected, period, window, err)
+		}
+	}
+	if _, err := parseBiometricWindow("soon"); err == nil {
+		t.Errorf("Expected error for invalid period")
+	}
+}
+
+func TestBiometricUnlockRequiresKeptKeys(t *testing.T) {
+	vault := newTestVault(t)
+	agent, client := setupAgent(t, vault.Path)
+
+	client.BiometricWindow = time.Hour
+	err := client.Unlock(ClientTestPwd)
+	if err != nil {
+		fatalTestErr(t, "Unable to unlock vault", err)
+	}
+	err = client.Lock()
+	if err != nil {
+		fatalTestErr(t, "Unable to lock vault", err)
+	}
+	if len(agent.biometric) != 0 {
+		t.Errorf("Expected explicit lock to discard keys kept for biometric unlock")
+	}
+	err = client.BiometricUnlock()
+	if err == nil {
+		t.Errorf("Expected biometric unlock to fail after an explicit lock")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+const creditCardType = "wallet.financial.CreditCard"
+
+// returns the card number field of a credit card item
+func cardNumberField(content *onepass.ItemContent) *onepass.ItemField {
+	for i, section := range content.Sections {
+		for k, field := range section.Fields {
+			if field.Name == "ccnum" {
+				return &content.Sections[i].Fields[k]
+			}
+		}
+	}
+	return nil
+}
+
+// maskCardNumber replaces all but the last four digits of
+// the card number in a credit card item's content
+func maskCardNumber(content *onepass.ItemContent) {
+	field := cardNumberField(content)
+	if field != nil && field.ValueString() != "" {
+		field.Value = onepass.MaskCardNumber(field.ValueString())
+	}
+}
+
+// checkCardNumber verifies the card number in a credit card
+// item's content and fills in the card's brand in the 'type'
+// field if it has not been set
+func checkCardNumber(content *onepass.ItemContent) error {
+	field := cardNumberField(content)
+	if field == nil || field.ValueString() == "" {
+		return nil
+	}
+	number := field.ValueString()
+	if !onepass.ValidCardNumber(number) {
+		return fmt.Errorf("'%s' is not a valid card number", number)
+	}
+	brand := onepass.CardBrand(number)
+	for i, section := range content.Sections {
+		for k, typeField := range section.Fields {
+			if typeField.Name == "type" && typeField.ValueString() == "" && brand != "" {
+				content.Sections[i].Fields[k].Value = brand
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func TestCheckCardNumber(t *testing.T) {
+	template, ok := onepass.StandardTemplate(creditCardType)
+	if !ok {
+		t.Fatal("Missing credit card template")
+	}
+	content, err := copyItemContent(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = setFieldValue(&content, "ccnum", "4111 1111 1111 1111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checkCardNumber(&content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if brand := fieldValueByName(content, "type"); brand != "visa" {
+		t.Errorf("Expected card type to be detected as visa, got '%s'", brand)
+	}
+
+	maskCardNumber(&content)
+	if number := fieldValueByName(content, "ccnum"); number != "************1111" {
+		t.Errorf("Unexpected masked number '%s'", number)
+	}
+
+	setFieldValue(&content, "ccnum", "4111 1111 1111 1112")
+	if checkCardNumber(&content) == nil {
+		t.Errorf("Expected invalid card number to be rejected")
+	}
+}
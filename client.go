@@ -3,15 +3,20 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
-	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
-	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"code.google.com/p/go.crypto/ssh/terminal"
@@ -19,7 +24,6 @@ import (
 	"github.com/robertknight/1pass/jsonutil"
 	"github.com/robertknight/1pass/onepass"
 	"github.com/robertknight/1pass/rangeutil"
-	"github.com/robertknight/clipboard"
 )
 
 var commandModes = []cmdmodes.Mode{
@@ -28,14 +32,87 @@ var commandModes = []cmdmodes.Mode{
 		Description: "Create a new vault",
 		ArgNames:    []string{"[path]"},
 	},
+	{
+		Command:     "setup",
+		Description: "Choose a vault and configure 1pass interactively",
+		ExtraHelp:   setupHelp,
+	},
+	{
+		Command:     "auth-gate",
+		Description: "Require OS authentication before decrypting items",
+		ArgNames:    []string{"polkit|pam|off"},
+		ExtraHelp:   authGateHelp,
+	},
+	{
+		Command:     "biometric-unlock",
+		Description: "Enable or disable unlocking with Touch ID",
+		ArgNames:    []string{"<period>|off"},
+		ExtraHelp:   biometricUnlockHelp,
+	},
 	{
 		Command:     "gen-password",
 		Description: "Generate a new random password",
+		ExtraHelp:   genPasswordHelp,
+	},
+	{
+		Command:     "gen-username",
+		Description: "Generate a new random username or email alias",
+		ExtraHelp:   genUsernameHelp,
+	},
+	{
+		Command:     "agent",
+		Description: "Install or remove the agent as a systemd user service",
+		ArgNames:    []string{"install-service|uninstall-service"},
+		ExtraHelp:   agentServiceHelp,
+	},
+	{
+		Command:     "agent-token",
+		Description: "Print the token for connecting to a remote agent",
+		ExtraHelp:   agentTokenHelp,
+	},
+	{
+		Command:     "templates",
+		Description: "List, show or edit item templates",
+		ArgNames:    []string{"[list|show|edit]", "[type]"},
+		ExtraHelp:   templatesHelp,
 	},
 	{
 		Command:     "set-vault",
 		Description: "Set the path to the 1Password vault",
 		ArgNames:    []string{"[path]"},
+		ExtraHelp:   setVaultHelp,
+	},
+	{
+		Command:     "vaults",
+		Description: "List or switch between previously used vaults",
+		ArgNames:    []string{"[number]"},
+		ExtraHelp:   vaultsHelp,
+	},
+	{
+		Command:     "discover",
+		Description: "List the vaults found on this computer",
+		ExtraHelp:   discoverHelp,
+	},
+	{
+		Command:     "config",
+		Description: "Show or change settings",
+		ArgNames:    []string{"[list|get|set|unset]", "[key]", "[value]"},
+		ExtraHelp:   configHelp,
+	},
+	{
+		Command:     "doctor",
+		Description: "Check the configuration and agent for problems",
+		ExtraHelp:   doctorHelp,
+	},
+	{
+		Command:     "plugins",
+		Description: "List commands provided by plugins",
+		ExtraHelp:   pluginsHelp,
+	},
+	{
+		Command:     "hooks",
+		Description: "List hook scripts run when the vault changes",
+		ExtraHelp:   hooksHelp,
 	},
 	{
 		Command:     "info",
@@ -47,10 +124,33 @@ var commandModes = []cmdmodes.Mode{
 		ArgNames:    []string{"[pattern]"},
 		ExtraHelp:   listHelp,
 	},
+	{
+		Command:     "list-trash",
+		Description: "List items in the trash",
+		ArgNames:    []string{"[pattern]"},
+		ExtraHelp:   listHelp,
+	},
 	{
 		Command:     "list-folder",
-		Description: "List items in a folder",
+		Description: "List items in a folder or smart folder",
 		ArgNames:    []string{"pattern"},
+		ExtraHelp:   listFolderHelp,
+	},
+	{
+		Command:     "list-folders",
+		Description: "List the folders in the vault",
+	},
+	{
+		Command:     "alias",
+		Description: "Give items short names to use in place of a pattern",
+		ArgNames:    []string{"[set|remove]", "[name]", "[pattern]"},
+		ExtraHelp:   aliasHelp,
+	},
+	{
+		Command:     "save-search",
+		Description: "Save a search for use as '@name' in other commands",
+		ArgNames:    []string{"[name]", "[pattern]"},
+		ExtraHelp:   saveSearchHelp,
 	},
 	{
 		Command:     "list-tag",
@@ -61,6 +161,11 @@ var commandModes = []cmdmodes.Mode{
 		Command:     "list-tags",
 		Description: "List all tags",
 	},
+	{
+		Command:     "audit",
+		Description: "Report items which have not been used recently",
+		ExtraHelp:   auditHelp,
+	},
 	{
 		Command:     "show-json",
 		Description: "Show the raw decrypted JSON for the given item",
@@ -70,12 +175,19 @@ var commandModes = []cmdmodes.Mode{
 		Command:     "show",
 		Description: "Display the details of the given item",
 		ArgNames:    []string{"pattern"},
+		ExtraHelp:   showHelp,
 	},
 	{
 		Command:     "add",
 		Description: "Add a new item to the vault",
-		ArgNames:    []string{"type", "title"},
-		ExtraHelp:   itemTypesHelp,
+		ArgNames:    []string{"type", "title", "[file]"},
+		ExtraHelp:   addHelp,
+	},
+	{
+		Command:     "get-document",
+		Description: "Save the file stored in a document item",
+		ArgNames:    []string{"pattern", "dest"},
+		ExtraHelp:   getDocumentHelp,
 	},
 
 	{
@@ -83,52 +195,249 @@ var commandModes = []cmdmodes.Mode{
 		Description: "Edit an existing item",
 		ArgNames:    []string{"pattern"},
 	},
+	{
+		Command:     "set",
+		Description: "Set fields of an existing item",
+		ArgNames:    []string{"pattern", "field=value..."},
+		ExtraHelp:   setHelp,
+	},
+	{
+		Command:     "meta",
+		Description: "Show or set an item's unencrypted metadata",
+		ArgNames:    []string{"pattern", "[key=value...]"},
+		ExtraHelp:   metaHelp,
+	},
+	{
+		Command:     "remove-field",
+		Description: "Remove a field or section from an item",
+		ArgNames:    []string{"pattern", "field-pattern"},
+		ExtraHelp:   fieldPatternHelp,
+	},
+	{
+		Command:     "rename-field",
+		Description: "Rename a field, section or URL in an item",
+		ArgNames:    []string{"pattern", "field-pattern", "new-title"},
+		ExtraHelp:   fieldPatternHelp,
+	},
 	{
 		Command:     "move",
 		Description: "Move items to a folder",
-		ArgNames:    []string{"item-pattern", "[folder-pattern]"},
+		ArgNames:    []string{"item-pattern...", "[folder-pattern]"},
+		ExtraHelp:   moveHelp,
 	},
 	{
 		Command:     "remove",
-		Description: "Remove items from the vault matching the given pattern",
-		ArgNames:    []string{"pattern"},
+		Description: "Remove items from the vault matching the given patterns",
+		ArgNames:    []string{"pattern..."},
+		ExtraHelp:   trashHelp,
 	},
 	{
 		Command:     "trash",
 		Description: "Move items to the trash",
-		ArgNames:    []string{"pattern"},
+		ArgNames:    []string{"pattern..."},
+		ExtraHelp:   trashHelp,
 	},
 	{
 		Command:     "restore",
 		Description: "Restore items from the trash",
 		ArgNames:    []string{"pattern"},
 	},
+	{
+		Command:     "purge",
+		Description: "Permanently remove items in the trash matching the given pattern",
+		ArgNames:    []string{"pattern"},
+		ExtraHelp:   purgeHelp,
+	},
 	{
 		Command:     "rename",
 		Description: "Renames an item in the vault",
 		ArgNames:    []string{"pattern", "new-title"},
 	},
+	{
+		Command:     "duplicate",
+		Description: "Create a copy of an item",
+		ArgNames:    []string{"pattern", "[new-title]"},
+	},
+	{
+		Command:     "set-expiry",
+		Description: "Set the date when items' credentials should be changed",
+		ArgNames:    []string{"pattern...", "expiry"},
+		ExtraHelp:   setExpiryHelp,
+	},
+	{
+		Command:     "set-url-match",
+		Description: "Set which sites items' websites match",
+		ArgNames:    []string{"pattern...", "match"},
+		ExtraHelp:   setUrlMatchHelp,
+	},
+	{
+		Command:     "for-url",
+		Description: "List items whose website matches a URL",
+		ArgNames:    []string{"url"},
+		ExtraHelp:   forUrlHelp,
+	},
+	{
+		Command:     "history",
+		Description: "Show the previous passwords of an item",
+		ArgNames:    []string{"pattern"},
+		ExtraHelp:   historyHelp,
+	},
+	{
+		Command:     "copy-to",
+		Description: "Copy items to another vault",
+		ArgNames:    []string{"profile", "pattern..."},
+		ExtraHelp:   copyToHelp,
+	},
+	{
+		Command:     "move-to",
+		Description: "Move items to another vault",
+		ArgNames:    []string{"profile", "pattern..."},
+		ExtraHelp:   moveToHelp,
+	},
+	{
+		Command:     "undo",
+		Description: "Revert the most recent change to items in the vault",
+		ExtraHelp:   undoHelp,
+	},
 	{
 		Command:     "copy",
 		Description: "Copy information from the given item to the clipboard",
 		ArgNames:    []string{"pattern", "[field]"},
 		ExtraHelp:   copyItemHelp,
 	},
+	{
+		Command:     "otp",
+		Description: "Print the current one-time password for an item",
+		ArgNames:    []string{"pattern"},
+		ExtraHelp:   otpHelp,
+	},
+	{
+		Command:     "open",
+		Description: "Open an item's website in the browser",
+		ArgNames:    []string{"pattern"},
+		ExtraHelp:   openHelp,
+	},
+	{
+		Command:     "wifi-qr",
+		Description: "Show a QR code for joining a WiFi network",
+		ArgNames:    []string{"pattern"},
+		ExtraHelp:   wifiQRHelp,
+	},
+	{
+		Command:     "pick",
+		Description: "Choose an item from a menu and copy its password",
+		ArgNames:    []string{"[pattern]"},
+		ExtraHelp:   pickHelp,
+	},
+	{
+		Command:     "type",
+		Description: "Type the username and password for an item into the focused window",
+		ArgNames:    []string{"pattern"},
+		ExtraHelp:   autoTypeHelp,
+	},
 	{
 		Command:     "export",
 		Description: "Export item to an unencrypted '1Password Interchange Format' directory",
-		ArgNames:    []string{"pattern", "path"},
+		ArgNames:    []string{"pattern...", "path"},
+		ExtraHelp:   exportHelp,
+	},
+	{
+		Command:     "share",
+		Description: "Encrypt an item with a passphrase to send to someone else",
+		ArgNames:    []string{"pattern", "[file]"},
+		ExtraHelp:   shareHelp,
+	},
+	{
+		Command:     "receive",
+		Description: "Add an item shared with 'share' to the vault",
+		ArgNames:    []string{"shared-item"},
+		ExtraHelp:   receiveHelp,
 	},
 	{
 		Command:     "import",
-		Description: "Import an item from an unencrypted '1Password Interchange Format' file or directory",
+		Description: "Import items from a '1Password Interchange Format' file or another password manager's export",
 		ArgNames:    []string{"path"},
+		ExtraHelp:   importHelp,
 	},
 	{
 		Command:     "set-password",
 		Description: "Change the master password for the vault",
 		ExtraHelp:   setPasswordHelp,
 	},
+	{
+		Command:     "rollback-password",
+		Description: "Restore the master password in use before 'set-password'",
+		ArgNames:    []string{"[backup]"},
+		ExtraHelp:   rollbackPasswordHelp,
+	},
+	{
+		Command:     "backup",
+		Description: "Save a timestamped backup of the vault",
+		ArgNames:    []string{"[dest]"},
+		ExtraHelp:   backupHelp,
+	},
+	{
+		Command:     "restore-backup",
+		Description: "Restore the vault from a backup",
+		ArgNames:    []string{"archive"},
+		ExtraHelp:   restoreBackupHelp,
+	},
+	{
+		Command:     "sync",
+		Description: "Sync the vault with a copy stored in Dropbox or on a WebDAV server",
+		ArgNames:    []string{"[remote]", "[direction]"},
+		ExtraHelp:   syncHelp,
+	},
+	{
+		Command:     "conflicts",
+		Description: "List items with conflicting changes found when syncing",
+		ArgNames:    []string{"[pattern]"},
+	},
+	{
+		Command:     "resolve",
+		Description: "Resolve conflicting changes to an item",
+		ArgNames:    []string{"pattern", "[revision]"},
+		ExtraHelp:   resolveHelp,
+	},
+	{
+		Command:     "watch",
+		Description: "Watch the vault for changes made by other programs",
+		ExtraHelp:   watchHelp,
+	},
+	{
+		Command:     "check",
+		Description: "Check the vault for missing, orphaned or corrupt items",
+		ExtraHelp:   checkVaultHelp,
+	},
+	{
+		Command:     "reindex",
+		Description: "Rebuild the vault's contents.js index from the item files",
+		ExtraHelp:   reindexHelp,
+	},
+	{
+		Command:     "reencrypt",
+		Description: "Re-encrypt all items in the vault with new random keys",
+		ExtraHelp:   reEncryptHelp,
+	},
+	{
+		Command:     "lock",
+		Description: "Lock the vault",
+		ExtraHelp:   lockHelp,
+	},
+	{
+		Command:     "unlock",
+		Description: "Unlock the vault without running another command",
+		ExtraHelp:   unlockHelp,
+	},
+	{
+		Command:     "signin",
+		Description: "Unlock the vault and start a session for use by subsequent commands",
+		ExtraHelp:   signInHelp,
+	},
+	{
+		Command:     "signout",
+		Description: "End the current session",
+	},
 	{
 		Command:     "help",
 		Description: "Display usage information",
@@ -142,20 +451,106 @@ var commandModes = []cmdmodes.Mode{
 	{
 		Command:     "add-tag",
 		Description: "Add a tag to an item",
-		ArgNames:    []string{"pattern", "tag"},
+		ArgNames:    []string{"pattern...", "tag"},
+		ExtraHelp:   multiPatternHelp,
 	},
 	{
 		Command:     "remove-tag",
 		Description: "Remove tags from an item",
-		ArgNames:    []string{"pattern", "tag"},
+		ArgNames:    []string{"pattern...", "tag"},
+		ExtraHelp:   multiPatternHelp,
 	},
 }
 
 type clientConfig struct {
 	VaultDir string
+
+	// If true, the vault is always opened
+	// in read-only mode
+	ReadOnly bool
+
+	// Email address from which 'gen-username'
+	// generates plus-addressed aliases
+	UsernameBase string
+
+	// Map of profile name -> path for other vaults
+	// used with 'copy-to' and 'move-to'
+	Profiles map[string]string
+
+	// Format for times shown by 'show'. See showHelp()
+	TimeFormat string
+
+	// Period after entering the master password during which
+	// the vault can be unlocked with Touch ID, eg. '8h'.
+	// See biometricUnlockHelp()
+	BiometricWindow string
+
+	// OS-level authentication required by the agent before
+	// decrypting items. See authGateHelp()
+	AuthGate string
+
+	// Map of name -> search saved with 'save-search'
+	Searches map[string]savedSearch
+
+	// If true, the log of when items were last used is stored
+	// in the vault directory, so that it is synced with the
+	// vault, instead of in ~/.1pass-usage
+	SyncUsage bool
+
+	// If true, 'show' renders notes as Markdown by default
+	RenderNotes bool
+
+	// Period after which values copied with 'copy'
+	// are cleared from the clipboard, eg. '30s'
+	ClipboardTimeout string
+
+	// Period of inactivity after which the agent
+	// locks the vault, eg. '5m'
+	AutoLock string
+
+	// Paths of vaults which have been used, listed by 'vaults'
+	KnownVaults []string
+
+	// Security level used by 'add' unless -security-level
+	// is given, eg. 'SL3'
+	SecurityLevel string
+
+	// Remote used by 'sync' if none is given
+	SyncRemote string
+
+	// Maximum time to wait for a newly started agent to accept
+	// connections and the initial interval between attempts to
+	// connect, eg. '5s' and '20ms'
+	AgentDialTimeout string
+	AgentDialBackoff string
+
+	// If true and the agent cannot be reached, commands prompt
+	// for the master password and decrypt items in-process
+	AgentFallback bool
+
+	// Map of profile name or vault path -> settings which
+	// override the settings above for that vault, using the
+	// keys shown by 'config list'. See configHelp()
+	VaultSettings map[string]map[string]string
+	// Map of vault path -> alias -> ID of the item which
+	// the alias refers to. See aliasHelp()
+	Aliases map[string]map[string]string
+	// Map of name -> command, with flags, which the name
+	// is a shorthand for. See commandAliasHelp()
+	CommandAliases map[string]string
 }
 
-var configPath = os.Getenv("HOME") + "/.1pass"
+var configPath = homeDir() + "/.1pass"
+
+// homeDir returns the current user's home directory,
+// which is %USERPROFILE% on Windows
+func homeDir() string {
+	home := os.Getenv("HOME")
+	if home == "" {
+		home = os.Getenv("USERPROFILE")
+	}
+	return home
+}
 
 // displays a prompt and reads a line of input
 func readLinePrompt(prompt string, args ...interface{}) string {
@@ -170,6 +565,21 @@ func readLine() string {
 	return scanner.Text()
 }
 
+func setVaultHelp() string {
+	return `[path] may be relative to the current directory or start with '~'
+for your home directory. It is checked to be a vault before being
+saved. If [path] is omitted, the vault is found automatically the
+next time 1pass is run.
+
+Flags:
+
+  -read-only        Always open the vault in read-only mode, in which
+                    commands which would modify it fail
+  -profile <name>   Save [path] as a named profile for use with
+                    'copy-to' and 'move-to' instead of changing the
+                    current vault. Use an empty [path] to remove it.`
+}
+
 func readConfig() clientConfig {
 	var config clientConfig
 	_ = jsonutil.ReadFile(configPath, &config)
@@ -180,8 +590,17 @@ func writeConfig(config *clientConfig) {
 	_ = jsonutil.WriteFile(configPath, config)
 }
 
+// shortItemId returns the abbreviated form of an item ID
+// which is shown next to item titles
+func shortItemId(uuid string) string {
+	if len(uuid) < 4 {
+		return uuid
+	}
+	return uuid[0:4]
+}
+
 func logItemAction(action string, item onepass.Item) {
-	fmt.Printf("%s '%s' (%s)\n", action, item.Title, item.Uuid[0:4])
+	fmt.Printf("%s '%s' (%s)\n", action, item.Title, shortItemId(item.Uuid))
 }
 
 // generate a random password with default settings
@@ -190,43 +609,111 @@ func genDefaultPassword() string {
 	return onepass.GenPassword(12)
 }
 
-// attempt to locate the keychain directory automatically
-func findKeyChainDirs() []string {
-	paths := []string{}
+// generate a random password made of syllables which
+// is easier to read out or type by hand. This is longer than
+// the default password to make up for the smaller set of
+// characters used.
+func genPronounceablePassword() string {
+	return onepass.GenPronounceablePassword(16)
+}
 
-	// try using 'locate'
-	locateCmd := exec.Command("locate", "-b", "--existing", ".agilekeychain")
-	locateOutput, err := locateCmd.Output()
-	if err == nil {
-		locateLines := strings.Split(string(locateOutput), "\n")
-		for _, path := range locateLines {
-			err = onepass.CheckVault(path)
-			if err == nil {
-				paths = append(paths, path)
-			}
-		}
+// generate a random username. If a base email address
+// has been configured, this is a plus-addressed alias of it,
+// otherwise a random handle.
+func genDefaultUsername() string {
+	base := readConfig().UsernameBase
+	if base == "" {
+		return onepass.GenUsername()
 	}
-
-	// try default paths
-	defaultPaths := []string{
-		os.Getenv("HOME") + "/Dropbox/1Password/1Password.agilekeychain",
+	alias, err := onepass.GenEmailAlias(base)
+	if err != nil {
+		fatalErr(err, "Unable to generate email alias")
 	}
-	for _, defaultPath := range defaultPaths {
-		ok := rangeutil.Contains(0, len(paths), func(i int) bool {
-			return paths[i] == defaultPath
-		})
-		if !ok {
-			err = onepass.CheckVault(defaultPath)
-			if err == nil {
-				paths = append(paths, defaultPath)
+	return alias
+}
+
+func genUsernameHelp() string {
+	return `Generates a random handle such as 'bakomidu52' or, if a base
+email address has been set, a plus-addressed alias of that address
+such as 'jim+dakovu27@example.com'.
+
+Flags:
+
+  -base <address>  Set the base email address used to generate
+                   aliases. Use '-base ""' to generate handles again.
+  -handle          Generate a handle even if a base address is set.
+
+When prompted for a username field during 'add', enter '-' to use
+a generated username.`
+}
+
+// default number of digits for generated PINs
+const defaultPINDigits = 4
+
+func genPasswordHelp() string {
+	return `Flags:
+
+  -pronounceable  Generate a password made of alternating consonants
+                  and vowels followed by digits, eg. 'Bakomifutedasi47',
+                  which is easier to read out or type on another device.
+  -digits <N>     Generate a numeric PIN or passcode with N digits.
+
+When prompted for a new password or other concealed field, enter '-'
+to generate a random password or '-p' to generate a pronounceable one.
+When prompted for a PIN or passcode, enter '-' to generate a random
+4 digit PIN or '-<N>' to generate one with N digits.`
+}
+
+// options controlling the output of 'list' and similar commands
+type listOptions struct {
+	// additional columns to show for each item
+	columns []string
+	// the item property used to sort the list
+	sortBy string
+	// sort the list in descending order
+	reverse bool
+	// list only items in the trash
+	onlyTrashed bool
+	// exclude items in the trash
+	excludeTrashed bool
+	// list only items which have expired or will expire
+	// within expiryPeriod from now
+	onlyExpiring bool
+	expiryPeriod time.Duration
+	// list only items which have been used
+	onlyRecent bool
+	// map of item ID -> time the item was last used, for
+	// sorting by the 'used' key
+	lastUsed map[string]int64
+}
+
+var listColumns = []string{"modified", "created", "expires", "folder", "type", "tags", "level", "username", "used"}
+var listSortKeys = []string{"title", "modified", "created", "expires", "type", "used"}
+
+// parseListOptions checks and returns the list options specified
+// by the comma-separated column names in columns and the sort
+// key sortBy
+func parseListOptions(columns string, sortBy string, reverse bool) (listOptions, error) {
+	options := listOptions{sortBy: sortBy, reverse: reverse}
+	if columns != "" {
+		for _, column := range strings.Split(columns, ",") {
+			if !rangeutil.Contains(0, len(listColumns), func(i int) bool { return listColumns[i] == column }) {
+				return options, fmt.Errorf("Unknown column '%s'. Supported columns are: %s", column,
+					strings.Join(listColumns, ", "))
 			}
+			options.columns = append(options.columns, column)
 		}
 	}
-
-	return paths
+	if sortBy == "" {
+		options.sortBy = "title"
+	} else if !rangeutil.Contains(0, len(listSortKeys), func(i int) bool { return listSortKeys[i] == sortBy }) {
+		return options, fmt.Errorf("Unknown sort key '%s'. Items can be sorted by: %s", sortBy,
+			strings.Join(listSortKeys, ", "))
+	}
+	return options, nil
 }
 
-func listMatchingItems(vault *onepass.Vault, pattern string) {
+func listMatchingItems(vault *onepass.Vault, pattern string, options listOptions) {
 	var items []onepass.Item
 	var err error
 
@@ -241,43 +728,321 @@ func listMatchingItems(vault *onepass.Vault, pattern string) {
 		os.Exit(1)
 	}
 
-	listItems(vault, items)
+	items = filterTrashed(items, options)
+	if options.onlyExpiring {
+		items = filterExpiring(items, options.expiryPeriod, time.Now())
+	}
+	if options.onlyRecent || options.sortBy == "used" {
+		options.lastUsed, err = readItemUsage(vault)
+		if err != nil {
+			fatalErr(err, "Unable to read item usage")
+		}
+	}
+	if options.onlyRecent {
+		items = filterUsed(items, options.lastUsed)
+	}
+	listItems(vault, items, options)
+}
+
+// filterTrashed removes items which are or are not in the
+// trash from items, according to options
+func filterTrashed(items []onepass.Item, options listOptions) []onepass.Item {
+	filtered := []onepass.Item{}
+	for _, item := range items {
+		if (options.onlyTrashed && !item.Trashed) || (options.excludeTrashed && item.Trashed) {
+			continue
+		}
+		filtered = append(filtered, item)
+	}
+	return filtered
+}
+
+// returns true if item a sorts before item b using the
+// sort key sortBy
+func itemLess(a onepass.Item, b onepass.Item, sortBy string) bool {
+	switch sortBy {
+	case "modified":
+		if a.UpdatedAt != b.UpdatedAt {
+			return a.UpdatedAt < b.UpdatedAt
+		}
+	case "created":
+		if a.CreatedAt != b.CreatedAt {
+			return a.CreatedAt < b.CreatedAt
+		}
+	case "expires":
+		if a.OpenContents.Expires != b.OpenContents.Expires {
+			return a.OpenContents.Expires < b.OpenContents.Expires
+		}
+	case "type":
+		if a.Type() != b.Type() {
+			return a.Type() < b.Type()
+		}
+	}
+	return strings.ToLower(a.Title) < strings.ToLower(b.Title)
+}
+
+// returns true if item a sorts before item b
+// using the sort key in options
+func (options listOptions) itemLess(a onepass.Item, b onepass.Item) bool {
+	if options.sortBy == "used" {
+		if options.lastUsed[a.Uuid] != options.lastUsed[b.Uuid] {
+			return options.lastUsed[a.Uuid] < options.lastUsed[b.Uuid]
+		}
+		return itemLess(a, b, "title")
+	}
+	return itemLess(a, b, options.sortBy)
 }
 
-func listItems(vault *onepass.Vault, items []onepass.Item) {
+func listItems(vault *onepass.Vault, items []onepass.Item, options listOptions) {
 	rangeutil.Sort(0, len(items), func(i, k int) bool {
-		return strings.ToLower(items[i].Title) < strings.ToLower(items[k].Title)
+		if options.reverse {
+			return options.itemLess(items[k], items[i])
+		}
+		return options.itemLess(items[i], items[k])
 	},
 		func(i, k int) {
 			items[i], items[k] = items[k], items[i]
 		})
 
+	if len(options.columns) > 0 {
+		listItemColumns(vault, items, options.columns)
+		return
+	}
+
 	for _, item := range items {
 		trashState := ""
 		if item.Trashed {
-			trashState = " (in trash)"
+			trashState = " " + colorize(colorRed, "(in trash)")
+		}
+		fmt.Printf("%s %s%s\n", colorize(colorBold, item.Title),
+			colorize(colorDim, fmt.Sprintf("(%s, %s)", item.Type(), shortItemId(item.Uuid))), trashState)
+	}
+}
+
+// prints a table of items with their titles, IDs and
+// the additional properties named by columns
+func listItemColumns(vault *onepass.Vault, items []onepass.Item, columns []string) {
+	folderTitles := map[string]string{}
+	usernames := map[string]string{}
+	lastUsed := map[string]int64{}
+	for _, column := range columns {
+		switch column {
+		case "used":
+			var err error
+			lastUsed, err = readItemUsage(vault)
+			if err != nil {
+				fatalErr(err, "Unable to read item usage")
+			}
+		case "folder":
+			folders, err := vault.FindItems(func(item onepass.Item) bool {
+				return item.TypeName == "system.folder.Regular"
+			})
+			if err != nil {
+				fatalErr(err, "Unable to list folders")
+			}
+			for _, folder := range folders {
+				folderTitles[folder.Uuid] = folder.Title
+			}
+		case "username":
+			for _, decrypted := range onepass.DecryptItems(items, onepass.DecryptParallelism) {
+				if decrypted.Err != nil {
+					fmt.Fprintf(os.Stderr, "Unable to decrypt '%s': %v\n", decrypted.Item.Title, decrypted.Err)
+					continue
+				}
+				usernames[decrypted.Item.Uuid] = itemUsername(decrypted.Content)
+			}
+		}
+	}
+
+	// tabwriter includes escape sequences when measuring cells, so
+	// every cell in a colored column, including the header, uses
+	// the same color to keep the columns aligned
+	table := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	header := []string{colorize(colorBold, "TITLE"), colorize(colorDim, "ID")}
+	for _, column := range columns {
+		header = append(header, strings.ToUpper(column))
+	}
+	fmt.Fprintf(table, "%s\n", strings.Join(header, "\t"))
+
+	for _, item := range items {
+		title := item.Title
+		if item.Trashed {
+			title += " (in trash)"
+		}
+		row := []string{colorize(colorBold, title), colorize(colorDim, shortItemId(item.Uuid))}
+		for _, column := range columns {
+			value := ""
+			switch column {
+			case "modified":
+				value = formatItemTime(item.UpdatedAt)
+			case "created":
+				value = formatItemTime(item.CreatedAt)
+			case "expires":
+				value = formatExpiry(item)
+			case "folder":
+				value = folderTitles[item.FolderUuid]
+			case "type":
+				value = item.Type()
+			case "tags":
+				value = strings.Join(item.OpenContents.Tags, ",")
+			case "level":
+				value = item.SecurityLevel
+			case "username":
+				value = usernames[item.Uuid]
+			case "used":
+				if lastUsed[item.Uuid] != 0 {
+					value = formatItemTime(uint64(lastUsed[item.Uuid]))
+				}
+			}
+			row = append(row, value)
 		}
-		fmt.Printf("%s (%s, %s)%s\n", item.Title, item.Type(), item.Uuid[0:4], trashState)
+		fmt.Fprintf(table, "%s\n", strings.Join(row, "\t"))
+	}
+	table.Flush()
+}
+
+// formatTime formats a Unix timestamp using format, which is
+// 'rfc3339' (the default), 'rfc1123', 'unix' or a Go time layout
+func formatTime(timestamp uint64, format string) string {
+	t := time.Unix(int64(timestamp), 0)
+	switch strings.ToLower(format) {
+	case "", "rfc3339":
+		return t.Format(time.RFC3339)
+	case "rfc1123":
+		return t.Format(time.RFC1123)
+	case "unix":
+		return strconv.FormatUint(timestamp, 10)
+	default:
+		return t.Format(format)
 	}
 }
 
+func formatItemTime(timestamp uint64) string {
+	if timestamp == 0 {
+		return ""
+	}
+	return time.Unix(int64(timestamp), 0).Format("2006-01-02 15:04")
+}
+
+// returns the username stored in an item's web form
+// fields or sections, if any
+func itemUsername(content onepass.ItemContent) string {
+	formField := content.FormFieldByPattern("username")
+	if formField != nil {
+		return formField.Value
+	}
+	field := content.FieldByPattern("username")
+	if field != nil {
+		return field.ValueString()
+	}
+	return ""
+}
+
 func listFolder(vault *onepass.Vault, pattern string) {
-	pattern = "folder:" + pattern
-	folder, err := lookupSingleItem(vault, pattern)
+	// smart folders are only searched if no regular folder matches
+	folderPattern := "folder:" + pattern
+	if folders, _ := lookupItems(vault, folderPattern); len(folders) == 0 {
+		smartPattern := "smart-folder:" + pattern
+		if smartFolders, _ := lookupItems(vault, smartPattern); len(smartFolders) > 0 {
+			folderPattern = smartPattern
+		}
+	}
+	folder, err := lookupSingleItem(vault, folderPattern)
 	if err != nil {
-		fatalErr(err, "Failed to find folder")
+		fatalErr(err, "Failed to find folder. Use 'list-folders' to see the folders in the vault")
 	}
 	items, err := vault.ListItems()
 	if err != nil {
 		fatalErr(err, "Failed to list items")
 	}
 	itemsInFolder := []onepass.Item{}
+	if folder.TypeName == onepass.SmartFolderType {
+		smartFolder, err := folder.SmartFolder()
+		if err != nil {
+			fatalErr(err, fmt.Sprintf("Unable to read smart folder '%s'", folder.Title))
+		}
+		for _, item := range items {
+			if smartFolder.Matches(item) {
+				itemsInFolder = append(itemsInFolder, item)
+			}
+		}
+	} else {
+		for _, item := range items {
+			if item.FolderUuid == folder.Uuid {
+				itemsInFolder = append(itemsInFolder, item)
+			}
+		}
+	}
+	listItems(vault, itemsInFolder, listOptions{})
+}
+
+func listFolderHelp() string {
+	return `Lists the items in the folder matching <pattern>. If no regular
+folder matches, smart folders created by 1Password clients are searched
+instead and the items matching the smart folder's search are listed.
+
+Smart folders whose search uses only the item type, tags or title are
+supported.`
+}
+
+// prints the folders in the vault with their IDs
+// and the number of items in each
+func listFolders(vault *onepass.Vault) {
+	items, err := vault.ListItems()
+	if err != nil {
+		fatalErr(err, "Failed to list items")
+	}
+	folders := []onepass.Item{}
+	itemCounts := map[string]int{}
+	smartFolders := map[string]onepass.SmartFolder{}
 	for _, item := range items {
-		if item.FolderUuid == folder.Uuid {
-			itemsInFolder = append(itemsInFolder, item)
+		if item.TypeName == "system.folder.Regular" {
+			folders = append(folders, item)
+		} else if item.TypeName == onepass.SmartFolderType {
+			folders = append(folders, item)
+			if smartFolder, err := item.SmartFolder(); err == nil {
+				smartFolders[item.Uuid] = smartFolder
+			}
+		} else if item.FolderUuid != "" {
+			itemCounts[item.FolderUuid]++
+		}
+	}
+	for uuid, smartFolder := range smartFolders {
+		for _, item := range items {
+			if smartFolder.Matches(item) {
+				itemCounts[uuid]++
+			}
+		}
+	}
+	if len(folders) == 0 {
+		fmt.Printf("No folders\n")
+		return
+	}
+	rangeutil.Sort(0, len(folders), func(i, k int) bool {
+		return strings.ToLower(folders[i].Title) < strings.ToLower(folders[k].Title)
+	},
+		func(i, k int) {
+			folders[i], folders[k] = folders[k], folders[i]
+		})
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(table, "%s\t%s\t%s\n", colorize(colorBold, "TITLE"), colorize(colorDim, "ID"), "ITEMS")
+	for _, folder := range folders {
+		title := folder.Title
+		count := fmt.Sprintf("%d", itemCounts[folder.Uuid])
+		if folder.TypeName == onepass.SmartFolderType {
+			title += " (smart)"
+			if _, ok := smartFolders[folder.Uuid]; !ok {
+				// the folder's search is not supported
+				count = "?"
+			}
 		}
+		if folder.Trashed {
+			title += " (in trash)"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\n", colorize(colorBold, title), colorize(colorDim, folder.Uuid), count)
 	}
-	listItems(vault, itemsInFolder)
+	table.Flush()
 }
 
 func prettyJson(src []byte) []byte {
@@ -286,7 +1051,19 @@ func prettyJson(src []byte) []byte {
 	return buffer.Bytes()
 }
 
-func showItems(vault *onepass.Vault, pattern string, asJson bool) {
+// options controlling the output of 'show'
+type showOptions struct {
+	// show credit card numbers in full
+	reveal bool
+	// render notes as Markdown
+	render bool
+	// format for timestamps, see formatTime()
+	timeFormat string
+	// map of item ID -> time the item was last used
+	lastUsed map[string]int64
+}
+
+func showItems(vault *onepass.Vault, pattern string, asJson bool, options showOptions) {
 	items, err := lookupItems(vault, pattern)
 	if err != nil {
 		fatalErr(err, "Unable to lookup items")
@@ -296,34 +1073,103 @@ func showItems(vault *onepass.Vault, pattern string, asJson bool) {
 		fmt.Fprintf(os.Stderr, "No matching items\n")
 	}
 
-	for i, item := range items {
-		if i > 0 {
-			fmt.Println()
-		}
-		if asJson {
+	if asJson {
+		for i, item := range items {
+			if i > 0 {
+				fmt.Println()
+			}
 			showItemJson(item)
-		} else {
-			showItem(vault, item)
 		}
+		return
+	}
+
+	lastUsed, err := readItemUsage(vault)
+	if err != nil {
+		debugf("Unable to read item usage: %v", err)
+	}
+	options.lastUsed = lastUsed
+	for i, decrypted := range onepass.DecryptItems(items, 0) {
+		if i > 0 {
+			fmt.Println()
+		}
+		showItem(vault, decrypted, options)
+	}
+	if len(items) > 0 {
+		recordItemUse(vault, items...)
+	}
+}
+
+func showHelp() string {
+	return `Flags:
+
+  -field <pattern>        Print only the value of the first field, web
+                          form field or URL matching <pattern>, in the
+                          same way as 'copy'. The pattern must match a
+                          single item.
+  -reveal                 Show credit card numbers in full. By default
+                          all but the last four digits are hidden.
+  -render                 Format Markdown in the item's notes, showing
+                          headings, lists and code with terminal
+                          styling. This can be made the default with
+                          'config set show.render_notes true'.
+  -time-format <format>   Format for the item's creation and update
+                          times: rfc3339 (the default, in local time),
+                          rfc1123, unix (seconds since the epoch) or a
+                          Go time layout such as '02/01/06 15:04'. The
+                          default can be changed with
+                          'config set show.time_format <format>'.
+
+'show-json' includes the item's "createdAt" and "updatedAt" times
+as Unix timestamps.`
+}
+
+// showField prints the value of a single field from the
+// item matching pattern
+func showField(vault *onepass.Vault, pattern string, fieldPattern string) {
+	item, err := lookupSingleItem(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Failed to find item")
+	}
+	warnIfExpired(item)
+	content, err := item.Content()
+	if err != nil {
+		fatalErr(err, fmt.Sprintf("Failed to decrypt item '%s'", item.Title))
+	}
+	_, value := findFieldValue(content, fieldPattern)
+	if len(value) == 0 {
+		fatalErr(fmt.Errorf("'%s' has no fields, web form fields or websites matching pattern '%s'", item.Title, fieldPattern), "")
 	}
+	fmt.Println(value)
+	recordItemUse(vault, item)
 }
 
-func showItem(vault *onepass.Vault, item onepass.Item) {
+func showItem(vault *onepass.Vault, decrypted onepass.DecryptedItem, options showOptions) {
+	item := decrypted.Item
+	warnIfExpired(item)
+
 	typeName := item.TypeName
 	itemType, ok := onepass.ItemTypes[item.TypeName]
 	if ok {
 		typeName = itemType.Name
 	}
 
-	fmt.Printf("%s (%s)\n", item.Title, typeName)
-	fmt.Printf("Info:\n")
-	fmt.Printf("  ID: %s\n", item.Uuid)
+	fmt.Printf("%s (%s)\n", colorize(colorBold, item.Title), typeName)
+	fmt.Printf("%s\n", colorize(colorBold, "Info:"))
+	fmt.Printf("  %s %s\n", colorize(colorCyan, "ID:"), item.Uuid)
+	fmt.Printf("  %s %s\n", colorize(colorCyan, "Security level:"), item.SecurityLevel)
 
-	updateTime := int64(item.UpdatedAt)
+	if item.CreatedAt != 0 {
+		fmt.Printf("  %s %s\n", colorize(colorCyan, "Created:"), formatTime(item.CreatedAt, options.timeFormat))
+	}
+	updateTime := item.UpdatedAt
 	if updateTime == 0 {
-		updateTime = int64(item.CreatedAt)
+		updateTime = item.CreatedAt
+	}
+	fmt.Printf("  %s %s\n", colorize(colorCyan, "Updated:"), formatTime(updateTime, options.timeFormat))
+	if lastUsed := options.lastUsed[item.Uuid]; lastUsed != 0 {
+		fmt.Printf("  %s %s (%s ago)\n", colorize(colorCyan, "Last used:"),
+			formatTime(uint64(lastUsed), options.timeFormat), formatAge(lastUsed, time.Now()))
 	}
-	fmt.Printf("  Updated: %s\n", time.Unix(updateTime, 0).Format("15:04 02/01/06"))
 
 	if len(item.FolderUuid) > 0 {
 		folder, err := vault.LoadItem(item.FolderUuid)
@@ -331,21 +1177,56 @@ func showItem(vault *onepass.Vault, item onepass.Item) {
 			fmt.Fprintf(os.Stderr, "Item folder '%s' not found", item.FolderUuid)
 			// continue
 		}
-		fmt.Printf("  Folder: %s\n", folder.Title)
+		fmt.Printf("  %s %s\n", colorize(colorCyan, "Folder:"), folder.Title)
 	}
 
 	if len(item.OpenContents.Tags) > 0 {
-		fmt.Printf("  Tags: %s\n", strings.Join(item.OpenContents.Tags, ", "))
+		fmt.Printf("  %s %s\n", colorize(colorCyan, "Tags:"), strings.Join(item.OpenContents.Tags, ", "))
+	}
+
+	if item.OpenContents.Expires != 0 {
+		fmt.Printf("  %s %s\n", colorize(colorCyan, "Expires:"), formatExpiry(item))
+	}
+
+	if match := item.UrlMatchName(); match != "domain" {
+		fmt.Printf("  %s %s\n", colorize(colorCyan, "URL match:"), match)
+	}
+
+	if len(item.Conflicts) > 0 {
+		fmt.Printf("  %s %d (use 'conflicts' to view)\n", colorize(colorCyan, "Conflicts:"), len(item.Conflicts))
 	}
 
 	fmt.Println()
 
-	content, err := item.Content()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to decrypt item: %s: %v", item.Title, err)
+	if decrypted.Err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to decrypt item: %s: %v", item.Title, decrypted.Err)
 		return
 	}
-	fmt.Printf(content.String())
+	content := decrypted.Content
+	if item.TypeName == creditCardType && !options.reveal {
+		maskCardNumber(&content)
+	}
+	contentStr := content.String()
+	fmt.Print(colorizeContent(contentStr))
+	if content.Notes != "" {
+		if contentStr != "" {
+			fmt.Println()
+		}
+		fmt.Printf("%s\n%s\n", colorize(colorBold, "Notes:"), formatNotes(content.Notes, options.render))
+	}
+}
+
+// formatNotes indents an item's notes for display by 'show',
+// rendering them as Markdown if render is true
+func formatNotes(notes string, render bool) string {
+	if render {
+		notes = renderMarkdown(notes)
+	}
+	lines := strings.Split(strings.TrimRight(notes, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = "  " + line
+	}
+	return strings.Join(lines, "\n")
 }
 
 func showItemJson(item onepass.Item) {
@@ -355,14 +1236,40 @@ func showItemJson(item onepass.Item) {
 		fmt.Fprintf(os.Stderr, "Failed to decrypt item: %s: %v", item.Title, err)
 		return
 	}
-	fmt.Println(string(prettyJson([]byte(decrypted))))
+	fmt.Println(string(prettyJson([]byte(addTimestampsJson(decrypted, item)))))
+}
+
+// addTimestampsJson adds the item's creation and update times
+// to the start of the JSON object in content, keeping the
+// order of the existing keys
+func addTimestampsJson(content string, item onepass.Item) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "{") {
+		return content
+	}
+	timestamps := fmt.Sprintf(`{"createdAt":%d,"updatedAt":%d`, item.CreatedAt, item.UpdatedAt)
+	rest := strings.TrimSpace(content[1:])
+	if rest != "}" {
+		timestamps += ","
+	}
+	return timestamps + rest
+}
+
+// returns true if field holds a numeric PIN or passcode,
+// such as the telephone banking PIN in a bank account item
+func isPINField(field onepass.ItemField) bool {
+	name := strings.ToLower(field.Name)
+	title := strings.ToLower(field.Title)
+	return strings.HasSuffix(name, "pin") || title == "pin" || strings.Contains(title, "passcode")
 }
 
 func readFieldValue(field onepass.ItemField) interface{} {
 	var newValue interface{}
 	for newValue == nil {
 		var valueStr string
-		if field.Kind == "concealed" {
+		if field.Kind == "concealed" && isPINField(field) {
+			valueStr, _ = readNewPIN(field.Title)
+		} else if field.Kind == "concealed" {
 			valueStr, _ = readNewPassword(field.Title)
 		} else if field.Kind == "address" {
 			newValue = onepass.ItemAddress{
@@ -372,15 +1279,38 @@ func readFieldValue(field onepass.ItemField) interface{} {
 				State:   readLinePrompt("State"),
 				Country: readLinePrompt("Country"),
 			}
-		} else {
+		} else if field.Kind == "date" && field.Name == "birthdate" {
+			valueStr = readLinePrompt("%s (%s)", field.Title, onepass.FieldFormat(field))
+			if valueStr == "" {
+				break
+			}
+			date, err := parseBirthDate(valueStr, time.Now())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				continue
+			}
+			newValue = date
+		} else if field.Name == "ccnum" {
 			valueStr = readLinePrompt("%s (%s)", field.Title, field.Kind)
+			if valueStr != "" && !onepass.ValidCardNumber(valueStr) {
+				fmt.Fprintf(os.Stderr, "'%s' is not a valid card number\n", valueStr)
+				continue
+			}
+		} else if field.Name == "wireless_security" {
+			valueStr = readLinePrompt("%s (%s)", field.Title, wifiSecurityHelp())
+			if _, ok := wifiSecurityTypes[valueStr]; !ok && valueStr != "" {
+				fmt.Fprintf(os.Stderr, "Unknown wireless security type '%s'\n", valueStr)
+				continue
+			}
+		} else {
+			valueStr = readLinePrompt("%s (%s)", field.Title, onepass.FieldFormat(field))
 		}
 		if len(valueStr) == 0 {
 			break
 		}
 		if newValue == nil {
 			var err error
-			newValue, err = onepass.FieldValueFromString(field.Kind, valueStr)
+			newValue, err = onepass.ParseFieldValue(field, valueStr)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "%s\n", err)
 			}
@@ -399,29 +1329,157 @@ func readFormFieldValue(field onepass.WebFormField) string {
 				break
 			}
 		}
+	} else if field.Designation == "username" {
+		newValue = readLinePrompt("%s (%s) (or '-' for a random username)", field.Name, field.Type)
+		if newValue == "-" {
+			newValue = genDefaultUsername()
+			fmt.Printf("(Generated username '%s')\n", newValue)
+		}
 	} else {
 		newValue = readLinePrompt("%s (%s)", field.Name, field.Type)
 	}
 	return newValue
 }
 
-func addItem(vault *onepass.Vault, title string, shortTypeName string) {
-	itemContent := onepass.ItemContent{}
-	var typeName string
-	for typeKey, itemType := range onepass.ItemTypes {
-		if itemType.ShortAlias == shortTypeName {
-			itemContent = onepass.ItemContent{}
-			typeName = typeKey
+func addHelp() string {
+	result := `Flags:
+
+  -security-level <level>  The security level of the key used to
+                           encrypt the item, SL5 (the default) or SL3.
+                           The vault must have a key for the level.
+                           The default can be changed with
+                           'config set add.security_level <level>'.
+  -username <value>        Set the item's username.
+  -password <value>        Set the item's password.
+  -url <value>             Set the item's website.
+  -notes <value>           Set the item's notes.
+  -field <name>=<value>    Set the field, web form field or URL with
+                           the given name or title. May be repeated.
+  -json <file>             Read the item's content from a JSON file
+                           ('-' for stdin) in the format printed by
+                           'show-json' instead of using the template.
+
+To store a file in the vault, use 'add document <title> <file>'. The
+file is encrypted in the same way as other items and can be saved
+again with 'get-document'.
+
+When adding an identity, any number of further addresses and phone
+numbers can be entered, each with a label such as 'work'. To add one
+to an existing identity, use 'edit' and create a field in the Address
+section with a title such as 'work address' or 'mobile phone'.
+
+If any field values are given, the item is created without prompting
+for the remaining fields. A value of '-' is prompted for when run from
+a terminal or otherwise read from the next line of stdin, which avoids
+passing secrets on the command line.
+
+` + itemTypesHelp()
+	if custom := userTemplatesHelp(); custom != "" {
+		result += "\n\n" + custom
+	}
+	return result + "\n\nSee 'help templates' for defining custom item types."
+}
+
+// addItem creates a new item of the given type. If jsonPath is set,
+// the item's content is read from that file ('-' for stdin). Otherwise,
+// if fieldValues is non-empty, each 'field=value' entry sets a field of
+// the type's template and if neither is set, the user is prompted for
+// each field.
+func addItem(vault *onepass.Vault, title string, shortTypeName string, securityLevel string,
+	fieldValues []string, jsonPath string) {
+	levels, err := vault.SecurityLevels()
+	if err != nil {
+		fatalErr(err, "Unable to read vault keys")
+	}
+	if !rangeutil.Contains(0, len(levels), func(i int) bool { return levels[i] == securityLevel }) {
+		fatalErr(fmt.Errorf("The vault has no key for security level '%s'. Available levels: %s",
+			securityLevel, strings.Join(levels, ", ")), "")
+	}
+
+	typeName, template, err := findItemTemplate(shortTypeName)
+	if err != nil {
+		fatalErr(err, "")
+	}
+
+	var itemContent onepass.ItemContent
+	if jsonPath != "" {
+		itemContent = readItemContentJson(jsonPath)
+	} else if len(fieldValues) > 0 {
+		itemContent = itemContentFromArgs(template, fieldValues)
+	} else {
+		itemContent = readItemContent(typeName, template)
+	}
+	if typeName == creditCardType {
+		err = checkCardNumber(&itemContent)
+		if err != nil {
+			fatalErr(err, "")
 		}
 	}
-	if len(typeName) == 0 {
-		fatalErr(fmt.Errorf("Unknown item type '%s'", shortTypeName), "")
+
+	// save item to vault
+	undo := newUndoRecorder(vault, "add")
+	item, err := vault.AddItemAtLevel(title, typeName, securityLevel, itemContent)
+	if err != nil {
+		fatalErr(err, "Unable to add item")
+	}
+	undo.added(item)
+	undo.commit()
+	logItemAction("Added new item", item)
+}
+
+// readItemContentJson reads an item's content as JSON, in
+// the format printed by 'show-json', from path or stdin if
+// path is '-'
+func readItemContentJson(path string) onepass.ItemContent {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		fatalErr(err, "Unable to read item content")
+	}
+	var content onepass.ItemContent
+	err = json.Unmarshal(data, &content)
+	if err != nil {
+		fatalErr(err, "Unable to parse item content")
 	}
+	return content
+}
 
-	template, ok := onepass.StandardTemplate(typeName)
-	if !ok {
-		fatalErr(fmt.Errorf("No template for item type '%s'", shortTypeName), "")
+// itemContentFromArgs returns a copy of template with the
+// fields set from a list of 'field=value' arguments. A value
+// of '-' is read from stdin.
+func itemContentFromArgs(template onepass.ItemContent, fieldValues []string) onepass.ItemContent {
+	content, err := copyItemContent(template)
+	if err != nil {
+		fatalErr(err, "Unable to copy item template")
+	}
+	for _, arg := range fieldValues {
+		name, value, err := splitFieldAssignment(arg)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		if value == "-" {
+			value, err = readSecretArg(name)
+			if err != nil {
+				fatalErr(err, fmt.Sprintf("Unable to read value for '%s'", name))
+			}
+		}
+		err = setFieldValue(&content, name, value)
+		if err != nil {
+			fatalErr(err, "")
+		}
 	}
+	return content
+}
+
+// readItemContent prompts for the value of each
+// field in template
+func readItemContent(typeName string, template onepass.ItemContent) onepass.ItemContent {
+	itemContent := onepass.ItemContent{}
 
 	// read sections
 	for _, sectionTemplate := range template.Sections {
@@ -440,6 +1498,9 @@ func addItem(vault *onepass.Vault, title string, shortTypeName string) {
 
 			section.Fields = append(section.Fields, field)
 		}
+		if typeName == identityType && section.Name == "address" {
+			readLabeledFields(&section)
+		}
 		itemContent.Sections = append(itemContent.Sections, section)
 	}
 
@@ -465,12 +1526,7 @@ func addItem(vault *onepass.Vault, title string, shortTypeName string) {
 		itemContent.Urls = append(itemContent.Urls, url)
 	}
 
-	// save item to vault
-	item, err := vault.AddItem(title, typeName, itemContent)
-	if err != nil {
-		fatalErr(err, "Unable to add item")
-	}
-	logItemAction("Added new item", item)
+	return itemContent
 }
 
 func editItem(vault *onepass.Vault, pattern string) {
@@ -484,6 +1540,10 @@ func editItem(vault *onepass.Vault, pattern string) {
 	if err != nil {
 		fatalErr(err, "Unable to read item content")
 	}
+	previous, err := copyItemContent(content)
+	if err != nil {
+		fatalErr(err, "Unable to read item content")
+	}
 
 	formSectionId := len(content.Sections) + 1
 	urlSectionId := len(content.Sections) + 2
@@ -521,11 +1581,18 @@ func editItem(vault *onepass.Vault, pattern string) {
 		fieldId, err := strconv.Atoi(fieldIdStr)
 		if err != nil {
 			// new field
-			section.Fields = append(section.Fields, onepass.ItemField{
+			newField := onepass.ItemField{
 				Name:  fieldIdStr,
 				Kind:  "string",
 				Title: fieldIdStr,
-			})
+			}
+			if item.TypeName == identityType {
+				newField = identityFieldForTitle(fieldIdStr)
+			}
+			err = addLabeledField(section, newField)
+			if err != nil {
+				fatalErr(err, "")
+			}
 			field = &section.Fields[len(section.Fields)-1]
 		} else if fieldId > 0 && fieldId <= len(section.Fields) {
 			field = &section.Fields[fieldId-1]
@@ -567,6 +1634,10 @@ func editItem(vault *onepass.Vault, pattern string) {
 		url.Url = readLinePrompt("%s", url.Label)
 	}
 
+	content.RecordPasswordChanges(previous, time.Now())
+
+	undo := newUndoRecorder(vault, "edit")
+	undo.snapshot(item)
 	err = item.SetContent(content)
 	if err != nil {
 		fatalErr(err, "Unable to save updated content")
@@ -575,6 +1646,7 @@ func editItem(vault *onepass.Vault, pattern string) {
 	if err != nil {
 		fatalErr(err, "Unable to save updated item")
 	}
+	undo.commit()
 }
 
 func listHelp() string {
@@ -584,6 +1656,28 @@ part of an item's title, part of an item's ID or the type of item.
 You can also specify both an item type and a title/ID pattern
 using '<item type>:<pattern>'.
 
+Flags:
+
+  -columns <names>  Show additional columns for each item.
+                    <names> is a comma-separated list of:
+                    modified, created, expires, folder, type, tags,
+                    level (security level), username and used (when
+                    the item was last shown, copied or typed).
+                    The username column requires decrypting each item.
+  -sort <key>       Sort items by title (the default), modified,
+                    created, expires, type or used (the time the item
+                    was last shown or copied).
+  -reverse          Sort items in descending order.
+  -recent           List only items which have been shown, copied or
+                    typed, most recently used first. Item usage is
+                    kept in an encrypted log in ~/.1pass-usage.
+  -trash            List only items in the trash.
+  -no-trash         Exclude items in the trash. This is the default,
+                    use -no-trash=false to list all items.
+  -expiring <period>  List only items which have expired or will
+                    expire within <period>, eg. '30d'. See
+                    'help set-expiry'.
+
 `
 
 	result += itemTypesHelp()
@@ -617,7 +1711,23 @@ func copyItemHelp() string {
 to copy. If omitted, defaults to 'password'.
 
 [field] patterns are matched against the field names in
-the same way that item name patterns are matched against item titles.`
+the same way that item name patterns are matched against item titles.
+'old-password' copies the password which the item's password replaced,
+see 'history'.
+
+When run from a terminal, 'copy' waits with a countdown until the
+timeout expires or Enter is pressed and then restores the previous
+contents of the clipboard.
+
+Flags:
+
+  -timeout <duration>  How long to keep the value on the clipboard,
+                       eg. '10s' or '2m'. Defaults to 30s or the
+                       timeout chosen with 'setup'. A timeout
+                       of 0 leaves the value on the clipboard.
+  -login               Copy the item's username first and then
+                       its password after Enter is pressed, for
+                       filling in a login form.`
 }
 
 // Returns the type code associated with a given alias.
@@ -634,6 +1744,48 @@ func typeFromAlias(alias string) string {
 }
 
 func lookupItems(vault *onepass.Vault, pattern string) ([]onepass.Item, error) {
+	ranked, err := lookupRankedItems(vault, pattern)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]onepass.Item, len(ranked))
+	for i, match := range ranked {
+		items[i] = match.item
+	}
+	return items, nil
+}
+
+// lookupRankedItems returns the items matching pattern, best match
+// first unless ranking has been disabled with -no-rank
+func lookupRankedItems(vault *onepass.Vault, pattern string) ([]rankedItem, error) {
+	items, titlePattern, err := findMatchingItems(vault, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if !rankMatches {
+		unranked := make([]rankedItem, len(items))
+		for i, item := range items {
+			unranked[i] = rankedItem{item: item}
+		}
+		return unranked, nil
+	}
+	return rankItems(items, titlePattern, readUsageScores(vault), time.Now()), nil
+}
+
+// findMatchingItems returns the items matching pattern in
+// vault order and the part of pattern matched against titles
+func findMatchingItems(vault *onepass.Vault, pattern string) ([]onepass.Item, string, error) {
+	if strings.HasPrefix(pattern, "@") {
+		items, err := lookupSavedSearch(vault, pattern[1:])
+		return items, "", err
+	}
+	if item, isAlias, err := lookupAlias(vault, pattern); isAlias {
+		if err != nil {
+			return nil, "", err
+		}
+		return []onepass.Item{item}, "", nil
+	}
+
 	typeName := typeFromAlias(pattern)
 	if typeName != "" {
 		pattern = ""
@@ -649,13 +1801,8 @@ func lookupItems(vault *onepass.Vault, pattern string) ([]onepass.Item, error) {
 		}
 	}
 
-	items, err := vault.ListItems()
-	if err != nil {
-		return items, err
-	}
 	patternLower := strings.ToLower(pattern)
-	matches := []onepass.Item{}
-	for _, item := range items {
+	items, err := vault.FindItems(func(item onepass.Item) bool {
 		patternMatch := pattern == ""
 		typeMatch := typeName == "" || item.TypeName == typeName
 
@@ -664,17 +1811,97 @@ func lookupItems(vault *onepass.Vault, pattern string) ([]onepass.Item, error) {
 			patternMatch = true
 		}
 
-		if patternMatch && typeMatch {
-			matches = append(matches, item)
+		return patternMatch && typeMatch
+	})
+	return items, pattern, err
+}
+
+// lookupItemList returns the union of the items matching
+// each pattern in patterns. A pattern of '-' reads a list of
+// item IDs, one per line, from stdin.
+func lookupItemList(vault *onepass.Vault, patterns []string) ([]onepass.Item, error) {
+	result := []onepass.Item{}
+	found := map[string]bool{}
+	for _, pattern := range patterns {
+		var items []onepass.Item
+		var err error
+		if pattern == "-" {
+			items, err = lookupItemIds(vault, os.Stdin)
+			stdinConsumed = true
+		} else {
+			items, err = lookupItems(vault, pattern)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if !found[item.Uuid] {
+				found[item.Uuid] = true
+				result = append(result, item)
+			}
 		}
 	}
-	return matches, nil
+	return result, nil
+}
+
+// lookupItemIds returns the items whose IDs are listed in src,
+// one per line
+func lookupItemIds(vault *onepass.Vault, src io.Reader) ([]onepass.Item, error) {
+	ids := map[string]bool{}
+	scanner := bufio.NewScanner(src)
+	for scanner.Scan() {
+		id := strings.TrimSpace(scanner.Text())
+		if id != "" {
+			ids[id] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	items, err := vault.FindItems(func(item onepass.Item) bool {
+		return ids[item.Uuid]
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		delete(ids, item.Uuid)
+	}
+	for id, _ := range ids {
+		fmt.Fprintf(os.Stderr, "No item with ID '%s'\n", id)
+	}
+	return items, nil
+}
+
+func multiPatternHelp() string {
+	return `Several patterns may be given, in which case the command applies to
+the items matching any of them. A pattern of '-' reads a list of
+item IDs, one per line, from stdin.`
 }
 
-// read a response to a yes/no question from stdin
+// set by lookupItemList() once item IDs have been read from
+// stdin, after which confirmations are read from the terminal
+var stdinConsumed bool
+
+// read a response to a yes/no question from stdin, or from
+// the terminal if stdin has been used for other input
 func readConfirmation() bool {
+	input := io.Reader(os.Stdin)
+	if stdinConsumed {
+		ttyPath := "/dev/tty"
+		if runtime.GOOS == "windows" {
+			ttyPath = "CONIN$"
+		}
+		tty, err := os.Open(ttyPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to ask for confirmation since item IDs were read from stdin. Use -yes to confirm.\n")
+			return false
+		}
+		defer tty.Close()
+		input = tty
+	}
 	var response string
-	count, err := fmt.Scanln(&response)
+	count, err := fmt.Fscanln(input, &response)
 	return err == nil && count > 0 && strings.ToLower(response) == "y"
 }
 
@@ -691,15 +1918,50 @@ func fatalErr(err error, context string) {
 }
 
 func readNewPassword(passType string) (string, error) {
-	fmt.Printf("%s (or '-' for a random new %s): ", passType, passType)
+	hint := fmt.Sprintf("'-' for a random new %s, '-p' for a pronounceable one", passType)
+	return readNewSecret(passType, hint, func(choice string) string {
+		switch choice {
+		case "-":
+			return genDefaultPassword()
+		case "-p":
+			return genPronounceablePassword()
+		}
+		return ""
+	})
+}
+
+// readNewPIN reads a new PIN or passcode. As with passwords,
+// '-' generates a random value, with '-<N>' selecting
+// the number of digits.
+func readNewPIN(passType string) (string, error) {
+	hint := fmt.Sprintf("'-' for a random %d digit %s, '-<N>' for N digits", defaultPINDigits, passType)
+	return readNewSecret(passType, hint, func(choice string) string {
+		if choice == "-" {
+			return onepass.GenPIN(defaultPINDigits)
+		}
+		if strings.HasPrefix(choice, "-") {
+			digits, err := strconv.Atoi(choice[1:])
+			if err == nil && digits > 0 {
+				return onepass.GenPIN(digits)
+			}
+		}
+		return ""
+	})
+}
+
+// readNewSecret prompts for a new concealed value and asks
+// for it to be entered twice. If generate returns a non-empty
+// value for the entered text, that is used instead.
+func readNewSecret(passType string, hint string, generate func(choice string) string) (string, error) {
+	fmt.Printf("%s (or %s): ", passType, hint)
 	pwd, _ := terminal.ReadPassword(0)
 	if len(pwd) == 0 {
 		fmt.Println()
 		return "", nil
 	}
-	if string(pwd) == "-" {
-		pwd = []byte(genDefaultPassword())
-		fmt.Printf("(Random new password generated)")
+	if generated := generate(string(pwd)); len(generated) > 0 {
+		pwd = []byte(generated)
+		fmt.Printf("(Random new %s generated)", passType)
 	} else {
 		fmt.Printf("\nRe-enter %s: ", passType)
 		pwd2, _ := terminal.ReadPassword(0)
@@ -747,12 +2009,17 @@ func setPassword(vault *onepass.Vault, currentPwd string) {
 	if !bytes.Equal(newPwd, newPwd2) {
 		fatalErr(nil, "Passwords do not match")
 	}
+	backup, err := vault.BackupKeys(time.Now())
+	if err != nil {
+		fatalErr(err, "Unable to back up the vault's keys")
+	}
 	err = vault.SetMasterPassword(currentPwd, string(newPwd))
 	if err != nil {
 		fatalErr(err, "Failed to change master password")
 	}
 
-	fmt.Printf("The master password has been updated.\n\n")
+	fmt.Printf("The master password has been updated.\n")
+	fmt.Printf("Use 'rollback-password %s' to restore the previous password.\n\n", backup)
 	fmt.Printf(setPasswordSyncNote)
 }
 
@@ -761,117 +2028,621 @@ other 1Password apps may still expect the old password until
 you unlock the vault with them and your new password is synced.
 `
 
-func setPasswordHelp() string {
-	return setPasswordSyncNote
+func lockHelp() string {
+	return `Makes the agent forget the vault's keys, so that the master password
+must be entered again before items can be read or changed. Vaults are
+also locked automatically after a period of inactivity.`
 }
 
-func moveItemsToFolder(vault *onepass.Vault, itemPattern string, folderPattern string) {
-	items, err := lookupItems(vault, itemPattern)
-	if err != nil {
-		fatalErr(err, "Unable to lookup items to move")
-	}
-	folderPattern = "folder:" + folderPattern
+func unlockHelp() string {
+	return fmt.Sprintf(`Asks for the master password, if the vault is locked, and unlocks it
+so that subsequent commands do not need to ask for it. The vault is
+locked again after %v of inactivity, or the period set with 'setup',
+or when 'lock' is run.`, defaultUnlockDelay)
+}
 
-	var folder onepass.Item
-	if len(folderPattern) > 0 {
-		folder, err = lookupSingleItem(vault, folderPattern)
-	}
-	for _, item := range items {
-		logItemAction("Moving item", item)
-		item.FolderUuid = folder.Uuid
-		err = item.Save()
-		if err != nil {
-			fatalErr(err, "Failed to move item to folder")
-		}
-	}
+func signInHelp() string {
+	return fmt.Sprintf(`Prints a command which sets $%s to a new session token.
+Use 'eval $(%s signin)' to start a session in the current shell.
+
+Once a session has been started, commands which access the vault
+must present a valid session token until the vault is locked,
+rather than relying only on access to the agent's socket.
+Sessions expire after %v of inactivity.`, sessionEnvVar, os.Args[0], defaultSessionDuration)
 }
 
-func removeItems(vault *onepass.Vault, pattern string) {
-	items, err := lookupItems(vault, pattern)
+func signIn(agentClient *OnePassAgentClient) {
+	// the output of this command is intended to be passed
+	// to 'eval', so prompts are written to stderr
+	fmt.Fprintf(os.Stderr, "Master password: ")
+	masterPwd, err := terminal.ReadPassword(0)
 	if err != nil {
-		fatalErr(err, "Unable to lookup items to remove")
+		os.Exit(1)
 	}
+	fmt.Fprintln(os.Stderr)
 
-	for _, item := range items {
-		fmt.Printf("Remove '%s' from vault? This cannot be undone. Y/N\n", item.Title)
-		if readConfirmation() {
-			err = item.Remove()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Unable to remove item: %s\n", err)
-			}
-		}
+	token, err := agentClient.SignIn(string(masterPwd))
+	onepass.ZeroBytes(masterPwd)
+	if err != nil {
+		fatalErr(err, "Unable to sign in")
 	}
+	fmt.Printf("export %s=%s\n", sessionEnvVar, token)
 }
 
-func trashItems(vault *onepass.Vault, pattern string) {
-	items, err := lookupItems(vault, pattern)
-	if err != nil {
-		fatalErr(err, "Unable to lookup items to trash")
-	}
-	for _, item := range items {
-		logItemAction("Trashing item", item)
-		item.Trashed = true
-		err = item.Save()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Unable to trash item: %s\n", err)
-		}
-	}
+func setPasswordHelp() string {
+	return `Before the password is changed, a copy of the vault's keys protected
+by the current password is saved in the vault. Use 'rollback-password'
+to restore it if the new password was mistyped or forgotten.
+
+` + setPasswordSyncNote
 }
 
-func restoreItems(vault *onepass.Vault, pattern string) {
-	items, err := lookupItems(vault, pattern)
-	if err != nil {
-		fatalErr(err, "Unable to lookup items to restore")
-	}
-	for _, item := range items {
-		logItemAction("Restoring item", item)
-		item.Trashed = false
-		err = item.Save()
+func rollbackPasswordHelp() string {
+	return `Restores the copy of the vault's keys saved by 'set-password',
+reverting the master password to the one in use before it was changed.
+[backup] is the timestamp of the copy to restore, as printed by
+'set-password'. If omitted, the most recent copy is restored.
+
+Copies saved before the vault was re-encrypted with 'reencrypt'
+cannot be restored.`
+}
+
+func rollbackPassword(vault *onepass.Vault, backup string) {
+	if backup == "" {
+		backups, err := vault.KeyBackups()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Unable to restore item: %s\n", err)
+			fatalErr(err, "Unable to list key backups")
 		}
+		if len(backups) == 0 {
+			fatalErr(onepass.ErrNoKeyBackups, "")
+		}
+		backup = backups[len(backups)-1]
+	}
+	fmt.Printf("Restore the master password in use before %s? Y/N\n", backup)
+	if !readConfirmation() {
+		return
+	}
+	_, err := vault.RestoreKeys(backup)
+	if err != nil {
+		fatalErr(err, "Unable to restore the previous master password")
 	}
+	fmt.Printf("The previous master password has been restored.\n\n")
+	fmt.Printf(setPasswordSyncNote)
 }
 
-func lookupSingleItem(vault *onepass.Vault, pattern string) (onepass.Item, error) {
-	items, err := lookupItems(vault, pattern)
+func reEncryptVault(vault *onepass.Vault, agent *OnePassAgentClient, masterPwd string, securityLevel string) {
+	// the undo journal and usage log are encrypted with the old
+	// keys, so they are read before the keys are replaced
+	err := vault.Unlock(masterPwd)
 	if err != nil {
-		fatalErr(err, "Unable to lookup items")
+		fatalErr(err, "Failed to re-encrypt vault")
+	}
+	oldAgent := vault.CryptoAgent
+	defer oldAgent.Lock()
+	journalPath := undoJournalPath(vault.Path)
+	journal, journalErr := onepass.OpenJournal(vault, journalPath)
+	usagePath := usageLogPath(vault.Path)
+	usage, usageErr := onepass.OpenUsageLog(vault, usagePath)
+
+	fmt.Printf("Re-encrypting vault...\n")
+	err = vault.ReEncrypt(masterPwd, strings.ToUpper(securityLevel))
+	if err != nil {
+		fatalErr(err, "Failed to re-encrypt vault")
 	}
 
-	if len(items) == 0 {
-		return onepass.Item{}, fmt.Errorf("No matching items")
+	if journalErr == nil {
+		journalErr = journal.ReEncrypt(oldAgent)
+	}
+	if journalErr != nil {
+		fmt.Fprintf(os.Stderr, "Unable to re-encrypt undo journal: %v. Earlier changes can no longer be undone.\n", journalErr)
+		os.Remove(journalPath)
+	}
+	if usageErr == nil {
+		usageErr = usage.ReEncrypt()
+	}
+	if usageErr != nil {
+		fmt.Fprintf(os.Stderr, "Unable to re-encrypt usage log: %v. Item usage has been reset.\n", usageErr)
+		os.Remove(usagePath)
 	}
 
-	if len(items) > 1 {
-		fmt.Fprintf(os.Stderr, "Multiple matching items:\n")
-		for _, item := range items {
-			fmt.Fprintf(os.Stderr, "  %s (%s)\n", item.Title, item.Uuid)
-		}
-		return onepass.Item{}, fmt.Errorf("Multiple matching items")
+	// the agent still holds the old keys, so force them
+	// to be discarded
+	err = agent.Lock()
+	if err != nil {
+		fatalErr(err, "Failed to lock keychain")
 	}
 
-	return items[0], nil
+	fmt.Printf("The vault has been re-encrypted with new keys.\n\n")
+	fmt.Printf(reEncryptSyncNote)
 }
 
-func renameItem(vault *onepass.Vault, pattern string, newTitle string) {
-	item, err := lookupSingleItem(vault, pattern)
-	if err != nil {
+const reEncryptSyncNote = `Note that other 1Password apps will need to
+re-read the entire vault once the re-encrypted items
+have been synced.
+`
+
+func reEncryptHelp() string {
+	return `Generates new random encryption keys for the vault and
+re-encrypts every item using them. This is useful if the existing
+keys may have been exposed or after importing data from elsewhere.
+If re-encryption fails, the vault is left unchanged.
+
+Flags:
+
+  -security-level <level>  Move all items to the security level
+                           <level>, eg. SL5, as they are re-encrypted.
+                           By default items keep their current level.
+
+` + reEncryptSyncNote
+}
+
+func backupHelp() string {
+	return fmt.Sprintf(`Saves a copy of the vault folder, with items still
+encrypted, to a timestamped .tar.gz archive in [dest].
+[dest] defaults to '%s'.
+
+Flags:
+
+  -keep <count>  Remove older backups of the vault in [dest],
+                 keeping only the newest <count>.`, defaultBackupDir)
+}
+
+func restoreBackupHelp() string {
+	return `Replaces the vault with the contents of a backup archive
+created with 'backup'. If the vault already exists it is
+moved aside to a timestamped folder rather than being removed.`
+}
+
+func createBackup(vault *onepass.Vault, destDir string, keep int) {
+	if destDir == "" {
+		destDir = defaultBackupDir
+	}
+	archivePath, err := backupVault(vault.Path, destDir, time.Now())
+	if err != nil {
+		fatalErr(err, "Unable to backup vault")
+	}
+	fmt.Printf("Saved backup to %s\n", archivePath)
+
+	if keep > 0 {
+		removed, err := pruneBackups(vault.Path, destDir, keep)
+		for _, path := range removed {
+			fmt.Printf("Removed old backup %s\n", path)
+		}
+		if err != nil {
+			fatalErr(err, "Unable to remove old backups")
+		}
+	}
+}
+
+func restoreVaultBackup(vaultPath string, archivePath string) {
+	movedVaultPath, err := restoreBackup(archivePath, vaultPath, time.Now())
+	if err != nil {
+		fatalErr(err, "Unable to restore backup")
+	}
+	if movedVaultPath != "" {
+		fmt.Printf("Moved existing vault to %s\n", movedVaultPath)
+	}
+	fmt.Printf("Restored vault from %s to %s\n", archivePath, vaultPath)
+}
+
+func checkVault(vault *onepass.Vault, masterPwd string) {
+	problems := vault.CheckIntegrity(masterPwd)
+	for _, problem := range problems {
+		fmt.Printf("%s\n", problem)
+		if len(problem.Fix) > 0 {
+			fmt.Printf("  Fix: %s\n", problem.Fix)
+		}
+	}
+	if len(problems) > 0 {
+		fmt.Printf("\n%d problem(s) found in %s\n", len(problems), vault.Path)
+		os.Exit(1)
+	}
+	fmt.Printf("No problems found in %s\n", vault.Path)
+}
+
+func checkVaultHelp() string {
+	return `Verifies that the entries in the vault's contents.js index match
+the item files in the vault, that the encryption keys can be decrypted
+and validated with the master password and that every item can be
+decrypted. Each problem found is reported with a suggested fix.`
+}
+
+func reindexHelp() string {
+	return `Regenerates the vault's contents.js index, which lists the title,
+type and folder of each item, from the item files in the vault. The
+vault does not need to be unlocked.
+
+The index is also rebuilt automatically before running other commands
+if it is missing or does not list the same items as the item files.
+This can happen after restoring item files by hand or if a sync was
+interrupted. The item files are only compared with the index if files
+were added to or removed from the vault's data folder since the index
+was last written. Entries whose details differ from their item file are
+reported by 'check'.`
+}
+
+func reindexVault(vault *onepass.Vault) {
+	count, err := vault.RebuildContentsIndex()
+	if err != nil {
+		fatalErr(err, "Unable to rebuild contents.js")
+	}
+	fmt.Printf("Rebuilt contents.js with %d items\n", count)
+}
+
+// rebuildStaleIndex rebuilds the vault's contents.js index if
+// it is out of date with the item files
+func rebuildStaleIndex(vault *onepass.Vault) {
+	stale, err := vault.ContentsIndexIsStale()
+	if err != nil || !stale {
+		return
+	}
+	if vault.ReadOnly {
+		fmt.Fprintf(os.Stderr, "The vault's contents.js index is out of date. Run 'reindex' to rebuild it.\n")
+		return
+	}
+	fmt.Fprintf(os.Stderr, "The vault's contents.js index is out of date, rebuilding it\n")
+	_, err = vault.RebuildContentsIndex()
+	if err != nil {
+		fatalErr(err, "Unable to rebuild contents.js")
+	}
+}
+
+func moveHelp() string {
+	return multiPatternHelp() + `
+
+If [folder-pattern] is omitted, the items are moved out of
+their folders to the top level of the vault.
+
+Flags:
+
+  -create  Create a folder named [folder-pattern] if no
+           folder matches it, without asking first.`
+}
+
+// lookupFolder returns the folder matching pattern. If there is
+// no matching folder, the user is asked whether to create a new
+// folder named after the pattern, unless create is true in which
+// case the folder is created without asking.
+func lookupFolder(vault *onepass.Vault, pattern string, create bool) onepass.Item {
+	title := strings.TrimSuffix(pattern, "/")
+	folders, err := lookupItems(vault, "folder:"+title)
+	if err != nil {
+		fatalErr(err, "Unable to lookup folder")
+	}
+	if len(folders) > 0 {
+		folder, err := lookupSingleItem(vault, "folder:"+title)
+		if err != nil {
+			fatalErr(err, "Unable to find folder")
+		}
+		return folder
+	}
+
+	if !create {
+		fmt.Printf("No folder matches '%s'. Create folder '%s'? Y/N\n", pattern, title)
+		if !readConfirmation() {
+			fatalErr(fmt.Errorf("No matching folder"), "")
+		}
+	}
+	undo := newUndoRecorder(vault, "add")
+	folder, err := vault.AddItem(title, "system.folder.Regular", onepass.ItemContent{})
+	if err != nil {
+		fatalErr(err, "Unable to create folder")
+	}
+	undo.added(folder)
+	undo.commit()
+	logItemAction("Created folder", folder)
+	return folder
+}
+
+func moveItemsToFolder(vault *onepass.Vault, itemPatterns []string, folderPattern string, create bool) {
+	items, err := lookupItemList(vault, itemPatterns)
+	if err != nil {
+		fatalErr(err, "Unable to lookup items to move")
+	}
+
+	var folder onepass.Item
+	if len(folderPattern) > 0 {
+		folder = lookupFolder(vault, folderPattern, create)
+	}
+	undo := newUndoRecorder(vault, "move")
+	defer undo.commit()
+	for _, item := range items {
+		logItemAction("Moving item", item)
+		undo.snapshot(item)
+		item.FolderUuid = folder.Uuid
+		err = item.Save()
+		if err != nil {
+			fatalErr(err, "Failed to move item to folder")
+		}
+	}
+}
+
+func confirmHelp() string {
+	return `Flags:
+
+  -yes  Do not ask for confirmation before changing
+        the matching items. -force is an alias for -yes.`
+}
+
+func trashHelp() string {
+	return multiPatternHelp() + "\n\n" + confirmHelp()
+}
+
+// confirmItems lists items and asks the user to confirm that
+// action should be applied to all of them. If assumeYes is true,
+// the items are listed without asking for confirmation.
+func confirmItems(action string, items []onepass.Item, assumeYes bool) bool {
+	if len(items) == 0 {
+		fmt.Printf("No matching items\n")
+		return false
+	}
+	if assumeYes {
+		return true
+	}
+	for _, item := range items {
+		fmt.Printf("  %s (%s)\n", item.Title, shortItemId(item.Uuid))
+	}
+	fmt.Printf("%s %d item(s)? Y/N\n", action, len(items))
+	return readConfirmation()
+}
+
+func removeItems(vault *onepass.Vault, patterns []string, assumeYes bool) {
+	items, err := lookupItemList(vault, patterns)
+	if err != nil {
+		fatalErr(err, "Unable to lookup items to remove")
+	}
+	if !confirmItems("Remove", items, assumeYes) {
+		return
+	}
+
+	undo := newUndoRecorder(vault, "remove")
+	defer undo.commit()
+	for _, item := range items {
+		logItemAction("Removing item", item)
+		undo.snapshot(item)
+		err = item.Remove()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to remove item: %s\n", err)
+		}
+	}
+}
+
+func purgeHelp() string {
+	return `Unlike 'remove', only items which are already in the trash are
+removed. Matching items which are not in the trash are skipped, so
+items can be safely deleted by trashing them first and purging them
+later.
+
+` + confirmHelp()
+}
+
+// purgeItems permanently removes the items in the
+// trash which match pattern
+func purgeItems(vault *onepass.Vault, pattern string, assumeYes bool) {
+	items, err := lookupItems(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Unable to lookup items to purge")
+	}
+	trashed := filterTrashed(items, listOptions{onlyTrashed: true})
+	for _, item := range items {
+		if !item.Trashed {
+			fmt.Fprintf(os.Stderr, "Skipping '%s' (%s), which is not in the trash\n", item.Title, shortItemId(item.Uuid))
+		}
+	}
+	if len(trashed) == 0 {
+		fatalErr(fmt.Errorf("No matching items in the trash"), "")
+	}
+	if !confirmItems("Permanently remove", trashed, assumeYes) {
+		return
+	}
+
+	undo := newUndoRecorder(vault, "purge")
+	defer undo.commit()
+	for _, item := range trashed {
+		logItemAction("Purging item", item)
+		undo.snapshot(item)
+		err = item.Remove()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to remove item: %s\n", err)
+		}
+	}
+}
+
+func trashItems(vault *onepass.Vault, patterns []string, assumeYes bool) {
+	items, err := lookupItemList(vault, patterns)
+	if err != nil {
+		fatalErr(err, "Unable to lookup items to trash")
+	}
+	if !confirmItems("Trash", items, assumeYes) {
+		return
+	}
+	undo := newUndoRecorder(vault, "trash")
+	defer undo.commit()
+	for _, item := range items {
+		logItemAction("Trashing item", item)
+		undo.snapshot(item)
+		item.Trashed = true
+		err = item.Save()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to trash item: %s\n", err)
+		}
+	}
+}
+
+func restoreItems(vault *onepass.Vault, pattern string) {
+	items, err := lookupItems(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Unable to lookup items to restore")
+	}
+	undo := newUndoRecorder(vault, "restore")
+	defer undo.commit()
+	for _, item := range items {
+		logItemAction("Restoring item", item)
+		undo.snapshot(item)
+		item.Trashed = false
+		err = item.Save()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to restore item: %s\n", err)
+		}
+	}
+}
+
+func lookupSingleItem(vault *onepass.Vault, pattern string) (onepass.Item, error) {
+	ranked, err := lookupRankedItems(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Unable to lookup items")
+	}
+
+	if len(ranked) == 0 {
+		return onepass.Item{}, fmt.Errorf("No matching items")
+	}
+
+	if len(ranked) > 1 {
+		if bestMatch(ranked) {
+			debugf("Chose '%s' from %d items matching '%s'", ranked[0].item.Title, len(ranked), pattern)
+			return ranked[0].item, nil
+		}
+		fmt.Fprintf(os.Stderr, "Multiple matching items:\n")
+		for _, match := range ranked {
+			fmt.Fprintf(os.Stderr, "  %s (%s)\n", match.item.Title, match.item.Uuid)
+		}
+		return onepass.Item{}, fmt.Errorf("Multiple matching items")
+	}
+
+	return ranked[0].item, nil
+}
+
+func renameItem(vault *onepass.Vault, pattern string, newTitle string) {
+	item, err := lookupSingleItem(vault, pattern)
+	if err != nil {
 		fatalErr(err, "Failed to find item to rename")
 	}
 	logItemAction("Renaming item", item)
+	undo := newUndoRecorder(vault, "rename")
+	undo.snapshot(item)
 	item.Title = newTitle
 	err = item.Save()
 	if err != nil {
 		fatalErr(err, "Failed to rename item")
 	}
+	undo.commit()
+}
+
+// duplicateItem creates a new item with a copy of the content,
+// folder and tags of the item matching pattern
+func duplicateItem(vault *onepass.Vault, pattern string, newTitle string) {
+	item, err := lookupSingleItem(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Failed to find item to duplicate")
+	}
+	content, err := item.Content()
+	if err != nil {
+		fatalErr(err, fmt.Sprintf("Failed to decrypt item '%s'", item.Title))
+	}
+	if newTitle == "" {
+		newTitle = item.Title + " (copy)"
+	}
+	securityLevel := item.SecurityLevel
+	if securityLevel == "" {
+		securityLevel = "SL5"
+	}
+	undo := newUndoRecorder(vault, "duplicate")
+	var newItem onepass.Item
+	if item.TypeName == onepass.DocumentType {
+		var info onepass.DocumentInfo
+		var data []byte
+		info, err = item.DocumentInfo()
+		if err == nil {
+			data, err = item.DocumentData()
+		}
+		if err != nil {
+			fatalErr(err, fmt.Sprintf("Unable to read document '%s'", item.Title))
+		}
+		newItem, err = vault.AddDocument(newTitle, info.FileName, data)
+	} else {
+		newItem, err = vault.AddItemAtLevel(newTitle, item.TypeName, securityLevel, content)
+	}
+	if err != nil {
+		fatalErr(err, "Unable to add item")
+	}
+	if item.FolderUuid != "" || len(item.OpenContents.Tags) > 0 {
+		newItem.FolderUuid = item.FolderUuid
+		newItem.OpenContents.Tags = append([]string{}, item.OpenContents.Tags...)
+		err = newItem.Save()
+		if err != nil {
+			fatalErr(err, "Unable to save item")
+		}
+	}
+	undo.added(newItem)
+	undo.commit()
+	logItemAction(fmt.Sprintf("Duplicated '%s' as", item.Title), newItem)
+}
+
+// findFieldValue returns the title and value of the first field,
+// web form field or URL in content which matches fieldPattern
+func findFieldValue(content onepass.ItemContent, fieldPattern string) (string, string) {
+	if fieldPattern == oldPasswordField {
+		return "previous password", content.PreviousPassword()
+	}
+	field := content.FieldByPattern(fieldPattern)
+	if field != nil {
+		return field.Title, field.ValueString()
+	}
+	formField := content.FormFieldByPattern(fieldPattern)
+	if formField != nil {
+		return formField.Name, formField.Value
+	}
+	urlField := content.UrlByPattern(fieldPattern)
+	if urlField != nil {
+		return urlField.Label, urlField.Url
+	}
+	return "", ""
+}
+
+// copyLogin copies the username from the item matching pattern to
+// the clipboard and then replaces it with the password once the
+// user presses Enter
+func copyLogin(vault *onepass.Vault, pattern string, timeout time.Duration) {
+	item, err := lookupSingleItem(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Failed to find item to copy")
+	}
+	warnIfExpired(item)
+	content, err := item.Content()
+	if err != nil {
+		fatalErr(err, fmt.Sprintf("Failed to decrypt item '%s'", item.Title))
+	}
+	username := itemUsername(content)
+	_, password := findFieldValue(content, "password")
+	if username == "" || password == "" {
+		fatalErr(fmt.Errorf("'%s' does not have both a username and a password", item.Title), "")
+	}
+
+	previous, _ := readClipboard()
+	err = writeClipboard(username)
+	if err != nil {
+		fatalErr(err, "Failed to copy username to clipboard")
+	}
+	fmt.Printf("Copied username to clipboard for item '%s', press Enter to copy the password", item.Title)
+	readLine()
+
+	err = writeClipboard(password)
+	if err != nil {
+		fatalErr(err, "Failed to copy password to clipboard")
+	}
+	fmt.Printf("Copied password to clipboard for item '%s'\n", item.Title)
+	recordItemUse(vault, item)
+	if timeout > 0 && terminal.IsTerminal(0) && terminal.IsTerminal(1) {
+		holdClipboard("password", password, previous, timeout)
+	}
 }
 
-func copyToClipboard(vault *onepass.Vault, pattern string, fieldPattern string) {
+func copyToClipboard(vault *onepass.Vault, pattern string, fieldPattern string, timeout time.Duration) {
 	item, err := lookupSingleItem(vault, pattern)
 	if err != nil {
 		fatalErr(err, "Failed to find item to copy")
 	}
+	warnIfExpired(item)
 
 	content, err := item.Content()
 	if err != nil {
@@ -882,36 +2653,77 @@ func copyToClipboard(vault *onepass.Vault, pattern string, fieldPattern string)
 		fieldPattern = "password"
 	}
 
-	fieldTitle := ""
-	value := ""
-	field := content.FieldByPattern(fieldPattern)
-	if field != nil {
-		fieldTitle = field.Title
-		value = field.ValueString()
-	} else {
-		formField := content.FormFieldByPattern(fieldPattern)
-		if formField != nil {
-			fieldTitle = formField.Name
-			value = formField.Value
-		} else {
-			urlField := content.UrlByPattern(fieldPattern)
-			if urlField != nil {
-				fieldTitle = urlField.Label
-				value = urlField.Url
-			}
-		}
-	}
-
+	fieldTitle, value := findFieldValue(content, fieldPattern)
 	if len(value) == 0 {
 		fatalErr(fmt.Errorf("onepass.Item has no fields, web form fields or websites matching pattern '%s'\n", fieldPattern), "")
 	}
 
-	err = clipboard.WriteAll(value)
+	// the previous contents are only restored when running
+	// interactively, so that scripts are not held up
+	interactive := timeout > 0 && terminal.IsTerminal(0) && terminal.IsTerminal(1)
+	previous := ""
+	if interactive {
+		previous, _ = readClipboard()
+	}
+
+	err = writeClipboard(value)
 	if err != nil {
-		fatalErr(err, fmt.Sprintf("Failed to copy '%s' field to clipboard", field))
+		fatalErr(err, fmt.Sprintf("Failed to copy '%s' field to clipboard", fieldTitle))
 	}
 
 	fmt.Printf("Copied '%s' to clipboard for item '%s'\n", fieldTitle, item.Title)
+	recordItemUse(vault, item)
+	if interactive {
+		holdClipboard(fieldTitle, value, previous, timeout)
+	}
+}
+
+func openHelp() string {
+	return `Opens the item's website in the default browser.
+
+Flags:
+
+  -copy                Copy the item's password to the clipboard
+                       after opening the website, as with 'copy'.
+  -timeout <duration>  How long to keep the password on the clipboard.
+                       Defaults to 30s.`
+}
+
+// openItem opens the website of the item matching pattern in
+// the default browser and optionally copies its password
+func openItem(vault *onepass.Vault, pattern string, copyPassword bool, timeout time.Duration) {
+	item, err := lookupSingleItem(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Failed to find item to open")
+	}
+	warnIfExpired(item)
+	url := item.Location
+	if url == "" {
+		content, err := item.Content()
+		if err != nil {
+			fatalErr(err, fmt.Sprintf("Failed to decrypt item '%s'", item.Title))
+		}
+		if len(content.Urls) > 0 {
+			url = content.Urls[0].Url
+		}
+	}
+	if url == "" {
+		fatalErr(fmt.Errorf("'%s' does not have a website", item.Title), "")
+	}
+	if !strings.Contains(url, "://") {
+		url = "https://" + url
+	}
+
+	fmt.Printf("Opening %s\n", url)
+	err = openURL(url)
+	if err != nil {
+		fatalErr(err, "Unable to open browser")
+	}
+	if copyPassword {
+		copyToClipboard(vault, item.Uuid, "password", timeout)
+	} else {
+		recordItemUse(vault, item)
+	}
 }
 
 // create a set of item templates based on existing
@@ -982,52 +2794,348 @@ func exportItemTemplates(vault *onepass.Vault, pattern string) {
 	_, _ = os.Stdout.Write(prettyJson(data))
 }
 
-func exportItems(vault *onepass.Vault, pattern string, path string) {
-	if !strings.HasSuffix(path, ".1pif") {
+func exportHelp() string {
+	return multiPatternHelp() + `
+
+Flags:
+
+  -encrypted  Export the items to a single file encrypted with
+              a passphrase instead of an unencrypted directory.
+              The file can be imported again with 'import'.`
+}
+
+func importHelp() string {
+	help := `<path> may also be a passphrase-protected file created
+with 'export -encrypted', in which case the passphrase
+will be requested.
+
+To import several files at once, <path> can be a directory, in which
+case every file in it is imported, or a quoted glob pattern such as
+'exports/*.1pif'. The result for each file and a summary are printed.
+
+Exports from other password managers can also be imported.
+The format is detected from the file's contents.
+
+Flags:
+
+  -format <name>  Read <path> in the given format instead of
+                  detecting it.
+
+Formats:
+`
+	for _, format := range onepass.ImportFormats {
+		help += fmt.Sprintf("\n  %-8s %s", format.Name, format.Description)
+	}
+	return help
+}
+
+func exportItems(vault *onepass.Vault, patterns []string, path string, encrypted bool) {
+	if !encrypted && !strings.HasSuffix(path, ".1pif") {
 		path += ".1pif"
 	}
-	items, err := lookupItems(vault, pattern)
+	items, err := lookupItemList(vault, patterns)
 	if err != nil {
 		fatalErr(err, "Unable to lookup items")
 	}
 	for _, item := range items {
 		logItemAction("Exporting item", item)
 	}
-	err = onepass.ExportItems(items, path)
+	if encrypted {
+		passphrase := readNewPassphrase()
+		err = onepass.ExportEncryptedItems(items, path, passphrase)
+	} else {
+		err = onepass.ExportItems(items, path)
+	}
 	if err != nil {
 		fatalErr(err, "Unable to export items")
 	}
 }
 
-func importItems(vault *onepass.Vault, path string) {
-	items, err := onepass.ImportItems(path)
+// reads a passphrase for encrypting exported data
+func readNewPassphrase() string {
+	fmt.Printf("Passphrase for exported data: ")
+	passphrase, _ := terminal.ReadPassword(0)
+	fmt.Printf("\nRe-enter passphrase: ")
+	passphrase2, _ := terminal.ReadPassword(0)
+	fmt.Println()
+	if !bytes.Equal(passphrase, passphrase2) {
+		fatalErr(nil, "Passphrases do not match")
+	}
+	if len(passphrase) == 0 {
+		fatalErr(nil, "Passphrase must not be empty")
+	}
+	return string(passphrase)
+}
+
+// importPaths expands the path given to 'import', which may be a
+// single file, a .1pif directory, a directory of exported files
+// or a glob pattern, into a list of files to import
+func importPaths(path string) ([]string, error) {
+	if strings.ContainsAny(path, "*?[") {
+		paths, err := filepath.Glob(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("No files match '%s'", path)
+		}
+		return paths, nil
+	}
+	info, err := os.Stat(path)
 	if err != nil {
-		fatalErr(err, "Unable to import items")
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
 	}
+	if _, err := os.Stat(path + "/data.1pif"); err == nil {
+		return []string{path}, nil
+	}
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
+			paths = append(paths, filepath.Join(path, entry.Name()))
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("No files to import in '%s'", path)
+	}
+	return paths, nil
+}
+
+// importFile adds the items from an exported file to the vault and
+// returns the number of items imported. The passphrase for encrypted
+// exports is requested the first time it is needed and then reused.
+func importFile(vault *onepass.Vault, path string, format string, passphrase *string) (int, error) {
+	items, err := readImportFile(path, format, passphrase)
+	if err != nil {
+		return 0, err
+	}
+	// the items are written together so that either all
+	// or none of the items in the file are imported
+	batch := vault.NewBatch()
 	for _, importedItem := range items {
-		item, err := vault.AddItem(importedItem.Title, importedItem.TypeName, importedItem.SecureContents)
+		_, err := batch.ImportItem(importedItem)
 		if err != nil {
-			fatalErr(err, fmt.Sprintf("Unable to import item '%s'", importedItem.Title))
+			return 0, fmt.Errorf("Unable to import item '%s': %v", importedItem.Title, err)
 		}
+	}
+	imported, err := batch.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("Unable to import items: %v", err)
+	}
+	undo := newUndoRecorder(vault, "import")
+	for _, item := range imported {
+		undo.added(item)
 		logItemAction("Imported item", item)
 	}
+	undo.commit()
+	return len(imported), nil
+}
+
+// readImportFile reads the items from an exported file, asking
+// for the passphrase of encrypted exports if it is not yet known
+func readImportFile(path string, format string, passphrase *string) ([]onepass.ExportedItem, error) {
+	if format == "" && onepass.IsEncryptedExport(path) {
+		if *passphrase == "" {
+			fmt.Printf("Passphrase: ")
+			input, _ := terminal.ReadPassword(0)
+			fmt.Println()
+			*passphrase = string(input)
+		}
+		return onepass.ImportEncryptedItems(path, *passphrase)
+	}
+	return onepass.ImportItemsFrom(path, format)
+}
+
+func importItems(vault *onepass.Vault, path string, format string) {
+	paths, err := importPaths(path)
+	if err != nil {
+		fatalErr(err, "Unable to import items")
+	}
+	var passphrase string
+	if len(paths) == 1 {
+		_, err = importFile(vault, paths[0], format, &passphrase)
+		if err != nil {
+			fatalErr(err, "Unable to import items")
+		}
+		return
+	}
+
+	imported := 0
+	failed := 0
+	for _, path := range paths {
+		count, err := importFile(vault, path, format, &passphrase)
+		imported += count
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, colorize(colorRed, err.Error()))
+			continue
+		}
+		fmt.Printf("%s: imported %d item(s)\n", path, count)
+	}
+	fmt.Printf("Imported %d item(s) from %d of %d files\n", imported, len(paths)-failed, len(paths))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func shareHelp() string {
+	return `Encrypts the item matching <pattern> with a one-off passphrase and
+prints it as a blob of text, or writes it to [file], which can be sent
+to someone else and added to their vault with 'receive'.
+
+A random passphrase is generated and printed, which should be passed
+on separately from the blob, eg. by phone.
+
+Flags:
+
+  -ask  Enter the passphrase instead of generating one.`
+}
+
+func receiveHelp() string {
+	return `Adds an item shared with 'share' to the vault. <shared-item> is
+either the text printed by 'share' or the path of the file it wrote.
+You will be prompted for the passphrase used to share the item.`
+}
+
+func shareItem(vault *onepass.Vault, pattern string, path string, askPassphrase bool) {
+	item, err := lookupSingleItem(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Failed to find item to share")
+	}
+	var passphrase string
+	if askPassphrase {
+		passphrase = readNewPassphrase()
+	} else {
+		passphrase = onepass.GenPassword(16)
+	}
+	blob, err := onepass.ShareItem(item, passphrase)
+	if err != nil {
+		fatalErr(err, fmt.Sprintf("Unable to share '%s'", item.Title))
+	}
+
+	if path != "" {
+		err = ioutil.WriteFile(path, []byte(blob+"\n"), 0600)
+		if err != nil {
+			fatalErr(err, "Unable to save shared item")
+		}
+		fmt.Printf("Saved '%s' to %s\n", item.Title, path)
+	} else {
+		fmt.Printf("%s\n", blob)
+	}
+	if !askPassphrase {
+		fmt.Fprintf(os.Stderr, "Passphrase: %s\n", passphrase)
+	}
+}
+
+func receiveItem(vault *onepass.Vault, sharedItem string) {
+	blob := sharedItem
+	if !strings.HasPrefix(sharedItem, onepass.SharedItemPrefix) {
+		data, err := ioutil.ReadFile(sharedItem)
+		if err != nil {
+			fatalErr(err, "Unable to read shared item")
+		}
+		blob = string(data)
+	}
+	fmt.Printf("Passphrase: ")
+	passphrase, _ := terminal.ReadPassword(0)
+	fmt.Println()
+	received, err := onepass.ReceiveItem(blob, string(passphrase))
+	onepass.ZeroBytes(passphrase)
+	if err != nil {
+		fatalErr(err, "Unable to decrypt shared item")
+	}
+	undo := newUndoRecorder(vault, "receive")
+	item, err := vault.ImportItem(received)
+	if err != nil {
+		fatalErr(err, fmt.Sprintf("Unable to add item '%s'", received.Title))
+	}
+	undo.added(item)
+	undo.commit()
+	logItemAction("Received item", item)
 }
 
 func listTag(vault *onepass.Vault, tag string) {
 	items, err := vault.ListItems()
 	if err != nil {
-		fatalErr(err, "Unable to list vault items")
+		fatalErr(err, "Unable to list vault items")
+	}
+	itemsWithTag := []onepass.Item{}
+	for _, item := range items {
+		hasTag := rangeutil.Contains(0, len(item.OpenContents.Tags), func(i int) bool {
+			return item.OpenContents.Tags[i] == tag
+		})
+		if hasTag {
+			itemsWithTag = append(itemsWithTag, item)
+		}
+	}
+	listItems(vault, itemsWithTag, listOptions{})
+}
+
+// formatSize formats a size in bytes, eg. '1.5 MB'
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d bytes", size)
+	}
+	value := float64(size) / unit
+	suffixes := []string{"KB", "MB", "GB"}
+	i := 0
+	for value >= unit && i < len(suffixes)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", value, suffixes[i])
+}
+
+// agentStatus returns whether the agent is running and has
+// the vault unlocked, without starting the agent
+func agentStatus(vaultPath string) string {
+	if remoteAddr := os.Getenv(remoteAgentEnvVar); remoteAddr != "" {
+		return fmt.Sprintf("remote agent at %s", remoteAddr)
+	}
+	agentClient, err := DialAgent(vaultPath)
+	if err != nil {
+		return "not running"
+	}
+	locked, err := agentClient.IsLocked()
+	if err != nil {
+		return fmt.Sprintf("unknown (%v)", err)
+	}
+	if locked {
+		return "running, vault locked"
+	}
+	return "running, vault unlocked"
+}
+
+func showVaultInfo(vault *onepass.Vault) {
+	fmt.Printf("Vault path: %s\n", vault.Path)
+	if vault.ReadOnly {
+		fmt.Printf("Read-only: yes\n")
+	}
+	info, err := vault.Info()
+	if err != nil {
+		fatalErr(err, "Unable to read vault info")
 	}
-	itemsWithTag := []onepass.Item{}
-	for _, item := range items {
-		hasTag := rangeutil.Contains(0, len(item.OpenContents.Tags), func(i int) bool {
-			return item.OpenContents.Tags[i] == tag
-		})
-		if hasTag {
-			itemsWithTag = append(itemsWithTag, item)
-		}
+	fmt.Printf("Format: %s\n", info.Format)
+	fmt.Printf("Items: %d (%d in trash)\n", info.Items, info.Trashed)
+	fmt.Printf("Folders: %d\n", info.Folders)
+	levels := []string{}
+	for level := range info.KeyIterations {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+	for _, level := range levels {
+		fmt.Printf("PBKDF2 iterations (%s): %d\n", level, info.KeyIterations[level])
 	}
-	listItems(vault, itemsWithTag)
+	fmt.Printf("Size: %s\n", formatSize(info.Size))
+	fmt.Printf("Last modified: %s\n", formatItemTime(uint64(info.Modified.Unix())))
+	fmt.Printf("Agent: %s\n", agentStatus(vault.Path))
 }
 
 func listTags(vault *onepass.Vault) {
@@ -1051,17 +3159,20 @@ func listTags(vault *onepass.Vault) {
 	}
 }
 
-func addTag(vault *onepass.Vault, pattern string, tag string) {
-	items, err := lookupItems(vault, pattern)
+func addTag(vault *onepass.Vault, patterns []string, tag string) {
+	items, err := lookupItemList(vault, patterns)
 	if err != nil {
 		fatalErr(err, "Unable to lookup items")
 	}
+	undo := newUndoRecorder(vault, "tag")
+	defer undo.commit()
 	for _, item := range items {
 		hasTag := rangeutil.Contains(0, len(item.OpenContents.Tags), func(i int) bool {
 			return item.OpenContents.Tags[i] == tag
 		})
 		if !hasTag {
 			logItemAction("Tagging item", item)
+			undo.snapshot(item)
 			item.OpenContents.Tags = append(item.OpenContents.Tags, tag)
 			err = item.Save()
 			if err != nil {
@@ -1071,17 +3182,20 @@ func addTag(vault *onepass.Vault, pattern string, tag string) {
 	}
 }
 
-func removeTag(vault *onepass.Vault, pattern string, tag string) {
-	items, err := lookupItems(vault, pattern)
+func removeTag(vault *onepass.Vault, patterns []string, tag string) {
+	items, err := lookupItemList(vault, patterns)
 	if err != nil {
 		fatalErr(err, "Unable to lookup items")
 	}
+	undo := newUndoRecorder(vault, "tag")
+	defer undo.commit()
 	for _, item := range items {
 		hasTag := rangeutil.Contains(0, len(item.OpenContents.Tags), func(i int) bool {
 			return item.OpenContents.Tags[i] == tag
 		})
 		if hasTag {
 			logItemAction("Untagging item", item)
+			undo.snapshot(item)
 			newTags := []string{}
 			for _, existingTag := range item.OpenContents.Tags {
 				if existingTag != tag {
@@ -1098,37 +3212,131 @@ func removeTag(vault *onepass.Vault, pattern string, tag string) {
 }
 
 func handleVaultCmd(vault *onepass.Vault, mode string, cmdArgs []string) {
+	defer debugTimer(fmt.Sprintf("Command '%s'", mode))()
 	parser := cmdmodes.NewParser(commandModes)
 	var err error
 	switch mode {
+	case "list-trash":
+		fallthrough
 	case "list":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		columns := flags.String("columns", "", "")
+		sortBy := flags.String("sort", "", "")
+		reverse := flags.Bool("reverse", false, "")
+		onlyTrashed := flags.Bool("trash", mode == "list-trash", "")
+		excludeTrashed := flags.Bool("no-trash", true, "")
+		expiring := flags.String("expiring", "", "")
+		recent := flags.Bool("recent", false, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		if *recent && *sortBy == "" {
+			*sortBy = "used"
+			*reverse = !*reverse
+		}
+		options, err := parseListOptions(*columns, *sortBy, *reverse)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		options.onlyRecent = *recent
+		if *expiring != "" {
+			options.onlyExpiring = true
+			options.expiryPeriod, err = parseExpiryPeriod(*expiring)
+			if err != nil {
+				fatalErr(err, "")
+			}
+		}
+		options.onlyTrashed = *onlyTrashed
+		options.excludeTrashed = *excludeTrashed && !*onlyTrashed
 		var pattern string
-		parser.ParseCmdArgs(mode, cmdArgs, &pattern)
-		listMatchingItems(vault, pattern)
+		parser.ParseCmdArgs(mode, args, &pattern)
+		listMatchingItems(vault, pattern, options)
 
 	case "list-folder":
 		var pattern string
 		parser.ParseCmdArgs(mode, cmdArgs, &pattern)
 		listFolder(vault, pattern)
 
+	case "list-folders":
+		err = parser.ParseCmdArgs(mode, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		listFolders(vault)
+
 	case "show-json":
 		fallthrough
 	case "show":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		fieldPattern := flags.String("field", "", "")
+		reveal := flags.Bool("reveal", false, "")
+		render := flags.Bool("render", readConfig().RenderNotes, "")
+		timeFormat := flags.String("time-format", readConfig().TimeFormat, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
 		var pattern string
-		err = parser.ParseCmdArgs(mode, cmdArgs, &pattern)
+		err = parser.ParseCmdArgs(mode, args, &pattern)
 		if err != nil {
 			fatalErr(err, "")
 		}
-		showItems(vault, pattern, mode == "show-json")
+		if *fieldPattern != "" {
+			showField(vault, pattern, *fieldPattern)
+		} else {
+			showItems(vault, pattern, mode == "show-json", showOptions{
+				reveal:     *reveal,
+				render:     *render,
+				timeFormat: *timeFormat,
+			})
+		}
 
 	case "add":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		securityLevel := flags.String("security-level", vaultConfig(vault.Path).securityLevel(), "")
+		var fieldValues stringList
+		for _, name := range []string{"username", "password", "url", "notes"} {
+			name := name
+			flags.Var(flagFunc(func(value string) error {
+				return fieldValues.Set(name + "=" + value)
+			}), name, "")
+		}
+		flags.Var(&fieldValues, "field", "")
+		jsonPath := flags.String("json", "", "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
 		var itemType string
 		var title string
-		err = parser.ParseCmdArgs(mode, cmdArgs, &itemType, &title)
+		var file string
+		err = parser.ParseCmdArgs(mode, args, &itemType, &title, &file)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		if typeFromAlias(itemType) == onepass.DocumentType {
+			if file == "" {
+				fatalErr(fmt.Errorf("Specify the file to store with 'add document <title> <file>'"), "")
+			}
+			addDocument(vault, title, file)
+			break
+		} else if file != "" {
+			fatalErr(fmt.Errorf("Only document items can store a file"), "")
+		}
+		if *jsonPath != "" && len(fieldValues) > 0 {
+			fatalErr(fmt.Errorf("-json cannot be combined with field values"), "")
+		}
+		addItem(vault, title, itemType, strings.ToUpper(*securityLevel), fieldValues, *jsonPath)
+
+	case "get-document":
+		var pattern string
+		var dest string
+		err = parser.ParseCmdArgs(mode, cmdArgs, &pattern, &dest)
 		if err != nil {
 			fatalErr(err, "")
 		}
-		addItem(vault, title, itemType)
+		getDocument(vault, pattern, dest)
 
 	case "edit":
 		var pattern string
@@ -1138,21 +3346,87 @@ func handleVaultCmd(vault *onepass.Vault, mode string, cmdArgs []string) {
 		}
 		editItem(vault, pattern)
 
+	case "set":
+		if len(cmdArgs) < 2 {
+			err = parser.ParseCmdArgs(mode, cmdArgs, new(string), new(string))
+			fatalErr(err, "")
+		}
+		setItemFields(vault, cmdArgs[0], cmdArgs[1:])
+
+	case "meta":
+		if len(cmdArgs) < 1 {
+			err = parser.ParseCmdArgs(mode, cmdArgs, new(string))
+			fatalErr(err, "")
+		}
+		if len(cmdArgs) == 1 {
+			showItemMeta(vault, cmdArgs[0])
+		} else {
+			setItemMeta(vault, cmdArgs[0], cmdArgs[1:])
+		}
+
+	case "remove-field":
+		var pattern string
+		var fieldPattern string
+		err = parser.ParseCmdArgs(mode, cmdArgs, &pattern, &fieldPattern)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		removeField(vault, pattern, fieldPattern)
+
+	case "rename-field":
+		var pattern string
+		var fieldPattern string
+		var newTitle string
+		err = parser.ParseCmdArgs(mode, cmdArgs, &pattern, &fieldPattern, &newTitle)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		renameField(vault, pattern, fieldPattern, newTitle)
+
 	case "remove":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		assumeYes := flags.Bool("yes", false, "")
+		flags.BoolVar(assumeYes, "force", false, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		var patterns []string
+		err = parser.ParseVariadicCmdArgs(mode, args, &patterns)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		removeItems(vault, patterns, *assumeYes)
+
+	case "purge":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		assumeYes := flags.Bool("yes", false, "")
+		flags.BoolVar(assumeYes, "force", false, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
 		var pattern string
-		err = parser.ParseCmdArgs(mode, cmdArgs, &pattern)
+		err = parser.ParseCmdArgs(mode, args, &pattern)
 		if err != nil {
 			fatalErr(err, "")
 		}
-		removeItems(vault, pattern)
+		purgeItems(vault, pattern, *assumeYes)
 
 	case "trash":
-		var pattern string
-		err = parser.ParseCmdArgs(mode, cmdArgs, &pattern)
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		assumeYes := flags.Bool("yes", false, "")
+		flags.BoolVar(assumeYes, "force", false, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
 		if err != nil {
 			fatalErr(err, "")
 		}
-		trashItems(vault, pattern)
+		var patterns []string
+		err = parser.ParseVariadicCmdArgs(mode, args, &patterns)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		trashItems(vault, patterns, *assumeYes)
 
 	case "restore":
 		var pattern string
@@ -1162,6 +3436,16 @@ func handleVaultCmd(vault *onepass.Vault, mode string, cmdArgs []string) {
 		}
 		restoreItems(vault, pattern)
 
+	case "alias":
+		var action string
+		var name string
+		var pattern string
+		err = parser.ParseCmdArgs(mode, cmdArgs, &action, &name, &pattern)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		runAliasCommand(vault, action, name, pattern)
+
 	case "rename":
 		var pattern string
 		var newTitle string
@@ -1171,31 +3455,183 @@ func handleVaultCmd(vault *onepass.Vault, mode string, cmdArgs []string) {
 		}
 		renameItem(vault, pattern, newTitle)
 
+	case "copy-to", "move-to":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		assumeYes := flags.Bool("yes", false, "")
+		flags.BoolVar(assumeYes, "force", false, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		if len(args) < 2 {
+			err = parser.ParseCmdArgs(mode, args, new(string), new(string))
+			fatalErr(err, "")
+		}
+		copyItemsToVault(vault, args[0], args[1:], mode == "move-to", *assumeYes)
+
+	case "duplicate":
+		var pattern string
+		var newTitle string
+		err = parser.ParseCmdArgs(mode, cmdArgs, &pattern, &newTitle)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		duplicateItem(vault, pattern, newTitle)
+
+	case "undo":
+		undoLastChange(vault)
+
 	case "copy":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		timeout := flags.Duration("timeout", vaultConfig(vault.Path).clipboardTimeout(), "")
+		login := flags.Bool("login", false, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
 		var pattern string
 		var field string
-		err = parser.ParseCmdArgs(mode, cmdArgs, &pattern, &field)
+		err = parser.ParseCmdArgs(mode, args, &pattern, &field)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		if *login {
+			if field != "" {
+				fatalErr(fmt.Errorf("[field] cannot be used with -login"), "")
+			}
+			copyLogin(vault, pattern, *timeout)
+		} else {
+			copyToClipboard(vault, pattern, field, *timeout)
+		}
+
+	case "otp":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		copyCode := flags.Bool("copy", false, "")
+		next := flags.Bool("next", false, "")
+		watch := flags.Bool("watch", false, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		var pattern string
+		err = parser.ParseCmdArgs(mode, args, &pattern)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		showOtp(vault, pattern, otpOptions{
+			copy:  *copyCode,
+			next:  *next,
+			watch: *watch,
+		})
+
+	case "open":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		copyPassword := flags.Bool("copy", false, "")
+		timeout := flags.Duration("timeout", vaultConfig(vault.Path).clipboardTimeout(), "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		var pattern string
+		err = parser.ParseCmdArgs(mode, args, &pattern)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		openItem(vault, pattern, *copyPassword, *timeout)
+
+	case "wifi-qr":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		payloadOnly := flags.Bool("payload", false, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		var pattern string
+		err = parser.ParseCmdArgs(mode, args, &pattern)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		showWifiQR(vault, pattern, *payloadOnly)
+
+	case "pick":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		autoType := flags.Bool("type", false, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		var pattern string
+		err = parser.ParseCmdArgs(mode, args, &pattern)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		pickItem(vault, pattern, *autoType)
+
+	case "type":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		delay := flags.Duration("delay", defaultAutoTypeDelay, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		var pattern string
+		err = parser.ParseCmdArgs(mode, args, &pattern)
 		if err != nil {
 			fatalErr(err, "")
 		}
-		copyToClipboard(vault, pattern, field)
+		autoTypeItem(vault, pattern, *delay)
 
 	case "import":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		format := flags.String("format", "", "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
 		var path string
-		err = parser.ParseCmdArgs(mode, cmdArgs, &path)
+		err = parser.ParseCmdArgs(mode, args, &path)
 		if err != nil {
 			fatalErr(err, "")
 		}
-		importItems(vault, path)
+		importItems(vault, path, *format)
 
 	case "export":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		encrypted := flags.Bool("encrypted", false, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		var patterns []string
+		var path string
+		err = parser.ParseVariadicCmdArgs(mode, args, &patterns, &path)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		exportItems(vault, patterns, path, *encrypted)
+
+	case "share":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		askPassphrase := flags.Bool("ask", false, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
 		var pattern string
 		var path string
-		err = parser.ParseCmdArgs(mode, cmdArgs, &pattern, &path)
+		err = parser.ParseCmdArgs(mode, args, &pattern, &path)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		shareItem(vault, pattern, path, *askPassphrase)
+
+	case "receive":
+		var sharedItem string
+		err = parser.ParseCmdArgs(mode, cmdArgs, &sharedItem)
 		if err != nil {
 			fatalErr(err, "")
 		}
-		exportItems(vault, pattern, path)
+		receiveItem(vault, sharedItem)
 
 	case "export-item-templates":
 		var pattern string
@@ -1206,13 +3642,19 @@ func handleVaultCmd(vault *onepass.Vault, mode string, cmdArgs []string) {
 		exportItemTemplates(vault, pattern)
 
 	case "move":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		create := flags.Bool("create", false, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
 		var folderPattern string
-		var itemPattern string
-		err = parser.ParseCmdArgs(mode, cmdArgs, &itemPattern, &folderPattern)
+		var itemPatterns []string
+		err = parser.ParseVariadicCmdArgs(mode, args, &itemPatterns, &folderPattern)
 		if err != nil {
 			fatalErr(err, "")
 		}
-		moveItemsToFolder(vault, itemPattern, folderPattern)
+		moveItemsToFolder(vault, itemPatterns, folderPattern, *create)
 
 	case "list-tag":
 		var tag string
@@ -1225,65 +3667,306 @@ func handleVaultCmd(vault *onepass.Vault, mode string, cmdArgs []string) {
 	case "list-tags":
 		listTags(vault)
 
-	case "add-tag":
+	case "audit":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		unused := flags.String("unused", defaultUnusedPeriod, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		err = parser.ParseCmdArgs(mode, args)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		period, err := parseExpiryPeriod(*unused)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		auditVault(vault, period)
+
+	case "conflicts":
+		var pattern string
+		err = parser.ParseCmdArgs(mode, cmdArgs, &pattern)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		listConflicts(vault, pattern)
+
+	case "resolve":
 		var pattern string
+		var revision string
+		err = parser.ParseCmdArgs(mode, cmdArgs, &pattern, &revision)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		resolveConflicts(vault, pattern, revision)
+
+	case "add-tag":
+		var patterns []string
 		var tag string
-		err = parser.ParseCmdArgs(mode, cmdArgs, &pattern, &tag)
+		err = parser.ParseVariadicCmdArgs(mode, cmdArgs, &patterns, &tag)
 		if err != nil {
 			fatalErr(err, "")
 		}
-		addTag(vault, pattern, tag)
+		addTag(vault, patterns, tag)
 
-	case "remove-tag":
+	case "set-expiry":
+		var patterns []string
+		var expiry string
+		err = parser.ParseVariadicCmdArgs(mode, cmdArgs, &patterns, &expiry)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		setExpiry(vault, patterns, expiry)
+
+	case "history":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		passwords := flags.Bool("passwords", false, "")
+		timeFormat := flags.String("time-format", readConfig().TimeFormat, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
 		var pattern string
+		err = parser.ParseCmdArgs(mode, args, &pattern)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		showPasswordHistory(vault, pattern, *passwords, *timeFormat)
+
+	case "set-url-match":
+		var patterns []string
+		var match string
+		err = parser.ParseVariadicCmdArgs(mode, cmdArgs, &patterns, &match)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		setUrlMatch(vault, patterns, match)
+
+	case "for-url":
+		var url string
+		err = parser.ParseCmdArgs(mode, cmdArgs, &url)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		listItemsForUrl(vault, url)
+
+	case "remove-tag":
+		var patterns []string
 		var tag string
-		err = parser.ParseCmdArgs(mode, cmdArgs, &pattern, &tag)
+		err = parser.ParseVariadicCmdArgs(mode, cmdArgs, &patterns, &tag)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		removeTag(vault, patterns, tag)
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", mode)
+		os.Exit(1)
+	}
+}
+
+func initVaultConfig(config *clientConfig) {
+	if _, err := os.Stat(configPath); os.IsNotExist(err) && terminal.IsTerminal(0) {
+		runSetupWizard(config)
+		return
+	}
+	keyChains := findKeyChainDirs()
+	if len(keyChains) == 0 {
+		fmt.Fprintf(os.Stderr,
+			`Unable to locate a 1Password vault automatically, use '%s set-vault <path>'
+to specify an existing vault or '%s new <path>' to create a new one.
+Run '%s discover' to list the vaults which were found.
+`, os.Args[0], os.Args[0], os.Args[0])
+		os.Exit(1)
+	}
+	if len(keyChains) > 1 {
+		if !terminal.IsTerminal(0) {
+			fmt.Fprintf(os.Stderr, "Found several vaults, use '%s set-vault <path>' to choose one:\n\n  %s\n",
+				os.Args[0], strings.Join(keyChains, "\n  "))
+			os.Exit(1)
+		}
+		err := newSetupWizard().selectVault(config, keyChains)
 		if err != nil {
 			fatalErr(err, "")
 		}
-		removeTag(vault, pattern, tag)
+	} else {
+		config.VaultDir = keyChains[0]
+	}
+	rememberVault(config, config.VaultDir)
+	fmt.Printf("Using the password vault in '%s'\n", config.VaultDir)
+	writeConfig(config)
+}
+
+// interruptContext returns a context which is cancelled when the user
+// presses Ctrl-C, so that a pending request to the agent fails instead
+// of blocking. If the command does not exit shortly afterwards, eg.
+// because it is not waiting for the agent, the process is terminated.
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		<-interrupts
+		signal.Stop(interrupts)
+		cancel()
+		time.Sleep(500 * time.Millisecond)
+		os.Exit(130)
+	}()
+	return ctx
+}
+
+// connectLocalAgent connects to the agent for the current user,
+// starting it if it is not running or restarting it if it does
+// not support a protocol version in common with the client or
+// has crashed, leaving its socket behind
+func connectLocalAgent(vaultDir string, policy agentDialPolicy) (OnePassAgentClient, error) {
+	agentClient, err := DialAgent(vaultDir)
+	if err != nil && removeStaleAgentSocket(agentConnAddr) {
+		debugf("Restarting agent after it exited unexpectedly")
+	}
+	if err == nil && agentClient.Protocol == 0 {
+		if agentClient.Info.Pid != 0 {
+			fmt.Fprintf(os.Stderr, "Agent/client protocol mismatch. Restarting agent.\n")
+			err = agentClient.Shutdown()
+			if err != nil {
+				// agents from older versions do not support
+				// Shutdown(), so stop the process instead
+				var agentProcess *os.Process
+				agentProcess, err = os.FindProcess(agentClient.Info.Pid)
+				if err == nil {
+					err = agentProcess.Kill()
+				}
+			}
+			if err != nil {
+				return OnePassAgentClient{}, fmt.Errorf("Failed to shut down existing agent: %v", err)
+			}
+			agentClient = OnePassAgentClient{}
+		}
+	}
+	if agentClient.Info.Pid == 0 {
+		agentClient, err = spawnAgent(vaultDir, policy)
+		if err != nil && removeStaleAgentSocket(agentConnAddr) {
+			// the new agent exited after creating its socket
+			debugf("Agent exited during startup: %v. Retrying", err)
+			agentClient, err = spawnAgent(vaultDir, policy)
+		}
+		if err != nil {
+			return OnePassAgentClient{}, err
+		}
+	}
+	return agentClient, nil
+}
 
-	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", mode)
-		os.Exit(1)
+// spawnAgent starts a new agent and waits for it to accept connections
+func spawnAgent(vaultDir string, policy agentDialPolicy) (OnePassAgentClient, error) {
+	err := startAgent()
+	if err != nil {
+		return OnePassAgentClient{}, fmt.Errorf("Unable to start agent: %v", err)
 	}
+	return waitForAgent(func() (OnePassAgentClient, error) {
+		return DialAgent(vaultDir)
+	}, policy)
 }
 
-func initVaultConfig(config *clientConfig) {
-	keyChains := findKeyChainDirs()
-	if len(keyChains) == 0 {
-		fmt.Fprintf(os.Stderr,
-			`Unable to locate a 1Password vault automatically, use '%s set-vault <path>'
-to specify an existing vault or '%s new <path>' to create a new one
-`, os.Args[0], os.Args[0])
+// unlockWithoutAgent prompts for the master password and
+// decrypts the vault's keys in-process, for use when the
+// agent cannot be reached
+func unlockWithoutAgent(vault *onepass.Vault, mode string) {
+	switch mode {
+	case "signin", "signout", "lock", "unlock", "reencrypt":
+		fatalErr(fmt.Errorf("'%s' requires the agent", mode), "")
+	}
+	fmt.Printf("Master password: ")
+	masterPwd, err := terminal.ReadPassword(0)
+	if err != nil {
 		os.Exit(1)
 	}
-	config.VaultDir = keyChains[0]
-	fmt.Printf("Using the password vault in '%s'\n", config.VaultDir)
-	writeConfig(config)
+	fmt.Println()
+	err = vault.Unlock(string(masterPwd))
+	onepass.ZeroBytes(masterPwd)
+	if _, ok := err.(onepass.DecryptError); ok {
+		hint, err := vault.PasswordHint()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read password hint: %v\n", err)
+		}
+		fmt.Fprintf(os.Stderr, "Incorrect password (hint: %s)\n", hint)
+		os.Exit(1)
+	} else if err != nil {
+		fatalErr(err, "Unable to unlock vault")
+	}
+	warnLockedKeys(vault)
 }
 
-func startAgent() error {
-	agentCmd := exec.Command(os.Args[0], "-agent")
-	err := agentCmd.Start()
-	return err
+// warnLockedKeys reports security levels whose keys could not be
+// decrypted with the master password used to unlock the vault, so that
+// a damaged key is noticed before items using it become unreadable
+func warnLockedKeys(vault *onepass.Vault) {
+	locked, err := vault.LockedKeys()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to check vault keys: %v\n", err)
+		return
+	}
+	for _, keyErr := range locked {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", keyErr)
+	}
+	if len(locked) > 0 {
+		fmt.Fprintf(os.Stderr, "Items using these keys cannot be read. Use 'check' to examine the key file or 'rollback-password' to restore it from a backup.\n")
+	}
 }
 
 func main() {
 	banner := fmt.Sprintf("%s is a tool for managing 1Password vaults.", os.Args[0])
 	parser := cmdmodes.NewParser(commandModes)
 	agentFlag := flag.Bool("agent", false, "Start 1pass in agent mode")
-	vaultPathFlag := flag.String("vault", "", "Custom vault path")
+	vaultPathFlag := flag.String("vault", "", "Custom vault path, or 'mem://[export file]' for a temporary in-memory vault")
 	lowSecFlag := flag.Bool("low-security", false, "Use lower security but faster encryption for the master password")
+	readOnlyFlag := flag.Bool("read-only", false, "Open the vault in read-only mode")
+	jobsFlag := flag.Int("jobs", onepass.DecryptParallelism, "Number of items to decrypt in parallel")
+	colorFlag := flag.String("color", "auto", "Color output: auto, always or never. NO_COLOR disables color in auto mode")
+	verboseUsage := "Log agent requests, vault file reads and timings to stderr, or to the file named by $ONEPASS_DEBUG. Secrets are redacted"
+	verboseFlag := flag.Bool("verbose", false, verboseUsage)
+	flag.BoolVar(verboseFlag, "v", false, verboseUsage)
+	agentListenFlag := flag.String("agent-listen", "", "In agent mode, also accept remote clients on a TCP address. See 'help agent-token'")
+	noRankFlag := flag.Bool("no-rank", false, "Do not rank items matching a pattern by match quality and usage. Commands acting on one item then fail if several items match")
+	agentTimeoutFlag := flag.Duration("agent-timeout", 0, "Maximum time to wait for a newly started agent. Overrides the agent.dial_timeout setting")
+	agentBackoffFlag := flag.Duration("agent-backoff", 0, "Initial interval between attempts to connect to a newly started agent. Overrides the agent.dial_backoff setting")
 
 	flag.Usage = func() {
 		parser.PrintHelp(banner, "")
 	}
 	flag.Parse()
+	onepass.DecryptParallelism = *jobsFlag
+	err := setColorMode(*colorFlag)
+	if err != nil {
+		fatalErr(err, "")
+	}
+	err = initDebugLog(*verboseFlag)
+	if err != nil {
+		fatalErr(err, "")
+	}
+	rankMatches = !*noRankFlag
 
 	if *agentFlag {
+		err := hardenAgentProcess()
+		if err != nil {
+			fatalErr(err, "Unable to secure agent process")
+		}
 		agent := NewAgent()
-		err := agent.Serve()
+		agent.authGate = readConfig().AuthGate
+		if *agentListenFlag != "" {
+			token, err := readAgentToken(agentTokenPath, true)
+			if err != nil {
+				fatalErr(err, "Unable to read agent token")
+			}
+			go func() {
+				err := agent.ServeTCP(*agentListenFlag, token)
+				if err != nil {
+					fatalErr(err, "Unable to accept remote clients")
+				}
+			}()
+		}
+		err = agent.Serve()
 		if err != nil {
 			fatalErr(err, "")
 		}
@@ -1293,6 +3976,8 @@ func main() {
 	config := readConfig()
 	if *vaultPathFlag != "" {
 		config.VaultDir = *vaultPathFlag
+	} else if envPath := os.Getenv(vaultEnvVar); envPath != "" {
+		config.VaultDir = envPath
 	}
 
 	if len(flag.Args()) < 1 || flag.Args()[0] == "help" {
@@ -1304,8 +3989,10 @@ func main() {
 		os.Exit(1)
 	}
 
-	mode := flag.Args()[0]
-	cmdArgs := flag.Args()[1:]
+	mode, cmdArgs, err := expandCommandAlias(config.CommandAliases, flag.Args()[0], flag.Args()[1:])
+	if err != nil {
+		fatalErr(err, "")
+	}
 
 	// handle commands which do not require
 	// an existing vault
@@ -1318,19 +4005,280 @@ func main() {
 		} else {
 			_ = parser.ParseCmdArgs(mode, cmdArgs, &path)
 			if len(path) == 0 {
-				path = os.Getenv("HOME") + "/Dropbox/1Password/1Password.agilekeychain"
+				path = homeDir() + "/Dropbox/1Password/1Password.agilekeychain"
 			}
 		}
 		createNewVault(path, *lowSecFlag)
+	case "setup":
+		err := parser.ParseCmdArgs(mode, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		setupConfig := readConfig()
+		runSetupWizard(&setupConfig)
 	case "gen-password":
-		fmt.Printf("%s\n", genDefaultPassword())
+		var pronounceable bool
+		var digits int
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		flags.BoolVar(&pronounceable, "pronounceable", false, "")
+		flags.IntVar(&digits, "digits", 0, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		_ = parser.ParseCmdArgs(mode, args)
+		if digits < 0 || (digits > 0 && pronounceable) {
+			fatalErr(fmt.Errorf("-digits must be a positive number and cannot be combined with -pronounceable"), "")
+		}
+		if digits > 0 {
+			fmt.Printf("%s\n", onepass.GenPIN(digits))
+		} else if pronounceable {
+			fmt.Printf("%s\n", genPronounceablePassword())
+		} else {
+			fmt.Printf("%s\n", genDefaultPassword())
+		}
+	case "gen-username":
+		var handle bool
+		var base string
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		flags.BoolVar(&handle, "handle", false, "")
+		flags.StringVar(&base, "base", "", "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		_ = parser.ParseCmdArgs(mode, args)
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name != "base" {
+				return
+			}
+			if base != "" {
+				if _, err := onepass.GenEmailAlias(base); err != nil {
+					fatalErr(err, "")
+				}
+			}
+			config.UsernameBase = base
+			writeConfig(&config)
+		})
+		if handle {
+			fmt.Printf("%s\n", onepass.GenUsername())
+		} else {
+			fmt.Printf("%s\n", genDefaultUsername())
+		}
+	case "discover":
+		err := parser.ParseCmdArgs(mode, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		listDiscoveredVaults(config.VaultDir)
+	case "config":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		profile := flags.String("profile", "", "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		var action string
+		var key string
+		var value string
+		err = parser.ParseCmdArgs(mode, args, &action, &key, &value)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		runConfigCommand(action, key, value, *profile)
+	case "doctor":
+		err := parser.ParseCmdArgs(mode, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		if !runDoctor() {
+			os.Exit(1)
+		}
+	case "plugins":
+		err := parser.ParseCmdArgs(mode, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		listPlugins()
+	case "hooks":
+		err := parser.ParseCmdArgs(mode, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		listHooks()
+	case "templates":
+		var action string
+		var alias string
+		err := parser.ParseCmdArgs(mode, cmdArgs, &action, &alias)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		if action != "" && action != "list" && alias == "" {
+			fatalErr(fmt.Errorf("'templates %s' requires an item type", action), "")
+		}
+		switch action {
+		case "", "list":
+			listItemTemplates()
+		case "show":
+			showItemTemplate(alias)
+		case "edit":
+			editItemTemplate(alias)
+		default:
+			fatalErr(fmt.Errorf("Unknown action '%s'. Use list, show or edit", action), "")
+		}
+	case "auth-gate":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		printPolicy := flags.Bool("polkit-policy", false, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		if *printPolicy {
+			fmt.Println(polkitPolicy())
+			return
+		}
+		var gateName string
+		err = parser.ParseCmdArgs(mode, args, &gateName)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		gate, err := parseAuthGate(gateName)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		setAuthGate(&config, gate)
+	case "biometric-unlock":
+		var period string
+		err := parser.ParseCmdArgs(mode, cmdArgs, &period)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		window, err := parseBiometricWindow(period)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		if window > 0 && !biometricAvailable() {
+			fatalErr(errBiometricUnavailable, "")
+		}
+		if window == 0 {
+			period = ""
+		}
+		config.BiometricWindow = period
+		writeConfig(&config)
+	case "save-search":
+		var search savedSearch
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		flags.Var((*stringList)(&search.Tags), "tag", "")
+		flags.Var((*stringList)(&search.Types), "type", "")
+		remove := flags.Bool("remove", false, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		var name string
+		err = parser.ParseCmdArgs(mode, args, &name, &search.Pattern)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		name = strings.TrimPrefix(name, "@")
+		if name == "" {
+			listSavedSearches(config)
+			return
+		}
+		if *remove {
+			if _, ok := config.Searches[name]; !ok {
+				fatalErr(fmt.Errorf("No saved search named '%s'", name), "")
+			}
+			delete(config.Searches, name)
+		} else {
+			err = saveSearch(&config, name, search)
+			if err != nil {
+				fatalErr(err, "")
+			}
+		}
+		writeConfig(&config)
+	case "agent":
+		var action string
+		err := parser.ParseCmdArgs(mode, cmdArgs, &action)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		switch action {
+		case "install-service":
+			err = installAgentService()
+		case "uninstall-service":
+			err = uninstallAgentService()
+		default:
+			err = fmt.Errorf("Unknown action '%s'. Use install-service or uninstall-service", action)
+		}
+		if err != nil {
+			fatalErr(err, "")
+		}
+	case "agent-token":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		replace := flags.Bool("new", false, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		_ = parser.ParseCmdArgs(mode, args)
+		showAgentToken(*replace)
 	case "set-vault":
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		readOnly := flags.Bool("read-only", false, "")
+		profile := flags.String("profile", "", "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
 		var newPath string
-		_ = parser.ParseCmdArgs(mode, cmdArgs, &newPath)
+		_ = parser.ParseCmdArgs(mode, args, &newPath)
+		if newPath != "" {
+			newPath, err = resolveVaultPath(newPath)
+			if err != nil {
+				fatalErr(err, "")
+			}
+			rememberVault(&config, newPath)
+		}
+		if *profile != "" {
+			if config.Profiles == nil {
+				config.Profiles = map[string]string{}
+			}
+			if newPath == "" {
+				delete(config.Profiles, *profile)
+			} else {
+				config.Profiles[*profile] = newPath
+			}
+			writeConfig(&config)
+			return
+		}
 		config.VaultDir = newPath
+		config.ReadOnly = *readOnly
 		writeConfig(&config)
+	case "vaults":
+		var choice string
+		err := parser.ParseCmdArgs(mode, cmdArgs, &choice)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		vaultsConfig := readConfig()
+		if choice == "" {
+			listKnownVaults(vaultsConfig)
+			return
+		}
+		err = switchKnownVault(&vaultsConfig, choice)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		writeConfig(&vaultsConfig)
+		fmt.Printf("Using the password vault in '%s'\n", vaultsConfig.VaultDir)
 	default:
 		handled = false
+		if !isBuiltinCommand(commandModes, mode) {
+			if pluginPath, ok := findPlugins(os.Getenv("PATH"))[mode]; ok {
+				runPlugin(pluginPath, cmdArgs, config.VaultDir)
+			}
+		}
 	}
 	if handled {
 		return
@@ -1341,55 +4289,197 @@ func main() {
 	if config.VaultDir == "" {
 		initVaultConfig(&config)
 	}
+	config = config.forVault(config.VaultDir)
+
+	readOnly := *readOnlyFlag || config.ReadOnly
+
+	if onepass.IsMemoryVaultPath(config.VaultDir) {
+		vault := openMemoryVault(config.VaultDir)
+		vault.ReadOnly = readOnly
+		handleVaultCmd(&vault, mode, cmdArgs)
+		return
+	}
+
+	if mode == "restore-backup" {
+		if readOnly {
+			fatalErr(onepass.ErrReadOnly, "Unable to restore backup")
+		}
+		var archivePath string
+		err := parser.ParseCmdArgs(mode, cmdArgs, &archivePath)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		restoreVaultBackup(config.VaultDir, archivePath)
+		return
+	}
+
 	vault, err := onepass.OpenVault(config.VaultDir)
 	if err != nil {
 		fatalErr(err, "Unable to setup vault")
 	}
+	vault.ReadOnly = readOnly
+	hooks := hookRunner{dir: userHooksDir(), command: mode, vaultPath: config.VaultDir}
+	hooks.install(&vault)
+
+	if mode == "reindex" {
+		err = parser.ParseCmdArgs(mode, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		reindexVault(&vault)
+		return
+	}
+	if mode != "check" {
+		rebuildStaleIndex(&vault)
+	}
 
 	if mode == "info" {
-		fmt.Printf("Vault path: %s\n", config.VaultDir)
+		err = parser.ParseCmdArgs(mode, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		showVaultInfo(&vault)
 		return
 	}
 
-	// remaining commands require an unlocked vault
+	if mode == "sync" {
+		var options syncOptions
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		flags.StringVar(&options.dropboxToken, "token", "", "")
+		flags.StringVar(&options.dropboxPath, "path", "", "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		var remote string
+		var direction string
+		err = parser.ParseCmdArgs(mode, args, &remote, &direction)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		if remote == "" {
+			remote = config.SyncRemote
+		}
+		if remote == "" {
+			fatalErr(fmt.Errorf("No remote given. Use 'config set sync.remote <remote>' to set a default"), "")
+		}
+		syncVault(&vault, remote, direction, options)
+		return
+	}
 
-	// connect to the 1pass agent daemon. Start it automatically
-	// if not already running or the agent/client version do not
-	// match
+	if mode == "watch" {
+		watchVault(&vault)
+		return
+	}
 
-	agentClient, err := DialAgent(config.VaultDir)
-	if err == nil && agentClient.Info.BinaryVersion != appBinaryVersion() {
-		if agentClient.Info.Pid != 0 {
-			fmt.Fprintf(os.Stderr, "Agent/client version mismatch. Restarting agent.\n")
-			// kill the existing agent
-			err = syscall.Kill(agentClient.Info.Pid, syscall.SIGINT)
-			if err != nil {
-				fatalErr(err, "Failed to shut down existing agent")
-			}
-			agentClient = OnePassAgentClient{}
+	if mode == "backup" {
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		keep := flags.Int("keep", 0, "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		var destDir string
+		err = parser.ParseCmdArgs(mode, args, &destDir)
+		if err != nil {
+			fatalErr(err, "")
 		}
+		createBackup(&vault, destDir, *keep)
+		return
 	}
-	if agentClient.Info.Pid == 0 {
-		err = startAgent()
+
+	if mode == "rollback-password" {
+		var backup string
+		err = parser.ParseCmdArgs(mode, cmdArgs, &backup)
 		if err != nil {
-			fatalErr(err, "Unable to start 1pass keychain agent")
+			fatalErr(err, "")
 		}
-		maxWait := time.Now().Add(1 * time.Second)
-		for time.Now().Before(maxWait) {
-			agentClient, err = DialAgent(config.VaultDir)
-			if err == nil {
-				break
-			} else {
-				fmt.Errorf("Error starting agent: %v\n", err)
+		rollbackPassword(&vault, backup)
+		return
+	}
+
+	// set-password and check decrypt the keys in-process
+	if mode == "set-password" {
+		fmt.Printf("Current master password: ")
+		masterPwd, err := terminal.ReadPassword(0)
+		if err != nil {
+			os.Exit(1)
+		}
+		fmt.Println()
+		setPassword(&vault, string(masterPwd))
+		onepass.ZeroBytes(masterPwd)
+		return
+	}
+
+	if mode == "check" {
+		fmt.Printf("Master password: ")
+		masterPwd, err := terminal.ReadPassword(0)
+		if err != nil {
+			os.Exit(1)
+		}
+		fmt.Println()
+		checkVault(&vault, string(masterPwd))
+		onepass.ZeroBytes(masterPwd)
+		return
+	}
+
+	// remaining commands require an unlocked vault
+
+	// connect to the 1pass agent daemon. Start it automatically
+	// if not already running or if the agent and client do not
+	// support a common protocol version. An agent from a different
+	// build which speaks a compatible protocol is kept running so
+	// that unlocked vaults stay unlocked.
+
+	var agentClient OnePassAgentClient
+	if remoteAddr := os.Getenv(remoteAgentEnvVar); remoteAddr != "" {
+		agentClient = connectRemoteAgent(config.VaultDir, remoteAddr)
+	} else {
+		policy := config.agentDialPolicy()
+		if *agentTimeoutFlag > 0 {
+			policy.timeout = *agentTimeoutFlag
+		}
+		if *agentBackoffFlag > 0 {
+			policy.backoff = *agentBackoffFlag
+		}
+		agentClient, err = connectLocalAgent(config.VaultDir, policy)
+		if err != nil {
+			if !config.AgentFallback {
+				fatalErr(err, "Unable to connect to 1pass keychain agent")
 			}
-			time.Sleep(10 * time.Millisecond)
+			fmt.Fprintf(os.Stderr, "Unable to connect to agent: %v. Decrypting without the agent.\n", err)
+			unlockWithoutAgent(&vault, mode)
+			hooks.unlocked()
+			handleVaultCmd(&vault, mode, cmdArgs)
+			return
 		}
+	}
+
+	agentClient.Session = os.Getenv(sessionEnvVar)
+	agentClient.Context = interruptContext()
+	agentClient.BiometricWindow, _ = parseBiometricWindow(config.BiometricWindow)
+	agentClient.UnlockDelay = config.autoLockDelay()
+
+	if mode == "signin" {
+		signIn(&agentClient)
+		hooks.unlocked()
+		return
+	}
+
+	if mode == "signout" {
+		err = agentClient.SignOut()
 		if err != nil {
-			fatalErr(err, "Unable to connect to 1pass keychain agent")
+			fatalErr(err, "Failed to end session")
 		}
+		fmt.Printf("unset %s\n", sessionEnvVar)
+		return
 	}
 
 	if mode == "lock" {
+		err = parser.ParseCmdArgs(mode, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
 		err = agentClient.Lock()
 		if err != nil {
 			fatalErr(err, "Failed to lock keychain")
@@ -1397,23 +4487,45 @@ func main() {
 		return
 	}
 
-	if mode == "set-password" {
-		fmt.Printf("Current master password: ")
+	if mode == "reencrypt" {
+		flags := flag.NewFlagSet(mode, flag.ContinueOnError)
+		securityLevel := flags.String("security-level", "", "")
+		args, err := cmdmodes.ParseFlags(flags, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		err = parser.ParseCmdArgs(mode, args)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		fmt.Printf("Master password: ")
 		masterPwd, err := terminal.ReadPassword(0)
 		if err != nil {
 			os.Exit(1)
 		}
 		fmt.Println()
-		setPassword(&vault, string(masterPwd))
+		reEncryptVault(&vault, &agentClient, string(masterPwd), *securityLevel)
+		onepass.ZeroBytes(masterPwd)
 		return
 	}
 
+	if mode == "unlock" {
+		err = parser.ParseCmdArgs(mode, cmdArgs)
+		if err != nil {
+			fatalErr(err, "")
+		}
+	}
+
 	var masterPwd []byte
 	locked, err := agentClient.IsLocked()
 	if err != nil {
 		fatalErr(err, "Failed to check lock status")
 	}
 
+	if locked && agentClient.BiometricWindow > 0 && agentClient.BiometricUnlock() == nil {
+		locked = false
+		hooks.unlocked()
+	}
 	if locked {
 		fmt.Printf("Master password: ")
 		masterPwd, err = terminal.ReadPassword(0)
@@ -1423,23 +4535,37 @@ func main() {
 		fmt.Println()
 
 		err = agentClient.Unlock(string(masterPwd))
+		onepass.ZeroBytes(masterPwd)
 		if err != nil {
-			if _, ok := err.(onepass.DecryptError); ok {
+			if err == errSessionRequired {
+				fmt.Fprintf(os.Stderr, "%v. Use 'eval $(%s signin)' to start a session.\n", err, os.Args[0])
+				os.Exit(1)
+			} else if _, ok := err.(onepass.DecryptError); ok {
 				hint, err := vault.PasswordHint()
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "Unable to read password hint: %v\n", err)
 				}
 				fmt.Fprintf(os.Stderr, "Incorrect password (hint: %s)\n", hint)
 				os.Exit(1)
+			} else if onepass.IsKeyFileError(err) {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				fmt.Fprintf(os.Stderr, "The vault's key file is damaged. Use 'rollback-password' to restore the keys from a backup.\n")
+				os.Exit(1)
 			} else {
 				fatalErr(err, "Unable to unlock vault")
 			}
 		}
+		vault.CryptoAgent = &agentClient
+		warnLockedKeys(&vault)
+		hooks.unlocked()
 	}
 	err = agentClient.RefreshAccess()
 	if err != nil {
 		fatalErr(err, "Unable to refresh vault access")
 	}
+	if mode == "unlock" {
+		return
+	}
 	vault.CryptoAgent = &agentClient
 	handleVaultCmd(&vault, mode, cmdArgs)
 }
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/robertknight/1pass/onepass"
 )
@@ -25,3 +28,214 @@ func newTestVault(t *testing.T) *onepass.Vault {
 	}
 	return &vault
 }
+
+func TestParseListOptions(t *testing.T) {
+	options, err := parseListOptions("folder,username", "modified", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options.columns) != 2 || options.sortBy != "modified" || !options.reverse {
+		t.Errorf("Unexpected list options: %v", options)
+	}
+	options, err = parseListOptions("", "", false)
+	if err != nil || options.sortBy != "title" {
+		t.Errorf("Expected items to be sorted by title by default")
+	}
+	_, err = parseListOptions("password", "", false)
+	if err == nil {
+		t.Errorf("Expected unknown column to be rejected")
+	}
+	_, err = parseListOptions("", "size", false)
+	if err == nil {
+		t.Errorf("Expected unknown sort key to be rejected")
+	}
+}
+
+func TestItemLess(t *testing.T) {
+	older := onepass.Item{Title: "b", UpdatedAt: 100, CreatedAt: 50}
+	newer := onepass.Item{Title: "A", UpdatedAt: 200, CreatedAt: 10}
+	if !itemLess(newer, older, "title") {
+		t.Errorf("Expected titles to be compared case-insensitively")
+	}
+	if !itemLess(older, newer, "modified") {
+		t.Errorf("Expected older item to sort first by modified time")
+	}
+	if !itemLess(newer, older, "created") {
+		t.Errorf("Expected earlier created item to sort first")
+	}
+}
+
+func TestFilterTrashed(t *testing.T) {
+	items := []onepass.Item{{Title: "a"}, {Title: "b", Trashed: true}}
+	filtered := filterTrashed(items, listOptions{excludeTrashed: true})
+	if len(filtered) != 1 || filtered[0].Title != "a" {
+		t.Errorf("Expected trashed items to be excluded: %v", filtered)
+	}
+	filtered = filterTrashed(items, listOptions{onlyTrashed: true})
+	if len(filtered) != 1 || filtered[0].Title != "b" {
+		t.Errorf("Expected only trashed items: %v", filtered)
+	}
+	filtered = filterTrashed(items, listOptions{})
+	if len(filtered) != 2 {
+		t.Errorf("Expected all items: %v", filtered)
+	}
+}
+
+func TestFindFieldValue(t *testing.T) {
+	content := onepass.ItemContent{
+		FormFields: []onepass.WebFormField{
+			{Name: "username", Designation: "username", Value: "jim"},
+		},
+		Urls: []onepass.ItemUrl{
+			{Label: "website", Url: "https://example.com"},
+		},
+	}
+	title, value := findFieldValue(content, "user")
+	if title != "username" || value != "jim" {
+		t.Errorf("Unexpected username field: %s = %s", title, value)
+	}
+	_, value = findFieldValue(content, "website")
+	if value != "https://example.com" {
+		t.Errorf("Unexpected URL: %s", value)
+	}
+	_, value = findFieldValue(content, "password")
+	if value != "" {
+		t.Errorf("Expected no match for missing field, got %s", value)
+	}
+}
+
+func TestIsPINField(t *testing.T) {
+	pinFields := []onepass.ItemField{
+		{Kind: "concealed", Name: "telephonePin", Title: "PIN"},
+		{Kind: "concealed", Name: "pin", Title: "password"},
+		{Kind: "concealed", Name: "lock", Title: "Door passcode"},
+	}
+	for _, field := range pinFields {
+		if !isPINField(field) {
+			t.Errorf("Expected %s to be a PIN field", field.Title)
+		}
+	}
+	if isPINField(onepass.ItemField{Kind: "concealed", Name: "password", Title: "password"}) {
+		t.Errorf("Expected password not to be a PIN field")
+	}
+}
+
+func TestDuplicateItem(t *testing.T) {
+	vault := newTestVault(t)
+	err := vault.Unlock(ClientTestPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := onepass.ItemContent{
+		FormFields: []onepass.WebFormField{
+			{Name: "username", Designation: "username", Value: "deploy-staging"},
+		},
+	}
+	item, err := vault.AddItem("Deploy Staging", "webforms.WebForm", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item.OpenContents.Tags = []string{"deploy"}
+	err = item.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duplicateItem(vault, "Deploy Staging", "Deploy Production")
+
+	copies, err := lookupItems(vault, "Deploy Production")
+	if err != nil || len(copies) != 1 {
+		t.Fatalf("Expected one copy, found %d: %v", len(copies), err)
+	}
+	dup := copies[0]
+	if dup.Uuid == item.Uuid || dup.TypeName != item.TypeName {
+		t.Errorf("Unexpected copy %v", dup)
+	}
+	if len(dup.OpenContents.Tags) != 1 || dup.OpenContents.Tags[0] != "deploy" {
+		t.Errorf("Expected tags to be copied: %v", dup.OpenContents.Tags)
+	}
+	dupContent, err := dup.Content()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if itemUsername(dupContent) != "deploy-staging" {
+		t.Errorf("Expected content to be copied: %v", dupContent)
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	timestamp := uint64(1420113600)
+	if formatTime(timestamp, "unix") != "1420113600" {
+		t.Errorf("Unexpected unix time '%s'", formatTime(timestamp, "unix"))
+	}
+	expected := time.Unix(1420113600, 0).Format(time.RFC3339)
+	if formatTime(timestamp, "") != expected || formatTime(timestamp, "RFC3339") != expected {
+		t.Errorf("Expected RFC3339 time by default, got '%s'", formatTime(timestamp, ""))
+	}
+	if formatTime(timestamp, "2006") != "2015" {
+		t.Errorf("Unexpected time for custom layout '%s'", formatTime(timestamp, "2006"))
+	}
+}
+
+func TestAddTimestampsJson(t *testing.T) {
+	item := onepass.Item{CreatedAt: 100, UpdatedAt: 200}
+	actual := addTimestampsJson(`{"notesPlain":"x"}`, item)
+	if actual != `{"createdAt":100,"updatedAt":200,"notesPlain":"x"}` {
+		t.Errorf("Unexpected JSON %s", actual)
+	}
+	actual = addTimestampsJson(`{}`, item)
+	if actual != `{"createdAt":100,"updatedAt":200}` {
+		t.Errorf("Unexpected JSON %s", actual)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	cases := map[int64]string{
+		10:                     "10 bytes",
+		1536:                   "1.5 KB",
+		3 * 1024 * 1024:        "3.0 MB",
+		5 * 1024 * 1024 * 1024: "5.0 GB",
+	}
+	for size, expected := range cases {
+		if actual := formatSize(size); actual != expected {
+			t.Errorf("Size %d formatted as '%s', expected '%s'", size, actual, expected)
+		}
+	}
+}
+
+func TestImportPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "1pass-import-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.json", "b.json", "c.csv", ".hidden"} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte("{}"), 0600)
+	}
+
+	paths, err := importPaths(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 3 || filepath.Base(paths[0]) != "a.json" || filepath.Base(paths[2]) != "c.csv" {
+		t.Errorf("Unexpected paths for directory: %v", paths)
+	}
+
+	paths, err = importPaths(filepath.Join(dir, "*.json"))
+	if err != nil || len(paths) != 2 {
+		t.Errorf("Unexpected paths for glob: %v %v", paths, err)
+	}
+	_, err = importPaths(filepath.Join(dir, "*.1pif"))
+	if err == nil {
+		t.Errorf("Glob without matches should fail")
+	}
+
+	// a .1pif directory is imported as a single export
+	pifDir := filepath.Join(dir, "export.1pif")
+	os.Mkdir(pifDir, 0700)
+	ioutil.WriteFile(pifDir+"/data.1pif", []byte{}, 0600)
+	paths, err = importPaths(pifDir)
+	if err != nil || len(paths) != 1 || paths[0] != pifDir {
+		t.Errorf("Unexpected paths for .1pif directory: %v %v", paths, err)
+	}
+}
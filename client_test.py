@@ -223,6 +223,32 @@ class OnePassTests(unittest.TestCase):
          .expect('mysite')
          .wait())
 
+    def testInfo(self):
+        self._createVault()
+        self._addLoginItem('mysite', 'myuser', 'mypass', 'mysite.com')
+        (self.exec_1pass('info')
+         .expect('Format: agilekeychain')
+         .expect('Items: 1')
+         .wait())
+
+    def testPurgeItem(self):
+        self._createVault()
+        self._addLoginItem('mysite', 'myuser', 'mypass', 'mysite.com')
+
+        # items which are not in the trash cannot be purged
+        (self.exec_1pass('purge -yes mysite')
+         .expect('not in the trash')
+         .wait(expect_status=1))
+
+        (self.exec_1pass('trash -yes mysite')
+         .wait())
+        (self.exec_1pass('purge -yes mysite')
+         .expect('Purging item')
+         .wait())
+        (self.exec_1pass('show mysite')
+         .expect('No matching items')
+         .wait())
+
     def testFolder(self):
         self._createVault()
         self._addLoginItem('mysite', 'myuser', 'mypass', 'mysite.com')
@@ -240,6 +266,9 @@ class OnePassTests(unittest.TestCase):
         (self.exec_1pass('list-folder newfolder')
           .expect('mysite')
           .wait())
+        (self.exec_1pass('list-folders')
+          .expect('NewFolder')
+          .wait())
 
         # Remove the item from the folder
         (self.exec_1pass('move mysite')
@@ -302,6 +331,20 @@ class OnePassTests(unittest.TestCase):
          .wait())
         self.assertEqual(clipboard.paste(), 'myuser')
 
+    def testPasswordHistory(self):
+        self._createVault()
+        self._addLoginItem('mysite', 'myuser', 'mypass', 'mysite.com')
+
+        (self.exec_1pass('set mysite password=newpass')
+         .expect("Updated item 'mysite'")
+         .wait())
+        (self.exec_1pass('history -passwords mysite')
+         .expect('mypass')
+         .wait())
+        (self.exec_1pass('show -field old-password mysite')
+         .expect('mypass')
+         .wait())
+
     def testExport(self):
         self._createVault()
         self._addLoginItem('mysite', 'myuser', 'mypass', 'mysite.com')
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const defaultClipboardTimeout = 30 * time.Second
+
+// returns true if running in a Wayland desktop session
+func isWaylandSession() bool {
+	return os.Getenv("WAYLAND_DISPLAY") != "" || os.Getenv("XDG_SESSION_TYPE") == "wayland"
+}
+
+// returns true if the wl-clipboard tools should be used
+// instead of the X11 clipboard
+func useWaylandClipboard() bool {
+	if !isWaylandSession() {
+		return false
+	}
+	_, err := exec.LookPath("wl-copy")
+	return err == nil
+}
+
+// readClipboard returns the current contents of the clipboard
+func readClipboard() (string, error) {
+	if useWaylandClipboard() {
+		output, err := exec.Command("wl-paste", "--no-newline").Output()
+		return string(output), err
+	}
+	return readSystemClipboard()
+}
+
+// writeClipboard replaces the contents of the clipboard with text
+func writeClipboard(text string) error {
+	if useWaylandClipboard() {
+		cmd := exec.Command("wl-copy")
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	return writeSystemClipboard(text)
+}
+
+// holdClipboard waits until timeout expires or the user presses
+// Enter, showing a countdown in the meantime, and then restores
+// the previous clipboard contents. The clipboard is left alone if
+// it no longer contains value, eg. because the user has since
+// copied something else.
+func holdClipboard(fieldTitle string, value string, previous string, timeout time.Duration) {
+	enterPressed := make(chan bool, 1)
+	go func() {
+		bufio.NewReader(os.Stdin).ReadString('\n')
+		enterPressed <- true
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	deadline := time.Now().Add(timeout)
+
+	for remaining := timeout; remaining > 0; remaining = deadline.Sub(time.Now()) {
+		fmt.Printf("\r'%s' on clipboard for %ds, press Enter to clear ", fieldTitle, int(remaining.Seconds()+0.5))
+		select {
+		case <-ticker.C:
+		case <-enterPressed:
+			deadline = time.Now()
+		}
+	}
+	fmt.Printf("\n")
+
+	current, err := readClipboard()
+	if err == nil && current != value {
+		fmt.Printf("Clipboard has changed, leaving it as it is\n")
+		return
+	}
+	err = writeClipboard(previous)
+	if err != nil {
+		fatalErr(err, "Failed to restore clipboard")
+	}
+	fmt.Printf("Restored previous clipboard contents\n")
+}
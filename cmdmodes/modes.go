@@ -12,7 +12,9 @@ The generic syntax is:
 package cmdmodes
 
 import (
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"strings"
 
@@ -154,3 +156,48 @@ func (p *Parser) ParseCmdArgs(cmdName string, cmdArgs []string, out ...*string)
 	}
 	return nil
 }
+
+// ParseVariadicCmdArgs is like ParseCmdArgs for commands whose
+// first positional argument may be repeated, as indicated by an
+// argument name ending in '...'.
+//
+// The leading arguments are saved into list and the final arguments
+// are saved into the variables supplied via out. At least one
+// argument is always saved into list.
+//
+func (p *Parser) ParseVariadicCmdArgs(cmdName string, cmdArgs []string, list *[]string, out ...*string) error {
+	if len(cmdArgs) == 0 {
+		return p.ParseCmdArgs(cmdName, cmdArgs, append([]*string{new(string)}, out...)...)
+	}
+	listLen := len(cmdArgs) - len(out)
+	if listLen < 1 {
+		listLen = 1
+	}
+	*list = cmdArgs[:listLen]
+	return p.ParseCmdArgs(cmdName, append([]string{cmdArgs[0]}, cmdArgs[listLen:]...), append([]*string{new(string)}, out...)...)
+}
+
+// ParseFlags parses the flags defined in flags from cmdArgs and returns
+// the remaining positional arguments, which can then be passed
+// to ParseCmdArgs.
+//
+// Unlike flag.FlagSet.Parse(), flags may appear before, after or between
+// positional arguments.
+//
+func ParseFlags(flags *flag.FlagSet, cmdArgs []string) ([]string, error) {
+	flags.SetOutput(ioutil.Discard)
+	args := []string{}
+	for {
+		err := flags.Parse(cmdArgs)
+		if err != nil {
+			return nil, err
+		}
+		cmdArgs = flags.Args()
+		if len(cmdArgs) == 0 {
+			break
+		}
+		args = append(args, cmdArgs[0])
+		cmdArgs = cmdArgs[1:]
+	}
+	return args, nil
+}
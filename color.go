@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"code.google.com/p/go.crypto/ssh/terminal"
+)
+
+// ANSI escape sequences used to color terminal output
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorDim   = "\x1b[2m"
+	colorRed   = "\x1b[31m"
+	colorCyan  = "\x1b[36m"
+)
+
+// true if output should include ANSI colors
+var colorEnabled = false
+
+// setColorMode enables or disables colored output. mode is
+// 'always', 'never' or 'auto', which uses color if stdout is
+// a terminal and the NO_COLOR environment variable is not set.
+func setColorMode(mode string) error {
+	switch mode {
+	case "always":
+		colorEnabled = true
+	case "never":
+		colorEnabled = false
+	case "auto", "":
+		colorEnabled = os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" &&
+			terminal.IsTerminal(1)
+	default:
+		return fmt.Errorf("Unknown color mode '%s'. Use auto, always or never", mode)
+	}
+	return nil
+}
+
+// colorize wraps text in the ANSI escape sequence code
+// if colored output is enabled
+func colorize(code string, text string) string {
+	if !colorEnabled || text == "" {
+		return text
+	}
+	return code + text + colorReset
+}
+
+// colorizeContent adds color to the output of
+// onepass.ItemContent.String(), highlighting headings
+// and field names
+func colorizeContent(text string) string {
+	if !colorEnabled {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasSuffix(trimmed, ":") {
+			lines[i] = colorize(colorBold, line)
+		} else if sep := strings.Index(line, ": "); sep != -1 {
+			indent := len(line) - len(strings.TrimLeft(line, " "))
+			lines[i] = line[0:indent] + colorize(colorCyan, line[indent:sep+1]) + line[sep+1:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestColorizeContent(t *testing.T) {
+	defer setColorMode("never")
+	text := "Sections:\n  Login:\n    username: jim: smith\n"
+
+	setColorMode("never")
+	if colorizeContent(text) != text {
+		t.Errorf("Expected output to be unchanged when color is disabled")
+	}
+
+	setColorMode("always")
+	expected := colorBold + "Sections:" + colorReset + "\n" +
+		colorBold + "  Login:" + colorReset + "\n" +
+		"    " + colorCyan + "username:" + colorReset + " jim: smith\n"
+	if actual := colorizeContent(text); actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+
+	os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+	setColorMode("auto")
+	if colorEnabled {
+		t.Errorf("Expected NO_COLOR to disable color")
+	}
+	if setColorMode("sometimes") == nil {
+		t.Errorf("Expected error for unknown color mode")
+	}
+}
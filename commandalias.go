@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// prefix of the 'config' keys used to define command aliases
+const commandAliasPrefix = "alias."
+
+// commands which cannot be replaced by an alias, so that an alias
+// which breaks a command can always be inspected and removed
+var unaliasableCommands = map[string]bool{
+	"config": true,
+	"help":   true,
+}
+
+func commandAliasHelp() string {
+	return `Command aliases are shorthands for commands with flags, defined with
+'config set alias.<name> <command>', eg.
+
+  config set alias.ls "list -no-trash -sort modified"
+  config set alias.cpl "copy -login"
+
+'1pass ls' then runs 'list -no-trash -sort modified' and '1pass cpl gh'
+runs 'copy -login gh'. Arguments given after the alias are appended
+to the command. Quote parts of the command which contain spaces.
+
+An alias with the same name as a command replaces it, so that default
+flags can be given for the command, eg. 'alias.list = list -sort modified'.
+The 'config' and 'help' commands cannot be replaced.
+Aliases are expanded once, so an alias cannot refer to another alias.
+Use 'config unset alias.<name>' to remove an alias.`
+}
+
+// splitCommandLine splits a command into words separated by spaces.
+// Words may be quoted with single or double quotes to include spaces.
+func splitCommandLine(command string) ([]string, error) {
+	words := []string{}
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, ch := range command {
+		switch {
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(ch)
+		case ch == '"' || ch == '\'':
+			quote = ch
+			inWord = true
+		case ch == ' ' || ch == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(ch)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("Unterminated quote in '%s'", command)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// expandCommandAlias returns the command and arguments to run for
+// 'mode args...', replacing mode with the command it is an alias
+// for, if any
+func expandCommandAlias(aliases map[string]string, mode string, args []string) (string, []string, error) {
+	command, ok := aliases[mode]
+	if !ok || unaliasableCommands[mode] {
+		return mode, args, nil
+	}
+	words, err := splitCommandLine(command)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(words) == 0 {
+		return "", nil, fmt.Errorf("The alias '%s' is empty", mode)
+	}
+	debugf("Expanded alias '%s' to '%s'", mode, command)
+	return words[0], append(words[1:], args...), nil
+}
+
+// commandAliasSetting returns the 'config' setting
+// which defines the command alias name
+func commandAliasSetting(name string) configSetting {
+	return configSetting{
+		key:         commandAliasPrefix + name,
+		description: "Command alias",
+		get:         func(config clientConfig) string { return config.CommandAliases[name] },
+		set: func(config *clientConfig, command string) error {
+			if command == "" {
+				delete(config.CommandAliases, name)
+				return nil
+			}
+			if name == "" || strings.ContainsAny(name, " :@") || strings.HasPrefix(name, "-") {
+				return fmt.Errorf("'%s' is not a valid alias name", name)
+			}
+			if unaliasableCommands[name] {
+				return fmt.Errorf("The '%s' command cannot be replaced by an alias", name)
+			}
+			words, err := splitCommandLine(command)
+			if err != nil {
+				return err
+			}
+			if len(words) == 0 {
+				return fmt.Errorf("No command given for alias '%s'", name)
+			}
+			_, isPlugin := findPlugins(os.Getenv("PATH"))[words[0]]
+			if !isBuiltinCommand(commandModes, words[0]) && !isPlugin {
+				return fmt.Errorf("Unknown command '%s'", words[0])
+			}
+			if config.CommandAliases == nil {
+				config.CommandAliases = map[string]string{}
+			}
+			config.CommandAliases[name] = command
+			return nil
+		},
+	}
+}
+
+// listCommandAliases prints the command aliases in config
+// in the same format as other settings
+func listCommandAliases(config clientConfig) {
+	names := []string{}
+	for name := range config.CommandAliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s%s = %s\n", commandAliasPrefix, name, config.CommandAliases[name])
+	}
+}
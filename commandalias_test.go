@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	commands := map[string][]string{
+		"list -sort modified":              {"list", "-sort", "modified"},
+		`  list   -columns "type,tags" `:   {"list", "-columns", "type,tags"},
+		`add login 'My Bank' -username ""`: {"add", "login", "My Bank", "-username", ""},
+		"":                                 {},
+	}
+	for command, expected := range commands {
+		words, err := splitCommandLine(command)
+		if err != nil || !reflect.DeepEqual(words, expected) {
+			t.Errorf("Expected '%s' to split into %q, got %q (%v)", command, expected, words, err)
+		}
+	}
+	if _, err := splitCommandLine(`copy "bank`); err == nil {
+		t.Errorf("Expected unterminated quote to be rejected")
+	}
+}
+
+func TestCommandAliases(t *testing.T) {
+	var config clientConfig
+	for name, command := range map[string]string{
+		"ls":   "list -no-trash -sort modified",
+		"list": "list -reverse",
+	} {
+		setting, _ := lookupConfigSetting(commandAliasPrefix + name)
+		err := setting.set(&config, command)
+		if err != nil {
+			t.Errorf("Unable to set alias '%s': %v", name, err)
+		}
+	}
+	for _, command := range []string{"frobnicate", "", `list "`} {
+		setting, _ := lookupConfigSetting(commandAliasPrefix + "bad")
+		err := setting.set(&config, command)
+		if err == nil && command != "" {
+			t.Errorf("Expected alias for '%s' to be rejected", command)
+		}
+	}
+	if _, ok := config.CommandAliases["bad"]; ok {
+		t.Errorf("Expected invalid alias not to be saved")
+	}
+	for _, name := range []string{"config", "help"} {
+		setting, _ := lookupConfigSetting(commandAliasPrefix + name)
+		err := setting.set(&config, "list")
+		if err == nil {
+			t.Errorf("Expected alias replacing '%s' to be rejected", name)
+		}
+	}
+
+	// aliases for 'config' added by editing the config file are ignored
+	mode, args, err := expandCommandAlias(map[string]string{"config": "list"}, "config", []string{"list"})
+	if err != nil || mode != "config" || !reflect.DeepEqual(args, []string{"list"}) {
+		t.Errorf("Expected 'config' alias to be ignored, got: %s %q (%v)", mode, args, err)
+	}
+
+	mode, args, err = expandCommandAlias(config.CommandAliases, "ls", []string{"bank"})
+	if err != nil || mode != "list" || !reflect.DeepEqual(args, []string{"-no-trash", "-sort", "modified", "bank"}) {
+		t.Errorf("Unexpected expansion of 'ls': %s %q (%v)", mode, args, err)
+	}
+
+	// aliases for commands are only expanded once
+	mode, args, err = expandCommandAlias(config.CommandAliases, "list", nil)
+	if err != nil || mode != "list" || !reflect.DeepEqual(args, []string{"-reverse"}) {
+		t.Errorf("Unexpected expansion of 'list': %s %q (%v)", mode, args, err)
+	}
+	mode, args, err = expandCommandAlias(config.CommandAliases, "show", []string{"bank"})
+	if err != nil || mode != "show" || !reflect.DeepEqual(args, []string{"bank"}) {
+		t.Errorf("Expected commands without aliases to be unchanged")
+	}
+}
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+	"github.com/robertknight/1pass/vaultsync"
+)
+
+// configSetting describes a setting in ~/.1pass which
+// can be read and changed with the 'config' command
+type configSetting struct {
+	key         string
+	description string
+
+	// value used when the setting is not set
+	defaultValue string
+
+	get func(config clientConfig) string
+
+	// set validates and stores a new value for the setting.
+	// An empty value restores the default.
+	set func(config *clientConfig, value string) error
+
+	// true if the agent must be restarted for
+	// a change to take effect
+	restartAgent bool
+
+	// true if the setting can be overridden for a single
+	// vault with 'config -profile <name|path> set'
+	perVault bool
+}
+
+// security level used by 'add' unless configured otherwise
+const defaultSecurityLevel = "SL5"
+
+// securityLevel returns the security level used
+// by 'add' unless -security-level is given
+func (config clientConfig) securityLevel() string {
+	if config.SecurityLevel == "" {
+		return defaultSecurityLevel
+	}
+	return config.SecurityLevel
+}
+
+// agentDialPolicy returns how long the client waits for
+// a newly started agent, as set in the configuration
+func (config clientConfig) agentDialPolicy() agentDialPolicy {
+	policy := agentDialPolicy{timeout: defaultAgentDialTimeout, backoff: defaultAgentDialBackoff}
+	if timeout, err := time.ParseDuration(config.AgentDialTimeout); err == nil && timeout > 0 {
+		policy.timeout = timeout
+	}
+	if backoff, err := time.ParseDuration(config.AgentDialBackoff); err == nil && backoff > 0 {
+		policy.backoff = backoff
+	}
+	return policy
+}
+
+// parseConfigDuration parses a period such as '30s' or '10m'
+// for a setting. If allowZero is false, the period must be
+// positive.
+func parseConfigDuration(value string, allowZero bool) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	period, err := time.ParseDuration(value)
+	if err != nil || period < 0 || (period == 0 && !allowZero) {
+		return "", fmt.Errorf("Invalid period '%s'. Use a period such as '30s' or '10m'", value)
+	}
+	return period.String(), nil
+}
+
+// parseConfigBool parses a true/false setting
+func parseConfigBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("Invalid value '%s'. Use true or false", value)
+	}
+	return enabled, nil
+}
+
+var configSettings = []configSetting{
+	{
+		key:         "vault.path",
+		description: "Path of the current vault",
+		get:         func(config clientConfig) string { return config.VaultDir },
+		set: func(config *clientConfig, value string) error {
+			if value != "" {
+				path, err := resolveVaultPath(value)
+				if err != nil {
+					return err
+				}
+				rememberVault(config, path)
+				value = path
+			}
+			config.VaultDir = value
+			return nil
+		},
+	},
+	{
+		key:          "vault.read_only",
+		description:  "Always open the vault in read-only mode",
+		defaultValue: "false",
+		get:          func(config clientConfig) string { return strconv.FormatBool(config.ReadOnly) },
+		set: func(config *clientConfig, value string) error {
+			enabled, err := parseConfigBool(value)
+			if err != nil {
+				return err
+			}
+			config.ReadOnly = enabled
+			return nil
+		},
+		perVault: true,
+	},
+	{
+		key:          "clipboard.timeout",
+		description:  "How long 'copy' keeps values on the clipboard",
+		defaultValue: defaultClipboardTimeout.String(),
+		get:          func(config clientConfig) string { return config.ClipboardTimeout },
+		set: func(config *clientConfig, value string) error {
+			period, err := parseConfigDuration(value, true)
+			if err != nil {
+				return err
+			}
+			config.ClipboardTimeout = period
+			return nil
+		},
+		perVault: true,
+	},
+	{
+		key:          "agent.lock_after",
+		description:  "Period of inactivity after which the vault is locked",
+		defaultValue: defaultUnlockDelay.String(),
+		get:          func(config clientConfig) string { return config.AutoLock },
+		set: func(config *clientConfig, value string) error {
+			period, err := parseConfigDuration(value, false)
+			if err != nil {
+				return err
+			}
+			config.AutoLock = period
+			return nil
+		},
+		perVault: true,
+	},
+	{
+		key:          "agent.biometric_window",
+		description:  "Period during which Touch ID can unlock the vault",
+		defaultValue: "off",
+		get:          func(config clientConfig) string { return config.BiometricWindow },
+		set: func(config *clientConfig, value string) error {
+			window, err := parseBiometricWindow(value)
+			if err != nil {
+				return err
+			}
+			if window > 0 && !biometricAvailable() {
+				return errBiometricUnavailable
+			}
+			if window == 0 {
+				value = ""
+			}
+			config.BiometricWindow = value
+			return nil
+		},
+	},
+	{
+		key:          "agent.auth_gate",
+		description:  "OS authentication required to decrypt items",
+		defaultValue: "off",
+		get:          func(config clientConfig) string { return config.AuthGate },
+		set: func(config *clientConfig, value string) error {
+			gate, err := parseAuthGate(value)
+			if err != nil {
+				return err
+			}
+			if gate == "pam" && !pamAvailable() {
+				return errors.New("This build of 1pass does not support PAM. Rebuild it with 'go build -tags pam'")
+			}
+			config.AuthGate = gate
+			return nil
+		},
+		restartAgent: true,
+	},
+	{
+		key:          "agent.dial_timeout",
+		description:  "How long to wait for a newly started agent",
+		defaultValue: defaultAgentDialTimeout.String(),
+		get:          func(config clientConfig) string { return config.AgentDialTimeout },
+		set: func(config *clientConfig, value string) error {
+			period, err := parseConfigDuration(value, false)
+			if err != nil {
+				return err
+			}
+			config.AgentDialTimeout = period
+			return nil
+		},
+	},
+	{
+		key:          "agent.dial_backoff",
+		description:  "Initial interval between attempts to connect to the agent",
+		defaultValue: defaultAgentDialBackoff.String(),
+		get:          func(config clientConfig) string { return config.AgentDialBackoff },
+		set: func(config *clientConfig, value string) error {
+			period, err := parseConfigDuration(value, false)
+			if err != nil {
+				return err
+			}
+			config.AgentDialBackoff = period
+			return nil
+		},
+	},
+	{
+		key:          "agent.fallback",
+		description:  "Decrypt items without the agent if it cannot be reached",
+		defaultValue: "false",
+		get:          func(config clientConfig) string { return strconv.FormatBool(config.AgentFallback) },
+		set: func(config *clientConfig, value string) error {
+			enabled, err := parseConfigBool(value)
+			if err != nil {
+				return err
+			}
+			config.AgentFallback = enabled
+			return nil
+		},
+	},
+	{
+		key:         "username.base",
+		description: "Email address used to generate username aliases",
+		get:         func(config clientConfig) string { return config.UsernameBase },
+		set: func(config *clientConfig, value string) error {
+			if value != "" {
+				if _, err := onepass.GenEmailAlias(value); err != nil {
+					return err
+				}
+			}
+			config.UsernameBase = value
+			return nil
+		},
+	},
+	{
+		key:          "add.security_level",
+		description:  "Security level of the key used to encrypt new items",
+		defaultValue: defaultSecurityLevel,
+		get:          func(config clientConfig) string { return config.SecurityLevel },
+		set: func(config *clientConfig, value string) error {
+			level := strings.ToUpper(value)
+			if level != "" && (len(level) != 3 || !strings.HasPrefix(level, "SL") || level[2] < '0' || level[2] > '9') {
+				return fmt.Errorf("Invalid security level '%s'. Use a level such as SL3 or SL5", value)
+			}
+			config.SecurityLevel = level
+			return nil
+		},
+		perVault: true,
+	},
+	{
+		key:         "sync.remote",
+		description: "Remote used by 'sync' if none is given",
+		get:         func(config clientConfig) string { return config.SyncRemote },
+		set: func(config *clientConfig, value string) error {
+			if value != "" && value != "dropbox" {
+				if _, err := vaultsync.NewWebDAV(value); err != nil {
+					return err
+				}
+			}
+			config.SyncRemote = value
+			return nil
+		},
+		perVault: true,
+	},
+	{
+		key:          "show.time_format",
+		description:  "Format for times shown by 'show'",
+		defaultValue: "rfc3339",
+		get:          func(config clientConfig) string { return config.TimeFormat },
+		set: func(config *clientConfig, value string) error {
+			config.TimeFormat = value
+			return nil
+		},
+	},
+	{
+		key:          "show.render_notes",
+		description:  "Render notes as Markdown in 'show'",
+		defaultValue: "false",
+		get:          func(config clientConfig) string { return strconv.FormatBool(config.RenderNotes) },
+		set: func(config *clientConfig, value string) error {
+			enabled, err := parseConfigBool(value)
+			if err != nil {
+				return err
+			}
+			config.RenderNotes = enabled
+			return nil
+		},
+	},
+	{
+		key:          "usage.sync",
+		description:  "Store the item usage log in the vault so that it is synced",
+		defaultValue: "false",
+		get:          func(config clientConfig) string { return strconv.FormatBool(config.SyncUsage) },
+		set: func(config *clientConfig, value string) error {
+			enabled, err := parseConfigBool(value)
+			if err != nil {
+				return err
+			}
+			config.SyncUsage = enabled
+			return nil
+		},
+	},
+}
+
+func configHelp() string {
+	keys := []string{}
+	for _, setting := range configSettings {
+		description := setting.description
+		if setting.perVault {
+			description += " *"
+		}
+		keys = append(keys, fmt.Sprintf("  %-24s %s", setting.key, description))
+	}
+	return fmt.Sprintf(`Reads and changes the settings saved in ~/.1pass.
+
+  config list               Show all settings
+  config get <key>          Show the value of a setting
+  config set <key> <value>  Change a setting
+  config unset <key>        Restore the default value of a setting
+
+Settings:
+
+%s
+
+Settings marked with '*' can be changed for a single vault with
+'config -profile <name|path> set <key> <value>', overriding the
+setting for all other vaults. <name> is a profile saved with
+'set-vault -profile'. 'list' and 'get' with -profile show the
+settings which apply to that vault.
+
+Values are checked before they are saved. Profiles, saved searches
+and the list of known vaults are managed with 'set-vault -profile',
+'save-search' and 'vaults'.
+
+%s`, strings.Join(keys, "\n"), commandAliasHelp())
+}
+
+// lookupConfigSetting returns the setting with the given key
+func lookupConfigSetting(key string) (configSetting, error) {
+	if strings.HasPrefix(key, commandAliasPrefix) {
+		return commandAliasSetting(key[len(commandAliasPrefix):]), nil
+	}
+	for _, setting := range configSettings {
+		if setting.key == key {
+			return setting, nil
+		}
+	}
+	keys := []string{}
+	for _, setting := range configSettings {
+		keys = append(keys, setting.key)
+	}
+	sort.Strings(keys)
+	return configSetting{}, fmt.Errorf("Unknown setting '%s'. Settings are: %s and %s<name>", key,
+		strings.Join(keys, ", "), commandAliasPrefix)
+}
+
+// configValue returns the value of a setting in config,
+// or its default if it is not set
+func configValue(config clientConfig, setting configSetting) string {
+	value := setting.get(config)
+	if value == "" {
+		return setting.defaultValue
+	}
+	return value
+}
+
+// forVault returns the settings which apply to the vault at
+// vaultPath: the global settings with the overrides for the
+// vault's profile, if it has one, and then for its path applied
+func (config clientConfig) forVault(vaultPath string) clientConfig {
+	merged := config
+	for _, scope := range []string{profileName(config, vaultPath), vaultPath} {
+		if scope == "" {
+			continue
+		}
+		for key, value := range config.VaultSettings[scope] {
+			setting, err := lookupConfigSetting(key)
+			if err == nil && setting.perVault {
+				_ = setting.set(&merged, value)
+			}
+		}
+	}
+	return merged
+}
+
+// vaultConfig returns the settings which
+// apply to the vault at vaultPath
+func vaultConfig(vaultPath string) clientConfig {
+	return readConfig().forVault(vaultPath)
+}
+
+// configScope returns the key under which overrides for the vault
+// identified by profile, a profile name or path, are saved and the
+// path of the vault
+func configScope(config clientConfig, profile string) (string, string, error) {
+	if path, ok := config.Profiles[profile]; ok {
+		return profile, path, nil
+	}
+	path, err := resolveVaultPath(profile)
+	if err != nil {
+		return "", "", err
+	}
+	return path, path, nil
+}
+
+// runConfigCommand runs 'config <action> [key] [value]'. If profile
+// is not empty, the settings for that vault are shown or changed.
+func runConfigCommand(action string, key string, value string, profile string) {
+	config := readConfig()
+	scope, vaultPath := "", ""
+	effective := config
+	if profile != "" {
+		var err error
+		scope, vaultPath, err = configScope(config, profile)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		effective = config.forVault(vaultPath)
+	}
+
+	switch action {
+	case "list", "":
+		for _, setting := range configSettings {
+			note := ""
+			if _, ok := config.VaultSettings[scope][setting.key]; ok && scope != "" {
+				note = " (set for this vault)"
+			}
+			fmt.Printf("%s = %s%s\n", setting.key, configValue(effective, setting), note)
+		}
+		listCommandAliases(config)
+		return
+	case "get", "set", "unset":
+	default:
+		fatalErr(fmt.Errorf("Unknown action '%s'. Use list, get, set or unset", action), "")
+	}
+
+	setting, err := lookupConfigSetting(key)
+	if err != nil {
+		fatalErr(err, "")
+	}
+	switch action {
+	case "get":
+		fmt.Printf("%s\n", configValue(effective, setting))
+		return
+	case "set":
+		if value == "" {
+			fatalErr(fmt.Errorf("No value given. Use 'config unset %s' to restore the default", key), "")
+		}
+	case "unset":
+		value = ""
+	}
+
+	if scope != "" {
+		err = setVaultSetting(&config, scope, setting, value)
+	} else {
+		err = setting.set(&config, value)
+	}
+	if err != nil {
+		fatalErr(err, "")
+	}
+	writeConfig(&config)
+
+	if setting.restartAgent {
+		agentClient, err := DialAgent(config.VaultDir)
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "Restarting agent to apply the new setting.\n")
+			agentClient.Shutdown()
+		}
+	}
+}
+
+// setVaultSetting overrides setting for the vaults identified by
+// scope, a profile name or vault path. An empty value removes the
+// override.
+func setVaultSetting(config *clientConfig, scope string, setting configSetting, value string) error {
+	if !setting.perVault {
+		return fmt.Errorf("'%s' cannot be set for a single vault", setting.key)
+	}
+	if value == "" {
+		delete(config.VaultSettings[scope], setting.key)
+		if len(config.VaultSettings[scope]) == 0 {
+			delete(config.VaultSettings, scope)
+		}
+		return nil
+	}
+
+	// check and normalize the value
+	var parsed clientConfig
+	err := setting.set(&parsed, value)
+	if err != nil {
+		return err
+	}
+	if config.VaultSettings == nil {
+		config.VaultSettings = map[string]map[string]string{}
+	}
+	if config.VaultSettings[scope] == nil {
+		config.VaultSettings[scope] = map[string]string{}
+	}
+	config.VaultSettings[scope][setting.key] = setting.get(parsed)
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestConfigSettings(t *testing.T) {
+	var config clientConfig
+	values := map[string]string{
+		"clipboard.timeout": "90s",
+		"agent.lock_after":  "10m",
+		"show.render_notes": "true",
+		"username.base":     "jim@example.com",
+	}
+	for key, value := range values {
+		setting, err := lookupConfigSetting(key)
+		if err != nil {
+			fatalTestErr(t, "Unknown setting", err)
+		}
+		err = setting.set(&config, value)
+		if err != nil {
+			t.Errorf("Unable to set '%s' to '%s': %v", key, value, err)
+		}
+	}
+	if config.clipboardTimeout().String() != "1m30s" || config.autoLockDelay().String() != "10m0s" ||
+		!config.RenderNotes || config.UsernameBase != "jim@example.com" {
+		t.Errorf("Unexpected config %+v", config)
+	}
+
+	invalid := map[string]string{
+		"clipboard.timeout": "soon",
+		"agent.lock_after":  "0s",
+		"agent.auth_gate":   "fingerprint",
+		"show.render_notes": "maybe",
+		"username.base":     "not-an-address",
+		"vault.path":        "/missing.agilekeychain",
+	}
+	for key, value := range invalid {
+		setting, _ := lookupConfigSetting(key)
+		before := configValue(config, setting)
+		err := setting.set(&config, value)
+		if err == nil {
+			t.Errorf("Expected '%s' to be rejected for '%s'", value, key)
+		}
+		if configValue(config, setting) != before {
+			t.Errorf("Expected '%s' to be unchanged after invalid value", key)
+		}
+	}
+
+	// an empty value restores the default
+	setting, _ := lookupConfigSetting("clipboard.timeout")
+	err := setting.set(&config, "")
+	if err != nil || configValue(config, setting) != defaultClipboardTimeout.String() {
+		t.Errorf("Expected default clipboard timeout, got '%s' (%v)", configValue(config, setting), err)
+	}
+
+	_, err = lookupConfigSetting("clipboard")
+	if err == nil {
+		t.Errorf("Expected unknown setting to be rejected")
+	}
+}
+
+func TestVaultSettings(t *testing.T) {
+	config := clientConfig{
+		ClipboardTimeout: "20s",
+		Profiles:         map[string]string{"team": "/team.agilekeychain"},
+	}
+	for key, value := range map[string]string{
+		"vault.read_only":    "true",
+		"clipboard.timeout":  "5s",
+		"add.security_level": "sl3",
+	} {
+		setting, _ := lookupConfigSetting(key)
+		err := setVaultSetting(&config, "team", setting, value)
+		if err != nil {
+			t.Errorf("Unable to set '%s' for vault: %v", key, err)
+		}
+	}
+	setting, _ := lookupConfigSetting("clipboard.timeout")
+	err := setVaultSetting(&config, "/team.agilekeychain", setting, "8s")
+	if err != nil {
+		t.Errorf("Unable to set clipboard timeout for vault path: %v", err)
+	}
+
+	// settings for the vault's path take precedence
+	// over those for its profile
+	team := config.forVault("/team.agilekeychain")
+	if !team.ReadOnly || team.clipboardTimeout().String() != "8s" || team.securityLevel() != "SL3" {
+		t.Errorf("Unexpected settings for team vault %+v", team)
+	}
+	personal := config.forVault("/personal.agilekeychain")
+	if personal.ReadOnly || personal.clipboardTimeout().String() != "20s" || personal.securityLevel() != defaultSecurityLevel {
+		t.Errorf("Unexpected settings for personal vault %+v", personal)
+	}
+
+	setting, _ = lookupConfigSetting("username.base")
+	err = setVaultSetting(&config, "team", setting, "jim@example.com")
+	if err == nil {
+		t.Errorf("Expected global-only setting to be rejected")
+	}
+	setting, _ = lookupConfigSetting("vault.read_only")
+	err = setVaultSetting(&config, "team", setting, "perhaps")
+	if err == nil {
+		t.Errorf("Expected invalid value to be rejected")
+	}
+	err = setVaultSetting(&config, "team", setting, "")
+	if err != nil || config.forVault("/team.agilekeychain").ReadOnly {
+		t.Errorf("Expected read-only override to be removed: %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"code.google.com/p/go.crypto/ssh/terminal"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func copyToHelp() string {
+	return `<profile> is the name of a vault saved with 'set-vault -profile <name>'
+or the path to another vault. The matching items are decrypted and
+re-encrypted with the keys of the other vault, keeping their tags.
+You will be asked for the other vault's master password.
+
+` + multiPatternHelp()
+}
+
+func moveToHelp() string {
+	return copyToHelp() + `
+
+The items are removed from the current vault once they have been
+copied.
+
+` + confirmHelp()
+}
+
+// resolveProfile returns the vault path for a profile name
+// saved in the config or, if there is no such profile,
+// treats name as the path to a vault
+func resolveProfile(config clientConfig, name string) (string, error) {
+	if path, ok := config.Profiles[name]; ok {
+		return path, nil
+	}
+	if _, err := os.Stat(name); err == nil {
+		return name, nil
+	}
+	profiles := []string{}
+	for profile := range config.Profiles {
+		profiles = append(profiles, profile)
+	}
+	sort.Strings(profiles)
+	if len(profiles) == 0 {
+		return "", fmt.Errorf("Unknown vault profile '%s'. Use 'set-vault -profile <name> <path>' to add one", name)
+	}
+	return "", fmt.Errorf("Unknown vault profile '%s'. Saved profiles are: %s", name, strings.Join(profiles, ", "))
+}
+
+// profileName returns the name of the profile saved
+// for the vault at path or an empty string if none is
+func profileName(config clientConfig, path string) string {
+	for name, profilePath := range config.Profiles {
+		if profilePath == path {
+			return name
+		}
+	}
+	return ""
+}
+
+// openTargetVault opens and unlocks the vault identified by profile,
+// prompting for its master password. Hooks are run for changes
+// made to the vault by command.
+func openTargetVault(source *onepass.Vault, profile string, command string) *onepass.Vault {
+	path, err := resolveProfile(readConfig(), profile)
+	if err != nil {
+		fatalErr(err, "")
+	}
+	sourcePath, _ := filepath.Abs(source.Path)
+	targetPath, _ := filepath.Abs(path)
+	if sourcePath == targetPath {
+		fatalErr(fmt.Errorf("'%s' is the current vault", profile), "")
+	}
+	target, err := onepass.OpenVault(path)
+	if err != nil {
+		fatalErr(err, fmt.Sprintf("Unable to open vault '%s'", path))
+	}
+
+	fmt.Printf("Master password for '%s': ", path)
+	masterPwd, err := terminal.ReadPassword(0)
+	fmt.Println()
+	if err != nil {
+		os.Exit(1)
+	}
+	err = target.Unlock(string(masterPwd))
+	onepass.ZeroBytes(masterPwd)
+	if err != nil {
+		if _, ok := err.(onepass.DecryptError); ok {
+			fatalErr(fmt.Errorf("Incorrect password for '%s'", path), "")
+		}
+		fatalErr(err, fmt.Sprintf("Unable to unlock vault '%s'", path))
+	}
+	hooks := hookRunner{dir: userHooksDir(), command: command, vaultPath: path}
+	hooks.install(&target)
+	hooks.unlocked()
+	return &target
+}
+
+// copyItemsToVault copies the items matching patterns into the vault
+// identified by profile. If move is true, the original items are
+// removed afterwards.
+func copyItemsToVault(vault *onepass.Vault, profile string, patterns []string, move bool, assumeYes bool) {
+	items, err := lookupItemList(vault, patterns)
+	if err != nil {
+		fatalErr(err, "Unable to lookup items")
+	}
+	if move && !confirmItems("Move", items, assumeYes) {
+		return
+	} else if !move && len(items) == 0 {
+		fmt.Printf("No matching items\n")
+		return
+	}
+
+	command := "copy-to"
+	if move {
+		command = "move-to"
+	}
+	target := openTargetVault(vault, profile, command)
+	var undo *undoRecorder
+	if move {
+		undo = newUndoRecorder(vault, "move")
+		defer undo.commit()
+	}
+	err = transferItems(items, target, profile, move, undo)
+	if err != nil {
+		fatalErr(err, "")
+	}
+}
+
+// transferItems copies items into target, where undoing the import
+// removes the copies. If move is true, the original items are removed
+// once all of them have been copied and are recorded by undo.
+func transferItems(items []onepass.Item, target *onepass.Vault, targetName string, move bool, undo *undoRecorder) error {
+	logAction := "Copied"
+	if move {
+		logAction = "Moved"
+	}
+	batch := target.NewBatch()
+	for _, item := range items {
+		content, err := item.Content()
+		if err != nil {
+			return fmt.Errorf("Unable to decrypt item '%s': %v", item.Title, err)
+		}
+		exported := onepass.ExportedItem{Item: item, SecureContents: content}
+		exported.Conflicts = nil
+		if item.TypeName == onepass.DocumentType {
+			exported.Document, err = item.DocumentData()
+			if err != nil {
+				return fmt.Errorf("Unable to read document '%s': %v", item.Title, err)
+			}
+		}
+		if _, err := target.LoadItem(item.FolderUuid); err != nil {
+			// the item's folder does not exist in the other vault
+			exported.FolderUuid = ""
+		}
+		_, err = batch.ImportItem(exported)
+		if err != nil {
+			return fmt.Errorf("Unable to copy item '%s': %v", item.Title, err)
+		}
+	}
+	copied, err := batch.Commit()
+	if err != nil {
+		return fmt.Errorf("Unable to copy items to %s: %v", targetName, err)
+	}
+	targetUndo := newUndoRecorder(target, "import")
+	for _, item := range copied {
+		targetUndo.added(item)
+	}
+	targetUndo.commit()
+
+	for i, item := range items {
+		logItemAction(fmt.Sprintf("%s '%s' to %s as", logAction, item.Title, targetName), copied[i])
+		if move {
+			undo.snapshot(item)
+			err = item.Remove()
+			if err != nil {
+				return fmt.Errorf("Unable to remove item '%s': %v", item.Title, err)
+			}
+		}
+	}
+	return nil
+}
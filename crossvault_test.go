@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func TestTransferItems(t *testing.T) {
+	source := newTestVault(t)
+	targetPath := os.TempDir() + "/target-vault.agilekeychain"
+	os.RemoveAll(targetPath)
+	defer os.RemoveAll(targetPath)
+	defer func(dir string) { undoJournalDir = dir }(undoJournalDir)
+	undoJournalDir = os.TempDir() + "/1pass-test-undo"
+	os.RemoveAll(undoJournalDir)
+	defer os.RemoveAll(undoJournalDir)
+	target, err := onepass.NewVault(targetPath, onepass.VaultSecurity{MasterPwd: "other-pwd", Iterations: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = source.Unlock(ClientTestPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = target.Unlock("other-pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := onepass.ItemContent{Notes: "work notes"}
+	work, err := source.AddItem("Work Note", "securenotes.SecureNote", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	personal, err := source.AddItem("Personal Note", "securenotes.SecureNote", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = transferItems([]onepass.Item{work}, &target, "work", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	undo := newUndoRecorder(source, "move")
+	err = transferItems([]onepass.Item{personal}, &target, "work", true, undo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copied, err := lookupItems(&target, "Note")
+	if err != nil || len(copied) != 2 {
+		t.Fatalf("Expected two items in target vault, found %d: %v", len(copied), err)
+	}
+	copiedContent, err := copied[0].Content()
+	if err != nil || copiedContent.Notes != "work notes" {
+		t.Errorf("Unexpected copied content %v: %v", copiedContent, err)
+	}
+
+	remaining, err := lookupItems(source, "Note")
+	if err != nil || len(remaining) != 1 || remaining[0].Title != "Work Note" {
+		t.Errorf("Expected only the copied item to remain in the source vault: %v", remaining)
+	}
+	if len(undo.snapshots) != 1 {
+		t.Errorf("Expected moved item to be recorded for undo")
+	}
+
+	// undoing the last transfer removes the copy from the target vault
+	journal, err := onepass.OpenJournal(&target, undoJournalPath(target.Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = journal.Undo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied, err = lookupItems(&target, "Note")
+	if err != nil || len(copied) != 1 || copied[0].Title != "Work Note" {
+		t.Errorf("Expected moved item to be removed from the target vault: %v", copied)
+	}
+}
+
+func TestResolveProfile(t *testing.T) {
+	config := clientConfig{Profiles: map[string]string{"work": "/vaults/work.agilekeychain"}}
+	path, err := resolveProfile(config, "work")
+	if err != nil || path != "/vaults/work.agilekeychain" {
+		t.Errorf("Unexpected profile path '%s': %v", path, err)
+	}
+	path, err = resolveProfile(config, os.TempDir())
+	if err != nil || path != os.TempDir() {
+		t.Errorf("Expected existing path to be used as a vault path: %v", err)
+	}
+	if _, err = resolveProfile(config, "personal"); err == nil {
+		t.Errorf("Expected error for unknown profile")
+	}
+}
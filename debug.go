@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+// logger for debug output, nil unless debug logging
+// has been enabled with -verbose or $ONEPASS_DEBUG
+var debugLog *log.Logger
+
+// secret wraps a value which must never appear in debug
+// output, such as a password or decrypted field value
+type secret string
+
+func (s secret) String() string {
+	return fmt.Sprintf("[%d chars redacted]", len(s))
+}
+
+// redactArg replaces key material and other sensitive values
+// in an argument to debugf() with a description of their size
+func redactArg(arg interface{}) interface{} {
+	switch value := arg.(type) {
+	case []byte:
+		return fmt.Sprintf("[%d bytes redacted]", len(value))
+	case secret:
+		return value.String()
+	case CryptArgs:
+		return fmt.Sprintf("{vault: %s, key: %s, data: [%d bytes redacted]}",
+			value.VaultPath, value.KeyName, len(value.Data))
+	case UnlockArgs:
+		return fmt.Sprintf("{vault: %s, password: [redacted], expire: %v}",
+			value.VaultPath, value.ExpireAfter)
+	case UserAuthArgs:
+		return fmt.Sprintf("{vault: %s, password: [redacted]}", value.VaultPath)
+	case SessionArgs:
+		return fmt.Sprintf("{vault: %s}", value.VaultPath)
+	case RefreshArgs:
+		return fmt.Sprintf("{vault: %s, expire: %v}", value.VaultPath, value.ExpireAfter)
+	}
+	return arg
+}
+
+// debugf writes a message to the debug log if it is enabled.
+// Byte slices and secret values in args are redacted.
+func debugf(format string, args ...interface{}) {
+	if debugLog == nil {
+		return
+	}
+	redacted := make([]interface{}, len(args))
+	for i, arg := range args {
+		redacted[i] = redactArg(arg)
+	}
+	debugLog.Printf(format, redacted...)
+}
+
+// debugTimer returns a function which logs the time
+// taken since debugTimer was called
+func debugTimer(operation string) func() {
+	if debugLog == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		debugf("%s took %v", operation, time.Since(start))
+	}
+}
+
+// initDebugLog enables debug logging if verbose is true or
+// $ONEPASS_DEBUG is set. If $ONEPASS_DEBUG is a file path
+// rather than '1' or 'true', the log is appended to that file,
+// otherwise it is written to stderr.
+func initDebugLog(verbose bool) error {
+	setting := os.Getenv("ONEPASS_DEBUG")
+	if !verbose && (setting == "" || setting == "0" || strings.ToLower(setting) == "false") {
+		return nil
+	}
+	var out io.Writer = os.Stderr
+	switch strings.ToLower(setting) {
+	case "", "0", "1", "true", "false":
+	default:
+		file, err := os.OpenFile(setting, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return fmt.Errorf("Unable to open debug log '%s': %v", setting, err)
+		}
+		out = file
+	}
+	debugLog = log.New(out, fmt.Sprintf("1pass[%d] ", os.Getpid()), log.LstdFlags|log.Lmicroseconds)
+	onepass.DebugLog = debugf
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestDebugRedaction(t *testing.T) {
+	var out bytes.Buffer
+	debugLog = log.New(&out, "", 0)
+	defer func() { debugLog = nil }()
+
+	debugf("key %v", []byte("a secret key"))
+	debugf("password %v", secret("hunter2"))
+	debugf("call %v", CryptArgs{VaultPath: "/vault", KeyName: "SL5", Data: []byte("item data")})
+	debugf("call %v", UnlockArgs{VaultPath: "/vault", MasterPwd: "hunter2"})
+
+	logged := out.String()
+	for _, leaked := range []string{"a secret key", "hunter2", "item data"} {
+		if strings.Contains(logged, leaked) {
+			t.Errorf("Debug log contains secret '%s': %s", leaked, logged)
+		}
+	}
+	for _, expected := range []string{"[12 bytes redacted]", "[7 chars redacted]", "key: SL5", "/vault"} {
+		if !strings.Contains(logged, expected) {
+			t.Errorf("Debug log does not contain '%s': %s", expected, logged)
+		}
+	}
+}
+
+func TestDebugDisabled(t *testing.T) {
+	debugLog = nil
+	// should not panic when logging is disabled
+	debugf("message %v", []byte("data"))
+	debugTimer("operation")()
+}
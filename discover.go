@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+// vault formats recognized when searching for vaults
+const (
+	agileKeychainFormat = "agilekeychain"
+	opVaultFormat       = "opvault"
+)
+
+// folders synced by cloud storage clients, in which vaults
+// are searched for if the platform's file search misses them
+var cloudStorageDirs = []string{"Dropbox", "Google Drive", "Nextcloud", "OneDrive"}
+
+// maximum depth below each cloud storage folder at which
+// vaults are searched for
+const vaultSearchDepth = 4
+
+// discoveredVault describes a vault found by discoverVaults()
+type discoveredVault struct {
+	path string
+
+	// 'agilekeychain' or 'opvault'
+	format string
+
+	// how the vault was found, eg. 'locate' or 'Dropbox'
+	source string
+
+	// the reason the vault cannot be used
+	// or nil if it can be opened by 1pass
+	err error
+}
+
+func discoverHelp() string {
+	return fmt.Sprintf(`Lists the vaults found on this computer using %s, a search
+of the cloud storage folders in your home directory (%s)
+up to %d levels deep and the locations where 1Password stores vaults
+by default.
+
+Vaults in the OPVault (.opvault) format are listed but cannot yet
+be opened by 1pass. Use 'set-vault <path>' to choose one of the
+vaults listed.`, vaultLocator, strings.Join(cloudStorageDirs, ", "), vaultSearchDepth)
+}
+
+// vaultFormat returns the format of the vault at path,
+// based on its extension, or an empty string if the
+// path does not look like a vault
+func vaultFormat(path string) string {
+	switch filepath.Ext(path) {
+	case ".agilekeychain":
+		return agileKeychainFormat
+	case ".opvault":
+		return opVaultFormat
+	default:
+		return ""
+	}
+}
+
+// checkDiscoveredVault returns an error if the vault at path
+// is incomplete or cannot be opened
+func checkDiscoveredVault(path string, format string) error {
+	if format == opVaultFormat {
+		_, err := os.Stat(path + "/default/profile.js")
+		if err != nil {
+			return fmt.Errorf("Unable to find profile in vault")
+		}
+		return fmt.Errorf("OPVault vaults are not supported")
+	}
+	return onepass.CheckVault(path)
+}
+
+// searchVaultDirs walks the directories in roots, up to maxDepth
+// levels below each, and returns the paths of vaults found.
+// Hidden directories and the contents of vaults are skipped.
+func searchVaultDirs(roots []string, maxDepth int) []string {
+	paths := []string{}
+	for _, root := range roots {
+		root = filepath.Clean(root)
+		_ = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.IsDir() {
+				// skip unreadable directories rather
+				// than abandoning the search
+				return nil
+			}
+			if path == root {
+				return nil
+			}
+			if vaultFormat(path) != "" {
+				paths = append(paths, path)
+				return filepath.SkipDir
+			}
+			depth := strings.Count(path[len(root):], string(filepath.Separator))
+			if depth >= maxDepth || strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+	}
+	return paths
+}
+
+// discoverVaults searches for vaults using the platform's file
+// search, a search of cloud storage folders and the default vault
+// locations. Each vault is listed once, along with whether it
+// can be used.
+func discoverVaults() []discoveredVault {
+	vaults := []discoveredVault{}
+	seen := map[string]bool{}
+	add := func(source string, paths []string) {
+		for _, path := range paths {
+			path = strings.TrimRight(path, "/")
+			format := vaultFormat(path)
+			if format == "" || seen[path] {
+				continue
+			}
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			seen[path] = true
+			vaults = append(vaults, discoveredVault{
+				path:   path,
+				format: format,
+				source: source,
+				err:    checkDiscoveredVault(path, format),
+			})
+		}
+	}
+
+	add(vaultLocator, locateVaults())
+	home := homeDir()
+	for _, dir := range cloudStorageDirs {
+		add(dir, searchVaultDirs([]string{home + "/" + dir}, vaultSearchDepth))
+	}
+	add("default location", append([]string{home + "/Dropbox/1Password/1Password.agilekeychain"},
+		platformVaultPaths()...))
+
+	return vaults
+}
+
+// attempt to locate the keychain directory automatically
+func findKeyChainDirs() []string {
+	paths := []string{}
+	for _, vault := range discoverVaults() {
+		if vault.err == nil {
+			paths = append(paths, vault.path)
+		}
+	}
+	return paths
+}
+
+// listDiscoveredVaults prints all of the vaults found by
+// discoverVaults(), marking the current vault
+func listDiscoveredVaults(currentVault string) {
+	vaults := discoverVaults()
+	if len(vaults) == 0 {
+		fmt.Printf("No vaults found. Use 'new <path>' to create one.\n")
+		return
+	}
+	for _, vault := range vaults {
+		note := ""
+		if vault.path == currentVault {
+			note = " (current)"
+		}
+		if vault.err != nil {
+			note += fmt.Sprintf(" - %v", vault.err)
+		}
+		fmt.Printf("%s [%s, found via %s]%s\n", vault.path, vault.format, vault.source, note)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"testing"
+)
+
+func TestSearchVaultDirs(t *testing.T) {
+	root := os.TempDir() + "/1pass-test-discover"
+	os.RemoveAll(root)
+	defer os.RemoveAll(root)
+
+	dirs := []string{
+		"1Password/1Password.agilekeychain/data/default",
+		"shared/team/Team.opvault/default",
+		"a/b/c/TooDeep.agilekeychain/data/default",
+		".hidden/Hidden.agilekeychain/data/default",
+		"Outer.agilekeychain/Nested.agilekeychain",
+	}
+	for _, dir := range dirs {
+		err := os.MkdirAll(root+"/"+dir, 0700)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths := searchVaultDirs([]string{root, root + "/missing"}, 3)
+	sort.Strings(paths)
+	expected := []string{
+		root + "/1Password/1Password.agilekeychain",
+		root + "/Outer.agilekeychain",
+		root + "/shared/team/Team.opvault",
+	}
+	if len(paths) != len(expected) {
+		t.Fatalf("Expected vaults %v, found %v", expected, paths)
+	}
+	for i, path := range expected {
+		if paths[i] != path {
+			t.Errorf("Expected vault '%s', found '%s'", path, paths[i])
+		}
+	}
+
+	if err := checkDiscoveredVault(expected[0], agileKeychainFormat); err != nil {
+		t.Errorf("Expected vault to be usable: %v", err)
+	}
+	if err := checkDiscoveredVault(expected[2], opVaultFormat); err == nil {
+		t.Errorf("Expected OPVault vault to be reported as unsupported")
+	}
+}
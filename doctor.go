@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/robertknight/1pass/jsonutil"
+	"github.com/robertknight/1pass/onepass"
+)
+
+func doctorHelp() string {
+	return `Checks the 1pass configuration and environment for common problems
+and suggests how to fix them. The checks cover the config file, the
+vault path, the agent's socket, whether the agent is reachable and
+compatible with this version of 1pass, the clipboard tools used by
+'copy' and the tool used to find vaults automatically.
+
+The agent is not started if it is not running. The exit status is
+non-zero if any check fails.`
+}
+
+// doctorResult is the outcome of one check run by 'doctor'
+type doctorResult struct {
+	name string
+	// description of the result if the check passed
+	detail string
+	// reason the check failed, nil if it passed
+	err error
+	// suggested fix if the check failed
+	fix string
+}
+
+func doctorPass(name string, detail string) doctorResult {
+	return doctorResult{name: name, detail: detail}
+}
+
+func doctorFail(name string, err error, fix string) doctorResult {
+	return doctorResult{name: name, err: err, fix: fix}
+}
+
+func checkConfigFile(path string) (clientConfig, doctorResult) {
+	const name = "Config file"
+	var config clientConfig
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return config, doctorFail(name, fmt.Errorf("%s does not exist", path),
+			"Run '1pass set-vault <path>' to choose a vault")
+	}
+	err = jsonutil.ReadFile(path, &config)
+	if err != nil {
+		return config, doctorFail(name, fmt.Errorf("Unable to read %s: %v", path, err),
+			fmt.Sprintf("Fix the JSON syntax in %s or remove it and run '1pass set-vault <path>'", path))
+	}
+	return config, doctorPass(name, path)
+}
+
+func checkVaultPath(vaultDir string) doctorResult {
+	const name = "Vault"
+	if vaultDir == "" {
+		return doctorFail(name, errors.New("No vault is configured"), "Run '1pass set-vault <path>'")
+	}
+	err := onepass.CheckVault(vaultDir)
+	if err != nil {
+		return doctorFail(name, fmt.Errorf("'%s': %v", vaultDir, err),
+			"Check that the vault has finished syncing or run '1pass set-vault <path>'")
+	}
+	return doctorPass(name, vaultDir)
+}
+
+// checkAgentSocket checks that the agent's socket, if it
+// exists, cannot be used by other users
+func checkAgentSocket(sockPath string) doctorResult {
+	const name = "Agent socket"
+	info, err := os.Stat(sockPath)
+	if os.IsNotExist(err) {
+		return doctorPass(name, "not present, the agent is not running")
+	} else if err != nil {
+		return doctorFail(name, err, "")
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return doctorFail(name, fmt.Errorf("%s is not a socket", sockPath),
+			fmt.Sprintf("Remove %s", sockPath))
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return doctorFail(name, fmt.Errorf("%s is accessible by other users (%v)", sockPath, info.Mode().Perm()),
+			fmt.Sprintf("Run 'chmod 600 %s'", sockPath))
+	}
+	return doctorPass(name, sockPath)
+}
+
+// checkAgent checks that the agent is reachable, if its socket exists,
+// and that it supports a protocol version in common with this client
+func checkAgent(vaultDir string) []doctorResult {
+	if remoteAddr := os.Getenv(remoteAgentEnvVar); remoteAddr != "" {
+		return []doctorResult{doctorPass("Agent", fmt.Sprintf("remote agent at %s, not checked", remoteAddr))}
+	}
+	if _, err := os.Stat(agentConnAddr); os.IsNotExist(err) {
+		return []doctorResult{doctorPass("Agent", "not running, it will be started when needed")}
+	}
+	agentClient, err := DialAgent(vaultDir)
+	if err != nil {
+		return []doctorResult{doctorFail("Agent", fmt.Errorf("Unable to connect: %v", err),
+			fmt.Sprintf("Remove the stale socket %s. The agent will be started when needed", agentConnAddr))}
+	}
+	results := []doctorResult{doctorPass("Agent", fmt.Sprintf("running, pid %d", agentClient.Info.Pid))}
+	if agentClient.Protocol == 0 {
+		results = append(results, doctorFail("Agent version",
+			fmt.Errorf("The agent supports protocol versions %d-%d, this client supports %d-%d",
+				agentClient.Info.MinProtocolVersion, agentClient.Info.ProtocolVersion,
+				agentMinProtocolVersion, agentProtocolVersion),
+			"Run any vault command, eg. '1pass list', to restart the agent"))
+	} else {
+		results = append(results, doctorPass("Agent version", fmt.Sprintf("protocol version %d", agentClient.Protocol)))
+	}
+	return results
+}
+
+// checkTools checks that one of the commands in tools is installed
+func checkTools(name string, tools []string, fix string) doctorResult {
+	for _, tool := range tools {
+		if path, err := exec.LookPath(tool); err == nil {
+			return doctorPass(name, path)
+		}
+	}
+	return doctorFail(name, fmt.Errorf("%s not found", strings.Join(tools, " or ")), fix)
+}
+
+func checkClipboard() doctorResult {
+	const name = "Clipboard"
+	if isWaylandSession() {
+		return checkTools(name, []string{"wl-copy"}, "Install wl-clipboard")
+	}
+	tools := systemClipboardTools()
+	if len(tools) == 0 {
+		return doctorPass(name, "system clipboard")
+	}
+	return checkTools(name, tools, fmt.Sprintf("Install %s", strings.Join(tools, " or ")))
+}
+
+// runDoctor runs the checks described in doctorHelp(), prints
+// the results and returns true if all checks passed
+func runDoctor() bool {
+	config, configResult := checkConfigFile(configPath)
+	results := []doctorResult{configResult, checkVaultPath(config.VaultDir), checkAgentSocket(agentConnAddr)}
+	results = append(results, checkAgent(config.VaultDir)...)
+	results = append(results, checkClipboard(),
+		checkTools("Vault search", []string{vaultLocator},
+			fmt.Sprintf("Install %s to find vaults automatically, or use '1pass set-vault <path>'", vaultLocator)))
+
+	ok := true
+	for _, result := range results {
+		if result.err == nil {
+			fmt.Printf("[ %s ] %s: %s\n", colorize(colorCyan, "OK"), result.name, result.detail)
+			continue
+		}
+		ok = false
+		fmt.Printf("[%s] %s: %v\n", colorize(colorRed, "FAIL"), result.name, result.err)
+		if result.fix != "" {
+			fmt.Printf("       Fix: %s\n", result.fix)
+		}
+	}
+	return ok
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestCheckConfigFile(t *testing.T) {
+	path := os.TempDir() + "/1pass-test-doctor-config"
+	os.Remove(path)
+	defer os.Remove(path)
+
+	_, result := checkConfigFile(path)
+	if result.err == nil {
+		t.Errorf("Missing config file should fail")
+	}
+
+	ioutil.WriteFile(path, []byte(`{"VaultDir": `), 0600)
+	_, result = checkConfigFile(path)
+	if result.err == nil {
+		t.Errorf("Invalid config file should fail")
+	}
+
+	ioutil.WriteFile(path, []byte(`{"VaultDir": "/path/to/vault.agilekeychain"}`), 0600)
+	config, result := checkConfigFile(path)
+	if result.err != nil || config.VaultDir != "/path/to/vault.agilekeychain" {
+		t.Errorf("Unexpected result for valid config: %v", result.err)
+	}
+}
+
+func TestCheckAgentSocket(t *testing.T) {
+	sockPath := os.TempDir() + "/1pass-test-doctor.sock"
+	os.Remove(sockPath)
+
+	if result := checkAgentSocket(sockPath); result.err != nil {
+		t.Errorf("Missing socket should pass: %v", result.err)
+	}
+
+	listener, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	os.Chmod(sockPath, 0600)
+	if result := checkAgentSocket(sockPath); result.err != nil {
+		t.Errorf("Private socket should pass: %v", result.err)
+	}
+	os.Chmod(sockPath, 0666)
+	if result := checkAgentSocket(sockPath); result.err == nil {
+		t.Errorf("Socket accessible by other users should fail")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func getDocumentHelp() string {
+	return `Decrypts the file stored in the document item matching <pattern>
+and saves it to <dest>, or writes it to stdout if <dest> is '-'.
+Existing files are not overwritten.
+
+Documents are added with 'add document <title> <file>'.`
+}
+
+// addDocument stores the file at path in a new document item
+func addDocument(vault *onepass.Vault, title string, path string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fatalErr(err, "Unable to read document")
+	}
+	defer onepass.ZeroBytes(data)
+	undo := newUndoRecorder(vault, "add")
+	item, err := vault.AddDocument(title, path, data)
+	if err != nil {
+		fatalErr(err, "Unable to add document")
+	}
+	undo.added(item)
+	undo.commit()
+	logItemAction("Added new document", item)
+}
+
+// getDocument saves the file stored in the document item
+// matching pattern to dest, or stdout if dest is '-'
+func getDocument(vault *onepass.Vault, pattern string, dest string) {
+	item, err := lookupSingleItem(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Failed to find document")
+	}
+	data, err := item.DocumentData()
+	if err != nil {
+		fatalErr(err, fmt.Sprintf("Unable to read '%s'", item.Title))
+	}
+	defer onepass.ZeroBytes(data)
+
+	if dest == "-" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		var file *os.File
+		file, err = os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			_, err = file.Write(data)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if err != nil {
+		fatalErr(err, "Unable to save document")
+	}
+	if dest != "-" {
+		fmt.Fprintf(os.Stderr, "Saved '%s' to %s\n", item.Title, dest)
+	}
+	recordItemUse(vault, item)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+// types of event reported by WaitForEvents(), in addition
+// to the item events reported by onepass.Subscription
+const (
+	vaultLockedEvent   = "locked"
+	vaultUnlockedEvent = "unlocked"
+)
+
+// maximum number of recent events kept by the agent
+const maxAgentEvents = 100
+
+// maximum time for which WaitForEvents() waits for a new event
+const maxEventWait = 5 * time.Minute
+
+// AgentEvent describes a change to a vault
+// reported by WaitForEvents()
+type AgentEvent struct {
+	// sequence number of the event, which increases
+	// with each event recorded by the agent
+	Seq  uint64
+	Time time.Time
+
+	// 'item-added', 'item-updated', 'item-removed',
+	// 'locked' or 'unlocked'
+	Type      string
+	VaultPath string
+
+	// ID, title and type of the changed item.
+	// Empty for lock and unlock events.
+	ItemUuid  string
+	ItemTitle string
+	ItemType  string
+}
+
+type EventArgs struct {
+	VaultPath string
+	Session   string
+
+	// sequence number of the last event seen by the
+	// client. Only later events are returned.
+	After uint64
+
+	// maximum time to wait for an event
+	Wait time.Duration
+
+	Timeout time.Duration
+}
+
+type EventsReply struct {
+	Events []AgentEvent
+
+	// sequence number of the latest event recorded by
+	// the agent, to pass as the 'After' argument of
+	// the next WaitForEvents() call
+	Seq uint64
+}
+
+// records an event and wakes any WaitForEvents() calls
+func (agent *OnePassAgent) addEvent(event AgentEvent) {
+	agent.eventsMu.Lock()
+	defer agent.eventsMu.Unlock()
+
+	agent.eventSeq++
+	event.Seq = agent.eventSeq
+	event.Time = time.Now()
+	agent.events = append(agent.events, event)
+	if len(agent.events) > maxAgentEvents {
+		agent.events = agent.events[len(agent.events)-maxAgentEvents:]
+	}
+	if agent.newEvents != nil {
+		close(agent.newEvents)
+	}
+	agent.newEvents = make(chan bool)
+}
+
+// watches an unlocked vault for changes, which are recorded for
+// WaitForEvents(). The vault is locked if the encryption keys are
+// replaced, eg. because the master password was changed on another
+// device, so that stale keys are not used to encrypt new items.
+func (agent *OnePassAgent) watchVault(vaultPath string) {
+	vault, err := onepass.OpenVault(vaultPath)
+	if err != nil {
+		return
+	}
+	sub, err := vault.Subscribe()
+	if err != nil {
+		log.Printf("Unable to watch vault '%s' for changes: %v", vaultPath, err)
+		return
+	}
+
+	agent.mu.Lock()
+	vaultData, unlocked := agent.vaults[vaultPath]
+	if !unlocked || vaultData.watcher != nil {
+		// the vault was locked, or unlocked again and
+		// is already being watched, while subscribing
+		agent.mu.Unlock()
+		sub.Close()
+		return
+	}
+	vaultData.watcher = sub
+	agent.vaults[vaultPath] = vaultData
+	agent.mu.Unlock()
+
+	for event := range sub.Events {
+		if event.Type == onepass.KeysChanged {
+			log.Printf("Encryption keys for '%s' changed, locking vault", vaultPath)
+			ok := false
+			agent.Lock(vaultPath, &ok)
+			continue
+		}
+		agent.addEvent(AgentEvent{
+			Type:      string(event.Type),
+			VaultPath: vaultPath,
+			ItemUuid:  event.Item.Uuid,
+			ItemTitle: event.Item.Title,
+			ItemType:  event.Item.TypeName,
+		})
+	}
+}
+
+// WaitForEvents returns the changes to a vault after the event
+// args.After, waiting up to args.Wait for a change if there are none.
+// Changes to items are only reported while the vault is unlocked.
+func (agent *OnePassAgent) WaitForEvents(args EventArgs, reply *EventsReply) error {
+	ctx, cancel := requestContext(args.Timeout)
+	defer cancel()
+
+	agent.mu.RLock()
+	vaultData, unlocked := agent.vaults[args.VaultPath]
+	var err error
+	if unlocked {
+		err = vaultData.checkSession(args.Session)
+	}
+	agent.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	wait := args.Wait
+	if wait > maxEventWait {
+		wait = maxEventWait
+	}
+	deadline := time.After(wait)
+	for {
+		agent.eventsMu.Lock()
+		events := []AgentEvent{}
+		for _, event := range agent.events {
+			isItemEvent := event.Type != vaultLockedEvent && event.Type != vaultUnlockedEvent
+			if event.Seq > args.After && event.VaultPath == args.VaultPath && (unlocked || !isItemEvent) {
+				events = append(events, event)
+			}
+		}
+		*reply = EventsReply{Events: events, Seq: agent.eventSeq}
+		if agent.newEvents == nil {
+			agent.newEvents = make(chan bool)
+		}
+		newEvents := agent.newEvents
+		agent.eventsMu.Unlock()
+
+		if len(events) > 0 {
+			return nil
+		}
+		select {
+		case <-newEvents:
+		case <-deadline:
+			return nil
+		case <-ctx.Done():
+			return errRequestExpired
+		}
+	}
+}
+
+var errEventsUnsupported = errors.New("The agent does not support waiting for vault changes")
+
+// WaitForEvents waits up to wait for changes to the vault after
+// the event with sequence number after. Pass 0 for wait to return
+// immediately with the sequence number of the latest event.
+func (client *OnePassAgentClient) WaitForEvents(after uint64, wait time.Duration) (EventsReply, error) {
+	if client.Protocol < 5 {
+		return EventsReply{}, errEventsUnsupported
+	}
+	// leave time for the reply to arrive before the call times out
+	if client.CallTimeout > 0 && wait > client.CallTimeout/2 {
+		wait = client.CallTimeout / 2
+	}
+	var reply EventsReply
+	err := client.call("OnePassAgent.WaitForEvents", EventArgs{
+		VaultPath: client.VaultPath,
+		Session:   client.Session,
+		After:     after,
+		Wait:      wait,
+	}, &reply)
+	return reply, err
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+// date format used for expiry dates
+const expiryDateFormat = "2006-01-02"
+
+func setExpiryHelp() string {
+	return `Sets the date after which the credentials stored in the matching
+items should be changed. <expiry> is either a date in YYYY-MM-DD form,
+a period from now such as '90d' (days), '12w' (weeks) or '6m' (months)
+or 'never' to remove the expiry date.
+
+'show' and 'copy' print a warning when used with an item which has
+expired and 'list -expiring <period>' lists items which expire within
+the given period.`
+}
+
+// parseExpiryPeriod parses a period such as '30d', '2w' or '6m'
+// or any duration accepted by time.ParseDuration
+func parseExpiryPeriod(period string) (time.Duration, error) {
+	const day = 24 * time.Hour
+	units := map[string]time.Duration{
+		"d": day,
+		"w": 7 * day,
+		"m": 30 * day,
+		"y": 365 * day,
+	}
+	if len(period) > 1 {
+		unit, ok := units[period[len(period)-1:]]
+		count, err := strconv.Atoi(period[:len(period)-1])
+		if ok && err == nil && count >= 0 {
+			return time.Duration(count) * unit, nil
+		}
+	}
+	duration, err := time.ParseDuration(period)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("Invalid period '%s'. Use a number of days, weeks, months or years, eg. '30d'", period)
+	}
+	return duration, nil
+}
+
+// parseExpiry parses an expiry date or period as described in
+// setExpiryHelp() and returns the expiry time. The zero time is
+// returned for 'never'.
+func parseExpiry(expiry string, now time.Time) (time.Time, error) {
+	if expiry == "never" {
+		return time.Time{}, nil
+	}
+	date, err := time.ParseInLocation(expiryDateFormat, expiry, time.Local)
+	if err == nil {
+		return date, nil
+	}
+	period, err := parseExpiryPeriod(expiry)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid expiry '%s'. Use a date (YYYY-MM-DD), a period such as '90d' or 'never'", expiry)
+	}
+	return now.Add(period), nil
+}
+
+// formatExpiry returns the expiry date of item or an empty
+// string if it does not expire
+func formatExpiry(item onepass.Item) string {
+	if item.OpenContents.Expires == 0 {
+		return ""
+	}
+	return time.Unix(int64(item.OpenContents.Expires), 0).Format(expiryDateFormat)
+}
+
+func setExpiry(vault *onepass.Vault, patterns []string, expiry string) {
+	expiryTime, err := parseExpiry(expiry, time.Now())
+	if err != nil {
+		fatalErr(err, "")
+	}
+	items, err := lookupItemList(vault, patterns)
+	if err != nil {
+		fatalErr(err, "Unable to lookup items")
+	}
+	undo := newUndoRecorder(vault, "expiry")
+	defer undo.commit()
+	for _, item := range items {
+		undo.snapshot(item)
+		if expiryTime.IsZero() {
+			logItemAction("Removing expiry date from", item)
+			item.OpenContents.Expires = 0
+		} else {
+			logItemAction(fmt.Sprintf("Setting expiry date to %s for", expiryTime.Format(expiryDateFormat)), item)
+			item.OpenContents.Expires = uint64(expiryTime.Unix())
+		}
+		err = item.Save()
+		if err != nil {
+			fatalErr(err, fmt.Sprintf("Unable to save item '%s'", item.Title))
+		}
+	}
+}
+
+// filterExpiring returns the items in items which have
+// already expired or will expire within period from now
+func filterExpiring(items []onepass.Item, period time.Duration, now time.Time) []onepass.Item {
+	filtered := []onepass.Item{}
+	for _, item := range items {
+		if item.IsExpired(now.Add(period)) {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered
+}
+
+// warnIfExpired prints a warning to stderr if the
+// credentials in item have expired
+func warnIfExpired(item onepass.Item) {
+	if !item.IsExpired(time.Now()) {
+		return
+	}
+	banner := strings.Repeat("*", 60)
+	fmt.Fprintf(os.Stderr, "%s\nWarning: '%s' expired on %s. Its credentials should be changed.\n%s\n",
+		banner, item.Title, formatExpiry(item), banner)
+}
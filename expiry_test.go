@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2015, 3, 1, 12, 0, 0, 0, time.Local)
+	cases := map[string]time.Time{
+		"30d":        now.AddDate(0, 0, 30),
+		"2w":         now.AddDate(0, 0, 14),
+		"48h":        now.Add(48 * time.Hour),
+		"2015-06-01": time.Date(2015, 6, 1, 0, 0, 0, 0, time.Local),
+		"never":      time.Time{},
+	}
+	for expiry, expected := range cases {
+		actual, err := parseExpiry(expiry, now)
+		if err != nil {
+			t.Errorf("Failed to parse '%s': %v", expiry, err)
+		} else if !actual.Equal(expected) {
+			t.Errorf("Expected %v for '%s', got %v", expected, expiry, actual)
+		}
+	}
+	for _, expiry := range []string{"", "d", "-3d", "soon", "2015-13-01"} {
+		_, err := parseExpiry(expiry, now)
+		if err == nil {
+			t.Errorf("Expected '%s' to be rejected", expiry)
+		}
+	}
+}
+
+func TestFilterExpiring(t *testing.T) {
+	now := time.Now()
+	expiring := func(title string, expires time.Time) onepass.Item {
+		item := onepass.Item{Title: title}
+		if !expires.IsZero() {
+			item.OpenContents.Expires = uint64(expires.Unix())
+		}
+		return item
+	}
+	items := []onepass.Item{
+		expiring("expired", now.AddDate(0, 0, -1)),
+		expiring("soon", now.AddDate(0, 0, 10)),
+		expiring("later", now.AddDate(0, 0, 60)),
+		expiring("never", time.Time{}),
+	}
+	filtered := filterExpiring(items, 30*24*time.Hour, now)
+	if len(filtered) != 2 || filtered[0].Title != "expired" || filtered[1].Title != "soon" {
+		t.Errorf("Unexpected expiring items: %v", filtered)
+	}
+	filtered = filterExpiring(items, 0, now)
+	if len(filtered) != 1 || filtered[0].Title != "expired" {
+		t.Errorf("Unexpected expired items: %v", filtered)
+	}
+}
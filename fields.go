@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"code.google.com/p/go.crypto/ssh/terminal"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+// stringList is a flag.Value which collects the values
+// of a flag which may be given several times
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// flagFunc is a flag.Value which calls a function
+// for each value of the flag
+type flagFunc func(value string) error
+
+func (f flagFunc) String() string {
+	return ""
+}
+
+func (f flagFunc) Set(value string) error {
+	return f(value)
+}
+
+// splitFieldAssignment splits a 'field=value' argument
+func splitFieldAssignment(arg string) (field string, value string, err error) {
+	sep := strings.Index(arg, "=")
+	if sep < 1 {
+		return "", "", fmt.Errorf("'%s' is not in the form field=value", arg)
+	}
+	return arg[0:sep], arg[sep+1:], nil
+}
+
+// scanner for values read from stdin by readSecretArg().
+// This is shared so that several values can be read from
+// successive lines.
+var stdinLines = bufio.NewScanner(os.Stdin)
+
+// readSecretArg returns the value for a field given as '-' on the
+// command line. When run from a terminal, the user is prompted for
+// the value as with 'add', otherwise the next line of stdin is used.
+func readSecretArg(fieldName string) (string, error) {
+	if terminal.IsTerminal(0) {
+		return readNewPassword(fieldName)
+	}
+	if !stdinLines.Scan() {
+		if stdinLines.Err() != nil {
+			return "", stdinLines.Err()
+		}
+		return "", fmt.Errorf("No value for '%s' on stdin", fieldName)
+	}
+	return stdinLines.Text(), nil
+}
+
+// copyItemContent returns a deep copy of content
+func copyItemContent(content onepass.ItemContent) (onepass.ItemContent, error) {
+	var contentCopy onepass.ItemContent
+	data, err := json.Marshal(content)
+	if err != nil {
+		return contentCopy, err
+	}
+	err = json.Unmarshal(data, &contentCopy)
+	return contentCopy, err
+}
+
+// setFieldValue sets the value of the field, web form field or
+// URL in content whose name, title or designation is name,
+// ignoring case. 'notes' sets the item's notes and 'url' or
+// 'website' sets the first URL, adding one if necessary.
+func setFieldValue(content *onepass.ItemContent, name string, value string) error {
+	nameLower := strings.ToLower(name)
+	if nameLower == "notes" {
+		content.Notes = value
+		return nil
+	}
+
+	for i, field := range content.FormFields {
+		if strings.ToLower(field.Designation) == nameLower || strings.ToLower(field.Name) == nameLower {
+			content.FormFields[i].Value = value
+			return nil
+		}
+	}
+
+	for i, section := range content.Sections {
+		for k, field := range section.Fields {
+			if strings.ToLower(field.Name) == nameLower || strings.ToLower(field.Title) == nameLower {
+				fieldValue, err := onepass.ParseFieldValue(field, value)
+				if err != nil {
+					return err
+				}
+				content.Sections[i].Fields[k].Value = fieldValue
+				return nil
+			}
+		}
+	}
+
+	for i, url := range content.Urls {
+		if strings.ToLower(url.Label) == nameLower {
+			content.Urls[i].Url = value
+			return nil
+		}
+	}
+	if nameLower == "url" || nameLower == "website" {
+		if len(content.Urls) == 0 {
+			content.Urls = append(content.Urls, onepass.ItemUrl{Label: "website"})
+		}
+		content.Urls[0].Url = value
+		return nil
+	}
+
+	return fmt.Errorf("No field, web form field or URL named '%s'", name)
+}
+
+func setHelp() string {
+	return `Sets the value of each field, web form field or URL named in a
+'field=value' argument, matching names, titles and designations as
+with 'add -field'. 'notes' sets the item's notes.
+
+Fields which do not exist are added to the item. 'url:<label>=value'
+adds or sets the URL with the given label.
+
+Values are checked against the field's kind. Dates are given as
+YYYY-MM-DD, months such as card expiry dates as MM/YYYY and menu
+fields, such as a card's type, must be one of the menu's choices.
+
+A value of '-' is prompted for when run from a terminal or otherwise
+read from the next line of stdin. New fields whose value is given
+this way are stored as concealed (password) fields.`
+}
+
+// setUrl sets the URL with the given label in content,
+// adding it if necessary
+func setUrl(content *onepass.ItemContent, label string, value string) {
+	for i, url := range content.Urls {
+		if url.Label == label {
+			content.Urls[i].Url = value
+			return
+		}
+	}
+	content.Urls = append(content.Urls, onepass.ItemUrl{Label: label, Url: value})
+}
+
+// addFieldValue adds a new field called name to the
+// first section of content
+func addFieldValue(content *onepass.ItemContent, name string, value string, concealed bool) {
+	if len(content.Sections) == 0 {
+		content.Sections = append(content.Sections, onepass.ItemSection{
+			Fields: []onepass.ItemField{},
+		})
+	}
+	kind := "string"
+	if concealed {
+		kind = "concealed"
+	}
+	content.Sections[0].Fields = append(content.Sections[0].Fields, onepass.ItemField{
+		Kind:  kind,
+		Name:  name,
+		Title: name,
+		Value: value,
+	})
+}
+
+// setItemFields sets fields in the item matching pattern from
+// a list of 'field=value' arguments, adding any which do not exist
+func setItemFields(vault *onepass.Vault, pattern string, fieldValues []string) {
+	item, err := lookupSingleItem(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Failed to find item")
+	}
+	content, err := item.Content()
+	if err != nil {
+		fatalErr(err, "Unable to read item content")
+	}
+	previous, err := copyItemContent(content)
+	if err != nil {
+		fatalErr(err, "Unable to read item content")
+	}
+
+	for _, arg := range fieldValues {
+		name, value, err := splitFieldAssignment(arg)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		fromStdin := value == "-"
+		if fromStdin {
+			value, err = readSecretArg(name)
+			if err != nil {
+				fatalErr(err, fmt.Sprintf("Unable to read value for '%s'", name))
+			}
+		}
+		if strings.HasPrefix(name, "url:") {
+			setUrl(&content, strings.TrimPrefix(name, "url:"), value)
+		} else if setFieldValue(&content, name, value) != nil {
+			addFieldValue(&content, name, value, fromStdin)
+		}
+	}
+	if item.TypeName == creditCardType {
+		err = checkCardNumber(&content)
+		if err != nil {
+			fatalErr(err, "")
+		}
+	}
+
+	content.RecordPasswordChanges(previous, time.Now())
+
+	undo := newUndoRecorder(vault, "edit")
+	undo.snapshot(item)
+	err = item.SetContent(content)
+	if err != nil {
+		fatalErr(err, "Unable to save updated content")
+	}
+	err = item.Save()
+	if err != nil {
+		fatalErr(err, "Unable to save updated item")
+	}
+	undo.commit()
+	logItemAction("Updated item", item)
+}
+
+// fieldRef identifies a section, section field, web form
+// field or URL within an item's content
+type fieldRef struct {
+	// one of 'section', 'field', 'form field' or 'URL'
+	kind    string
+	section int
+	index   int
+	title   string
+}
+
+// matchFields returns references to the sections, fields, web form
+// fields and URLs in content whose title or name matches pattern.
+// Exact matches, ignoring case, are preferred over partial matches.
+func matchFields(content onepass.ItemContent, pattern string) []fieldRef {
+	patternLower := strings.ToLower(pattern)
+	exact := []fieldRef{}
+	partial := []fieldRef{}
+	match := func(ref fieldRef, names ...string) {
+		for _, name := range names {
+			nameLower := strings.ToLower(name)
+			if nameLower == patternLower {
+				exact = append(exact, ref)
+				return
+			}
+		}
+		for _, name := range names {
+			if name != "" && strings.Contains(strings.ToLower(name), patternLower) {
+				partial = append(partial, ref)
+				return
+			}
+		}
+	}
+
+	for i, section := range content.Sections {
+		if section.Title != "" {
+			match(fieldRef{"section", i, -1, section.Title}, section.Title, section.Name)
+		}
+		for k, field := range section.Fields {
+			match(fieldRef{"field", i, k, field.Title}, field.Title, field.Name)
+		}
+	}
+	for i, field := range content.FormFields {
+		match(fieldRef{"form field", -1, i, field.Name}, field.Name, field.Designation)
+	}
+	for i, url := range content.Urls {
+		match(fieldRef{"URL", -1, i, url.Label}, url.Label)
+	}
+
+	if len(exact) > 0 {
+		return exact
+	}
+	return partial
+}
+
+// matchSingleField returns the only field in content
+// matching pattern or an error if there is not exactly
+// one match
+func matchSingleField(content onepass.ItemContent, pattern string) (fieldRef, error) {
+	refs := matchFields(content, pattern)
+	if len(refs) == 0 {
+		return fieldRef{}, fmt.Errorf("No sections, fields or URLs match '%s'", pattern)
+	}
+	if len(refs) > 1 {
+		titles := []string{}
+		for _, ref := range refs {
+			titles = append(titles, fmt.Sprintf("'%s' (%s)", ref.title, ref.kind))
+		}
+		return fieldRef{}, fmt.Errorf("'%s' matches several sections, fields or URLs: %s", pattern,
+			strings.Join(titles, ", "))
+	}
+	return refs[0], nil
+}
+
+// removeContentField removes the section, field, web
+// form field or URL identified by ref from content
+func removeContentField(content *onepass.ItemContent, ref fieldRef) {
+	switch ref.kind {
+	case "section":
+		content.Sections = append(content.Sections[:ref.section], content.Sections[ref.section+1:]...)
+	case "field":
+		fields := content.Sections[ref.section].Fields
+		content.Sections[ref.section].Fields = append(fields[:ref.index], fields[ref.index+1:]...)
+	case "form field":
+		content.FormFields = append(content.FormFields[:ref.index], content.FormFields[ref.index+1:]...)
+	case "URL":
+		content.Urls = append(content.Urls[:ref.index], content.Urls[ref.index+1:]...)
+	}
+}
+
+// renameContentField changes the title of the section, field
+// or URL identified by ref. Web form fields are renamed by changing
+// their name, which may stop them being filled in by browsers.
+func renameContentField(content *onepass.ItemContent, ref fieldRef, newTitle string) {
+	switch ref.kind {
+	case "section":
+		content.Sections[ref.section].Title = newTitle
+	case "field":
+		content.Sections[ref.section].Fields[ref.index].Title = newTitle
+	case "form field":
+		content.FormFields[ref.index].Name = newTitle
+	case "URL":
+		content.Urls[ref.index].Label = newTitle
+	}
+}
+
+// updateItemField finds the item matching pattern and the field
+// within it matching fieldPattern and passes them to update before
+// saving the item
+func updateItemField(vault *onepass.Vault, pattern string, fieldPattern string,
+	update func(item onepass.Item, content *onepass.ItemContent, ref fieldRef)) {
+	item, err := lookupSingleItem(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Failed to find item")
+	}
+	content, err := item.Content()
+	if err != nil {
+		fatalErr(err, "Unable to read item content")
+	}
+	ref, err := matchSingleField(content, fieldPattern)
+	if err != nil {
+		fatalErr(err, "")
+	}
+	update(item, &content, ref)
+
+	undo := newUndoRecorder(vault, "edit")
+	undo.snapshot(item)
+	err = item.SetContent(content)
+	if err != nil {
+		fatalErr(err, "Unable to save updated content")
+	}
+	err = item.Save()
+	if err != nil {
+		fatalErr(err, "Unable to save updated item")
+	}
+	undo.commit()
+}
+
+func removeField(vault *onepass.Vault, pattern string, fieldPattern string) {
+	updateItemField(vault, pattern, fieldPattern, func(item onepass.Item, content *onepass.ItemContent, ref fieldRef) {
+		if ref.kind == "section" {
+			fmt.Printf("Removing section '%s' and its %d fields from '%s'\n", ref.title,
+				len(content.Sections[ref.section].Fields), item.Title)
+		} else {
+			fmt.Printf("Removing %s '%s' from '%s'\n", ref.kind, ref.title, item.Title)
+		}
+		removeContentField(content, ref)
+	})
+}
+
+func renameField(vault *onepass.Vault, pattern string, fieldPattern string, newTitle string) {
+	updateItemField(vault, pattern, fieldPattern, func(item onepass.Item, content *onepass.ItemContent, ref fieldRef) {
+		fmt.Printf("Renaming %s '%s' to '%s' in '%s'\n", ref.kind, ref.title, newTitle, item.Title)
+		renameContentField(content, ref, newTitle)
+	})
+}
+
+func fieldPatternHelp() string {
+	return `<field-pattern> is matched against the titles and names of the item's
+sections, fields, web form fields and URL labels. An exact match is
+used if there is one, otherwise the pattern must match part of exactly
+one title. Removing a section removes all of the fields within it.
+
+Use 'undo' to revert a change made by mistake.`
+}
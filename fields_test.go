@@ -0,0 +1,153 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func TestSetFieldValue(t *testing.T) {
+	template, ok := onepass.StandardTemplate("webforms.WebForm")
+	if !ok {
+		t.Fatal("Missing login template")
+	}
+	content, err := copyItemContent(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{
+		"username": "jim",
+		"Password": "secret",
+		"url":      "https://github.com",
+		"notes":    "Work account",
+	}
+	for name, value := range values {
+		err = setFieldValue(&content, name, value)
+		if err != nil {
+			t.Errorf("Failed to set '%s': %v", name, err)
+		}
+	}
+	if itemUsername(content) != "jim" {
+		t.Errorf("Unexpected username '%s'", itemUsername(content))
+	}
+	if _, password := findFieldValue(content, "password"); password != "secret" {
+		t.Errorf("Unexpected password '%s'", password)
+	}
+	if len(content.Urls) != 1 || content.Urls[0].Url != "https://github.com" {
+		t.Errorf("Unexpected URLs %v", content.Urls)
+	}
+	if content.Notes != "Work account" {
+		t.Errorf("Unexpected notes '%s'", content.Notes)
+	}
+	if err = setFieldValue(&content, "pin", "1234"); err == nil {
+		t.Errorf("Expected error when setting unknown field")
+	}
+
+	// check that the standard template was not modified
+	template, _ = onepass.StandardTemplate("webforms.WebForm")
+	for _, field := range template.FormFields {
+		if field.Value != "" {
+			t.Errorf("Standard template was modified: %v", template.FormFields)
+		}
+	}
+}
+
+func TestSplitFieldAssignment(t *testing.T) {
+	name, value, err := splitFieldAssignment("url=https://example.com/?a=b")
+	if err != nil || name != "url" || value != "https://example.com/?a=b" {
+		t.Errorf("Unexpected result: %s %s %v", name, value, err)
+	}
+	for _, arg := range []string{"url", "=value"} {
+		if _, _, err := splitFieldAssignment(arg); err == nil {
+			t.Errorf("Expected '%s' to be rejected", arg)
+		}
+	}
+}
+
+func TestAddFieldValue(t *testing.T) {
+	content := onepass.ItemContent{}
+	addFieldValue(&content, "api key", "abc", true)
+	addFieldValue(&content, "environment", "staging", false)
+	setUrl(&content, "admin", "https://example.com")
+	setUrl(&content, "admin", "https://example.com/admin")
+
+	if len(content.Sections) != 1 || len(content.Sections[0].Fields) != 2 {
+		t.Fatalf("Unexpected sections %v", content.Sections)
+	}
+	fields := content.Sections[0].Fields
+	if fields[0].Kind != "concealed" || fields[0].Title != "api key" || fields[0].Value != "abc" {
+		t.Errorf("Unexpected concealed field %v", fields[0])
+	}
+	if fields[1].Kind != "string" || fields[1].Value != "staging" {
+		t.Errorf("Unexpected field %v", fields[1])
+	}
+	if len(content.Urls) != 1 || content.Urls[0].Url != "https://example.com/admin" {
+		t.Errorf("Unexpected URLs %v", content.Urls)
+	}
+
+	err := setFieldValue(&content, "environment", "production")
+	if err != nil || content.Sections[0].Fields[1].Value != "production" {
+		t.Errorf("Failed to update added field: %v", err)
+	}
+}
+
+func TestRemoveAndRenameFields(t *testing.T) {
+	content := onepass.ItemContent{
+		Sections: []onepass.ItemSection{
+			{Name: "", Title: "", Fields: []onepass.ItemField{
+				{Kind: "string", Name: "env", Title: "environment"},
+				{Kind: "string", Name: "old_key", Title: "old api key"},
+			}},
+			{Name: "legacy", Title: "Legacy", Fields: []onepass.ItemField{
+				{Kind: "string", Name: "host", Title: "legacy host"},
+			}},
+		},
+		FormFields: []onepass.WebFormField{
+			{Name: "user", Designation: "username"},
+		},
+		Urls: []onepass.ItemUrl{{Label: "website", Url: "https://example.com"}},
+	}
+
+	if _, err := matchSingleField(content, "leg"); err == nil {
+		t.Errorf("Expected 'leg' to match both the section and 'legacy host'")
+	}
+	if _, err := matchSingleField(content, "missing"); err == nil {
+		t.Errorf("Expected no match for 'missing'")
+	}
+
+	ref, err := matchSingleField(content, "Legacy")
+	if err != nil || ref.kind != "section" {
+		t.Fatalf("Expected exact match for section: %v %v", ref, err)
+	}
+	removeContentField(&content, ref)
+	if len(content.Sections) != 1 {
+		t.Errorf("Expected section to be removed: %v", content.Sections)
+	}
+
+	ref, err = matchSingleField(content, "old api")
+	if err != nil || ref.kind != "field" {
+		t.Fatalf("Expected partial match for field: %v %v", ref, err)
+	}
+	removeContentField(&content, ref)
+	if len(content.Sections[0].Fields) != 1 || content.Sections[0].Fields[0].Name != "env" {
+		t.Errorf("Unexpected fields after removal: %v", content.Sections[0].Fields)
+	}
+
+	ref, err = matchSingleField(content, "env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	renameContentField(&content, ref, "stage")
+	if content.Sections[0].Fields[0].Title != "stage" || content.Sections[0].Fields[0].Name != "env" {
+		t.Errorf("Unexpected field after rename: %v", content.Sections[0].Fields[0])
+	}
+
+	ref, err = matchSingleField(content, "website")
+	if err != nil || ref.kind != "URL" {
+		t.Fatalf("Expected match for URL: %v %v", ref, err)
+	}
+	renameContentField(&content, ref, "login page")
+	if content.Urls[0].Label != "login page" {
+		t.Errorf("Unexpected URL label '%s'", content.Urls[0].Label)
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// hardenAgentProcess reduces the ways in which keys held by
+// an unlocked agent can be read by other processes.
+//
+// Core dumps are disabled, so that a crash does not write keys to
+// disk, and the process is marked as non-dumpable or denies debugger
+// attachment where the platform supports it, so that other processes
+// running as the same user cannot trivially read its memory.
+func hardenAgentProcess() error {
+	if os.Getuid() != os.Geteuid() || os.Getgid() != os.Getegid() {
+		return errors.New("Refusing to run the agent setuid or setgid")
+	}
+
+	err := syscall.Setrlimit(syscall.RLIMIT_CORE, &syscall.Rlimit{Cur: 0, Max: 0})
+	if err != nil {
+		return err
+	}
+	return denyDebuggers()
+}
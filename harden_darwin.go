@@ -0,0 +1,15 @@
+package main
+
+import "syscall"
+
+// PT_DENY_ATTACH from <sys/ptrace.h>
+const ptDenyAttach = 31
+
+// prevents debuggers from attaching to the process
+func denyDebuggers() error {
+	_, _, errno := syscall.Syscall(syscall.SYS_PTRACE, ptDenyAttach, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
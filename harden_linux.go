@@ -0,0 +1,13 @@
+package main
+
+import "syscall"
+
+// marks the process as non-dumpable, which prevents core dumps and
+// ptrace() attachment by other processes which lack CAP_SYS_PTRACE
+func denyDebuggers() error {
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_DUMPABLE, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
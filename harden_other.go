@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package main
+
+// debugger attachment cannot be prevented on this platform,
+// only core dumps are disabled
+func denyDebuggers() error {
+	return nil
+}
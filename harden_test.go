@@ -0,0 +1,42 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+// set in the environment of the child process in which
+// TestHardenAgentProcess hardens itself
+const hardenTestEnvVar = "ONEPASS_TEST_HARDEN_CHILD"
+
+func TestHardenAgentProcess(t *testing.T) {
+	if os.Getenv(hardenTestEnvVar) != "1" {
+		// hardening cannot be undone, so it is done in a child
+		// process rather than in the process running the other tests
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHardenAgentProcess$")
+		cmd.Env = append(os.Environ(), hardenTestEnvVar+"=1")
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Hardening test process failed: %v\n%s", err, output)
+		}
+		return
+	}
+
+	err := hardenAgentProcess()
+	if err != nil {
+		t.Fatalf("Unable to harden process: %v", err)
+	}
+	var limit syscall.Rlimit
+	err = syscall.Getrlimit(syscall.RLIMIT_CORE, &limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit.Cur != 0 || limit.Max != 0 {
+		t.Errorf("Expected core dumps to be disabled, limit: %+v", limit)
+	}
+}
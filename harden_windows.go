@@ -0,0 +1,8 @@
+package main
+
+// hardenAgentProcess is a no-op on Windows, where core
+// dump limits and debugger restrictions are not available
+// to unprivileged processes
+func hardenAgentProcess() error {
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+// field pattern which refers to the most recently
+// replaced password in an item's history
+const oldPasswordField = "old-password"
+
+func historyHelp() string {
+	return `Lists the passwords which have been replaced in an item by 'set'
+or 'edit', most recent first. The passwords are stored, encrypted, as
+part of the item.
+
+Use 'copy <pattern> old-password' to copy the most recently replaced
+password to the clipboard.
+
+Flags:
+
+  -passwords           Show the previous passwords instead of hiding them.
+  -time-format <fmt>   The format for times, as for 'show'.`
+}
+
+// showPasswordHistory prints the previous passwords of
+// the item matching pattern, most recent first
+func showPasswordHistory(vault *onepass.Vault, pattern string, reveal bool, timeFormat string) {
+	item, err := lookupSingleItem(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Failed to find item")
+	}
+	content, err := item.Content()
+	if err != nil {
+		fatalErr(err, fmt.Sprintf("Failed to decrypt item '%s'", item.Title))
+	}
+	history := content.PasswordHistory
+	if len(history) == 0 {
+		fmt.Fprintf(os.Stderr, "'%s' has no previous passwords\n", item.Title)
+		return
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		value := strings.Repeat("*", 8)
+		if reveal {
+			value = history[i].Value
+		}
+		fmt.Printf("%s %s\n", colorize(colorCyan, formatTime(uint64(history[i].Time), timeFormat)), value)
+	}
+	if reveal {
+		recordItemUse(vault, item)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+// names of the hook scripts run by 1pass
+const (
+	postSaveHook   = "post-save"
+	preRemoveHook  = "pre-remove"
+	postUnlockHook = "post-unlock"
+)
+
+var hookNames = []string{postSaveHook, preRemoveHook, postUnlockHook}
+
+// environment variables passed to hook scripts
+const (
+	hookEnvVar     = "ONEPASS_HOOK"
+	commandEnvVar  = "ONEPASS_COMMAND"
+	itemIdEnvVar   = "ONEPASS_ITEM_UUID"
+	itemTypeEnvVar = "ONEPASS_ITEM_TYPE"
+	itemNameEnvVar = "ONEPASS_ITEM_TITLE"
+)
+
+// variables which hold secrets and are not
+// passed on to hook scripts
+var secretEnvVars = []string{sessionEnvVar, remoteAgentTokenEnvVar, dropboxTokenEnvVar}
+
+func hooksHelp() string {
+	return fmt.Sprintf(`Lists the hook scripts which are installed. Hooks are executables in
+%s which are run when the vault changes:
+
+  %-12s Run after an item is saved, including when it is removed
+  %-12s Run before an item is removed. A non-zero exit status
+               prevents the removal.
+  %-12s Run after the vault is unlocked
+
+Hooks receive the item's ID as their argument and the following
+environment variables. They never receive item content, passwords
+or session tokens.
+
+  %-19s Name of the hook
+  %-19s The 1pass command being run, eg. 'edit'
+  %-19s Path of the vault
+  %-19s ID of the item
+  %-19s Type of the item, eg. 'webforms.WebForm'
+  %-19s Title of the item
+
+The output of hooks is written to stderr.`, userHooksDir(),
+		postSaveHook, preRemoveHook, postUnlockHook,
+		hookEnvVar, commandEnvVar, vaultEnvVar, itemIdEnvVar, itemTypeEnvVar, itemNameEnvVar)
+}
+
+// returns the directory containing user hook scripts
+func userHooksDir() string {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		configDir = homeDir() + "/.config"
+	}
+	return configDir + "/1pass/hooks"
+}
+
+// hookPath returns the path of the named hook in dir, or
+// an empty string if the hook is not installed
+func hookPath(dir string, name string) string {
+	path := dir + "/" + name
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+		return ""
+	}
+	return path
+}
+
+// hookRunner runs the hook scripts in a directory
+// for changes made by a command
+type hookRunner struct {
+	dir       string
+	command   string
+	vaultPath string
+}
+
+// run runs the named hook, if installed, for item or
+// for the vault if item is nil
+func (runner hookRunner) run(name string, item *onepass.Item) error {
+	path := hookPath(runner.dir, name)
+	if path == "" {
+		return nil
+	}
+	vars := map[string]string{
+		hookEnvVar:    name,
+		commandEnvVar: runner.command,
+		vaultEnvVar:   runner.vaultPath,
+	}
+	for _, secretVar := range secretEnvVars {
+		vars[secretVar] = ""
+	}
+	args := []string{}
+	if item != nil {
+		vars[itemIdEnvVar] = item.Uuid
+		vars[itemTypeEnvVar] = item.TypeName
+		vars[itemNameEnvVar] = item.Title
+		args = append(args, item.Uuid)
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = withEnv(os.Environ(), vars)
+	debugf("Running %s hook %s %v", name, path, args)
+	return cmd.Run()
+}
+
+// install sets up the vault to run the post-save and
+// pre-remove hooks when items are changed
+func (runner hookRunner) install(vault *onepass.Vault) {
+	vault.PostSave = func(item onepass.Item) {
+		err := runner.run(postSaveHook, &item)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s hook failed for '%s': %v\n", postSaveHook, item.Title, err)
+		}
+	}
+	vault.PreRemove = func(item onepass.Item) error {
+		err := runner.run(preRemoveHook, &item)
+		if err != nil {
+			return fmt.Errorf("Removal of '%s' rejected by %s hook: %v", item.Title, preRemoveHook, err)
+		}
+		return nil
+	}
+}
+
+// unlocked runs the post-unlock hook
+func (runner hookRunner) unlocked() {
+	err := runner.run(postUnlockHook, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s hook failed: %v\n", postUnlockHook, err)
+	}
+}
+
+func listHooks() {
+	dir := userHooksDir()
+	for _, name := range hookNames {
+		if path := hookPath(dir, name); path != "" {
+			fmt.Printf("%s\t%s\n", name, path)
+		}
+	}
+}
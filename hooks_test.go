@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func TestHooks(t *testing.T) {
+	dir := os.TempDir() + "/1pass-test-hooks"
+	os.RemoveAll(dir)
+	err := os.Mkdir(dir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	outPath := dir + "/hook-output"
+	scripts := map[string]string{
+		postSaveHook:  `echo "$ONEPASS_HOOK $ONEPASS_COMMAND $ONEPASS_ITEM_TYPE $1 session=$ONEPASS_SESSION" >> ` + outPath,
+		preRemoveHook: `test "$ONEPASS_ITEM_TITLE" != "Keep Me"`,
+	}
+	for name, script := range scripts {
+		err = ioutil.WriteFile(dir+"/"+name, []byte("#!/bin/sh\n"+script+"\n"), 0700)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Setenv(sessionEnvVar, "secret-token")
+	defer os.Unsetenv(sessionEnvVar)
+
+	vault := newTestVault(t)
+	err = vault.Unlock(ClientTestPwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooks := hookRunner{dir: dir, command: "add", vaultPath: vault.Path}
+	hooks.install(vault)
+	item, err := vault.AddItem("Keep Me", "securenotes.SecureNote", onepass.ItemContent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := ioutil.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("Expected post-save hook to run: %v", err)
+	}
+	expected := "post-save add securenotes.SecureNote " + item.Uuid + " session=\n"
+	if string(output) != expected {
+		t.Errorf("Expected hook output '%s', got '%s'", expected, output)
+	}
+
+	err = item.Remove()
+	if err == nil || !strings.Contains(err.Error(), preRemoveHook) {
+		t.Errorf("Expected pre-remove hook to reject removal, got: %v", err)
+	}
+	item.Title = "Remove Me"
+	err = item.Save()
+	if err == nil {
+		err = item.Remove()
+	}
+	if err != nil {
+		t.Errorf("Expected removal to succeed: %v", err)
+	}
+
+	// hooks which are not executable are not run
+	os.Chmod(dir+"/"+preRemoveHook, 0600)
+	if hookPath(dir, preRemoveHook) != "" || hookPath(dir, postUnlockHook) != "" {
+		t.Errorf("Expected only executable hooks to be found")
+	}
+	if err = hooks.run(postUnlockHook, nil); err != nil {
+		t.Errorf("Expected missing hook to be ignored: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+const identityType = "identities.Identity"
+
+// kinds of identity field which may be added more
+// than once with different labels, eg. 'work address'
+var labeledFieldKinds = []string{"address", "phone"}
+
+// parseBirthDate parses a birth date in one of the formats accepted
+// for 'date' fields and returns the timestamp stored in the field.
+// Two-digit years are not accepted since most birth dates would
+// then be ambiguous.
+func parseBirthDate(str string, now time.Time) (int64, error) {
+	date, err := onepass.ParseDate(str)
+	if err != nil {
+		return 0, err
+	}
+	if date.After(now) {
+		return 0, fmt.Errorf("'%s' is in the future", str)
+	}
+	return date.Unix(), nil
+}
+
+// labeledField returns an empty field of the given kind for an
+// identity's address section with a label such as 'work'
+func labeledField(kind string, label string) onepass.ItemField {
+	label = strings.TrimSpace(label)
+	name := kind + "_" + strings.Replace(strings.ToLower(label), " ", "_", -1)
+	title := label
+	if kind == "address" {
+		title = label + " address"
+	}
+	return onepass.ItemField{
+		Name:  name,
+		Title: title,
+		Kind:  kind,
+	}
+}
+
+// identityFieldForTitle returns a new field for an identity item
+// with the given title. Titles ending with 'address' or 'phone'
+// create labeled fields of that kind, others create string fields.
+func identityFieldForTitle(title string) onepass.ItemField {
+	for _, kind := range labeledFieldKinds {
+		label := strings.TrimSpace(strings.TrimSuffix(title, " "+kind))
+		if label != title && label != "" {
+			return labeledField(kind, label)
+		}
+	}
+	return onepass.ItemField{
+		Name:  title,
+		Kind:  "string",
+		Title: title,
+	}
+}
+
+// addLabeledField appends field to section unless the
+// section already has a field with the same name or title
+func addLabeledField(section *onepass.ItemSection, field onepass.ItemField) error {
+	for _, existing := range section.Fields {
+		if existing.Name == field.Name || existing.Title == field.Title {
+			return fmt.Errorf("There is already a '%s' field", existing.Title)
+		}
+	}
+	section.Fields = append(section.Fields, field)
+	return nil
+}
+
+// readLabeledFields prompts for any number of additional
+// labeled addresses and phone numbers for an identity
+func readLabeledFields(section *onepass.ItemSection) {
+	for _, kind := range labeledFieldKinds {
+		for {
+			label := readLinePrompt("Label for another %s (eg. work, blank to finish)", kind)
+			if label == "" {
+				break
+			}
+			field := labeledField(kind, label)
+			err := addLabeledField(section, field)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				continue
+			}
+			section.Fields[len(section.Fields)-1].Value = readFieldValue(field)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func TestParseBirthDate(t *testing.T) {
+	now := time.Date(2015, 6, 1, 0, 0, 0, 0, time.Local)
+	birthDate := time.Date(1962, 3, 14, 0, 0, 0, 0, time.Local).Unix()
+	for _, str := range []string{"1962-03-14", "14/03/1962"} {
+		date, err := parseBirthDate(str, now)
+		if err != nil {
+			t.Errorf("Failed to parse '%s': %v", str, err)
+		} else if date != birthDate {
+			t.Errorf("Parsed '%s' as %v", str, time.Unix(date, 0))
+		}
+	}
+	for _, str := range []string{"14/03/62", "2020-01-01", "March 1962", ""} {
+		_, err := parseBirthDate(str, now)
+		if err == nil {
+			t.Errorf("Expected '%s' to be rejected", str)
+		}
+	}
+}
+
+func TestIdentityFieldForTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		field onepass.ItemField
+	}{
+		{"work address", onepass.ItemField{Name: "address_work", Title: "work address", Kind: "address"}},
+		{"Holiday Home address", onepass.ItemField{Name: "address_holiday_home", Title: "Holiday Home address", Kind: "address"}},
+		{"mobile phone", onepass.ItemField{Name: "phone_mobile", Title: "mobile", Kind: "phone"}},
+		{"phone", onepass.ItemField{Name: "phone", Title: "phone", Kind: "string"}},
+		{"nickname", onepass.ItemField{Name: "nickname", Title: "nickname", Kind: "string"}},
+	}
+	for _, test := range tests {
+		field := identityFieldForTitle(test.title)
+		if field != test.field {
+			t.Errorf("Expected %+v for '%s', got %+v", test.field, test.title, field)
+		}
+	}
+}
+
+func TestAddLabeledField(t *testing.T) {
+	template, ok := onepass.StandardTemplate(identityType)
+	if !ok {
+		t.Fatal("Missing identity template")
+	}
+	content, err := copyItemContent(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var section *onepass.ItemSection
+	for i := range content.Sections {
+		if content.Sections[i].Name == "address" {
+			section = &content.Sections[i]
+		}
+	}
+	if section == nil {
+		t.Fatal("Identity template has no address section")
+	}
+	fieldCount := len(section.Fields)
+
+	err = addLabeledField(section, labeledField("address", "work"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = addLabeledField(section, labeledField("phone", "work"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(section.Fields) != fieldCount+2 {
+		t.Errorf("Expected %d fields, found %d", fieldCount+2, len(section.Fields))
+	}
+
+	if addLabeledField(section, labeledField("address", "Work")) == nil {
+		t.Errorf("Expected duplicate address to be rejected")
+	}
+	if addLabeledField(section, labeledField("phone", "home")) == nil {
+		t.Errorf("Expected phone with the same title as a template field to be rejected")
+	}
+}
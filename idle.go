@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+// period without Encrypt() or Decrypt() requests after which the
+// agent encrypts a vault's keys in memory. The keys are decrypted
+// again by the next request.
+var keyIdleWrapDelay = 15 * time.Second
+
+// wrapIdleKeys encrypts the keys for a vault which has not been
+// used for keyIdleWrapDelay, using a wrapping key held in its own
+// locked page, and wipes the plaintext keys. This shortens the
+// time that plaintext keys are in memory while the vault is unlocked.
+func (agent *OnePassAgent) wrapIdleKeys(vaultPath string) {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	data, unlocked := agent.vaults[vaultPath]
+	if !unlocked || data.wrappedKeys != nil {
+		return
+	}
+	if idle := time.Since(data.lastUsed); idle < keyIdleWrapDelay {
+		data.idleTimer.Reset(keyIdleWrapDelay - idle)
+		return
+	}
+
+	wrappingKey := onepass.NewWrappingKey()
+	wrapped, err := onepass.WrapKeys(data.keys, wrappingKey)
+	if err != nil {
+		log.Printf("Unable to encrypt idle keys for '%s': %v", vaultPath, err)
+		onepass.FreeWrappingKey(wrappingKey)
+		return
+	}
+	data.keys.Wipe()
+	data.keys = nil
+	data.wrappedKeys = wrapped
+	data.wrappingKey = wrappingKey
+	agent.vaults[vaultPath] = data
+	debugf("Encrypted idle keys for '%s'", vaultPath)
+}
+
+// unwrapKeys decrypts the keys for a vault if they were encrypted
+// by wrapIdleKeys() and restarts the idle timer. The caller must
+// hold a write lock on agent.mu.
+func (agent *OnePassAgent) unwrapKeys(vaultPath string) error {
+	data, unlocked := agent.vaults[vaultPath]
+	if !unlocked {
+		return nil
+	}
+	if data.wrappedKeys != nil {
+		keys, err := onepass.UnwrapKeys(data.wrappedKeys, data.wrappingKey)
+		if err != nil {
+			return err
+		}
+		data.discardWrappedKeys()
+		data.keys = keys
+		debugf("Decrypted idle keys for '%s'", vaultPath)
+	}
+	data.lastUsed = time.Now()
+	if data.idleTimer != nil {
+		data.idleTimer.Reset(keyIdleWrapDelay)
+	}
+	agent.vaults[vaultPath] = data
+	return nil
+}
+
+// useKeys makes the keys for a vault available before
+// a request which reads them under a read lock
+func (agent *OnePassAgent) useKeys(vaultPath string) error {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+	return agent.unwrapKeys(vaultPath)
+}
+
+// erases the keys encrypted by wrapIdleKeys()
+func (data *vaultData) discardWrappedKeys() {
+	if data.wrappingKey != nil {
+		onepass.FreeWrappingKey(data.wrappingKey)
+		onepass.ZeroBytes(data.wrappedKeys)
+	}
+	data.wrappedKeys = nil
+	data.wrappingKey = nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWrapIdleKeys(t *testing.T) {
+	vault := newTestVault(t)
+	agent := NewAgent()
+	var ok bool
+	err := agent.Unlock(UnlockArgs{VaultPath: vault.Path, MasterPwd: ClientTestPwd, ExpireAfter: time.Minute}, &ok)
+	if err != nil {
+		fatalTestErr(t, "Unable to unlock vault", err)
+	}
+	defer agent.stop(0)
+
+	var encrypted []byte
+	err = agent.Encrypt(CryptArgs{VaultPath: vault.Path, KeyName: "SL5", Data: []byte("data")}, &encrypted)
+	if err != nil {
+		fatalTestErr(t, "Unable to encrypt data", err)
+	}
+
+	// keys are not wrapped while the vault is in use
+	agent.wrapIdleKeys(vault.Path)
+	if agent.vaults[vault.Path].wrappedKeys != nil {
+		t.Errorf("Expected keys of a recently used vault not to be wrapped")
+	}
+
+	data := agent.vaults[vault.Path]
+	data.lastUsed = time.Now().Add(-keyIdleWrapDelay)
+	agent.vaults[vault.Path] = data
+	agent.wrapIdleKeys(vault.Path)
+	data = agent.vaults[vault.Path]
+	if data.wrappedKeys == nil || data.keys != nil {
+		t.Fatalf("Expected keys of an idle vault to be wrapped")
+	}
+
+	var decrypted []byte
+	err = agent.Decrypt(CryptArgs{VaultPath: vault.Path, KeyName: "SL5", Data: encrypted}, &decrypted)
+	if err != nil || string(decrypted) != "data" {
+		t.Errorf("Expected decryption to succeed after keys were wrapped, got %v", err)
+	}
+	if agent.vaults[vault.Path].wrappedKeys != nil {
+		t.Errorf("Expected keys to be unwrapped after use")
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"strings"
+	"sync"
+)
+
+// JSON-RPC 2.0 error codes, see http://www.jsonrpc.org/specification
+const (
+	jsonRPCParseError     = -32700
+	jsonRPCInvalidRequest = -32600
+	jsonRPCMethodNotFound = -32601
+	jsonRPCInvalidParams  = -32602
+
+	// errors returned by the agent's methods, such
+	// as a wrong master password or a locked vault
+	jsonRPCAgentError = -32000
+)
+
+// prefix of the error messages for requests whose
+// params could not be decoded into the method's arguments
+const invalidParamsPrefix = "Invalid params: "
+
+type jsonRPCRequest struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+
+	// ID of the request, or nil for notifications, to
+	// which the agent does not send a response
+	Id json.RawMessage `json:"id"`
+}
+
+type jsonRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type jsonRPCResponse struct {
+	Version string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *jsonRPCError   `json:"error,omitempty"`
+	Id      json.RawMessage `json:"id"`
+}
+
+// jsonRPCServerCodec is an rpc.ServerCodec for the JSON-RPC 2.0
+// protocol which the agent accepts alongside the gob encoding
+// used by 1pass clients. See docs/agent-protocol.md
+type jsonRPCServerCodec struct {
+	decoder *json.Decoder
+	encoder *json.Encoder
+	closer  io.Closer
+
+	// request being read, between the calls to
+	// ReadRequestHeader() and ReadRequestBody()
+	request jsonRPCRequest
+
+	// protects the fields below, which map the sequence
+	// numbers of pending requests to their JSON-RPC IDs
+	mu      sync.Mutex
+	seq     uint64
+	pending map[uint64]json.RawMessage
+	invalid map[uint64]bool
+}
+
+func newJSONRPCServerCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
+	return &jsonRPCServerCodec{
+		decoder: json.NewDecoder(conn),
+		encoder: json.NewEncoder(conn),
+		closer:  conn,
+		pending: map[uint64]json.RawMessage{},
+		invalid: map[uint64]bool{},
+	}
+}
+
+func (codec *jsonRPCServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	codec.request = jsonRPCRequest{}
+	err := codec.decoder.Decode(&codec.request)
+	if err == io.EOF {
+		return err
+	}
+	if err != nil {
+		// the rest of the stream cannot be parsed reliably,
+		// so the connection is closed after the error is sent
+		codec.encoder.Encode(jsonRPCResponse{
+			Version: "2.0",
+			Error:   &jsonRPCError{Code: jsonRPCParseError, Message: "Parse error"},
+			Id:      json.RawMessage("null"),
+		})
+		return err
+	}
+
+	codec.mu.Lock()
+	codec.seq++
+	r.Seq = codec.seq
+	codec.pending[r.Seq] = codec.request.Id
+	if codec.request.Version != "2.0" || codec.request.Method == "" {
+		// an ill-formed method name makes the rpc.Server
+		// reply with an error, which is sent as an
+		// 'Invalid Request' error by WriteResponse()
+		codec.invalid[r.Seq] = true
+		r.ServiceMethod = ""
+	} else {
+		r.ServiceMethod = codec.request.Method
+	}
+	codec.mu.Unlock()
+	return nil
+}
+
+// ReadRequestBody decodes the params of a request into the method's
+// argument. Agent methods take a single argument, which is passed
+// either by-name as a JSON object or as the only element of an array.
+// Params may be omitted for methods whose argument is unused.
+func (codec *jsonRPCServerCodec) ReadRequestBody(x interface{}) error {
+	if x == nil {
+		return nil
+	}
+	params := bytes.TrimSpace(codec.request.Params)
+	if len(params) == 0 || bytes.Equal(params, []byte("null")) {
+		return nil
+	}
+	if params[0] == '[' {
+		var list []json.RawMessage
+		err := json.Unmarshal(params, &list)
+		if err != nil {
+			return errors.New(invalidParamsPrefix + err.Error())
+		}
+		if len(list) > 1 {
+			return errors.New(invalidParamsPrefix + "expected a single argument")
+		}
+		if len(list) == 0 {
+			return nil
+		}
+		params = list[0]
+	}
+	err := json.Unmarshal(params, x)
+	if err != nil {
+		return errors.New(invalidParamsPrefix + err.Error())
+	}
+	return nil
+}
+
+func (codec *jsonRPCServerCodec) WriteResponse(r *rpc.Response, x interface{}) error {
+	codec.mu.Lock()
+	id, ok := codec.pending[r.Seq]
+	invalid := codec.invalid[r.Seq]
+	delete(codec.pending, r.Seq)
+	delete(codec.invalid, r.Seq)
+	codec.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("No pending request for response %d", r.Seq)
+	}
+	if id == nil && !invalid {
+		// notification
+		return nil
+	}
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+
+	response := jsonRPCResponse{Version: "2.0", Id: id}
+	switch {
+	case invalid:
+		response.Error = &jsonRPCError{Code: jsonRPCInvalidRequest, Message: "Invalid Request"}
+	case r.Error == "":
+		response.Result = x
+		if x == nil {
+			response.Result = json.RawMessage("null")
+		}
+	case strings.HasPrefix(r.Error, "rpc: can't find"):
+		response.Error = &jsonRPCError{Code: jsonRPCMethodNotFound, Message: r.Error}
+	case strings.HasPrefix(r.Error, invalidParamsPrefix):
+		response.Error = &jsonRPCError{Code: jsonRPCInvalidParams, Message: r.Error}
+	default:
+		response.Error = &jsonRPCError{Code: jsonRPCAgentError, Message: r.Error}
+	}
+	return codec.encoder.Encode(response)
+}
+
+func (codec *jsonRPCServerCodec) Close() error {
+	return codec.closer.Close()
+}
+
+// bufferedConn is a connection whose first bytes have been
+// read into a buffer to detect the protocol used by the client
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (conn bufferedConn) Read(p []byte) (int, error) {
+	return conn.reader.Read(p)
+}
+
+// serveConn handles requests from a client using either the
+// gob encoding used by 1pass clients or JSON-RPC 2.0. JSON-RPC
+// clients are recognized by their first request starting with '{',
+// which is never the first byte of a gob stream.
+func serveConn(rpcServer *rpc.Server, conn net.Conn) {
+	buffered := bufferedConn{Conn: conn, reader: bufio.NewReader(conn)}
+	start, err := buffered.reader.Peek(1)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	if start[0] == '{' {
+		rpcServer.ServeCodec(newJSONRPCServerCodec(buffered))
+	} else {
+		rpcServer.ServeConn(buffered)
+	}
+}
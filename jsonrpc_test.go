@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+)
+
+type testJSONRPCResponse struct {
+	Version string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *jsonRPCError   `json:"error"`
+	Id      json.RawMessage `json:"id"`
+}
+
+func jsonRPCCall(t *testing.T, conn net.Conn, decoder *json.Decoder, request string) testJSONRPCResponse {
+	_, err := conn.Write([]byte(request))
+	if err != nil {
+		fatalTestErr(t, "Unable to send request", err)
+	}
+	var response testJSONRPCResponse
+	err = decoder.Decode(&response)
+	if err != nil {
+		fatalTestErr(t, "Unable to read response", err)
+	}
+	if response.Version != "2.0" {
+		t.Errorf("Expected JSON-RPC 2.0 response, got %+v", response)
+	}
+	return response
+}
+
+func TestJSONRPC(t *testing.T) {
+	vault := newTestVault(t)
+	setupAgent(t, vault.Path)
+	conn, err := net.Dial("unix", "agent-test.sock")
+	if err != nil {
+		fatalTestErr(t, "Unable to connect to agent", err)
+	}
+	defer conn.Close()
+	decoder := json.NewDecoder(conn)
+
+	response := jsonRPCCall(t, conn, decoder, `{"jsonrpc": "2.0", "method": "OnePassAgent.Info", "id": 1}`)
+	var info AgentInfo
+	err = json.Unmarshal(response.Result, &info)
+	if err != nil || info.ProtocolVersion != agentProtocolVersion {
+		t.Errorf("Unexpected agent info: %s (%v)", response.Result, err)
+	}
+	if string(response.Id) != "1" {
+		t.Errorf("Expected response ID 1, got %s", response.Id)
+	}
+
+	// params are accepted as an object or a single-element array
+	vaultPath, _ := json.Marshal(vault.Path)
+	response = jsonRPCCall(t, conn, decoder, `{"jsonrpc": "2.0", "method": "OnePassAgent.Unlock",
+		"params": [{"VaultPath": `+string(vaultPath)+`, "MasterPwd": "`+ClientTestPwd+`", "ExpireAfter": 60000000000}], "id": "unlock"}`)
+	if response.Error != nil || string(response.Result) != "true" {
+		t.Fatalf("Unable to unlock vault: %+v", response.Error)
+	}
+	response = jsonRPCCall(t, conn, decoder, `{"jsonrpc": "2.0", "method": "OnePassAgent.IsLocked",
+		"params": {"vaultPath": `+string(vaultPath)+`}, "id": 2}`)
+	if string(response.Result) != "false" {
+		t.Errorf("Expected vault to be unlocked, got %s", response.Result)
+	}
+
+	// binary data is base64-encoded
+	response = jsonRPCCall(t, conn, decoder, `{"jsonrpc": "2.0", "method": "OnePassAgent.Encrypt",
+		"params": {"VaultPath": `+string(vaultPath)+`, "KeyName": "SL5", "Data": "c2VjcmV0"}, "id": 3}`)
+	if response.Error != nil {
+		t.Fatalf("Unable to encrypt data: %+v", response.Error)
+	}
+	response = jsonRPCCall(t, conn, decoder, `{"jsonrpc": "2.0", "method": "OnePassAgent.Decrypt",
+		"params": {"VaultPath": `+string(vaultPath)+`, "KeyName": "SL5", "Data": `+string(response.Result)+`}, "id": 4}`)
+	if response.Error != nil || string(response.Result) != `"c2VjcmV0"` {
+		t.Errorf("Unexpected decrypted data: %s (%+v)", response.Result, response.Error)
+	}
+
+	// notifications do not receive a response
+	response = jsonRPCCall(t, conn, decoder, `{"jsonrpc": "2.0", "method": "OnePassAgent.Info"}
+		{"jsonrpc": "2.0", "method": "OnePassAgent.Info", "id": 5}`)
+	if string(response.Id) != "5" {
+		t.Errorf("Expected response to request 5, got %s", response.Id)
+	}
+
+	errorCases := map[string]int{
+		`{"jsonrpc": "2.0", "method": "OnePassAgent.Unknown", "id": 6}`:                               jsonRPCMethodNotFound,
+		`{"jsonrpc": "2.0", "method": "OnePassAgent.IsLocked", "params": [1, 2], "id": 6}`:            jsonRPCInvalidParams,
+		`{"jsonrpc": "2.0", "method": "OnePassAgent.IsLocked", "params": "path", "id": 6}`:            jsonRPCInvalidParams,
+		`{"jsonrpc": "1.0", "method": "OnePassAgent.Info", "id": 6}`:                                  jsonRPCInvalidRequest,
+		`{"jsonrpc": "2.0", "method": "OnePassAgent.Decrypt", "params": {"KeyName": "SL5"}, "id": 6}`: jsonRPCAgentError,
+	}
+	for request, code := range errorCases {
+		response = jsonRPCCall(t, conn, decoder, request)
+		if response.Error == nil || response.Error.Code != code {
+			t.Errorf("Expected error %d for %s, got %+v", code, request, response.Error)
+		}
+		if string(response.Id) != "6" {
+			t.Errorf("Expected error response ID 6, got %s", response.Id)
+		}
+	}
+
+	response = jsonRPCCall(t, conn, decoder, `{"jsonrpc": "2.0", "method"`+"\n}")
+	if response.Error == nil || response.Error.Code != jsonRPCParseError || string(response.Id) != "null" {
+		t.Errorf("Expected parse error, got %+v", response.Error)
+	}
+}
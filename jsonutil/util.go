@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 )
 
 type MarshalFunc func(interface{}) ([]byte, error)
@@ -15,8 +16,49 @@ func MarshalToFile(path string, in interface{}, marshal MarshalFunc) error {
 	if err != nil {
 		return err
 	}
-	err = ioutil.WriteFile(path, data, 0644)
-	return err
+	return WriteFileAtomic(path, data, 0644)
+}
+
+// WriteFileAtomic writes data to a temporary file in the same
+// directory as path, syncs it to disk and then renames it over
+// path, so that a crash part-way through never leaves a
+// truncated file behind
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmpFile, err := ioutil.TempFile(dir, "."+name+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+	_, err = tmpFile.Write(data)
+	if err == nil {
+		err = tmpFile.Chmod(perm)
+	}
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// sync the directory so that the rename itself is durable.
+	// This is not supported on all platforms, so errors are ignored.
+	if dirFile, err := os.Open(dir); err == nil {
+		dirFile.Sync()
+		dirFile.Close()
+	}
+	return nil
 }
 
 func ReadFile(path string, out interface{}) error {
@@ -0,0 +1,65 @@
+package jsonutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "contents.js")
+	err = ioutil.WriteFile(path, []byte(`["old"]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = WriteFile(path, []string{"new"})
+	if err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	var contents []string
+	err = ReadFile(path, &contents)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if len(contents) != 1 || contents[0] != "new" {
+		t.Errorf("Expected [new], got %v", contents)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("Expected mode 0644, got %v", info.Mode().Perm())
+	}
+
+	// the temporary file should have been renamed over the target
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the written file in %s, found %d entries", dir, len(entries))
+	}
+}
+
+func TestWriteFileAtomicMissingDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = WriteFileAtomic(filepath.Join(dir, "missing", "item.1password"), []byte("{}"), 0644)
+	if err == nil {
+		t.Errorf("Expected writing to a missing directory to fail")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	markdownHeadingRe  = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	markdownBulletRe   = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	markdownNumberedRe = regexp.MustCompile(`^(\s*)([0-9]+)[.)]\s+(.*)$`)
+	markdownCodeRe     = regexp.MustCompile("`([^`]+)`")
+	markdownBoldRe     = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+)
+
+// renderMarkdown formats the simple Markdown often used in notes
+// for display in a terminal. Headings and bold text are shown in
+// bold, code spans and code blocks are highlighted and list items
+// are indented with bullets. Other text is left as-is.
+func renderMarkdown(text string) string {
+	lines := strings.Split(text, "\n")
+	inCodeBlock := false
+	rendered := []string{}
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCodeBlock = !inCodeBlock
+			continue
+		}
+		if inCodeBlock {
+			rendered = append(rendered, "    "+colorize(colorCyan, line))
+			continue
+		}
+		if match := markdownHeadingRe.FindStringSubmatch(line); match != nil {
+			heading := match[2]
+			if len(match[1]) == 1 {
+				heading = strings.ToUpper(heading)
+			}
+			rendered = append(rendered, colorize(colorBold, heading))
+			continue
+		}
+		if match := markdownBulletRe.FindStringSubmatch(line); match != nil {
+			line = match[1] + "  • " + match[2]
+		} else if match := markdownNumberedRe.FindStringSubmatch(line); match != nil {
+			line = match[1] + "  " + match[2] + ". " + match[3]
+		}
+		rendered = append(rendered, renderMarkdownSpans(line))
+	}
+	return strings.Join(rendered, "\n")
+}
+
+// renderMarkdownSpans formats code spans and bold
+// text within a line of Markdown
+func renderMarkdownSpans(line string) string {
+	line = markdownCodeRe.ReplaceAllStringFunc(line, func(span string) string {
+		return colorize(colorCyan, span[1:len(span)-1])
+	})
+	return markdownBoldRe.ReplaceAllStringFunc(line, func(span string) string {
+		return colorize(colorBold, span[2:len(span)-2])
+	})
+}
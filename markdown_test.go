@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	defer setColorMode("never")
+	notes := "# Restart\n\n## Steps\n- stop the `web` service\n* run:\n```\nsudo reboot\n```\n2. check **all** hosts"
+
+	setColorMode("never")
+	expected := "RESTART\n\nSteps\n  • stop the web service\n  • run:\n    sudo reboot\n  2. check all hosts"
+	if actual := renderMarkdown(notes); actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+
+	setColorMode("always")
+	expected = colorBold + "RESTART" + colorReset + "\n\n" +
+		colorBold + "Steps" + colorReset + "\n" +
+		"  • stop the " + colorCyan + "web" + colorReset + " service\n" +
+		"  • run:\n" +
+		"    " + colorCyan + "sudo reboot" + colorReset + "\n" +
+		"  2. check " + colorBold + "all" + colorReset + " hosts"
+	if actual := renderMarkdown(notes); actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+}
+
+func TestFormatNotes(t *testing.T) {
+	defer setColorMode("never")
+	setColorMode("never")
+	if notes := formatNotes("line one\n- item\n", false); notes != "  line one\n  - item" {
+		t.Errorf("Unexpected notes %q", notes)
+	}
+	if notes := formatNotes("line one\n- item\n", true); notes != "  line one\n    • item" {
+		t.Errorf("Unexpected rendered notes %q", notes)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+// openMemoryVault returns an unlocked in-memory vault for a
+// 'mem://[export file]' vault path. If an export file is given,
+// its items are copied into the vault. Changes to the vault are
+// lost when the command finishes.
+func openMemoryVault(vaultPath string) onepass.Vault {
+	// the vault only exists for the duration of the command,
+	// so it is protected by a random password
+	pwdBytes := make([]byte, 16)
+	_, err := rand.Read(pwdBytes)
+	if err != nil {
+		fatalErr(err, "Unable to generate in-memory vault password")
+	}
+	pwd := hex.EncodeToString(pwdBytes)
+	vault, err := onepass.NewMemoryVault(pwd)
+	if err == nil {
+		err = vault.Unlock(pwd)
+	}
+	if err != nil {
+		fatalErr(err, "Unable to create in-memory vault")
+	}
+
+	seedPath := strings.TrimPrefix(vaultPath, onepass.MemoryVaultScheme)
+	if seedPath == "" {
+		return vault
+	}
+	var passphrase string
+	items, err := readImportFile(seedPath, "", &passphrase)
+	if err != nil {
+		fatalErr(err, "Unable to read items for in-memory vault")
+	}
+	for _, item := range items {
+		_, err = vault.ImportItem(item)
+		if err != nil {
+			fatalErr(err, fmt.Sprintf("Unable to add item '%s' to in-memory vault", item.Title))
+		}
+	}
+	return vault
+}
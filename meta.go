@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func metaHelp() string {
+	return `Shows or sets the unencrypted metadata stored with an item, which is
+read by 1Password's apps and browser extensions without unlocking
+the vault.
+
+  tags          Comma-separated list of tags
+  scope         'Always' or 'Never'. Items with the 'Never' scope are
+                not offered by browser extensions.
+  faveIndex     Position of the item in the favorites list, or 0 if
+                it is not a favorite
+  usernameHash  Hash of the item's username, set by 1Password's apps
+  expires       Expiry date set with 'set-expiry', as a Unix timestamp
+  urlMatch      'host' if set with 'set-url-match host'
+
+Other keys written by 1Password's apps are listed and preserved when
+the item is changed. Use 'key=' to remove a key.`
+}
+
+// showItemMeta prints the metadata of the item matching pattern
+func showItemMeta(vault *onepass.Vault, pattern string) {
+	item, err := lookupSingleItem(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Failed to find item")
+	}
+	meta := item.Meta()
+	for _, key := range item.MetaKeys() {
+		fmt.Printf("%s %s\n", colorize(colorCyan, key+":"), meta[key])
+	}
+}
+
+// setItemMeta sets metadata of the item matching pattern from
+// 'key=value' arguments
+func setItemMeta(vault *onepass.Vault, pattern string, assignments []string) {
+	item, err := lookupSingleItem(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Failed to find item")
+	}
+	undo := newUndoRecorder(vault, "meta")
+	undo.snapshot(item)
+	for _, arg := range assignments {
+		key, value, err := splitFieldAssignment(arg)
+		if err == nil {
+			err = item.SetMeta(key, value)
+		}
+		if err != nil {
+			fatalErr(err, "")
+		}
+	}
+	err = item.Save()
+	if err != nil {
+		fatalErr(err, "Unable to save updated item")
+	}
+	undo.commit()
+	logItemAction("Updated metadata of item", item)
+}
@@ -0,0 +1,177 @@
+package onepass
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/robertknight/1pass/jsonutil"
+)
+
+// VaultBackend is implemented by the stores which hold a vault's
+// items and encryption keys. Vault uses the backend for reading,
+// saving and removing items and for unlocking the vault, so that
+// code using Vault works unchanged with different stores.
+//
+// The default backend reads and writes an Agile Keychain folder.
+// Operations specific to that format, such as checking the vault's
+// files or managing key backups, are not part of the interface.
+type VaultBackend interface {
+	// ListItems returns all of the items in the store,
+	// including tombstones for removed items
+	ListItems() ([]Item, error)
+
+	// LoadItem returns the item with ID uuid, including
+	// its encrypted content
+	LoadItem(uuid string) (Item, error)
+
+	// SaveItem adds a new item to the store or replaces
+	// an existing item with the same ID
+	SaveItem(item Item) error
+
+	// RemoveItem deletes the item with ID uuid from the store
+	// without leaving a tombstone
+	RemoveItem(uuid string) error
+
+	// UnlockKeys decrypts the keys used to encrypt items with
+	// the master password pwd, as described for UnlockKeys()
+	UnlockKeys(pwd string) (KeyDict, error)
+
+	// SecurityLevels returns the names of the security
+	// levels for which the store has encryption keys
+	SecurityLevels() ([]string, error)
+}
+
+// backend returns the store used by the vault, which
+// defaults to the Agile Keychain folder at vault.Path
+func (vault *Vault) backend() VaultBackend {
+	if vault.Backend != nil {
+		return vault.Backend
+	}
+	return agileKeychain{vault: vault}
+}
+
+// agileKeychain is the VaultBackend for the Agile Keychain format
+// used by 1Password. Each item is stored in a '<ID>.1password' file
+// in the vault's data folder, with a summary of all items in
+// contents.js and the encryption keys in encryptionKeys.js.
+type agileKeychain struct {
+	vault *Vault
+}
+
+func (store agileKeychain) ListItems() ([]Item, error) {
+	items := []Item{}
+	dataDir := store.vault.DataDir()
+	dirEntries, err := ioutil.ReadDir(dataDir)
+	if err != nil {
+		return items, err
+	}
+	for _, item := range dirEntries {
+		if path.Ext(item.Name()) == ".1password" {
+			itemData := Item{}
+			err := jsonutil.ReadFile(dataDir+"/"+item.Name(), &itemData)
+			if err != nil {
+				fmt.Printf("Failed to read item: %s: %v\n", item.Name(), err)
+			} else {
+				items = append(items, itemData)
+			}
+		}
+	}
+	return items, nil
+}
+
+func (store agileKeychain) LoadItem(uuid string) (Item, error) {
+	var item Item
+	err := jsonutil.ReadFile(store.vault.DataDir()+"/"+uuid+".1password", &item)
+	return item, err
+}
+
+func (store agileKeychain) SaveItem(item Item) error {
+	unlock, err := store.vault.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// the document's file is written first so that
+	// the item never refers to a missing file
+	if item.document != nil {
+		err = writeDocumentFile(store.vault.Path, item.Uuid, item.document)
+		if err != nil {
+			return fmt.Errorf("Failed to save document %s: %v", item.Title, err)
+		}
+	}
+
+	// save item to .1password file
+	err = jsonutil.WriteFile(store.vault.DataDir()+"/"+item.Uuid+".1password", item)
+	if err != nil {
+		return fmt.Errorf("Failed to save item %s: %v", item.Title, err)
+	}
+
+	// update contents.js entry
+	return store.vault.updateIndex([]Item{item})
+}
+
+func (store agileKeychain) RemoveItem(uuid string) error {
+	unlock, err := store.vault.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// remove contents.js entry
+	contentsFilePath := store.vault.DataDir() + "/contents.js"
+	var contentsEntries [][]interface{}
+	err = jsonutil.ReadFile(contentsFilePath, &contentsEntries)
+	if err != nil {
+		return fmt.Errorf("Failed to read contents.js: %v", err)
+	}
+
+	foundExisting := false
+	newContentsEntries := [][]interface{}{}
+	for _, entry := range contentsEntries {
+		tmpItem := readContentsEntry(entry)
+		if tmpItem.Uuid == uuid {
+			foundExisting = true
+		} else {
+			newContentsEntries = append(newContentsEntries, entry)
+		}
+	}
+	if !foundExisting {
+		return fmt.Errorf("Entry for item %s not found", uuid)
+	}
+
+	err = jsonutil.WriteFile(contentsFilePath, newContentsEntries)
+	if err != nil {
+		return fmt.Errorf("Failed to update contents.js: %v", err)
+	}
+	markContentsIndexCurrent(store.vault.DataDir())
+
+	// remove .1password data file
+	itemDataFile := store.vault.DataDir() + "/" + uuid + ".1password"
+	err = os.Remove(itemDataFile)
+	if err != nil {
+		return fmt.Errorf("Failed to remove item data file: %s: %v", itemDataFile, err)
+	}
+
+	return nil
+}
+
+func (store agileKeychain) UnlockKeys(pwd string) (KeyDict, error) {
+	return UnlockKeys(store.vault.Path, pwd)
+}
+
+func (store agileKeychain) SecurityLevels() ([]string, error) {
+	var keyList encryptionKeys
+	err := jsonutil.ReadFile(store.vault.DataDir()+"/encryptionKeys.js", &keyList)
+	if err != nil {
+		return nil, errors.New("Failed to read encryption key file")
+	}
+	levels := []string{}
+	for _, entry := range keyList.List {
+		levels = append(levels, entry.Level)
+	}
+	return levels, nil
+}
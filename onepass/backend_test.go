@@ -0,0 +1,95 @@
+package onepass
+
+import (
+	"fmt"
+	"testing"
+)
+
+// mapBackend is a VaultBackend which stores items in a map and
+// delegates unlocking to another vault's backend
+type mapBackend struct {
+	items map[string]Item
+	keys  VaultBackend
+}
+
+func (store mapBackend) ListItems() ([]Item, error) {
+	items := []Item{}
+	for _, item := range store.items {
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (store mapBackend) LoadItem(uuid string) (Item, error) {
+	item, ok := store.items[uuid]
+	if !ok {
+		return Item{}, fmt.Errorf("No item %s", uuid)
+	}
+	return item, nil
+}
+
+func (store mapBackend) SaveItem(item Item) error {
+	store.items[item.Uuid] = item
+	return nil
+}
+
+func (store mapBackend) RemoveItem(uuid string) error {
+	delete(store.items, uuid)
+	return nil
+}
+
+func (store mapBackend) UnlockKeys(pwd string) (KeyDict, error) {
+	return store.keys.UnlockKeys(pwd)
+}
+
+func (store mapBackend) SecurityLevels() ([]string, error) {
+	return store.keys.SecurityLevels()
+}
+
+func TestCustomBackend(t *testing.T) {
+	fileVault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	store := mapBackend{items: map[string]Item{}, keys: fileVault.backend()}
+	vault := Vault{Backend: store}
+	err = vault.Unlock("test-pwd")
+	if err != nil {
+		t.Fatalf("Unlocking vault failed: %v", err)
+	}
+
+	item, err := vault.AddItem("Backend Item", "securenotes.SecureNote", newTestContent("backend.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.items[item.Uuid]; !ok {
+		t.Fatalf("Expected item to be saved to the backend")
+	}
+	fileItems, _ := fileVault.ListItems()
+	if len(fileItems) != 0 {
+		t.Errorf("Expected no items in the vault folder, found %d", len(fileItems))
+	}
+
+	items, err := vault.ListItems()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Title != item.Title {
+		t.Fatalf("Expected to list '%s', got %v", item.Title, items)
+	}
+	content, err := items[0].Content()
+	if err != nil {
+		t.Fatalf("Failed to decrypt item from backend: %v", err)
+	}
+	if content.Urls[0].Url != "backend.com" {
+		t.Errorf("Unexpected item content: %v", content)
+	}
+
+	err = item.removeDataFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.items) != 0 {
+		t.Errorf("Expected item to be removed from the backend")
+	}
+}
@@ -0,0 +1,232 @@
+package onepass
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/robertknight/1pass/jsonutil"
+)
+
+// maximum number of item files written at once by Batch.Commit()
+const maxParallelWrites = 8
+
+// Batch collects new and changed items so that they can be written
+// to the vault together. For Agile Keychain vaults, the item files
+// are written concurrently and contents.js is updated once, which is
+// much faster than saving items one at a time when importing or
+// copying many items. If any item cannot be written, the vault is
+// left as it was before Commit() was called.
+type Batch struct {
+	vault *Vault
+	items []Item
+	ids   map[string]bool
+
+	// finish is called by commitToKeychain() after the items and
+	// contents.js have been written, with the vault still locked.
+	// If it fails, the items and contents.js are restored.
+	finish func() error
+}
+
+// NewBatch returns an empty batch of changes to the vault
+func (vault *Vault) NewBatch() *Batch {
+	return &Batch{vault: vault, ids: map[string]bool{}}
+}
+
+// Len returns the number of items in the batch
+func (batch *Batch) Len() int {
+	return len(batch.items)
+}
+
+// ImportItem adds an item exported from another vault to the batch,
+// in the same way as Vault.ImportItem(). The item is not saved until
+// Commit() is called.
+func (batch *Batch) ImportItem(exported ExportedItem) (Item, error) {
+	if err := batch.vault.checkWritable(); err != nil {
+		return Item{}, err
+	}
+	item, err := batch.vault.prepareImport(exported, batch.ids)
+	if err != nil {
+		return Item{}, err
+	}
+	batch.add(item)
+	return item, nil
+}
+
+// Save adds a new or changed item to the batch.
+// The item is not saved until Commit() is called.
+func (batch *Batch) Save(item Item) error {
+	if err := batch.vault.checkWritable(); err != nil {
+		return err
+	}
+	if len(item.Encrypted) == 0 && item.loadEncrypted() != nil {
+		return fmt.Errorf("Item content not set")
+	}
+	batch.add(item)
+	return nil
+}
+
+func (batch *Batch) add(item Item) {
+	item.UpdatedAt = uint64(time.Now().Unix())
+	if item.CreatedAt == 0 {
+		item.CreatedAt = item.UpdatedAt
+	}
+	if batch.ids[item.Uuid] {
+		// a later change to an item replaces an earlier one
+		for i := range batch.items {
+			if batch.items[i].Uuid == item.Uuid {
+				batch.items[i] = item
+			}
+		}
+		return
+	}
+	batch.ids[item.Uuid] = true
+	batch.items = append(batch.items, item)
+}
+
+// Commit saves the items in the batch to the vault and
+// returns them. The batch is empty afterwards.
+func (batch *Batch) Commit() ([]Item, error) {
+	if err := batch.vault.checkWritable(); err != nil {
+		return nil, err
+	}
+	items := batch.items
+	var err error
+	if batch.vault.Backend != nil {
+		err = batch.commitToBackend()
+	} else {
+		err = batch.commitToKeychain()
+	}
+	if err != nil {
+		return nil, err
+	}
+	batch.items = nil
+	batch.ids = map[string]bool{}
+
+	if batch.vault.PostSave != nil {
+		for _, item := range items {
+			batch.vault.PostSave(item)
+		}
+	}
+	return items, nil
+}
+
+// commitToBackend saves the batch's items one at a time using a
+// custom backend. Items which were saved before an error occurred
+// are not rolled back.
+func (batch *Batch) commitToBackend() error {
+	for _, item := range batch.items {
+		err := batch.vault.Backend.SaveItem(item)
+		if err != nil {
+			return fmt.Errorf("Failed to save item %s: %v", item.Title, err)
+		}
+	}
+	return nil
+}
+
+// commitToKeychain writes the batch's item files concurrently and
+// then updates contents.js, restoring the previous item files and
+// index if any write fails
+func (batch *Batch) commitToKeychain() error {
+	vault := batch.vault
+	unlock, err := vault.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	contentsFilePath := vault.DataDir() + "/contents.js"
+	prevContents, err := ioutil.ReadFile(contentsFilePath)
+	if err != nil {
+		return fmt.Errorf("Failed to read contents.js: %v", err)
+	}
+
+	// the previous content of each item file and the file of
+	// each document item, or nil if the file did not exist
+	prevFiles := make([][]byte, len(batch.items))
+	prevDocuments := make([][]byte, len(batch.items))
+	errs := make([]error, len(batch.items))
+	limit := make(chan bool, maxParallelWrites)
+	var wg sync.WaitGroup
+	for i := range batch.items {
+		wg.Add(1)
+		limit <- true
+		go func(i int) {
+			defer func() {
+				<-limit
+				wg.Done()
+			}()
+			item := batch.items[i]
+			if item.document != nil {
+				prevDocuments[i], _ = ioutil.ReadFile(vault.Path + "/" + DocumentFileName(item.Uuid))
+				err := writeDocumentFile(vault.Path, item.Uuid, item.document)
+				if err != nil {
+					errs[i] = fmt.Errorf("Failed to save document %s: %v", item.Title, err)
+					return
+				}
+			}
+			path := vault.DataDir() + "/" + item.Uuid + ".1password"
+			prevFiles[i], _ = ioutil.ReadFile(path)
+			err := jsonutil.WriteFile(path, item)
+			if err != nil {
+				errs[i] = fmt.Errorf("Failed to save item %s: %v", item.Title, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err = range errs {
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = vault.updateIndex(batch.items)
+		if err == nil && batch.finish != nil {
+			err = batch.finish()
+		}
+		if err != nil {
+			// updateIndex() may have partially rewritten contents.js
+			restoreErr := jsonutil.WriteFileAtomic(contentsFilePath, prevContents, 0644)
+			if restoreErr != nil {
+				DebugLog("Restoring contents.js failed: %v", restoreErr)
+			}
+		}
+	}
+	if err != nil {
+		batch.rollbackFiles(prevFiles, prevDocuments)
+		return err
+	}
+	return nil
+}
+
+// rollbackFiles restores the item and document files written by
+// commitToKeychain() to their previous content, removing those for
+// new items
+func (batch *Batch) rollbackFiles(prevFiles [][]byte, prevDocuments [][]byte) {
+	for i, item := range batch.items {
+		restoreFile(batch.vault.DataDir()+"/"+item.Uuid+".1password", prevFiles[i], 0644)
+		if item.document != nil {
+			restoreFile(batch.vault.Path+"/"+DocumentFileName(item.Uuid), prevDocuments[i], 0600)
+		}
+	}
+}
+
+// restoreFile replaces the file at path with data,
+// or removes it if data is nil
+func restoreFile(path string, data []byte, perm os.FileMode) {
+	var err error
+	if data == nil {
+		err = os.Remove(path)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	} else {
+		err = jsonutil.WriteFileAtomic(path, data, perm)
+	}
+	if err != nil {
+		DebugLog("Restoring %s failed: %v", path, err)
+	}
+}
@@ -0,0 +1,152 @@
+package onepass
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing, err := vault.AddItem("Existing Item", "securenotes.SecureNote", newTestContent("existing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := 0
+	vault.PostSave = func(item Item) { saved++ }
+
+	batch := vault.NewBatch()
+	for i := 0; i < 20; i++ {
+		exported := ExportedItem{
+			Item:           Item{Title: fmt.Sprintf("Item %d", i), TypeName: "webforms.WebForm"},
+			SecureContents: newTestContent(fmt.Sprintf("https://%d.example.com", i)),
+		}
+		if i < 2 {
+			// items in the batch with the same ID are given new IDs
+			exported.Uuid = "0123456789ABCDEF0123456789ABCDEF"
+		}
+		_, err = batch.ImportItem(exported)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	existing.Title = "Renamed Item"
+	err = batch.Save(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is written until the batch is committed
+	items, _ := vault.ListItems()
+	if len(items) != 1 || items[0].Title != "Existing Item" {
+		t.Errorf("Expected vault to be unchanged before commit, got %d items", len(items))
+	}
+	committed, err := batch.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(committed) != 21 || saved != 21 || batch.Len() != 0 {
+		t.Errorf("Expected 21 items to be committed and reported, got %d and %d", len(committed), saved)
+	}
+	items, err = vault.ListItems()
+	if err != nil || len(items) != 21 {
+		t.Fatalf("Expected 21 items after commit, got %d (%v)", len(items), err)
+	}
+	renamed, err := vault.LoadItem(existing.Uuid)
+	if err != nil || renamed.Title != "Renamed Item" {
+		t.Errorf("Expected existing item to be updated: %v", err)
+	}
+	content, err := committed[5].Content()
+	if err != nil || content.Urls[0].Url != "https://5.example.com" {
+		t.Errorf("Unexpected content for imported item: %v, %v", content, err)
+	}
+}
+
+func TestBatchRollback(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing, err := vault.AddItem("Existing Item", "securenotes.SecureNote", newTestContent("existing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contentsPath := vault.DataDir() + "/contents.js"
+	prevContents, _ := ioutil.ReadFile(contentsPath)
+	existingPath := vault.DataDir() + "/" + existing.Uuid + ".1password"
+	prevExisting, _ := ioutil.ReadFile(existingPath)
+
+	// a directory in place of an item's file
+	// prevents the item from being written
+	const blockedId = "0123456789ABCDEF0123456789ABCDEF"
+	err = os.Mkdir(vault.DataDir()+"/"+blockedId+".1password", 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := vault.NewBatch()
+	newItem, err := batch.ImportItem(ExportedItem{
+		Item:           Item{Title: "New Item", TypeName: "webforms.WebForm"},
+		SecureContents: newTestContent("new"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = batch.ImportItem(ExportedItem{
+		Item:           Item{Title: "Blocked Item", TypeName: "webforms.WebForm", Uuid: blockedId},
+		SecureContents: newTestContent("blocked"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing.Title = "Renamed Item"
+	batch.Save(existing)
+
+	_, err = batch.Commit()
+	if err == nil {
+		t.Fatal("Expected commit to fail")
+	}
+	if _, err := os.Stat(vault.DataDir() + "/" + newItem.Uuid + ".1password"); !os.IsNotExist(err) {
+		t.Errorf("Expected file for new item to be removed")
+	}
+	currentExisting, _ := ioutil.ReadFile(existingPath)
+	if string(currentExisting) != string(prevExisting) {
+		t.Errorf("Expected existing item to be restored")
+	}
+	currentContents, _ := ioutil.ReadFile(contentsPath)
+	if string(currentContents) != string(prevContents) {
+		t.Errorf("Expected contents.js to be unchanged")
+	}
+}
+
+func TestBatchFinishFailure(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing, err := vault.AddItem("Existing Item", "securenotes.SecureNote", newTestContent("existing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	existingPath := vault.DataDir() + "/" + existing.Uuid + ".1password"
+	prevExisting, _ := ioutil.ReadFile(existingPath)
+
+	batch := vault.NewBatch()
+	existing.Title = "Renamed Item"
+	batch.Save(existing)
+	batch.finish = func() error {
+		return fmt.Errorf("finish failed")
+	}
+	_, err = batch.Commit()
+	if err == nil {
+		t.Fatal("Expected commit to fail")
+	}
+	currentExisting, _ := ioutil.ReadFile(existingPath)
+	if string(currentExisting) != string(prevExisting) {
+		t.Errorf("Expected existing item to be restored")
+	}
+}
@@ -0,0 +1,97 @@
+package onepass
+
+import (
+	"strings"
+)
+
+// prefixes of card numbers for each card brand, using
+// the values of the 'type' field of credit card items.
+// Ranges of prefixes are expanded by CardBrand().
+var cardBrandPrefixes = []struct {
+	brand    string
+	prefixes []string
+}{
+	{"amex", []string{"34", "37"}},
+	{"diners", []string{"300-305", "36", "38"}},
+	{"discover", []string{"6011", "644-649", "65"}},
+	{"jcb", []string{"3528-3589"}},
+	{"maestro", []string{"50", "56-58", "6304", "6759"}},
+	{"mc", []string{"51-55", "2221-2720"}},
+	{"unionpay", []string{"62"}},
+	{"visa", []string{"4"}},
+}
+
+// NormalizeCardNumber removes spaces and dashes from
+// a credit card number
+func NormalizeCardNumber(number string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(number)
+}
+
+// ValidCardNumber returns true if number, ignoring spaces
+// and dashes, consists of 12-19 digits and passes the Luhn
+// checksum used by payment card numbers
+func ValidCardNumber(number string) bool {
+	number = NormalizeCardNumber(number)
+	if len(number) < 12 || len(number) > 19 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < len(number); i++ {
+		ch := number[len(number)-1-i]
+		if ch < '0' || ch > '9' {
+			return false
+		}
+		digit := int(ch - '0')
+		if i%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
+
+// returns true if number starts with prefix, which is
+// either a number or a range of numbers, eg. '51-55'
+func hasCardPrefix(number string, prefix string) bool {
+	bounds := strings.SplitN(prefix, "-", 2)
+	if len(bounds) == 1 {
+		return strings.HasPrefix(number, prefix)
+	}
+	if len(number) < len(bounds[0]) {
+		return false
+	}
+	start := number[0:len(bounds[0])]
+	return start >= bounds[0] && start <= bounds[1]
+}
+
+// CardBrand returns the brand of a credit card number, using the
+// codes stored in the 'type' field of credit card items, eg. 'visa'
+// or 'mc', or an empty string if the brand is not recognized
+func CardBrand(number string) string {
+	number = NormalizeCardNumber(number)
+	brand := ""
+	longestPrefix := 0
+	for _, entry := range cardBrandPrefixes {
+		for _, prefix := range entry.prefixes {
+			prefixLen := len(strings.SplitN(prefix, "-", 2)[0])
+			if prefixLen > longestPrefix && hasCardPrefix(number, prefix) {
+				brand = entry.brand
+				longestPrefix = prefixLen
+			}
+		}
+	}
+	return brand
+}
+
+// MaskCardNumber replaces all but the last four digits
+// of a card number with '*'
+func MaskCardNumber(number string) string {
+	number = NormalizeCardNumber(number)
+	if len(number) <= 4 {
+		return number
+	}
+	return strings.Repeat("*", len(number)-4) + number[len(number)-4:]
+}
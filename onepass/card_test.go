@@ -0,0 +1,45 @@
+package onepass
+
+import (
+	"testing"
+)
+
+func TestValidCardNumber(t *testing.T) {
+	valid := []string{"4111111111111111", "4111 1111 1111 1111", "378282246310005", "5555-5555-5555-4444"}
+	for _, number := range valid {
+		if !ValidCardNumber(number) {
+			t.Errorf("Expected %s to be valid", number)
+		}
+	}
+	invalid := []string{"4111111111111112", "1234", "4111x11111111111", ""}
+	for _, number := range invalid {
+		if ValidCardNumber(number) {
+			t.Errorf("Expected %s to be invalid", number)
+		}
+	}
+}
+
+func TestCardBrand(t *testing.T) {
+	brands := map[string]string{
+		"4111111111111111": "visa",
+		"378282246310005":  "amex",
+		"5555555555554444": "mc",
+		"2223003122003222": "mc",
+		"6011111111111117": "discover",
+		"3530111333300000": "jcb",
+		"30569309025904":   "diners",
+		"6200000000000005": "unionpay",
+		"9999999999999999": "",
+	}
+	for number, brand := range brands {
+		if actual := CardBrand(number); actual != brand {
+			t.Errorf("Expected brand '%s' for %s, got '%s'", brand, number, actual)
+		}
+	}
+}
+
+func TestMaskCardNumber(t *testing.T) {
+	if masked := MaskCardNumber("4111 1111 1111 1234"); masked != "************1234" {
+		t.Errorf("Unexpected masked number '%s'", masked)
+	}
+}
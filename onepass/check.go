@@ -0,0 +1,262 @@
+package onepass
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Describes a problem found in a vault by CheckIntegrity()
+type VaultProblem struct {
+	// Path of the file in the vault which has the problem
+	Path string
+
+	// Description of the problem
+	Description string
+
+	// Suggested action to fix the problem
+	Fix string
+}
+
+func (problem VaultProblem) String() string {
+	return fmt.Sprintf("%s: %s", path.Base(problem.Path), problem.Description)
+}
+
+// suggested fix for problems with contents.js
+const reindexFix = "Rebuild contents.js from the item files with 'reindex'"
+
+// vaultChecker accumulates the problems found
+// while checking a vault
+type vaultChecker struct {
+	vault    *Vault
+	problems []VaultProblem
+}
+
+func (checker *vaultChecker) report(path string, fix string, format string, args ...interface{}) {
+	checker.problems = append(checker.problems, VaultProblem{
+		Path:        path,
+		Description: fmt.Sprintf(format, args...),
+		Fix:         fix,
+	})
+}
+
+// CheckIntegrity verifies the consistency of the files in a vault
+// and returns a list of the problems found.
+//
+// The encryption keys in encryptionKeys.js are checked using the
+// master password pwd, the entries in contents.js are compared with
+// the .1password item files and the content of each item is decrypted
+// to verify that it is valid JSON.
+func (vault *Vault) CheckIntegrity(pwd string) []VaultProblem {
+	checker := vaultChecker{vault: vault}
+	keys := checker.checkKeys(pwd)
+	defer keys.Wipe()
+	contents := checker.checkContentsFile()
+	checker.checkItemFiles(contents, keys)
+	return checker.problems
+}
+
+func (checker *vaultChecker) checkKeys(pwd string) KeyDict {
+	keyFilePath := checker.vault.DataDir() + "/encryptionKeys.js"
+	restoreFix := "Restore encryptionKeys.js from a backup or another device"
+
+	data, err := ioutil.ReadFile(keyFilePath)
+	if err != nil {
+		checker.report(keyFilePath, restoreFix, "Unable to read key file: %v", err)
+		return nil
+	}
+	var keyList encryptionKeys
+	err = json.Unmarshal(data, &keyList)
+	if err != nil {
+		checker.report(keyFilePath, restoreFix, "Key file is not valid JSON: %v", err)
+		return nil
+	}
+
+	_, err = os.Stat(checker.vault.DataDir() + "/1password.keys")
+	if err != nil {
+		checker.report(checker.vault.DataDir()+"/1password.keys",
+			"Change the master password with 'set-password' to regenerate the file",
+			"Missing key file used by 1Password for Mac")
+	}
+
+	if len(keyList.List) == 0 {
+		checker.report(keyFilePath, restoreFix, "Key file contains no keys")
+		return nil
+	}
+
+	keys := KeyDict{}
+	keysValid := true
+	foundSL5 := false
+	for _, entry := range keyList.List {
+		if entry.Level == "SL5" {
+			foundSL5 = true
+			if entry.Identifier != keyList.SL5 {
+				checker.report(keyFilePath, restoreFix,
+					"ID of the SL5 key (%s) does not match the 'SL5' entry (%s)", entry.Identifier, keyList.SL5)
+			}
+		}
+		if err := entry.checkFormat(); err != nil {
+			checker.report(keyFilePath, restoreFix, "%s key is invalid: %s", entry.Level, err.(KeyFileError).Problem)
+			keysValid = false
+			continue
+		}
+		salt, encryptedKey, _ := extractSaltAndCipherText(entry.Data)
+		decryptedKey, err := decryptKey([]byte(pwd), encryptedKey, salt, entry.Iterations, entry.Validation)
+		if err != nil {
+			checker.report(keyFilePath,
+				"Check that the master password is correct, otherwise "+restoreFix,
+				"%s key failed validation: %v", entry.Level, err)
+			keysValid = false
+			continue
+		}
+		keys[entry.Level] = decryptedKey
+	}
+	if !foundSL5 {
+		checker.report(keyFilePath, restoreFix, "Key file has no SL5 key")
+	}
+	if !keysValid {
+		// item content cannot be checked if the keys
+		// could not be decrypted
+		return nil
+	}
+
+	return keys
+}
+
+// checks that contents.js can be read and returns a map
+// of item ID -> item metadata for the entries in it
+func (checker *vaultChecker) checkContentsFile() map[string]Item {
+	contentsFilePath := checker.vault.DataDir() + "/contents.js"
+	entries := map[string]Item{}
+
+	data, err := ioutil.ReadFile(contentsFilePath)
+	if err != nil {
+		checker.report(contentsFilePath, reindexFix, "Unable to read contents file: %v", err)
+		return entries
+	}
+	var contentsEntries [][]interface{}
+	err = json.Unmarshal(data, &contentsEntries)
+	if err != nil {
+		checker.report(contentsFilePath, reindexFix, "Contents file is not valid JSON: %v", err)
+		return entries
+	}
+
+	for i, entry := range contentsEntries {
+		item, ok := checkContentsEntry(entry)
+		if !ok {
+			checker.report(contentsFilePath, reindexFix, "Entry %d is malformed: %v", i, entry)
+			continue
+		}
+		if _, exists := entries[item.Uuid]; exists {
+			checker.report(contentsFilePath, reindexFix, "Duplicate entry for item %s", item.Uuid)
+		}
+		entries[item.Uuid] = item
+	}
+	return entries
+}
+
+// type-checked version of readContentsEntry()
+func checkContentsEntry(entry []interface{}) (Item, bool) {
+	if len(entry) < 8 {
+		return Item{}, false
+	}
+	for _, i := range []int{0, 1, 2, 3, 5, 7} {
+		if _, ok := entry[i].(string); !ok {
+			return Item{}, false
+		}
+	}
+	if _, ok := entry[4].(float64); !ok {
+		return Item{}, false
+	}
+	return readContentsEntry(entry), true
+}
+
+func (checker *vaultChecker) checkItemFiles(contents map[string]Item, keys KeyDict) {
+	dataDir := checker.vault.DataDir()
+	dirEntries, err := ioutil.ReadDir(dataDir)
+	if err != nil {
+		checker.report(dataDir, "Check the permissions of the vault folder", "Unable to read vault folder: %v", err)
+		return
+	}
+
+	foundItems := map[string]bool{}
+	for _, dirEntry := range dirEntries {
+		if path.Ext(dirEntry.Name()) != ".1password" {
+			continue
+		}
+		itemPath := dataDir + "/" + dirEntry.Name()
+		uuid := strings.TrimSuffix(dirEntry.Name(), ".1password")
+		foundItems[uuid] = true
+		checker.checkItemFile(itemPath, uuid, contents, keys)
+	}
+
+	missingIds := []string{}
+	for uuid, _ := range contents {
+		if !foundItems[uuid] {
+			missingIds = append(missingIds, uuid)
+		}
+	}
+	sort.Strings(missingIds)
+	for _, uuid := range missingIds {
+		checker.report(dataDir+"/contents.js",
+			"Restore the item file from a backup or remove the entry from contents.js",
+			"Entry for '%s' (%s) has no item file", contents[uuid].Title, uuid)
+	}
+}
+
+func (checker *vaultChecker) checkItemFile(itemPath string, uuid string, contents map[string]Item, keys KeyDict) {
+	restoreFix := "Restore the item from a backup or remove it from the vault"
+
+	data, err := ioutil.ReadFile(itemPath)
+	if err != nil {
+		checker.report(itemPath, restoreFix, "Unable to read item file: %v", err)
+		return
+	}
+	var item Item
+	err = json.Unmarshal(data, &item)
+	if err != nil {
+		checker.report(itemPath, restoreFix, "Item file is not valid JSON: %v", err)
+		return
+	}
+
+	if item.Uuid != uuid {
+		checker.report(itemPath, "Rename the file to match the item's ID",
+			"Item ID '%s' does not match the file name", item.Uuid)
+	}
+
+	entry, ok := contents[uuid]
+	if !ok {
+		checker.report(itemPath, reindexFix,
+			"Item '%s' is missing from contents.js", item.Title)
+	} else if entry.Title != item.Title || entry.TypeName != item.TypeName ||
+		entry.Trashed != item.Trashed || entry.FolderUuid != item.FolderUuid {
+		checker.report(itemPath, reindexFix,
+			"Entry for '%s' in contents.js is out of date", item.Title)
+	}
+
+	if item.TypeName == "system.Tombstone" || keys == nil {
+		return
+	}
+	if _, ok := ItemTypes[item.TypeName]; !ok {
+		checker.report(itemPath, "", "Item '%s' has unknown type '%s'", item.Title, item.TypeName)
+	}
+	key, ok := keys[item.SecurityLevel]
+	if !ok {
+		checker.report(itemPath, restoreFix, "Item '%s' uses unknown key '%s'", item.Title, item.SecurityLevel)
+		return
+	}
+	content, err := DecryptItemData(key, item.Encrypted)
+	if err != nil {
+		checker.report(itemPath, restoreFix, "Unable to decrypt item '%s': %v", item.Title, err)
+		return
+	}
+	var unused interface{}
+	err = json.Unmarshal(content, &unused)
+	if err != nil {
+		checker.report(itemPath, restoreFix, "Decrypted content of item '%s' is not valid JSON", item.Title)
+	}
+}
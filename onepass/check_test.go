@@ -0,0 +1,51 @@
+package onepass
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	item, err := vault.AddItem("Check Item", "securenotes.SecureNote", newTestContent("check.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems := vault.CheckIntegrity("test-pwd")
+	if len(problems) != 0 {
+		t.Errorf("Unexpected problems in new vault: %v", problems)
+	}
+
+	problems = vault.CheckIntegrity("wrong-pwd")
+	if len(problems) != 1 || !strings.Contains(problems[0].Description, "failed validation") {
+		t.Errorf("Expected key validation failure, got: %v", problems)
+	}
+
+	// add an item file which is not listed in contents.js
+	orphanPath := vault.DataDir() + "/ORPHAN.1password"
+	err = ioutil.WriteFile(orphanPath, []byte("{not json"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems = vault.CheckIntegrity("test-pwd")
+	if len(problems) != 1 || !strings.Contains(problems[0].Description, "not valid JSON") {
+		t.Errorf("Expected unparsable item, got: %v", problems)
+	}
+	os.Remove(orphanPath)
+
+	// remove an item file which is listed in contents.js
+	err = os.Remove(item.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems = vault.CheckIntegrity("test-pwd")
+	if len(problems) != 1 || !strings.Contains(problems[0].Description, "has no item file") {
+		t.Errorf("Expected missing item file, got: %v", problems)
+	}
+}
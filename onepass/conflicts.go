@@ -0,0 +1,85 @@
+package onepass
+
+import (
+	"fmt"
+	"time"
+)
+
+// ItemConflict is a revision of an item which conflicted with
+// the current revision when the vault was synced.
+//
+// The content of the conflicting revision remains encrypted
+// with the vault's keys.
+type ItemConflict struct {
+	Title         string `json:"title"`
+	TypeName      string `json:"typeName"`
+	SecurityLevel string `json:"securityLevel"`
+	Encrypted     []byte `json:"encrypted"`
+	FolderUuid    string `json:"folderUuid"`
+	Trashed       bool   `json:"trashed"`
+
+	// UNIX timestamp of the last modification
+	// of the conflicting revision
+	UpdatedAt uint64 `json:"updatedAt"`
+
+	// UNIX timestamp of when the conflict was found
+	FoundAt uint64 `json:"foundAt"`
+
+	// Description of where the conflicting revision
+	// came from, eg. the sync remote
+	Source string `json:"source"`
+}
+
+// AddConflict stores other as a conflicting revision of the item,
+// together with any unresolved conflicts that other has,
+// and saves the item.
+func (item *Item) AddConflict(other Item, source string) error {
+	item.Conflicts = append(item.Conflicts, other.Conflicts...)
+	item.Conflicts = append(item.Conflicts, ItemConflict{
+		Title:         other.Title,
+		TypeName:      other.TypeName,
+		SecurityLevel: other.SecurityLevel,
+		Encrypted:     other.Encrypted,
+		FolderUuid:    other.FolderUuid,
+		Trashed:       other.Trashed,
+		UpdatedAt:     other.UpdatedAt,
+		FoundAt:       uint64(time.Now().Unix()),
+		Source:        source,
+	})
+	return item.Save()
+}
+
+// ConflictContent decrypts and returns the content of
+// the conflicting revision at index i in item.Conflicts
+func (item *Item) ConflictContent(i int) (ItemContent, error) {
+	if i < 0 || i >= len(item.Conflicts) {
+		return ItemContent{}, fmt.Errorf("No such conflict: %d", i)
+	}
+	conflict := item.Conflicts[i]
+	revision := Item{
+		Title:         conflict.Title,
+		TypeName:      conflict.TypeName,
+		SecurityLevel: conflict.SecurityLevel,
+		Encrypted:     conflict.Encrypted,
+		vault:         item.vault,
+	}
+	return revision.Content()
+}
+
+// ResolveConflicts discards the item's conflicting revisions and
+// saves the item. If keep is a valid index in item.Conflicts,
+// the conflicting revision at that index replaces the current
+// revision, otherwise the current revision is kept.
+func (item *Item) ResolveConflicts(keep int) error {
+	if keep >= 0 && keep < len(item.Conflicts) {
+		conflict := item.Conflicts[keep]
+		item.Title = conflict.Title
+		item.TypeName = conflict.TypeName
+		item.SecurityLevel = conflict.SecurityLevel
+		item.Encrypted = conflict.Encrypted
+		item.FolderUuid = conflict.FolderUuid
+		item.Trashed = conflict.Trashed
+	}
+	item.Conflicts = nil
+	return item.Save()
+}
@@ -0,0 +1,56 @@
+package onepass
+
+import (
+	"runtime"
+	"sync"
+)
+
+// DecryptParallelism is the default number of items which
+// DecryptItems() decrypts concurrently
+var DecryptParallelism = runtime.NumCPU()
+
+// DecryptedItem is the result of decrypting
+// an item with DecryptItems()
+type DecryptedItem struct {
+	Item    Item
+	Content ItemContent
+	Err     error
+}
+
+// DecryptItems decrypts the content of items using up to
+// parallelism concurrent workers and returns the results in
+// the same order as items. If parallelism is less than 1,
+// DecryptParallelism is used.
+//
+// Failure to decrypt an item is reported in the Err field
+// of its result and does not affect other items.
+func DecryptItems(items []Item, parallelism int) []DecryptedItem {
+	if parallelism < 1 {
+		parallelism = DecryptParallelism
+	}
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	results := make([]DecryptedItem, len(items))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < parallelism && worker < len(items); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				result := &results[i]
+				result.Item = items[i]
+				result.Content, result.Err = result.Item.Content()
+			}
+		}()
+	}
+	for i := range items {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
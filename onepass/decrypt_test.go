@@ -0,0 +1,45 @@
+package onepass
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDecryptItems(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	items := []Item{}
+	for i := 0; i < 10; i++ {
+		item, err := vault.AddItem(fmt.Sprintf("Item %d", i), "securenotes.SecureNote", ItemContent{Notes: fmt.Sprintf("note %d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+	items[3].Encrypted = []byte("invalid")
+
+	for _, parallelism := range []int{0, 1, 4, 20} {
+		results := DecryptItems(items, parallelism)
+		if len(results) != len(items) {
+			t.Fatalf("Expected %d results, got %d", len(items), len(results))
+		}
+		for i, result := range results {
+			if result.Item.Uuid != items[i].Uuid {
+				t.Errorf("Result %d is for the wrong item", i)
+			}
+			if i == 3 {
+				if result.Err == nil {
+					t.Errorf("Expected decrypting invalid item to fail")
+				}
+				continue
+			}
+			if result.Err != nil {
+				t.Errorf("Failed to decrypt item %d: %v", i, result.Err)
+			} else if result.Content.Notes != fmt.Sprintf("note %d", i) {
+				t.Errorf("Unexpected content for item %d: %s", i, result.Content.Notes)
+			}
+		}
+	}
+}
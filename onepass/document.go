@@ -0,0 +1,224 @@
+package onepass
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/robertknight/1pass/jsonutil"
+)
+
+// DocumentType is the type of items which store an encrypted file
+const DocumentType = "documents.Document"
+
+// MaxDocumentSize is the largest file which can be stored in
+// a document item
+const MaxDocumentSize = 10 * 1024 * 1024
+
+// name of the section in a document item's content which
+// describes the stored file
+const documentSectionName = "document"
+
+// DocumentInfo describes the file stored in a document item
+type DocumentInfo struct {
+	FileName string
+	Size     int
+	// hex-encoded SHA-256 hash of the file's contents
+	Sha256 string
+}
+
+// DocumentFileName returns the path, relative to the vault's folder,
+// of the file holding the encrypted contents of the document item
+// with ID uuid
+func DocumentFileName(uuid string) string {
+	return "a/default/" + uuid
+}
+
+// returns the path of the file holding the encrypted
+// contents of a document item
+func (item *Item) documentPath() string {
+	return item.vault.Path + "/" + DocumentFileName(item.Uuid)
+}
+
+// documentFile returns the encrypted contents of
+// the file stored in a document item
+func (item *Item) documentFile() ([]byte, error) {
+	return ioutil.ReadFile(item.documentPath())
+}
+
+// documentFilePath returns the path of the file holding the encrypted
+// contents of the document item uuid in the vault at vaultPath. The ID
+// is checked so that the path cannot refer to a file outside the vault.
+func documentFilePath(vaultPath string, uuid string) (string, error) {
+	if !IsValidItemId(uuid) {
+		return "", fmt.Errorf("Invalid item ID '%s'", uuid)
+	}
+	path := filepath.Join(vaultPath, filepath.FromSlash(DocumentFileName(uuid)))
+	relPath, err := filepath.Rel(vaultPath, path)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("The file for document %s is outside the vault", uuid)
+	}
+	return path, nil
+}
+
+// DocumentPath returns the path of the file holding the
+// encrypted contents of the document item with ID uuid
+func (vault *Vault) DocumentPath(uuid string) (string, error) {
+	return documentFilePath(vault.Path, uuid)
+}
+
+// WriteDocumentFile replaces the file for the document item with ID
+// uuid with data, the encrypted file from another copy of the vault
+func (vault *Vault) WriteDocumentFile(uuid string, data []byte) error {
+	if err := vault.checkWritable(); err != nil {
+		return err
+	}
+	unlock, err := vault.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return writeDocumentFile(vault.Path, uuid, data)
+}
+
+// writeDocumentFile saves the encrypted contents of the file
+// for the document item uuid in the vault at vaultPath
+func writeDocumentFile(vaultPath string, uuid string, encrypted []byte) error {
+	path, err := documentFilePath(vaultPath, uuid)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	return jsonutil.WriteFileAtomic(path, encrypted, 0600)
+}
+
+// SnapshotItem loads the item with ID uuid, including the file
+// stored in a document item, so that the item can be restored
+// in full with Journal.Record() and Journal.Undo()
+func (vault *Vault) SnapshotItem(uuid string) (Item, error) {
+	item, err := vault.LoadItem(uuid)
+	if err != nil {
+		return Item{}, err
+	}
+	if item.TypeName == DocumentType {
+		item.document, err = item.documentFile()
+		if err != nil && !os.IsNotExist(err) {
+			return Item{}, err
+		}
+	}
+	return item, nil
+}
+
+// AddDocument adds a document item to the vault which stores data,
+// encrypted with the key for the vault's SL5 security level.
+// fileName is the name of the original file.
+func (vault *Vault) AddDocument(title string, fileName string, data []byte) (Item, error) {
+	if err := vault.checkWritable(); err != nil {
+		return Item{}, err
+	}
+	if vault.Backend != nil {
+		return Item{}, errors.New("Documents can only be added to Agile Keychain vaults")
+	}
+	if len(data) > MaxDocumentSize {
+		return Item{}, fmt.Errorf("Documents must be smaller than %d MB", MaxDocumentSize/(1024*1024))
+	}
+	if vault.IsLocked() {
+		return Item{}, errors.New("Vault is locked")
+	}
+	item := Item{
+		Title:         title,
+		SecurityLevel: "SL5",
+		Encrypted:     []byte{},
+		TypeName:      DocumentType,
+		Uuid:          newItemId(),
+		vault:         vault,
+	}
+
+	var err error
+	item.document, err = vault.CryptoAgent.Encrypt(item.SecurityLevel, data)
+	if err != nil {
+		return Item{}, fmt.Errorf("Failed to encrypt document: %v", err)
+	}
+
+	hash := sha256.Sum256(data)
+	content := ItemContent{
+		Sections: []ItemSection{{
+			Name:  documentSectionName,
+			Title: "Document",
+			Fields: []ItemField{
+				{Kind: "string", Name: "filename", Title: "file name", Value: filepath.Base(fileName)},
+				{Kind: "string", Name: "size", Title: "size", Value: strconv.Itoa(len(data))},
+				{Kind: "string", Name: "sha256", Title: "SHA-256", Value: hex.EncodeToString(hash[:])},
+			},
+		}},
+	}
+	err = item.SetContent(content)
+	if err == nil {
+		err = item.Save()
+	}
+	if err != nil {
+		os.Remove(item.documentPath())
+		return Item{}, err
+	}
+	return item, nil
+}
+
+// DocumentInfo returns the description of the file
+// stored in a document item
+func (item *Item) DocumentInfo() (DocumentInfo, error) {
+	if item.TypeName != DocumentType {
+		return DocumentInfo{}, fmt.Errorf("'%s' is not a document", item.Title)
+	}
+	content, err := item.Content()
+	if err != nil {
+		return DocumentInfo{}, err
+	}
+	var info DocumentInfo
+	for _, section := range content.Sections {
+		if section.Name != documentSectionName {
+			continue
+		}
+		for _, field := range section.Fields {
+			switch field.Name {
+			case "filename":
+				info.FileName = field.ValueString()
+			case "size":
+				info.Size, _ = strconv.Atoi(field.ValueString())
+			case "sha256":
+				info.Sha256 = field.ValueString()
+			}
+		}
+	}
+	return info, nil
+}
+
+// DocumentData decrypts and returns the file stored in a document
+// item, after checking that it has not been modified
+func (item *Item) DocumentData() ([]byte, error) {
+	info, err := item.DocumentInfo()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := item.documentFile()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read document: %v", err)
+	}
+	data, err := item.vault.CryptoAgent.Decrypt(item.SecurityLevel, encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decrypt document: %v", err)
+	}
+	hash := sha256.Sum256(data)
+	if hex.EncodeToString(hash[:]) != info.Sha256 {
+		return nil, errors.New("Document does not match its checksum")
+	}
+	return data, nil
+}
@@ -0,0 +1,209 @@
+package onepass
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDocument(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	data := []byte("secret document contents")
+	item, err := vault.AddDocument("Doc", "/path/to/secret.txt", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the file must be stored encrypted
+	encrypted, err := ioutil.ReadFile(item.documentPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(encrypted, data) {
+		t.Errorf("Document is not encrypted")
+	}
+
+	loaded, err := vault.LoadItem(item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := loaded.DocumentInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.FileName != "secret.txt" || info.Size != len(data) {
+		t.Errorf("Unexpected document info %+v", info)
+	}
+	decrypted, err := loaded.DocumentData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, data) {
+		t.Errorf("Unexpected document data '%s'", decrypted)
+	}
+
+	// modified documents are rejected
+	otherEncrypted, _ := vault.CryptoAgent.Encrypt("SL5", []byte("other contents"))
+	ioutil.WriteFile(item.documentPath(), otherEncrypted, 0600)
+	_, err = loaded.DocumentData()
+	if err == nil {
+		t.Errorf("Expected modified document to be rejected")
+	}
+
+	// removing the item removes the stored file
+	err = loaded.Remove()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(item.documentPath()); !os.IsNotExist(err) {
+		t.Errorf("Document file was not removed")
+	}
+
+	_, err = vault.AddDocument("Large", "large.bin", make([]byte, MaxDocumentSize+1))
+	if err == nil {
+		t.Errorf("Expected large document to be rejected")
+	}
+}
+
+func TestDocumentReEncrypt(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	data := []byte("re-encrypted document")
+	item, err := vault.AddDocument("Doc", "doc.txt", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = vault.ReEncrypt("test-pwd", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := vault.LoadItem(item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := loaded.DocumentData()
+	if err != nil || !bytes.Equal(decrypted, data) {
+		t.Errorf("Unable to read document after re-encrypting: '%s' (%v)", decrypted, err)
+	}
+}
+
+func TestDocumentUndoRemove(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	data := []byte("removed document")
+	item, err := vault.AddDocument("Doc", "doc.txt", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := vault.SnapshotItem(item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = item.Remove()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journalPath := os.TempDir() + "/1pass-test-document-journal"
+	os.Remove(journalPath)
+	defer os.Remove(journalPath)
+	journal, err := OpenJournal(&vault, journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = journal.Record("remove", []Item{snapshot}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal, err = OpenJournal(&vault, journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = journal.Undo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := vault.LoadItem(item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := restored.DocumentData()
+	if err != nil || !bytes.Equal(decrypted, data) {
+		t.Errorf("Unable to read document after undo: '%s' (%v)", decrypted, err)
+	}
+}
+
+func TestDocumentExportImport(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	data := []byte("exported document")
+	item, err := vault.AddDocument("Doc", "doc.txt", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported, err := exportedItems([]Item{item})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 1 || !bytes.Equal(exported[0].Document, data) {
+		t.Fatalf("Expected document to be exported")
+	}
+
+	// importing into the same vault gives the copy a new ID
+	imported, err := vault.ImportItem(exported[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Uuid == item.Uuid {
+		t.Fatalf("Expected imported document to have a new ID")
+	}
+	decrypted, err := imported.DocumentData()
+	if err != nil || !bytes.Equal(decrypted, data) {
+		t.Errorf("Unable to read imported document: '%s' (%v)", decrypted, err)
+	}
+
+	// documents cannot be imported without their file
+	exported[0].Document = nil
+	_, err = vault.ImportItem(exported[0])
+	if err == nil {
+		t.Errorf("Expected document without a file to be rejected")
+	}
+}
+
+func TestDocumentPathOutsideVault(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	for _, uuid := range []string{"../../../../tmp/escape", "AB", ""} {
+		if _, err := vault.DocumentPath(uuid); err == nil {
+			t.Errorf("Expected document path for '%s' to be rejected", uuid)
+		}
+		if err := vault.WriteDocumentFile(uuid, []byte("data")); err == nil {
+			t.Errorf("Expected document file for '%s' not to be written", uuid)
+		}
+	}
+	uuid := newItemId()
+	path, err := vault.DocumentPath(uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = vault.WriteDocumentFile(uuid, []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil || string(data) != "data" {
+		t.Errorf("Unable to read document file: '%s' (%v)", data, err)
+	}
+}
@@ -0,0 +1,135 @@
+package onepass
+
+import (
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// VaultEventType identifies the kind of change
+// reported by a VaultEvent
+type VaultEventType string
+
+const (
+	ItemAdded   VaultEventType = "item-added"
+	ItemUpdated VaultEventType = "item-updated"
+	ItemRemoved VaultEventType = "item-removed"
+
+	// the vault's encryption keys were replaced, eg. because
+	// the master password was changed on another device
+	KeysChanged VaultEventType = "keys-changed"
+)
+
+// VaultEvent describes a change to a vault
+type VaultEvent struct {
+	Type VaultEventType
+
+	// the item which changed, without its encrypted content.
+	// For removed items, this is the last known state of the
+	// item. Empty for KeysChanged events.
+	Item Item
+}
+
+// Subscription reports changes to a vault's items and keys
+// made by this or other processes, such as a sync client
+type Subscription struct {
+	// Events receives changes to the vault. The channel
+	// is closed when the subscription is closed.
+	Events chan VaultEvent
+
+	vault     *Vault
+	watcher   *VaultWatcher
+	known     map[string]Item
+	done      chan bool
+	closeOnce sync.Once
+}
+
+// Subscribe starts reporting changes to the vault's items and keys.
+// This lists the vault's items, which can take a while for large
+// vaults. The subscription must be closed with Close() when no
+// longer needed.
+func (vault *Vault) Subscribe() (*Subscription, error) {
+	watcher, err := vault.Watch()
+	if err != nil {
+		return nil, err
+	}
+	items, err := vault.ListItems()
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	sub := &Subscription{
+		Events:  make(chan VaultEvent),
+		vault:   vault,
+		watcher: watcher,
+		known:   map[string]Item{},
+		done:    make(chan bool),
+	}
+	for _, item := range items {
+		sub.known[item.Uuid] = item
+	}
+	go sub.reportChanges()
+	return sub, nil
+}
+
+// Close stops reporting changes to the vault
+func (sub *Subscription) Close() {
+	sub.closeOnce.Do(func() {
+		close(sub.done)
+		sub.watcher.Close()
+	})
+}
+
+func (sub *Subscription) reportChanges() {
+	defer close(sub.Events)
+	for changes := range sub.watcher.Changes {
+		for _, name := range changes {
+			event, changed := sub.changeEvent(name)
+			if !changed {
+				continue
+			}
+			select {
+			case sub.Events <- event:
+			case <-sub.done:
+				return
+			}
+		}
+	}
+}
+
+// changeEvent returns the event for a change to the file
+// called name in the vault's data folder, or false if the
+// change does not affect the vault's keys or items
+func (sub *Subscription) changeEvent(name string) (VaultEvent, bool) {
+	if name == "encryptionKeys.js" {
+		return VaultEvent{Type: KeysChanged}, true
+	}
+	if path.Ext(name) != ".1password" {
+		return VaultEvent{}, false
+	}
+
+	uuid := strings.TrimSuffix(name, ".1password")
+	prevItem, known := sub.known[uuid]
+	item, err := sub.vault.LoadItem(uuid)
+	if os.IsNotExist(err) || (err == nil && item.TypeName == "system.Tombstone") {
+		if !known {
+			return VaultEvent{}, false
+		}
+		delete(sub.known, uuid)
+		return VaultEvent{Type: ItemRemoved, Item: prevItem}, true
+	} else if err != nil {
+		// the file may still be being written, in which
+		// case a further change will be reported
+		return VaultEvent{}, false
+	}
+
+	item.Encrypted = nil
+	sub.known[uuid] = item
+	if !known {
+		return VaultEvent{Type: ItemAdded, Item: item}, true
+	} else if item.UpdatedAt != prevItem.UpdatedAt || item.Title != prevItem.Title {
+		return VaultEvent{Type: ItemUpdated, Item: item}, true
+	}
+	return VaultEvent{}, false
+}
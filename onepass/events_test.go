@@ -0,0 +1,68 @@
+package onepass
+
+import (
+	"testing"
+	"time"
+)
+
+func expectEvent(t *testing.T, sub *Subscription, eventType VaultEventType, title string) {
+	select {
+	case event := <-sub.Events:
+		if event.Type != eventType || event.Item.Title != title {
+			t.Errorf("Expected %s event for '%s', got %s for '%s'", eventType, title, event.Type, event.Item.Title)
+		}
+		if event.Item.Encrypted != nil {
+			t.Errorf("Expected event not to include encrypted content")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected %s event for '%s'", eventType, title)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	existing, err := vault.AddItem("Existing", "securenotes.SecureNote", newTestContent("existing.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := vault.Subscribe()
+	if err != nil {
+		t.Fatalf("Unable to subscribe to vault: %v", err)
+	}
+	defer sub.Close()
+
+	_, err = vault.AddItem("New Item", "securenotes.SecureNote", newTestContent("new.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, sub, ItemAdded, "New Item")
+
+	// UpdatedAt has a resolution of one second
+	time.Sleep(time.Second)
+	existing.Title = "Renamed"
+	err = existing.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, sub, ItemUpdated, "Renamed")
+
+	err = existing.Remove()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, sub, ItemRemoved, "Renamed")
+
+	sub.Close()
+	select {
+	case _, ok := <-sub.Events:
+		if ok {
+			t.Errorf("Unexpected event after subscription was closed")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Events channel was not closed")
+	}
+}
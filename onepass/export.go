@@ -1,6 +1,8 @@
 package onepass
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,7 +11,7 @@ import (
 	"regexp"
 	"strings"
 
-	uuid "github.com/nu7hatch/gouuid"
+	"code.google.com/p/go.crypto/scrypt"
 )
 
 // Item type used by the '1Password Interchange Format' (.1pif)
@@ -17,41 +19,44 @@ import (
 type ExportedItem struct {
 	Item
 	SecureContents ItemContent `json:"secureContents"`
+
+	// Decrypted contents of the file stored in a document item
+	Document []byte `json:"document,omitempty"`
 }
 
+// Separator which follows each item in a .1pif file.
+// 1Password apps use this fixed UUID for all exports.
+const pifItemSeparator = "***5642bee8-a5ff-11dc-8314-0800200c9a66***"
+
+// matches the separator between items when reading .1pif files,
+// which may use other UUIDs
+var pifSeparatorRe = regexp.MustCompile("\\s*\\*{3}[0-9a-fA-F\\-]{36}\\*{3}\\s*")
+
+// ExportItems writes the decrypted content of items to a
+// '1Password Interchange Format' directory at path, which can
+// be imported by the official 1Password apps.
 func ExportItems(items []Item, path string) error {
 	if !strings.HasSuffix(path, ".1pif") {
 		return errors.New("Path must have a .1pif suffix")
 	}
 
-	err := os.Mkdir(path, 0775)
+	exported, err := exportedItems(items)
 	if err != nil {
-		return fmt.Errorf("unable to create export dir '%s': %v", path, err)
+		return err
 	}
 
-	exportUuid, err := uuid.NewV4()
+	err = os.Mkdir(path, 0775)
 	if err != nil {
-		return err
+		return fmt.Errorf("unable to create export dir '%s': %v", path, err)
 	}
 
 	exportData := ""
-	for i, item := range items {
-		content, err := item.Content()
-		if err != nil {
-			return err
-		}
-		item.Encrypted = nil
-		exported := ExportedItem{
-			item, content,
-		}
-		exportedJson, err := json.Marshal(exported)
+	for _, item := range exported {
+		exportedJson, err := json.Marshal(item)
 		if err != nil {
 			return err
 		}
-		if i > 0 {
-			exportData += "\n"
-		}
-		exportData += fmt.Sprintf("%s\n***%s***", string(exportedJson), exportUuid.String())
+		exportData += fmt.Sprintf("%s\n%s\n", string(exportedJson), pifItemSeparator)
 	}
 	err = ioutil.WriteFile(path+"/data.1pif", []byte(exportData), 0644)
 	if err != nil {
@@ -77,16 +82,19 @@ func ImportItems(path string) ([]ExportedItem, error) {
 	if err != nil {
 		return []ExportedItem{}, err
 	}
+	return readPifItems(pifData)
+}
 
-	re := regexp.MustCompile("\\s*\\*{3}[0-9a-f\\-]{36}\\*{3}\\s*")
-	itemData := re.Split(string(pifData), -1)
+// readPifItems parses the contents of a .1pif data file
+func readPifItems(pifData []byte) ([]ExportedItem, error) {
+	itemData := pifSeparatorRe.Split(string(pifData), -1)
 	items := []ExportedItem{}
 	for _, itemJson := range itemData {
-		if len(itemJson) == 0 {
+		if len(strings.TrimSpace(itemJson)) == 0 {
 			continue
 		}
 		var item ExportedItem
-		err = json.Unmarshal([]byte(itemJson), &item)
+		err := json.Unmarshal([]byte(itemJson), &item)
 		if err != nil {
 			return []ExportedItem{}, err
 		}
@@ -94,3 +102,184 @@ func ImportItems(path string) ([]ExportedItem, error) {
 	}
 	return items, nil
 }
+
+// format identifier for passphrase-protected export files
+const encryptedExportFormat = "1pass-encrypted-export"
+
+// Parameters for the scrypt key derivation function used to
+// derive keys for passphrase-protected data
+const (
+	scryptN      = 32768
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+)
+
+// Largest scrypt parameters accepted when decrypting passphrase-
+// protected data, which may come from someone else. The memory
+// needed to derive a key is 128 * N * r * p bytes, so without
+// limits a crafted file could exhaust the available memory.
+const (
+	maxScryptN  = 1 << 20
+	maxScryptRP = 32
+)
+
+// Data encrypted with a passphrase using scrypt and AES-GCM
+type passphraseEncrypted struct {
+	Format string `json:"format"`
+
+	// scrypt parameters used to derive the key
+	// from the passphrase
+	N    int    `json:"N"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt []byte `json:"salt"`
+
+	// AES-GCM nonce and encrypted data
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+func passphraseCipher(passphrase string, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(aesCipher)
+}
+
+// encrypts data with a key derived from passphrase
+func encryptWithPassphrase(format string, passphrase string, data []byte) (passphraseEncrypted, error) {
+	salt := randomBytes(16)
+	gcm, err := passphraseCipher(passphrase, salt, scryptN, scryptR, scryptP)
+	if err != nil {
+		return passphraseEncrypted{}, err
+	}
+	nonce := randomBytes(gcm.NonceSize())
+	return passphraseEncrypted{
+		Format: format,
+		N:      scryptN,
+		R:      scryptR,
+		P:      scryptP,
+		Salt:   salt,
+		Nonce:  nonce,
+		Data:   gcm.Seal(nil, nonce, data, []byte(format)),
+	}, nil
+}
+
+// decrypts data encrypted with encryptWithPassphrase(). Returns
+// a DecryptError if the passphrase is incorrect.
+func decryptWithPassphrase(format string, passphrase string, encrypted passphraseEncrypted) ([]byte, error) {
+	if encrypted.Format != format {
+		return nil, fmt.Errorf("Unexpected data format '%s'", encrypted.Format)
+	}
+	if encrypted.N > maxScryptN || encrypted.R <= 0 || encrypted.P <= 0 ||
+		encrypted.R*encrypted.P > maxScryptRP {
+		return nil, fmt.Errorf("Unsupported key derivation parameters (N=%d, r=%d, p=%d)",
+			encrypted.N, encrypted.R, encrypted.P)
+	}
+	gcm, err := passphraseCipher(passphrase, encrypted.Salt, encrypted.N, encrypted.R, encrypted.P)
+	if err != nil {
+		return nil, err
+	}
+	if len(encrypted.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("Invalid nonce length")
+	}
+	data, err := gcm.Open(nil, encrypted.Nonce, encrypted.Data, []byte(format))
+	if err != nil {
+		return nil, DecryptError{err: errors.New("Incorrect passphrase or corrupted data")}
+	}
+	return data, nil
+}
+
+func exportedItems(items []Item) ([]ExportedItem, error) {
+	exported := []ExportedItem{}
+	for _, decrypted := range DecryptItems(items, 0) {
+		if decrypted.Err != nil {
+			return nil, decrypted.Err
+		}
+		item := decrypted.Item
+		item.Encrypted = nil
+		var document []byte
+		if item.TypeName == DocumentType {
+			var err error
+			document, err = item.DocumentData()
+			if err != nil {
+				return nil, fmt.Errorf("Unable to export '%s': %v", item.Title, err)
+			}
+		}
+		exported = append(exported, ExportedItem{item, decrypted.Content, document})
+	}
+	return exported, nil
+}
+
+// ExportEncryptedItems writes items to a single file at path which
+// is encrypted with a key derived from passphrase, so that the
+// exported data is never stored on disk unencrypted.
+func ExportEncryptedItems(items []Item, path string, passphrase string) error {
+	exported, err := exportedItems(items)
+	if err != nil {
+		return err
+	}
+	exportJson, err := json.Marshal(exported)
+	if err != nil {
+		return err
+	}
+	encrypted, err := encryptWithPassphrase(encryptedExportFormat, passphrase, exportJson)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(encrypted)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(data)
+	return err
+}
+
+// IsEncryptedExport returns true if path is a file created
+// by ExportEncryptedItems()
+func IsEncryptedExport(path string) bool {
+	var encrypted passphraseEncrypted
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	err = json.Unmarshal(data, &encrypted)
+	return err == nil && encrypted.Format == encryptedExportFormat
+}
+
+// ImportEncryptedItems reads the items from a file created by
+// ExportEncryptedItems(). Returns a DecryptError if the passphrase
+// is incorrect.
+func ImportEncryptedItems(path string, passphrase string) ([]ExportedItem, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []ExportedItem{}, err
+	}
+	var encrypted passphraseEncrypted
+	err = json.Unmarshal(data, &encrypted)
+	if err != nil {
+		return []ExportedItem{}, fmt.Errorf("Unable to read encrypted export: %v", err)
+	}
+	exportJson, err := decryptWithPassphrase(encryptedExportFormat, passphrase, encrypted)
+	if err != nil {
+		return []ExportedItem{}, err
+	}
+	items := []ExportedItem{}
+	err = json.Unmarshal(exportJson, &items)
+	if err != nil {
+		return []ExportedItem{}, err
+	}
+	return items, nil
+}
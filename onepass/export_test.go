@@ -0,0 +1,178 @@
+package onepass
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedExportImport(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	content := newTestContent("export.com")
+	item, err := vault.AddItem("Export Item", "securenotes.SecureNote", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := os.TempDir() + "/1pass-encrypted-export"
+	os.Remove(path)
+	defer os.Remove(path)
+
+	err = ExportEncryptedItems([]Item{item}, path, "export-pwd")
+	if err != nil {
+		t.Fatalf("Failed to export items: %v", err)
+	}
+	if !IsEncryptedExport(path) {
+		t.Errorf("Export was not recognized as encrypted")
+	}
+
+	_, err = ImportEncryptedItems(path, "wrong-pwd")
+	if _, ok := err.(DecryptError); !ok {
+		t.Errorf("Expected DecryptError for wrong passphrase, got %v", err)
+	}
+
+	items, err := ImportEncryptedItems(path, "export-pwd")
+	if err != nil {
+		t.Fatalf("Failed to import items: %v", err)
+	}
+	if len(items) != 1 || items[0].Title != item.Title {
+		t.Fatalf("Unexpected imported items: %v", items)
+	}
+	if !reflect.DeepEqual(items[0].SecureContents, content) {
+		t.Errorf("Imported content mismatch. Actual: %s, expected: %s", items[0].SecureContents, content)
+	}
+}
+
+func TestPifExportImport(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	content := newTestContent("pif.com")
+	item, err := vault.AddItem("Pif Item", "securenotes.SecureNote", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item.OpenContents.Tags = []string{"exported"}
+	err = item.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := os.TempDir() + "/1pass-export-test.1pif"
+	os.RemoveAll(path)
+	defer os.RemoveAll(path)
+
+	err = ExportItems([]Item{item}, path)
+	if err != nil {
+		t.Fatalf("Failed to export items: %v", err)
+	}
+	data, err := ioutil.ReadFile(path + "/data.1pif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), pifItemSeparator+"\n") {
+		t.Errorf("Export is not terminated by the 1PIF separator")
+	}
+	if strings.Contains(string(data), `"encrypted"`) {
+		t.Errorf("Export contains encrypted item data")
+	}
+
+	items, err := ImportItems(path)
+	if err != nil {
+		t.Fatalf("Failed to import items: %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("Expected 1 imported item, got %d", len(items))
+	}
+	detected, err := ImportItemsFrom(path, "")
+	if err != nil || len(detected) != 1 {
+		t.Errorf("Failed to detect 1PIF format: %v", err)
+	}
+
+	// re-importing into the same vault should assign a new ID
+	imported, err := vault.ImportItem(items[0])
+	if err != nil {
+		t.Fatalf("Failed to add imported item: %v", err)
+	}
+	if imported.Uuid == item.Uuid {
+		t.Errorf("Imported item re-used the ID of an existing item")
+	}
+	if !reflect.DeepEqual(imported.OpenContents.Tags, item.OpenContents.Tags) {
+		t.Errorf("Imported item tags mismatch: %v", imported.OpenContents.Tags)
+	}
+	importedContent, err := imported.Content()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(importedContent, content) {
+		t.Errorf("Imported content mismatch. Actual: %s, expected: %s", importedContent, content)
+	}
+}
+
+func TestPassphraseScryptLimits(t *testing.T) {
+	encrypted, err := encryptWithPassphrase(encryptedExportFormat, "passphrase", []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, params := range [][3]int{{1 << 30, 8, 1}, {32768, 8, 16}, {32768, 0, 1}} {
+		tampered := encrypted
+		tampered.N, tampered.R, tampered.P = params[0], params[1], params[2]
+		_, err = decryptWithPassphrase(encryptedExportFormat, "passphrase", tampered)
+		if err == nil || !strings.Contains(err.Error(), "Unsupported key derivation parameters") {
+			t.Errorf("Expected parameters %v to be rejected, got %v", params, err)
+		}
+	}
+
+	// shared items are checked in the same way
+	tampered := encrypted
+	tampered.Format = sharedItemFormat
+	tampered.N = 1 << 30
+	data, _ := json.Marshal(tampered)
+	_, err = ReceiveItem(SharedItemPrefix+base64.URLEncoding.EncodeToString(data), "passphrase")
+	if err == nil || !strings.Contains(err.Error(), "Unsupported key derivation parameters") {
+		t.Errorf("Expected shared item with large N to be rejected, got %v", err)
+	}
+}
+
+func TestImportItemIds(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	existing, err := vault.AddItem("Existing", "securenotes.SecureNote", ItemContent{Notes: "existing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	validId := newItemId()
+	for _, uuid := range []string{"AB", "../" + validId[3:], existing.Uuid, validId} {
+		imported, err := vault.ImportItem(ExportedItem{
+			Item: Item{
+				Title:     "Imported",
+				TypeName:  "securenotes.SecureNote",
+				Uuid:      uuid,
+				Conflicts: []ItemConflict{{Title: "Other Vault Revision"}},
+			},
+			SecureContents: ItemContent{Notes: "imported"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsValidItemId(imported.Uuid) {
+			t.Errorf("Expected imported item with ID '%s' to get a valid ID, got '%s'", uuid, imported.Uuid)
+		}
+		if (uuid == validId) != (imported.Uuid == uuid) {
+			t.Errorf("Unexpected ID '%s' for imported item with ID '%s'", imported.Uuid, uuid)
+		}
+		if len(imported.Conflicts) != 0 {
+			t.Errorf("Expected conflicts not to be imported, got %v", imported.Conflicts)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package onepass
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// format in which values of 'date' fields are entered and displayed
+const DateFormat = "2006-01-02"
+
+// formats accepted for 'date' fields
+var dateInputFormats = []string{DateFormat, "02/01/2006"}
+
+// formats accepted for 'monthYear' fields
+var monthYearInputFormats = []string{"01/2006", "01/06", "2006-01"}
+
+var phoneNumberRe = regexp.MustCompile(`^\+?[0-9 ()./-]*[0-9][0-9 ()./-]*(\s*(x|ext\.?)\s*[0-9]+)?$`)
+
+// choices for 'menu' and 'gender' fields in the standard
+// templates, by field name, as stored by 1Password
+var menuOptions = map[string][]string{
+	"sex":           {"female", "male"},
+	"accountType":   {"checking", "savings", "loc", "amt", "money_market", "other"},
+	"database_type": {"db2", "filemaker", "msaccess", "mssql", "mysql", "oracle", "postgresql", "sqlite", "other"},
+}
+
+// MenuOptions returns the values which a 'menu', 'gender' or
+// 'cctype' field may have or nil if any value is accepted
+func MenuOptions(field ItemField) []string {
+	switch field.Kind {
+	case "cctype":
+		brands := []string{}
+		for _, brand := range cardBrandPrefixes {
+			brands = append(brands, brand.brand)
+		}
+		return brands
+	case "menu", "gender":
+		return menuOptions[field.Name]
+	}
+	return nil
+}
+
+// ParseDate parses the value of a 'date' field, which is
+// either in YYYY-MM-DD or DD/MM/YYYY format
+func ParseDate(str string) (time.Time, error) {
+	for _, format := range dateInputFormats {
+		date, err := time.ParseInLocation(format, str, time.Local)
+		if err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("'%s' is not in the format YYYY-MM-DD", str)
+}
+
+// ParseMonthYear parses the value of a 'monthYear' field in
+// MM/YYYY, MM/YY or YYYY-MM format and returns it encoded as
+// an int with the digits YYYYMM
+func ParseMonthYear(str string) (int, error) {
+	for _, format := range monthYearInputFormats {
+		date, err := time.Parse(format, str)
+		if err == nil {
+			return date.Year()*100 + int(date.Month()), nil
+		}
+	}
+	return 0, fmt.Errorf("'%s' is not in the format MM/YYYY", str)
+}
+
+// ValidPhoneNumber returns true if number consists of digits
+// and the punctuation used in phone numbers, with an optional
+// leading '+' and trailing extension such as 'x123'
+func ValidPhoneNumber(number string) bool {
+	return phoneNumberRe.MatchString(strings.TrimSpace(number))
+}
+
+// ParseFieldValue converts a string entered by the user to the
+// value stored for field, checking that it is valid for the
+// field's kind
+func ParseFieldValue(field ItemField, str string) (interface{}, error) {
+	if options := MenuOptions(field); options != nil {
+		value := strings.ToLower(str)
+		for _, option := range options {
+			if value == option {
+				return option, nil
+			}
+		}
+		return nil, fmt.Errorf("'%s' is not a valid %s. Use one of: %s",
+			str, field.Title, strings.Join(options, ", "))
+	}
+	return FieldValueFromString(field.Kind, str)
+}
+
+// FieldFormat returns a description of the values which
+// may be entered for a field, for use in prompts
+func FieldFormat(field ItemField) string {
+	if options := MenuOptions(field); options != nil {
+		return strings.Join(options, "|")
+	}
+	switch field.Kind {
+	case "date":
+		return "YYYY-MM-DD"
+	case "monthYear":
+		return "MM/YYYY"
+	case "phone":
+		return "phone number"
+	}
+	return field.Kind
+}
+
+// numericFieldValue returns the value of a 'date' or 'monthYear'
+// field, which is a float64 if the item was read from the vault
+// or an int or int64 if it was set by FieldValueFromString()
+func numericFieldValue(value interface{}) (int64, bool) {
+	switch number := value.(type) {
+	case float64:
+		return int64(number), true
+	case int:
+		return int64(number), true
+	case int64:
+		return number, true
+	}
+	return 0, false
+}
@@ -0,0 +1,90 @@
+package onepass
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDateField(t *testing.T) {
+	expected := time.Date(2014, 3, 9, 0, 0, 0, 0, time.Local).Unix()
+	for _, str := range []string{"2014-03-09", "09/03/2014"} {
+		value, err := FieldValueFromString("date", str)
+		if err != nil {
+			t.Errorf("Failed to parse '%s': %v", str, err)
+		} else if value != expected {
+			t.Errorf("Expected %d for '%s', got %v", expected, str, value)
+		}
+	}
+	for _, str := range []string{"09/03/14", "2014-13-01", "yesterday"} {
+		if _, err := FieldValueFromString("date", str); err == nil {
+			t.Errorf("Expected '%s' to be rejected", str)
+		}
+	}
+
+	field := ItemField{Kind: "date", Value: float64(expected)}
+	if str := field.ValueString(); str != "2014-03-09" {
+		t.Errorf("Unexpected date '%s'", str)
+	}
+	field.Value = expected
+	if str := field.ValueString(); str != "2014-03-09" {
+		t.Errorf("Unexpected date '%s' for unsaved value", str)
+	}
+}
+
+func TestMonthYearField(t *testing.T) {
+	for _, str := range []string{"04/2027", "04/27", "2027-04"} {
+		value, err := FieldValueFromString("monthYear", str)
+		if err != nil {
+			t.Errorf("Failed to parse '%s': %v", str, err)
+		} else if value != 202704 {
+			t.Errorf("Expected 202704 for '%s', got %v", str, value)
+		}
+	}
+	for _, str := range []string{"13/2027", "2027", "April"} {
+		if _, err := FieldValueFromString("monthYear", str); err == nil {
+			t.Errorf("Expected '%s' to be rejected", str)
+		}
+	}
+	field := ItemField{Kind: "monthYear", Value: 202704}
+	if str := field.ValueString(); str != "04/2027" {
+		t.Errorf("Unexpected month and year '%s'", str)
+	}
+}
+
+func TestPhoneField(t *testing.T) {
+	for _, number := range []string{"+44 20 7946 0958", "(555) 010-9999", "555.0100 x12", "0123 ext. 4"} {
+		if !ValidPhoneNumber(number) {
+			t.Errorf("Expected '%s' to be accepted", number)
+		}
+	}
+	for _, number := range []string{"", "call me", "+", "555-0100 x"} {
+		if ValidPhoneNumber(number) {
+			t.Errorf("Expected '%s' to be rejected", number)
+		}
+	}
+}
+
+func TestMenuField(t *testing.T) {
+	sex := ItemField{Kind: "menu", Name: "sex", Title: "sex"}
+	value, err := ParseFieldValue(sex, "Female")
+	if err != nil || value != "female" {
+		t.Errorf("Unexpected value %v, %v", value, err)
+	}
+	if _, err := ParseFieldValue(sex, "unknown"); err == nil {
+		t.Errorf("Expected value not in menu to be rejected")
+	}
+	if format := FieldFormat(sex); format != "female|male" {
+		t.Errorf("Unexpected format '%s'", format)
+	}
+
+	cardType := ItemField{Kind: "cctype", Name: "type", Title: "type"}
+	if _, err := ParseFieldValue(cardType, "visa"); err != nil {
+		t.Errorf("Failed to set card type: %v", err)
+	}
+
+	// menus without known options accept any value
+	other := ItemField{Kind: "menu", Name: "custom", Title: "custom"}
+	if value, err := ParseFieldValue(other, "anything"); err != nil || value != "anything" {
+		t.Errorf("Unexpected value %v, %v", value, err)
+	}
+}
@@ -0,0 +1,68 @@
+package onepass
+
+import (
+	"time"
+)
+
+// PasswordHistoryEntry is a password which was
+// replaced when an item was changed
+type PasswordHistoryEntry struct {
+	Value string `json:"value"`
+
+	// Unix timestamp when the password was replaced
+	Time int64 `json:"time"`
+}
+
+type passwordField struct {
+	key   string
+	value string
+}
+
+// returns the concealed fields and password form
+// fields in content, in the order they appear
+func passwordFields(content ItemContent) []passwordField {
+	fields := []passwordField{}
+	for _, section := range content.Sections {
+		for _, field := range section.Fields {
+			if field.Kind == "concealed" {
+				fields = append(fields, passwordField{section.Name + "." + field.Name, field.ValueString()})
+			}
+		}
+	}
+	for _, field := range content.FormFields {
+		if field.Type == "P" {
+			fields = append(fields, passwordField{"fields." + field.Name, field.Value})
+		}
+	}
+	return fields
+}
+
+// RecordPasswordChanges compares the passwords in content with
+// those in previous, the content before it was changed, and adds
+// any passwords which were replaced or removed to content's
+// password history
+func (content *ItemContent) RecordPasswordChanges(previous ItemContent, when time.Time) {
+	current := map[string]string{}
+	for _, field := range passwordFields(*content) {
+		current[field.key] = field.value
+	}
+	for _, field := range passwordFields(previous) {
+		if field.value == "" || current[field.key] == field.value {
+			continue
+		}
+		content.PasswordHistory = append(content.PasswordHistory, PasswordHistoryEntry{
+			Value: field.value,
+			Time:  when.Unix(),
+		})
+	}
+}
+
+// PreviousPassword returns the most recently replaced
+// password in the item's history or an empty string
+// if it has none
+func (content *ItemContent) PreviousPassword() string {
+	if len(content.PasswordHistory) == 0 {
+		return ""
+	}
+	return content.PasswordHistory[len(content.PasswordHistory)-1].Value
+}
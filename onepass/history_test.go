@@ -0,0 +1,56 @@
+package onepass
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordPasswordChanges(t *testing.T) {
+	previous := ItemContent{
+		Sections: []ItemSection{{
+			Name: "",
+			Fields: []ItemField{
+				{Kind: "concealed", Name: "pin", Value: "1234"},
+				{Kind: "string", Name: "username", Value: "jim"},
+			},
+		}},
+		FormFields: []WebFormField{
+			{Name: "password", Type: "P", Value: "oldpass"},
+			{Name: "username", Type: "T", Value: "jim"},
+		},
+	}
+	content := ItemContent{
+		Sections: []ItemSection{{
+			Name: "",
+			Fields: []ItemField{
+				{Kind: "concealed", Name: "pin", Value: "1234"},
+				{Kind: "string", Name: "username", Value: "bob"},
+			},
+		}},
+		FormFields: []WebFormField{
+			{Name: "password", Type: "P", Value: "newpass"},
+			{Name: "username", Type: "T", Value: "bob"},
+		},
+	}
+	if content.PreviousPassword() != "" {
+		t.Errorf("Expected no previous password")
+	}
+
+	now := time.Unix(1400000000, 0)
+	content.RecordPasswordChanges(previous, now)
+	if len(content.PasswordHistory) != 1 {
+		t.Fatalf("Expected one history entry, got %+v", content.PasswordHistory)
+	}
+	entry := content.PasswordHistory[0]
+	if entry.Value != "oldpass" || entry.Time != now.Unix() {
+		t.Errorf("Unexpected history entry %+v", entry)
+	}
+
+	// removing a concealed field also records its value
+	previous = content
+	content.Sections = []ItemSection{{Fields: previous.Sections[0].Fields[1:]}}
+	content.RecordPasswordChanges(previous, now.Add(time.Hour))
+	if content.PreviousPassword() != "1234" || len(content.PasswordHistory) != 2 {
+		t.Errorf("Unexpected history %+v", content.PasswordHistory)
+	}
+}
@@ -0,0 +1,117 @@
+package onepass
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// how long NextHotpCode() waits for another process to
+// finish updating an item's counter
+const hotpLockTimeout = 5 * time.Second
+
+// lock files older than this are assumed to have been
+// left behind by a process which exited while holding them
+const hotpStaleLockAge = time.Minute
+
+// setUriCounter returns an 'otpauth://hotp/' URI with
+// its 'counter' parameter set to counter
+func setUriCounter(rawUri string, counter uint64) (string, error) {
+	uri, err := url.Parse(rawUri)
+	if err != nil {
+		return "", err
+	}
+	params := uri.Query()
+	params.Set("counter", strconv.FormatUint(counter, 10))
+	uri.RawQuery = params.Encode()
+	return uri.String(), nil
+}
+
+// lockItem creates a lock file for item, waiting for up to
+// hotpLockTimeout if another process holds the lock, and
+// returns a function which releases it
+func lockItem(item Item) (func(), error) {
+	lockPath := item.Path() + ".lock"
+	deadline := time.Now().Add(hotpLockTimeout)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > hotpStaleLockAge {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("Timed out waiting for another process to update '%s'", item.Title)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// NextHotpCode returns the code for the current counter of the
+// counter-based one-time password field named fieldName in the
+// item with ID uuid and saves the item with the counter
+// incremented. The item is locked and re-read from disk while
+// the counter is updated, so that concurrent calls never return
+// the same code.
+func (vault *Vault) NextHotpCode(uuid string, fieldName string) (string, error) {
+	item, err := vault.LoadItem(uuid)
+	if err != nil {
+		return "", err
+	}
+	unlock, err := lockItem(item)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	// reload the item in case another process
+	// changed it before the lock was acquired
+	item, err = vault.LoadItem(uuid)
+	if err != nil {
+		return "", err
+	}
+	content, err := item.Content()
+	if err != nil {
+		return "", err
+	}
+	var field *ItemField
+	for i, section := range content.Sections {
+		for k := range section.Fields {
+			if section.Fields[k].Name == fieldName {
+				field = &content.Sections[i].Fields[k]
+			}
+		}
+	}
+	if field == nil {
+		return "", fmt.Errorf("'%s' has no field named '%s'", item.Title, fieldName)
+	}
+	hotp, err := ParseTotp(field.ValueString())
+	if err != nil {
+		return "", err
+	}
+	if !hotp.CounterBased {
+		return "", fmt.Errorf("'%s' is not a counter-based one-time password", field.Title)
+	}
+	code := hotp.Code(time.Now())
+	field.Value, err = setUriCounter(field.ValueString(), hotp.Counter+1)
+	if err != nil {
+		return "", err
+	}
+	err = item.SetContent(content)
+	if err != nil {
+		return "", err
+	}
+	err = item.Save()
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
@@ -0,0 +1,68 @@
+package onepass
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestNextHotpCode(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	content := ItemContent{}
+	AddTotpField(&content, "otpauth://hotp/test?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=0")
+	item, err := vault.AddItem("HOTP", "webforms.WebForm", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fieldName := content.TotpFields()[0].Name
+
+	// codes for counters 0-3 from RFC 4226. Each code must be
+	// returned once when generated concurrently.
+	expected := map[string]bool{"755224": true, "287082": true, "359152": true, "969429": true}
+	codes := make(chan string, len(expected))
+	var wg sync.WaitGroup
+	for i := 0; i < len(expected); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, err := vault.NextHotpCode(item.Uuid, fieldName)
+			if err != nil {
+				t.Error(err)
+			}
+			codes <- code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if !expected[code] {
+			t.Errorf("Unexpected or repeated code '%s'", code)
+		}
+		delete(expected, code)
+	}
+
+	item, err = vault.LoadItem(item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err = item.Content()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hotp, err := ParseTotp(content.TotpFields()[0].ValueString())
+	if err != nil || hotp.Counter != 4 {
+		t.Errorf("Expected counter to be saved as 4, got %+v %v", hotp, err)
+	}
+
+	totpItem := ItemContent{}
+	AddTotpField(&totpItem, "otpauth://totp/test?secret=JBSWY3DPEHPK3PXP")
+	item, err = vault.AddItem("TOTP", "webforms.WebForm", totpItem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = vault.NextHotpCode(item.Uuid, totpItem.TotpFields()[0].Name); err == nil {
+		t.Errorf("Expected time-based password to be rejected")
+	}
+}
@@ -0,0 +1,363 @@
+package onepass
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ImportFormat describes a file format exported by 1Password or
+// another password manager which can be imported into a vault
+type ImportFormat struct {
+	// short name used to select the format, eg. '1pif'
+	Name string
+
+	// name of the application which exports this format
+	Description string
+
+	// Detect returns true if data appears to be in this format
+	Detect func(data []byte) bool
+
+	// Read converts exported data into items
+	Read func(data []byte) ([]ExportedItem, error)
+}
+
+// ImportFormats lists the supported import formats. Formats are
+// tried in order when detecting the format of a file.
+var ImportFormats = []ImportFormat{
+	{
+		Name:        "1pif",
+		Description: "1Password Interchange Format",
+		Detect: func(data []byte) bool {
+			return pifSeparatorRe.Match(data) || isExportedItemJson(data)
+		},
+		Read: readPifItems,
+	},
+	{
+		Name:        "apple",
+		Description: "Safari or iCloud Passwords CSV",
+		Detect: func(data []byte) bool {
+			return csvHasColumns(data, "title", "url", "username", "password", "otpauth")
+		},
+		Read: readAppleCsvItems,
+	},
+	{
+		Name:        "dashlane",
+		Description: "Dashlane credentials CSV",
+		Detect: func(data []byte) bool {
+			return csvHasColumns(data, "username", "username2", "title", "password", "note", "url")
+		},
+		Read: readDashlaneCsvItems,
+	},
+	{
+		Name:        "dashlane-json",
+		Description: "Dashlane JSON",
+		Detect:      isDashlaneJson,
+		Read:        readDashlaneJsonItems,
+	},
+	{
+		Name:        "enpass",
+		Description: "Enpass JSON",
+		Detect:      isEnpassJson,
+		Read:        readEnpassItems,
+	},
+}
+
+// isExportedItemJson returns true if data is a single item
+// in the JSON format used by .1pif files
+func isExportedItemJson(data []byte) bool {
+	var item ExportedItem
+	return json.Unmarshal(data, &item) == nil && item.TypeName != "" && item.Title != ""
+}
+
+// FindImportFormat returns the import format with the given name
+func FindImportFormat(name string) (ImportFormat, error) {
+	names := []string{}
+	for _, format := range ImportFormats {
+		if format.Name == name {
+			return format, nil
+		}
+		names = append(names, format.Name)
+	}
+	return ImportFormat{}, fmt.Errorf("Unknown import format '%s'. Supported formats are: %s",
+		name, strings.Join(names, ", "))
+}
+
+// ImportItemsFrom reads the items from an exported file or .1pif
+// directory at path. If formatName is empty, the format is detected
+// from the file's contents.
+func ImportItemsFrom(path string, formatName string) ([]ExportedItem, error) {
+	pathInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if pathInfo.IsDir() {
+		path += "/data.1pif"
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if formatName != "" {
+		format, err := FindImportFormat(formatName)
+		if err != nil {
+			return nil, err
+		}
+		return format.Read(data)
+	}
+	for _, format := range ImportFormats {
+		if format.Detect(data) {
+			return format.Read(data)
+		}
+	}
+	return nil, fmt.Errorf("Unable to determine the format of '%s'. Use -format to specify it", path)
+}
+
+// NewLoginItem returns a login item with the given content
+// for importing into a vault
+func NewLoginItem(title string, url string, username string, password string, notes string) ExportedItem {
+	content, _ := StandardTemplate("webforms.WebForm")
+	content.FormFields = []WebFormField{
+		{Name: "username", Type: "T", Designation: "username", Value: username},
+		{Name: "password", Type: "P", Designation: "password", Value: password},
+	}
+	content.Urls = []ItemUrl{}
+	if url != "" {
+		content.Urls = append(content.Urls, ItemUrl{Label: "website", Url: url})
+	}
+	content.Sections = []ItemSection{}
+	content.Notes = notes
+	return ExportedItem{
+		Item:           Item{Title: title, TypeName: "webforms.WebForm", Location: url},
+		SecureContents: content,
+	}
+}
+
+// NewSecureNoteItem returns a secure note for importing into a vault
+func NewSecureNoteItem(title string, notes string) ExportedItem {
+	return ExportedItem{
+		Item: Item{Title: title, TypeName: "securenotes.SecureNote"},
+		SecureContents: ItemContent{
+			Sections:   []ItemSection{},
+			Urls:       []ItemUrl{},
+			FormFields: []WebFormField{},
+			Notes:      notes,
+		},
+	}
+}
+
+// CreditCard holds the details of a card exported by
+// another password manager
+type CreditCard struct {
+	Cardholder string
+	Number     string
+	Cvv        string
+	Bank       string
+
+	// expiry month (1-12) and four-digit year
+	ExpiryMonth int
+	ExpiryYear  int
+}
+
+// NewCreditCardItem returns a credit card item for importing into a vault
+func NewCreditCardItem(title string, card CreditCard, notes string) ExportedItem {
+	content, _ := StandardTemplate("wallet.financial.CreditCard")
+	content.Notes = notes
+	setImportedField(&content, "cardholder", card.Cardholder)
+	setImportedField(&content, "ccnum", card.Number)
+	setImportedField(&content, "cvv", card.Cvv)
+	setImportedField(&content, "bank", card.Bank)
+	if card.ExpiryMonth > 0 && card.ExpiryYear > 0 {
+		setImportedField(&content, "expiry", card.ExpiryYear*100+card.ExpiryMonth)
+	}
+	return ExportedItem{
+		Item:           Item{Title: title, TypeName: "wallet.financial.CreditCard"},
+		SecureContents: content,
+	}
+}
+
+// setImportedField sets the value of the field named name
+// in a template's sections
+func setImportedField(content *ItemContent, name string, value interface{}) {
+	if value == "" {
+		return
+	}
+	for i, section := range content.Sections {
+		for k, field := range section.Fields {
+			if field.Name == name {
+				content.Sections[i].Fields[k].Value = value
+				return
+			}
+		}
+	}
+}
+
+// name of the section holding fields from other password
+// managers which do not correspond to a standard field
+const importedSectionName = "importedFields"
+
+// AddImportedField adds a field which has no equivalent in the
+// standard template for an item to an 'Imported fields' section
+func AddImportedField(content *ItemContent, title string, value string, concealed bool) {
+	if value == "" {
+		return
+	}
+	kind := "string"
+	if concealed {
+		kind = "concealed"
+	}
+	field := ItemField{
+		Kind:  kind,
+		Name:  strings.ToLower(hex.EncodeToString(randomBytes(8))),
+		Title: title,
+		Value: value,
+	}
+	for i, section := range content.Sections {
+		if section.Name == importedSectionName {
+			content.Sections[i].Fields = append(content.Sections[i].Fields, field)
+			return
+		}
+	}
+	content.Sections = append(content.Sections, ItemSection{
+		Name:   importedSectionName,
+		Title:  "Imported fields",
+		Fields: []ItemField{field},
+	})
+}
+
+// totpUri returns an 'otpauth://' URI for a one-time password
+// secret, which may already be an 'otpauth://' or 'steam://' URI
+func totpUri(label string, secret string) string {
+	secret = strings.TrimSpace(secret)
+	if strings.HasPrefix(secret, "otpauth://") || strings.HasPrefix(secret, "steam://") {
+		return secret
+	}
+	secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	return fmt.Sprintf("otpauth://totp/%s?secret=%s", url.PathEscape(label), url.QueryEscape(secret))
+}
+
+// parseCardExpiry parses a card expiry month and year, where the
+// year may have two or four digits, and returns zeros if either
+// is invalid
+func parseCardExpiry(monthStr string, yearStr string) (month int, year int) {
+	month, err := strconv.Atoi(strings.TrimSpace(monthStr))
+	if err != nil || month < 1 || month > 12 {
+		return 0, 0
+	}
+	year, err = strconv.Atoi(strings.TrimSpace(yearStr))
+	if err != nil || year < 0 {
+		return 0, 0
+	}
+	if year < 100 {
+		year += 2000
+	}
+	return month, year
+}
+
+// name of the section holding one-time password fields
+const totpSectionName = "oneTimePassword"
+
+// prefix of the names of one-time password fields, which
+// have an 'otpauth://' URI as their value
+const TotpFieldPrefix = "TOTP_"
+
+// AddTotpField adds a one-time password field with an
+// 'otpauth://' URI as its value to content
+func AddTotpField(content *ItemContent, uri string) {
+	field := ItemField{
+		Kind:  "concealed",
+		Name:  TotpFieldPrefix + strings.ToLower(hex.EncodeToString(randomBytes(16))),
+		Title: "one-time password",
+		Value: uri,
+	}
+	for i, section := range content.Sections {
+		if section.Name == totpSectionName {
+			content.Sections[i].Fields = append(content.Sections[i].Fields, field)
+			return
+		}
+	}
+	content.Sections = append(content.Sections, ItemSection{
+		Name:   totpSectionName,
+		Title:  "One-time password",
+		Fields: []ItemField{field},
+	})
+}
+
+// readCsvRecords parses CSV data with a header row and returns
+// each row as a map of lower-case column name -> value
+func readCsvRecords(data []byte) ([]map[string]string, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	header := rows[0]
+	records := []map[string]string{}
+	for _, row := range rows[1:] {
+		record := map[string]string{}
+		for i, value := range row {
+			if i < len(header) {
+				record[strings.ToLower(strings.TrimSpace(header[i]))] = value
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// csvHasColumns returns true if the first line of data is
+// a CSV header which includes all of the given columns
+func csvHasColumns(data []byte, columns ...string) bool {
+	firstLine := data
+	if end := bytes.IndexByte(data, '\n'); end != -1 {
+		firstLine = data[:end]
+	}
+	header, err := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(firstLine, []byte("\xef\xbb\xbf")))).Read()
+	if err != nil {
+		return false
+	}
+	found := map[string]bool{}
+	for _, name := range header {
+		found[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	for _, column := range columns {
+		if !found[column] {
+			return false
+		}
+	}
+	return true
+}
+
+// readAppleCsvItems reads the CSV files exported by Safari
+// and iCloud Passwords, which have the columns Title, URL,
+// Username, Password, Notes and OTPAuth
+func readAppleCsvItems(data []byte) ([]ExportedItem, error) {
+	records, err := readCsvRecords(data)
+	if err != nil {
+		return nil, err
+	}
+	items := []ExportedItem{}
+	for _, record := range records {
+		title := record["title"]
+		if title == "" {
+			title = record["url"]
+		}
+		item := NewLoginItem(title, record["url"], record["username"], record["password"], record["notes"])
+		if uri := record["otpauth"]; uri != "" {
+			AddTotpField(&item.SecureContents, uri)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,140 @@
+package onepass
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// readDashlaneCsvItems reads the credentials.csv file from a
+// Dashlane CSV export, which has the columns username, username2,
+// username3, title, password, note, url, category and otpSecret
+func readDashlaneCsvItems(data []byte) ([]ExportedItem, error) {
+	records, err := readCsvRecords(data)
+	if err != nil {
+		return nil, err
+	}
+	items := []ExportedItem{}
+	for _, record := range records {
+		title := record["title"]
+		if title == "" {
+			title = record["url"]
+		}
+		item := NewLoginItem(title, record["url"], record["username"], record["password"], record["note"])
+		AddImportedField(&item.SecureContents, "username 2", record["username2"], false)
+		AddImportedField(&item.SecureContents, "username 3", record["username3"], false)
+		if record["category"] != "" {
+			item.OpenContents.Tags = []string{record["category"]}
+		}
+		for _, column := range []string{"otpsecret", "otpurl"} {
+			if secret := record[column]; secret != "" {
+				AddTotpField(&item.SecureContents, totpUri(title, secret))
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// isDashlaneJson returns true if data is a Dashlane JSON export,
+// which is an object mapping Dashlane's item categories, such as
+// 'AUTHENTIFIANT' for logins, to lists of items
+func isDashlaneJson(data []byte) bool {
+	var export map[string]json.RawMessage
+	if json.Unmarshal(data, &export) != nil {
+		return false
+	}
+	_, hasLogins := export["AUTHENTIFIANT"]
+	_, hasNotes := export["SECURENOTE"]
+	return hasLogins || hasNotes
+}
+
+// dashlaneEntry is an item in a Dashlane JSON export
+type dashlaneEntry map[string]interface{}
+
+// get returns the first non-empty string property
+// of entry from the given names
+func (entry dashlaneEntry) get(names ...string) string {
+	for _, name := range names {
+		if value, ok := entry[name]; ok && value != nil {
+			if str := strings.TrimSpace(fmt.Sprint(value)); str != "" {
+				return str
+			}
+		}
+	}
+	return ""
+}
+
+// readDashlaneJsonItems reads a Dashlane JSON export. Logins,
+// secure notes and credit cards are mapped to the equivalent item
+// types. Items in other categories are imported as secure notes
+// listing their properties.
+func readDashlaneJsonItems(data []byte) ([]ExportedItem, error) {
+	var export map[string][]dashlaneEntry
+	err := json.Unmarshal(data, &export)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read Dashlane export: %v", err)
+	}
+	categories := []string{}
+	for category := range export {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	items := []ExportedItem{}
+	for _, category := range categories {
+		for _, entry := range export[category] {
+			items = append(items, dashlaneItem(category, entry))
+		}
+	}
+	return items, nil
+}
+
+func dashlaneItem(category string, entry dashlaneEntry) ExportedItem {
+	title := entry.get("title", "name", "domain")
+	switch category {
+	case "AUTHENTIFIANT":
+		username := entry.get("login", "email")
+		item := NewLoginItem(title, entry.get("domain", "url"), username, entry.get("password"), entry.get("note"))
+		if email := entry.get("email"); email != username {
+			AddImportedField(&item.SecureContents, "email", email, false)
+		}
+		AddImportedField(&item.SecureContents, "secondary login", entry.get("secondaryLogin"), false)
+		if secret := entry.get("otpSecret", "otpUrl"); secret != "" {
+			AddTotpField(&item.SecureContents, totpUri(title, secret))
+		}
+		return item
+	case "SECURENOTE":
+		return NewSecureNoteItem(title, entry.get("content"))
+	case "PAYMENTMEANS_CREDITCARD":
+		card := CreditCard{
+			Cardholder: entry.get("owner", "ownerName"),
+			Number:     entry.get("cardNumber"),
+			Cvv:        entry.get("securityCode"),
+			Bank:       entry.get("bank"),
+		}
+		card.ExpiryMonth, card.ExpiryYear = parseCardExpiry(entry.get("expireMonth"), entry.get("expireYear"))
+		if title == "" {
+			title = card.Bank
+		}
+		return NewCreditCardItem(title, card, entry.get("note"))
+	}
+
+	// list the properties of items in other categories
+	names := []string{}
+	for name := range entry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := []string{}
+	for _, name := range names {
+		if value := entry.get(name); value != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", name, value))
+		}
+	}
+	if title == "" {
+		title = strings.ToLower(category)
+	}
+	return NewSecureNoteItem(title, strings.Join(lines, "\n"))
+}
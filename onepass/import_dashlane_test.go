@@ -0,0 +1,86 @@
+package onepass
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadDashlaneCsv(t *testing.T) {
+	data := []byte("username,username2,username3,title,password,note,url,category,otpSecret\n" +
+		"jim,jim2,,Example,pass1,a note,https://example.com,Work,JBSW Y3DP\n")
+	format, err := FindImportFormat("dashlane")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !format.Detect(data) {
+		t.Fatalf("Failed to detect Dashlane CSV")
+	}
+	items, err := format.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("Expected 1 item, got %d", len(items))
+	}
+	content := items[0].SecureContents
+	if content.FormFieldByPattern("username").Value != "jim" || content.Notes != "a note" {
+		t.Errorf("Unexpected content %+v", content)
+	}
+	if field := content.FieldByPattern("username 2"); field == nil || field.ValueString() != "jim2" {
+		t.Errorf("Expected second username to be imported")
+	}
+	if len(items[0].OpenContents.Tags) != 1 || items[0].OpenContents.Tags[0] != "Work" {
+		t.Errorf("Expected category to be imported as a tag")
+	}
+	totp := content.FieldByPattern("one-time password")
+	if totp == nil || totp.ValueString() != "otpauth://totp/Example?secret=JBSWY3DP" {
+		t.Errorf("Unexpected one-time password field %+v", totp)
+	}
+}
+
+func TestReadDashlaneJson(t *testing.T) {
+	data := []byte(`{
+		"AUTHENTIFIANT": [{"title": "Example", "domain": "example.com", "login": "jim",
+			"email": "jim@example.com", "password": "pass1", "note": ""}],
+		"SECURENOTE": [{"title": "Note", "content": "secret note"}],
+		"PAYMENTMEANS_CREDITCARD": [{"name": "Visa", "owner": "Jim Smith", "cardNumber": "4111111111111111",
+			"securityCode": "123", "expireMonth": "04", "expireYear": "2027", "bank": "Bank"}],
+		"IDENTITY": [{"firstName": "Jim", "lastName": "Smith"}]
+	}`)
+	if !isDashlaneJson(data) {
+		t.Fatalf("Failed to detect Dashlane JSON")
+	}
+	items, err := readDashlaneJsonItems(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byType := map[string]ExportedItem{}
+	for _, item := range items {
+		byType[item.TypeName+":"+item.Title] = item
+	}
+	if len(items) != 4 {
+		t.Fatalf("Expected 4 items, got %d", len(items))
+	}
+
+	login := byType["webforms.WebForm:Example"].SecureContents
+	if login.FormFieldByPattern("username").Value != "jim" || login.Urls[0].Url != "example.com" {
+		t.Errorf("Unexpected login %+v", login)
+	}
+	if field := login.FieldByPattern("email"); field == nil || field.ValueString() != "jim@example.com" {
+		t.Errorf("Expected email to be imported")
+	}
+	if byType["securenotes.SecureNote:Note"].SecureContents.Notes != "secret note" {
+		t.Errorf("Expected secure note to be imported")
+	}
+	card := byType["wallet.financial.CreditCard:Visa"].SecureContents
+	if field := card.FieldByPattern("ccnum"); field == nil || field.ValueString() != "4111111111111111" {
+		t.Errorf("Expected card number to be imported")
+	}
+	if field := card.FieldByPattern("expiry"); field == nil || field.Value != 202704 {
+		t.Errorf("Unexpected card expiry %+v", field)
+	}
+	identity := byType["securenotes.SecureNote:identity"].SecureContents
+	if !strings.Contains(identity.Notes, "firstName: Jim") {
+		t.Errorf("Expected other items to be imported as notes, got '%s'", identity.Notes)
+	}
+}
@@ -0,0 +1,121 @@
+package onepass
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// enpassExport is the format of Enpass JSON exports
+type enpassExport struct {
+	Items []enpassItem `json:"items"`
+}
+
+type enpassItem struct {
+	Title    string        `json:"title"`
+	Category string        `json:"category"`
+	Note     string        `json:"note"`
+	Trashed  int           `json:"trashed"`
+	Fields   []enpassField `json:"fields"`
+}
+
+type enpassField struct {
+	Label     string `json:"label"`
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	Sensitive int    `json:"sensitive"`
+	Deleted   int    `json:"deleted"`
+}
+
+// isEnpassJson returns true if data is an Enpass JSON export
+func isEnpassJson(data []byte) bool {
+	var export enpassExport
+	if json.Unmarshal(data, &export) != nil || len(export.Items) == 0 {
+		return false
+	}
+	return export.Items[0].Category != ""
+}
+
+// readEnpassItems reads an Enpass JSON export. Logins, passwords,
+// notes and credit cards are mapped to the equivalent item types and
+// items in other categories are imported as secure notes. Fields
+// without a standard equivalent are kept in an 'Imported fields'
+// section.
+func readEnpassItems(data []byte) ([]ExportedItem, error) {
+	var export enpassExport
+	err := json.Unmarshal(data, &export)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read Enpass export: %v", err)
+	}
+	items := []ExportedItem{}
+	for _, entry := range export.Items {
+		item := enpassItemToExported(entry)
+		item.Trashed = entry.Trashed != 0
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func enpassItemToExported(entry enpassItem) ExportedItem {
+	// values of the first field of each type
+	values := map[string]string{}
+	for _, field := range entry.Fields {
+		if _, seen := values[field.Type]; !seen && field.Deleted == 0 && field.Value != "" {
+			values[field.Type] = field.Value
+		}
+	}
+
+	// types of fields whose first value is
+	// stored in a standard field
+	var item ExportedItem
+	mapped := map[string]bool{}
+	switch entry.Category {
+	case "login", "password":
+		username := values["username"]
+		mapped["username"] = true
+		if username == "" {
+			username = values["email"]
+			mapped["email"] = true
+		}
+		item = NewLoginItem(entry.Title, values["url"], username, values["password"], entry.Note)
+		mapped["url"], mapped["password"] = true, true
+		if secret := values["totp"]; secret != "" {
+			AddTotpField(&item.SecureContents, totpUri(entry.Title, secret))
+			mapped["totp"] = true
+		}
+	case "creditcard":
+		card := CreditCard{
+			Cardholder: values["ccName"],
+			Number:     values["ccNumber"],
+			Cvv:        values["ccCvc"],
+			Bank:       values["ccBankname"],
+		}
+		if parts := strings.SplitN(values["ccExpiry"], "/", 2); len(parts) == 2 {
+			card.ExpiryMonth, card.ExpiryYear = parseCardExpiry(parts[0], parts[1])
+		}
+		item = NewCreditCardItem(entry.Title, card, entry.Note)
+		for _, fieldType := range []string{"ccName", "ccNumber", "ccCvc", "ccBankname", "ccExpiry"} {
+			mapped[fieldType] = true
+		}
+	default:
+		item = NewSecureNoteItem(entry.Title, entry.Note)
+	}
+
+	for _, field := range entry.Fields {
+		if field.Deleted != 0 || field.Value == "" {
+			continue
+		}
+		if mapped[field.Type] {
+			// only the first field of a mapped type is
+			// stored in the standard field
+			mapped[field.Type] = false
+			continue
+		}
+		label := field.Label
+		if label == "" {
+			label = field.Type
+		}
+		AddImportedField(&item.SecureContents, label, field.Value, field.Sensitive != 0)
+	}
+	return item
+}
@@ -0,0 +1,74 @@
+package onepass
+
+import (
+	"testing"
+)
+
+const enpassJson = `{
+	"folders": [],
+	"items": [
+		{
+			"title": "Example", "category": "login", "note": "a note", "trashed": 0,
+			"fields": [
+				{"label": "Username", "type": "username", "value": "jim", "sensitive": 0},
+				{"label": "E-mail", "type": "email", "value": "jim@example.com", "sensitive": 0},
+				{"label": "Password", "type": "password", "value": "pass1", "sensitive": 1},
+				{"label": "Old password", "type": "password", "value": "pass0", "sensitive": 1},
+				{"label": "Website", "type": "url", "value": "https://example.com", "sensitive": 0},
+				{"label": "TOTP", "type": "totp", "value": "JBSWY3DP", "sensitive": 1},
+				{"label": "Removed", "type": "text", "value": "gone", "deleted": 1}
+			]
+		},
+		{
+			"title": "Card", "category": "creditcard", "trashed": 1,
+			"fields": [
+				{"label": "Number", "type": "ccNumber", "value": "4111111111111111"},
+				{"label": "Expiry", "type": "ccExpiry", "value": "04/27"}
+			]
+		},
+		{"title": "Note", "category": "note", "note": "secret note", "fields": []}
+	]
+}`
+
+func TestReadEnpassJson(t *testing.T) {
+	data := []byte(enpassJson)
+	if !isEnpassJson(data) || isDashlaneJson(data) {
+		t.Fatalf("Failed to detect Enpass JSON")
+	}
+	items, err := readEnpassItems(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("Expected 3 items, got %d", len(items))
+	}
+
+	login := items[0].SecureContents
+	if items[0].TypeName != "webforms.WebForm" || login.FormFieldByPattern("username").Value != "jim" ||
+		login.FormFieldByPattern("password").Value != "pass1" || login.Urls[0].Url != "https://example.com" {
+		t.Errorf("Unexpected login %+v", login)
+	}
+	if field := fieldByTitle(login, "E-mail"); field == nil || field.ValueString() != "jim@example.com" {
+		t.Errorf("Expected email to be imported")
+	}
+	if field := fieldByTitle(login, "Old password"); field == nil || field.Kind != "concealed" {
+		t.Errorf("Expected second password to be imported as a concealed field")
+	}
+	if fieldByTitle(login, "Removed") != nil {
+		t.Errorf("Deleted fields should not be imported")
+	}
+	if login.FieldByPattern("one-time password") == nil {
+		t.Errorf("Expected one-time password field")
+	}
+
+	card := items[1]
+	if card.TypeName != "wallet.financial.CreditCard" || !card.Trashed {
+		t.Errorf("Unexpected card %+v", card.Item)
+	}
+	if field := card.SecureContents.FieldByPattern("expiry"); field == nil || field.Value != 202704 {
+		t.Errorf("Unexpected card expiry %+v", field)
+	}
+	if items[2].TypeName != "securenotes.SecureNote" || items[2].SecureContents.Notes != "secret note" {
+		t.Errorf("Unexpected note %+v", items[2])
+	}
+}
@@ -0,0 +1,94 @@
+package onepass
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+const appleCsv = "Title,URL,Username,Password,Notes,OTPAuth\n" +
+	"example.com (jim),https://example.com/,jim,pass1,\"some\nnotes\",otpauth://totp/Example:jim?secret=JBSWY3DPEHPK3PXP\n" +
+	",https://other.com/,bob,pass2,,\n"
+
+func TestImportAppleCsv(t *testing.T) {
+	path := os.TempDir() + "/1pass-test-apple.csv"
+	err := ioutil.WriteFile(path, []byte(appleCsv), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	items, err := ImportItemsFrom(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(items))
+	}
+
+	item := items[0]
+	if item.Title != "example.com (jim)" || item.TypeName != "webforms.WebForm" {
+		t.Errorf("Unexpected item %+v", item.Item)
+	}
+	content := item.SecureContents
+	if content.FormFieldByPattern("username").Value != "jim" || content.FormFieldByPattern("password").Value != "pass1" {
+		t.Errorf("Unexpected form fields %v", content.FormFields)
+	}
+	if content.Notes != "some\nnotes" || content.Urls[0].Url != "https://example.com/" {
+		t.Errorf("Unexpected content %+v", content)
+	}
+	if len(content.Sections) != 1 || len(content.Sections[0].Fields) != 1 {
+		t.Fatalf("Expected a one-time password field, got %+v", content.Sections)
+	}
+	totp := content.Sections[0].Fields[0]
+	if !strings.HasPrefix(totp.Name, TotpFieldPrefix) || !strings.HasPrefix(totp.ValueString(), "otpauth://totp/") {
+		t.Errorf("Unexpected one-time password field %+v", totp)
+	}
+
+	// items without a title are named after their URL
+	if items[1].Title != "https://other.com/" || len(items[1].SecureContents.Sections) != 0 {
+		t.Errorf("Unexpected item %+v", items[1])
+	}
+}
+
+func TestImportFormatDetection(t *testing.T) {
+	path := os.TempDir() + "/1pass-test-unknown.csv"
+	err := ioutil.WriteFile(path, []byte("a,b,c\n1,2,3\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	_, err = ImportItemsFrom(path, "")
+	if err == nil {
+		t.Errorf("Importing a file in an unknown format should fail")
+	}
+	// a single item from a .1pif file
+	err = ioutil.WriteFile(path, []byte(`{"title": "Item", "typeName": "securenotes.SecureNote",
+		"secureContents": {"notesPlain": "note"}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := ImportItemsFrom(path, "")
+	if err != nil || len(items) != 1 || items[0].SecureContents.Notes != "note" {
+		t.Errorf("Failed to import single item: %v", err)
+	}
+
+	_, err = ImportItemsFrom(path, "no-such-format")
+	if err == nil {
+		t.Errorf("Importing with an unknown format name should fail")
+	}
+}
+
+// returns the field in content with the given title
+func fieldByTitle(content ItemContent, title string) *ItemField {
+	for _, section := range content.Sections {
+		for i, field := range section.Fields {
+			if field.Title == title {
+				return &section.Fields[i]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package onepass
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/robertknight/1pass/jsonutil"
+)
+
+// ItemIndexer is implemented by CryptoAgents which maintain
+// an index of the items in a vault. If the vault's CryptoAgent
+// implements it, ListItems() uses the index instead of reading
+// every item file.
+type ItemIndexer interface {
+	// ListItems returns the items in the vault with
+	// their encrypted content omitted
+	ListItems() ([]Item, error)
+}
+
+// an entry in an ItemIndex for a single item file
+type itemIndexEntry struct {
+	Item    Item  `json:"item"`
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"modTime"`
+}
+
+// ItemIndex is a cache of the unencrypted overview data
+// (titles, types, locations, tags and so on) for the items
+// in a vault, which allows items to be listed without reading
+// and parsing every item file.
+//
+// The index is refreshed by comparing the sizes and modification
+// times of item files with those recorded in the index and
+// re-reading only those which have changed.
+type ItemIndex struct {
+	entries map[string]itemIndexEntry
+}
+
+func NewItemIndex() *ItemIndex {
+	return &ItemIndex{entries: map[string]itemIndexEntry{}}
+}
+
+// Refresh updates the index to match the item files in
+// the vault and returns true if any entries changed
+func (index *ItemIndex) Refresh(vault *Vault) (bool, error) {
+	dirEntries, err := ioutil.ReadDir(vault.DataDir())
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	found := map[string]bool{}
+	for _, dirEntry := range dirEntries {
+		if path.Ext(dirEntry.Name()) != ".1password" {
+			continue
+		}
+		uuid := strings.TrimSuffix(dirEntry.Name(), ".1password")
+		found[uuid] = true
+
+		entry, exists := index.entries[uuid]
+		if exists && entry.Size == dirEntry.Size() && entry.ModTime == dirEntry.ModTime().UnixNano() {
+			continue
+		}
+		item, err := vault.LoadItem(uuid)
+		if err != nil {
+			// the file may be in the process of being written,
+			// it will be re-read on the next refresh
+			delete(index.entries, uuid)
+			continue
+		}
+		item.Encrypted = nil
+		index.entries[uuid] = itemIndexEntry{
+			Item:    item,
+			Size:    dirEntry.Size(),
+			ModTime: dirEntry.ModTime().UnixNano(),
+		}
+		changed = true
+	}
+
+	for uuid, _ := range index.entries {
+		if !found[uuid] {
+			delete(index.entries, uuid)
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// Items returns the items in the index, excluding tombstones
+// for removed items. The encrypted content of the returned
+// items is loaded on demand.
+func (index *ItemIndex) Items(vault *Vault) []Item {
+	items := []Item{}
+	for _, entry := range index.entries {
+		if entry.Item.TypeName == "system.Tombstone" {
+			continue
+		}
+		item := entry.Item
+		item.vault = vault
+		items = append(items, item)
+	}
+	return items
+}
+
+// derives the key used to encrypt a saved index from
+// the vault's master key
+func indexKey(keys KeyDict) ([]byte, error) {
+	masterKey, ok := keys["SL5"]
+	if !ok {
+		return nil, errors.New("Vault has no SL5 key")
+	}
+	mac := hmac.New(sha256.New, masterKey)
+	mac.Write([]byte("1pass item index"))
+	return mac.Sum(nil), nil
+}
+
+func indexCipher(keys KeyDict) (cipher.AEAD, error) {
+	key, err := indexKey(keys)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Save writes the index to filePath, encrypted with a key
+// derived from the vault's keys
+func (index *ItemIndex) Save(filePath string, keys KeyDict) error {
+	data, err := json.Marshal(index.entries)
+	if err != nil {
+		return err
+	}
+	aead, err := indexCipher(keys)
+	if err != nil {
+		return err
+	}
+	nonce := randomBytes(aead.NonceSize())
+	sealed := aead.Seal(nonce, nonce, data, nil)
+
+	err = os.MkdirAll(path.Dir(filePath), 0700)
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so that a concurrent
+	// reader never sees a partially written index
+	return jsonutil.WriteFileAtomic(filePath, sealed, 0600)
+}
+
+// LoadItemIndex reads an index saved by ItemIndex.Save().
+// An empty index is returned if the file does not exist.
+func LoadItemIndex(filePath string, keys KeyDict) (*ItemIndex, error) {
+	sealed, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return NewItemIndex(), nil
+	} else if err != nil {
+		return nil, err
+	}
+	aead, err := indexCipher(keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("Item index is truncated")
+	}
+	nonce := sealed[:aead.NonceSize()]
+	data, err := aead.Open(nil, nonce, sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decrypt item index: %v", err)
+	}
+	index := NewItemIndex()
+	err = json.Unmarshal(data, &index.entries)
+	if err != nil {
+		return nil, fmt.Errorf("Item index is corrupt: %v", err)
+	}
+	return index, nil
+}
@@ -0,0 +1,84 @@
+package onepass
+
+import (
+	"os"
+	"testing"
+)
+
+func TestItemIndex(t *testing.T) {
+	testVault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	vault := &testVault
+	item, err := vault.AddItem("Indexed Item", "securenotes.SecureNote", ItemContent{Notes: "indexed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := NewItemIndex()
+	changed, err := index.Refresh(vault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Errorf("Expected initial refresh to change index")
+	}
+	changed, err = index.Refresh(vault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Errorf("Expected refresh of unchanged vault to leave index unchanged")
+	}
+
+	// save and reload the index
+	indexPath := os.TempDir() + "/1pass-test-index"
+	defer os.Remove(indexPath)
+	keys, err := UnlockKeys(vault.Path, "test-pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = index.Save(indexPath, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err = LoadItemIndex(indexPath, keys)
+	if err != nil {
+		t.Fatalf("Unable to load saved index: %v", err)
+	}
+	_, err = LoadItemIndex(indexPath, KeyDict{"SL5": []byte("wrong key")})
+	if err == nil {
+		t.Errorf("Expected loading index with wrong key to fail")
+	}
+
+	items := index.Items(vault)
+	if len(items) != 1 || items[0].Uuid != item.Uuid || items[0].Title != "Indexed Item" {
+		t.Fatalf("Unexpected items in index: %v", items)
+	}
+	if len(items[0].Encrypted) != 0 {
+		t.Errorf("Expected item content to be omitted from index")
+	}
+
+	// content of indexed items is read on demand
+	content, err := items[0].Content()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content.Notes != "indexed" {
+		t.Errorf("Unexpected item content: %s", content.Notes)
+	}
+
+	// removed items are dropped from the index
+	err = items[0].Remove()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = index.Refresh(vault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items := index.Items(vault); len(items) != 0 {
+		t.Errorf("Expected removed item to be omitted, got %v", items)
+	}
+}
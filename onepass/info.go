@@ -0,0 +1,84 @@
+package onepass
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/robertknight/1pass/jsonutil"
+)
+
+// VaultInfo summarizes the contents and security
+// settings of a vault
+type VaultInfo struct {
+	// vault format, eg. 'agilekeychain'
+	Format string
+
+	// number of items, excluding folders, and the
+	// number of those items which are in the trash
+	Items   int
+	Trashed int
+	Folders int
+
+	// map of security level -> number of PBKDF2 iterations
+	// applied to the master password to decrypt that level's key
+	KeyIterations map[string]int
+
+	// total size in bytes of the files in the vault
+	Size int64
+
+	// time at which a file in the vault was last modified
+	Modified time.Time
+}
+
+// Info returns a summary of the vault. The vault
+// does not need to be unlocked.
+func (vault *Vault) Info() (VaultInfo, error) {
+	info := VaultInfo{
+		Format:        strings.TrimPrefix(path.Ext(vault.Path), "."),
+		KeyIterations: map[string]int{},
+	}
+
+	var keys encryptionKeys
+	err := jsonutil.ReadFile(vault.DataDir()+"/encryptionKeys.js", &keys)
+	if err != nil {
+		return info, err
+	}
+	for _, entry := range keys.List {
+		info.KeyIterations[entry.Level] = entry.Iterations
+	}
+
+	items, err := vault.ListItems()
+	if err != nil {
+		return info, err
+	}
+	for _, item := range items {
+		switch {
+		case item.TypeName == "system.folder.Regular":
+			info.Folders++
+		case strings.HasPrefix(item.TypeName, "system."):
+		default:
+			info.Items++
+			if item.Trashed {
+				info.Trashed++
+			}
+		}
+	}
+
+	err = filepath.Walk(vault.Path, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fileInfo.IsDir() {
+			return nil
+		}
+		info.Size += fileInfo.Size()
+		if fileInfo.ModTime().After(info.Modified) {
+			info.Modified = fileInfo.ModTime()
+		}
+		return nil
+	})
+	return info, err
+}
@@ -0,0 +1,46 @@
+package onepass
+
+import (
+	"testing"
+)
+
+func TestVaultInfo(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	_, err = vault.AddItem("Login", "webforms.WebForm", newTestContent("info.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trashed, err := vault.AddItem("Old Login", "webforms.WebForm", newTestContent("old.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trashed.Trashed = true
+	err = trashed.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = vault.AddItem("Folder", "system.folder.Regular", ItemContent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := vault.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Format != "agilekeychain" {
+		t.Errorf("Unexpected format '%s'", info.Format)
+	}
+	if info.Items != 2 || info.Trashed != 1 || info.Folders != 1 {
+		t.Errorf("Unexpected item counts: %+v", info)
+	}
+	if info.KeyIterations["SL5"] != 100 {
+		t.Errorf("Unexpected SL5 iterations: %d", info.KeyIterations["SL5"])
+	}
+	if info.Size == 0 || info.Modified.IsZero() {
+		t.Errorf("Expected vault size and modification time")
+	}
+}
@@ -369,6 +369,54 @@ const itemTemplateData = `{
     "fields": [],
     "URLs": null
   },
+  "wallet.computer.Router": {
+    "sections": [
+      {
+        "name": "",
+        "title": "",
+        "fields": [
+          {
+            "k": "string",
+            "n": "name",
+            "t": "base station name",
+            "v": null
+          },
+          {
+            "k": "concealed",
+            "n": "password",
+            "t": "base station password",
+            "v": null
+          },
+          {
+            "k": "string",
+            "n": "server",
+            "t": "server / IP address",
+            "v": null
+          },
+          {
+            "k": "string",
+            "n": "network_name",
+            "t": "network name",
+            "v": null
+          },
+          {
+            "k": "menu",
+            "n": "wireless_security",
+            "t": "wireless security",
+            "v": null
+          },
+          {
+            "k": "concealed",
+            "n": "wireless_password",
+            "t": "wireless network password",
+            "v": null
+          }
+        ]
+      }
+    ],
+    "fields": [],
+    "URLs": null
+  },
   "wallet.computer.UnixServer": {
     "sections": [
       {
@@ -1048,5 +1096,6 @@ const itemTemplateData = `{
       }
     ]
   },
-  "system.folder.Regular" : {}
+  "system.folder.Regular" : {},
+  "documents.Document" : {}
 }`
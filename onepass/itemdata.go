@@ -28,6 +28,9 @@ type ItemContent struct {
 	HtmlMethod string         `json:"htmlMethod"`
 	HtmlAction string         `json:"htmlAction"`
 	HtmlId     string         `json:"htmlID,omitempty"`
+
+	// previous values of the item's passwords, oldest first
+	PasswordHistory []PasswordHistoryEntry `json:"passwordHistory,omitempty"`
 }
 
 // Contents of an item which are stored unencrypted
@@ -39,6 +42,23 @@ type ItemOpenContents struct {
 	// Supported values are 'Always' (show everywhere)
 	// and 'Never' (never show in browser)
 	Scope string `json:"scope"`
+
+	// Unix timestamp after which the item's credentials
+	// should be changed, or 0 if they do not expire.
+	// This is a 1pass extension which other clients ignore.
+	Expires uint64 `json:"expires,omitempty"`
+
+	// Which sites the item's website matches, UrlMatchDomain
+	// or UrlMatchHost. This is a 1pass extension.
+	UrlMatch string `json:"urlMatch,omitempty"`
+
+	// Hash of the item's username, used by 1Password
+	// apps to find logins for a site
+	UsernameHash string `json:"usernameHash,omitempty"`
+
+	// Other keys written by official clients, which are
+	// preserved when the item is saved
+	Other map[string]json.RawMessage `json:"-"`
 }
 
 // Section of an item's contents
@@ -77,21 +97,20 @@ func (field ItemField) ValueString() string {
 		return fmt.Sprintf("Street: %s, City: %s, Zip: %s, State: %s, Country:%s",
 			addr.Street, addr.City, addr.Zip, addr.State, addr.Country)
 	case "date":
-		valueFloat, ok := field.Value.(float64)
+		value, ok := numericFieldValue(field.Value)
 		if !ok {
 			return defaultStr
 		}
-		return time.Unix(int64(valueFloat), 0).Format("02/01/06")
+		return time.Unix(value, 0).Format(DateFormat)
 	case "monthYear":
 		// stored as an int with digits YYYYMM
-		valueFloat, ok := field.Value.(float64)
+		value, ok := numericFieldValue(field.Value)
 		if !ok {
 			return defaultStr
 		}
-		value := int(valueFloat)
 		month := value % 100
 		year := value / 100
-		return fmt.Sprintf("%02.d/%04.d", month, year)
+		return fmt.Sprintf("%02d/%04d", month, year)
 	case "string", "URL", "cctype", "phone", "gender", "email", "menu":
 		return defaultStr
 	default:
@@ -102,19 +121,22 @@ func (field ItemField) ValueString() string {
 func FieldValueFromString(kind string, str string) (interface{}, error) {
 	switch kind {
 	case "date":
-		// TODO - Use locale-appropriate date format
-		date, err := time.Parse("02/01/06", str)
+		date, err := ParseDate(str)
 		if err != nil {
-			return nil, fmt.Errorf("%s is not in the format DD/MM/YY", str)
+			return nil, err
 		}
 		return date.Unix(), nil
 	case "monthYear":
-		date, err := time.Parse("01/06", str)
+		value, err := ParseMonthYear(str)
 		if err != nil {
-			return nil, fmt.Errorf("%s is not in the format MM/YY", str)
+			return nil, err
+		}
+		return value, nil
+	case "phone":
+		if !ValidPhoneNumber(str) {
+			return nil, fmt.Errorf("'%s' is not a valid phone number", str)
 		}
-		// convert to int with digits YYYYMM
-		return date.Year()*100 + int(date.Month()), nil
+		return strings.TrimSpace(str), nil
 	default:
 		return str, nil
 	}
@@ -251,6 +273,10 @@ var ItemTypes = map[string]ItemType{
 		Name:       "Identity",
 		ShortAlias: "id",
 	},
+	"documents.Document": ItemType{
+		Name:       "Document",
+		ShortAlias: "document",
+	},
 	// internal entry type created for items
 	// that have been removed from the trash
 	"system.Tombstone": ItemType{
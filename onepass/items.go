@@ -0,0 +1,146 @@
+package onepass
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	"github.com/robertknight/1pass/jsonutil"
+)
+
+// ItemIterator reads the items in a vault one at a time.
+//
+// Each item file is read only when the iterator advances to it and
+// the encrypted content of the item is not retained. The content
+// is read again from the item file if it is requested.
+type ItemIterator struct {
+	vault *Vault
+	names []string
+	item  Item
+
+	// items listed up-front by backends other than the
+	// Agile Keychain, which are returned in turn
+	items []Item
+}
+
+// Items returns an iterator over the items in the vault,
+// excluding tombstones for removed items
+func (vault *Vault) Items() (*ItemIterator, error) {
+	if _, ok := vault.backend().(agileKeychain); !ok {
+		items, err := vault.listItemFiles()
+		if err != nil {
+			return nil, err
+		}
+		return &ItemIterator{vault: vault, items: items}, nil
+	}
+
+	dirEntries, err := ioutil.ReadDir(vault.DataDir())
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range dirEntries {
+		if path.Ext(entry.Name()) == ".1password" {
+			names = append(names, entry.Name())
+		}
+	}
+	return &ItemIterator{vault: vault, names: names}, nil
+}
+
+// Next advances to the next item in the vault and
+// returns false if there are no more items
+func (it *ItemIterator) Next() bool {
+	for len(it.items) > 0 {
+		item := it.items[0]
+		it.items = it.items[1:]
+		if item.TypeName == "system.Tombstone" {
+			continue
+		}
+		item.Encrypted = nil
+		it.item = item
+		return true
+	}
+	for len(it.names) > 0 {
+		name := it.names[0]
+		it.names = it.names[1:]
+
+		item := Item{vault: it.vault}
+		err := jsonutil.ReadFile(it.vault.DataDir()+"/"+name, &item)
+		if err != nil {
+			fmt.Printf("Failed to read item: %s: %v\n", name, err)
+			continue
+		}
+		if item.TypeName == "system.Tombstone" {
+			continue
+		}
+		item.Encrypted = nil
+		it.item = item
+		return true
+	}
+	return false
+}
+
+// Item returns the current item
+func (it *ItemIterator) Item() Item {
+	return it.item
+}
+
+// FindItems returns the items in the vault for which match
+// returns true.
+//
+// match is called with the overview data for each item from the
+// vault's contents.js index (ID, type, title, location, folder,
+// trash state and last update time) and only the files for matching
+// items are read. If the index cannot be read, every item
+// file is read instead.
+func (vault *Vault) FindItems(match func(overview Item) bool) ([]Item, error) {
+	if _, ok := vault.CryptoAgent.(ItemIndexer); ok {
+		// the agent's index is faster than contents.js
+		// and includes all overview data
+		items, err := vault.ListItems()
+		if err != nil {
+			return nil, err
+		}
+		return filterItems(items, match), nil
+	}
+
+	data, err := ioutil.ReadFile(vault.DataDir() + "/contents.js")
+	var overviews []Item
+	if err == nil {
+		overviews, err = ParseContentsIndex(data)
+	}
+	DebugLog("Read contents.js index (%d items, err: %v)", len(overviews), err)
+	if err != nil {
+		items, err := vault.ListItems()
+		if err != nil {
+			return nil, err
+		}
+		return filterItems(items, match), nil
+	}
+
+	items := []Item{}
+	for _, overview := range overviews {
+		if overview.TypeName == "system.Tombstone" || !match(overview) {
+			continue
+		}
+		item, err := vault.LoadItem(overview.Uuid)
+		if err != nil {
+			// listed in the index but the item
+			// file is missing or unreadable
+			continue
+		}
+		item.Encrypted = nil
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func filterItems(items []Item, match func(Item) bool) []Item {
+	matches := []Item{}
+	for _, item := range items {
+		if match(item) {
+			matches = append(matches, item)
+		}
+	}
+	return matches
+}
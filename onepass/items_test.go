@@ -0,0 +1,68 @@
+package onepass
+
+import (
+	"os"
+	"testing"
+)
+
+func TestItemIteratorAndFind(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	titles := []string{"First Item", "Second Item", "Removed Item"}
+	items := []Item{}
+	for _, title := range titles {
+		item, err := vault.AddItem(title, "securenotes.SecureNote", ItemContent{Notes: title})
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+	err = items[2].Remove()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	it, err := vault.Items()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for it.Next() {
+		item := it.Item()
+		if item.TypeName == "system.Tombstone" {
+			t.Errorf("Iterator returned removed item")
+		}
+		if len(item.Encrypted) != 0 {
+			t.Errorf("Expected content of '%s' to be read on demand", item.Title)
+		}
+		count++
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 items, got %d", count)
+	}
+
+	// only the files for matching items are read, so
+	// a corrupt file for another item is ignored
+	err = os.Truncate(items[1].Path(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := vault.FindItems(func(item Item) bool {
+		return item.Title == "First Item"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Uuid != items[0].Uuid {
+		t.Fatalf("Unexpected items found: %v", found)
+	}
+	content, err := found[0].Content()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content.Notes != "First Item" {
+		t.Errorf("Unexpected content: %s", content.Notes)
+	}
+}
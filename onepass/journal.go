@@ -0,0 +1,197 @@
+package onepass
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+)
+
+// maximum number of operations kept in a journal
+const maxJournalEntries = 20
+
+// ErrNothingToUndo is returned by Journal.Undo() if
+// there are no recorded operations
+var ErrNothingToUndo = errors.New("Nothing to undo")
+
+// JournalEntry records the state of items before
+// an operation which modified them
+type JournalEntry struct {
+	// Description of the operation, eg. 'rename'
+	Action string `json:"action"`
+
+	// UNIX timestamp of when the operation happened
+	Time int64 `json:"time"`
+
+	// Copies of the item files before the operation
+	Snapshots []Item `json:"snapshots"`
+
+	// Map of item ID -> encrypted contents of the files stored
+	// in document items in Snapshots
+	Documents map[string][]byte `json:"documents,omitempty"`
+
+	// IDs of items added by the operation, which
+	// are removed when it is undone
+	Created []string `json:"created,omitempty"`
+}
+
+// Journal is a log of recent operations which modified items
+// in a vault, which allows the most recent operation to be undone.
+//
+// The journal is stored outside the vault and is encrypted with
+// the vault's SL5 key, so it can only be read while the vault
+// is unlocked.
+type Journal struct {
+	vault   *Vault
+	path    string
+	Entries []JournalEntry
+}
+
+// OpenJournal reads the journal for vault from filePath. If the
+// file does not exist, an empty journal is returned.
+func OpenJournal(vault *Vault, filePath string) (*Journal, error) {
+	journal := &Journal{vault: vault, path: filePath}
+	encrypted, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return journal, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if vault.IsLocked() {
+		return nil, errors.New("Vault is locked")
+	}
+	data, err := vault.CryptoAgent.Decrypt("SL5", encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decrypt undo journal: %v", err)
+	}
+	err = json.Unmarshal(data, &journal.Entries)
+	ZeroBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("Undo journal is corrupt: %v", err)
+	}
+	return journal, nil
+}
+
+func (journal *Journal) save() error {
+	data, err := json.Marshal(journal.Entries)
+	if err != nil {
+		return err
+	}
+	encrypted, err := journal.vault.CryptoAgent.Encrypt("SL5", data)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(path.Dir(journal.path), 0700)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(journal.path, encrypted, 0600)
+}
+
+// Record adds an entry for an operation to the journal.
+// snapshots are copies of the items affected by the operation,
+// loaded with Vault.SnapshotItem() before they were modified, and
+// created lists the IDs of items which the operation added.
+func (journal *Journal) Record(action string, snapshots []Item, created []string) error {
+	entry := JournalEntry{
+		Action:    action,
+		Time:      time.Now().Unix(),
+		Snapshots: snapshots,
+		Created:   created,
+	}
+	for _, item := range snapshots {
+		if item.document != nil {
+			if entry.Documents == nil {
+				entry.Documents = map[string][]byte{}
+			}
+			entry.Documents[item.Uuid] = item.document
+		}
+	}
+	journal.Entries = append(journal.Entries, entry)
+	if len(journal.Entries) > maxJournalEntries {
+		journal.Entries = journal.Entries[len(journal.Entries)-maxJournalEntries:]
+	}
+	return journal.save()
+}
+
+// Undo restores the items affected by the most recent operation in
+// the journal to their previous state and removes any items which it
+// added, then removes the operation from the journal and returns it.
+func (journal *Journal) Undo() (JournalEntry, error) {
+	if len(journal.Entries) == 0 {
+		return JournalEntry{}, ErrNothingToUndo
+	}
+	entry := journal.Entries[len(journal.Entries)-1]
+	for i, _ := range entry.Snapshots {
+		item := &entry.Snapshots[i]
+		item.vault = journal.vault
+		item.document = entry.Documents[item.Uuid]
+		err := item.Save()
+		if err != nil {
+			return JournalEntry{}, fmt.Errorf("Unable to restore '%s': %v", item.Title, err)
+		}
+	}
+	for _, uuid := range entry.Created {
+		item, err := journal.vault.LoadItem(uuid)
+		if err != nil {
+			return JournalEntry{}, fmt.Errorf("Unable to find added item %s: %v", uuid, err)
+		}
+		if item.TypeName == "system.Tombstone" {
+			continue
+		}
+		err = item.Remove()
+		if err != nil {
+			return JournalEntry{}, fmt.Errorf("Unable to remove '%s': %v", item.Title, err)
+		}
+	}
+	journal.Entries = journal.Entries[:len(journal.Entries)-1]
+	return entry, journal.save()
+}
+
+// ReEncrypt re-encrypts the journal and the item revisions in it
+// after the vault's keys have been replaced by Vault.ReEncrypt().
+// oldAgent must still hold the keys which the journal was
+// encrypted with.
+func (journal *Journal) ReEncrypt(oldAgent CryptoAgent) error {
+	newAgent := journal.vault.CryptoAgent
+	for i := range journal.Entries {
+		entry := &journal.Entries[i]
+		for k := range entry.Snapshots {
+			item := &entry.Snapshots[k]
+			var err error
+			if len(item.Encrypted) > 0 {
+				item.Encrypted, err = reEncryptWith(oldAgent, newAgent, item.SecurityLevel, item.Encrypted)
+				if err != nil {
+					return fmt.Errorf("Failed to re-encrypt '%s' in undo journal: %v", item.Title, err)
+				}
+			}
+			if document, ok := entry.Documents[item.Uuid]; ok {
+				entry.Documents[item.Uuid], err = reEncryptWith(oldAgent, newAgent, item.SecurityLevel, document)
+				if err != nil {
+					return fmt.Errorf("Failed to re-encrypt document '%s' in undo journal: %v", item.Title, err)
+				}
+			}
+			for c, conflict := range item.Conflicts {
+				item.Conflicts[c].Encrypted, err = reEncryptWith(oldAgent, newAgent, conflict.SecurityLevel, conflict.Encrypted)
+				if err != nil {
+					return fmt.Errorf("Failed to re-encrypt conflicting revision of '%s' in undo journal: %v", item.Title, err)
+				}
+			}
+		}
+	}
+	return journal.save()
+}
+
+// reEncryptWith decrypts data using oldAgent's key for level
+// and encrypts it again using newAgent's key
+func reEncryptWith(oldAgent CryptoAgent, newAgent CryptoAgent, level string, encrypted []byte) ([]byte, error) {
+	content, err := oldAgent.Decrypt(level, encrypted)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroBytes(content)
+	return newAgent.Encrypt(level, content)
+}
@@ -0,0 +1,227 @@
+package onepass
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestJournalUndo(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	item, err := vault.AddItem("Original Title", "securenotes.SecureNote", newTestContent("undo.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journalPath := os.TempDir() + "/1pass-test-journal"
+	os.Remove(journalPath)
+	defer os.Remove(journalPath)
+	journal, err := OpenJournal(&vault, journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = journal.Undo()
+	if err != ErrNothingToUndo {
+		t.Errorf("Expected empty journal, got: %v", err)
+	}
+
+	// rename and then remove the item
+	snapshot, err := vault.LoadItem(item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = journal.Record("rename", []Item{snapshot}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item.Title = "New Title"
+	err = item.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err = vault.LoadItem(item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = journal.Record("remove", []Item{snapshot}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = item.Remove()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// undo both operations using a re-opened journal
+	journal, err = OpenJournal(&vault, journalPath)
+	if err != nil {
+		t.Fatalf("Unable to re-open journal: %v", err)
+	}
+	entry, err := journal.Undo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Action != "remove" {
+		t.Errorf("Expected remove to be undone first, got %s", entry.Action)
+	}
+	restored, err := vault.LoadItem(item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Title != "New Title" || restored.TypeName != "securenotes.SecureNote" {
+		t.Errorf("Removed item was not restored: %s (%s)", restored.Title, restored.TypeName)
+	}
+	content, err := restored.Content()
+	if err != nil {
+		t.Fatalf("Unable to decrypt restored item: %v", err)
+	}
+	if content.Urls[0].Url != "undo.com" {
+		t.Errorf("Unexpected content for restored item: %v", content)
+	}
+
+	_, err = journal.Undo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err = vault.LoadItem(item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Title != "Original Title" {
+		t.Errorf("Rename was not undone, title: %s", restored.Title)
+	}
+	if len(journal.Entries) != 0 {
+		t.Errorf("Expected journal to be empty, has %d entries", len(journal.Entries))
+	}
+}
+
+func TestUndoAfterReEncrypt(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	item, err := vault.AddItem("Original Title", "securenotes.SecureNote", newTestContent("undo.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journalPath := os.TempDir() + "/1pass-test-reencrypt-journal"
+	usagePath := os.TempDir() + "/1pass-test-reencrypt-usage"
+	for _, path := range []string{journalPath, usagePath} {
+		os.Remove(path)
+		defer os.Remove(path)
+	}
+	journal, err := OpenJournal(&vault, journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := vault.LoadItem(item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = journal.Record("rename", []Item{snapshot}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item.Title = "New Title"
+	err = item.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage, err := OpenUsageLog(&vault, usagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = usage.Record(time.Unix(1000, 0), item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldAgent := vault.CryptoAgent
+	err = vault.ReEncrypt("test-pwd", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = journal.ReEncrypt(oldAgent)
+	if err != nil {
+		t.Fatalf("Unable to re-encrypt journal: %v", err)
+	}
+	err = usage.ReEncrypt()
+	if err != nil {
+		t.Fatalf("Unable to re-encrypt usage log: %v", err)
+	}
+
+	// both files can be read with the new keys
+	journal, err = OpenJournal(&vault, journalPath)
+	if err != nil {
+		t.Fatalf("Unable to re-open journal: %v", err)
+	}
+	_, err = journal.Undo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := vault.LoadItem(item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := restored.Content()
+	if err != nil {
+		t.Fatalf("Unable to decrypt restored item: %v", err)
+	}
+	if restored.Title != "Original Title" || content.Urls[0].Url != "undo.com" {
+		t.Errorf("Unexpected restored item: %s, %v", restored.Title, content)
+	}
+	usage, err = OpenUsageLog(&vault, usagePath)
+	if err != nil {
+		t.Fatalf("Unable to re-open usage log: %v", err)
+	}
+	if usage.LastUsed(item.Uuid) != 1000 {
+		t.Errorf("Expected usage to be kept, got %d", usage.LastUsed(item.Uuid))
+	}
+}
+
+func TestUndoAddedItem(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	journalPath := os.TempDir() + "/1pass-test-added-journal"
+	os.Remove(journalPath)
+	defer os.Remove(journalPath)
+	journal, err := OpenJournal(&vault, journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := vault.AddItem("Duplicate", "securenotes.SecureNote", newTestContent("undo.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = journal.Record("duplicate", nil, []string{item.Uuid})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journal, err = OpenJournal(&vault, journalPath)
+	if err != nil {
+		t.Fatalf("Unable to re-open journal: %v", err)
+	}
+	entry, err := journal.Undo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Action != "duplicate" || len(entry.Created) != 1 {
+		t.Errorf("Unexpected undone entry: %v", entry)
+	}
+	removed, err := vault.LoadItem(item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed.TypeName != "system.Tombstone" {
+		t.Errorf("Expected added item to be removed, has type %s", removed.TypeName)
+	}
+}
@@ -0,0 +1,139 @@
+package onepass
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robertknight/1pass/jsonutil"
+)
+
+// format of the timestamps in the names of key backups
+const keyBackupTimeFormat = "20060102-150405"
+
+// files which hold a vault's encryption keys
+var keyFileNames = []string{"encryptionKeys.js", "1password.keys"}
+
+// ErrNoKeyBackups is returned by RestoreKeys() if the
+// vault has no backups of its key files
+var ErrNoKeyBackups = errors.New("No key backups found")
+
+// returns the path of the backup of the key file
+// fileName made at timestamp
+func (vault *Vault) keyBackupPath(fileName string, timestamp string) string {
+	return fmt.Sprintf("%s/%s.%s.bak", vault.DataDir(), fileName, timestamp)
+}
+
+// BackupKeys saves copies of the vault's key files, which are
+// encrypted with the current master password, alongside the
+// originals and returns the timestamp which identifies the backup.
+//
+// This is done before the master password is changed so that the
+// change can be reverted with RestoreKeys().
+func (vault *Vault) BackupKeys(now time.Time) (string, error) {
+	if err := vault.checkWritable(); err != nil {
+		return "", err
+	}
+	unlock, err := vault.lockForWrite()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	timestamp := now.Format(keyBackupTimeFormat)
+	for _, fileName := range keyFileNames {
+		data, err := ioutil.ReadFile(vault.DataDir() + "/" + fileName)
+		if os.IsNotExist(err) && fileName != "encryptionKeys.js" {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		err = jsonutil.WriteFileAtomic(vault.keyBackupPath(fileName, timestamp), data, 0644)
+		if err != nil {
+			return "", err
+		}
+	}
+	return timestamp, nil
+}
+
+// KeyBackups returns the timestamps of the backups created
+// by BackupKeys(), oldest first
+func (vault *Vault) KeyBackups() ([]string, error) {
+	entries, err := ioutil.ReadDir(vault.DataDir())
+	if err != nil {
+		return nil, err
+	}
+	prefix := "encryptionKeys.js."
+	timestamps := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, prefix) && strings.HasSuffix(name, ".bak") {
+			timestamps = append(timestamps, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".bak"))
+		}
+	}
+	sort.Strings(timestamps)
+	return timestamps, nil
+}
+
+// RestoreKeys replaces the vault's key files with the backup
+// identified by timestamp, or the most recent backup if timestamp
+// is empty, reverting the master password to the one which was in
+// use when the backup was made. It returns the timestamp of the
+// restored backup.
+//
+// Backups made before the vault was re-encrypted with new keys
+// are refused, since they cannot decrypt the vault's items.
+func (vault *Vault) RestoreKeys(timestamp string) (string, error) {
+	if err := vault.checkWritable(); err != nil {
+		return "", err
+	}
+	if timestamp == "" {
+		timestamps, err := vault.KeyBackups()
+		if err != nil {
+			return "", err
+		}
+		if len(timestamps) == 0 {
+			return "", ErrNoKeyBackups
+		}
+		timestamp = timestamps[len(timestamps)-1]
+	}
+
+	unlock, err := vault.lockForWrite()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	var current, backup encryptionKeys
+	err = jsonutil.ReadFile(vault.DataDir()+"/encryptionKeys.js", &current)
+	if err != nil {
+		return "", fmt.Errorf("Unable to read current keys: %v", err)
+	}
+	err = jsonutil.ReadFile(vault.keyBackupPath("encryptionKeys.js", timestamp), &backup)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("No key backup from %s", timestamp)
+	} else if err != nil {
+		return "", fmt.Errorf("Unable to read key backup: %v", err)
+	}
+	if backup.SL5 != current.SL5 {
+		return "", errors.New("The key backup is from before the vault was re-encrypted with new keys")
+	}
+
+	for _, fileName := range keyFileNames {
+		data, err := ioutil.ReadFile(vault.keyBackupPath(fileName, timestamp))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		err = jsonutil.WriteFileAtomic(vault.DataDir()+"/"+fileName, data, 0644)
+		if err != nil {
+			return "", err
+		}
+	}
+	return timestamp, nil
+}
@@ -0,0 +1,57 @@
+package onepass
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRestoreKeys(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	_, err = vault.RestoreKeys("")
+	if err != ErrNoKeyBackups {
+		t.Errorf("Expected no key backups, got: %v", err)
+	}
+
+	backup, err := vault.BackupKeys(time.Unix(1400000000, 0))
+	if err != nil {
+		t.Fatalf("Unable to back up keys: %v", err)
+	}
+	err = vault.SetMasterPassword("test-pwd", "mistyped-pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = UnlockKeys(vault.Path, "test-pwd")
+	if err == nil {
+		t.Fatalf("Expected old password to be rejected after changing it")
+	}
+
+	backups, err := vault.KeyBackups()
+	if err != nil || len(backups) != 1 || backups[0] != backup {
+		t.Errorf("Unexpected key backups: %v (%v)", backups, err)
+	}
+	restored, err := vault.RestoreKeys("")
+	if err != nil {
+		t.Fatalf("Unable to restore keys: %v", err)
+	}
+	if restored != backup {
+		t.Errorf("Expected backup %s to be restored, got %s", backup, restored)
+	}
+	keys, err := UnlockKeys(vault.Path, "test-pwd")
+	if err != nil {
+		t.Fatalf("Expected old password to work after restoring keys: %v", err)
+	}
+	keys.Wipe()
+
+	// backups made before re-encrypting cannot be restored
+	err = vault.ReEncrypt("test-pwd", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = vault.RestoreKeys(backup)
+	if err == nil {
+		t.Errorf("Expected backup from before re-encryption to be refused")
+	}
+}
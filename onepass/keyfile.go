@@ -0,0 +1,83 @@
+package onepass
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/robertknight/1pass/jsonutil"
+)
+
+// length of an encrypted key or validation block in encryptionKeys.js:
+// the 'Salted__' prefix and salt followed by the encrypted 1024-byte
+// key and a block of padding
+const encryptedKeyLen = 16 + agileKeychainKeyLen + AesBlockLen
+
+// KeyFileError is returned by UnlockKeys() if the vault's
+// encryptionKeys.js file cannot be read or contains a malformed
+// key. Unlike a DecryptError, this indicates that the file is
+// corrupt rather than that the master password is wrong.
+type KeyFileError struct {
+	// security level of the malformed key or empty if the
+	// problem is with the file as a whole
+	Level string
+
+	Problem string
+}
+
+func (err KeyFileError) Error() string {
+	if err.Level == "" {
+		return fmt.Sprintf("Invalid encryptionKeys.js file: %s", err.Problem)
+	}
+	return fmt.Sprintf("Invalid %s key in encryptionKeys.js: %s", err.Level, err.Problem)
+}
+
+// IsKeyFileError returns true if err is a KeyFileError or is
+// the message of one received from another process, such as
+// the 1pass agent
+func IsKeyFileError(err error) bool {
+	if _, ok := err.(KeyFileError); ok {
+		return true
+	}
+	return err != nil && strings.Contains(err.Error(), " encryptionKeys.js")
+}
+
+// readKeyFile reads the encryptionKeys.js file in a
+// vault's data folder
+func readKeyFile(dataDir string) (encryptionKeys, error) {
+	var keyList encryptionKeys
+	err := jsonutil.ReadFile(dataDir+"/encryptionKeys.js", &keyList)
+	if os.IsNotExist(err) {
+		return keyList, KeyFileError{Problem: "the file does not exist"}
+	} else if err != nil {
+		return keyList, KeyFileError{Problem: err.Error()}
+	}
+	if len(keyList.List) == 0 {
+		return keyList, KeyFileError{Problem: "the file contains no keys"}
+	}
+	return keyList, nil
+}
+
+// checkFormat verifies the structure of an encrypted key and its
+// validation block, without decrypting them. A KeyFileError is
+// returned if the entry is malformed.
+func (entry encKeyEntry) checkFormat() error {
+	problem := ""
+	switch {
+	case entry.Level == "":
+		problem = "the key has no security level"
+	case len(entry.Data) != encryptedKeyLen:
+		problem = fmt.Sprintf("unexpected encrypted key length %d", len(entry.Data))
+	case !strings.HasPrefix(string(entry.Data), "Salted__"):
+		problem = "the encrypted key is missing its salt"
+	case entry.Iterations < 1:
+		problem = fmt.Sprintf("invalid PBKDF2 iteration count %d", entry.Iterations)
+	case !strings.HasPrefix(string(entry.Validation), "Salted__"):
+		problem = "the validation block is missing its salt"
+	case len(entry.Validation) <= 16 || (len(entry.Validation)-16)%AesBlockLen != 0:
+		problem = fmt.Sprintf("unexpected validation block length %d", len(entry.Validation))
+	default:
+		return nil
+	}
+	return KeyFileError{Level: entry.Level, Problem: problem}
+}
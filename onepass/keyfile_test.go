@@ -0,0 +1,91 @@
+package onepass
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestUnlockWrongPassword(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	err = vault.Unlock("wrong-pwd")
+	decryptErr, ok := err.(DecryptError)
+	if !ok {
+		t.Fatalf("Expected DecryptError for wrong password, got %v", err)
+	}
+	levels, _ := vault.SecurityLevels()
+	if len(decryptErr.Levels) != len(levels) {
+		t.Errorf("Expected all keys (%v) to fail validation, got %v", levels, decryptErr.Levels)
+	}
+	if IsKeyFileError(err) {
+		t.Errorf("Wrong password reported as a key file error: %v", err)
+	}
+}
+
+func TestUnlockCorruptKeyFile(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	keyList, err := readKeyFile(vault.DataDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkCorrupt := func(corrupt func(keys *encryptionKeys), level string) {
+		keys := keyList
+		keys.List = append([]encKeyEntry{}, keyList.List...)
+		corrupt(&keys)
+		err := saveEncryptionKeys(vault.DataDir(), keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = vault.Unlock("test-pwd")
+		keyErr, ok := err.(KeyFileError)
+		if !ok {
+			t.Errorf("Expected KeyFileError, got %v", err)
+			return
+		}
+		if keyErr.Level != level {
+			t.Errorf("Expected problem with key '%s', got '%s' (%v)", level, keyErr.Level, err)
+		}
+	}
+
+	level := keyList.List[0].Level
+	checkCorrupt(func(keys *encryptionKeys) {
+		keys.List[0].Data = keys.List[0].Data[0:100]
+	}, level)
+	checkCorrupt(func(keys *encryptionKeys) {
+		keys.List[0].Validation = []byte("not a validation block")
+	}, level)
+	checkCorrupt(func(keys *encryptionKeys) {
+		keys.List[0].Iterations = 0
+	}, level)
+	checkCorrupt(func(keys *encryptionKeys) {
+		keys.List = nil
+	}, "")
+
+	err = ioutil.WriteFile(vault.DataDir()+"/encryptionKeys.js", []byte("{not json"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = vault.Unlock("test-pwd")
+	if _, ok := err.(KeyFileError); !ok {
+		t.Errorf("Expected KeyFileError for invalid JSON, got %v", err)
+	}
+
+	os.Remove(vault.DataDir() + "/encryptionKeys.js")
+	err = vault.Unlock("test-pwd")
+	if _, ok := err.(KeyFileError); !ok {
+		t.Errorf("Expected KeyFileError for missing key file, got %v", err)
+	}
+
+	// key file errors received from the agent only have a message
+	if !IsKeyFileError(errors.New(err.Error())) {
+		t.Errorf("Expected '%v' to be recognized as a key file error", err)
+	}
+}
@@ -0,0 +1,51 @@
+package onepass
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// file in a vault's data directory which is locked while the
+// vault's item files or index are changed, so that concurrent
+// writers, such as two 1pass processes or the agent and a sync
+// client, do not overwrite each other's changes
+const writeLockFile = ".1pass.lock"
+
+// how long to wait for another process to finish changing
+// the vault before giving up
+var writeLockTimeout = 30 * time.Second
+
+const writeLockPollInterval = 20 * time.Millisecond
+
+// lockForWrite acquires an exclusive advisory lock on the vault,
+// waiting for other processes which hold it, and returns a
+// function which releases the lock. Locks are not re-entrant, so
+// functions which hold the lock must not call others which take it.
+func (vault *Vault) lockForWrite() (func(), error) {
+	lockPath := vault.DataDir() + "/" + writeLockFile
+	file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open vault lock file: %v", err)
+	}
+	deadline := time.Now().Add(writeLockTimeout)
+	for {
+		locked, err := tryLockFile(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("Unable to lock vault: %v", err)
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, fmt.Errorf("Timed out waiting for another process to finish changing the vault")
+		}
+		time.Sleep(writeLockPollInterval)
+	}
+	return func() {
+		unlockFile(file)
+		file.Close()
+	}, nil
+}
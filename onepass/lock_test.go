@@ -0,0 +1,50 @@
+package onepass
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockForWrite(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	defer func(timeout time.Duration) { writeLockTimeout = timeout }(writeLockTimeout)
+	writeLockTimeout = 100 * time.Millisecond
+
+	unlock, err := vault.lockForWrite()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// writers must wait while another holds the lock
+	_, err = vault.AddItem("Blocked", "webforms.WebForm", ItemContent{})
+	if err == nil {
+		t.Errorf("Expected save to time out while the vault is locked")
+	}
+	// including those used by sync clients
+	err = vault.WriteItemFile("AB120000000000000000000000000000", []byte("{}"))
+	if err == nil {
+		t.Errorf("Expected item file write to time out while the vault is locked")
+	}
+	err = vault.WriteKeyFile(".password.hint", []byte("hint"))
+	if err == nil {
+		t.Errorf("Expected key file write to time out while the vault is locked")
+	}
+
+	unlock()
+	_, err = vault.AddItem("Unblocked", "webforms.WebForm", ItemContent{})
+	if err != nil {
+		t.Errorf("Failed to save item after lock was released: %v", err)
+	}
+
+	err = vault.WriteKeyFile(".password.hint", []byte("hint"))
+	if err != nil {
+		t.Errorf("Failed to write key file after lock was released: %v", err)
+	}
+	err = vault.WriteKeyFile("contents.js", []byte("[]"))
+	if err == nil {
+		t.Errorf("Expected write of a file which is not a key file to fail")
+	}
+}
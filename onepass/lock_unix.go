@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package onepass
+
+import (
+	"os"
+	"syscall"
+)
+
+// tries to take an exclusive flock() on file, returning
+// false if another open file description holds it
+func tryLockFile(file *os.File) (bool, error) {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlockFile(file *os.File) {
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,123 @@
+package onepass
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// prefix of vault paths which refer to an in-memory vault,
+// optionally followed by the path of an export to seed it with
+const MemoryVaultScheme = "mem://"
+
+// PBKDF2 iterations used for the keys of in-memory vaults,
+// which are never written to disk
+const memoryVaultIterations = 1000
+
+// IsMemoryVaultPath returns true if path refers
+// to an in-memory vault, eg. 'mem://'
+func IsMemoryVaultPath(path string) bool {
+	return strings.HasPrefix(path, MemoryVaultScheme)
+}
+
+// memoryBackend is a VaultBackend which holds items and
+// encryption keys only in memory, so that nothing is written
+// to disk and the vault's content is lost when it is discarded
+type memoryBackend struct {
+	mu    sync.Mutex
+	items map[string]Item
+	keys  []encKeyEntry
+}
+
+// NewMemoryVault returns a new, empty vault which is stored only in
+// memory and is protected by the master password pwd. The vault is
+// initially locked and must be unlocked with Unlock().
+//
+// Items can be copied into the vault from an export with ImportItem().
+func NewMemoryVault(pwd string) (Vault, error) {
+	randomKey := randomBytes(agileKeychainKeyLen)
+	defer ZeroBytes(randomKey)
+	salt := randomBytes(8)
+	encryptedKey, validation, err := encryptKey([]byte(pwd), randomKey, salt, memoryVaultIterations)
+	if err != nil {
+		return Vault{}, fmt.Errorf("Failed to generate encryption key")
+	}
+	store := &memoryBackend{
+		items: map[string]Item{},
+		keys: []encKeyEntry{{
+			Data:       []byte(fmt.Sprintf("Salted__%s%s", salt, encryptedKey)),
+			Identifier: newItemId(),
+			Iterations: memoryVaultIterations,
+			Level:      "SL5",
+			Validation: validation,
+		}},
+	}
+	return Vault{Path: MemoryVaultScheme, Backend: store}, nil
+}
+
+func (store *memoryBackend) ListItems() ([]Item, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	items := []Item{}
+	for _, item := range store.items {
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (store *memoryBackend) LoadItem(uuid string) (Item, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	item, ok := store.items[uuid]
+	if !ok {
+		return Item{}, fmt.Errorf("Item %s not found", uuid)
+	}
+	return item, nil
+}
+
+func (store *memoryBackend) SaveItem(item Item) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	item.vault = nil
+	item.Encrypted = append([]byte(nil), item.Encrypted...)
+	store.items[item.Uuid] = item
+	return nil
+}
+
+func (store *memoryBackend) RemoveItem(uuid string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.items[uuid]; !ok {
+		return fmt.Errorf("Entry for item %s not found", uuid)
+	}
+	delete(store.items, uuid)
+	return nil
+}
+
+func (store *memoryBackend) UnlockKeys(pwd string) (KeyDict, error) {
+	pwdBytes := []byte(pwd)
+	defer ZeroBytes(pwdBytes)
+
+	keys := KeyDict{}
+	for _, entry := range store.keys {
+		salt, encryptedKey, _ := extractSaltAndCipherText(entry.Data)
+		decryptedKey, err := decryptKey(pwdBytes, encryptedKey, salt, entry.Iterations, entry.Validation)
+		if err != nil {
+			keys.Wipe()
+			return KeyDict{}, DecryptError{
+				err:    fmt.Errorf("Incorrect master password, the %s key failed validation", entry.Level),
+				Levels: []string{entry.Level},
+			}
+		}
+		keys[entry.Level] = secureBytes(decryptedKey)
+	}
+	return keys, nil
+}
+
+func (store *memoryBackend) SecurityLevels() ([]string, error) {
+	levels := []string{}
+	for _, entry := range store.keys {
+		levels = append(levels, entry.Level)
+	}
+	return levels, nil
+}
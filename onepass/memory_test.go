@@ -0,0 +1,77 @@
+package onepass
+
+import (
+	"testing"
+)
+
+func TestMemoryVault(t *testing.T) {
+	vault, err := NewMemoryVault("mem-pwd")
+	if err != nil {
+		t.Fatalf("Creating memory vault failed: %v", err)
+	}
+	if !IsMemoryVaultPath(vault.Path) {
+		t.Errorf("Expected '%s' to be a memory vault path", vault.Path)
+	}
+	err = vault.Unlock("wrong-pwd")
+	if _, ok := err.(DecryptError); !ok {
+		t.Errorf("Expected wrong password to be rejected, got %v", err)
+	}
+	err = vault.Unlock("mem-pwd")
+	if err != nil {
+		t.Fatalf("Unlocking memory vault failed: %v", err)
+	}
+
+	item, err := vault.AddItem("Memory Item", "securenotes.SecureNote", newTestContent("memory.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	importedId := "AB120000000000000000000000000000"
+	exported := ExportedItem{Item: Item{Uuid: importedId, Title: "Imported", TypeName: "securenotes.SecureNote"},
+		SecureContents: newTestContent("imported.com")}
+	imported, err := vault.ImportItem(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Uuid != importedId {
+		t.Errorf("Expected imported item to keep its ID, got %s", imported.Uuid)
+	}
+
+	items, err := vault.ListItems()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(items))
+	}
+	loaded, err := vault.LoadItem(item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := loaded.Content()
+	if err != nil {
+		t.Fatalf("Failed to decrypt item: %v", err)
+	}
+	if content.Urls[0].Url != "memory.com" {
+		t.Errorf("Unexpected item content: %v", content)
+	}
+
+	err = loaded.Remove()
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, _ = vault.ListItems()
+	if len(items) != 1 || items[0].Uuid != imported.Uuid {
+		t.Errorf("Expected only '%s' after removing '%s', got %v", imported.Title, item.Title, items)
+	}
+
+	_, err = vault.AddDocument("Document", "doc.txt", []byte("data"))
+	if err == nil {
+		t.Errorf("Expected documents to be rejected by memory vaults")
+	}
+
+	vault.Lock()
+	_, err = loaded.Content()
+	if err == nil {
+		t.Errorf("Expected content to be unreadable after locking")
+	}
+}
@@ -0,0 +1,150 @@
+package onepass
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// keys of an item's openContents block which are
+// stored in fields of ItemOpenContents
+var openContentsKeys = []string{"tags", "scope", "expires", "urlMatch", "usernameHash"}
+
+func (contents *ItemOpenContents) UnmarshalJSON(data []byte) error {
+	type plainContents ItemOpenContents
+	var plain plainContents
+	err := json.Unmarshal(data, &plain)
+	if err != nil {
+		return err
+	}
+	var other map[string]json.RawMessage
+	err = json.Unmarshal(data, &other)
+	if err != nil {
+		return err
+	}
+	for _, key := range openContentsKeys {
+		delete(other, key)
+	}
+	*contents = ItemOpenContents(plain)
+	if len(other) > 0 {
+		contents.Other = other
+	}
+	return nil
+}
+
+func (contents ItemOpenContents) MarshalJSON() ([]byte, error) {
+	type plainContents ItemOpenContents
+	data, err := json.Marshal(plainContents(contents))
+	if err != nil || len(contents.Other) == 0 {
+		return data, err
+	}
+	var all map[string]json.RawMessage
+	err = json.Unmarshal(data, &all)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range contents.Other {
+		if _, ok := all[key]; !ok {
+			all[key] = value
+		}
+	}
+	return json.Marshal(all)
+}
+
+// Meta returns the item's unencrypted metadata: the values in
+// its openContents block, including any which 1pass does not
+// use, and its position in the favorites list. Values which are
+// not set are omitted.
+func (item *Item) Meta() map[string]string {
+	meta := map[string]string{}
+	set := func(key string, value string) {
+		if value != "" && value != "0" {
+			meta[key] = value
+		}
+	}
+	set("faveIndex", strconv.Itoa(item.FaveIndex))
+	set("tags", strings.Join(item.OpenContents.Tags, ","))
+	set("scope", item.OpenContents.Scope)
+	set("expires", strconv.FormatUint(item.OpenContents.Expires, 10))
+	set("urlMatch", item.OpenContents.UrlMatch)
+	set("usernameHash", item.OpenContents.UsernameHash)
+	for key, value := range item.OpenContents.Other {
+		var str string
+		if json.Unmarshal(value, &str) != nil {
+			str = string(value)
+		}
+		set(key, str)
+	}
+	return meta
+}
+
+// MetaKeys returns the sorted keys of the item's metadata
+func (item *Item) MetaKeys() []string {
+	keys := []string{}
+	for key := range item.Meta() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SetMeta sets a value in the item's unencrypted metadata.
+// An empty value removes the key. Keys which 1pass does not
+// use are stored as JSON if value is valid JSON or as a
+// string otherwise.
+func (item *Item) SetMeta(key string, value string) error {
+	switch key {
+	case "faveIndex", "expires":
+		number := 0
+		if value != "" {
+			var err error
+			number, err = strconv.Atoi(value)
+			if err != nil || number < 0 {
+				return fmt.Errorf("%s must be a positive number", key)
+			}
+		}
+		if key == "faveIndex" {
+			item.FaveIndex = number
+		} else {
+			item.OpenContents.Expires = uint64(number)
+		}
+	case "tags":
+		item.OpenContents.Tags = nil
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				item.OpenContents.Tags = append(item.OpenContents.Tags, tag)
+			}
+		}
+	case "scope":
+		if value != "" && value != "Always" && value != ScopeNever {
+			return fmt.Errorf("scope must be 'Always' or '%s'", ScopeNever)
+		}
+		item.OpenContents.Scope = value
+	case "urlMatch":
+		if value != UrlMatchDomain && value != UrlMatchHost {
+			return fmt.Errorf("urlMatch must be '%s' or empty", UrlMatchHost)
+		}
+		item.OpenContents.UrlMatch = value
+	case "usernameHash":
+		item.OpenContents.UsernameHash = value
+	default:
+		if key == "" {
+			return fmt.Errorf("Missing metadata key")
+		}
+		if value == "" {
+			delete(item.OpenContents.Other, key)
+			return nil
+		}
+		raw := json.RawMessage(value)
+		if !json.Valid(raw) {
+			raw, _ = json.Marshal(value)
+		}
+		if item.OpenContents.Other == nil {
+			item.OpenContents.Other = map[string]json.RawMessage{}
+		}
+		item.OpenContents.Other[key] = raw
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package onepass
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOpenContentsRoundTrip(t *testing.T) {
+	data := `{"tags":["work"],"scope":"Always","usernameHash":"abc123","autosubmit":"never","uuids":[1,2]}`
+	var contents ItemOpenContents
+	err := json.Unmarshal([]byte(data), &contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contents.UsernameHash != "abc123" || contents.Scope != "Always" || len(contents.Tags) != 1 {
+		t.Errorf("Unexpected contents %+v", contents)
+	}
+	if len(contents.Other) != 2 {
+		t.Errorf("Expected unknown keys to be kept, got %v", contents.Other)
+	}
+
+	saved, err := json.Marshal(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var savedMap map[string]interface{}
+	json.Unmarshal(saved, &savedMap)
+	if savedMap["autosubmit"] != "never" || savedMap["usernameHash"] != "abc123" || savedMap["uuids"] == nil {
+		t.Errorf("Unknown keys were not saved: %s", saved)
+	}
+}
+
+func TestItemMeta(t *testing.T) {
+	item := Item{FaveIndex: 2}
+	for key, value := range map[string]string{
+		"tags":       "work, banking",
+		"scope":      "Never",
+		"autosubmit": "never",
+		"custom":     `{"a":1}`,
+	} {
+		err := item.SetMeta(key, value)
+		if err != nil {
+			t.Errorf("Failed to set %s: %v", key, err)
+		}
+	}
+	meta := item.Meta()
+	expected := map[string]string{
+		"faveIndex":  "2",
+		"tags":       "work,banking",
+		"scope":      "Never",
+		"autosubmit": "never",
+		"custom":     `{"a":1}`,
+	}
+	for key, value := range expected {
+		if meta[key] != value {
+			t.Errorf("Expected %s to be '%s', got '%s'", key, value, meta[key])
+		}
+	}
+	if len(meta) != len(expected) {
+		t.Errorf("Unexpected metadata %v", meta)
+	}
+
+	item.SetMeta("autosubmit", "")
+	if _, ok := item.Meta()["autosubmit"]; ok {
+		t.Errorf("Expected key to be removed")
+	}
+	if item.SetMeta("scope", "Sometimes") == nil {
+		t.Errorf("Expected invalid scope to be rejected")
+	}
+	if item.SetMeta("faveIndex", "first") == nil {
+		t.Errorf("Expected invalid favorites index to be rejected")
+	}
+}
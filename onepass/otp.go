@@ -0,0 +1,228 @@
+package onepass
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Totp holds the parameters of a time-based one-time password,
+// as given in an 'otpauth://totp/' URI, or of a counter-based
+// password given in an 'otpauth://hotp/' URI
+type Totp struct {
+	// service and account the password is for, from the URI's
+	// label and 'issuer' parameter
+	Issuer  string
+	Account string
+
+	Secret []byte
+
+	// hash function used to generate codes: SHA1, SHA256 or SHA512
+	Algorithm string
+
+	// number of digits in each code
+	Digits int
+
+	// number of seconds for which each code is valid
+	Period int
+
+	// format of codes, either empty for numeric codes or
+	// SteamEncoder for Steam Guard codes
+	Encoder string
+
+	// true for HOTP passwords, which are generated from Counter
+	// rather than the time
+	CounterBased bool
+	Counter      uint64
+}
+
+// Totp.Encoder value for the 5-character codes used by Steam
+// Guard. Fields with a 'steam://<secret>' value or an otpauth
+// URI with an 'encoder=steam' parameter generate these codes.
+const SteamEncoder = "steam"
+
+// characters used in Steam Guard codes
+const steamCodeChars = "23456789BCDFGHJKMNPQRTVWXY"
+
+const steamCodeLength = 5
+
+// parameters used by services which do not specify them
+const (
+	defaultTotpAlgorithm = "SHA1"
+	defaultTotpDigits    = 6
+	defaultTotpPeriod    = 30
+)
+
+// ParseTotp parses the value of a one-time password field, which
+// is an 'otpauth://totp/' or 'otpauth://hotp/' URI, a 'steam://'
+// URI or a bare base32 secret
+func ParseTotp(value string) (Totp, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "steam://") {
+		totp, err := newTotp(strings.TrimPrefix(value, "steam://"))
+		totp.Encoder = SteamEncoder
+		totp.Digits = steamCodeLength
+		return totp, err
+	}
+	if !strings.HasPrefix(value, "otpauth://") {
+		return newTotp(value)
+	}
+	uri, err := url.Parse(value)
+	if err != nil {
+		return Totp{}, fmt.Errorf("Invalid one-time password URI: %v", err)
+	}
+	if uri.Host != "totp" && uri.Host != "hotp" {
+		return Totp{}, fmt.Errorf("Unsupported one-time password type '%s'", uri.Host)
+	}
+	params := uri.Query()
+	totp, err := newTotp(params.Get("secret"))
+	if err != nil {
+		return Totp{}, err
+	}
+	if uri.Host == "hotp" {
+		totp.CounterBased = true
+		totp.Counter, err = strconv.ParseUint(params.Get("counter"), 10, 64)
+		if err != nil {
+			return Totp{}, fmt.Errorf("Invalid one-time password counter '%s'", params.Get("counter"))
+		}
+	}
+
+	label := strings.TrimPrefix(uri.Path, "/")
+	if sep := strings.Index(label, ":"); sep != -1 {
+		totp.Issuer = strings.TrimSpace(label[0:sep])
+		label = label[sep+1:]
+	}
+	totp.Account = strings.TrimSpace(label)
+	if issuer := params.Get("issuer"); issuer != "" {
+		totp.Issuer = issuer
+	}
+
+	if algorithm := params.Get("algorithm"); algorithm != "" {
+		totp.Algorithm = strings.ToUpper(algorithm)
+		if totpHash(totp.Algorithm) == nil {
+			return Totp{}, fmt.Errorf("Unsupported one-time password algorithm '%s'", algorithm)
+		}
+	}
+	if digits := params.Get("digits"); digits != "" {
+		totp.Digits, err = strconv.Atoi(digits)
+		if err != nil || totp.Digits < 6 || totp.Digits > 10 {
+			return Totp{}, fmt.Errorf("Invalid number of one-time password digits '%s'", digits)
+		}
+	}
+	if period := params.Get("period"); period != "" {
+		totp.Period, err = strconv.Atoi(period)
+		if err != nil || totp.Period < 1 {
+			return Totp{}, fmt.Errorf("Invalid one-time password period '%s'", period)
+		}
+	}
+	switch encoder := strings.ToLower(params.Get("encoder")); encoder {
+	case "":
+	case SteamEncoder:
+		totp.Encoder = SteamEncoder
+		totp.Digits = steamCodeLength
+	default:
+		return Totp{}, fmt.Errorf("Unsupported one-time password encoder '%s'", encoder)
+	}
+	return totp, nil
+}
+
+// newTotp returns the default parameters for a base32 secret
+func newTotp(secret string) (Totp, error) {
+	secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	secret = strings.TrimRight(secret, "=")
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil || len(key) == 0 {
+		return Totp{}, fmt.Errorf("One-time password secret is not valid base32")
+	}
+	return Totp{
+		Secret:    key,
+		Algorithm: defaultTotpAlgorithm,
+		Digits:    defaultTotpDigits,
+		Period:    defaultTotpPeriod,
+	}, nil
+}
+
+func totpHash(algorithm string) func() hash.Hash {
+	switch algorithm {
+	case "SHA1":
+		return sha1.New
+	case "SHA256":
+		return sha256.New
+	case "SHA512":
+		return sha512.New
+	}
+	return nil
+}
+
+// Code returns the one-time password for time now, as
+// described in RFC 6238, or for the current counter value
+// of an HOTP password
+func (totp Totp) Code(now time.Time) string {
+	if totp.CounterBased {
+		return totp.counterCode(totp.Counter)
+	}
+	return totp.counterCode(uint64(now.Unix() / int64(totp.Period)))
+}
+
+// counterCode returns the one-time password for a counter
+// value, as described in RFC 4226
+func (totp Totp) counterCode(counterValue uint64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], counterValue)
+	mac := hmac.New(totpHash(totp.Algorithm), totp.Secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	value := uint64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+	if totp.Encoder == SteamEncoder {
+		return steamCode(value)
+	}
+	modulus := uint64(1)
+	for i := 0; i < totp.Digits; i++ {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", totp.Digits, value%modulus)
+}
+
+// steamCode formats a truncated HMAC value as a Steam Guard code
+func steamCode(value uint64) string {
+	code := make([]byte, steamCodeLength)
+	for i := range code {
+		code[i] = steamCodeChars[value%uint64(len(steamCodeChars))]
+		value /= uint64(len(steamCodeChars))
+	}
+	return string(code)
+}
+
+// Remaining returns how long the code for time now remains valid
+func (totp Totp) Remaining(now time.Time) time.Duration {
+	period := int64(totp.Period)
+	return time.Duration(period-now.Unix()%period) * time.Second
+}
+
+// TotpFields returns the one-time password fields in content,
+// which are fields named with TotpFieldPrefix or whose value
+// is an 'otpauth://' or 'steam://' URI
+func (content *ItemContent) TotpFields() []ItemField {
+	fields := []ItemField{}
+	for _, section := range content.Sections {
+		for _, field := range section.Fields {
+			value := field.ValueString()
+			if strings.HasPrefix(field.Name, TotpFieldPrefix) ||
+				strings.HasPrefix(value, "otpauth://") || strings.HasPrefix(value, "steam://") {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
@@ -0,0 +1,106 @@
+package onepass
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTotpCode(t *testing.T) {
+	// test vectors from RFC 6238, using the 8-digit codes
+	uris := map[string]string{
+		"SHA1":   "otpauth://totp/Example:alice@example.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8&issuer=Example",
+		"SHA256": "otpauth://totp/test?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZA&algorithm=SHA256&digits=8",
+		"SHA512": "otpauth://totp/test?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNA&algorithm=sha512&digits=8",
+	}
+	expected := map[string]string{
+		"SHA1":   "94287082",
+		"SHA256": "46119246",
+		"SHA512": "90693936",
+	}
+	now := time.Unix(59, 0)
+	for algorithm, uri := range uris {
+		totp, err := ParseTotp(uri)
+		if err != nil {
+			t.Fatalf("Failed to parse %s URI: %v", algorithm, err)
+		}
+		if totp.Algorithm != algorithm || totp.Digits != 8 || totp.Period != 30 {
+			t.Errorf("Unexpected parameters %+v", totp)
+		}
+		if code := totp.Code(now); code != expected[algorithm] {
+			t.Errorf("Expected %s code %s, got %s", algorithm, expected[algorithm], code)
+		}
+	}
+}
+
+func TestParseTotp(t *testing.T) {
+	totp, err := ParseTotp("otpauth://totp/ACME%20Co:jim@example.com?secret=JBSWY3DPEHPK3PXP&period=60")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totp.Issuer != "ACME Co" || totp.Account != "jim@example.com" {
+		t.Errorf("Unexpected label %+v", totp)
+	}
+	if totp.Period != 60 || totp.Digits != 6 || totp.Algorithm != "SHA1" {
+		t.Errorf("Unexpected parameters %+v", totp)
+	}
+	if remaining := totp.Remaining(time.Unix(125, 0)); remaining != 55*time.Second {
+		t.Errorf("Unexpected remaining time %v", remaining)
+	}
+
+	// bare secrets use the default parameters
+	totp, err = ParseTotp("jbsw y3dp ehpk 3pxp")
+	if err != nil || totp.Digits != 6 || totp.Period != 30 {
+		t.Errorf("Failed to parse secret: %+v %v", totp, err)
+	}
+
+	for _, value := range []string{
+		"otpauth://hotp/test?secret=JBSWY3DPEHPK3PXP",
+		"otpauth://totp/test?secret=JBSWY3DPEHPK3PXP&algorithm=MD5",
+		"otpauth://totp/test?secret=JBSWY3DPEHPK3PXP&digits=4",
+		"otpauth://totp/test?secret=JBSWY3DPEHPK3PXP&period=0",
+		"otpauth://totp/test?secret=not-base32",
+		"",
+	} {
+		if _, err := ParseTotp(value); err == nil {
+			t.Errorf("Expected '%s' to be rejected", value)
+		}
+	}
+}
+
+func TestTotpFields(t *testing.T) {
+	content := ItemContent{}
+	AddTotpField(&content, "otpauth://totp/test?secret=JBSWY3DPEHPK3PXP")
+	content.Sections = append(content.Sections, ItemSection{
+		Fields: []ItemField{
+			{Kind: "string", Name: "otp", Value: "otpauth://totp/other?secret=JBSWY3DPEHPK3PXP"},
+			{Kind: "string", Name: "username", Value: "jim"},
+		},
+	})
+	if fields := content.TotpFields(); len(fields) != 2 {
+		t.Errorf("Expected 2 one-time password fields, found %d", len(fields))
+	}
+}
+
+func TestSteamCode(t *testing.T) {
+	for _, value := range []string{
+		"steam://JBSWY3DPEHPK3PXP",
+		"otpauth://totp/Steam:jim?secret=JBSWY3DPEHPK3PXP&issuer=Steam&encoder=steam",
+	} {
+		totp, err := ParseTotp(value)
+		if err != nil {
+			t.Fatalf("Failed to parse '%s': %v", value, err)
+		}
+		if totp.Encoder != SteamEncoder {
+			t.Errorf("Expected Steam encoder for '%s'", value)
+		}
+		if code := totp.Code(time.Unix(59, 0)); code != "2YXGV" {
+			t.Errorf("Unexpected Steam code '%s'", code)
+		}
+		if code := totp.Code(time.Unix(1700000000, 0)); code != "2KM2P" {
+			t.Errorf("Unexpected Steam code '%s'", code)
+		}
+	}
+	if _, err := ParseTotp("otpauth://totp/test?secret=JBSWY3DPEHPK3PXP&encoder=other"); err == nil {
+		t.Errorf("Expected unknown encoder to be rejected")
+	}
+}
@@ -0,0 +1,88 @@
+package onepass
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// letters used by GenPronounceablePassword(). Letters which
+// are easily confused when read aloud or written down, such
+// as 'c'/'k' and 'q', are left out.
+const (
+	pronounceableConsonants = "bdfghjkmnprstvz"
+	pronounceableVowels     = "aeiou"
+)
+
+// returns a uniformly distributed random number in [0, n)
+func randomInt(n int) int {
+	value, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		panic("Failed to read random number")
+	}
+	return int(value.Int64())
+}
+
+// returns a random character from chars
+func randomChar(chars string) byte {
+	return chars[randomInt(len(chars))]
+}
+
+// GenPronounceablePassword generates a password of length chars
+// made of alternating consonants and vowels followed by two digits,
+// eg. 'Bakomifute47', which is easier to type by hand than the
+// output of GenPassword(). Since there are fewer possible characters
+// in each position, a longer password is needed for the same
+// strength.
+func GenPronounceablePassword(length int) string {
+	if length < 4 {
+		panic("Minimum password length is 4 chars")
+	}
+	letters := []byte{}
+	for i := 0; i < length-2; i++ {
+		if i%2 == 0 {
+			letters = append(letters, randomChar(pronounceableConsonants))
+		} else {
+			letters = append(letters, randomChar(pronounceableVowels))
+		}
+	}
+	password := strings.ToUpper(string(letters[0:1])) + string(letters[1:])
+	return password + GenPIN(2)
+}
+
+// GenPIN generates a random numeric code with the given
+// number of digits, for use as a PIN or passcode
+func GenPIN(digits int) string {
+	if digits < 1 {
+		panic("Minimum PIN length is 1 digit")
+	}
+	pin := make([]byte, digits)
+	for i := range pin {
+		pin[i] = randomChar("0123456789")
+	}
+	return string(pin)
+}
+
+// GenUsername generates a random, lower-case handle such
+// as 'bakomidu52' for use as a throwaway username
+func GenUsername() string {
+	return strings.ToLower(GenPronounceablePassword(10))
+}
+
+// GenEmailAlias generates a random plus-addressed alias of
+// the email address base, eg. 'jim+dakovu27@example.com' for
+// 'jim@example.com'. Most mail providers deliver mail for
+// such aliases to the base address.
+func GenEmailAlias(base string) (string, error) {
+	at := strings.LastIndex(base, "@")
+	if at < 1 || at == len(base)-1 {
+		return "", fmt.Errorf("'%s' is not a valid email address", base)
+	}
+	local := base[0:at]
+	if plus := strings.Index(local, "+"); plus != -1 {
+		local = local[0:plus]
+	}
+	tag := strings.ToLower(GenPronounceablePassword(8))
+	return local + "+" + tag + base[at:], nil
+}
@@ -0,0 +1,73 @@
+package onepass
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestGenPronounceablePassword(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		pwd := GenPronounceablePassword(12)
+		if len(pwd) != 12 {
+			t.Fatalf("Expected 12 chars, got '%s'", pwd)
+		}
+		if !unicode.IsUpper(rune(pwd[0])) {
+			t.Errorf("Expected first letter to be upper case: '%s'", pwd)
+		}
+		letters := strings.ToLower(pwd[:10])
+		for k := 0; k < len(letters); k++ {
+			chars := pronounceableConsonants
+			if k%2 == 1 {
+				chars = pronounceableVowels
+			}
+			if !strings.ContainsRune(chars, rune(letters[k])) {
+				t.Errorf("Expected alternating consonants and vowels: '%s'", pwd)
+				break
+			}
+		}
+		if !unicode.IsDigit(rune(pwd[10])) || !unicode.IsDigit(rune(pwd[11])) {
+			t.Errorf("Expected password to end with two digits: '%s'", pwd)
+		}
+	}
+}
+
+func TestGenPIN(t *testing.T) {
+	for _, digits := range []int{1, 4, 8} {
+		pin := GenPIN(digits)
+		if len(pin) != digits {
+			t.Errorf("Expected %d digits, got '%s'", digits, pin)
+		}
+		for _, ch := range pin {
+			if !unicode.IsDigit(ch) {
+				t.Errorf("Expected only digits in PIN '%s'", pin)
+			}
+		}
+	}
+}
+
+func TestGenUsername(t *testing.T) {
+	username := GenUsername()
+	if len(username) != 10 || strings.ToLower(username) != username {
+		t.Errorf("Unexpected username '%s'", username)
+	}
+}
+
+func TestGenEmailAlias(t *testing.T) {
+	for _, base := range []string{"jim@example.com", "jim+old@example.com"} {
+		alias, err := GenEmailAlias(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(alias, "jim+") || !strings.HasSuffix(alias, "@example.com") ||
+			strings.Count(alias, "+") != 1 {
+			t.Errorf("Unexpected alias '%s' for '%s'", alias, base)
+		}
+	}
+	for _, base := range []string{"", "jim", "@example.com", "jim@"} {
+		_, err := GenEmailAlias(base)
+		if err == nil {
+			t.Errorf("Expected error for invalid address '%s'", base)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package onepass
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/robertknight/1pass/jsonutil"
+)
+
+// ContentsIndexIsStale returns true if the vault's contents.js
+// index needs to be rebuilt with RebuildContentsIndex(). This is the
+// case if the index is missing or cannot be parsed or if it does not
+// list exactly the item files in the vault, which commonly happens
+// after item files are restored by hand or a sync is interrupted.
+//
+// Only the item file names are compared with the index, and only if
+// the data folder has been modified since contents.js was written, so
+// that the check is cheap enough to run before every command. Entries
+// whose title or other details differ from their item file are
+// reported by CheckIntegrity().
+func (vault *Vault) ContentsIndexIsStale() (bool, error) {
+	contentsPath := vault.DataDir() + "/contents.js"
+	contentsInfo, err := os.Stat(contentsPath)
+	if os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	data, err := ioutil.ReadFile(contentsPath)
+	if err != nil {
+		return false, err
+	}
+	entries, err := ParseContentsIndex(data)
+	if err != nil {
+		return true, nil
+	}
+
+	// item files are only listed if files have been added to or
+	// removed from the data folder since contents.js was written
+	dirInfo, err := os.Stat(vault.DataDir())
+	if err != nil {
+		return false, err
+	}
+	if !dirInfo.ModTime().After(contentsInfo.ModTime()) {
+		return false, nil
+	}
+
+	indexed := map[string]bool{}
+	for _, entry := range entries {
+		indexed[entry.Uuid] = true
+	}
+
+	dirEntries, err := ioutil.ReadDir(vault.DataDir())
+	if err != nil {
+		return false, err
+	}
+	itemCount := 0
+	for _, dirEntry := range dirEntries {
+		if path.Ext(dirEntry.Name()) != ".1password" {
+			continue
+		}
+		itemCount++
+		uuid := strings.TrimSuffix(dirEntry.Name(), ".1password")
+		if !indexed[uuid] {
+			return true, nil
+		}
+	}
+	return itemCount != len(indexed), nil
+}
+
+// RebuildContentsIndex replaces the vault's contents.js index with
+// one generated from the metadata in the vault's item files and
+// returns the number of entries in the new index. The vault does not
+// need to be unlocked as the metadata is not encrypted.
+func (vault *Vault) RebuildContentsIndex() (int, error) {
+	if err := vault.checkWritable(); err != nil {
+		return 0, err
+	}
+	unlock, err := vault.lockForWrite()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	items, err := vault.listItemFiles()
+	if err != nil {
+		return 0, fmt.Errorf("Failed to read item files: %v", err)
+	}
+	data, err := FormatContentsIndex(items)
+	if err != nil {
+		return 0, err
+	}
+	err = jsonutil.WriteFileAtomic(vault.DataDir()+"/contents.js", data, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to write contents.js: %v", err)
+	}
+	markContentsIndexCurrent(vault.DataDir())
+	return len(items), nil
+}
+
+// markContentsIndexCurrent sets the modification time of contents.js
+// in dataDir to that of dataDir after the index has been written.
+// Replacing contents.js changes the folder's modification time, which
+// would otherwise appear to ContentsIndexIsStale() as a later change
+// to the item files.
+//
+// Item files which are added or removed within the timestamp
+// granularity of the file system are not detected until the
+// folder changes again.
+func markContentsIndexCurrent(dataDir string) {
+	dirInfo, err := os.Stat(dataDir)
+	if err != nil {
+		return
+	}
+	modTime := dirInfo.ModTime()
+	err = os.Chtimes(dataDir+"/contents.js", modTime, modTime)
+	if err != nil {
+		DebugLog("Unable to update contents.js modification time: %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package onepass
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRebuildContentsIndex(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	item, err := vault.AddItem("Reindex Item", "securenotes.SecureNote", newTestContent("reindex.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStale := func(expected bool) {
+		stale, err := vault.ContentsIndexIsStale()
+		if err != nil {
+			t.Fatalf("Checking index failed: %v", err)
+		}
+		if stale != expected {
+			t.Errorf("Expected stale to be %v, got %v", expected, stale)
+		}
+	}
+	checkStale(false)
+
+	// the data folder's modification time may not change if item
+	// files are added or removed within the timestamp granularity
+	// of the file system, so contents.js is made older first
+	ageIndex := func() {
+		past := time.Now().Add(-time.Hour)
+		err := os.Chtimes(vault.DataDir()+"/contents.js", past, past)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// restore an item file which is not listed in contents.js
+	restored := item
+	restored.Uuid = "RESTORED"
+	restored.Title = "Restored Item"
+	restoredData, err := json.Marshal(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restoredPath := vault.DataDir() + "/RESTORED.1password"
+	ageIndex()
+	err = ioutil.WriteFile(restoredPath, restoredData, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStale(true)
+
+	count, err := vault.RebuildContentsIndex()
+	if err != nil {
+		t.Fatalf("Rebuilding index failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 entries in rebuilt index, got %d", count)
+	}
+	checkStale(false)
+
+	// item file modified after contents.js, but still listed in it
+	future := time.Now().Add(time.Hour)
+	err = os.Chtimes(item.Path(), future, future)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStale(false)
+
+	// details which differ from the index are reported by CheckIntegrity()
+	renamed := item
+	renamed.Title = "Renamed Item"
+	renamedData, err := json.Marshal(renamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(item.Path(), renamedData, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStale(false)
+	problems := vault.CheckIntegrity("test-pwd")
+	if len(problems) != 1 || problems[0].Path != item.Path() || problems[0].Fix != reindexFix {
+		t.Errorf("Expected out of date index entry to be reported, got %v", problems)
+	}
+
+	// missing contents.js
+	err = os.Remove(vault.DataDir() + "/contents.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStale(true)
+	_, err = vault.RebuildContentsIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStale(false)
+
+	items, err := vault.FindItems(func(overview Item) bool {
+		return overview.Title == "Restored Item"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Uuid != restored.Uuid {
+		t.Errorf("Expected rebuilt index to list '%s', got %v", restored.Title, items)
+	}
+
+	// removed item file
+	ageIndex()
+	err = os.Remove(restoredPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStale(true)
+}
+
+func TestStaleCheckSkipsUnchangedFolder(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	_, err = vault.AddItem("Indexed Item", "securenotes.SecureNote", newTestContent("reindex.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contentsInfo, err := os.Stat(vault.DataDir() + "/contents.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirInfo, err := os.Stat(vault.DataDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dirInfo.ModTime().After(contentsInfo.ModTime()) {
+		t.Errorf("Expected contents.js to be marked as current after saving an item")
+	}
+
+	// an unindexed item file is not noticed while the data folder's
+	// modification time is no later than that of contents.js
+	err = ioutil.WriteFile(vault.DataDir()+"/UNLISTED.1password", []byte("{}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(vault.DataDir(), contentsInfo.ModTime(), contentsInfo.ModTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale, err := vault.ContentsIndexIsStale()
+	if err != nil || stale {
+		t.Errorf("Expected item files not to be listed, got stale = %v: %v", stale, err)
+	}
+
+	future := contentsInfo.ModTime().Add(time.Second)
+	err = os.Chtimes(vault.DataDir(), future, future)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale, err = vault.ContentsIndexIsStale()
+	if err != nil || !stale {
+		t.Errorf("Expected unlisted item file to be found, got stale = %v: %v", stale, err)
+	}
+}
@@ -0,0 +1,129 @@
+package onepass
+
+import (
+	"encoding/json"
+	"sync"
+	"unsafe"
+)
+
+// buffers allocated by secureBytes(), keyed by the
+// address of their first byte
+var secureAllocs = struct {
+	sync.Mutex
+	bufs map[uintptr]bool
+}{bufs: map[uintptr]bool{}}
+
+// ZeroBytes overwrites buf with zeros. It is used to erase
+// secrets such as keys and passwords once they are no
+// longer needed.
+func ZeroBytes(buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+}
+
+// secureBytes returns a copy of data in memory which is outside
+// the Go heap, locked so that it is not written to swap and, where
+// supported, excluded from core dumps. The original data is zeroed.
+//
+// If the memory cannot be allocated or locked, for example because
+// RLIMIT_MEMLOCK is too low, a copy on the Go heap is returned instead.
+//
+// The returned buffer must be released with freeSecureBytes().
+func secureBytes(data []byte) []byte {
+	defer ZeroBytes(data)
+	if len(data) == 0 {
+		return []byte{}
+	}
+
+	buf, err := mapMemory(len(data))
+	if err != nil {
+		return append([]byte{}, data...)
+	}
+	err = lockMemory(buf)
+	if err != nil {
+		unmapMemory(buf)
+		return append([]byte{}, data...)
+	}
+	copy(buf, data)
+
+	secureAllocs.Lock()
+	secureAllocs.bufs[uintptr(unsafe.Pointer(&buf[0]))] = true
+	secureAllocs.Unlock()
+	return buf
+}
+
+// freeSecureBytes zeroes buf and, if it was allocated
+// by secureBytes(), releases it. buf must not be used afterwards.
+func freeSecureBytes(buf []byte) {
+	ZeroBytes(buf)
+	if len(buf) == 0 {
+		return
+	}
+
+	addr := uintptr(unsafe.Pointer(&buf[0]))
+	secureAllocs.Lock()
+	allocated := secureAllocs.bufs[addr]
+	delete(secureAllocs.bufs, addr)
+	secureAllocs.Unlock()
+
+	if allocated {
+		unlockMemory(buf)
+		unmapMemory(buf)
+	}
+}
+
+// Wipe erases the keys in the dictionary and releases the
+// locked memory holding them
+func (keys KeyDict) Wipe() {
+	for name, key := range keys {
+		freeSecureBytes(key)
+		delete(keys, name)
+	}
+}
+
+// NewWrappingKey returns a random key for use with WrapKeys(),
+// held in locked memory. It must be released with
+// FreeWrappingKey().
+func NewWrappingKey() []byte {
+	return secureBytes(randomBytes(agileKeychainKeyLen))
+}
+
+// FreeWrappingKey erases and releases a key
+// returned by NewWrappingKey()
+func FreeWrappingKey(key []byte) {
+	freeSecureBytes(key)
+}
+
+// WrapKeys encrypts the keys in the dictionary with wrappingKey
+// so that they can be kept after the dictionary is wiped and
+// restored later with UnwrapKeys()
+func WrapKeys(keys KeyDict, wrappingKey []byte) ([]byte, error) {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroBytes(data)
+	return EncryptItemData(wrappingKey, data)
+}
+
+// UnwrapKeys decrypts keys encrypted by WrapKeys(). The keys
+// are returned in locked memory and must be released with
+// KeyDict.Wipe()
+func UnwrapKeys(wrapped []byte, wrappingKey []byte) (KeyDict, error) {
+	data, err := DecryptItemData(wrappingKey, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroBytes(data)
+	var plainKeys map[string][]byte
+	err = json.Unmarshal(data, &plainKeys)
+	if err != nil {
+		return nil, err
+	}
+	keys := KeyDict{}
+	for name, key := range plainKeys {
+		keys[name] = secureBytes(key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,13 @@
+package onepass
+
+import "syscall"
+
+// locks buf in memory. Excluding individual pages from
+// core dumps is not supported on this platform.
+func lockMemory(buf []byte) error {
+	return syscall.Mlock(buf)
+}
+
+func unlockMemory(buf []byte) {
+	syscall.Munlock(buf)
+}
@@ -0,0 +1,21 @@
+package onepass
+
+import "syscall"
+
+// MADV_DONTDUMP from <sys/mman.h>, which is
+// not defined by the syscall package
+const madvDontDump = 16
+
+// locks buf in memory and excludes it from core dumps
+func lockMemory(buf []byte) error {
+	err := syscall.Mlock(buf)
+	if err != nil {
+		return err
+	}
+	syscall.Madvise(buf, madvDontDump)
+	return nil
+}
+
+func unlockMemory(buf []byte) {
+	syscall.Munlock(buf)
+}
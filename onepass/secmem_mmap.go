@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package onepass
+
+import "syscall"
+
+// allocates size bytes of memory outside the Go heap
+func mapMemory(size int) ([]byte, error) {
+	return syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE,
+		syscall.MAP_ANON|syscall.MAP_PRIVATE)
+}
+
+func unmapMemory(buf []byte) {
+	syscall.Munmap(buf)
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package onepass
+
+import "errors"
+
+// locking memory is not supported on this platform,
+// so secureBytes() falls back to the Go heap
+func lockMemory(buf []byte) error {
+	return errors.New("Locking memory is not supported")
+}
+
+func unlockMemory(buf []byte) {
+}
@@ -0,0 +1,77 @@
+package onepass
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSecureBytes(t *testing.T) {
+	data := []byte("secret key material")
+	expected := append([]byte{}, data...)
+
+	buf := secureBytes(data)
+	if !bytes.Equal(buf, expected) {
+		t.Errorf("Secure copy does not match original: %v", buf)
+	}
+	if !bytes.Equal(data, make([]byte, len(data))) {
+		t.Errorf("Expected original data to be zeroed")
+	}
+
+	keys := KeyDict{"SL5": buf}
+	keys.Wipe()
+	if len(keys) != 0 {
+		t.Errorf("Expected keys to be removed after wipe")
+	}
+}
+
+func TestLockWipesKeys(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	agent := vault.CryptoAgent.(*simpleCryptoAgent)
+	heapKey := append([]byte{}, agent.keys["SL5"]...)
+	// replace the locked key with one on the heap which
+	// can be inspected after the vault is locked
+	freeSecureBytes(agent.keys["SL5"])
+	agent.keys["SL5"] = heapKey
+
+	err = vault.CryptoAgent.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(heapKey, make([]byte, len(heapKey))) {
+		t.Errorf("Expected key to be zeroed when vault is locked")
+	}
+}
+
+func TestWrapKeys(t *testing.T) {
+	key := bytes.Repeat([]byte{42}, agileKeychainKeyLen)
+	keys := KeyDict{"SL5": secureBytes(append([]byte{}, key...))}
+	wrappingKey := NewWrappingKey()
+	defer FreeWrappingKey(wrappingKey)
+
+	wrapped, err := WrapKeys(keys, wrappingKey)
+	if err != nil {
+		t.Fatalf("Unable to wrap keys: %v", err)
+	}
+	keys.Wipe()
+	if bytes.Contains(wrapped, key) {
+		t.Errorf("Wrapped keys contain the original key")
+	}
+
+	unwrapped, err := UnwrapKeys(wrapped, wrappingKey)
+	if err != nil {
+		t.Fatalf("Unable to unwrap keys: %v", err)
+	}
+	defer unwrapped.Wipe()
+	if !bytes.Equal(unwrapped["SL5"], key) {
+		t.Errorf("Unwrapped key does not match original")
+	}
+
+	otherKey := bytes.Repeat([]byte{1}, agileKeychainKeyLen)
+	_, err = UnwrapKeys(wrapped, otherKey)
+	if err == nil {
+		t.Errorf("Expected unwrapping with the wrong key to fail")
+	}
+}
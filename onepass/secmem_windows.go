@@ -0,0 +1,49 @@
+package onepass
+
+import "unsafe"
+
+var (
+	procVirtualAlloc  = kernel32.NewProc("VirtualAlloc")
+	procVirtualFree   = kernel32.NewProc("VirtualFree")
+	procVirtualLock   = kernel32.NewProc("VirtualLock")
+	procVirtualUnlock = kernel32.NewProc("VirtualUnlock")
+)
+
+// flags from <winnt.h>
+const (
+	memCommit     = 0x1000
+	memReserve    = 0x2000
+	memRelease    = 0x8000
+	pageReadWrite = 0x4
+)
+
+// allocates size bytes of memory outside the Go heap
+func mapMemory(size int) ([]byte, error) {
+	addr, _, err := procVirtualAlloc.Call(0, uintptr(size), memCommit|memReserve, pageReadWrite)
+	if addr == 0 {
+		return nil, err
+	}
+	// the address is converted via a pointer to it, since the
+	// memory is not managed by Go
+	ptr := *(*unsafe.Pointer)(unsafe.Pointer(&addr))
+	return unsafe.Slice((*byte)(ptr), size), nil
+}
+
+func unmapMemory(buf []byte) {
+	procVirtualFree.Call(uintptr(unsafe.Pointer(&buf[0])), 0, memRelease)
+}
+
+// locks buf in memory so that it is not written to the page file.
+// The number of pages which a process can lock is limited by its
+// minimum working set size, which is large enough for the vault keys.
+func lockMemory(buf []byte) error {
+	ret, _, err := procVirtualLock.Call(uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	if ret == 0 {
+		return err
+	}
+	return nil
+}
+
+func unlockMemory(buf []byte) {
+	procVirtualUnlock.Call(uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+}
@@ -0,0 +1,82 @@
+package onepass
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// format identifier for items shared with ShareItem()
+const sharedItemFormat = "1pass-shared-item"
+
+// SharedItemPrefix starts every blob created by ShareItem()
+const SharedItemPrefix = "1pass-share:"
+
+// ShareItem encrypts a copy of item and its content with a key derived
+// from passphrase and returns it as a compact base64 blob, which can
+// be passed to ReceiveItem() to recover the item.
+//
+// Only the item itself is included, not its folder, conflicting
+// revisions or any other data from the vault.
+func ShareItem(item Item, passphrase string) (string, error) {
+	content, err := item.Content()
+	if err != nil {
+		return "", err
+	}
+	var document []byte
+	if item.TypeName == DocumentType {
+		document, err = item.DocumentData()
+		if err != nil {
+			return "", err
+		}
+	}
+	shared := item
+	shared.Encrypted = nil
+	shared.FolderUuid = ""
+	shared.Conflicts = nil
+	itemJson, err := json.Marshal(ExportedItem{shared, content, document})
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := encryptWithPassphrase(sharedItemFormat, passphrase, itemJson)
+	ZeroBytes(itemJson)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(encrypted)
+	if err != nil {
+		return "", err
+	}
+	return SharedItemPrefix + base64.URLEncoding.EncodeToString(data), nil
+}
+
+// ReceiveItem decrypts an item shared with ShareItem(). Returns a
+// DecryptError if the passphrase is incorrect. The item can be added
+// to a vault with Vault.ImportItem().
+func ReceiveItem(blob string, passphrase string) (ExportedItem, error) {
+	blob = strings.Join(strings.Fields(blob), "")
+	if !strings.HasPrefix(blob, SharedItemPrefix) {
+		return ExportedItem{}, errors.New("Not a shared item")
+	}
+	data, err := base64.URLEncoding.DecodeString(strings.TrimPrefix(blob, SharedItemPrefix))
+	if err != nil {
+		return ExportedItem{}, errors.New("Shared item is corrupted")
+	}
+	var encrypted passphraseEncrypted
+	err = json.Unmarshal(data, &encrypted)
+	if err != nil {
+		return ExportedItem{}, errors.New("Shared item is corrupted")
+	}
+	itemJson, err := decryptWithPassphrase(sharedItemFormat, passphrase, encrypted)
+	if err != nil {
+		return ExportedItem{}, err
+	}
+	defer ZeroBytes(itemJson)
+	var item ExportedItem
+	err = json.Unmarshal(itemJson, &item)
+	if err != nil {
+		return ExportedItem{}, err
+	}
+	return item, nil
+}
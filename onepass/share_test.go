@@ -0,0 +1,40 @@
+package onepass
+
+import "testing"
+
+func TestShareItem(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	item, err := vault.AddItem("Shared Login", "webforms.WebForm", newTestContent("shared.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob, err := ShareItem(item, "one-off")
+	if err != nil {
+		t.Fatalf("Unable to share item: %v", err)
+	}
+
+	_, err = ReceiveItem(blob, "wrong")
+	if _, ok := err.(DecryptError); !ok {
+		t.Errorf("Expected wrong passphrase to be rejected, got: %v", err)
+	}
+	_, err = ReceiveItem("not a blob", "one-off")
+	if err == nil {
+		t.Errorf("Expected invalid blob to be rejected")
+	}
+
+	// line breaks added when pasting the blob are ignored
+	received, err := ReceiveItem(blob[:20]+"\n"+blob[20:], "one-off")
+	if err != nil {
+		t.Fatalf("Unable to receive item: %v", err)
+	}
+	if received.Title != item.Title || received.Uuid != item.Uuid {
+		t.Errorf("Unexpected received item: %s (%s)", received.Title, received.Uuid)
+	}
+	if received.SecureContents.Urls[0].Url != "shared.com" {
+		t.Errorf("Unexpected received content: %v", received.SecureContents)
+	}
+}
@@ -0,0 +1,119 @@
+package onepass
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// type name of smart folder items, which list the items
+// matching a saved search rather than containing items
+const SmartFolderType = "system.folder.SavedSearch"
+
+// SmartFolder holds the predicate of a smart folder item,
+// which is stored in the item's content as:
+//
+//	{"predicate": {"match": "all", "conditions": [
+//	  {"field": "tag", "operator": "is", "value": "work"},
+//	  {"field": "title", "operator": "contains", "value": "bank"}
+//	]}}
+//
+// Only the conditions listed in SmartFolderCondition are supported.
+type SmartFolder struct {
+	// "all" (the default) if items must match every condition
+	// or "any" if they must match at least one
+	Match string `json:"match"`
+
+	Conditions []SmartFolderCondition `json:"conditions"`
+}
+
+// SmartFolderCondition is a single condition in a smart
+// folder's predicate. Field is one of 'type' (the item's type
+// name), 'tag' or 'title' and Operator is either 'is' or
+// 'contains'. Comparisons are case-insensitive.
+type SmartFolderCondition struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// SmartFolder decrypts and parses the predicate of a smart
+// folder item. An error is returned if the predicate uses
+// fields or operators which are not supported.
+func (item *Item) SmartFolder() (SmartFolder, error) {
+	if item.TypeName != SmartFolderType {
+		return SmartFolder{}, fmt.Errorf("'%s' is not a smart folder", item.Title)
+	}
+	contentJson, err := item.ContentJson()
+	if err != nil {
+		return SmartFolder{}, err
+	}
+	var content struct {
+		Predicate *SmartFolder `json:"predicate"`
+	}
+	err = json.Unmarshal([]byte(contentJson), &content)
+	if err != nil {
+		return SmartFolder{}, fmt.Errorf("Unable to parse smart folder: %v", err)
+	}
+	if content.Predicate == nil {
+		return SmartFolder{}, fmt.Errorf("Smart folder '%s' uses a search format which is not supported", item.Title)
+	}
+	folder := *content.Predicate
+	if folder.Match == "" {
+		folder.Match = "all"
+	}
+	if folder.Match != "all" && folder.Match != "any" {
+		return SmartFolder{}, fmt.Errorf("Unsupported smart folder match '%s'", folder.Match)
+	}
+	for _, condition := range folder.Conditions {
+		switch condition.Field {
+		case "type", "tag", "title":
+		default:
+			return SmartFolder{}, fmt.Errorf("Unsupported smart folder field '%s'", condition.Field)
+		}
+		if condition.Operator != "is" && condition.Operator != "contains" {
+			return SmartFolder{}, fmt.Errorf("Unsupported smart folder operator '%s'", condition.Operator)
+		}
+	}
+	return folder, nil
+}
+
+// Matches returns true if item is listed in the smart folder.
+// Folders and other system items are never listed.
+func (folder SmartFolder) Matches(item Item) bool {
+	if strings.HasPrefix(item.TypeName, "system.") {
+		return false
+	}
+	for _, condition := range folder.Conditions {
+		matched := condition.matches(item)
+		if matched && folder.Match == "any" {
+			return true
+		} else if !matched && folder.Match != "any" {
+			return false
+		}
+	}
+	return folder.Match != "any" || len(folder.Conditions) == 0
+}
+
+func (condition SmartFolderCondition) matches(item Item) bool {
+	values := []string{}
+	switch condition.Field {
+	case "type":
+		values = append(values, item.TypeName)
+		if itemType, ok := ItemTypes[item.TypeName]; ok {
+			values = append(values, itemType.Name, itemType.ShortAlias)
+		}
+	case "tag":
+		values = item.OpenContents.Tags
+	case "title":
+		values = append(values, item.Title)
+	}
+	expected := strings.ToLower(condition.Value)
+	for _, value := range values {
+		value = strings.ToLower(value)
+		if value == expected || (condition.Operator == "contains" && strings.Contains(value, expected)) {
+			return true
+		}
+	}
+	return false
+}
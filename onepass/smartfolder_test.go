@@ -0,0 +1,73 @@
+package onepass
+
+import (
+	"testing"
+)
+
+func TestSmartFolder(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	folderItem, err := vault.AddItem("Work Logins", SmartFolderType, ItemContent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = folderItem.SetContentJson(`{"predicate": {"conditions": [
+		{"field": "type", "operator": "is", "value": "login"},
+		{"field": "tag", "operator": "is", "value": "Work"}
+	]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	folder, err := folderItem.SmartFolder()
+	if err != nil {
+		t.Fatalf("Failed to read smart folder: %v", err)
+	}
+
+	workLogin := Item{Title: "Work Mail", TypeName: "webforms.WebForm"}
+	workLogin.OpenContents.Tags = []string{"work"}
+	homeLogin := Item{Title: "Home Mail", TypeName: "webforms.WebForm"}
+	workNote := Item{Title: "Work Note", TypeName: "securenotes.SecureNote"}
+	workNote.OpenContents.Tags = []string{"work"}
+
+	if !folder.Matches(workLogin) {
+		t.Errorf("Expected '%s' to match", workLogin.Title)
+	}
+	if folder.Matches(homeLogin) || folder.Matches(workNote) {
+		t.Errorf("Expected only items matching all conditions to match")
+	}
+	if folder.Matches(folderItem) {
+		t.Errorf("Expected folders not to match")
+	}
+
+	folder.Match = "any"
+	if !folder.Matches(homeLogin) || !folder.Matches(workNote) {
+		t.Errorf("Expected items matching any condition to match")
+	}
+
+	folder = SmartFolder{Conditions: []SmartFolderCondition{{Field: "title", Operator: "contains", Value: "mail"}}}
+	if !folder.Matches(workLogin) || folder.Matches(workNote) {
+		t.Errorf("Expected title condition to match only titles containing 'mail'")
+	}
+
+	err = folderItem.SetContentJson(`{"predicate": {"conditions": [
+		{"field": "url", "operator": "is", "value": "example.com"}
+	]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = folderItem.SmartFolder()
+	if err == nil {
+		t.Errorf("Expected unsupported field to be rejected")
+	}
+
+	err = folderItem.SetContentJson(`{"predicate_b64": "YnBsaXN0MDA="}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = folderItem.SmartFolder()
+	if err == nil {
+		t.Errorf("Expected unsupported predicate format to be rejected")
+	}
+}
@@ -0,0 +1,109 @@
+package onepass
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// passwords which are tried first when guessing, and variations
+// of which are given no credit by EstimatePasswordStrength()
+var commonPasswords = []string{
+	"password", "passw0rd", "123456", "12345678", "123456789", "qwerty",
+	"qwertyuiop", "abc123", "letmein", "welcome", "monkey", "dragon",
+	"iloveyou", "admin", "login", "master", "secret", "1password",
+	"onepassword", "trustno1", "sunshine", "princess", "football",
+}
+
+// PasswordStrength is a rough rating of how hard a password
+// chosen by a person would be to guess
+type PasswordStrength int
+
+const (
+	PasswordWeak PasswordStrength = iota
+	PasswordFair
+	PasswordStrong
+)
+
+func (strength PasswordStrength) String() string {
+	switch strength {
+	case PasswordWeak:
+		return "weak"
+	case PasswordFair:
+		return "fair"
+	default:
+		return "strong"
+	}
+}
+
+// minimum estimated entropy, in bits, for a password
+// to be rated as fair or strong
+const (
+	fairPasswordBits   = 50
+	strongPasswordBits = 70
+)
+
+// EstimatePasswordStrength returns a rough estimate of the entropy
+// of a password in bits and a rating based on it. The estimate is
+// based on the classes of characters used, with no credit given for
+// characters which repeat or continue a sequence of the previous
+// ones, or for common passwords contained in the password.
+//
+// This is only a guide for people choosing a password and does
+// not account for all of the ways in which a password may be weak.
+func EstimatePasswordStrength(pwd string) (float64, PasswordStrength) {
+	lower := strings.ToLower(pwd)
+	for _, common := range commonPasswords {
+		lower = strings.Replace(lower, common, "", -1)
+	}
+
+	poolSize := 0
+	var hasLower, hasUpper, hasDigit, hasSymbol, hasOther bool
+	for _, ch := range pwd {
+		switch {
+		case ch >= 'a' && ch <= 'z':
+			hasLower = true
+		case ch >= 'A' && ch <= 'Z':
+			hasUpper = true
+		case ch >= '0' && ch <= '9':
+			hasDigit = true
+		case ch < unicode.MaxASCII && unicode.IsPrint(ch):
+			hasSymbol = true
+		default:
+			hasOther = true
+		}
+	}
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{hasLower, 26}, {hasUpper, 26}, {hasDigit, 10}, {hasSymbol, 33}, {hasOther, 100}} {
+		if class.used {
+			poolSize += class.size
+		}
+	}
+	if poolSize == 0 {
+		return 0, PasswordWeak
+	}
+
+	bitsPerChar := math.Log2(float64(poolSize))
+	bits := 0.0
+	var prev rune = -1
+	for _, ch := range lower {
+		if ch == prev || ch == prev+1 || ch == prev-1 {
+			// repeated characters and sequences such as
+			// 'aaa', 'abc' or '321' are easily guessed
+			bits += 1
+		} else {
+			bits += bitsPerChar
+		}
+		prev = ch
+	}
+
+	strength := PasswordWeak
+	if bits >= strongPasswordBits {
+		strength = PasswordStrong
+	} else if bits >= fairPasswordBits {
+		strength = PasswordFair
+	}
+	return bits, strength
+}
@@ -0,0 +1,30 @@
+package onepass
+
+import (
+	"testing"
+)
+
+func TestEstimatePasswordStrength(t *testing.T) {
+	cases := map[string]PasswordStrength{
+		"":                              PasswordWeak,
+		"password":                      PasswordWeak,
+		"Password123":                   PasswordWeak,
+		"aaaaaaaaaaaaaaaaaaaaaaaa":      PasswordWeak,
+		"abcdefghijklmnopqrstuvwxyz":    PasswordWeak,
+		"kT8#vq2Lp9":                    PasswordFair,
+		"correct horse battery staple":  PasswordStrong,
+		"Tr0ub4dor&3-Xylophone-Meadow!": PasswordStrong,
+	}
+	for pwd, expected := range cases {
+		bits, strength := EstimatePasswordStrength(pwd)
+		if strength != expected {
+			t.Errorf("Expected '%s' to be rated %s, got %s (%.0f bits)", pwd, expected, strength, bits)
+		}
+	}
+
+	shortBits, _ := EstimatePasswordStrength("kT8#vq")
+	longBits, _ := EstimatePasswordStrength("kT8#vq2Lp9")
+	if longBits <= shortBits {
+		t.Errorf("Expected longer password to have more entropy")
+	}
+}
@@ -0,0 +1,111 @@
+package onepass
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// values of ItemOpenContents.UrlMatch, which determine
+// which sites an item's website matches
+const (
+	// match sites with the same base domain, eg. 'mail.example.com'
+	// matches an item for 'www.example.com'. This is the default.
+	UrlMatchDomain = ""
+
+	// match only sites with the same host name
+	UrlMatchHost = "host"
+)
+
+// value of ItemOpenContents.Scope for items which
+// are never shown or filled in browsers
+const ScopeNever = "Never"
+
+// second-level labels under which domains are registered in
+// country code domains, eg. 'example.co.uk'
+var secondLevelLabels = map[string]bool{
+	"ac":  true,
+	"co":  true,
+	"com": true,
+	"edu": true,
+	"gov": true,
+	"net": true,
+	"org": true,
+}
+
+// UrlHost returns the lowercased host name in a URL or
+// a bare host name such as 'www.example.com'
+func UrlHost(rawUrl string) string {
+	rawUrl = strings.TrimSpace(rawUrl)
+	if !strings.Contains(rawUrl, "://") {
+		rawUrl = "http://" + rawUrl
+	}
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+}
+
+// BaseDomain returns the registered domain of host,
+// eg. 'example.com' for 'mail.corp.example.com'
+func BaseDomain(host string) string {
+	labels := strings.Split(host, ".")
+	count := 2
+	if len(labels) > 2 && len(labels[len(labels)-1]) == 2 &&
+		secondLevelLabels[labels[len(labels)-2]] {
+		count = 3
+	}
+	if len(labels) <= count {
+		return host
+	}
+	return strings.Join(labels[len(labels)-count:], ".")
+}
+
+// MatchesUrl returns true if the item's website matches the
+// site at rawUrl according to the item's URL match setting
+func (item *Item) MatchesUrl(rawUrl string) bool {
+	if item.OpenContents.Scope == ScopeNever || item.Location == "" {
+		return false
+	}
+	itemHost := UrlHost(item.Location)
+	host := UrlHost(rawUrl)
+	if itemHost == "" || host == "" {
+		return false
+	}
+	if item.OpenContents.UrlMatch == UrlMatchHost {
+		return itemHost == host
+	}
+	return BaseDomain(itemHost) == BaseDomain(host)
+}
+
+// SetUrlMatch sets which sites the item matches, one of 'host',
+// 'domain' or 'never' to never match any site
+func (item *Item) SetUrlMatch(match string) error {
+	switch match {
+	case "host":
+		item.OpenContents.UrlMatch = UrlMatchHost
+	case "domain":
+		item.OpenContents.UrlMatch = UrlMatchDomain
+	case "never":
+		item.OpenContents.Scope = ScopeNever
+		return nil
+	default:
+		return fmt.Errorf("Unknown URL match '%s'. Use host, domain or never", match)
+	}
+	if item.OpenContents.Scope == ScopeNever {
+		item.OpenContents.Scope = "Always"
+	}
+	return nil
+}
+
+// UrlMatchName returns the name of the item's URL match
+// setting, as accepted by SetUrlMatch()
+func (item *Item) UrlMatchName() string {
+	if item.OpenContents.Scope == ScopeNever {
+		return "never"
+	} else if item.OpenContents.UrlMatch == UrlMatchHost {
+		return "host"
+	}
+	return "domain"
+}
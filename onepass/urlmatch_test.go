@@ -0,0 +1,56 @@
+package onepass
+
+import (
+	"testing"
+)
+
+func TestBaseDomain(t *testing.T) {
+	cases := map[string]string{
+		"example.com":          "example.com",
+		"mail.example.com":     "example.com",
+		"a.corp.example.com":   "example.com",
+		"www.example.co.uk":    "example.co.uk",
+		"example.co.uk":        "example.co.uk",
+		"localhost":            "localhost",
+		"login.example.com.au": "example.com.au",
+	}
+	for host, expected := range cases {
+		if actual := BaseDomain(host); actual != expected {
+			t.Errorf("Expected base domain of '%s' to be '%s', got '%s'", host, expected, actual)
+		}
+	}
+}
+
+func TestMatchesUrl(t *testing.T) {
+	item := Item{Location: "https://app.corp.example.com/login"}
+	cases := []struct {
+		url      string
+		match    string
+		expected bool
+	}{
+		{"https://app.corp.example.com/home", "domain", true},
+		{"wiki.corp.example.com", "domain", true},
+		{"https://example.org", "domain", false},
+		{"https://APP.corp.example.com:8443/", "host", true},
+		{"https://wiki.corp.example.com", "host", false},
+		{"https://app.corp.example.com", "never", false},
+	}
+	for _, test := range cases {
+		err := item.SetUrlMatch(test.match)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.MatchesUrl(test.url) != test.expected {
+			t.Errorf("Expected match of '%s' with '%s' setting to be %v", test.url, test.match, test.expected)
+		}
+		if name := item.UrlMatchName(); name != test.match {
+			t.Errorf("Expected URL match name '%s', got '%s'", test.match, name)
+		}
+	}
+	if item.SetUrlMatch("subdomain") == nil {
+		t.Errorf("Expected unknown URL match to be rejected")
+	}
+	if (&Item{}).MatchesUrl("https://example.com") {
+		t.Errorf("Item without a website should not match any URL")
+	}
+}
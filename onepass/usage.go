@@ -0,0 +1,102 @@
+package onepass
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+)
+
+// ItemUsage records how often and when an item was used
+type ItemUsage struct {
+	// UNIX timestamp of when the item was last used
+	LastUsed int64 `json:"lastUsed"`
+
+	// Number of times the item has been used
+	Count int `json:"count"`
+}
+
+// UsageLog records when items in a vault were used, eg. by
+// copying a password or showing the item, so that frequently
+// and recently used items can be found quickly.
+//
+// Like the undo journal, the log is stored outside the vault, so
+// it is not synced with other devices, and is encrypted with the
+// vault's SL5 key.
+type UsageLog struct {
+	vault *Vault
+	path  string
+
+	// Map of item ID -> usage
+	Items map[string]ItemUsage
+}
+
+// OpenUsageLog reads the usage log for vault from filePath. If the
+// file does not exist, an empty log is returned.
+func OpenUsageLog(vault *Vault, filePath string) (*UsageLog, error) {
+	usage := &UsageLog{vault: vault, path: filePath, Items: map[string]ItemUsage{}}
+	encrypted, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return usage, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if vault.IsLocked() {
+		return nil, errors.New("Vault is locked")
+	}
+	data, err := vault.CryptoAgent.Decrypt("SL5", encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decrypt usage log: %v", err)
+	}
+	err = json.Unmarshal(data, &usage.Items)
+	ZeroBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("Usage log is corrupt: %v", err)
+	}
+	return usage, nil
+}
+
+func (usage *UsageLog) save() error {
+	data, err := json.Marshal(usage.Items)
+	if err != nil {
+		return err
+	}
+	encrypted, err := usage.vault.CryptoAgent.Encrypt("SL5", data)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(path.Dir(usage.path), 0700)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(usage.path, encrypted, 0600)
+}
+
+// ReEncrypt saves the log encrypted with the vault's current
+// keys, after they have been replaced by Vault.ReEncrypt(). The
+// log must have been opened before the keys were replaced.
+func (usage *UsageLog) ReEncrypt() error {
+	return usage.save()
+}
+
+// Record notes that the items with the given IDs
+// were used at time when and saves the log
+func (usage *UsageLog) Record(when time.Time, uuids ...string) error {
+	for _, uuid := range uuids {
+		entry := usage.Items[uuid]
+		entry.LastUsed = when.Unix()
+		entry.Count++
+		usage.Items[uuid] = entry
+	}
+	return usage.save()
+}
+
+// LastUsed returns the UNIX timestamp of when the item
+// with the given ID was last used, or zero if it has
+// not been used
+func (usage *UsageLog) LastUsed(uuid string) int64 {
+	return usage.Items[uuid].LastUsed
+}
@@ -0,0 +1,68 @@
+package onepass
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUsageLog(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+
+	usagePath := os.TempDir() + "/1pass-test-usage"
+	os.Remove(usagePath)
+	defer os.Remove(usagePath)
+	usage, err := OpenUsageLog(&vault, usagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.LastUsed("item1") != 0 {
+		t.Errorf("Expected empty usage log")
+	}
+
+	first := time.Unix(1000, 0)
+	second := time.Unix(2000, 0)
+	err = usage.Record(first, "item1", "item2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = usage.Record(second, "item1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// re-open the log to check that it was saved
+	usage, err = OpenUsageLog(&vault, usagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.LastUsed("item1") != second.Unix() || usage.Items["item1"].Count != 2 {
+		t.Errorf("Unexpected usage for item1: %+v", usage.Items["item1"])
+	}
+	if usage.LastUsed("item2") != first.Unix() || usage.Items["item2"].Count != 1 {
+		t.Errorf("Unexpected usage for item2: %+v", usage.Items["item2"])
+	}
+
+	// the log must be encrypted
+	data, err := ioutil.ReadFile(usagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("item1")) {
+		t.Errorf("Usage log is not encrypted")
+	}
+
+	err = vault.CryptoAgent.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = OpenUsageLog(&vault, usagePath)
+	if err == nil {
+		t.Errorf("Opening usage log of a locked vault should fail")
+	}
+}
@@ -20,6 +20,7 @@ package onepass
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/md5"
 	"crypto/rand"
 	"crypto/sha1"
@@ -46,6 +47,11 @@ const AesBlockLen = 16
 
 var PbkdfIterations = 17094
 
+// DebugLog is called to log vault file reads and other
+// diagnostic information. Messages never include key material
+// or item content.
+var DebugLog = func(format string, args ...interface{}) {}
+
 const agileKeychainKeyLen = 1024
 
 type KeyDict map[string][]byte
@@ -74,16 +80,35 @@ type simpleCryptoAgent struct {
 }
 
 func (agent *simpleCryptoAgent) Encrypt(keyName string, in []byte) ([]byte, error) {
-	data, err := EncryptItemData(agent.keys[keyName], in)
+	key, ok := agent.keys[keyName]
+	if !ok {
+		return nil, KeyLockedError{keyName}
+	}
+	data, err := EncryptItemData(key, in)
 	return data, err
 }
 
 func (agent *simpleCryptoAgent) Decrypt(keyName string, in []byte) ([]byte, error) {
-	data, err := DecryptItemData(agent.keys[keyName], in)
+	key, ok := agent.keys[keyName]
+	if !ok {
+		return nil, KeyLockedError{keyName}
+	}
+	data, err := DecryptItemData(key, in)
 	return data, err
 }
 
+// KeyLockedError is returned when encrypting or decrypting an
+// item which uses a security level whose key was not unlocked
+type KeyLockedError struct {
+	Level string
+}
+
+func (err KeyLockedError) Error() string {
+	return fmt.Sprintf("The %s key is not unlocked", err.Level)
+}
+
 func (agent *simpleCryptoAgent) Lock() error {
+	agent.keys.Wipe()
 	agent.keys = nil
 	return nil
 }
@@ -96,13 +121,47 @@ func (agent *simpleCryptoAgent) IsLocked() (bool, error) {
 type Vault struct {
 	Path        string
 	CryptoAgent CryptoAgent
+
+	// Store holding the vault's items and keys. If nil, the
+	// Agile Keychain folder at Path is used.
+	Backend VaultBackend
+
+	// If true, operations which would modify
+	// the vault fail with ErrReadOnly
+	ReadOnly bool
+
+	// If set, called after an item has been saved, including
+	// the tombstone which replaces an item when it is removed
+	PostSave func(item Item)
+
+	// If set, called before an item is removed with Remove().
+	// The item is kept if this returns an error.
+	PreRemove func(item Item) error
+}
+
+// ErrReadOnly is returned by operations which would
+// modify a vault opened in read-only mode
+var ErrReadOnly = errors.New("Vault is read-only")
+
+func (vault *Vault) checkWritable() error {
+	if vault.ReadOnly {
+		return ErrReadOnly
+	}
+	return nil
 }
 
 type DecryptError struct {
 	err error
+
+	// security levels whose keys could not be decrypted
+	// with the master password, if known
+	Levels []string
 }
 
 func (err DecryptError) Error() string {
+	if err.err == nil {
+		return "Incorrect master password"
+	}
 	return err.err.Error()
 }
 
@@ -119,7 +178,7 @@ type Item struct {
 
 	// JSON content of the item, encrypted with the key identified
 	// by 'SecurityLevel' from encryptionKeys.js
-	Encrypted    []byte `json:"encrypted"`
+	Encrypted    []byte `json:"encrypted,omitempty"`
 	ContentsHash string `json:"contentsHash"`
 
 	// type code identifying the type of item, eg. 'webforms.WebForm'
@@ -135,6 +194,14 @@ type Item struct {
 	// primary domain or URL associated with the item?
 	Location string `json:"location"`
 
+	// normalized form of 'Location' used by 1Password
+	// apps to find items for a site
+	LocationKey string `json:"locationKey,omitempty"`
+
+	// UNIX timestamp set by 1Password apps when
+	// the item is synced
+	TxTimestamp uint64 `json:"txTimestamp,omitempty"`
+
 	// UUID of folder item containing this item
 	FolderUuid string `json:"folderUuid"`
 
@@ -148,7 +215,15 @@ type Item struct {
 	// Unencrypted item content
 	OpenContents ItemOpenContents `json:"openContents"`
 
+	// Conflicting revisions of the item found when syncing
+	// the vault, which have not yet been resolved
+	Conflicts []ItemConflict `json:"conflicts,omitempty"`
+
 	vault *Vault
+
+	// encrypted contents of a document item's file, if it
+	// should be written when the item is next saved
+	document []byte
 }
 
 // struct for items in encryptionKeys.js
@@ -181,6 +256,18 @@ type encryptionKeys struct {
 	SL5 string
 }
 
+// IsValidItemId returns true if id has the form of the IDs
+// given to items by newItemId(), 32 hexadecimal digits. IDs read
+// from other copies of a vault must be checked with this before
+// they are used in file paths.
+func IsValidItemId(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
 func newItemId() string {
 	id, err := uuid.NewV4()
 	if err != nil {
@@ -255,6 +342,7 @@ func NewVault(vaultPath string, security VaultSecurity) (Vault, error) {
 	if err != nil {
 		return Vault{}, fmt.Errorf("Failed to create contents.js file")
 	}
+	markContentsIndexCurrent(dataDir)
 
 	// create encryptionKeys.js file
 	randomKey := randomBytes(1024)
@@ -307,40 +395,94 @@ func (vault *Vault) DataDir() string {
 
 // UnlockKeys decrypts the item encryption keys for
 // a vault using the master password and returns a dictionary
-// mapping key name to key data or an instance of DecryptError
-// if the password is wrong
+// mapping key name to key data. A DecryptError is returned if
+// the password is wrong and a KeyFileError if encryptionKeys.js
+// is missing or corrupt.
+//
+// Each security level (SL3, SL5) has its own key. Levels whose key
+// cannot be decrypted with pwd are left out of the dictionary, so
+// that only items using the unlocked levels can be read. An error
+// is returned if no key can be decrypted. Vault.LockedKeys() reports
+// the levels which were left locked.
 func UnlockKeys(vaultPath string, pwd string) (KeyDict, error) {
-	var keyList encryptionKeys
-	err := jsonutil.ReadFile(vaultDataDir(vaultPath)+"/encryptionKeys.js", &keyList)
+	DebugLog("Reading encryption keys for '%s'", vaultPath)
+	keyList, err := readKeyFile(vaultDataDir(vaultPath))
 	if err != nil {
-		return KeyDict{}, errors.New("Failed to read encryption key file")
+		return KeyDict{}, err
 	}
-
-	keys := KeyDict{}
 	for _, entry := range keyList.List {
-		if len(entry.Data) != 1056 {
-			return KeyDict{}, fmt.Errorf("Unexpected encrypted key length: %d", len(entry.Data))
+		if err := entry.checkFormat(); err != nil {
+			return KeyDict{}, err
 		}
+	}
+
+	pwdBytes := []byte(pwd)
+	defer ZeroBytes(pwdBytes)
 
-		salt, encryptedKey, err := extractSaltAndCipherText(entry.Data)
+	// decrypted keys are held in locked memory and
+	// must be released with KeyDict.Wipe()
+	keys := KeyDict{}
+	failedLevels := []string{}
+	for _, entry := range keyList.List {
+		salt, encryptedKey, _ := extractSaltAndCipherText(entry.Data)
+		decryptedKey, err := decryptKey(pwdBytes, encryptedKey, salt, entry.Iterations, entry.Validation)
 		if err != nil {
-			return KeyDict{}, fmt.Errorf("Invalid encrypted data: %v", err)
+			DebugLog("Failed to decrypt %s key: %v", entry.Level, err)
+			failedLevels = append(failedLevels, entry.Level)
+			continue
 		}
-		decryptedKey, err := decryptKey([]byte(pwd), encryptedKey, salt, entry.Iterations, entry.Validation)
-		if err != nil {
-			return KeyDict{}, DecryptError{err: fmt.Errorf("Failed to decrypt main key: %v", err)}
+		keys[entry.Level] = secureBytes(decryptedKey)
+	}
+	if len(keys) == 0 {
+		return KeyDict{}, DecryptError{
+			err: fmt.Errorf("Incorrect master password, the %s key failed validation",
+				strings.Join(failedLevels, " and ")),
+			Levels: failedLevels,
 		}
-		keys[entry.Level] = decryptedKey
 	}
 
 	return keys, nil
 }
 
+// SecurityLevels returns the names of the security levels,
+// such as 'SL5', for which the vault has encryption keys
+func (vault *Vault) SecurityLevels() ([]string, error) {
+	return vault.backend().SecurityLevels()
+}
+
+// LockedKeys returns a KeyFileError for each of the vault's security
+// levels whose key is still locked after Unlock() succeeded, because
+// it failed validation with the master password. The key may be
+// damaged or protected by a different password.
+func (vault *Vault) LockedKeys() ([]KeyFileError, error) {
+	levels, err := vault.SecurityLevels()
+	if err != nil {
+		return nil, err
+	}
+	locked := []KeyFileError{}
+	for _, level := range levels {
+		_, err := vault.CryptoAgent.Encrypt(level, []byte{})
+		if err == nil {
+			continue
+		}
+		// errors lose their type when returned from an agent in
+		// another process, so locked keys are recognized by the message
+		if err.Error() != (KeyLockedError{level}).Error() {
+			return nil, err
+		}
+		locked = append(locked, KeyFileError{
+			Level:   level,
+			Problem: "the key failed validation with the master password",
+		})
+	}
+	return locked, nil
+}
+
 // Decrypts the master encryption key for the vault using
 // the given master password. Item contents can then be decrypted
 // and items can be added or updated
 func (vault *Vault) Unlock(pwd string) error {
-	keys, err := UnlockKeys(vault.Path, pwd)
+	keys, err := vault.backend().UnlockKeys(pwd)
 	vault.CryptoAgent = &simpleCryptoAgent{keys}
 	return err
 }
@@ -395,29 +537,37 @@ func saveEncryptionKeys(dataDir string, keyList encryptionKeys) (err error) {
 // is first decrypted using the current password, then re-encrypted
 // using the new password
 func (vault *Vault) SetMasterPassword(currentPwd string, newPwd string) error {
-	var keyList encryptionKeys
-	keyFilePath := vault.DataDir() + "/encryptionKeys.js"
-	err := jsonutil.ReadFile(keyFilePath, &keyList)
+	if err := vault.checkWritable(); err != nil {
+		return err
+	}
+	unlock, err := vault.lockForWrite()
 	if err != nil {
-		return errors.New("Failed to read encryption key file")
+		return err
+	}
+	defer unlock()
+
+	keyList, err := readKeyFile(vault.DataDir())
+	if err != nil {
+		return err
 	}
 
 	for i, entry := range keyList.List {
-		if len(entry.Data) != 1056 {
-			return fmt.Errorf("Unexpected encrypted key length: %d", len(entry.Data))
-		}
-		salt, encryptedKey, err := extractSaltAndCipherText(entry.Data)
-		if err != nil {
-			return fmt.Errorf("Invalid encrypted key: %v", err)
+		if err := entry.checkFormat(); err != nil {
+			return err
 		}
+		salt, encryptedKey, _ := extractSaltAndCipherText(entry.Data)
 		decryptedKey, err := decryptKey([]byte(currentPwd), encryptedKey, salt, entry.Iterations, entry.Validation)
 		if err != nil {
-			return fmt.Errorf("Failed to decrypt main key: %v", err)
+			return DecryptError{
+				err:    fmt.Errorf("Incorrect master password, the %s key failed validation", entry.Level),
+				Levels: []string{entry.Level},
+			}
 		}
 
 		// re-encrypt key with new password
 		newSalt := randomBytes(8)
 		newEncryptedKey, newValidation, err := encryptKey([]byte(newPwd), decryptedKey, newSalt, entry.Iterations)
+		ZeroBytes(decryptedKey)
 		if err != nil {
 			return fmt.Errorf("Failed to re-encrypt main key: %v", err)
 		}
@@ -435,12 +585,180 @@ func (vault *Vault) SetMasterPassword(currentPwd string, newPwd string) error {
 	return nil
 }
 
+// ReEncrypt replaces the vault's encryption keys with newly generated
+// random keys, protected by the master password pwd, and re-encrypts
+// every item in the vault with the new keys. If level is not empty,
+// items are moved to that security level, eg. 'SL5', as they are
+// re-encrypted.
+//
+// This is useful if the existing keys may have been exposed. After
+// a successful call the vault is unlocked using the new keys. If
+// re-encryption fails, the vault is left unchanged.
+func (vault *Vault) ReEncrypt(pwd string, level string) error {
+	if err := vault.checkWritable(); err != nil {
+		return err
+	}
+	if vault.Backend != nil {
+		return errors.New("Re-encrypting is only supported for Agile Keychain vaults")
+	}
+
+	oldKeys, err := UnlockKeys(vault.Path, pwd)
+	if err != nil {
+		return err
+	}
+	defer oldKeys.Wipe()
+
+	var keyList encryptionKeys
+	err = jsonutil.ReadFile(vault.DataDir()+"/encryptionKeys.js", &keyList)
+	if err != nil {
+		return errors.New("Failed to read encryption key file")
+	}
+
+	newKeys := KeyDict{}
+	for i, entry := range keyList.List {
+		newKey := randomBytes(agileKeychainKeyLen)
+		salt := randomBytes(8)
+		encryptedKey, validation, err := encryptKey([]byte(pwd), newKey, salt, entry.Iterations)
+		if err != nil {
+			return fmt.Errorf("Failed to generate encryption key: %v", err)
+		}
+		entry.Data = []byte(fmt.Sprintf("Salted__%s%s", salt, encryptedKey))
+		entry.Validation = validation
+		entry.Identifier = newItemId()
+		if entry.Level == "SL5" {
+			keyList.SL5 = entry.Identifier
+		}
+		keyList.List[i] = entry
+		newKeys[entry.Level] = newKey
+	}
+	if level != "" && newKeys[level] == nil {
+		return fmt.Errorf("The vault has no key for the security level '%s'", level)
+	}
+
+	items, err := vault.listItemFiles()
+	if err != nil {
+		return err
+	}
+
+	// decrypt and re-encrypt all items in memory, then write the
+	// items and finally the new keys, so that a failure at any
+	// point leaves the vault untouched
+	batch := vault.NewBatch()
+	for _, item := range items {
+		if len(item.Encrypted) == 0 {
+			continue
+		}
+		newLevel := item.SecurityLevel
+		if level != "" {
+			newLevel = level
+		}
+		item.Encrypted, err = reEncryptData(oldKeys[item.SecurityLevel], newKeys[newLevel], item.Encrypted)
+		if err != nil {
+			return fmt.Errorf("Failed to re-encrypt item '%s': %v", item.Title, err)
+		}
+		if item.TypeName == DocumentType {
+			document, err := item.documentFile()
+			if err != nil {
+				return fmt.Errorf("Unable to read document '%s': %v", item.Title, err)
+			}
+			item.document, err = reEncryptData(oldKeys[item.SecurityLevel], newKeys[newLevel], document)
+			if err != nil {
+				return fmt.Errorf("Failed to re-encrypt document '%s': %v", item.Title, err)
+			}
+		}
+		item.SecurityLevel = newLevel
+		for k, conflict := range item.Conflicts {
+			newLevel := conflict.SecurityLevel
+			if level != "" {
+				newLevel = level
+			}
+			item.Conflicts[k].Encrypted, err = reEncryptData(oldKeys[conflict.SecurityLevel], newKeys[newLevel], conflict.Encrypted)
+			if err != nil {
+				return fmt.Errorf("Failed to re-encrypt conflicting revision of '%s': %v", item.Title, err)
+			}
+			item.Conflicts[k].SecurityLevel = newLevel
+		}
+		err = batch.Save(item)
+		if err != nil {
+			return err
+		}
+	}
+
+	prevKeyFiles, err := readKeyFiles(vault.DataDir())
+	if err != nil {
+		return fmt.Errorf("Failed to read encryption key files: %v", err)
+	}
+	batch.finish = func() error {
+		err := saveEncryptionKeys(vault.DataDir(), keyList)
+		if err != nil {
+			restoreKeyFiles(vault.DataDir(), prevKeyFiles)
+			return fmt.Errorf("Failed to save new keys: %v", err)
+		}
+		return nil
+	}
+	_, err = batch.Commit()
+	if err != nil {
+		return err
+	}
+
+	for level, key := range newKeys {
+		newKeys[level] = secureBytes(key)
+	}
+	vault.CryptoAgent = &simpleCryptoAgent{newKeys}
+	return nil
+}
+
+// reEncryptData decrypts item data encrypted with oldKey
+// and encrypts it again with newKey
+func reEncryptData(oldKey []byte, newKey []byte, encrypted []byte) ([]byte, error) {
+	content, err := DecryptItemData(oldKey, encrypted)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroBytes(content)
+	return EncryptItemData(newKey, content)
+}
+
+// readKeyFiles returns the contents of the key files in dataDir
+// which exist, so that they can be restored with restoreKeyFiles()
+func readKeyFiles(dataDir string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	for _, fileName := range keyFileNames {
+		data, err := ioutil.ReadFile(dataDir + "/" + fileName)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		files[fileName] = data
+	}
+	return files, nil
+}
+
+// restoreKeyFiles replaces the key files in dataDir with the
+// contents returned by readKeyFiles()
+func restoreKeyFiles(dataDir string, files map[string][]byte) {
+	for fileName, data := range files {
+		err := jsonutil.WriteFileAtomic(dataDir+"/"+fileName, data, 0644)
+		if err != nil {
+			DebugLog("Restoring %s failed: %v", fileName, err)
+		}
+	}
+}
+
 // Save a new item to the vault. The new item is given a randomly
 // generated ID.
 func (vault *Vault) AddItem(title string, itemType string, content ItemContent) (Item, error) {
+	return vault.AddItemAtLevel(title, itemType, "SL5", content)
+}
+
+// AddItemAtLevel adds a new item to the vault whose content
+// is encrypted with the key for the security level
+// securityLevel (eg. 'SL3' or 'SL5')
+func (vault *Vault) AddItemAtLevel(title string, itemType string, securityLevel string, content ItemContent) (Item, error) {
 	item := Item{
 		Title:         title,
-		SecurityLevel: "SL5",
+		SecurityLevel: securityLevel,
 		Encrypted:     []byte{},
 		TypeName:      itemType,
 		Uuid:          newItemId(),
@@ -459,57 +777,93 @@ func (vault *Vault) AddItem(title string, itemType string, content ItemContent)
 	return item, nil
 }
 
-// Remove the item from the vault
-func (item *Item) Remove() error {
-	item.TypeName = "system.Tombstone"
-	item.Title = "Unnamed"
-	item.Trashed = true
-	err := item.SetContent(ItemContent{})
+// ImportItem adds an item exported from another vault to this vault,
+// preserving its metadata such as tags, folder and creation time.
+// The item keeps its existing ID unless the vault already
+// contains an item with the same ID.
+func (vault *Vault) ImportItem(exported ExportedItem) (Item, error) {
+	item, err := vault.prepareImport(exported, nil)
 	if err != nil {
-		return err
+		return Item{}, err
 	}
 	err = item.Save()
-	return err
+	if err != nil {
+		return Item{}, err
+	}
+	return item, nil
 }
 
-// Remove the item's data files from the vault
-func (item *Item) removeDataFiles() error {
-	itemDataFile := item.Path()
+// prepareImport returns a new item for the vault with the metadata
+// and content of an exported item, without saving it. The item is
+// given a new ID if its ID is already used in the vault or is in
+// pendingIds.
+func (vault *Vault) prepareImport(exported ExportedItem, pendingIds map[string]bool) (Item, error) {
+	item := exported.Item
+	item.vault = vault
+	item.SecurityLevel = "SL5"
+	item.Encrypted = []byte{}
+	item.ContentsHash = ""
+	item.TxTimestamp = 0
 
-	// remove contents.js entry
-	contentsFilePath := item.vault.DataDir() + "/contents.js"
-	var contentsEntries [][]interface{}
-	err := jsonutil.ReadFile(contentsFilePath, &contentsEntries)
-	if err != nil {
-		return fmt.Errorf("Failed to read contents.js: %v", err)
-	}
+	// conflicting revisions are encrypted with the source vault's key
+	item.Conflicts = nil
 
-	foundExisting := false
-	newContentsEntries := [][]interface{}{}
-	for _, entry := range contentsEntries {
-		tmpItem := readContentsEntry(entry)
-		if tmpItem.Uuid == item.Uuid {
-			foundExisting = true
-		} else {
-			newContentsEntries = append(newContentsEntries, entry)
-		}
+	validId := IsValidItemId(item.Uuid)
+	if validId {
+		// keep the item's ID unless it is already in use
+		_, err := vault.backend().LoadItem(item.Uuid)
+		validId = err != nil && !pendingIds[item.Uuid]
 	}
-	if !foundExisting {
-		return fmt.Errorf("Entry '%s' (ID: %s) not found", item.Title, item.Uuid)
+	if !validId {
+		item.Uuid = newItemId()
 	}
 
-	err = jsonutil.WriteFile(contentsFilePath, newContentsEntries)
+	err := item.SetContent(exported.SecureContents)
 	if err != nil {
-		return fmt.Errorf("Failed to update contents.js: %v", err)
+		return Item{}, err
+	}
+	if item.TypeName == DocumentType {
+		if vault.Backend != nil {
+			return Item{}, errors.New("Documents can only be saved in Agile Keychain vaults")
+		}
+		if exported.Document == nil {
+			return Item{}, fmt.Errorf("The file for the document '%s' is missing", item.Title)
+		}
+		item.document, err = vault.CryptoAgent.Encrypt(item.SecurityLevel, exported.Document)
+		if err != nil {
+			return Item{}, fmt.Errorf("Failed to encrypt document: %v", err)
+		}
 	}
+	return item, nil
+}
 
-	// remove .1password data file
-	err = os.Remove(itemDataFile)
+// Remove the item from the vault
+func (item *Item) Remove() error {
+	if err := item.vault.checkWritable(); err != nil {
+		return err
+	}
+	if item.vault.PreRemove != nil {
+		if err := item.vault.PreRemove(*item); err != nil {
+			return err
+		}
+	}
+	if item.TypeName == DocumentType {
+		os.Remove(item.documentPath())
+	}
+	item.TypeName = "system.Tombstone"
+	item.Title = "Unnamed"
+	item.Trashed = true
+	err := item.SetContent(ItemContent{})
 	if err != nil {
-		return fmt.Errorf("Failed to remove item data file: %s: %v", itemDataFile, err)
+		return err
 	}
+	err = item.Save()
+	return err
+}
 
-	return nil
+// Remove the item's data files from the vault
+func (item *Item) removeDataFiles() error {
+	return item.vault.backend().RemoveItem(item.Uuid)
 }
 
 func (item *Item) contentsEntry() []interface{} {
@@ -546,99 +900,238 @@ func readContentsEntry(entry []interface{}) Item {
 	}
 }
 
+// ParseContentsIndex parses the data from a vault's contents.js
+// index file and returns the items listed in it. Only the metadata
+// stored in the index is set for each item.
+func ParseContentsIndex(data []byte) ([]Item, error) {
+	var contentsEntries [][]interface{}
+	err := json.Unmarshal(data, &contentsEntries)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse contents.js: %v", err)
+	}
+	items := []Item{}
+	for i, entry := range contentsEntries {
+		item, ok := checkContentsEntry(entry)
+		if !ok {
+			return nil, fmt.Errorf("Invalid entry %d in contents.js", i)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// FormatContentsIndex returns the contents.js index file
+// data for a list of items
+func FormatContentsIndex(items []Item) ([]byte, error) {
+	contentsEntries := [][]interface{}{}
+	for _, item := range items {
+		contentsEntries = append(contentsEntries, item.contentsEntry())
+	}
+	return json.Marshal(contentsEntries)
+}
+
 // Returns the path of the file containing
 // this item.
 func (item *Item) Path() string {
 	return item.vault.DataDir() + "/" + item.Uuid + ".1password"
 }
 
+// IsExpired returns true if the item has an expiry date
+// which is at or before now
+func (item *Item) IsExpired(now time.Time) bool {
+	return item.OpenContents.Expires != 0 && int64(item.OpenContents.Expires) <= now.Unix()
+}
+
 // Save item to the vault. The item's UpdatedAt
 // timestamp is updated to the current time and
 // CreatedAt is also set to the current time if
 // it was not previously set.
 func (item *Item) Save() error {
-	if len(item.Encrypted) == 0 {
+	if err := item.vault.checkWritable(); err != nil {
+		return err
+	}
+	if len(item.Encrypted) == 0 && item.loadEncrypted() != nil {
 		return fmt.Errorf("Item content not set")
 	}
+	if item.document != nil && item.vault.Backend != nil {
+		return errors.New("Documents can only be saved in Agile Keychain vaults")
+	}
 
 	item.UpdatedAt = uint64(time.Now().Unix())
 	if item.CreatedAt == 0 {
 		item.CreatedAt = item.UpdatedAt
 	}
+	err := item.vault.backend().SaveItem(*item)
+	if err == nil {
+		item.document = nil
+	}
+	if err == nil && item.vault.PostSave != nil {
+		item.vault.PostSave(*item)
+	}
+	return err
+}
 
-	// save item to .1password file
-	itemPath := item.Path()
-	err := jsonutil.WriteFile(itemPath, item)
+// UpdateIndex adds or replaces the entries for items in the
+// vault's contents.js index file. The item files themselves
+// are not modified.
+func (vault *Vault) UpdateIndex(items []Item) error {
+	if err := vault.checkWritable(); err != nil {
+		return err
+	}
+	unlock, err := vault.lockForWrite()
 	if err != nil {
-		return fmt.Errorf("Failed to save item %s: %v", item.Title, err)
+		return err
 	}
+	defer unlock()
+	return vault.updateIndex(items)
+}
 
-	// update contents.js entry
-	contentsFilePath := item.vault.DataDir() + "/contents.js"
+// updateIndex implements UpdateIndex(). The caller
+// must hold the vault's write lock.
+func (vault *Vault) updateIndex(items []Item) error {
+	contentsFilePath := vault.DataDir() + "/contents.js"
 	var contentsEntries [][]interface{}
-	err = jsonutil.ReadFile(contentsFilePath, &contentsEntries)
+	err := jsonutil.ReadFile(contentsFilePath, &contentsEntries)
 	if err != nil {
 		return fmt.Errorf("Failed to read contents.js: %v", err)
 	}
-	foundExisting := false
+	entryIndex := map[string]int{}
 	for i, entry := range contentsEntries {
-		tmpItem := readContentsEntry(entry)
-		if tmpItem.Uuid == item.Uuid {
+		entryIndex[readContentsEntry(entry).Uuid] = i
+	}
+	for _, item := range items {
+		if i, foundExisting := entryIndex[item.Uuid]; foundExisting {
 			contentsEntries[i] = item.contentsEntry()
-			foundExisting = true
-			break
+		} else {
+			entryIndex[item.Uuid] = len(contentsEntries)
+			contentsEntries = append(contentsEntries, item.contentsEntry())
 		}
 	}
-	if !foundExisting {
-		contentsEntries = append(contentsEntries, item.contentsEntry())
-	}
 	err = jsonutil.WriteFile(contentsFilePath, contentsEntries)
 	if err != nil {
 		return fmt.Errorf("Failed to update contents.js: %v", err)
 	}
+	markContentsIndexCurrent(vault.DataDir())
 
 	return nil
 }
 
 func (vault *Vault) LoadItem(uuid string) (Item, error) {
-	item := Item{
-		vault: vault,
+	item, err := vault.backend().LoadItem(uuid)
+	item.vault = vault
+	if err != nil {
+		DebugLog("Reading item %s failed: %v", uuid, err)
+		return Item{}, err
 	}
-	err := jsonutil.ReadFile(vault.DataDir()+"/"+uuid+".1password", &item)
+	DebugLog("Read item %s (%d bytes encrypted)", uuid, len(item.Encrypted))
+	return item, nil
+}
+
+// DecodeItem parses the contents of an item file read from another
+// copy of the vault, such as a remote copy which is being synced.
+// The item can then be saved to this vault.
+func (vault *Vault) DecodeItem(data []byte) (Item, error) {
+	var item Item
+	err := json.Unmarshal(data, &item)
 	if err != nil {
 		return Item{}, err
 	}
+	if !IsValidItemId(item.Uuid) {
+		return Item{}, fmt.Errorf("Invalid item ID '%s'", item.Uuid)
+	}
+	item.vault = vault
 	return item, nil
 }
 
-// Returns a list of all items in the vault.
-// Returned items have their main content still encrypted
-func (vault *Vault) ListItems() ([]Item, error) {
-	items := []Item{}
-	dirEntries, err := ioutil.ReadDir(vault.DataDir())
+// WriteItemFile replaces the file for the item with ID uuid with data,
+// the contents of the item's file in another copy of the vault. Unlike
+// Item.Save(), the file is written as-is and the index is not updated.
+func (vault *Vault) WriteItemFile(uuid string, data []byte) error {
+	if err := vault.checkWritable(); err != nil {
+		return err
+	}
+	if !IsValidItemId(uuid) {
+		return fmt.Errorf("Invalid item ID '%s'", uuid)
+	}
+	unlock, err := vault.lockForWrite()
 	if err != nil {
-		return items, err
+		return err
 	}
-	for _, item := range dirEntries {
-		if path.Ext(item.Name()) == ".1password" {
-			itemData := Item{vault: vault}
-			err := jsonutil.ReadFile(vault.DataDir()+"/"+item.Name(), &itemData)
-			if err != nil {
-				fmt.Printf("Failed to read item: %s: %v\n", item.Name(), err)
-			} else if itemData.TypeName != "system.Tombstone" {
-				items = append(items, itemData)
+	defer unlock()
+	return jsonutil.WriteFileAtomic(vault.DataDir()+"/"+uuid+".1password", data, 0644)
+}
+
+// WriteKeyFile replaces one of the files in the data folder which hold
+// the vault's encryption keys or password hint, for example with a copy
+// fetched from another device.
+func (vault *Vault) WriteKeyFile(name string, data []byte) error {
+	if err := vault.checkWritable(); err != nil {
+		return err
+	}
+	switch name {
+	case "encryptionKeys.js", "1password.keys", ".password.hint":
+	default:
+		return fmt.Errorf("'%s' is not a key file", name)
+	}
+	unlock, err := vault.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return jsonutil.WriteFileAtomic(vault.DataDir()+"/"+name, data, 0644)
+}
+
+// Returns a list of all items in the vault.
+// The encrypted content of the returned items is only read
+// from the item files when it is needed.
+//
+// Commands which only need a few items should use FindItems()
+// and those which process items one at a time should use Items().
+func (vault *Vault) ListItems() ([]Item, error) {
+	if indexer, ok := vault.CryptoAgent.(ItemIndexer); ok {
+		items, err := indexer.ListItems()
+		if err == nil {
+			for i, _ := range items {
+				items[i].vault = vault
 			}
+			return items, nil
 		}
+		// fall back to reading the item files
+	}
+
+	it, err := vault.Items()
+	if err != nil {
+		return []Item{}, err
+	}
+	items := []Item{}
+	for it.Next() {
+		items = append(items, it.Item())
 	}
 	return items, nil
 }
 
+// listItemFiles returns all of the items stored in the
+// vault, including tombstones for removed items
+func (vault *Vault) listItemFiles() ([]Item, error) {
+	items, err := vault.backend().ListItems()
+	for i := range items {
+		items[i].vault = vault
+	}
+	return items, err
+}
+
 // Decrypts the item's content and returns it
 // as a JSON string
 func (item *Item) ContentJson() (string, error) {
 	if item.vault.IsLocked() {
 		return "", errors.New("Vault is locked")
 	}
+	if len(item.Encrypted) == 0 {
+		err := item.loadEncrypted()
+		if err != nil {
+			return "", err
+		}
+	}
 	if len(item.Encrypted) < 16 {
 		return "", errors.New("No item data")
 	}
@@ -649,6 +1142,20 @@ func (item *Item) ContentJson() (string, error) {
 	return string(decrypted), nil
 }
 
+// reads the encrypted content of an item which was
+// listed from an index without its content
+func (item *Item) loadEncrypted() error {
+	if item.vault == nil || item.Uuid == "" {
+		return errors.New("No item data")
+	}
+	stored, err := item.vault.LoadItem(item.Uuid)
+	if err != nil {
+		return err
+	}
+	item.Encrypted = stored.Encrypted
+	return nil
+}
+
 // Decrypts and returns the content of the item
 func (item *Item) Content() (ItemContent, error) {
 	content, err := item.ContentJson()
@@ -768,6 +1275,9 @@ func aesCbcDecrypt(key []byte, cipherText []byte, iv []byte) ([]byte, error) {
 	if len(iv) != Aes128KeyLen {
 		return nil, fmt.Errorf("Incorrect IV length")
 	}
+	if len(cipherText) == 0 || len(cipherText)%AesBlockLen != 0 {
+		return nil, fmt.Errorf("Ciphertext length is not a multiple of %d", AesBlockLen)
+	}
 	aesCipher, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to initialize AES cipher")
@@ -846,6 +1356,7 @@ func extractSaltAndCipherText(data []byte) ([]byte, []byte, error) {
 func encryptKey(masterPwd []byte, decryptedKey []byte, salt []byte, iterCount int) ([]byte, []byte, error) {
 	const keyLen = 32
 	derivedKey := pbkdf2.Key(masterPwd, salt, iterCount, keyLen, sha1.New)
+	defer ZeroBytes(derivedKey)
 	aesKey := derivedKey[0:16]
 	iv := derivedKey[16:32]
 	encryptedKey, err := aesCbcEncrypt(aesKey, decryptedKey, iv)
@@ -867,6 +1378,7 @@ func encryptKey(masterPwd []byte, decryptedKey []byte, salt []byte, iterCount in
 func decryptKey(masterPwd []byte, encryptedKey []byte, salt []byte, iterCount int, validation []byte) ([]byte, error) {
 	const keyLen = 32
 	derivedKey := pbkdf2.Key(masterPwd, salt, iterCount, keyLen, sha1.New)
+	defer ZeroBytes(derivedKey)
 
 	aesKey := derivedKey[0:16]
 	iv := derivedKey[16:32]
@@ -883,10 +1395,13 @@ func decryptKey(masterPwd []byte, encryptedKey []byte, salt []byte, iterCount in
 	validationAesKey, validationIv := openSslKey(decryptedKey, validationSalt)
 	decryptedValidation, err := aesCbcDecrypt(validationAesKey, validationCipherText, validationIv)
 	if err != nil {
+		ZeroBytes(decryptedKey)
 		return nil, fmt.Errorf("Failed to decrypt validation: %v", err)
 	}
+	defer ZeroBytes(decryptedValidation)
 
-	if string(decryptedValidation) != string(decryptedKey) {
+	if !hmac.Equal(decryptedValidation, decryptedKey) {
+		ZeroBytes(decryptedKey)
 		return nil, errors.New("Validation decryption failed")
 	}
 
@@ -905,7 +1420,9 @@ func writePlistFile(path string, in interface{}) error {
 //
 func openSslKey(password []byte, salt []byte) (key []byte, iv []byte) {
 	const rounds = 2
-	data := append(password, salt...)
+	// copy the password so that salt is not appended to
+	// a key buffer shared with concurrent callers
+	data := append(append([]byte{}, password...), salt...)
 	md5Hashes := make([][]byte, rounds)
 
 	sum := md5.Sum(data)
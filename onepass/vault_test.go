@@ -3,13 +3,17 @@ package onepass
 import (
 	"bytes"
 	"encoding/hex"
+	"fmt"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 	"unicode"
 
 	uuid "github.com/nu7hatch/gouuid"
+
+	"github.com/robertknight/1pass/jsonutil"
 )
 
 func newTestItem(vault *Vault) Item {
@@ -336,3 +340,256 @@ func TestGenPassword(t *testing.T) {
 		}
 	}
 }
+
+func TestReEncrypt(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	content := newTestContent("reencrypt.com")
+	item, err := vault.AddItem("Test Item", "securenotes.SecureNote", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldKeys, err := UnlockKeys(vault.Path, "test-pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = vault.ReEncrypt("test-pwd", "")
+	if err != nil {
+		t.Fatalf("Failed to re-encrypt vault: %v", err)
+	}
+	newKeys, err := UnlockKeys(vault.Path, "test-pwd")
+	if err != nil {
+		t.Fatalf("Failed to unlock re-encrypted vault: %v", err)
+	}
+	if bytes.Equal(oldKeys["SL5"], newKeys["SL5"]) {
+		t.Errorf("Encryption key was not replaced")
+	}
+
+	err = vault.Unlock("test-pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadedItem, err := vault.LoadItem(item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadedContent, err := loadedItem.Content()
+	if err != nil {
+		t.Fatalf("Failed to decrypt re-encrypted item: %v", err)
+	}
+	if !reflect.DeepEqual(loadedContent, content) {
+		t.Errorf("Re-encrypted content mismatch. Actual: %s, expected: %s", loadedContent, content)
+	}
+}
+
+func TestReEncryptSecurityLevel(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+
+	// add an SL3 key protected by the same password
+	var keyList encryptionKeys
+	err = jsonutil.ReadFile(vault.DataDir()+"/encryptionKeys.js", &keyList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := randomBytes(8)
+	encryptedKey, validation, err := encryptKey([]byte("test-pwd"), randomBytes(1024), salt, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyList.List = append(keyList.List, encKeyEntry{
+		Data:       []byte(fmt.Sprintf("Salted__%s%s", salt, encryptedKey)),
+		Identifier: newItemId(),
+		Iterations: 100,
+		Level:      "SL3",
+		Validation: validation,
+	})
+	err = saveEncryptionKeys(vault.DataDir(), keyList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = vault.Unlock("test-pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := newTestContent("sl3.com")
+	item, err := vault.AddItemAtLevel("Low Security", "securenotes.SecureNote", "SL3", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = vault.ReEncrypt("test-pwd", "SL4")
+	if err == nil {
+		t.Errorf("Expected re-encrypting to a missing level to fail")
+	}
+	err = vault.ReEncrypt("test-pwd", "SL5")
+	if err != nil {
+		t.Fatalf("Failed to re-encrypt vault: %v", err)
+	}
+	loadedItem, err := vault.LoadItem(item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loadedItem.SecurityLevel != "SL5" {
+		t.Errorf("Expected item to be moved to SL5, got %s", loadedItem.SecurityLevel)
+	}
+	loadedContent, err := loadedItem.Content()
+	if err != nil || !reflect.DeepEqual(loadedContent, content) {
+		t.Errorf("Unexpected content after re-encrypting: %v (%v)", loadedContent, err)
+	}
+}
+
+func TestReadOnlyVault(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	item, err := vault.AddItem("Read Only", "securenotes.SecureNote", newTestContent("readonly.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vault.ReadOnly = true
+	_, err = vault.AddItem("New Item", "securenotes.SecureNote", newTestContent("new.com"))
+	if err != ErrReadOnly {
+		t.Errorf("Expected adding item to fail, got: %v", err)
+	}
+	item.Title = "Renamed"
+	if err = item.Save(); err != ErrReadOnly {
+		t.Errorf("Expected saving item to fail, got: %v", err)
+	}
+	if err = item.Remove(); err != ErrReadOnly {
+		t.Errorf("Expected removing item to fail, got: %v", err)
+	}
+	if err = vault.SetMasterPassword("test-pwd", "new-pwd"); err != ErrReadOnly {
+		t.Errorf("Expected changing password to fail, got: %v", err)
+	}
+
+	// the vault can still be read
+	items, err := vault.ListItems()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Title != "Read Only" {
+		t.Errorf("Unexpected items in read-only vault: %v", items)
+	}
+}
+
+func TestItemHooks(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+	saved := []string{}
+	vault.PostSave = func(item Item) {
+		saved = append(saved, item.TypeName)
+	}
+	item, err := vault.AddItem("Hooked", "securenotes.SecureNote", newTestContent("hooked.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(saved, []string{"securenotes.SecureNote"}) {
+		t.Errorf("Expected post-save hook to be called for new item, got %v", saved)
+	}
+
+	vault.PreRemove = func(item Item) error {
+		return fmt.Errorf("Not removing %s", item.Title)
+	}
+	if err = item.Remove(); err == nil {
+		t.Errorf("Expected pre-remove hook to prevent removal")
+	}
+	loaded, err := vault.LoadItem(item.Uuid)
+	if err != nil || loaded.TypeName != "securenotes.SecureNote" {
+		t.Errorf("Expected item to be kept, got %v (%v)", loaded, err)
+	}
+
+	removed := ""
+	vault.PreRemove = func(item Item) error {
+		removed = item.Title
+		return nil
+	}
+	if err = item.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if removed != "Hooked" {
+		t.Errorf("Expected pre-remove hook to receive item, got '%s'", removed)
+	}
+	if saved[len(saved)-1] != "system.Tombstone" {
+		t.Errorf("Expected post-save hook to be called for tombstone, got %v", saved)
+	}
+}
+
+func TestSecurityLevels(t *testing.T) {
+	vault, err := newTestVault()
+	if err != nil {
+		t.Fatalf("Creating test vault failed: %v", err)
+	}
+
+	// add an SL3 key protected by a different password
+	var keyList encryptionKeys
+	err = jsonutil.ReadFile(vault.DataDir()+"/encryptionKeys.js", &keyList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := randomBytes(8)
+	encryptedKey, validation, err := encryptKey([]byte("sl3-pwd"), randomBytes(1024), salt, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyList.List = append(keyList.List, encKeyEntry{
+		Data:       []byte(fmt.Sprintf("Salted__%s%s", salt, encryptedKey)),
+		Identifier: newItemId(),
+		Iterations: 100,
+		Level:      "SL3",
+		Validation: validation,
+	})
+	err = saveEncryptionKeys(vault.DataDir(), keyList)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	levels, err := vault.SecurityLevels()
+	if err != nil || len(levels) != 2 {
+		t.Errorf("Expected two security levels, got %v (%v)", levels, err)
+	}
+
+	// unlocking with the SL3 password only unlocks the SL3 key
+	err = vault.Unlock("sl3-pwd")
+	if err != nil {
+		t.Fatalf("Unable to unlock SL3 key: %v", err)
+	}
+	item, err := vault.AddItemAtLevel("Low Security", "securenotes.SecureNote", "SL3", newTestContent("sl3.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = vault.AddItem("High Security", "securenotes.SecureNote", newTestContent("sl5.com"))
+	if err == nil || !strings.Contains(err.Error(), KeyLockedError{"SL5"}.Error()) {
+		t.Errorf("Expected SL5 key to be locked, got: %v", err)
+	}
+
+	err = vault.Unlock("test-pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked, err := vault.LockedKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locked) != 1 || locked[0].Level != "SL3" || !IsKeyFileError(locked[0]) {
+		t.Errorf("Expected SL3 key to be reported as locked, got %v", locked)
+	}
+	_, err = item.Content()
+	if err == nil || !strings.Contains(err.Error(), KeyLockedError{"SL3"}.Error()) {
+		t.Errorf("Expected SL3 item to be unreadable with the SL5 key, got: %v", err)
+	}
+
+	err = vault.Unlock("wrong-pwd")
+	if _, ok := err.(DecryptError); !ok {
+		t.Errorf("Expected wrong password to be rejected, got: %v", err)
+	}
+}
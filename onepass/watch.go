@@ -0,0 +1,86 @@
+package onepass
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// VaultWatcher reports changes to the files in a vault's
+// data folder, such as those made by another device's
+// sync client.
+type VaultWatcher struct {
+	// Changes receives the names of files in the vault's
+	// data folder which have been created, modified or removed.
+	// Changes made in quick succession are reported together.
+	//
+	// The channel is closed when the watcher is closed.
+	Changes chan []string
+
+	events    chan string
+	done      chan bool
+	stop      func()
+	closeOnce sync.Once
+}
+
+// period without further changes after which
+// pending changes are reported
+const watchSettleDelay = 200 * time.Millisecond
+
+// Watch starts watching the vault's data folder for changes.
+// The watcher must be closed with Close() when no longer needed.
+func (vault *Vault) Watch() (*VaultWatcher, error) {
+	watcher := &VaultWatcher{
+		Changes: make(chan []string),
+		events:  make(chan string),
+		done:    make(chan bool),
+	}
+	stop, err := watchDir(vault.DataDir(), watcher.events, watcher.done)
+	if err != nil {
+		return nil, err
+	}
+	watcher.stop = stop
+	go watcher.batchEvents()
+	return watcher, nil
+}
+
+// Close stops watching the vault for changes
+func (watcher *VaultWatcher) Close() {
+	watcher.closeOnce.Do(func() {
+		close(watcher.done)
+		watcher.stop()
+	})
+}
+
+// collects change events for individual files and
+// reports them once no further changes have occurred
+// for watchSettleDelay
+func (watcher *VaultWatcher) batchEvents() {
+	defer close(watcher.Changes)
+
+	pending := map[string]bool{}
+	var settled <-chan time.Time
+	for {
+		select {
+		case name := <-watcher.events:
+			pending[name] = true
+			settled = time.After(watchSettleDelay)
+		case <-settled:
+			names := []string{}
+			for name, _ := range pending {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			pending = map[string]bool{}
+			settled = nil
+
+			select {
+			case watcher.Changes <- names:
+			case <-watcher.done:
+				return
+			}
+		case <-watcher.done:
+			return
+		}
+	}
+}
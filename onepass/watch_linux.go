@@ -0,0 +1,79 @@
+package onepass
+
+import (
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// watches dir for changes using inotify and sends the names of
+// changed files to events until the function returned
+// by watchDir() is called
+func watchDir(dir string, events chan<- string, done <-chan bool) (func(), error) {
+	fd, err := syscall.InotifyInit()
+	if err != nil {
+		return nil, err
+	}
+	const mask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_DELETE |
+		syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+	wd, err := syscall.InotifyAddWatch(fd, dir, mask)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	// protects fd, which is set to -1 once closed
+	var mu sync.Mutex
+
+	go func() {
+		defer func() {
+			mu.Lock()
+			syscall.Close(fd)
+			fd = -1
+			mu.Unlock()
+		}()
+
+		var buf [(syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1) * 16]byte
+		for {
+			n, err := syscall.Read(fd, buf[:])
+			if err == syscall.EINTR {
+				continue
+			} else if err != nil || n <= 0 {
+				return
+			}
+
+			offset := 0
+			for offset+syscall.SizeofInotifyEvent <= n {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				nameStart := offset + syscall.SizeofInotifyEvent
+				offset = nameStart + int(event.Len)
+
+				if event.Mask&syscall.IN_IGNORED != 0 {
+					// the watch was removed, either by the stop
+					// function or because dir was removed
+					return
+				}
+				name := strings.TrimRight(string(buf[nameStart:offset]), "\x00")
+				if name == "" {
+					continue
+				}
+				select {
+				case events <- name:
+				case <-done:
+				}
+			}
+		}
+	}()
+
+	// removing the watch generates an IN_IGNORED
+	// event which ends the read loop above
+	stop := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if fd != -1 {
+			syscall.InotifyRmWatch(fd, uint32(wd))
+		}
+	}
+	return stop, nil
+}
@@ -0,0 +1,82 @@
+//go:build !linux
+// +build !linux
+
+package onepass
+
+import (
+	"io/ioutil"
+	"time"
+)
+
+// interval between checks for changes on
+// platforms without inotify support
+const watchPollInterval = time.Second
+
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+func snapshotDir(dir string) (map[string]watchedFile, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]watchedFile{}
+	for _, entry := range entries {
+		files[entry.Name()] = watchedFile{
+			size:    entry.Size(),
+			modTime: entry.ModTime(),
+		}
+	}
+	return files, nil
+}
+
+// watches dir for changes by periodically comparing the sizes
+// and modification times of the files in it and sends the names
+// of changed files to events until done is closed
+func watchDir(dir string, events chan<- string, done <-chan bool) (func(), error) {
+	prev, err := snapshotDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		ticker := time.NewTicker(watchPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+
+			current, err := snapshotDir(dir)
+			if err != nil {
+				continue
+			}
+			changed := []string{}
+			for name, file := range current {
+				if prevFile, ok := prev[name]; !ok || prevFile != file {
+					changed = append(changed, name)
+				}
+			}
+			for name, _ := range prev {
+				if _, ok := current[name]; !ok {
+					changed = append(changed, name)
+				}
+			}
+			prev = current
+
+			for _, name := range changed {
+				select {
+				case events <- name:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {}, nil
+}
@@ -0,0 +1,52 @@
+package onepass
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWatchVault(t *testing.T) {
+	vaultPath := os.TempDir() + "/watch-test.agilekeychain"
+	os.RemoveAll(vaultPath)
+	vault, err := NewVault(vaultPath, VaultSecurity{MasterPwd: "test-pwd", Iterations: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(vaultPath)
+
+	watcher, err := vault.Watch()
+	if err != nil {
+		t.Fatalf("Unable to watch vault: %v", err)
+	}
+	defer watcher.Close()
+
+	err = ioutil.WriteFile(vault.DataDir()+"/ABCD.1password", []byte("{}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Remove(vault.DataDir() + "/contents.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case changes := <-watcher.Changes:
+		if len(changes) != 2 || changes[0] != "ABCD.1password" || changes[1] != "contents.js" {
+			t.Errorf("Unexpected changes: %v", changes)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Changes were not reported")
+	}
+
+	watcher.Close()
+	select {
+	case _, ok := <-watcher.Changes:
+		if ok {
+			t.Errorf("Unexpected changes after watcher was closed")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Changes channel was not closed")
+	}
+}
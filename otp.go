@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"code.google.com/p/go.crypto/ssh/terminal"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func otpHelp() string {
+	return `Prints the current one-time password for an item with a one-time
+password field, such as a login imported with its TOTP secret.
+
+The field's value is either an 'otpauth://totp/' URI or a base32
+secret. The 'algorithm' (SHA1, SHA256 or SHA512), 'digits' and 'period'
+parameters of the URI are used, defaulting to 6-digit SHA1 codes which
+change every 30 seconds.
+
+For Steam Guard, which uses 5-character codes, set the field to
+'steam://<secret>' or add 'encoder=steam' to its otpauth URI.
+
+Counter-based passwords, with an 'otpauth://hotp/' URI, require -next.
+The counter stored in the URI is incremented each time a code is
+generated, so each code is only printed once.
+
+Flags:
+
+  -copy   Copy the password to the clipboard instead of printing it.
+  -next   Generate the next code for a counter-based password.
+  -watch  Keep showing the current code with a countdown until Enter
+          is pressed. With -copy, each new code is copied to the
+          clipboard.`
+}
+
+// width of the countdown bar shown by 'otp -watch'
+const otpBarWidth = 30
+
+type otpOptions struct {
+	// copy the code to the clipboard
+	copy bool
+	// generate the next code of an HOTP password
+	next bool
+	// keep showing the current code
+	watch bool
+}
+
+// countdownBar returns a bar showing the fraction of
+// period which remains
+func countdownBar(remaining time.Duration, period time.Duration, width int) string {
+	filled := int(int64(width) * int64(remaining) / int64(period))
+	if filled > width {
+		filled = width
+	} else if filled < 0 {
+		filled = 0
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", width-filled) + "]"
+}
+
+// watchOtp shows the current code for totp, updating it at the
+// end of each period, until Enter is pressed
+func watchOtp(title string, totp onepass.Totp, copyCode bool) {
+	stop := make(chan bool, 1)
+	go func() {
+		bufio.NewReader(os.Stdin).ReadString('\n')
+		stop <- true
+	}()
+	interactive := terminal.IsTerminal(1)
+	if interactive {
+		fmt.Printf("One-time passwords for '%s', press Enter to stop\n", title)
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	period := time.Duration(totp.Period) * time.Second
+	lastCode := ""
+	for {
+		now := time.Now()
+		code := totp.Code(now)
+		if code != lastCode {
+			if copyCode {
+				err := writeClipboard(code)
+				if err != nil {
+					fatalErr(err, "Failed to copy one-time password to clipboard")
+				}
+			}
+			if !interactive {
+				fmt.Println(code)
+			}
+			lastCode = code
+		}
+		if interactive {
+			remaining := totp.Remaining(now)
+			fmt.Printf("\r%s %s %2ds ", colorize(colorBold, code), countdownBar(remaining, period, otpBarWidth),
+				int(remaining.Seconds()))
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			if interactive {
+				fmt.Println()
+			}
+			return
+		}
+	}
+}
+
+// showOtp prints or copies the current one-time password
+// for the item matching pattern
+func showOtp(vault *onepass.Vault, pattern string, options otpOptions) {
+	item, err := lookupSingleItem(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Failed to find item")
+	}
+	content, err := item.Content()
+	if err != nil {
+		fatalErr(err, fmt.Sprintf("Failed to decrypt item '%s'", item.Title))
+	}
+	fields := content.TotpFields()
+	if len(fields) == 0 {
+		fatalErr(fmt.Errorf("'%s' has no one-time password fields", item.Title), "")
+	}
+	totp, err := onepass.ParseTotp(fields[0].ValueString())
+	if err != nil {
+		fatalErr(err, fmt.Sprintf("Unable to read one-time password for '%s'", item.Title))
+	}
+
+	now := time.Now()
+	var code string
+	if totp.CounterBased {
+		if options.watch {
+			fatalErr(fmt.Errorf("-watch can only be used with time-based one-time passwords"), "")
+		}
+		if !options.next {
+			fatalErr(fmt.Errorf("'%s' has a counter-based one-time password. Use -next to generate the next code", item.Title), "")
+		}
+		code, err = vault.NextHotpCode(item.Uuid, fields[0].Name)
+		if err != nil {
+			fatalErr(err, "Unable to generate one-time password")
+		}
+	} else if options.next {
+		fatalErr(fmt.Errorf("-next can only be used with counter-based one-time passwords"), "")
+	} else if options.watch {
+		recordItemUse(vault, item)
+		watchOtp(item.Title, totp, options.copy)
+		return
+	} else {
+		code = totp.Code(now)
+	}
+	if options.copy {
+		err = writeClipboard(code)
+		if err != nil {
+			fatalErr(err, "Failed to copy one-time password to clipboard")
+		}
+		fmt.Printf("Copied one-time password to clipboard for item '%s'\n", item.Title)
+	} else {
+		fmt.Println(code)
+	}
+	if !totp.CounterBased && terminal.IsTerminal(2) {
+		fmt.Fprintf(os.Stderr, "Valid for %v\n", totp.Remaining(now))
+	}
+	recordItemUse(vault, item)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCountdownBar(t *testing.T) {
+	period := 30 * time.Second
+	cases := map[time.Duration]string{
+		30 * time.Second: "[##########]",
+		15 * time.Second: "[#####-----]",
+		2 * time.Second:  "[----------]",
+		45 * time.Second: "[##########]",
+	}
+	for remaining, expected := range cases {
+		if bar := countdownBar(remaining, period, 10); bar != expected {
+			t.Errorf("Expected %s for %v remaining, got %s", expected, remaining, bar)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+//go:build linux && cgo && pam
+// +build linux,cgo,pam
+
+package main
+
+/*
+#cgo LDFLAGS: -lpam
+#include <security/pam_appl.h>
+#include <stdlib.h>
+#include <string.h>
+
+// answers each prompt in the PAM conversation with
+// the password passed as appdata
+static int passwordConv(int count, const struct pam_message **msgs,
+	struct pam_response **responses, void *appdata) {
+	struct pam_response *replies = calloc(count, sizeof(struct pam_response));
+	if (!replies) {
+		return PAM_BUF_ERR;
+	}
+	for (int i = 0; i < count; i++) {
+		int style = msgs[i]->msg_style;
+		if (style == PAM_PROMPT_ECHO_OFF || style == PAM_PROMPT_ECHO_ON) {
+			replies[i].resp = strdup((const char *)appdata);
+		}
+	}
+	*responses = replies;
+	return PAM_SUCCESS;
+}
+
+static int authenticateUser(const char *service, const char *user, const char *password) {
+	struct pam_conv conv = { passwordConv, (void *)password };
+	pam_handle_t *handle = NULL;
+	int status = pam_start(service, user, &conv, &handle);
+	if (status != PAM_SUCCESS) {
+		return status;
+	}
+	status = pam_authenticate(handle, 0);
+	if (status == PAM_SUCCESS) {
+		status = pam_acct_mgmt(handle, 0);
+	}
+	pam_end(handle, status);
+	return status;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+func pamAvailable() bool {
+	return true
+}
+
+// pamAuthenticate checks password for user using the PAM service
+func pamAuthenticate(service string, user string, password string) error {
+	cService := C.CString(service)
+	defer C.free(unsafe.Pointer(cService))
+	cUser := C.CString(user)
+	defer C.free(unsafe.Pointer(cUser))
+	cPassword := C.CString(password)
+	defer func() {
+		C.memset(unsafe.Pointer(cPassword), 0, C.size_t(len(password)))
+		C.free(unsafe.Pointer(cPassword))
+	}()
+
+	status := C.authenticateUser(cService, cUser, cPassword)
+	if status != C.PAM_SUCCESS {
+		return fmt.Errorf("PAM authentication failed (status %d)", int(status))
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux || !cgo || !pam
+// +build !linux !cgo !pam
+
+package main
+
+import "errors"
+
+func pamAvailable() bool {
+	return false
+}
+
+func pamAuthenticate(service string, user string, password string) error {
+	return errors.New("PAM support is not included in this build")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+// menu programs which read a list of choices from stdin and
+// print the selected choice, in order of preference
+var waylandPickers = [][]string{
+	{"wofi", "--dmenu", "--insensitive", "--prompt", "1pass"},
+	{"fuzzel", "--dmenu", "--prompt", "1pass: "},
+}
+var x11Pickers = [][]string{
+	{"rofi", "-dmenu", "-i", "-p", "1pass"},
+	{"dmenu", "-i", "-p", "1pass"},
+}
+
+func pickHelp() string {
+	return `Shows a menu of the items in the vault using a desktop menu program
+and copies the password for the selected item to the clipboard.
+This is useful when bound to a keyboard shortcut. The most recently
+used items are listed first.
+
+Under Wayland 'wofi' or 'fuzzel' is used, otherwise 'rofi' or 'dmenu'.
+
+Flags:
+
+  -type  Type the username and password for the selected item into
+         the focused window, as with 'type', instead of copying.`
+}
+
+// findPicker returns the command line for the first
+// available menu program
+func findPicker() ([]string, error) {
+	pickers := x11Pickers
+	if isWaylandSession() {
+		pickers = append(append([][]string{}, waylandPickers...), x11Pickers...)
+	}
+	for _, picker := range pickers {
+		if _, err := exec.LookPath(picker[0]); err == nil {
+			return picker, nil
+		}
+	}
+	return nil, fmt.Errorf("Unable to find a menu program. Install one of wofi, fuzzel, rofi or dmenu")
+}
+
+// returns the menu entry for an item, which
+// ends with the item's ID
+func pickerEntry(item onepass.Item) string {
+	return fmt.Sprintf("%s (%s)", item.Title, item.Uuid)
+}
+
+// returns the ID of the item from a menu entry
+// created by pickerEntry()
+func pickerEntryId(entry string) string {
+	entry = strings.TrimSpace(entry)
+	start := strings.LastIndex(entry, "(")
+	if start < 0 || !strings.HasSuffix(entry, ")") {
+		return ""
+	}
+	return entry[start+1 : len(entry)-1]
+}
+
+func pickItem(vault *onepass.Vault, pattern string, autoType bool) {
+	items, err := lookupItems(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Unable to lookup items")
+	}
+	items = filterTrashed(items, listOptions{excludeTrashed: true})
+	if len(items) == 0 {
+		fatalErr(fmt.Errorf("No matching items"), "")
+	}
+	lastUsed, err := readItemUsage(vault)
+	if err != nil {
+		debugf("Unable to read item usage: %v", err)
+	}
+	sortByRecentUse(items, lastUsed)
+
+	picker, err := findPicker()
+	if err != nil {
+		fatalErr(err, "")
+	}
+	var choices bytes.Buffer
+	for _, item := range items {
+		fmt.Fprintf(&choices, "%s\n", pickerEntry(item))
+	}
+	cmd := exec.Command(picker[0], picker[1:]...)
+	cmd.Stdin = &choices
+	output, err := cmd.Output()
+	if err != nil {
+		// menu programs exit with an error if
+		// the user cancels the selection
+		return
+	}
+	id := pickerEntryId(string(output))
+	if id == "" {
+		fatalErr(fmt.Errorf("Unexpected selection '%s'", strings.TrimSpace(string(output))), "")
+	}
+
+	if autoType {
+		// no delay is needed since the target window
+		// regains focus when the menu closes
+		autoTypeItem(vault, id, 500*time.Millisecond)
+	} else {
+		copyToClipboard(vault, id, "", vaultConfig(vault.Path).clipboardTimeout())
+	}
+}
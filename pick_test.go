@@ -0,0 +1,18 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func TestPickerEntryId(t *testing.T) {
+	item := onepass.Item{Title: "My (work) login", Uuid: "ABCD1234"}
+	id := pickerEntryId(pickerEntry(item) + "\n")
+	if id != item.Uuid {
+		t.Errorf("Expected ID %s, got '%s'", item.Uuid, id)
+	}
+	if pickerEntryId("no id") != "" {
+		t.Errorf("Expected no ID for unknown entry")
+	}
+}
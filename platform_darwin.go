@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// label of the launchd job used to run the agent, if installed
+// in ~/Library/LaunchAgents
+const launchAgentLabel = "com.github.robertknight.1pass.agent"
+
+// locateVaults searches for vaults using the Spotlight index
+func locateVaults() []string {
+	output, err := exec.Command("mdfind",
+		"kMDItemFSName == '*.agilekeychain' || kMDItemFSName == '*.opvault'").Output()
+	if err != nil {
+		return nil
+	}
+	return strings.Split(string(output), "\n")
+}
+
+// platformVaultPaths returns the locations where vaults
+// are usually found on this platform, other than Dropbox
+func platformVaultPaths() []string {
+	home := homeDir()
+	return []string{
+		home + "/Library/Mobile Documents/com~apple~CloudDocs/1Password/1Password.agilekeychain",
+		home + "/Library/Application Support/1Password/1Password.agilekeychain",
+	}
+}
+
+// command used by locateVaults()
+const vaultLocator = "mdfind"
+
+// systemClipboardTools returns the commands, one of which must be
+// installed, used by readSystemClipboard() and writeSystemClipboard()
+func systemClipboardTools() []string {
+	return []string{"pbcopy"}
+}
+
+func readSystemClipboard() (string, error) {
+	output, err := exec.Command("pbpaste").Output()
+	return string(output), err
+}
+
+func writeSystemClipboard(text string) error {
+	cmd := exec.Command("pbcopy")
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+// startAgent starts the agent using launchd if a launch agent
+// has been installed for it, otherwise the agent is started
+// in a new session so that it is not stopped when the terminal
+// which started it is closed
+func startAgent() error {
+	plistPath := homeDir() + "/Library/LaunchAgents/" + launchAgentLabel + ".plist"
+	if _, err := os.Stat(plistPath); err == nil {
+		return exec.Command("launchctl", "start", launchAgentLabel).Run()
+	}
+	agentCmd := exec.Command(os.Args[0], "-agent")
+	agentCmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	return agentCmd.Start()
+}
+
+// openURL opens url in the user's default browser
+func openURL(url string) error {
+	return exec.Command("open", url).Run()
+}
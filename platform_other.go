@@ -0,0 +1,67 @@
+//go:build !darwin
+// +build !darwin
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/robertknight/clipboard"
+)
+
+// locateVaults searches for vaults using the 'locate' database
+func locateVaults() []string {
+	output, err := exec.Command("locate", "-b", "--existing", ".agilekeychain", ".opvault").Output()
+	if err != nil {
+		return nil
+	}
+	return strings.Split(string(output), "\n")
+}
+
+// platformVaultPaths returns the locations where vaults
+// are usually found on this platform, other than Dropbox
+func platformVaultPaths() []string {
+	return nil
+}
+
+// command used by locateVaults()
+const vaultLocator = "locate"
+
+// systemClipboardTools returns the commands, one of which must be
+// installed, used by readSystemClipboard() and writeSystemClipboard()
+func systemClipboardTools() []string {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	return []string{"xclip", "xsel"}
+}
+
+func readSystemClipboard() (string, error) {
+	return clipboard.ReadAll()
+}
+
+func writeSystemClipboard(text string) error {
+	return clipboard.WriteAll(text)
+}
+
+// startAgent starts the agent via systemd if the agent service
+// has been installed, otherwise the agent is started directly
+func startAgent() error {
+	if started, err := startAgentService(); started || err != nil {
+		return err
+	}
+	agentCmd := exec.Command(os.Args[0], "-agent")
+	err := agentCmd.Start()
+	return err
+}
+
+// openURL opens url in the user's default browser
+func openURL(url string) error {
+	if runtime.GOOS == "windows" {
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	}
+	return exec.Command("xdg-open", url).Start()
+}
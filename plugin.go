@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/robertknight/1pass/cmdmodes"
+)
+
+// prefix of the names of executables on the PATH
+// which provide additional commands
+const pluginPrefix = "1pass-"
+
+// environment variables passed to plugins
+const (
+	// path of the vault which the plugin should use. This is
+	// also read by 1pass, so that commands which a plugin runs
+	// via $ONEPASS_BIN use the same vault as the plugin.
+	vaultEnvVar = "ONEPASS_VAULT"
+
+	// path of the 1pass executable which ran the plugin
+	binEnvVar = "ONEPASS_BIN"
+
+	// path of the agent's socket, for plugins which talk to
+	// the agent directly. See docs/agent-protocol.md
+	agentSocketEnvVar = "ONEPASS_AGENT_SOCKET"
+)
+
+func pluginsHelp() string {
+	return fmt.Sprintf(`Lists the plugins found on the PATH. A plugin is an executable named
+'%[1]s<command>' which is run for '1pass <command>' if <command> is not a
+built-in command, eg. '1pass aws' runs '%[1]saws'. Plugins receive the
+remaining arguments and the following environment variables:
+
+  %[2]s  Path of the vault, as set with 'set-vault' or -vault
+  %[3]s  Path of the 1pass executable, for running other commands
+  %[4]s  Path of the agent's socket
+  %[5]s  Session token from 'signin', if any
+
+Plugins can read items by running '$%[3]s' or by talking to the agent
+directly using the protocol described in docs/agent-protocol.md.`,
+		pluginPrefix, vaultEnvVar, binEnvVar, agentSocketEnvVar, sessionEnvVar)
+}
+
+// isBuiltinCommand returns true if cmd is one of
+// the commands implemented by 1pass itself
+func isBuiltinCommand(modes []cmdmodes.Mode, cmd string) bool {
+	if cmd == "help" {
+		return true
+	}
+	for _, mode := range modes {
+		if mode.Command == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+// findPlugins returns a map of command name to executable path for
+// the plugins in the directories listed in path. If a plugin exists
+// in several directories, the first one found is used.
+func findPlugins(path string) map[string]string {
+	plugins := map[string]string{}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !strings.HasPrefix(name, pluginPrefix) || len(name) == len(pluginPrefix) {
+				continue
+			}
+			if entry.IsDir() || entry.Mode()&0111 == 0 {
+				continue
+			}
+			cmd := strings.TrimPrefix(name, pluginPrefix)
+			if _, exists := plugins[cmd]; !exists {
+				plugins[cmd] = filepath.Join(dir, name)
+			}
+		}
+	}
+	return plugins
+}
+
+func listPlugins() {
+	plugins := findPlugins(os.Getenv("PATH"))
+	commands := []string{}
+	for cmd, _ := range plugins {
+		commands = append(commands, cmd)
+	}
+	sort.Strings(commands)
+	for _, cmd := range commands {
+		fmt.Printf("%s\t%s\n", cmd, plugins[cmd])
+	}
+}
+
+// pluginEnv returns the environment for a plugin, which is the
+// environment of 1pass plus variables describing the vault and
+// how to reach the agent
+func pluginEnv(environ []string, vaultPath string, binPath string) []string {
+	agentSocket := agentConnAddr
+	if remoteAddr := os.Getenv(remoteAgentEnvVar); remoteAddr != "" && isSocketPath(remoteAddr) {
+		agentSocket = strings.TrimPrefix(remoteAddr, "unix:")
+	}
+	return withEnv(environ, map[string]string{
+		vaultEnvVar:       vaultPath,
+		binEnvVar:         binPath,
+		agentSocketEnvVar: agentSocket,
+	})
+}
+
+// withEnv returns a copy of environ with the variables in vars
+// added, replacing any existing values. Variables whose value in
+// vars is empty are removed.
+func withEnv(environ []string, vars map[string]string) []string {
+	env := []string{}
+	for _, entry := range environ {
+		name := strings.SplitN(entry, "=", 2)[0]
+		if _, replaced := vars[name]; !replaced {
+			env = append(env, entry)
+		}
+	}
+	for name, value := range vars {
+		if value != "" {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// runPlugin runs the plugin at pluginPath with args and
+// exits with the plugin's exit status
+func runPlugin(pluginPath string, args []string, vaultPath string) {
+	binPath, err := exec.LookPath(os.Args[0])
+	if err == nil {
+		binPath, err = filepath.Abs(binPath)
+	}
+	if err != nil {
+		binPath = os.Args[0]
+	}
+
+	cmd := exec.Command(pluginPath, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = pluginEnv(os.Environ(), vaultPath, binPath)
+
+	// Ctrl-C is delivered to the plugin as well, which
+	// decides whether to exit
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+
+	err = cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code := exitErr.ExitCode()
+		if code < 0 {
+			// terminated by a signal
+			code = 1
+		}
+		os.Exit(code)
+	}
+	if err != nil {
+		fatalErr(err, fmt.Sprintf("Unable to run plugin '%s'", pluginPath))
+	}
+	os.Exit(0)
+}
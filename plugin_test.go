@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindPlugins(t *testing.T) {
+	dirs := []string{os.TempDir() + "/1pass-test-plugins-a", os.TempDir() + "/1pass-test-plugins-b"}
+	for _, dir := range dirs {
+		os.RemoveAll(dir)
+		err := os.Mkdir(dir, 0700)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+	}
+	files := map[string]os.FileMode{
+		dirs[0] + "/1pass-aws":    0700,
+		dirs[0] + "/1pass-notes":  0600,
+		dirs[0] + "/1pass-":       0700,
+		dirs[0] + "/other-tool":   0700,
+		dirs[1] + "/1pass-aws":    0700,
+		dirs[1] + "/1pass-import": 0755,
+	}
+	for path, mode := range files {
+		err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"), mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plugins := findPlugins(dirs[0] + string(filepath.ListSeparator) + dirs[1] + string(filepath.ListSeparator) + "/no/such/dir")
+	expected := map[string]string{
+		"aws":    dirs[0] + "/1pass-aws",
+		"import": dirs[1] + "/1pass-import",
+	}
+	if len(plugins) != len(expected) {
+		t.Errorf("Expected plugins %v, got %v", expected, plugins)
+	}
+	for cmd, path := range expected {
+		if plugins[cmd] != path {
+			t.Errorf("Expected '%s' plugin at '%s', got '%s'", cmd, path, plugins[cmd])
+		}
+	}
+
+	if isBuiltinCommand(commandModes, "aws") || !isBuiltinCommand(commandModes, "import") {
+		t.Errorf("Expected plugins not to override built-in commands")
+	}
+}
+
+func TestPluginEnv(t *testing.T) {
+	environ := []string{"HOME=/home/test", vaultEnvVar + "=/old/vault", sessionEnvVar + "=token"}
+	env := pluginEnv(environ, "/vaults/test.agilekeychain", "/usr/bin/1pass")
+	vars := map[string]string{}
+	for _, entry := range env {
+		parts := strings.SplitN(entry, "=", 2)
+		if _, exists := vars[parts[0]]; exists {
+			t.Errorf("Duplicate environment variable %s", parts[0])
+		}
+		vars[parts[0]] = parts[1]
+	}
+	expected := map[string]string{
+		"HOME":            "/home/test",
+		vaultEnvVar:       "/vaults/test.agilekeychain",
+		binEnvVar:         "/usr/bin/1pass",
+		agentSocketEnvVar: agentConnAddr,
+		sessionEnvVar:     "token",
+	}
+	for name, value := range expected {
+		if vars[name] != value {
+			t.Errorf("Expected %s=%s, got '%s'", name, value, vars[name])
+		}
+	}
+}
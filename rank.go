@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+	"github.com/robertknight/1pass/rangeutil"
+)
+
+// whether items matching a pattern are ranked by match quality
+// and usage. Disabled with -no-rank so that scripts get the same
+// result regardless of which items have been used.
+var rankMatches = true
+
+// how well an item's title or ID matches a pattern
+const (
+	matchNone = iota
+	// the pattern is part of the title or a prefix of the ID
+	matchSubstring
+	// the pattern is the start of a word in the title
+	matchWordPrefix
+	// the pattern is the start of the title
+	matchTitlePrefix
+	// the pattern is the whole title or ID
+	matchExact
+)
+
+// when several items match a pattern equally well, the most
+// frequently and recently used item is chosen by commands which
+// act on a single item if its frecency score is at least this
+// many times higher than that of the next item
+const frecencyDominance = 2
+
+// matchQuality returns how well item matches pattern
+func matchQuality(item onepass.Item, pattern string) int {
+	if pattern == "" {
+		return matchNone
+	}
+	title := strings.ToLower(item.Title)
+	pattern = strings.ToLower(pattern)
+	switch {
+	case title == pattern || strings.ToLower(item.Uuid) == pattern:
+		return matchExact
+	case strings.HasPrefix(title, pattern):
+		return matchTitlePrefix
+	}
+	for _, word := range strings.FieldsFunc(title, isWordSeparator) {
+		if strings.HasPrefix(word, pattern) {
+			return matchWordPrefix
+		}
+	}
+	if strings.Contains(title, pattern) || strings.HasPrefix(strings.ToLower(item.Uuid), pattern) {
+		return matchSubstring
+	}
+	return matchNone
+}
+
+func isWordSeparator(r rune) bool {
+	return strings.ContainsRune(" .-_@/()", r)
+}
+
+// frecency combines how often and how recently an item has
+// been used into a single score, so that an item used daily
+// outranks one used many times long ago
+func frecency(usage onepass.ItemUsage, now time.Time) int {
+	if usage.Count == 0 {
+		return 0
+	}
+	age := now.Sub(time.Unix(usage.LastUsed, 0))
+	day := 24 * time.Hour
+	weight := 10
+	switch {
+	case age < 4*day:
+		weight = 100
+	case age < 14*day:
+		weight = 70
+	case age < 31*day:
+		weight = 50
+	case age < 90*day:
+		weight = 30
+	}
+	return usage.Count * weight
+}
+
+// rankedItem is an item matching a pattern with its scores
+type rankedItem struct {
+	item     onepass.Item
+	quality  int
+	frecency int
+}
+
+// rankItems sorts items matching pattern by match quality and
+// then by frecency, best match first
+func rankItems(items []onepass.Item, pattern string, usage map[string]onepass.ItemUsage, now time.Time) []rankedItem {
+	ranked := make([]rankedItem, len(items))
+	for i, item := range items {
+		ranked[i] = rankedItem{
+			item:     item,
+			quality:  matchQuality(item, pattern),
+			frecency: frecency(usage[item.Uuid], now),
+		}
+	}
+	rangeutil.Sort(0, len(ranked), func(i, k int) bool {
+		a, b := ranked[i], ranked[k]
+		if a.quality != b.quality {
+			return a.quality > b.quality
+		}
+		if a.frecency != b.frecency {
+			return a.frecency > b.frecency
+		}
+		return itemLess(a.item, b.item, "title")
+	}, func(i, k int) {
+		ranked[i], ranked[k] = ranked[k], ranked[i]
+	})
+	return ranked
+}
+
+// bestMatch returns true if the first of several ranked items is
+// a clearly better match than the rest, either because it matches
+// the pattern more closely or because it is used much more often
+func bestMatch(ranked []rankedItem) bool {
+	if len(ranked) < 2 {
+		return len(ranked) == 1
+	}
+	first, second := ranked[0], ranked[1]
+	if first.quality != second.quality {
+		return true
+	}
+	return first.frecency > 0 && first.frecency >= second.frecency*frecencyDominance
+}
+
+// readUsageScores returns the usage log entries for a vault,
+// or an empty map if the log cannot be read
+func readUsageScores(vault *onepass.Vault) map[string]onepass.ItemUsage {
+	usage, err := onepass.OpenUsageLog(vault, usageLogPath(vault.Path))
+	if err != nil {
+		debugf("Unable to read usage log: %v", err)
+		return map[string]onepass.ItemUsage{}
+	}
+	return usage.Items
+}
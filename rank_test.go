@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func TestMatchQuality(t *testing.T) {
+	item := onepass.Item{Uuid: "ABCD1234", Title: "GitHub Enterprise"}
+	cases := []struct {
+		pattern string
+		quality int
+	}{
+		{"github enterprise", matchExact},
+		{"abcd1234", matchExact},
+		{"git", matchTitlePrefix},
+		{"enter", matchWordPrefix},
+		{"hub", matchSubstring},
+		{"abc", matchSubstring},
+		{"gitlab", matchNone},
+	}
+	for _, tc := range cases {
+		if quality := matchQuality(item, tc.pattern); quality != tc.quality {
+			t.Errorf("Quality of '%s' was %d, expected %d", tc.pattern, quality, tc.quality)
+		}
+	}
+}
+
+func TestFrecency(t *testing.T) {
+	now := time.Unix(100*24*60*60, 0)
+	recent := onepass.ItemUsage{LastUsed: now.Add(-time.Hour).Unix(), Count: 3}
+	old := onepass.ItemUsage{LastUsed: now.Add(-60 * 24 * time.Hour).Unix(), Count: 5}
+	if frecency(recent, now) <= frecency(old, now) {
+		t.Errorf("Recently used item should outrank older item")
+	}
+	if frecency(onepass.ItemUsage{}, now) != 0 {
+		t.Errorf("Unused item should have no frecency")
+	}
+}
+
+func TestRankItems(t *testing.T) {
+	now := time.Now()
+	personal := onepass.Item{Uuid: "aaaa", Title: "GitHub"}
+	work := onepass.Item{Uuid: "bbbb", Title: "GitHub Work"}
+	gitlab := onepass.Item{Uuid: "cccc", Title: "Gitlab"}
+	items := []onepass.Item{gitlab, work, personal}
+
+	usage := map[string]onepass.ItemUsage{
+		"bbbb": {LastUsed: now.Unix(), Count: 10},
+		"cccc": {LastUsed: now.Unix(), Count: 1},
+	}
+
+	// equally good matches are ordered by usage
+	ranked := rankItems(items, "git", usage, now)
+	if ranked[0].item.Uuid != "bbbb" || ranked[1].item.Uuid != "cccc" || ranked[2].item.Uuid != "aaaa" {
+		t.Errorf("Unexpected ranking %v", ranked)
+	}
+	if !bestMatch(ranked) {
+		t.Errorf("Frequently used item should be the best match")
+	}
+
+	// an exact match wins regardless of usage
+	ranked = rankItems(items, "github", usage, now)
+	if ranked[0].item.Uuid != "aaaa" || !bestMatch(ranked) {
+		t.Errorf("Exact match should be the best match")
+	}
+
+	// without usage, equally good matches are ambiguous
+	ranked = rankItems(items, "git", nil, now)
+	if bestMatch(ranked) {
+		t.Errorf("Unused items matching equally should be ambiguous")
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/rpc"
+	"os"
+	"strings"
+	"time"
+)
+
+// environment variables used by clients to connect
+// to an agent running on another host
+const (
+	// address of the agent, either 'host:port' for an agent
+	// started with -agent-listen or the path of a UNIX socket,
+	// such as one forwarded from the other host with 'ssh -L'
+	remoteAgentEnvVar = "ONEPASS_AGENT"
+
+	// token used to authenticate with an agent listening on
+	// a TCP port. Defaults to the contents of agentTokenPath.
+	remoteAgentTokenEnvVar = "ONEPASS_AGENT_TOKEN"
+
+	// path of the vault on the agent's host, if different
+	// from the path of the vault on the client's host
+	remoteAgentVaultEnvVar = "ONEPASS_AGENT_VAULT"
+)
+
+// file containing the token which clients must present
+// to an agent listening on a TCP port
+var agentTokenPath = homeDir() + "/.1pass-agent-token"
+
+const agentTokenLen = 32
+const handshakeNonceLen = 32
+const handshakeTimeout = 10 * time.Second
+
+// maximum size of a message sent over a remote agent connection
+const maxSecureFrameLen = 64 * 1024 * 1024
+
+var errAgentAuthFailed = errors.New("Remote agent authentication failed")
+
+func agentTokenHelp() string {
+	return `Prints the token which clients on other hosts must present to connect
+to an agent listening on a TCP port, creating it if necessary. The token
+is stored in ~/.1pass-agent-token.
+
+To keep a vault unlocked on one host and use it from others, start the
+agent on that host with:
+
+  1pass -agent -agent-listen <host:port>
+
+Then on each client host, with a copy of the vault, set:
+
+  ONEPASS_AGENT=<host:port>
+  ONEPASS_AGENT_TOKEN=<token>
+
+Both sides prove that they know the token before any request is sent and
+requests are encrypted with keys derived from it. Alternatively, forward
+the agent's socket over SSH, eg. 'ssh -L /tmp/1pass.sock:.1pass.sock host',
+and set ONEPASS_AGENT to the forwarded socket path. No token is needed
+in that case.
+
+If the vault is stored at a different path on the agent's host, set
+ONEPASS_AGENT_VAULT to that path.
+
+Flags:
+
+  -new  Replace the existing token. Clients using the old token
+        will no longer be able to connect.`
+}
+
+// readAgentToken reads the agent token from path. If create is true,
+// a new random token is generated if none exists.
+func readAgentToken(path string, create bool) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		return parseAgentToken(string(data))
+	}
+	if !os.IsNotExist(err) || !create {
+		return nil, err
+	}
+	return newAgentToken(path)
+}
+
+// errInvalidAgentToken is returned for tokens which are not the
+// hex encoding of agentTokenLen bytes. An empty or truncated token
+// must never be used as it would let anyone authenticate.
+var errInvalidAgentToken = fmt.Errorf("The agent token must be %d hex digits. Use 'agent-token -new' to generate a new one",
+	agentTokenLen*2)
+
+// parseAgentToken decodes a hex-encoded agent token
+func parseAgentToken(tokenHex string) ([]byte, error) {
+	token, err := hex.DecodeString(strings.TrimSpace(tokenHex))
+	if err != nil || len(token) != agentTokenLen {
+		return nil, errInvalidAgentToken
+	}
+	return token, nil
+}
+
+// newAgentToken generates a new agent token and saves it to path
+func newAgentToken(path string) ([]byte, error) {
+	token := make([]byte, agentTokenLen)
+	_, err := rand.Read(token)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(path, []byte(hex.EncodeToString(token)+"\n"), 0600)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// returns the HMAC of the concatenated parts, keyed with token
+func tokenMAC(token []byte, label string, parts ...[]byte) []byte {
+	mac := hmac.New(sha256.New, token)
+	mac.Write([]byte(label))
+	for _, part := range parts {
+		mac.Write(part)
+	}
+	return mac.Sum(nil)
+}
+
+// secureConn encrypts and authenticates messages sent over an
+// underlying connection using AES-GCM, with a separate key for
+// each direction
+type secureConn struct {
+	conn      net.Conn
+	readAEAD  cipher.AEAD
+	writeAEAD cipher.AEAD
+
+	// message counters, used as nonces
+	readSeq  uint64
+	writeSeq uint64
+
+	// decrypted data not yet returned by Read()
+	pending []byte
+}
+
+func newSecureConn(conn net.Conn, readKey []byte, writeKey []byte) (*secureConn, error) {
+	readAEAD, err := newAEAD(readKey)
+	if err != nil {
+		return nil, err
+	}
+	writeAEAD, err := newAEAD(writeKey)
+	if err != nil {
+		return nil, err
+	}
+	return &secureConn{conn: conn, readAEAD: readAEAD, writeAEAD: writeAEAD}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seqNonce(aead cipher.AEAD, seq uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], seq)
+	return nonce
+}
+
+func (c *secureConn) Write(data []byte) (int, error) {
+	sealed := c.writeAEAD.Seal(nil, seqNonce(c.writeAEAD, c.writeSeq), data, nil)
+	c.writeSeq++
+	frame := make([]byte, 4+len(sealed))
+	binary.BigEndian.PutUint32(frame, uint32(len(sealed)))
+	copy(frame[4:], sealed)
+	_, err := c.conn.Write(frame)
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (c *secureConn) Read(data []byte) (int, error) {
+	for len(c.pending) == 0 {
+		var header [4]byte
+		_, err := io.ReadFull(c.conn, header[:])
+		if err != nil {
+			return 0, err
+		}
+		frameLen := binary.BigEndian.Uint32(header[:])
+		if frameLen > maxSecureFrameLen {
+			return 0, errors.New("Remote agent message too large")
+		}
+		sealed := make([]byte, frameLen)
+		_, err = io.ReadFull(c.conn, sealed)
+		if err != nil {
+			return 0, err
+		}
+		c.pending, err = c.readAEAD.Open(nil, seqNonce(c.readAEAD, c.readSeq), sealed, nil)
+		if err != nil {
+			return 0, errors.New("Remote agent message failed authentication")
+		}
+		c.readSeq++
+	}
+	n := copy(data, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *secureConn) Close() error {
+	return c.conn.Close()
+}
+
+// secureHandshake authenticates both ends of conn using token and
+// returns a connection which encrypts all further messages. The
+// agent sends a random nonce, the client replies with its own nonce
+// and a MAC of both, then the agent replies with a MAC proving that
+// it also knows the token.
+func secureHandshake(conn net.Conn, token []byte, isAgent bool) (*secureConn, error) {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	agentNonce := make([]byte, handshakeNonceLen)
+	clientNonce := make([]byte, handshakeNonceLen)
+	var err error
+	if isAgent {
+		_, err = rand.Read(agentNonce)
+		if err == nil {
+			_, err = conn.Write(agentNonce)
+		}
+		if err != nil {
+			return nil, err
+		}
+		clientProof := make([]byte, sha256.Size)
+		_, err = io.ReadFull(conn, clientNonce)
+		if err == nil {
+			_, err = io.ReadFull(conn, clientProof)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !hmac.Equal(clientProof, tokenMAC(token, "client", agentNonce, clientNonce)) {
+			return nil, errAgentAuthFailed
+		}
+		_, err = conn.Write(tokenMAC(token, "agent", agentNonce, clientNonce))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		_, err = io.ReadFull(conn, agentNonce)
+		if err == nil {
+			_, err = rand.Read(clientNonce)
+		}
+		if err != nil {
+			return nil, err
+		}
+		proof := append(append([]byte{}, clientNonce...), tokenMAC(token, "client", agentNonce, clientNonce)...)
+		_, err = conn.Write(proof)
+		if err != nil {
+			return nil, err
+		}
+		agentProof := make([]byte, sha256.Size)
+		_, err = io.ReadFull(conn, agentProof)
+		if err != nil {
+			return nil, errAgentAuthFailed
+		}
+		if !hmac.Equal(agentProof, tokenMAC(token, "agent", agentNonce, clientNonce)) {
+			return nil, errAgentAuthFailed
+		}
+	}
+
+	toAgentKey := tokenMAC(token, "client-to-agent", agentNonce, clientNonce)
+	toClientKey := tokenMAC(token, "agent-to-client", agentNonce, clientNonce)
+	if isAgent {
+		return newSecureConn(conn, toAgentKey, toClientKey)
+	}
+	return newSecureConn(conn, toClientKey, toAgentKey)
+}
+
+// ServeTCP accepts connections from remote clients on a TCP address.
+// Clients must authenticate with token before making requests.
+func (agent *OnePassAgent) ServeTCP(addr string, token []byte) error {
+	if len(token) != agentTokenLen {
+		return errInvalidAgentToken
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	agent.mu.Lock()
+	agent.tcpListener = listener
+	agent.mu.Unlock()
+
+	rpcServer := rpc.NewServer()
+	rpcServer.Register(agent)
+	log.Printf("Accepting remote clients on %s", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return nil
+		}
+		go func() {
+			secure, err := secureHandshake(conn, token, true)
+			if err != nil {
+				log.Printf("Rejected remote client %s: %v", conn.RemoteAddr(), err)
+				conn.Close()
+				return
+			}
+			debugf("Accepted remote client %s", conn.RemoteAddr())
+			rpcServer.ServeConn(secure)
+		}()
+	}
+}
+
+// isSocketPath returns true if a remote agent address
+// refers to a UNIX socket rather than a TCP address
+func isSocketPath(addr string) bool {
+	return strings.HasPrefix(addr, "unix:") || strings.Contains(addr, "/")
+}
+
+// DialRemoteAgent connects to an agent at addr, which is either
+// a TCP address or the path of a forwarded UNIX socket
+func DialRemoteAgent(vaultPath string, addr string, token []byte) (OnePassAgentClient, error) {
+	if isSocketPath(addr) {
+		return DialAgentAt(vaultPath, strings.TrimPrefix(addr, "unix:"))
+	}
+	if len(token) != agentTokenLen {
+		return OnePassAgentClient{}, errInvalidAgentToken
+	}
+	conn, err := net.DialTimeout("tcp", addr, handshakeTimeout)
+	if err != nil {
+		return OnePassAgentClient{}, err
+	}
+	secure, err := secureHandshake(conn, token, false)
+	if err != nil {
+		conn.Close()
+		return OnePassAgentClient{}, err
+	}
+	return newAgentClient(rpc.NewClient(secure), vaultPath)
+}
+
+// connectRemoteAgent connects to the agent specified by the
+// ONEPASS_AGENT environment variable. Unlike local agents, remote
+// agents are never started or restarted by the client.
+func connectRemoteAgent(vaultPath string, addr string) OnePassAgentClient {
+	var token []byte
+	if !isSocketPath(addr) {
+		var err error
+		if tokenHex, ok := os.LookupEnv(remoteAgentTokenEnvVar); ok {
+			token, err = parseAgentToken(tokenHex)
+		} else {
+			token, err = readAgentToken(agentTokenPath, false)
+		}
+		if err != nil {
+			fatalErr(err, fmt.Sprintf("Unable to read agent token. Set %s to the output of 'agent-token' on the agent's host",
+				remoteAgentTokenEnvVar))
+		}
+	}
+	if remoteVault := os.Getenv(remoteAgentVaultEnvVar); remoteVault != "" {
+		vaultPath = remoteVault
+	}
+	agentClient, err := DialRemoteAgent(vaultPath, addr, token)
+	if err != nil {
+		fatalErr(err, fmt.Sprintf("Unable to connect to 1pass agent at '%s'", addr))
+	}
+	if agentClient.Protocol == 0 {
+		fatalErr(fmt.Errorf("The agent at '%s' is not compatible with this version of 1pass", addr), "")
+	}
+	return agentClient
+}
+
+func showAgentToken(replace bool) {
+	var token []byte
+	var err error
+	if replace {
+		token, err = newAgentToken(agentTokenPath)
+	} else {
+		token, err = readAgentToken(agentTokenPath, true)
+	}
+	if err != nil {
+		fatalErr(err, "Unable to read agent token")
+	}
+	fmt.Println(hex.EncodeToString(token))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+type handshakeResult struct {
+	conn *secureConn
+	err  error
+}
+
+func testHandshake(agentToken []byte, clientToken []byte) (agent handshakeResult, client handshakeResult) {
+	agentConn, clientConn := net.Pipe()
+	done := make(chan handshakeResult)
+	go func() {
+		conn, err := secureHandshake(agentConn, agentToken, true)
+		if err != nil {
+			agentConn.Close()
+		}
+		done <- handshakeResult{conn, err}
+	}()
+	conn, err := secureHandshake(clientConn, clientToken, false)
+	if err != nil {
+		clientConn.Close()
+	}
+	client = handshakeResult{conn, err}
+	agent = <-done
+	return agent, client
+}
+
+func TestRemoteAgentHandshake(t *testing.T) {
+	token := bytes.Repeat([]byte{1}, agentTokenLen)
+	agent, client := testHandshake(token, token)
+	if agent.err != nil || client.err != nil {
+		t.Fatalf("Handshake failed: %v, %v", agent.err, client.err)
+	}
+	defer agent.conn.Close()
+	defer client.conn.Close()
+
+	messages := []string{"request one", "request two"}
+	go func() {
+		for _, message := range messages {
+			client.conn.Write([]byte(message))
+		}
+	}()
+	for _, message := range messages {
+		received := make([]byte, len(message))
+		_, err := io.ReadFull(agent.conn, received)
+		if err != nil {
+			t.Fatalf("Unable to read message: %v", err)
+		}
+		if string(received) != message {
+			t.Errorf("Expected '%s', got '%s'", message, received)
+		}
+	}
+}
+
+func TestRemoteAgentWrongToken(t *testing.T) {
+	agentToken := bytes.Repeat([]byte{1}, agentTokenLen)
+	clientToken := bytes.Repeat([]byte{2}, agentTokenLen)
+	agent, client := testHandshake(agentToken, clientToken)
+	if agent.err != errAgentAuthFailed {
+		t.Errorf("Expected agent to reject client, got %v", agent.err)
+	}
+	if client.err == nil {
+		t.Errorf("Expected client handshake to fail")
+	}
+}
+
+func TestIsSocketPath(t *testing.T) {
+	for addr, expected := range map[string]bool{
+		"localhost:4567":         false,
+		"10.0.0.1:4567":          false,
+		"/tmp/1pass.sock":        true,
+		"unix:forwarded.sock":    true,
+		"./forwarded-1pass.sock": true,
+	} {
+		if isSocketPath(addr) != expected {
+			t.Errorf("Expected isSocketPath(%s) to be %v", addr, expected)
+		}
+	}
+}
+
+func TestInvalidAgentToken(t *testing.T) {
+	for _, tokenHex := range []string{"", "\n", "0102", strings.Repeat("zz", agentTokenLen)} {
+		if _, err := parseAgentToken(tokenHex); err == nil {
+			t.Errorf("Expected token '%s' to be rejected", tokenHex)
+		}
+	}
+	token, err := parseAgentToken(strings.Repeat("01", agentTokenLen) + "\n")
+	if err != nil || !bytes.Equal(token, bytes.Repeat([]byte{1}, agentTokenLen)) {
+		t.Errorf("Unable to parse valid token: %v", err)
+	}
+
+	agent := NewAgent()
+	err = agent.ServeTCP("127.0.0.1:0", nil)
+	if err != errInvalidAgentToken {
+		t.Errorf("Expected agent not to listen without a token, got: %v", err)
+	}
+	_, err = DialRemoteAgent("", "127.0.0.1:1", []byte{})
+	if err != errInvalidAgentToken {
+		t.Errorf("Expected client not to connect without a token, got: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// agentPidPath returns the path of the file in which the agent
+// serving clients at sock records its process ID, so that clients
+// can tell whether the socket was left behind by an agent which
+// has since exited
+func agentPidPath(sock string) string {
+	return sock + ".pid"
+}
+
+func writeAgentPid(sock string) error {
+	return ioutil.WriteFile(agentPidPath(sock), []byte(strconv.Itoa(os.Getpid())), 0600)
+}
+
+// readAgentPid returns the process ID recorded by the agent
+// serving clients at sock, or 0 if none was recorded
+func readAgentPid(sock string) int {
+	data, err := ioutil.ReadFile(agentPidPath(sock))
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// removeAgentPid removes the pid file for sock if it was written
+// by the current process. An agent which replaced this one via
+// Shutdown() may already have written its own.
+func removeAgentPid(sock string) {
+	if readAgentPid(sock) == os.Getpid() {
+		os.Remove(agentPidPath(sock))
+	}
+}
+
+// processRunning reports whether the process with ID pid exists
+func processRunning(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess() fails on Windows if the process has exited
+		proc.Release()
+		return true
+	}
+	err = proc.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// removeStaleAgentSocket removes the socket at sock and its pid file
+// if the agent which created them is no longer running, eg. because
+// it crashed, so that a new agent can be started in its place.
+// Returns true if the socket was stale.
+func removeStaleAgentSocket(sock string) bool {
+	pid := readAgentPid(sock)
+	if pid == 0 || processRunning(pid) {
+		return false
+	}
+	debugf("Agent (pid %d) is no longer running. Removing %s", pid, sock)
+	for _, path := range []string{sock, agentPidPath(sock)} {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			debugf("Unable to remove %s: %v", path, err)
+		}
+	}
+	return true
+}
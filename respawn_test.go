@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// exitedPid returns the ID of a process which has exited
+func exitedPid(t *testing.T) int {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	err := cmd.Run()
+	if err != nil {
+		fatalTestErr(t, "Unable to run process", err)
+	}
+	return cmd.Process.Pid
+}
+
+// createStaleSocket creates a socket at sock which no
+// process is listening on, as left by a crashed agent
+func createStaleSocket(t *testing.T, sock string) {
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		fatalTestErr(t, "Unable to create socket", err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+}
+
+func TestRemoveStaleAgentSocket(t *testing.T) {
+	dir := os.TempDir() + "/1pass-test-respawn"
+	os.RemoveAll(dir)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		fatalTestErr(t, "Unable to create test dir", err)
+	}
+	defer os.RemoveAll(dir)
+	sock := dir + "/agent.sock"
+
+	// without a pid file, the socket is left alone
+	createStaleSocket(t, sock)
+	if removeStaleAgentSocket(sock) {
+		t.Errorf("Expected socket without a pid file not to be removed")
+	}
+
+	// the socket belongs to a running agent
+	err = writeAgentPid(sock)
+	if err != nil {
+		fatalTestErr(t, "Unable to write pid file", err)
+	}
+	if removeStaleAgentSocket(sock) {
+		t.Errorf("Expected socket of running agent not to be removed")
+	}
+
+	// the agent which created the socket has exited
+	err = ioutil.WriteFile(agentPidPath(sock), []byte(strconv.Itoa(exitedPid(t))), 0600)
+	if err != nil {
+		fatalTestErr(t, "Unable to write pid file", err)
+	}
+	if !removeStaleAgentSocket(sock) {
+		t.Errorf("Expected stale socket to be removed")
+	}
+	for _, path := range []string{sock, agentPidPath(sock)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", path)
+		}
+	}
+}
+
+func TestAgentPidFile(t *testing.T) {
+	sock := os.TempDir() + "/1pass-test-agent-pid.sock"
+	agent := NewAgent()
+	done := make(chan error)
+	go func() {
+		done <- agent.ServeAt(sock)
+	}()
+	err := waitForServer(sock, 2*time.Second)
+	if err != nil {
+		fatalTestErr(t, "Unable to dial agent", err)
+	}
+	if pid := readAgentPid(sock); pid != os.Getpid() {
+		t.Errorf("Expected pid file to contain %d, got %d", os.Getpid(), pid)
+	}
+
+	agent.stop(0)
+	err = <-done
+	if err != nil {
+		fatalTestErr(t, "Agent failed", err)
+	}
+	if _, err := os.Stat(agentPidPath(sock)); !os.IsNotExist(err) {
+		t.Errorf("Expected pid file to be removed when the agent stops")
+	}
+	os.Remove(sock)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/robertknight/1pass/onepass"
+	"github.com/robertknight/1pass/rangeutil"
+)
+
+// savedSearch is a query saved with 'save-search' which
+// can be used in place of a pattern as '@<name>'
+type savedSearch struct {
+	// pattern matched against item titles and IDs, in
+	// the same format as other commands
+	Pattern string `json:",omitempty"`
+
+	// tags which matching items must all have
+	Tags []string `json:",omitempty"`
+
+	// type aliases, one of which matching items must have
+	Types []string `json:",omitempty"`
+}
+
+func (search savedSearch) String() string {
+	parts := []string{}
+	if search.Pattern != "" {
+		parts = append(parts, fmt.Sprintf("'%s'", search.Pattern))
+	}
+	for _, tag := range search.Tags {
+		parts = append(parts, "-tag "+tag)
+	}
+	for _, itemType := range search.Types {
+		parts = append(parts, "-type "+itemType)
+	}
+	if len(parts) == 0 {
+		return "all items"
+	}
+	return strings.Join(parts, " ")
+}
+
+func saveSearchHelp() string {
+	return `Saves a search which can be used in place of a pattern in other
+commands as '@<name>', eg. 'list @work' or 'copy @bank'.
+
+Items match the search if they match [pattern], have all of the tags
+given with -tag and are of one of the types given with -type. -tag and
+-type may be repeated.
+
+  save-search                   List saved searches
+  save-search <name> [pattern]  Save or replace a search
+  save-search -remove <name>    Remove a saved search`
+}
+
+// matches returns true if item has the tags and
+// one of the types required by search
+func (search savedSearch) matches(item onepass.Item) bool {
+	for _, tag := range search.Tags {
+		hasTag := rangeutil.Contains(0, len(item.OpenContents.Tags), func(i int) bool {
+			return item.OpenContents.Tags[i] == tag
+		})
+		if !hasTag {
+			return false
+		}
+	}
+	if len(search.Types) == 0 {
+		return true
+	}
+	for _, alias := range search.Types {
+		if item.TypeName == typeFromAlias(alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupSavedSearch returns the items matching
+// the search saved under name
+func lookupSavedSearch(vault *onepass.Vault, name string) ([]onepass.Item, error) {
+	search, ok := readConfig().Searches[name]
+	if !ok {
+		return nil, fmt.Errorf("No saved search named '%s'. Use 'save-search' to list saved searches", name)
+	}
+	var items []onepass.Item
+	var err error
+	if search.Pattern != "" {
+		items, err = lookupItems(vault, search.Pattern)
+	} else {
+		items, err = vault.ListItems()
+	}
+	if err != nil {
+		return nil, err
+	}
+	matches := []onepass.Item{}
+	for _, item := range items {
+		if search.matches(item) {
+			matches = append(matches, item)
+		}
+	}
+	return matches, nil
+}
+
+// saveSearch adds or replaces a saved search in config
+func saveSearch(config *clientConfig, name string, search savedSearch) error {
+	if name == "" || strings.ContainsAny(name, " @:") {
+		return fmt.Errorf("'%s' is not a valid search name", name)
+	}
+	if strings.HasPrefix(search.Pattern, "@") {
+		return fmt.Errorf("Saved searches cannot refer to other saved searches")
+	}
+	for _, alias := range search.Types {
+		if typeFromAlias(alias) == "" {
+			return fmt.Errorf("Unknown type name '%s'", alias)
+		}
+	}
+	if config.Searches == nil {
+		config.Searches = map[string]savedSearch{}
+	}
+	config.Searches[name] = search
+	return nil
+}
+
+func listSavedSearches(config clientConfig) {
+	if len(config.Searches) == 0 {
+		fmt.Printf("No saved searches\n")
+		return
+	}
+	names := []string{}
+	for name := range config.Searches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("@%s: %s\n", name, config.Searches[name])
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func TestSavedSearchMatches(t *testing.T) {
+	login := onepass.Item{Title: "Bank", TypeName: "webforms.WebForm"}
+	login.OpenContents.Tags = []string{"finance", "work"}
+	note := onepass.Item{Title: "Notes", TypeName: "securenotes.SecureNote"}
+	note.OpenContents.Tags = []string{"work"}
+
+	type testCase struct {
+		search  savedSearch
+		matches []bool
+	}
+	cases := []testCase{
+		{savedSearch{}, []bool{true, true}},
+		{savedSearch{Tags: []string{"work"}}, []bool{true, true}},
+		{savedSearch{Tags: []string{"work", "finance"}}, []bool{true, false}},
+		{savedSearch{Types: []string{"note"}}, []bool{false, true}},
+		{savedSearch{Types: []string{"login", "note"}, Tags: []string{"finance"}}, []bool{true, false}},
+	}
+	for _, tc := range cases {
+		for i, item := range []onepass.Item{login, note} {
+			if tc.search.matches(item) != tc.matches[i] {
+				t.Errorf("Expected search %s to match '%s': %v", tc.search, item.Title, tc.matches[i])
+			}
+		}
+	}
+}
+
+func TestSaveSearch(t *testing.T) {
+	config := clientConfig{}
+	err := saveSearch(&config, "work", savedSearch{Pattern: "acme", Types: []string{"login"}})
+	if err != nil {
+		t.Fatalf("Unable to save search: %v", err)
+	}
+	if config.Searches["work"].Pattern != "acme" {
+		t.Errorf("Search was not saved: %v", config.Searches)
+	}
+
+	invalid := map[string]savedSearch{
+		"":      {},
+		"a b":   {},
+		"other": {Pattern: "@work"},
+		"typo":  {Types: []string{"not-a-type"}},
+	}
+	for name, search := range invalid {
+		if saveSearch(&config, name, search) == nil {
+			t.Errorf("Expected saving '%s' (%s) to fail", name, search)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.google.com/p/go.crypto/ssh/terminal"
+	"github.com/robertknight/1pass/onepass"
+)
+
+var errSetupCancelled = errors.New("Setup cancelled")
+
+func setupHelp() string {
+	return `Asks which vault to use, offering the vaults found on this computer or
+to create a new one, and sets the clipboard timeout and the period of
+inactivity after which the vault is locked. Other vaults which were
+found can be saved as profiles for use with 'copy-to' and 'move-to'.
+The settings are saved in ~/.1pass.
+
+Setup runs automatically the first time 1pass is used from a terminal.`
+}
+
+// clipboardTimeout returns how long 'copy' keeps
+// values on the clipboard unless -timeout is given
+func (config clientConfig) clipboardTimeout() time.Duration {
+	timeout, err := time.ParseDuration(config.ClipboardTimeout)
+	if err != nil || timeout < 0 {
+		return defaultClipboardTimeout
+	}
+	return timeout
+}
+
+// autoLockDelay returns the period of inactivity
+// after which the agent locks the vault
+func (config clientConfig) autoLockDelay() time.Duration {
+	delay, err := time.ParseDuration(config.AutoLock)
+	if err != nil || delay <= 0 {
+		return defaultUnlockDelay
+	}
+	return delay
+}
+
+// setupWizard asks the user how to configure 1pass
+type setupWizard struct {
+	input *bufio.Reader
+
+	// reads a password without echoing it
+	readPassword func() ([]byte, error)
+}
+
+func newSetupWizard() *setupWizard {
+	return &setupWizard{
+		input: bufio.NewReader(os.Stdin),
+		readPassword: func() ([]byte, error) {
+			return terminal.ReadPassword(0)
+		},
+	}
+}
+
+// prompt asks a question and returns the answer, or
+// defaultValue if the user just presses Enter
+func (wizard *setupWizard) prompt(question string, defaultValue string) (string, error) {
+	if defaultValue != "" {
+		fmt.Printf("%s [%s]: ", question, defaultValue)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	line, err := wizard.input.ReadString('\n')
+	if err == io.EOF && line == "" {
+		fmt.Println()
+		return "", errSetupCancelled
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return defaultValue, nil
+	}
+	return line, nil
+}
+
+// chooseVault lists the vaults found on this computer and asks
+// the user to pick one of them, enter the path of another vault
+// or create a new one. Returns the path of the vault and whether
+// it needs to be created.
+func (wizard *setupWizard) chooseVault(candidates []string) (string, bool, error) {
+	if len(candidates) == 0 {
+		fmt.Printf("No existing vaults were found on this computer.\n")
+	} else {
+		fmt.Printf("Found the following vaults:\n\n")
+	}
+	for i, path := range candidates {
+		fmt.Printf("  %d) %s\n", i+1, path)
+	}
+	fmt.Printf("  o) Use another existing vault\n")
+	fmt.Printf("  n) Create a new vault\n\n")
+
+	defaultChoice := "n"
+	if len(candidates) > 0 {
+		defaultChoice = "1"
+	}
+	for {
+		choice, err := wizard.prompt("Vault to use", defaultChoice)
+		if err != nil {
+			return "", false, err
+		}
+		switch choice {
+		case "n":
+			path, err := wizard.prompt("Path for the new vault", homeDir()+"/Dropbox/1Password/1Password.agilekeychain")
+			if err != nil {
+				return "", false, err
+			}
+			if !strings.HasSuffix(path, ".agilekeychain") {
+				path += ".agilekeychain"
+			}
+			return path, true, nil
+		case "o":
+			path, err := wizard.prompt("Path of the vault", "")
+			if err != nil {
+				return "", false, err
+			}
+			path, err = resolveVaultPath(path)
+			if err != nil {
+				fmt.Printf("%v\n", err)
+				continue
+			}
+			return path, false, nil
+		}
+		index, err := strconv.Atoi(choice)
+		if err == nil && index >= 1 && index <= len(candidates) {
+			return candidates[index-1], false, nil
+		}
+		fmt.Printf("Enter a number from the list, 'o' or 'n'\n")
+	}
+}
+
+// chooseMasterPassword asks for the master password for a new vault,
+// showing how strong it is and asking for confirmation if it is weak
+func (wizard *setupWizard) chooseMasterPassword() (string, error) {
+	for {
+		fmt.Printf("Master password: ")
+		pwd, err := wizard.readPassword()
+		fmt.Println()
+		if err != nil {
+			return "", err
+		}
+		if len(pwd) == 0 {
+			return "", errSetupCancelled
+		}
+		bits, strength := onepass.EstimatePasswordStrength(string(pwd))
+		fmt.Printf("Password strength: %s (about %.0f bits)\n", strength, bits)
+		if strength == onepass.PasswordWeak {
+			answer, err := wizard.prompt("This password would be easy to guess. Use it anyway? y/N", "n")
+			if err != nil {
+				onepass.ZeroBytes(pwd)
+				return "", err
+			}
+			if strings.ToLower(answer) != "y" {
+				onepass.ZeroBytes(pwd)
+				fmt.Printf("Longer passwords made of several unrelated words are stronger and easy to remember.\n")
+				continue
+			}
+		}
+
+		fmt.Printf("Re-enter master password: ")
+		pwd2, err := wizard.readPassword()
+		fmt.Println()
+		if err != nil {
+			onepass.ZeroBytes(pwd)
+			return "", err
+		}
+		match := string(pwd) == string(pwd2)
+		onepass.ZeroBytes(pwd2)
+		if !match {
+			onepass.ZeroBytes(pwd)
+			fmt.Printf("Passwords do not match\n")
+			continue
+		}
+		return string(pwd), nil
+	}
+}
+
+// chooseDuration asks for a period of time, eg. '30s' or '5m'
+func (wizard *setupWizard) chooseDuration(question string, defaultValue time.Duration) (time.Duration, error) {
+	for {
+		answer, err := wizard.prompt(question, defaultValue.String())
+		if err != nil {
+			return 0, err
+		}
+		duration, err := time.ParseDuration(answer)
+		if err == nil && duration >= 0 {
+			return duration, nil
+		}
+		fmt.Printf("Enter a period such as '30s' or '5m'\n")
+	}
+}
+
+// selectVault asks the user to choose or create a vault and sets
+// it as the current vault in config. If other vaults were found,
+// the user can save them as profiles for use with 'copy-to' and
+// 'move-to'. candidates lists the existing vaults found on this
+// computer.
+func (wizard *setupWizard) selectVault(config *clientConfig, candidates []string) error {
+	path, create, err := wizard.chooseVault(candidates)
+	if err != nil {
+		return err
+	}
+	if create {
+		pwd, err := wizard.chooseMasterPassword()
+		if err != nil {
+			return err
+		}
+		_, err = onepass.NewVault(path, onepass.VaultSecurity{MasterPwd: pwd})
+		if err != nil {
+			return fmt.Errorf("Failed to create new vault: %v", err)
+		}
+		fmt.Printf("Created new vault in %s\n", path)
+	}
+	config.VaultDir = path
+
+	for _, other := range candidates {
+		if other == path || profileName(*config, other) != "" {
+			continue
+		}
+		name, err := wizard.prompt(fmt.Sprintf("Profile name for '%s' (Enter to skip)", other), "")
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+		if config.Profiles == nil {
+			config.Profiles = map[string]string{}
+		}
+		config.Profiles[name] = other
+	}
+	return nil
+}
+
+// run asks the user to choose or create a vault and to set the
+// clipboard timeout and auto-lock period, and updates config.
+// candidates lists the existing vaults found on this computer.
+func (wizard *setupWizard) run(config *clientConfig, candidates []string) error {
+	err := wizard.selectVault(config, candidates)
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+
+	timeout, err := wizard.chooseDuration("Clear copied passwords from the clipboard after", config.clipboardTimeout())
+	if err != nil {
+		return err
+	}
+	autoLock, err := wizard.chooseDuration("Lock the vault after a period of inactivity of", config.autoLockDelay())
+	if err != nil {
+		return err
+	}
+
+	config.ClipboardTimeout = timeout.String()
+	config.AutoLock = autoLock.String()
+	return nil
+}
+
+// runSetupWizard runs the setup wizard and saves the
+// resulting configuration
+func runSetupWizard(config *clientConfig) {
+	fmt.Printf("Welcome to 1pass. Answer a few questions to get started, pressing Enter to accept the defaults.\n\n")
+	err := newSetupWizard().run(config, findKeyChainDirs())
+	if err != nil {
+		fatalErr(err, "")
+	}
+	rememberVault(config, config.VaultDir)
+	writeConfig(config)
+	fmt.Printf("\nSaved settings to %s. Use '%s setup' to change them.\n", configPath, os.Args[0])
+}
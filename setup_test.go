@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func newTestWizard(input string, passwords ...string) *setupWizard {
+	return &setupWizard{
+		input: bufio.NewReader(strings.NewReader(input)),
+		readPassword: func() ([]byte, error) {
+			if len(passwords) == 0 {
+				return nil, nil
+			}
+			pwd := passwords[0]
+			passwords = passwords[1:]
+			return []byte(pwd), nil
+		},
+	}
+}
+
+func TestSetupExistingVault(t *testing.T) {
+	candidates := []string{"/first.agilekeychain", "/second.agilekeychain"}
+
+	// invalid choices are asked again and the vault
+	// which is not chosen is saved as a profile
+	wizard := newTestWizard("3\n2\nshared\n10s\n\n")
+	var config clientConfig
+	err := wizard.run(&config, candidates)
+	if err != nil {
+		fatalTestErr(t, "Setup failed", err)
+	}
+	if config.VaultDir != candidates[1] {
+		t.Errorf("Expected vault '%s', got '%s'", candidates[1], config.VaultDir)
+	}
+	if len(config.Profiles) != 1 || config.Profiles["shared"] != candidates[0] {
+		t.Errorf("Expected '%s' to be saved as profile 'shared', got %v", candidates[0], config.Profiles)
+	}
+	if config.clipboardTimeout() != 10*time.Second {
+		t.Errorf("Expected clipboard timeout of 10s, got %v", config.clipboardTimeout())
+	}
+	if config.autoLockDelay() != defaultUnlockDelay {
+		t.Errorf("Expected default auto-lock period, got %v", config.autoLockDelay())
+	}
+
+	// the first vault found is the default, naming other
+	// vaults is optional and invalid periods are asked for again
+	wizard = newTestWizard("\n\nsoon\n0s\n5m\n")
+	config = clientConfig{}
+	err = wizard.run(&config, candidates)
+	if err != nil {
+		fatalTestErr(t, "Setup failed", err)
+	}
+	if config.VaultDir != candidates[0] || config.ClipboardTimeout != "0s" || config.AutoLock != "5m0s" ||
+		len(config.Profiles) != 0 {
+		t.Errorf("Unexpected config %+v", config)
+	}
+
+	// vaults which already have a profile are not asked about
+	wizard = newTestWizard("1\n")
+	config = clientConfig{Profiles: map[string]string{"other": candidates[1]}}
+	err = wizard.selectVault(&config, candidates)
+	if err != nil || config.VaultDir != candidates[0] || len(config.Profiles) != 1 {
+		t.Errorf("Unexpected result of choosing vault: %v, %+v", err, config)
+	}
+
+	// setup is cancelled if input ends early
+	wizard = newTestWizard("1\n\n")
+	err = wizard.run(&clientConfig{}, candidates)
+	if err != errSetupCancelled {
+		t.Errorf("Expected setup to be cancelled, got %v", err)
+	}
+}
+
+func TestSetupNewVault(t *testing.T) {
+	dir := os.TempDir() + "/1pass-test-setup"
+	os.RemoveAll(dir)
+	err := os.Mkdir(dir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a weak password is rejected, then a strong
+	// password is entered but mistyped when confirmed
+	strongPwd := "correct Horse battery st4ple"
+	wizard := newTestWizard("n\n"+dir+"/new\nn\n\n\n", "password1", strongPwd, "mistyped", strongPwd, strongPwd)
+	var config clientConfig
+	err = wizard.run(&config, nil)
+	if err != nil {
+		fatalTestErr(t, "Setup failed", err)
+	}
+	expectedPath := dir + "/new.agilekeychain"
+	if config.VaultDir != expectedPath {
+		t.Errorf("Expected vault '%s', got '%s'", expectedPath, config.VaultDir)
+	}
+	vault, err := onepass.OpenVault(config.VaultDir)
+	if err != nil {
+		fatalTestErr(t, "Unable to open new vault", err)
+	}
+	err = vault.Unlock(strongPwd)
+	if err != nil {
+		fatalTestErr(t, "Unable to unlock new vault", err)
+	}
+}
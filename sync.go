@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"code.google.com/p/go.crypto/ssh/terminal"
+	"github.com/robertknight/1pass/jsonutil"
+	"github.com/robertknight/1pass/onepass"
+	"github.com/robertknight/1pass/rangeutil"
+	"github.com/robertknight/1pass/vaultsync"
+)
+
+// file storing the state of the local vault after
+// the last sync with each remote
+var syncStatePath = homeDir() + "/.1pass-sync"
+
+// map of '<vault path>|<remote>' -> sync state
+type syncStates map[string]map[string]string
+
+func syncHelp() string {
+	return fmt.Sprintf(`[remote] is either 'dropbox' or the URL of the folder containing
+a copy of the vault on a WebDAV server. If omitted, the remote set
+with 'config set sync.remote <remote>' is used.
+
+WebDAV URLs have the form 'https://dav.example.com/1Password.agilekeychain'.
+The 'webdav://' and 'webdavs://' schemes are aliases for 'http://'
+and 'https://'. A username can be included in the URL, in which case
+the password will be requested.
+
+'dropbox' syncs with a vault stored in Dropbox using the Dropbox API,
+which does not require the Dropbox desktop client to be installed.
+
+[direction] is 'pull' to download remote changes, 'push' to
+upload local changes or 'both' (the default) to do both.
+
+Only items which have changed since the last sync are transferred.
+
+Flags:
+
+  -token <token>  Dropbox API access token. Defaults to the value
+                  of the $%s environment variable.
+  -path <path>    Path of the vault in Dropbox.
+                  Defaults to '%s'.`, dropboxTokenEnvVar, vaultsync.DefaultDropboxPath)
+}
+
+// environment variable used as the default Dropbox API token
+const dropboxTokenEnvVar = "ONEPASS_DROPBOX_TOKEN"
+
+// options for sync remotes which cannot be
+// specified as part of the remote's URL
+type syncOptions struct {
+	dropboxToken string
+	dropboxPath  string
+}
+
+func newSyncBackend(remote string, options syncOptions) (vaultsync.Backend, string) {
+	if remote == "dropbox" {
+		token := options.dropboxToken
+		if token == "" {
+			token = os.Getenv(dropboxTokenEnvVar)
+		}
+		if token == "" {
+			fatalErr(fmt.Errorf("Use -token or set $%s to specify a Dropbox API access token", dropboxTokenEnvVar), "")
+		}
+		dbx := vaultsync.NewDropbox(token, options.dropboxPath)
+		return dbx, "dropbox:" + dbx.Path
+	}
+
+	dav, err := vaultsync.NewWebDAV(remote)
+	if err != nil {
+		fatalErr(err, "Unsupported sync remote")
+	}
+	if dav.Username != "" && dav.Password == "" {
+		fmt.Printf("WebDAV password for %s: ", dav.Username)
+		pwd, err := terminal.ReadPassword(0)
+		if err != nil {
+			os.Exit(1)
+		}
+		fmt.Println()
+		dav.Password = string(pwd)
+	}
+	return dav, dav.URL
+}
+
+func syncVault(vault *onepass.Vault, remote string, direction string, options syncOptions) {
+	if direction == "" {
+		direction = "both"
+	}
+	backend, remoteId := newSyncBackend(remote, options)
+
+	var states syncStates
+	_ = jsonutil.ReadFile(syncStatePath, &states)
+	if states == nil {
+		states = syncStates{}
+	}
+	stateKey := vault.Path + "|" + remoteId
+	syncer := vaultsync.NewSyncer(vault, backend, states[stateKey])
+	syncer.RemoteName = remoteId
+
+	var report vaultsync.Report
+	var err error
+	switch direction {
+	case "pull":
+		report, err = syncer.Pull()
+	case "push":
+		report, err = syncer.Push()
+	case "both":
+		report, err = syncer.Sync()
+	default:
+		fatalErr(fmt.Errorf("Unknown sync direction '%s'", direction), "")
+	}
+
+	// save the state even if the sync failed part-way through
+	// so that files which were transferred are recorded
+	states[stateKey] = syncer.State
+	stateErr := jsonutil.WriteFile(syncStatePath, states)
+
+	for _, name := range report.Downloaded {
+		fmt.Printf("Downloaded %s\n", name)
+	}
+	for _, name := range report.Uploaded {
+		fmt.Printf("Uploaded %s\n", name)
+	}
+	for _, name := range report.Conflicts {
+		fmt.Printf("Conflicting changes to %s\n", name)
+	}
+	if err != nil {
+		fatalErr(err, "Sync failed")
+	}
+	if stateErr != nil {
+		fatalErr(stateErr, "Unable to save sync state")
+	}
+
+	keysChanged := rangeutil.Contains(0, len(report.Downloaded), func(i int) bool {
+		return report.Downloaded[i] == "encryptionKeys.js"
+	})
+	if keysChanged {
+		// the agent may hold keys which have been replaced
+		agentClient, err := DialAgent(vault.Path)
+		if err == nil {
+			agentClient.Lock()
+		}
+	}
+
+	fmt.Printf("Synced with %s (%d downloaded, %d uploaded)\n", remoteId,
+		len(report.Downloaded), len(report.Uploaded))
+	if len(report.Conflicts) > 0 {
+		fmt.Printf("Some items were changed both locally and remotely. Use '%s conflicts' to list them\n", os.Args[0])
+	}
+}
+
+func resolveHelp() string {
+	return `Replaces the item with one of its conflicting revisions and
+discards the others. [revision] is the number of the revision to keep,
+as listed by 'conflicts', or 'current' (the default) to keep the
+current revision.`
+}
+
+// lists items with conflicting revisions which have not
+// been resolved. If pattern is non-empty, the content of
+// each revision of matching items is also shown.
+func listConflicts(vault *onepass.Vault, pattern string) {
+	var items []onepass.Item
+	var err error
+	if len(pattern) > 0 {
+		items, err = lookupItems(vault, pattern)
+	} else {
+		items, err = vault.ListItems()
+	}
+	if err != nil {
+		fatalErr(err, "Unable to list vault items")
+	}
+
+	found := false
+	for _, item := range items {
+		if len(item.Conflicts) == 0 {
+			continue
+		}
+		if found {
+			fmt.Println()
+		}
+		found = true
+
+		fmt.Printf("%s (%s, %s)\n", item.Title, item.Type(), shortItemId(item.Uuid))
+		fmt.Printf("  current: updated %s\n", time.Unix(int64(item.UpdatedAt), 0).Format("15:04 02/01/06"))
+		for i, conflict := range item.Conflicts {
+			fmt.Printf("  %d: '%s' from %s, updated %s\n", i+1, conflict.Title, conflict.Source,
+				time.Unix(int64(conflict.UpdatedAt), 0).Format("15:04 02/01/06"))
+		}
+		if len(pattern) == 0 {
+			continue
+		}
+
+		content, err := item.Content()
+		if err != nil {
+			fatalErr(err, fmt.Sprintf("Failed to decrypt item '%s'", item.Title))
+		}
+		fmt.Printf("\nCurrent revision:\n%s", content.String())
+		for i := range item.Conflicts {
+			content, err := item.ConflictContent(i)
+			if err != nil {
+				fatalErr(err, fmt.Sprintf("Failed to decrypt revision %d of '%s'", i+1, item.Title))
+			}
+			fmt.Printf("\nRevision %d:\n%s", i+1, content.String())
+		}
+	}
+	if !found {
+		fmt.Printf("No conflicts\n")
+	}
+}
+
+func resolveConflicts(vault *onepass.Vault, pattern string, revision string) {
+	item, err := lookupSingleItem(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Failed to find item")
+	}
+	if len(item.Conflicts) == 0 {
+		fmt.Printf("'%s' has no conflicts\n", item.Title)
+		return
+	}
+
+	keep := -1
+	if revision != "" && revision != "current" {
+		index, err := strconv.Atoi(revision)
+		if err != nil || index < 1 || index > len(item.Conflicts) {
+			fatalErr(fmt.Errorf("Revision must be 'current' or a number between 1 and %d", len(item.Conflicts)), "")
+		}
+		keep = index - 1
+	}
+
+	logItemAction("Resolving conflicts in", item)
+	undo := newUndoRecorder(vault, "resolve")
+	undo.snapshot(item)
+	err = item.ResolveConflicts(keep)
+	if err != nil {
+		fatalErr(err, "Failed to resolve conflicts")
+	}
+	undo.commit()
+}
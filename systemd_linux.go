@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// name of the systemd user units which run the agent
+const agentServiceName = "1pass-agent"
+
+// first file descriptor passed by systemd socket activation
+const listenFdsStart = 3
+
+// returns the directory containing the user's systemd units
+func systemdUserDir() string {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		configDir = homeDir() + "/.config"
+	}
+	return configDir + "/systemd/user"
+}
+
+func agentSocketUnitPath() string {
+	return systemdUserDir() + "/" + agentServiceName + ".socket"
+}
+
+func agentServiceUnitPath() string {
+	return systemdUserDir() + "/" + agentServiceName + ".service"
+}
+
+// activatedListener returns the socket passed to the agent
+// by systemd socket activation, or nil if the agent was not
+// started by systemd
+func activatedListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+	if fds > 1 {
+		return nil, fmt.Errorf("Expected one socket from systemd, got %d", fds)
+	}
+	// stop the variables being inherited by child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	file := os.NewFile(listenFdsStart, "systemd socket")
+	defer file.Close()
+	return net.FileListener(file)
+}
+
+// agentUnitFiles returns the contents of the systemd socket and
+// service units which start the agent binary at binPath when a
+// client first connects
+func agentUnitFiles(binPath string, sockPath string) (socketUnit string, serviceUnit string) {
+	socketUnit = fmt.Sprintf(`[Unit]
+Description=1pass keychain agent socket
+
+[Socket]
+ListenStream=%s
+SocketMode=0600
+
+[Install]
+WantedBy=sockets.target
+`, sockPath)
+
+	serviceUnit = fmt.Sprintf(`[Unit]
+Description=1pass keychain agent
+Requires=%s.socket
+
+[Service]
+ExecStart=%s -agent
+`, agentServiceName, strconv.Quote(binPath))
+	return socketUnit, serviceUnit
+}
+
+func systemctl(args ...string) error {
+	cmd := exec.Command("systemctl", append([]string{"--user"}, args...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// installAgentService writes systemd user units which start the
+// agent on the first connection to its socket and enables them
+func installAgentService() error {
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return errors.New("systemctl was not found. Services require systemd")
+	}
+	binPath, err := filepath.Abs(os.Args[0])
+	if err == nil {
+		binPath, err = filepath.EvalSymlinks(binPath)
+	}
+	if err != nil {
+		return err
+	}
+	socketUnit, serviceUnit := agentUnitFiles(binPath, agentConnAddr)
+	err = os.MkdirAll(systemdUserDir(), 0755)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(agentSocketUnitPath(), []byte(socketUnit), 0644)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(agentServiceUnitPath(), []byte(serviceUnit), 0644)
+	if err != nil {
+		return err
+	}
+
+	// an agent started by a previous client holds the socket path
+	if agentClient, err := DialAgent(""); err == nil {
+		agentClient.Shutdown()
+	}
+	err = systemctl("daemon-reload")
+	if err == nil {
+		err = systemctl("enable", "--now", agentServiceName+".socket")
+	}
+	return err
+}
+
+// uninstallAgentService stops and removes the agent's units
+func uninstallAgentService() error {
+	systemctl("disable", "--now", agentServiceName+".socket", agentServiceName+".service")
+	for _, path := range []string{agentSocketUnitPath(), agentServiceUnitPath()} {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return systemctl("daemon-reload")
+}
+
+// startAgentService starts the agent's systemd socket if the
+// service has been installed. Returns false if it has not.
+func startAgentService() (bool, error) {
+	if _, err := os.Stat(agentSocketUnitPath()); err != nil {
+		return false, nil
+	}
+	return true, exec.Command("systemctl", "--user", "start", agentServiceName+".socket").Run()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAgentUnitFiles(t *testing.T) {
+	socketUnit, serviceUnit := agentUnitFiles("/usr/local/bin/1pass", "/home/user/.1pass.sock")
+	if !strings.Contains(socketUnit, "ListenStream=/home/user/.1pass.sock\n") {
+		t.Errorf("Socket unit does not listen on the agent socket:\n%s", socketUnit)
+	}
+	if !strings.Contains(serviceUnit, `ExecStart="/usr/local/bin/1pass" -agent`) {
+		t.Errorf("Service unit does not start the agent:\n%s", serviceUnit)
+	}
+}
+
+func TestActivatedListener(t *testing.T) {
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	listener, err := activatedListener()
+	if listener != nil || err != nil {
+		t.Errorf("Expected no listener without socket activation")
+	}
+
+	// sockets passed to other processes are ignored
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	os.Setenv("LISTEN_FDS", "1")
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	listener, err = activatedListener()
+	if listener != nil || err != nil {
+		t.Errorf("Expected no listener for another process")
+	}
+}
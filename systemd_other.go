@@ -0,0 +1,29 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+var errNoServiceManager = errors.New("Installing the agent as a service is only supported on Linux with systemd")
+
+// activatedListener returns nil since socket activation
+// is only supported with systemd
+func activatedListener() (net.Listener, error) {
+	return nil, nil
+}
+
+func installAgentService() error {
+	return errNoServiceManager
+}
+
+func uninstallAgentService() error {
+	return errNoServiceManager
+}
+
+func startAgentService() (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/robertknight/1pass/jsonutil"
+	"github.com/robertknight/1pass/onepass"
+)
+
+// userTemplate is an item template defined in a JSON file
+// in the user's template directory. The file name, minus the
+// .json extension, is the alias used with 'add'.
+type userTemplate struct {
+	// human readable name of the item type
+	Name string `json:"name"`
+
+	// alias or type code of the standard item type used for
+	// items created from the template. Defaults to the standard
+	// type with the same alias as the template or to a secure note.
+	Type string `json:"type,omitempty"`
+
+	onepass.ItemContent
+}
+
+// returns the directory containing user-defined item templates
+func userTemplateDir() string {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		configDir = homeDir() + "/.config"
+	}
+	return configDir + "/1pass/templates"
+}
+
+func userTemplatePath(alias string) string {
+	return userTemplateDir() + "/" + alias + ".json"
+}
+
+// loadUserTemplates reads the item templates in dir,
+// keyed by alias
+func loadUserTemplates(dir string) (map[string]userTemplate, error) {
+	templates := map[string]userTemplate{}
+	paths, err := filepath.Glob(dir + "/*.json")
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		var template userTemplate
+		err := jsonutil.ReadFile(path, &template)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read item template '%s': %v", path, err)
+		}
+		alias := strings.TrimSuffix(filepath.Base(path), ".json")
+		if template.Name == "" {
+			template.Name = alias
+		}
+		templates[alias] = template
+	}
+	return templates, nil
+}
+
+// returns the type code of the standard item type with
+// the given alias or type code
+func standardItemType(alias string) (string, bool) {
+	if _, ok := onepass.ItemTypes[alias]; ok {
+		return alias, true
+	}
+	for typeName, itemType := range onepass.ItemTypes {
+		if itemType.ShortAlias == alias {
+			return typeName, true
+		}
+	}
+	return "", false
+}
+
+// findItemTemplate returns the type code and template for
+// new items of the type with the given alias. User-defined
+// templates take precedence over the standard templates.
+func findItemTemplate(alias string) (string, onepass.ItemContent, error) {
+	userTemplates, err := loadUserTemplates(userTemplateDir())
+	if err != nil {
+		return "", onepass.ItemContent{}, err
+	}
+	if template, ok := userTemplates[alias]; ok {
+		baseType := template.Type
+		if baseType == "" {
+			baseType = alias
+		}
+		typeName, ok := standardItemType(baseType)
+		if !ok && template.Type == "" {
+			typeName, ok = "securenotes.SecureNote", true
+		}
+		if !ok {
+			return "", onepass.ItemContent{}, fmt.Errorf("Unknown item type '%s' in template '%s'", template.Type, alias)
+		}
+		return typeName, template.ItemContent, nil
+	}
+
+	typeName, ok := standardItemType(alias)
+	if !ok {
+		return "", onepass.ItemContent{}, fmt.Errorf("Unknown item type '%s'", alias)
+	}
+	template, ok := onepass.StandardTemplate(typeName)
+	if !ok {
+		return "", onepass.ItemContent{}, fmt.Errorf("No template for item type '%s'", alias)
+	}
+	return typeName, template, nil
+}
+
+// returns the help text listing user-defined item types
+func userTemplatesHelp() string {
+	userTemplates, err := loadUserTemplates(userTemplateDir())
+	if err != nil || len(userTemplates) == 0 {
+		return ""
+	}
+	aliases := []string{}
+	for alias := range userTemplates {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	result := "Custom Item Types:\n\n"
+	for i, alias := range aliases {
+		if i > 0 {
+			result += "\n"
+		}
+		result += fmt.Sprintf("  %s - %s", alias, userTemplates[alias].Name)
+	}
+	return result
+}
+
+func templatesHelp() string {
+	return fmt.Sprintf(`Lists, shows or edits the templates used to create new items with 'add'.
+
+  templates list         List the standard and custom item types
+  templates show <type>  Print the template for an item type as JSON
+  templates edit <type>  Create or edit a custom template in $EDITOR
+
+Custom templates are JSON files in %s, named
+'<type>.json'. Each contains a "name" for the item type, an optional
+"type" giving the standard item type to store items as (eg. "login")
+and the "sections", web form "fields" and "URLs" of new items, in the
+same format as 'show-json'. A custom template with the same name as a
+standard item type replaces the standard template.`, userTemplateDir())
+}
+
+func listItemTemplates() {
+	fmt.Println(itemTypesHelp())
+	if custom := userTemplatesHelp(); custom != "" {
+		fmt.Printf("\n%s\n", custom)
+	}
+}
+
+func showItemTemplate(alias string) {
+	userTemplates, err := loadUserTemplates(userTemplateDir())
+	if err != nil {
+		fatalErr(err, "")
+	}
+	var data []byte
+	if template, ok := userTemplates[alias]; ok {
+		data, err = json.Marshal(template)
+	} else {
+		var template onepass.ItemContent
+		_, template, err = findItemTemplate(alias)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		data, err = json.Marshal(template)
+	}
+	if err != nil {
+		fatalErr(err, "Unable to format template")
+	}
+	fmt.Println(string(prettyJson(data)))
+}
+
+// editItemTemplate opens the custom template for alias in
+// the user's editor, creating it from the standard template
+// with the same alias if it does not already exist
+func editItemTemplate(alias string) {
+	path := userTemplatePath(alias)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		template := userTemplate{Name: alias}
+		if typeName, ok := standardItemType(alias); ok {
+			template.Name = onepass.ItemTypes[typeName].Name
+			template.ItemContent, _ = onepass.StandardTemplate(typeName)
+		} else {
+			template.Type = "note"
+			template.Sections = []onepass.ItemSection{{
+				Fields: []onepass.ItemField{{Kind: "string", Name: "field", Title: "field"}},
+			}}
+		}
+		data, err := json.Marshal(template)
+		if err != nil {
+			fatalErr(err, "Unable to create template")
+		}
+		err = os.MkdirAll(userTemplateDir(), 0700)
+		if err == nil {
+			err = ioutil.WriteFile(path, prettyJson(data), 0600)
+		}
+		if err != nil {
+			fatalErr(err, "Unable to create template")
+		}
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	cmd := exec.Command(editor, path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		fatalErr(err, fmt.Sprintf("Unable to run editor '%s'", editor))
+	}
+
+	var template userTemplate
+	err = jsonutil.ReadFile(path, &template)
+	if err != nil {
+		fatalErr(err, fmt.Sprintf("The template '%s' is not valid JSON", path))
+	}
+}
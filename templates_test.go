@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFindItemTemplate(t *testing.T) {
+	configDir, err := ioutil.TempDir("", "1pass-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(configDir)
+	os.Setenv("XDG_CONFIG_HOME", configDir)
+	defer os.Unsetenv("XDG_CONFIG_HOME")
+
+	err = os.MkdirAll(userTemplateDir(), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates := map[string]string{
+		"service": `{"name": "Service Account", "type": "server",
+		             "sections": [{"name": "", "title": "", "fields": [{"k": "string", "n": "env", "t": "environment"}]}]}`,
+		"login":  `{"fields": [{"name": "email", "type": "E", "designation": "username"}]}`,
+		"recipe": `{"name": "Recipe"}`,
+	}
+	for alias, data := range templates {
+		err = ioutil.WriteFile(userTemplatePath(alias), []byte(data), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	typeName, template, err := findItemTemplate("service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typeName != "wallet.computer.UnixServer" || len(template.Sections) != 1 ||
+		template.Sections[0].Fields[0].Title != "environment" {
+		t.Errorf("Unexpected custom template: %s %v", typeName, template)
+	}
+
+	typeName, template, err = findItemTemplate("login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typeName != "webforms.WebForm" || len(template.FormFields) != 1 || template.FormFields[0].Name != "email" {
+		t.Errorf("Expected custom template to replace standard login template: %s %v", typeName, template)
+	}
+
+	typeName, _, err = findItemTemplate("recipe")
+	if err != nil || typeName != "securenotes.SecureNote" {
+		t.Errorf("Expected custom template without a type to be a secure note: %s %v", typeName, err)
+	}
+
+	typeName, template, err = findItemTemplate("bank")
+	if err != nil || typeName != "wallet.financial.BankAccountUS" || len(template.Sections) == 0 {
+		t.Errorf("Unexpected standard template: %s %v", typeName, err)
+	}
+
+	_, _, err = findItemTemplate("unknown")
+	if err == nil {
+		t.Errorf("Expected error for unknown item type")
+	}
+}
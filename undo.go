@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+var undoJournalDir = homeDir() + "/.1pass-undo"
+
+// returns the path of the undo journal for the vault at vaultPath
+func undoJournalPath(vaultPath string) string {
+	hash := sha1.Sum([]byte(vaultPath))
+	return undoJournalDir + "/" + hex.EncodeToString(hash[:])
+}
+
+func undoHelp() string {
+	return `Reverts the most recent edit, rename, move, trash, restore, remove,
+purge, tag, metadata, expiry date or URL match change or conflict
+resolution, restoring the affected items to their previous state.
+Items created by 'add', 'duplicate', 'import' or 'receive' are
+removed again.
+Running 'undo' repeatedly steps back through earlier changes.
+
+The previous versions of items are kept in an encrypted journal
+in ~/.1pass-undo, which holds the last few changes.`
+}
+
+// undoRecorder collects copies of items before they are
+// modified by a command so that the command can be reverted
+type undoRecorder struct {
+	vault     *onepass.Vault
+	action    string
+	snapshots []onepass.Item
+	created   []string
+}
+
+func newUndoRecorder(vault *onepass.Vault, action string) *undoRecorder {
+	return &undoRecorder{vault: vault, action: action}
+}
+
+// snapshot records the current state of item.
+// This must be called before the item is changed.
+func (recorder *undoRecorder) snapshot(item onepass.Item) {
+	saved, err := recorder.vault.SnapshotItem(item.Uuid)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to save undo information for '%s': %v\n", item.Title, err)
+		return
+	}
+	recorder.snapshots = append(recorder.snapshots, saved)
+}
+
+// added records that item was added by the command,
+// so that undoing the command removes it
+func (recorder *undoRecorder) added(item onepass.Item) {
+	recorder.created = append(recorder.created, item.Uuid)
+}
+
+// commit adds the recorded snapshots and added items
+// to the vault's undo journal
+func (recorder *undoRecorder) commit() {
+	if len(recorder.snapshots)+len(recorder.created) == 0 || recorder.vault.ReadOnly ||
+		onepass.IsMemoryVaultPath(recorder.vault.Path) {
+		// in-memory vaults do not write anything to disk
+		return
+	}
+	journal, err := onepass.OpenJournal(recorder.vault, undoJournalPath(recorder.vault.Path))
+	if err == nil {
+		err = journal.Record(recorder.action, recorder.snapshots, recorder.created)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to save undo information: %v\n", err)
+	}
+}
+
+func undoLastChange(vault *onepass.Vault) {
+	journal, err := onepass.OpenJournal(vault, undoJournalPath(vault.Path))
+	if err != nil {
+		fatalErr(err, "Unable to read undo journal")
+	}
+	entry, err := journal.Undo()
+	if err != nil {
+		fatalErr(err, "Unable to undo last change")
+	}
+	fmt.Printf("Reverted '%s' of %d item(s)\n", entry.Action, len(entry.Snapshots)+len(entry.Created))
+	for _, item := range entry.Snapshots {
+		logItemAction("Restored item", item)
+	}
+	for _, uuid := range entry.Created {
+		fmt.Printf("Removed added item %s\n", shortItemId(uuid))
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/robertknight/1pass/onepass"
+	"github.com/robertknight/1pass/rangeutil"
+)
+
+func setUrlMatchHelp() string {
+	return `Sets which sites the website of the matching items is used for
+by 'for-url'. <match> is one of:
+
+  domain  Match any site with the same base domain, so that an item
+          for 'www.example.com' matches 'mail.example.com'. This is
+          the default.
+  host    Match only sites with the same host name. Use this when
+          different sites share a domain, eg. '*.corp.example.com'.
+  never   Never match any site. 1Password's browser extensions also
+          do not offer to fill these items.`
+}
+
+func forUrlHelp() string {
+	return `Lists the items whose website matches <url>, taking into account
+the setting made with 'set-url-match'. Items whose website has the same
+host name as <url> are listed first.`
+}
+
+// setUrlMatch changes the URL match setting of the items
+// matching patterns
+func setUrlMatch(vault *onepass.Vault, patterns []string, match string) {
+	items, err := lookupItemList(vault, patterns)
+	if err != nil {
+		fatalErr(err, "Unable to lookup items")
+	}
+	undo := newUndoRecorder(vault, "url-match")
+	defer undo.commit()
+	for _, item := range items {
+		undo.snapshot(item)
+		err = item.SetUrlMatch(match)
+		if err != nil {
+			fatalErr(err, "")
+		}
+		logItemAction(fmt.Sprintf("Setting URL match to '%s' for", match), item)
+		err = item.Save()
+		if err != nil {
+			fatalErr(err, fmt.Sprintf("Unable to save item '%s'", item.Title))
+		}
+	}
+}
+
+// filterForUrl returns the items in items which are not in the
+// trash and match url. Items whose website has the same host as
+// url are returned first, followed by other matches, each sorted
+// by title.
+func filterForUrl(items []onepass.Item, url string) []onepass.Item {
+	host := onepass.UrlHost(url)
+	matches := []onepass.Item{}
+	for _, item := range items {
+		if !item.Trashed && item.MatchesUrl(url) {
+			matches = append(matches, item)
+		}
+	}
+	sameHost := func(item onepass.Item) bool {
+		return onepass.UrlHost(item.Location) == host
+	}
+	rangeutil.Sort(0, len(matches), func(i, k int) bool {
+		if sameHost(matches[i]) != sameHost(matches[k]) {
+			return sameHost(matches[i])
+		}
+		return matches[i].Title < matches[k].Title
+	}, func(i, k int) {
+		matches[i], matches[k] = matches[k], matches[i]
+	})
+	return matches
+}
+
+func listItemsForUrl(vault *onepass.Vault, url string) {
+	if onepass.UrlHost(url) == "" {
+		fatalErr(fmt.Errorf("'%s' is not a valid URL", url), "")
+	}
+	items, err := vault.ListItems()
+	if err != nil {
+		fatalErr(err, "Unable to list vault items")
+	}
+	matches := filterForUrl(items, url)
+	if len(matches) == 0 {
+		fmt.Fprintf(os.Stderr, "No items match '%s'\n", url)
+		os.Exit(1)
+	}
+	for _, item := range matches {
+		fmt.Printf("%s %s\n", colorize(colorBold, item.Title),
+			colorize(colorDim, fmt.Sprintf("(%s, %s)", item.Location, shortItemId(item.Uuid))))
+	}
+}
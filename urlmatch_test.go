@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func TestFilterForUrl(t *testing.T) {
+	items := []onepass.Item{
+		{Title: "Corp SSO", Location: "https://sso.corp.example.com"},
+		{Title: "Corp Wiki", Location: "https://wiki.corp.example.com"},
+		{Title: "Another Wiki Login", Location: "wiki.corp.example.com"},
+		{Title: "Old Wiki", Location: "https://wiki.corp.example.com", Trashed: true},
+		{Title: "Other Site", Location: "https://example.org"},
+	}
+	items[0].SetUrlMatch("host")
+
+	matches := filterForUrl(items, "https://wiki.corp.example.com/page")
+	expected := []string{"Another Wiki Login", "Corp Wiki"}
+	if len(matches) != len(expected) {
+		t.Fatalf("Expected %d matches, got %d", len(expected), len(matches))
+	}
+	for i, title := range expected {
+		if matches[i].Title != title {
+			t.Errorf("Expected match %d to be '%s', got '%s'", i, title, matches[i].Title)
+		}
+	}
+
+	matches = filterForUrl(items, "https://mail.example.com")
+	if len(matches) != 2 {
+		t.Errorf("Expected items matching the base domain, got %d", len(matches))
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+	"github.com/robertknight/1pass/rangeutil"
+)
+
+var usageLogDir = homeDir() + "/.1pass-usage"
+
+// name of the usage log file within the vault when
+// the "SyncUsage" setting is enabled
+const syncedUsageLogName = "1pass-usage"
+
+// returns the path of the usage log for the vault at vaultPath
+func usageLogPath(vaultPath string) string {
+	if readConfig().SyncUsage {
+		return vaultPath + "/" + syncedUsageLogName
+	}
+	hash := sha1.Sum([]byte(vaultPath))
+	return usageLogDir + "/" + hex.EncodeToString(hash[:])
+}
+
+// recordItemUse notes that items were used by a command such as
+// 'copy' or 'show'. Failing to update the usage log does not
+// prevent the command from completing.
+func recordItemUse(vault *onepass.Vault, items ...onepass.Item) {
+	if onepass.IsMemoryVaultPath(vault.Path) {
+		return
+	}
+	usage, err := onepass.OpenUsageLog(vault, usageLogPath(vault.Path))
+	if err == nil {
+		uuids := []string{}
+		for _, item := range items {
+			uuids = append(uuids, item.Uuid)
+		}
+		err = usage.Record(time.Now(), uuids...)
+	}
+	if err != nil {
+		debugf("Unable to update usage log: %v", err)
+	}
+}
+
+// readItemUsage returns a map of item ID -> time at which
+// the item was last used, as a UNIX timestamp
+func readItemUsage(vault *onepass.Vault) (map[string]int64, error) {
+	usage, err := onepass.OpenUsageLog(vault, usageLogPath(vault.Path))
+	if err != nil {
+		return nil, err
+	}
+	lastUsed := map[string]int64{}
+	for uuid, entry := range usage.Items {
+		lastUsed[uuid] = entry.LastUsed
+	}
+	return lastUsed, nil
+}
+
+// filterUsed removes items which have not been used from items
+func filterUsed(items []onepass.Item, lastUsed map[string]int64) []onepass.Item {
+	used := []onepass.Item{}
+	for _, item := range items {
+		if lastUsed[item.Uuid] > 0 {
+			used = append(used, item)
+		}
+	}
+	return used
+}
+
+// sortByRecentUse sorts items so that the most recently used
+// items come first, followed by unused items in title order
+func sortByRecentUse(items []onepass.Item, lastUsed map[string]int64) {
+	rangeutil.Sort(0, len(items), func(i, k int) bool {
+		a, b := items[i], items[k]
+		if lastUsed[a.Uuid] != lastUsed[b.Uuid] {
+			return lastUsed[a.Uuid] > lastUsed[b.Uuid]
+		}
+		return itemLess(a, b, "title")
+	}, func(i, k int) {
+		items[i], items[k] = items[k], items[i]
+	})
+}
+
+// formatAge describes the time elapsed since
+// a UNIX timestamp, eg. '3 days' or '2 years'
+func formatAge(timestamp int64, now time.Time) string {
+	const day = 24 * 60 * 60
+	days := (now.Unix() - timestamp) / day
+	plural := func(count int64, unit string) string {
+		if count == 1 {
+			return fmt.Sprintf("1 %s", unit)
+		}
+		return fmt.Sprintf("%d %ss", count, unit)
+	}
+	switch {
+	case days < 1:
+		return "less than a day"
+	case days < 60:
+		return plural(days, "day")
+	case days < 730:
+		return plural(days/30, "month")
+	}
+	return plural(days/365, "year")
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func TestSortByRecentUse(t *testing.T) {
+	items := []onepass.Item{
+		{Uuid: "a", Title: "Alpha"},
+		{Uuid: "b", Title: "Beta"},
+		{Uuid: "c", Title: "Charlie"},
+		{Uuid: "d", Title: "Delta"},
+	}
+	lastUsed := map[string]int64{"c": 100, "b": 200}
+	sortByRecentUse(items, lastUsed)
+	order := ""
+	for _, item := range items {
+		order += item.Uuid
+	}
+	if order != "bcad" {
+		t.Errorf("Unexpected order %s", order)
+	}
+
+	used := filterUsed(items, lastUsed)
+	if len(used) != 2 || used[0].Uuid != "b" || used[1].Uuid != "c" {
+		t.Errorf("Unexpected used items %v", used)
+	}
+}
+
+func TestListSortByUsed(t *testing.T) {
+	options, err := parseListOptions("", "used", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.lastUsed = map[string]int64{"a": 100}
+	used := onepass.Item{Uuid: "a", Title: "Zulu"}
+	unused := onepass.Item{Uuid: "b", Title: "Alpha"}
+	if !options.itemLess(unused, used) {
+		t.Errorf("Unused items should sort before used items")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func vaultsHelp() string {
+	return `Lists the vaults which have been chosen with 'set-vault' or 'setup'
+or found automatically, numbered so that [number] can be used to
+switch to one of them. The current vault is marked with '*'.`
+}
+
+// expandVaultPath expands a leading '~' in path to the user's
+// home directory and makes relative paths absolute
+func expandVaultPath(path string) (string, error) {
+	if path == "~" {
+		path = homeDir()
+	} else if strings.HasPrefix(path, "~/") {
+		path = homeDir() + path[1:]
+	}
+	return filepath.Abs(path)
+}
+
+// resolveVaultPath expands path using expandVaultPath()
+// and checks that it refers to a usable vault
+func resolveVaultPath(path string) (string, error) {
+	path, err := expandVaultPath(path)
+	if err != nil {
+		return "", err
+	}
+	err = onepass.CheckVault(path)
+	if err != nil {
+		return "", fmt.Errorf("'%s' is not a usable vault: %v", path, err)
+	}
+	return path, nil
+}
+
+// rememberVault adds path to the list of vaults
+// shown by 'vaults', if it is not already there
+func rememberVault(config *clientConfig, path string) {
+	if path == "" {
+		return
+	}
+	for _, known := range config.KnownVaults {
+		if known == path {
+			return
+		}
+	}
+	config.KnownVaults = append(config.KnownVaults, path)
+}
+
+// listKnownVaults prints the vaults remembered in config,
+// marking the current one and any which no longer exist
+func listKnownVaults(config clientConfig) {
+	if len(config.KnownVaults) == 0 {
+		fmt.Printf("No vaults have been used yet. Use 'discover' to find some.\n")
+		return
+	}
+	for i, path := range config.KnownVaults {
+		marker := " "
+		if path == config.VaultDir {
+			marker = "*"
+		}
+		note := ""
+		if name := profileName(config, path); name != "" {
+			note += fmt.Sprintf(" (profile '%s')", name)
+		}
+		if _, err := os.Stat(path); err != nil {
+			note += " (missing)"
+		}
+		fmt.Printf("%s %d) %s%s\n", marker, i+1, path, note)
+	}
+}
+
+// switchKnownVault makes the vault numbered choice in
+// the list printed by listKnownVaults() current
+func switchKnownVault(config *clientConfig, choice string) error {
+	index, err := strconv.Atoi(choice)
+	if err != nil || index < 1 || index > len(config.KnownVaults) {
+		return fmt.Errorf("Unknown vault '%s'. Run 'vaults' to list the known vaults", choice)
+	}
+	path := config.KnownVaults[index-1]
+	err = onepass.CheckVault(path)
+	if err != nil {
+		return fmt.Errorf("'%s' is not a usable vault: %v", path, err)
+	}
+	config.VaultDir = path
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandVaultPath(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := map[string]string{
+		"~":                           homeDir(),
+		"~/Dropbox/1Password":         homeDir() + "/Dropbox/1Password",
+		"vault.agilekeychain":         filepath.Join(cwd, "vault.agilekeychain"),
+		"/abs/../vault.agilekeychain": "/vault.agilekeychain",
+	}
+	for path, expected := range paths {
+		actual, err := expandVaultPath(path)
+		if err != nil || actual != expected {
+			t.Errorf("Expected '%s' to expand to '%s', got '%s' (%v)", path, expected, actual, err)
+		}
+	}
+}
+
+func TestKnownVaults(t *testing.T) {
+	vault := newTestVault(t)
+	var config clientConfig
+	rememberVault(&config, "/missing.agilekeychain")
+	rememberVault(&config, vault.Path)
+	rememberVault(&config, vault.Path)
+	rememberVault(&config, "")
+	if len(config.KnownVaults) != 2 {
+		t.Fatalf("Expected 2 known vaults, got %v", config.KnownVaults)
+	}
+
+	err := switchKnownVault(&config, "2")
+	if err != nil || config.VaultDir != vault.Path {
+		t.Errorf("Expected to switch to '%s', got '%s' (%v)", vault.Path, config.VaultDir, err)
+	}
+	for _, choice := range []string{"1", "3", "first"} {
+		err = switchKnownVault(&config, choice)
+		if err == nil {
+			t.Errorf("Expected switching to vault '%s' to fail", choice)
+		}
+	}
+	if config.VaultDir != vault.Path {
+		t.Errorf("Expected current vault to be unchanged after failed switch")
+	}
+
+	_, err = resolveVaultPath("/missing.agilekeychain")
+	if err == nil {
+		t.Errorf("Expected missing vault to be rejected")
+	}
+}
@@ -0,0 +1,111 @@
+package vaultsync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// default location of the vault in Dropbox used
+// by the 1Password apps
+const DefaultDropboxPath = "/1Password/1Password.agilekeychain"
+
+const dropboxContentUrl = "https://content.dropboxapi.com/2"
+
+// Dropbox is a Backend which stores the vault in Dropbox
+// using the Dropbox HTTP API. This allows a vault to be synced
+// without the Dropbox desktop client.
+type Dropbox struct {
+	// OAuth access token for the Dropbox API
+	Token string
+
+	// Path of the vault folder in Dropbox
+	Path string
+
+	contentUrl string
+	client     *http.Client
+}
+
+func NewDropbox(token string, path string) *Dropbox {
+	if path == "" {
+		path = DefaultDropboxPath
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return &Dropbox{
+		Token:      token,
+		Path:       strings.TrimSuffix(path, "/"),
+		contentUrl: dropboxContentUrl,
+		client:     &http.Client{},
+	}
+}
+
+// sends a request to a Dropbox content endpoint. The API arguments
+// are passed as JSON in the 'Dropbox-API-Arg' header.
+func (dbx *Dropbox) request(endpoint string, args interface{}, body []byte) (*http.Response, error) {
+	argsJson, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", dbx.contentUrl+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+dbx.Token)
+	req.Header.Set("Dropbox-API-Arg", string(argsJson))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	return dbx.client.Do(req)
+}
+
+func dropboxError(endpoint string, resp *http.Response) error {
+	body, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Errorf("Dropbox %s failed: %s: %s", endpoint, resp.Status, strings.TrimSpace(string(body)))
+}
+
+func (dbx *Dropbox) Get(path string) ([]byte, error) {
+	resp, err := dbx.request("/files/download", map[string]string{
+		"path": dbx.Path + "/" + path,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		// endpoint-specific errors are reported with a 409
+		// status and a JSON body describing the error
+		var apiErr struct {
+			ErrorSummary string `json:"error_summary"`
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = json.Unmarshal(body, &apiErr)
+		if strings.HasPrefix(apiErr.ErrorSummary, "path/not_found") {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("Dropbox download of %s failed: %s", path, apiErr.ErrorSummary)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, dropboxError("download", resp)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (dbx *Dropbox) Put(path string, data []byte) error {
+	resp, err := dbx.request("/files/upload", map[string]interface{}{
+		"path": dbx.Path + "/" + path,
+		"mode": "overwrite",
+		"mute": true,
+	}, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return dropboxError("upload", resp)
+	}
+	return nil
+}
@@ -0,0 +1,457 @@
+// Package vaultsync implements syncing of 1Password vaults
+// with remote storage services.
+//
+// Only files which have changed are transferred. Items are compared
+// using the 'updatedAt' timestamps in the local and remote contents.js
+// index files and other files in the vault, such as the encryption keys,
+// are compared using content hashes recorded at the last sync.
+//
+// If an item has changed both locally and remotely since the last
+// sync, the older revision is stored as a conflict inside the newer
+// one (see onepass.Item.AddConflict) instead of being overwritten.
+//
+// Item data is transferred in its encrypted form, so the vault
+// does not need to be unlocked in order to sync it.
+package vaultsync
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+// ErrNotFound is returned by Backend.Get() if
+// the requested file does not exist
+var ErrNotFound = errors.New("File not found")
+
+// Backend is the interface to a remote storage service
+// holding a copy of a vault
+type Backend interface {
+	// Get returns the content of the file at path, relative
+	// to the root of the remote vault, or ErrNotFound if
+	// the file does not exist
+	Get(path string) ([]byte, error)
+
+	// Put replaces the content of the file at path, relative
+	// to the root of the remote vault, creating parent folders
+	// as necessary
+	Put(path string, data []byte) error
+}
+
+// path of the folder containing item data,
+// relative to the root of the vault
+const dataDir = "data/default"
+
+// files in the vault's data folder which are synced
+// by comparing their content
+var keyFiles = []string{"encryptionKeys.js", "1password.keys", ".password.hint"}
+
+// Report lists the files in the vault's data folder
+// which were transferred during a sync
+type Report struct {
+	Downloaded []string
+	Uploaded   []string
+
+	// Items which had changed both locally and remotely
+	Conflicts []string
+}
+
+// Syncer syncs a local vault with a copy stored
+// using a remote Backend
+type Syncer struct {
+	vault  *onepass.Vault
+	remote Backend
+
+	// Map of file name -> content hash of key files, or
+	// item 'updatedAt' timestamp of item files, in the
+	// vault's data folder after the last sync. This is used to
+	// determine whether the local or remote copy of a file
+	// has changed since then.
+	//
+	// The caller is responsible for persisting this
+	// between syncs.
+	State map[string]string
+
+	// Description of the remote which is recorded as the
+	// source of conflicting revisions of items
+	RemoteName string
+}
+
+func NewSyncer(vault *onepass.Vault, remote Backend, state map[string]string) Syncer {
+	if state == nil {
+		state = map[string]string{}
+	}
+	return Syncer{
+		vault:      vault,
+		remote:     remote,
+		State:      state,
+		RemoteName: "remote",
+	}
+}
+
+func contentHash(data []byte) string {
+	hash := sha1.Sum(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func (s *Syncer) localPath(name string) string {
+	return s.vault.DataDir() + "/" + name
+}
+
+// reads a file from the local vault's data folder,
+// returning nil if the file does not exist
+func (s *Syncer) readLocal(name string) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.localPath(name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// reads a file from the remote vault's data folder,
+// returning nil if the file does not exist
+func (s *Syncer) readRemote(name string) ([]byte, error) {
+	data, err := s.remote.Get(dataDir + "/" + name)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (s *Syncer) localIndex() ([]onepass.Item, error) {
+	data, err := s.readLocal("contents.js")
+	if err != nil || data == nil {
+		return []onepass.Item{}, err
+	}
+	return onepass.ParseContentsIndex(data)
+}
+
+func (s *Syncer) remoteIndex() ([]onepass.Item, error) {
+	data, err := s.readRemote("contents.js")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read remote contents.js: %v", err)
+	}
+	if data == nil {
+		return []onepass.Item{}, nil
+	}
+	return onepass.ParseContentsIndex(data)
+}
+
+// returns true if the local and remote revisions of an
+// item have both changed since the last sync
+func (s *Syncer) isConflict(localItem onepass.Item, remoteItem onepass.Item) bool {
+	if localItem.UpdatedAt == remoteItem.UpdatedAt {
+		return false
+	}
+	if localItem.TypeName == "system.Tombstone" || remoteItem.TypeName == "system.Tombstone" {
+		// removal of an item always replaces
+		// the older revision
+		return false
+	}
+	lastSynced, synced := s.State[localItem.Uuid+".1password"]
+	if !synced {
+		return false
+	}
+	return lastSynced != formatTimestamp(localItem.UpdatedAt) &&
+		lastSynced != formatTimestamp(remoteItem.UpdatedAt)
+}
+
+func formatTimestamp(timestamp uint64) string {
+	return strconv.FormatUint(timestamp, 10)
+}
+
+// merges diverged local and remote revisions of an item by storing
+// the older revision as a conflict in the newer one. The merged item
+// is saved locally and will be uploaded by the next Push().
+//
+// The local item file is only replaced when the merged item is saved,
+// so the local revision is kept if the merge fails.
+func (s *Syncer) mergeConflict(uuid string, remoteData []byte) error {
+	localItem, err := s.vault.LoadItem(uuid)
+	if err != nil {
+		return err
+	}
+	remoteItem, err := s.vault.DecodeItem(remoteData)
+	if err != nil {
+		return err
+	}
+	if remoteItem.Uuid != uuid {
+		return fmt.Errorf("Remote item file contains item %s", remoteItem.Uuid)
+	}
+
+	if localItem.UpdatedAt > remoteItem.UpdatedAt {
+		return localItem.AddConflict(remoteItem, s.RemoteName)
+	} else {
+		return remoteItem.AddConflict(localItem, "local")
+	}
+}
+
+func indexById(items []onepass.Item) map[string]onepass.Item {
+	itemMap := map[string]onepass.Item{}
+	for _, item := range items {
+		itemMap[item.Uuid] = item
+	}
+	return itemMap
+}
+
+// syncs the non-item files in the vault's data folder. If pull is true,
+// files which have changed remotely are downloaded, otherwise files
+// which have changed locally are uploaded. Fails if a file has
+// changed both locally and remotely.
+func (s *Syncer) syncKeyFiles(report *Report, pull bool) error {
+	for _, name := range keyFiles {
+		local, err := s.readLocal(name)
+		if err != nil {
+			return err
+		}
+		remote, err := s.readRemote(name)
+		if err != nil {
+			return fmt.Errorf("Unable to read remote %s: %v", name, err)
+		}
+		if local == nil && remote == nil {
+			continue
+		}
+
+		localHash := contentHash(local)
+		remoteHash := contentHash(remote)
+		if localHash == remoteHash {
+			s.State[name] = localHash
+			continue
+		}
+
+		lastHash, synced := s.State[name]
+		if synced && local != nil && remote != nil && lastHash != localHash && lastHash != remoteHash {
+			// unlike items, key files cannot be merged
+			report.Conflicts = append(report.Conflicts, name)
+			return fmt.Errorf("%s has changed both locally and remotely since the last sync, "+
+				"so the copies of the vault may now have different master passwords. "+
+				"Replace one copy's %s with the other's to resolve this", name, name)
+		}
+		if pull && remote != nil && (local == nil || !synced || lastHash == localHash) {
+			err = s.vault.WriteKeyFile(name, remote)
+			if err != nil {
+				return err
+			}
+			report.Downloaded = append(report.Downloaded, name)
+			s.State[name] = remoteHash
+		} else if !pull && local != nil && (remote == nil || !synced || lastHash == remoteHash) {
+			err = s.remote.Put(dataDir+"/"+name, local)
+			if err != nil {
+				return fmt.Errorf("Unable to upload %s: %v", name, err)
+			}
+			report.Uploaded = append(report.Uploaded, name)
+			s.State[name] = localHash
+		}
+	}
+	return nil
+}
+
+// transfers the file stored in the document item uuid, which is
+// outside the data folder, before the item itself. Documents whose
+// file is missing are skipped.
+func (s *Syncer) syncDocumentFile(uuid string, pull bool) error {
+	// the ID is checked before it is used in a local or remote path
+	localPath, err := s.vault.DocumentPath(uuid)
+	if err != nil {
+		return err
+	}
+	name := onepass.DocumentFileName(uuid)
+	if pull {
+		data, err := s.remote.Get(name)
+		if err == ErrNotFound {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("Unable to download %s: %v", name, err)
+		}
+		return s.vault.WriteDocumentFile(uuid, data)
+	}
+	data, err := ioutil.ReadFile(localPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	err = s.remote.Put(name, data)
+	if err != nil {
+		return fmt.Errorf("Unable to upload %s: %v", name, err)
+	}
+	return nil
+}
+
+// Pull downloads items and keys which have changed in
+// the remote copy of the vault
+func (s *Syncer) Pull() (Report, error) {
+	report := Report{}
+	if s.vault.ReadOnly {
+		return report, onepass.ErrReadOnly
+	}
+	err := s.syncKeyFiles(&report, true)
+	if err != nil {
+		return report, err
+	}
+
+	remoteItems, err := s.remoteIndex()
+	if err != nil {
+		return report, err
+	}
+	localItems, err := s.localIndex()
+	if err != nil {
+		return report, err
+	}
+	localMap := indexById(localItems)
+
+	updatedItems := []onepass.Item{}
+	for _, remoteItem := range remoteItems {
+		// IDs from the remote index are used in local file paths
+		if !onepass.IsValidItemId(remoteItem.Uuid) {
+			return report, fmt.Errorf("Remote contents.js lists an item with an invalid ID '%s'", remoteItem.Uuid)
+		}
+		name := remoteItem.Uuid + ".1password"
+		localItem, exists := localMap[remoteItem.Uuid]
+		conflict := exists && s.isConflict(localItem, remoteItem)
+		if exists && !conflict && localItem.UpdatedAt >= remoteItem.UpdatedAt {
+			if localItem.UpdatedAt == remoteItem.UpdatedAt {
+				s.State[name] = formatTimestamp(remoteItem.UpdatedAt)
+			}
+			continue
+		}
+		data, err := s.readRemote(name)
+		if err != nil {
+			return report, fmt.Errorf("Unable to download %s: %v", name, err)
+		}
+		if data == nil {
+			// listed in the remote index but not uploaded yet
+			continue
+		}
+		if conflict {
+			err = s.mergeConflict(remoteItem.Uuid, data)
+			if err != nil {
+				return report, fmt.Errorf("Unable to merge conflicting revisions of %s: %v", name, err)
+			}
+			report.Conflicts = append(report.Conflicts, name)
+		} else {
+			if remoteItem.TypeName == onepass.DocumentType {
+				err = s.syncDocumentFile(remoteItem.Uuid, true)
+				if err != nil {
+					return report, err
+				}
+			}
+			err = s.vault.WriteItemFile(remoteItem.Uuid, data)
+			if err != nil {
+				return report, err
+			}
+			report.Downloaded = append(report.Downloaded, name)
+			updatedItems = append(updatedItems, remoteItem)
+		}
+		s.State[name] = formatTimestamp(remoteItem.UpdatedAt)
+	}
+
+	if len(updatedItems) > 0 {
+		err = s.vault.UpdateIndex(updatedItems)
+	}
+	return report, err
+}
+
+// Push uploads items and keys which have changed
+// in the local copy of the vault
+func (s *Syncer) Push() (Report, error) {
+	report := Report{}
+	err := s.syncKeyFiles(&report, false)
+	if err != nil {
+		return report, err
+	}
+
+	localItems, err := s.localIndex()
+	if err != nil {
+		return report, err
+	}
+	remoteItems, err := s.remoteIndex()
+	if err != nil {
+		return report, err
+	}
+	remoteMap := indexById(remoteItems)
+
+	uploadedItems := 0
+	for _, localItem := range localItems {
+		name := localItem.Uuid + ".1password"
+		remoteItem, exists := remoteMap[localItem.Uuid]
+		if exists && s.isConflict(localItem, remoteItem) {
+			// the remote changes must be pulled and
+			// merged before this item can be uploaded
+			report.Conflicts = append(report.Conflicts, name)
+			continue
+		}
+		if exists && remoteItem.UpdatedAt >= localItem.UpdatedAt {
+			if localItem.UpdatedAt == remoteItem.UpdatedAt {
+				s.State[name] = formatTimestamp(localItem.UpdatedAt)
+			}
+			continue
+		}
+		data, err := s.readLocal(name)
+		if err != nil {
+			return report, err
+		}
+		if data == nil {
+			continue
+		}
+		if localItem.TypeName == onepass.DocumentType {
+			err = s.syncDocumentFile(localItem.Uuid, false)
+			if err != nil {
+				return report, err
+			}
+		}
+		err = s.remote.Put(dataDir+"/"+name, data)
+		if err != nil {
+			return report, fmt.Errorf("Unable to upload %s: %v", name, err)
+		}
+		report.Uploaded = append(report.Uploaded, name)
+		uploadedItems++
+		s.State[name] = formatTimestamp(localItem.UpdatedAt)
+
+		if !exists {
+			remoteItems = append(remoteItems, localItem)
+		} else {
+			for i, item := range remoteItems {
+				if item.Uuid == localItem.Uuid {
+					remoteItems[i] = localItem
+				}
+			}
+		}
+	}
+
+	if uploadedItems > 0 {
+		// the index is uploaded last so that other clients
+		// never see entries for items which have not been
+		// uploaded yet
+		indexData, err := onepass.FormatContentsIndex(remoteItems)
+		if err != nil {
+			return report, err
+		}
+		err = s.remote.Put(dataDir+"/contents.js", indexData)
+		if err != nil {
+			return report, fmt.Errorf("Unable to upload contents.js: %v", err)
+		}
+	}
+	return report, nil
+}
+
+// Sync pulls remote changes into the local vault and then
+// pushes local changes to the remote vault
+func (s *Syncer) Sync() (Report, error) {
+	pullReport, err := s.Pull()
+	if err != nil {
+		return pullReport, err
+	}
+	pushReport, err := s.Push()
+	return Report{
+		Downloaded: pullReport.Downloaded,
+		Uploaded:   pushReport.Uploaded,
+		Conflicts:  append(pullReport.Conflicts, pushReport.Conflicts...),
+	}, err
+}
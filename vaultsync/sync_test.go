@@ -0,0 +1,482 @@
+package vaultsync
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+// minimal in-memory WebDAV server supporting
+// the requests used by the WebDAV backend
+type testDavServer struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	dirs  map[string]bool
+}
+
+func newTestDavServer() *testDavServer {
+	return &testDavServer{
+		files: map[string][]byte{},
+		dirs:  map[string]bool{"/": true},
+	}
+}
+
+func parentDir(path string) string {
+	path = strings.TrimSuffix(path, "/")
+	return path[:strings.LastIndex(path, "/")+1]
+}
+
+func (server *testDavServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	path := req.URL.Path
+	switch req.Method {
+	case "GET":
+		data, ok := server.files[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case "PUT":
+		if !server.dirs[parentDir(path)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		data, _ := ioutil.ReadAll(req.Body)
+		server.files[path] = data
+		w.WriteHeader(http.StatusCreated)
+	case "MKCOL":
+		if !strings.HasSuffix(path, "/") {
+			path += "/"
+		}
+		if server.dirs[path] {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !server.dirs[parentDir(path)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		server.dirs[path] = true
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestVault(t *testing.T, name string) *onepass.Vault {
+	path := os.TempDir() + "/" + name + ".agilekeychain"
+	err := os.RemoveAll(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault, err := onepass.NewVault(path, onepass.VaultSecurity{MasterPwd: "test-pwd", Iterations: 100})
+	if err != nil {
+		t.Fatalf("Unable to create test vault: %v", err)
+	}
+	err = vault.Unlock("test-pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &vault
+}
+
+func TestWebDAVSync(t *testing.T) {
+	server := httptest.NewServer(newTestDavServer())
+	defer server.Close()
+
+	backend, err := NewWebDAV(server.URL + "/sync-test.agilekeychain")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vaultA := newTestVault(t, "sync-test-a")
+	item, err := vaultA.AddItem("Synced Item", "securenotes.SecureNote", onepass.ItemContent{Notes: "synced"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	syncerA := NewSyncer(vaultA, backend, nil)
+	report, err := syncerA.Push()
+	if err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if len(report.Uploaded) != 3 {
+		t.Errorf("Expected keys and item to be uploaded, uploaded: %v", report.Uploaded)
+	}
+
+	// a second push should not transfer anything
+	report, err = syncerA.Push()
+	if err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if len(report.Uploaded) != 0 {
+		t.Errorf("Unexpected uploads for unchanged vault: %v", report.Uploaded)
+	}
+
+	// pull into a second vault, which replaces its keys
+	// with those from the first vault
+	vaultB := newTestVault(t, "sync-test-b")
+	syncerB := NewSyncer(vaultB, backend, nil)
+	report, err = syncerB.Pull()
+	if err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+	if len(report.Downloaded) != 3 {
+		t.Errorf("Expected keys and item to be downloaded, downloaded: %v", report.Downloaded)
+	}
+
+	err = vaultB.Unlock("test-pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := vaultB.ListItems()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Uuid != item.Uuid {
+		t.Fatalf("Unexpected items after pull: %v", items)
+	}
+	content, err := items[0].Content()
+	if err != nil {
+		t.Fatalf("Unable to decrypt pulled item: %v", err)
+	}
+	if content.Notes != "synced" {
+		t.Errorf("Pulled content mismatch: %s", content.Notes)
+	}
+}
+
+func TestSyncDocument(t *testing.T) {
+	server := httptest.NewServer(newTestDavServer())
+	defer server.Close()
+
+	backend, err := NewWebDAV(server.URL + "/sync-document-test.agilekeychain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vaultA := newTestVault(t, "sync-document-a")
+	data := []byte("synced document")
+	item, err := vaultA.AddDocument("Synced Document", "doc.txt", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncerA := NewSyncer(vaultA, backend, nil)
+	_, err = syncerA.Push()
+	if err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+
+	vaultB := newTestVault(t, "sync-document-b")
+	syncerB := NewSyncer(vaultB, backend, nil)
+	_, err = syncerB.Pull()
+	if err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+	err = vaultB.Unlock("test-pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pulled, err := vaultB.LoadItem(item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pulledData, err := pulled.DocumentData()
+	if err != nil || string(pulledData) != string(data) {
+		t.Errorf("Unable to read pulled document: '%s' (%v)", pulledData, err)
+	}
+}
+
+// minimal in-memory implementation of the
+// Dropbox content API endpoints
+type testDropboxServer struct {
+	mu    sync.Mutex
+	token string
+	files map[string][]byte
+}
+
+func (server *testDropboxServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if req.Header.Get("Authorization") != "Bearer "+server.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var args struct {
+		Path string `json:"path"`
+	}
+	err := json.Unmarshal([]byte(req.Header.Get("Dropbox-API-Arg")), &args)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch req.URL.Path {
+	case "/files/download":
+		data, ok := server.files[args.Path]
+		if !ok {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"error_summary": "path/not_found/.."}`))
+			return
+		}
+		w.Write(data)
+	case "/files/upload":
+		data, _ := ioutil.ReadAll(req.Body)
+		server.files[args.Path] = data
+		w.Write([]byte("{}"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestDropboxSync(t *testing.T) {
+	dropboxServer := &testDropboxServer{token: "test-token", files: map[string][]byte{}}
+	server := httptest.NewServer(dropboxServer)
+	defer server.Close()
+
+	backend := NewDropbox("test-token", "")
+	backend.contentUrl = server.URL
+
+	vault := newTestVault(t, "dropbox-sync-test")
+	item, err := vault.AddItem("Dropbox Item", "securenotes.SecureNote", onepass.ItemContent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncer := NewSyncer(vault, backend, nil)
+	_, err = syncer.Sync()
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	itemPath := DefaultDropboxPath + "/data/default/" + item.Uuid + ".1password"
+	if _, ok := dropboxServer.files[itemPath]; !ok {
+		t.Errorf("Item was not uploaded to %s", itemPath)
+	}
+	if _, ok := dropboxServer.files[DefaultDropboxPath+"/data/default/contents.js"]; !ok {
+		t.Errorf("Index was not uploaded")
+	}
+
+	backend.Token = "wrong-token"
+	_, err = syncer.Pull()
+	if err == nil {
+		t.Errorf("Expected sync with invalid token to fail")
+	}
+}
+
+func editNotes(t *testing.T, vault *onepass.Vault, uuid string, notes string) {
+	item, err := vault.LoadItem(uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = item.SetContent(onepass.ItemContent{Notes: notes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = item.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncConflict(t *testing.T) {
+	server := httptest.NewServer(newTestDavServer())
+	defer server.Close()
+
+	backend, err := NewWebDAV(server.URL + "/conflict-test.agilekeychain")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vaultA := newTestVault(t, "conflict-test-a")
+	item, err := vaultA.AddItem("Conflict Item", "securenotes.SecureNote", onepass.ItemContent{Notes: "original"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncerA := NewSyncer(vaultA, backend, nil)
+	_, err = syncerA.Sync()
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	vaultB := newTestVault(t, "conflict-test-b")
+	syncerB := NewSyncer(vaultB, backend, nil)
+	syncerB.RemoteName = "test-remote"
+	_, err = syncerB.Sync()
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	err = vaultB.Unlock("test-pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// change the item in both vaults. Item timestamps have a
+	// resolution of one second, so wait between changes to
+	// make the order of the changes unambiguous.
+	time.Sleep(time.Second)
+	editNotes(t, vaultA, item.Uuid, "changed in A")
+	_, err = syncerA.Sync()
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	time.Sleep(time.Second)
+	editNotes(t, vaultB, item.Uuid, "changed in B")
+
+	report, err := syncerB.Sync()
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(report.Conflicts) != 1 {
+		t.Fatalf("Expected one conflict, got: %v", report.Conflicts)
+	}
+
+	// the newer change in B is kept and the change
+	// from A is stored as a conflicting revision
+	merged, err := vaultB.LoadItem(item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.Conflicts) != 1 || merged.Conflicts[0].Source != "test-remote" {
+		t.Fatalf("Unexpected conflicts: %v", merged.Conflicts)
+	}
+	content, err := merged.Content()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content.Notes != "changed in B" {
+		t.Errorf("Expected newer revision to be kept, got '%s'", content.Notes)
+	}
+	content, err = merged.ConflictContent(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content.Notes != "changed in A" {
+		t.Errorf("Expected older revision to be stored as a conflict, got '%s'", content.Notes)
+	}
+
+	// the merged item is uploaded and pulled into A
+	report, err = syncerA.Sync()
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(report.Conflicts) != 0 {
+		t.Errorf("Unexpected conflicts after merge: %v", report.Conflicts)
+	}
+	pulled, err := vaultA.LoadItem(item.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pulled.Conflicts) != 1 {
+		t.Errorf("Expected merged item to be pulled, conflicts: %v", pulled.Conflicts)
+	}
+
+	// resolve the conflict by keeping the revision from A
+	err = pulled.ResolveConflicts(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err = pulled.Content()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content.Notes != "changed in A" || len(pulled.Conflicts) != 0 {
+		t.Errorf("Unexpected item after resolving conflict: '%s', %v", content.Notes, pulled.Conflicts)
+	}
+}
+
+func TestSyncKeyFileConflict(t *testing.T) {
+	server := httptest.NewServer(newTestDavServer())
+	defer server.Close()
+
+	backend, err := NewWebDAV(server.URL + "/key-conflict-test.agilekeychain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vaultA := newTestVault(t, "key-conflict-test-a")
+	syncerA := NewSyncer(vaultA, backend, nil)
+	_, err = syncerA.Sync()
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	vaultB := newTestVault(t, "key-conflict-test-b")
+	syncerB := NewSyncer(vaultB, backend, nil)
+	_, err = syncerB.Sync()
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	// change the master password differently in each copy
+	err = vaultA.SetMasterPassword("test-pwd", "password-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = syncerA.Sync()
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	err = vaultB.SetMasterPassword("test-pwd", "password-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := syncerB.Sync()
+	if err == nil {
+		t.Errorf("Expected sync with conflicting key changes to fail")
+	}
+	if len(report.Conflicts) == 0 || report.Conflicts[0] != "encryptionKeys.js" {
+		t.Errorf("Expected key file conflict to be reported, got %v", report.Conflicts)
+	}
+	keys, err := onepass.UnlockKeys(vaultB.Path, "password-b")
+	if err != nil {
+		t.Errorf("Expected local keys to be kept: %v", err)
+	}
+	keys.Wipe()
+}
+
+func TestSyncInvalidItemId(t *testing.T) {
+	server := httptest.NewServer(newTestDavServer())
+	defer server.Close()
+
+	backend, err := NewWebDAV(server.URL + "/invalid-id-test.agilekeychain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	escapePath := os.TempDir() + "/1pass-sync-escape"
+	os.Remove(escapePath)
+	defer os.Remove(escapePath)
+
+	// a remote index listing an item whose ID is a path
+	// outside of the vault
+	evilId := "../../../../../../../.." + escapePath
+	index, err := onepass.FormatContentsIndex([]onepass.Item{{
+		Uuid:      evilId,
+		Title:     "Evil Document",
+		TypeName:  onepass.DocumentType,
+		UpdatedAt: 1,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = backend.Put(dataDir+"/contents.js", index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vault := newTestVault(t, "invalid-id-test")
+	syncer := NewSyncer(vault, backend, nil)
+	_, err = syncer.Pull()
+	if err == nil {
+		t.Errorf("Expected pull of item with invalid ID to fail")
+	}
+	if _, err := os.Stat(escapePath); !os.IsNotExist(err) {
+		t.Errorf("Expected no file to be written outside the vault")
+	}
+}
@@ -0,0 +1,137 @@
+package vaultsync
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WebDAV is a Backend which stores the vault
+// on a WebDAV server
+type WebDAV struct {
+	// URL of the folder on the server
+	// containing the vault
+	URL string
+
+	Username string
+	Password string
+
+	client *http.Client
+}
+
+// NewWebDAV returns a backend for the vault stored at the given URL.
+// The 'webdav://' and 'webdavs://' schemes can be used as aliases for
+// 'http://' and 'https://'. A username and password can be included
+// in the URL.
+func NewWebDAV(rawUrl string) (*WebDAV, error) {
+	vaultUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	switch vaultUrl.Scheme {
+	case "webdav":
+		vaultUrl.Scheme = "http"
+	case "webdavs":
+		vaultUrl.Scheme = "https"
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("Unsupported WebDAV URL scheme '%s'", vaultUrl.Scheme)
+	}
+
+	dav := &WebDAV{client: &http.Client{}}
+	if vaultUrl.User != nil {
+		dav.Username = vaultUrl.User.Username()
+		dav.Password, _ = vaultUrl.User.Password()
+		vaultUrl.User = nil
+	}
+	dav.URL = strings.TrimSuffix(vaultUrl.String(), "/")
+	return dav, nil
+}
+
+func (dav *WebDAV) request(method string, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, dav.URL+"/"+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if dav.Username != "" {
+		req.SetBasicAuth(dav.Username, dav.Password)
+	}
+	return dav.client.Do(req)
+}
+
+func statusError(method string, path string, resp *http.Response) error {
+	return fmt.Errorf("%s %s failed: %s", method, path, resp.Status)
+}
+
+func (dav *WebDAV) Get(path string) ([]byte, error) {
+	resp, err := dav.request("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("GET", path, resp)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (dav *WebDAV) Put(path string, data []byte) error {
+	resp, err := dav.request("PUT", path, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		// a 409 response indicates that the parent
+		// folder does not exist
+		err = dav.makeParentDirs(path)
+		if err != nil {
+			return err
+		}
+		resp, err = dav.request("PUT", path, data)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return statusError("PUT", path, resp)
+	}
+	return nil
+}
+
+// creates the folders containing path, if they
+// do not already exist
+func (dav *WebDAV) makeParentDirs(path string) error {
+	parts := strings.Split(path, "/")
+
+	// create the root folder for the vault
+	// followed by each folder in path
+	dirs := []string{""}
+	for i := 1; i < len(parts); i++ {
+		dirs = append(dirs, strings.Join(parts[:i], "/")+"/")
+	}
+	for _, dirPath := range dirs {
+		resp, err := dav.request("MKCOL", dirPath, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		// 405 (Method Not Allowed) is returned
+		// if the folder already exists
+		if resp.StatusCode != http.StatusCreated &&
+			resp.StatusCode != http.StatusMethodNotAllowed {
+			return statusError("MKCOL", dirPath, resp)
+		}
+	}
+	return nil
+}
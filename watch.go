@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+func watchHelp() string {
+	return `Prints a line for each item which is added, changed or removed
+by another program, such as a sync client, until interrupted.
+
+The 1pass agent also watches unlocked vaults and locks them if
+the encryption keys are changed by another device.`
+}
+
+func watchVault(vault *onepass.Vault) {
+	sub, err := vault.Subscribe()
+	if err != nil {
+		fatalErr(err, "Unable to watch vault for changes")
+	}
+	defer sub.Close()
+
+	fmt.Printf("Watching %s for changes\n", vault.Path)
+	for event := range sub.Events {
+		timestamp := time.Now().Format("15:04:05")
+		item := event.Item
+		switch event.Type {
+		case onepass.KeysChanged:
+			fmt.Printf("%s: Encryption keys changed\n", timestamp)
+		case onepass.ItemAdded:
+			fmt.Printf("%s: Added '%s' (%s)\n", timestamp, item.Title, shortItemId(item.Uuid))
+		case onepass.ItemUpdated:
+			fmt.Printf("%s: Updated '%s' (%s)\n", timestamp, item.Title, shortItemId(item.Uuid))
+		case onepass.ItemRemoved:
+			fmt.Printf("%s: Removed '%s' (%s)\n", timestamp, item.Title, shortItemId(item.Uuid))
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"code.google.com/p/go.crypto/ssh/terminal"
+
+	"github.com/robertknight/1pass/onepass"
+)
+
+// map of values for the 'wireless security' field of
+// router items -> authentication type used in WiFi QR codes
+var wifiSecurityTypes = map[string]string{
+	"none":  "nopass",
+	"wep":   "WEP",
+	"wpa":   "WPA",
+	"wpa2p": "WPA",
+	"wpa3":  "SAE",
+}
+
+func wifiQRHelp() string {
+	return `Prints the WIFI:S:<network>;T:<security>;P:<password>;; QR code payload
+for a Wireless Router item, which phones can scan to join the network.
+
+When run from a terminal and the 'qrencode' tool is installed, the QR
+code is drawn in the terminal. Otherwise the payload is printed so that
+it can be passed to a QR code generator.
+
+Flags:
+
+  -payload  Always print the payload instead of drawing the QR code.`
+}
+
+// returns the help text for the 'wireless security' field
+func wifiSecurityHelp() string {
+	types := []string{}
+	for securityType := range wifiSecurityTypes {
+		types = append(types, securityType)
+	}
+	sort.Strings(types)
+	return strings.Join(types, ", ")
+}
+
+// escapes special characters in a field of a WiFi QR payload
+func escapeWifiQRField(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, ":", `\:`, `"`, `\"`)
+	return replacer.Replace(value)
+}
+
+// wifiQRPayload returns the payload of a QR code which
+// phones can scan to join a WiFi network
+func wifiQRPayload(ssid string, security string, password string) (string, error) {
+	authType, ok := wifiSecurityTypes[strings.ToLower(security)]
+	if security == "" {
+		authType, ok = "WPA", true
+		if password == "" {
+			authType = "nopass"
+		}
+	}
+	if !ok {
+		return "", fmt.Errorf("Unknown wireless security type '%s'. Supported types are: %s",
+			security, wifiSecurityHelp())
+	}
+	payload := fmt.Sprintf("WIFI:S:%s;T:%s;", escapeWifiQRField(ssid), authType)
+	if authType != "nopass" {
+		payload += fmt.Sprintf("P:%s;", escapeWifiQRField(password))
+	}
+	return payload + ";", nil
+}
+
+// returns the value of the field in content named name
+func fieldValueByName(content onepass.ItemContent, name string) string {
+	for _, section := range content.Sections {
+		for _, field := range section.Fields {
+			if field.Name == name {
+				return field.ValueString()
+			}
+		}
+	}
+	return ""
+}
+
+func showWifiQR(vault *onepass.Vault, pattern string, payloadOnly bool) {
+	item, err := lookupSingleItem(vault, pattern)
+	if err != nil {
+		fatalErr(err, "Failed to find item")
+	}
+	content, err := item.Content()
+	if err != nil {
+		fatalErr(err, fmt.Sprintf("Failed to decrypt item '%s'", item.Title))
+	}
+	ssid := fieldValueByName(content, "network_name")
+	if ssid == "" {
+		fatalErr(fmt.Errorf("'%s' does not have a network name", item.Title), "")
+	}
+	payload, err := wifiQRPayload(ssid, fieldValueByName(content, "wireless_security"),
+		fieldValueByName(content, "wireless_password"))
+	if err != nil {
+		fatalErr(err, "")
+	}
+
+	if !payloadOnly && terminal.IsTerminal(1) {
+		if _, err := exec.LookPath("qrencode"); err == nil {
+			// the payload is passed via stdin so that the password
+			// is not visible in the process list
+			cmd := exec.Command("qrencode", "-t", "ANSIUTF8")
+			cmd.Stdin = strings.NewReader(payload)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			if cmd.Run() == nil {
+				return
+			}
+		}
+	}
+	fmt.Println(payload)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestWifiQRPayload(t *testing.T) {
+	cases := []struct {
+		ssid     string
+		security string
+		password string
+		payload  string
+	}{
+		{"Home", "wpa2p", "secret", "WIFI:S:Home;T:WPA;P:secret;;"},
+		{"Cafe", "none", "", "WIFI:S:Cafe;T:nopass;;"},
+		{"Cafe", "", "", "WIFI:S:Cafe;T:nopass;;"},
+		{`My;Net`, "wep", `a:b,c"d\`, `WIFI:S:My\;Net;T:WEP;P:a\:b\,c\"d\\;;`},
+	}
+	for _, c := range cases {
+		payload, err := wifiQRPayload(c.ssid, c.security, c.password)
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", c.ssid, err)
+		} else if payload != c.payload {
+			t.Errorf("Expected '%s', got '%s'", c.payload, payload)
+		}
+	}
+	if _, err := wifiQRPayload("Office", "radius", "x"); err == nil {
+		t.Errorf("Expected error for unknown security type")
+	}
+}